@@ -4,8 +4,8 @@ go 1.22.2
 
 require (
 	github.com/TobiOkanlawon/go-sanatio v0.0.0-20240424152542-709b1e16c180
-	github.com/dustin/go-humanize v1.0.1
 	github.com/go-chi/chi/v5 v5.0.11
+	github.com/go-pdf/fpdf v0.9.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/csrf v1.7.2
 	github.com/gorilla/sessions v1.2.2
@@ -13,19 +13,29 @@ import (
 const port string = "8001"
 
 func main() {
+	// maintenance commands, e.g. ./api ledger-check
+	if len(os.Args) > 1 {
+		if err := web_backend.RunCommand(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("%s failed: %s \n", os.Args[1], err)
+		}
+		return
+	}
+
 	secretKey, ok := os.LookupEnv("SECRET_KEY")
 	if !ok {
 		log.Fatalf("did not find the secret key")
 	}
-	paystackSecretKey, ok := os.LookupEnv("PAYSTACK_SECRET_KEY")
+	// BASE_URL is where the server can be reached from outside, e.g.
+	// for payment providers to send customers back to
+	baseURL, ok := os.LookupEnv("BASE_URL")
 	if !ok {
-		log.Fatalf("did not find the secret key")
+		baseURL = fmt.Sprintf("http://localhost:%s", port)
 	}
-	paystackPublicKey, ok := os.LookupEnv("PAYSTACK_PUBLIC_KEY")
-	if !ok {
-		log.Fatalf("did not find the secret key")
+	payments, err := web_backend.PaymentProvidersFromEnv(baseURL)
+	if err != nil {
+		log.Fatalf("error with setting up payments %s \n", err)
 	}
-	handlerFunc, cleanUp, err := web_backend.WebAppServer([]byte(secretKey), paystackPublicKey, paystackSecretKey)
+	handlerFunc, cleanUp, err := web_backend.WebAppServer([]byte(secretKey), baseURL, payments)
 	defer cleanUp()
 	if err != nil {
 		log.Fatalf("error with setting up server %s \n", err)
@@ -1,6 +1,20 @@
 CREATE TYPE sex_type AS ENUM ('M', 'F');
 CREATE TYPE frequency_type AS ENUM ('D', 'W', 'M', 'Y');
 CREATE TYPE status_type AS ENUM ('SUCCESSFUL', 'PENDING', 'FAILED');
+CREATE TYPE payout_purpose_type AS ENUM ('WITHDRAWAL', 'LOAN_DISBURSEMENT');
+CREATE TYPE payout_status_type AS ENUM ('PENDING', 'PROCESSING', 'SUCCESSFUL', 'FAILED', 'REVERSED');
+CREATE TYPE refund_status_type AS ENUM ('PENDING', 'PROCESSED', 'FAILED');
+CREATE TYPE dispute_status_type AS ENUM ('OPEN', 'WON', 'LOST');
+CREATE TYPE loan_status_type AS ENUM ('ACTIVE', 'REPAID', 'DEFAULTED', 'CANCELLED');
+CREATE TYPE loan_application_status_type AS ENUM ('SUBMITTED', 'UNDER_REVIEW', 'APPROVED', 'REJECTED', 'DISBURSED', 'ACTIVE', 'REPAID', 'DEFAULTED');
+CREATE TYPE loan_repayment_kind_type AS ENUM ('INSTALLMENT', 'AMOUNT', 'PAYOFF');
+CREATE TYPE interest_method_type AS ENUM ('FLAT', 'REDUCING_BALANCE');
+CREATE TYPE installment_frequency_type AS ENUM ('WEEKLY', 'MONTHLY');
+CREATE TYPE delinquency_bucket_type AS ENUM ('CURRENT', '1_30', '31_60', '61_90', '90_PLUS');
+CREATE TYPE statement_format_type AS ENUM ('CSV', 'PDF');
+CREATE TYPE loan_guarantor_status_type AS ENUM ('INVITED', 'ACCEPTED', 'DECLINED');
+CREATE TYPE investment_application_status_type AS ENUM ('DRAFT', 'PENDING', 'APPROVED', 'REJECTED');
+CREATE TYPE investment_position_status_type AS ENUM ('ACTIVE', 'MATURED', 'ROLLED_OVER');
 CREATE TYPE employment_status_type AS ENUM ('SALARIED', 'SELF-EMPLOYED', 'RETIRED', 'UNEMPLOYED');
 
 CREATE TABLE IF NOT EXISTS customer (
@@ -14,7 +28,10 @@ CREATE TABLE IF NOT EXISTS customer (
        phone_number	varchar(14)	,
        sex		sex_type		,
        date_of_birth	date		,
-       postal_address	varchar(128)	
+       postal_address	varchar(128)	,
+       -- suspended customers can't log in
+       suspended_at	timestamp	,
+       suspension_note	text		NOT NULL DEFAULT ''
 );
 
 CREATE TABLE IF NOT EXISTS password_hash (
@@ -28,7 +45,7 @@ CREATE TABLE IF NOT EXISTS password_hash (
 CREATE TABLE IF NOT EXISTS solo_savings_account (
        account_id	   serial	NOT NULL,
        customer_id	   integer	NOT NULL UNIQUE,
-       balance_in_k	   integer	NOT NULL CHECK(balance_in_k > 0),
+       balance_in_k	   integer	NOT NULL CHECK(balance_in_k >= 0),
        -- the balance is stored in kobos
        CONSTRAINT solo_savings_account_pk PRIMARY KEY(account_id)
 );
@@ -49,7 +66,7 @@ CREATE TABLE IF NOT EXISTS family_vault_plan (
        contribution_amount_in_k		    integer NOT NULL,
        savings_duration_in_d		    integer NOT NULL,
        savings_frequency		    frequency_type	NOT NULL,
-       balance_in_k	       integer	NOT NULL CHECK(balance_in_k > 0),
+       balance_in_k	       integer	NOT NULL CHECK(balance_in_k >= 0),
        is_active	       boolean	DEFAULT true,
        creator_id	       integer	NOT NULL,
        CONSTRAINT	       family_vault_plan_fk FOREIGN KEY (creator_id) REFERENCES customer (customer_id)
@@ -66,20 +83,28 @@ CREATE TABLE IF NOT EXISTS family_vault_plan_member (
 );
 
 CREATE TABLE withdrawal_application (       
+       withdrawal_application_id    serial	PRIMARY KEY,
        customer_id		    integer	NOT NULL,
+       bank_account_id		    integer	,
        amount_in_k		    integer	NOT NULL CHECK(amount_in_k > 0),
        status			    status_type	NOT NULL DEFAULT 'PENDING',
        failure_reason		    text,
        date_created		    timestamp	DEFAULT CURRENT_TIMESTAMP,
+       -- withdrawals are approved or rejected, with why, before they are paid out
+       decision_note		    text	NOT NULL DEFAULT '',
+       reviewed_by		    integer	REFERENCES customer (customer_id),
+       reviewed_at		    timestamp	,
        CONSTRAINT		    withdrawal_application_customer_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
 );
 
+CREATE INDEX IF NOT EXISTS withdrawal_application_queue_idx ON withdrawal_application (status, date_created);
+
 CREATE TABLE IF NOT EXISTS target_savings_plan (
        target_savings_plan_id	 serial NOT NULL,
        customer_id		 integer    NOT NULL,
        name		       varchar(32) NOT NULL,
        description	       varchar(128) ,
-       balance_in_k	       integer	NOT NULL CHECK(balance_in_k > 0),
+       balance_in_k	       integer	NOT NULL CHECK(balance_in_k >= 0),
        goal_in_k	       integer	NOT NULL,
        CONSTRAINT	       target_savings_plan_pk PRIMARY KEY (target_savings_plan)
 );
@@ -91,37 +116,55 @@ CREATE TABLE IF NOT EXISTS loans_account (
        CONSTRAINT loans_account_pk PRIMARY KEY(account_id)
 );
 
-CREATE TABLE IF NOT EXISTS loan_application (
-       loans_account_id	      integer	NOT NULL,
-       amount_requested_in_k  integer	NOT NULL,
-       duration_requested_in_days	integer	 NOT NULL,
-       status				status_type NOT NULL DEFAULT 'PENDING',
-       CONSTRAINT loan_application_loans_account_fk FOREIGN KEY (loans_account_id) REFERENCES loans_account (account_id)
+-- what customers can invest in
+CREATE TABLE IF NOT EXISTS investment_product (
+       investment_product_id	serial		PRIMARY KEY,
+       name			varchar(128)	NOT NULL UNIQUE,
+       -- in basis points a year
+       annual_rate_bp		integer		NOT NULL CHECK(annual_rate_bp > 0),
+       minimum_amount_in_k	bigint		NOT NULL CHECK(minimum_amount_in_k > 0),
+       tenors_in_days		integer[]	NOT NULL CHECK(cardinality(tenors_in_days) > 0),
+       active			boolean		NOT NULL DEFAULT TRUE,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS investment_application (
        investment_application_id		  serial	NOT NULL UNIQUE,
        investment_account_id			  integer	NOT NULL,
-       employment_status			  employment_status_type	 NOT NULL,
-       date_of_employment			  date				 NOT NULL,
-       employer_name				  varchar(128)			 NOT NULL,
-       tenure					  integer			 NOT NULL,
+       investment_product_id			  integer	REFERENCES investment_product (investment_product_id),
+       -- drafts can be saved before every field is filled in
+       employment_status			  employment_status_type	 ,
+       date_of_employment			  date				 ,
+       employer_name				  varchar(128)			 ,
+       tenure					  integer			 ,
        -- this tracks whether the admin has accepted the investment request or not
-       status					  status_type			 NOT NULL DEFAULT 'PENDING',
+       status					  investment_application_status_type	 NOT NULL DEFAULT 'DRAFT',
        -- tax identification number
-       tin    bigint NOT NULL,
-       bank_account_name  varchar(64)	NOT NULL,
-       bank_account_number		bigint	NOT NULL,
+       tin    varchar(13) ,
+       bank_account_name  varchar(64)	,
+       bank_account_number		varchar(10)	,
        amount_in_k			bigint NOT NULL DEFAULT 0,
+       created_at			timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       submitted_at			timestamp	,
+       decision_note			text		NOT NULL DEFAULT '',
+       reviewed_by			integer		REFERENCES customer (customer_id),
+       reviewed_at			timestamp	,
+       updated_at			timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
        -- TODO: Remove that default when we fix the migraitions
        CONSTRAINT investment_application_pk PRIMARY KEY(investment_application_id),
        CONSTRAINT investment_account_fk	FOREIGN KEY (investment_account_id) REFERENCES investment_account (account_id)
 );     
 
+-- a customer has one draft, and one application waiting to be reviewed, at a time
+CREATE UNIQUE INDEX IF NOT EXISTS investment_application_draft_idx ON investment_application (investment_account_id)
+WHERE status = 'DRAFT';
+CREATE UNIQUE INDEX IF NOT EXISTS investment_application_pending_idx ON investment_application (investment_account_id)
+WHERE status = 'PENDING';
+
 CREATE TABLE IF NOT EXISTS investment_account (
        customer_id 		integer	NOT NULL,
        account_id		serial 	NOT NULL,
-       balance_in_k		integer NOT NULL CHECK(balance_in_k > 0),
+       balance_in_k		integer NOT NULL CHECK(balance_in_k >= 0),
        CONSTRAINT investment_account_pk PRIMARY KEY(account_id)
 );
 
@@ -154,13 +197,18 @@ CREATE TABLE payment_processor_transaction (
     reference_number 			   UUID UNIQUE NOT NULL,
     payment_originator 			   payment_originator_type NOT NULL,
     payment_amount_in_k 		   integer 		   NOT NULL,
-    -- we have this f_st.. field because of potential failures trying to fulfill the payment. We can then use this to implement refunds
+    -- the provider the payment was initialized with, which is the one that verifies it
+    payment_provider			   varchar(32)	NOT NULL DEFAULT 'paystack',
+    -- we have this f_st.. field because of potential failures trying to fulfill the payment. Payments that fail to be fulfilled are refunded
     fulfillment_status			   status_type NOT NULL DEFAULT 'PENDING',
     fulfillment_failure_reason		   	       text,
     verification_status 		   status_type NOT NULL DEFAULT 'PENDING',
     verification_failure_reason			       text,
     created_at 				   timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL,
     verified_at 			   timestamp DEFAULT NULL,
+    -- set when the reconciliation job can't settle a pending payment and an admin has to look at it
+    flagged_at 				   timestamp DEFAULT NULL,
+    flag_reason				   text,
     CONSTRAINT payment_processor_transaction_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
 );
 
@@ -177,20 +225,419 @@ CREATE TABLE IF NOT EXISTS next_of_kin (
        CONSTRAINT next_of_kin_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
 );
 
--- CREATE TABLE IF NOT EXISTS account_suspension (
---        customer_id		   integer	NOT NULL,
---        suspension_status   boolean	NOT NULL,
--- );
-
 CREATE TABLE IF NOT EXISTS admin_user (
        admin_user_id	serial		PRIMARY KEY UNIQUE,
        customer_id 	integer		UNIQUE NOT NULL,
        CONSTRAINT admin_user_customer_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
 );
 
+CREATE TABLE IF NOT EXISTS admin_role (
+       admin_role_id	serial		PRIMARY KEY,
+       name		varchar(64)	UNIQUE NOT NULL,
+       description	text		NOT NULL DEFAULT ''
+);
+
+-- permissions are defined in code, e.g. loans.approve. The super-admin role has every permission without them being listed here.
+CREATE TABLE IF NOT EXISTS admin_role_permission (
+       admin_role_id	integer		NOT NULL REFERENCES admin_role (admin_role_id) ON DELETE CASCADE,
+       permission	varchar(64)	NOT NULL,
+       PRIMARY KEY (admin_role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS admin_user_role (
+       admin_user_id	integer		NOT NULL REFERENCES admin_user (admin_user_id) ON DELETE CASCADE,
+       admin_role_id	integer		NOT NULL REFERENCES admin_role (admin_role_id),
+       -- the admin that assigned the role
+       assigned_by	integer		REFERENCES customer (customer_id),
+       assigned_at	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       PRIMARY KEY (admin_user_id, admin_role_id)
+);
+
+INSERT INTO admin_role (name, description) VALUES
+       ('super-admin', 'Everything, including assigning roles to other admins'),
+       ('loan-officer', 'Reviews and disburses loan applications, and follows up overdue loans'),
+       ('investment-officer', 'Manages investment products and reviews investment applications'),
+       ('operations', 'Approves withdrawals, refunds payments and replays webhooks'),
+       ('support', 'Looks up customers and what they have asked for, and suspends accounts'),
+       ('auditor', 'Sees everything, but can''t change anything')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO admin_role_permission (admin_role_id, permission)
+SELECT r.admin_role_id, p.permission
+FROM admin_role r
+JOIN (VALUES
+       ('loan-officer', 'loans.view'),
+       ('loan-officer', 'loans.approve'),
+       ('loan-officer', 'reports.view'),
+       ('loan-officer', 'users.view'),
+       ('investment-officer', 'investments.view'),
+       ('investment-officer', 'investments.manage'),
+       ('investment-officer', 'investments.approve'),
+       ('investment-officer', 'users.view'),
+       ('operations', 'withdrawals.view'),
+       ('operations', 'withdrawals.approve'),
+       ('operations', 'payments.view'),
+       ('operations', 'payments.refund'),
+       ('operations', 'webhooks.replay'),
+       ('operations', 'balances.adjust'),
+       ('operations', 'users.view'),
+       ('support', 'loans.view'),
+       ('support', 'investments.view'),
+       ('support', 'withdrawals.view'),
+       ('support', 'payments.view'),
+       ('support', 'users.view'),
+       ('support', 'users.suspend'),
+       ('auditor', 'loans.view'),
+       ('auditor', 'investments.view'),
+       ('auditor', 'withdrawals.view'),
+       ('auditor', 'payments.view'),
+       ('auditor', 'users.view'),
+       ('auditor', 'reports.view')
+) AS p (role, permission) ON p.role = r.name
+ON CONFLICT DO NOTHING;
+
 CREATE TABLE IF NOT EXISTS bvn (
        customer_id	integer		UNIQUE NOT NULL,
-       bvn		integer		UNIQUE NOT NULL,
+       bvn		bigint		UNIQUE NOT NULL,
        is_verified	boolean		DEFAULT FALSE NOT NULL,
        CONSTRAINT bvn_customer_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
 );
+
+CREATE TYPE ledger_account_type AS ENUM ('ASSET', 'LIABILITY', 'EQUITY', 'INCOME', 'EXPENSE');
+CREATE TYPE ledger_direction_type AS ENUM ('DEBIT', 'CREDIT');
+
+CREATE TABLE IF NOT EXISTS ledger_account (
+       ledger_account_id	serial			PRIMARY KEY,
+       code			varchar(64)		UNIQUE NOT NULL,
+       account_type		ledger_account_type	NOT NULL,
+       customer_id		integer			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CONSTRAINT ledger_account_customer_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_transaction (
+       ledger_transaction_id	serial		PRIMARY KEY,
+       -- the idempotency key stops the same business event from being journalled twice
+       idempotency_key		varchar(128)	UNIQUE NOT NULL,
+       description		text		NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entry (
+       ledger_entry_id		serial			PRIMARY KEY,
+       ledger_transaction_id	integer			NOT NULL,
+       ledger_account_id	integer			NOT NULL,
+       direction		ledger_direction_type	NOT NULL,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CONSTRAINT ledger_entry_transaction_fk FOREIGN KEY (ledger_transaction_id) REFERENCES ledger_transaction (ledger_transaction_id),
+       CONSTRAINT ledger_entry_account_fk FOREIGN KEY (ledger_account_id) REFERENCES ledger_account (ledger_account_id)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entry_account_idx ON ledger_entry (ledger_account_id);
+
+-- journal rows are never changed. Mistakes are fixed with a reversing journal
+CREATE OR REPLACE FUNCTION ledger_is_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transaction_immutable BEFORE UPDATE OR DELETE ON ledger_transaction FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
+CREATE TRIGGER ledger_entry_immutable BEFORE UPDATE OR DELETE ON ledger_entry FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
+
+CREATE TABLE IF NOT EXISTS webhook_event (
+       webhook_event_id		serial		PRIMARY KEY,
+       provider			varchar(32)	NOT NULL,
+       -- the provider's id for the event. Providers resend events, so this is unique per provider
+       event_id			varchar(128)	NOT NULL,
+       event_type		varchar(64)	NOT NULL,
+       payload			bytea		NOT NULL,
+       signature		text		,
+       signature_valid		boolean		NOT NULL,
+       status			status_type	NOT NULL DEFAULT 'PENDING',
+       failure_reason		text		,
+       attempts			integer		NOT NULL DEFAULT 0,
+       received_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       processed_at		timestamp	DEFAULT NULL
+);
+
+-- events with a bad signature are kept for inspection, but can't claim an event id
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_event_provider_event_idx ON webhook_event (provider, event_id) WHERE signature_valid;
+CREATE INDEX IF NOT EXISTS webhook_event_status_idx ON webhook_event (status, received_at);
+
+CREATE INDEX IF NOT EXISTS payment_processor_transaction_pending_idx ON payment_processor_transaction (verification_status, created_at);
+
+CREATE TABLE IF NOT EXISTS payment_reconciliation_report (
+       report_id		serial		PRIMARY KEY,
+       provider			varchar(32)	NOT NULL,
+       report_date		date		NOT NULL,
+       matched_count		integer		NOT NULL,
+       discrepancies		jsonb		NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (provider, report_date)
+);
+
+CREATE TABLE IF NOT EXISTS customer_bank_account (
+       bank_account_id		serial		PRIMARY KEY,
+       customer_id		integer		NOT NULL REFERENCES customer (customer_id),
+       bank_code		varchar(8)	NOT NULL,
+       account_number		char(10)	NOT NULL,
+       account_name		varchar(128)	NOT NULL,
+       -- the provider that knows the account as recipient_code
+       recipient_provider	varchar(32)	NOT NULL,
+       recipient_code		varchar(128)	NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (customer_id, bank_code, account_number)
+);
+
+CREATE TABLE IF NOT EXISTS payout (
+       payout_id		serial			PRIMARY KEY,
+       -- sent to the provider with the transfer, which makes it idempotent
+       reference		uuid			NOT NULL UNIQUE,
+       customer_id		integer			NOT NULL REFERENCES customer (customer_id),
+       bank_account_id		integer			NOT NULL REFERENCES customer_bank_account (bank_account_id),
+       purpose			payout_purpose_type	NOT NULL,
+       -- the withdrawal application or loan application that is paid out
+       source_id		integer			NOT NULL,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       provider			varchar(32)		NOT NULL,
+       provider_transfer_id	varchar(128)		,
+       status			payout_status_type	NOT NULL DEFAULT 'PENDING',
+       failure_reason		text			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       updated_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a payout that failed or was reversed doesn't stop what it paid out being paid again
+CREATE UNIQUE INDEX IF NOT EXISTS payout_open_source_idx ON payout (purpose, source_id) WHERE status NOT IN ('FAILED', 'REVERSED');
+
+CREATE TABLE IF NOT EXISTS payment_refund (
+       refund_id		serial			PRIMARY KEY,
+       -- ours, so that a refund can be told apart from others of the same payment
+       reference		uuid			NOT NULL UNIQUE,
+       payment_reference	uuid			NOT NULL REFERENCES payment_processor_transaction (reference_number),
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       reason			text			NOT NULL,
+       -- admin:<id>, or system for refunds of payments that couldn't be fulfilled
+       initiated_by		varchar(64)		NOT NULL,
+       provider			varchar(32)		NOT NULL,
+       provider_refund_id	varchar(128)		,
+       status			refund_status_type	NOT NULL DEFAULT 'PENDING',
+       -- whether the amount was taken out of the account the payment went into
+       held			boolean			NOT NULL DEFAULT false,
+       failure_reason		text			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       updated_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS payment_dispute (
+       dispute_id		serial			PRIMARY KEY,
+       provider			varchar(32)		NOT NULL,
+       provider_dispute_id	varchar(128)		NOT NULL,
+       payment_reference	uuid			NOT NULL REFERENCES payment_processor_transaction (reference_number),
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       reason			text			,
+       status			dispute_status_type	NOT NULL DEFAULT 'OPEN',
+       -- false when the customer didn't have the money when the dispute was opened
+       held			boolean			NOT NULL DEFAULT false,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       resolved_at		timestamp		,
+       UNIQUE (provider, provider_dispute_id)
+);
+
+-- who did what to money, and why. Like the ledger, it is never changed
+CREATE TABLE IF NOT EXISTS audit_log (
+       audit_log_id		serial		PRIMARY KEY,
+       actor			varchar(64)	NOT NULL,
+       action			varchar(64)	NOT NULL,
+       subject			varchar(128)	NOT NULL,
+       detail			text		NOT NULL DEFAULT '',
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_subject_idx ON audit_log (subject, created_at);
+
+CREATE TRIGGER audit_log_immutable BEFORE UPDATE OR DELETE ON audit_log FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
+
+CREATE TABLE IF NOT EXISTS loan (
+       loan_id			serial			PRIMARY KEY,
+       customer_id		integer			NOT NULL REFERENCES customer (customer_id),
+       principal_in_k		bigint			NOT NULL CHECK(principal_in_k > 0),
+       status			loan_status_type	NOT NULL DEFAULT 'ACTIVE',
+       -- rates are in basis points
+       interest_method		interest_method_type	NOT NULL DEFAULT 'FLAT',
+       monthly_rate_bp		integer			NOT NULL DEFAULT 400 CHECK(monthly_rate_bp >= 0),
+       fee_rate_bp		integer			NOT NULL DEFAULT 0 CHECK(fee_rate_bp >= 0),
+       installment_frequency	installment_frequency_type NOT NULL DEFAULT 'MONTHLY',
+       days_past_due		integer			NOT NULL DEFAULT 0 CHECK(days_past_due >= 0),
+       delinquency_bucket	delinquency_bucket_type	NOT NULL DEFAULT 'CURRENT',
+       disbursed_at		timestamp		,
+       repaid_at		timestamp		,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a customer repays one loan at a time
+CREATE UNIQUE INDEX IF NOT EXISTS loan_active_customer_idx ON loan (customer_id) WHERE status IN ('ACTIVE', 'DEFAULTED');
+
+CREATE INDEX IF NOT EXISTS loan_overdue_idx ON loan (days_past_due) WHERE status = 'ACTIVE' AND days_past_due > 0;
+
+CREATE TABLE IF NOT EXISTS loan_installment (
+       loan_installment_id	serial		PRIMARY KEY,
+       loan_id			integer		NOT NULL REFERENCES loan (loan_id),
+       installment_number	integer		NOT NULL CHECK(installment_number > 0),
+       due_date			date		NOT NULL,
+       principal_due_in_k	bigint		NOT NULL CHECK(principal_due_in_k >= 0),
+       interest_due_in_k	bigint		NOT NULL CHECK(interest_due_in_k >= 0),
+       -- the management fee is due with the first installment
+       fee_due_in_k		bigint		NOT NULL DEFAULT 0 CHECK(fee_due_in_k >= 0),
+       -- penalties are added when the installment is late
+       penalty_due_in_k		bigint		NOT NULL DEFAULT 0 CHECK(penalty_due_in_k >= 0),
+       principal_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(principal_paid_in_k BETWEEN 0 AND principal_due_in_k),
+       interest_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(interest_paid_in_k BETWEEN 0 AND interest_due_in_k),
+       fee_paid_in_k		bigint		NOT NULL DEFAULT 0 CHECK(fee_paid_in_k BETWEEN 0 AND fee_due_in_k),
+       penalty_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(penalty_paid_in_k BETWEEN 0 AND penalty_due_in_k),
+       paid_at			timestamp	,
+       overdue_at		timestamp	,
+       -- penalties have been charged for every day up to and including this one
+       penalty_charged_through	date		,
+       last_reminded_at		timestamp	,
+       UNIQUE (loan_id, installment_number)
+);
+
+-- what a LOAN_REPAYMENT payment was for, and what it went to once it was paid
+CREATE TABLE IF NOT EXISTS loan_repayment (
+       loan_repayment_id	serial			PRIMARY KEY,
+       payment_reference	uuid			NOT NULL UNIQUE REFERENCES payment_processor_transaction (reference_number),
+       loan_id			integer			NOT NULL REFERENCES loan (loan_id),
+       kind			loan_repayment_kind_type NOT NULL,
+       installment_number	integer			,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       penalty_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       fee_paid_in_k		bigint			NOT NULL DEFAULT 0,
+       interest_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       principal_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       waived_interest_in_k	bigint			NOT NULL DEFAULT 0,
+       allocated_at		timestamp
+);
+
+CREATE TABLE IF NOT EXISTS loan_application (
+       loan_application_id	      serial	PRIMARY KEY,
+       loans_account_id	      integer	NOT NULL,
+       amount_requested_in_k  integer	NOT NULL,
+       duration_requested_in_days	integer	 NOT NULL,
+       status				loan_application_status_type NOT NULL DEFAULT 'SUBMITTED',
+       -- the BVN the customer applied with
+       bvn				bigint	,
+       -- where the loan is paid out to
+       bank_account_id			integer	REFERENCES customer_bank_account (bank_account_id),
+       decision_note			text	NOT NULL DEFAULT '',
+       reviewed_by			integer	REFERENCES customer (customer_id),
+       reviewed_at			timestamp ,
+       -- the loan that the application became once it was paid out
+       loan_id				integer	REFERENCES loan (loan_id),
+       -- what the customer was quoted when they applied; rates are in basis points
+       interest_method			interest_method_type NOT NULL DEFAULT 'FLAT',
+       monthly_rate_bp			integer	NOT NULL DEFAULT 400 CHECK(monthly_rate_bp >= 0),
+       fee_rate_bp			integer	NOT NULL DEFAULT 0 CHECK(fee_rate_bp >= 0),
+       installment_frequency		installment_frequency_type NOT NULL DEFAULT 'MONTHLY',
+       -- the credit score the application was made with, and the rules that applied to it as a JSON list of code, points and description
+       credit_score			integer	,
+       credit_max_amount_in_k		bigint	NOT NULL DEFAULT 0,
+       credit_max_tenor_in_days		integer	NOT NULL DEFAULT 0,
+       credit_reasons			jsonb	NOT NULL DEFAULT '[]',
+       -- how many guarantors have to agree before the application can be approved
+       guarantors_required		integer	NOT NULL DEFAULT 0 CHECK(guarantors_required >= 0),
+       created_at			timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       updated_at			timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CONSTRAINT loan_application_loans_account_fk FOREIGN KEY (loans_account_id) REFERENCES loans_account (account_id)
+);
+
+-- a customer has one application in progress at a time, until its loan is repaid
+CREATE UNIQUE INDEX IF NOT EXISTS loan_application_open_idx ON loan_application (loans_account_id)
+WHERE status IN ('SUBMITTED', 'UNDER_REVIEW', 'APPROVED', 'DISBURSED', 'ACTIVE', 'DEFAULTED');
+
+-- what was read from the bank statement uploaded with an application
+CREATE TABLE IF NOT EXISTS loan_application_statement (
+       loan_application_id	integer			PRIMARY KEY REFERENCES loan_application (loan_application_id),
+       file_name		varchar(255)		NOT NULL,
+       format			statement_format_type	NOT NULL,
+       analysis			jsonb			NOT NULL,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the guarantors nominated for an application, and their answers
+CREATE TABLE IF NOT EXISTS loan_guarantor (
+       loan_guarantor_id	serial				PRIMARY KEY,
+       loan_application_id	integer				NOT NULL REFERENCES loan_application (loan_application_id),
+       -- the email address or phone number the guarantor was nominated by
+       contact			varchar(320)			NOT NULL,
+       token			uuid				NOT NULL UNIQUE,
+       status			loan_guarantor_status_type	NOT NULL DEFAULT 'INVITED',
+       -- the customer that answered the invitation
+       customer_id		integer				REFERENCES customer (customer_id),
+       -- solo savings the guarantor can't withdraw until the loan is repaid or the application is rejected
+       hold_in_k		bigint				NOT NULL DEFAULT 0 CHECK(hold_in_k >= 0),
+       responded_at		timestamp			,
+       created_at		timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (loan_application_id, contact)
+);
+
+CREATE INDEX IF NOT EXISTS loan_guarantor_hold_idx ON loan_guarantor (customer_id) WHERE status = 'ACCEPTED' AND hold_in_k > 0;
+
+-- investments that have been made, and the positions they were rolled over into
+CREATE TABLE IF NOT EXISTS investment_position (
+       investment_position_id		serial				PRIMARY KEY,
+       customer_id			integer				NOT NULL REFERENCES customer (customer_id),
+       investment_product_id		integer				NOT NULL REFERENCES investment_product (investment_product_id),
+       -- the application it was opened for, or the position it was rolled over from
+       investment_application_id	integer				UNIQUE REFERENCES investment_application (investment_application_id),
+       rolled_over_from			integer				UNIQUE REFERENCES investment_position (investment_position_id),
+       principal_in_k			bigint				NOT NULL CHECK(principal_in_k > 0),
+       -- the product's rate when the position was opened
+       annual_rate_bp			integer				NOT NULL,
+       tenor_in_days			integer				NOT NULL CHECK(tenor_in_days > 0),
+       start_date			date				NOT NULL,
+       maturity_date			date				NOT NULL,
+       status				investment_position_status_type	NOT NULL DEFAULT 'ACTIVE',
+       -- whether to roll the principal and return over into a new position at maturity
+       rollover				boolean				NOT NULL DEFAULT FALSE,
+       -- the return paid at maturity
+       return_in_k			bigint				NOT NULL DEFAULT 0,
+       matured_at			timestamp			,
+       created_at			timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CHECK (investment_application_id IS NOT NULL OR rolled_over_from IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS investment_position_maturity_idx ON investment_position (maturity_date) WHERE status = 'ACTIVE';
+
+CREATE TYPE admin_action_status_type AS ENUM ('PENDING', 'APPROVED', 'EXECUTED', 'FAILED', 'REJECTED');
+
+-- sensitive actions that one admin proposes and a different admin approves before they are carried out
+CREATE TABLE IF NOT EXISTS admin_action (
+       admin_action_id		serial				PRIMARY KEY,
+       kind			varchar(64)			NOT NULL,
+       -- what the action is done to, as the audit log knows it, e.g. withdrawal:12
+       subject			varchar(128)			NOT NULL,
+       summary			text				NOT NULL,
+       amount_in_k		bigint				NOT NULL DEFAULT 0,
+       -- what the kind of action needs to be carried out
+       payload			jsonb				NOT NULL,
+       status			admin_action_status_type	NOT NULL DEFAULT 'PENDING',
+       -- why it was proposed
+       note			text				NOT NULL,
+       proposed_by		integer				NOT NULL REFERENCES customer (customer_id),
+       proposed_at		timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       decision_note		text				NOT NULL DEFAULT '',
+       reviewed_by		integer				REFERENCES customer (customer_id),
+       reviewed_at		timestamp			,
+       failure_reason		text				NOT NULL DEFAULT '',
+       executed_at		timestamp			,
+       -- only a different admin can approve an action
+       CHECK (status IN ('PENDING', 'REJECTED') OR reviewed_by <> proposed_by)
+);
+
+-- one action of a kind can wait for a subject at a time
+CREATE UNIQUE INDEX IF NOT EXISTS admin_action_pending_idx ON admin_action (kind, subject) WHERE status IN ('PENDING', 'APPROVED');
+CREATE INDEX IF NOT EXISTS admin_action_queue_idx ON admin_action (status, proposed_at);
+CREATE INDEX IF NOT EXISTS admin_action_subject_idx ON admin_action (subject, proposed_at);
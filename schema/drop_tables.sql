@@ -1,9 +1,15 @@
 DROP TABLE customer CASCADE;
+DROP TABLE loan_application_statement;
+DROP TABLE loan_guarantor;
 DROP TABLE loan_application;
 DROP TABLE thrift_plan;
 DROP TABLE thrift_transaction;
 DROP TABLE thrift_plan_member;
 DROP TABLE payment_processor_transaction;
+DROP TABLE admin_action;
+DROP TABLE admin_user_role;
+DROP TABLE admin_role_permission;
+DROP TABLE admin_role;
 DROP TABLE admin_user;
 DROP TABLE solo_savings_transaction;
 DROP TABLE family_vault_plan_member;
@@ -12,14 +18,48 @@ DROP TABLE family_vault_plan;
 DROP TABLE next_of_kin;
 DROP TABLE target_savings_plan;
 DROP TABLE target_savings_plan_transaction;
+DROP TABLE investment_position;
+DROP TABLE investment_application;
+DROP TABLE investment_product;
 DROP TABLE investment_account;
 DROP TABLE loans_account;
 DROP TABLE solo_savings_account;
 DROP TABLE password_hash;
 DROP TABLE bvn;
+DROP TABLE ledger_entry;
+DROP TABLE ledger_transaction;
+DROP TABLE ledger_account;
+DROP FUNCTION ledger_is_append_only CASCADE;
+DROP TABLE webhook_event;
+DROP TABLE payment_reconciliation_report;
+DROP TABLE payout;
+DROP TABLE payment_refund;
+DROP TABLE payment_dispute;
+DROP TABLE audit_log;
+DROP TABLE loan_repayment;
+DROP TABLE loan_installment;
+DROP TABLE loan;
+DROP TABLE customer_bank_account;
 
 DROP TYPE sex_type CASCADE;
 DROP TYPE status_type CASCADE;
 DROP TYPE relationship_type CASCADE;
 DROP TYPE frequency_type CASCADE;
 DROP TYPE payment_originator_type CASCADE;
+DROP TYPE ledger_account_type CASCADE;
+DROP TYPE ledger_direction_type CASCADE;
+DROP TYPE payout_purpose_type CASCADE;
+DROP TYPE payout_status_type CASCADE;
+DROP TYPE refund_status_type CASCADE;
+DROP TYPE dispute_status_type CASCADE;
+DROP TYPE loan_status_type CASCADE;
+DROP TYPE loan_repayment_kind_type CASCADE;
+DROP TYPE loan_application_status_type CASCADE;
+DROP TYPE interest_method_type CASCADE;
+DROP TYPE installment_frequency_type CASCADE;
+DROP TYPE delinquency_bucket_type CASCADE;
+DROP TYPE statement_format_type CASCADE;
+DROP TYPE loan_guarantor_status_type CASCADE;
+DROP TYPE investment_application_status_type CASCADE;
+DROP TYPE investment_position_status_type CASCADE;
+DROP TYPE admin_action_status_type CASCADE;
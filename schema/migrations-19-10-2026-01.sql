@@ -0,0 +1,100 @@
+-- Double-entry ledger. The balance columns on the account tables become a cache of the journal
+CREATE TYPE ledger_account_type AS ENUM ('ASSET', 'LIABILITY', 'EQUITY', 'INCOME', 'EXPENSE');
+CREATE TYPE ledger_direction_type AS ENUM ('DEBIT', 'CREDIT');
+
+CREATE TABLE IF NOT EXISTS ledger_account (
+       ledger_account_id	serial			PRIMARY KEY,
+       code			varchar(64)		UNIQUE NOT NULL,
+       account_type		ledger_account_type	NOT NULL,
+       customer_id		integer			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CONSTRAINT ledger_account_customer_fk FOREIGN KEY (customer_id) REFERENCES customer (customer_id)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_transaction (
+       ledger_transaction_id	serial		PRIMARY KEY,
+       -- the idempotency key stops the same business event from being journalled twice
+       idempotency_key		varchar(128)	UNIQUE NOT NULL,
+       description		text		NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entry (
+       ledger_entry_id		serial			PRIMARY KEY,
+       ledger_transaction_id	integer			NOT NULL,
+       ledger_account_id	integer			NOT NULL,
+       direction		ledger_direction_type	NOT NULL,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CONSTRAINT ledger_entry_transaction_fk FOREIGN KEY (ledger_transaction_id) REFERENCES ledger_transaction (ledger_transaction_id),
+       CONSTRAINT ledger_entry_account_fk FOREIGN KEY (ledger_account_id) REFERENCES ledger_account (ledger_account_id)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entry_account_idx ON ledger_entry (ledger_account_id);
+
+-- journal rows are never changed. Mistakes are fixed with a reversing journal
+CREATE OR REPLACE FUNCTION ledger_is_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger rows are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transaction_immutable BEFORE UPDATE OR DELETE ON ledger_transaction FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
+CREATE TRIGGER ledger_entry_immutable BEFORE UPDATE OR DELETE ON ledger_entry FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
+
+-- accounts are opened with a zero balance, so the old > 0 checks could never pass
+ALTER TABLE solo_savings_account DROP CONSTRAINT IF EXISTS solo_savings_account_balance_in_k_check;
+ALTER TABLE solo_savings_account ADD CONSTRAINT solo_savings_account_balance_in_k_check CHECK(balance_in_k >= 0);
+ALTER TABLE family_vault_plan DROP CONSTRAINT IF EXISTS family_vault_plan_balance_in_k_check;
+ALTER TABLE family_vault_plan ADD CONSTRAINT family_vault_plan_balance_in_k_check CHECK(balance_in_k >= 0);
+ALTER TABLE target_savings_plan DROP CONSTRAINT IF EXISTS target_savings_plan_balance_in_k_check;
+ALTER TABLE target_savings_plan ADD CONSTRAINT target_savings_plan_balance_in_k_check CHECK(balance_in_k >= 0);
+ALTER TABLE investment_account DROP CONSTRAINT IF EXISTS investment_account_balance_in_k_check;
+ALTER TABLE investment_account ADD CONSTRAINT investment_account_balance_in_k_check CHECK(balance_in_k >= 0);
+
+-- Opening balances. Balances that existed before the ledger get a single journal against OPENING_BALANCES
+BEGIN;
+INSERT INTO ledger_account (code, account_type) VALUES ('OPENING_BALANCES', 'EQUITY') ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO ledger_account (code, account_type, customer_id)
+SELECT 'SOLO_SAVINGS:' || customer_id, 'LIABILITY', customer_id FROM solo_savings_account WHERE balance_in_k > 0
+UNION ALL
+SELECT 'FAMILY_VAULT:' || family_vault_plan_id, 'LIABILITY', NULL FROM family_vault_plan WHERE balance_in_k > 0
+UNION ALL
+SELECT 'TARGET_SAVINGS:' || target_savings_plan_id, 'LIABILITY', customer_id FROM target_savings_plan WHERE balance_in_k > 0
+UNION ALL
+SELECT 'INVESTMENT:' || customer_id, 'LIABILITY', customer_id FROM investment_account WHERE balance_in_k > 0
+UNION ALL
+SELECT 'LOANS_RECEIVABLE:' || customer_id, 'ASSET', customer_id FROM loans_account WHERE amount_owed_in_k > 0
+ON CONFLICT (code) DO NOTHING;
+
+WITH opening AS (
+     INSERT INTO ledger_transaction (idempotency_key, description)
+     VALUES ('OPENING_BALANCES', 'opening balances carried over from the account tables')
+     RETURNING ledger_transaction_id
+), balances AS (
+     SELECT 'SOLO_SAVINGS:' || customer_id AS code, balance_in_k::bigint AS amount, 'CREDIT'::ledger_direction_type AS direction FROM solo_savings_account WHERE balance_in_k > 0
+     UNION ALL
+     SELECT 'FAMILY_VAULT:' || family_vault_plan_id, balance_in_k, 'CREDIT' FROM family_vault_plan WHERE balance_in_k > 0
+     UNION ALL
+     SELECT 'TARGET_SAVINGS:' || target_savings_plan_id, balance_in_k, 'CREDIT' FROM target_savings_plan WHERE balance_in_k > 0
+     UNION ALL
+     SELECT 'INVESTMENT:' || customer_id, balance_in_k, 'CREDIT' FROM investment_account WHERE balance_in_k > 0
+     UNION ALL
+     SELECT 'LOANS_RECEIVABLE:' || customer_id, amount_owed_in_k, 'DEBIT' FROM loans_account WHERE amount_owed_in_k > 0
+), entries AS (
+     INSERT INTO ledger_entry (ledger_transaction_id, ledger_account_id, direction, amount_in_k)
+     SELECT opening.ledger_transaction_id, la.ledger_account_id, b.direction, b.amount
+     FROM balances b JOIN ledger_account la ON la.code = b.code, opening
+     RETURNING direction, amount_in_k
+)
+-- the balancing leg against equity
+INSERT INTO ledger_entry (ledger_transaction_id, ledger_account_id, direction, amount_in_k)
+SELECT opening.ledger_transaction_id, la.ledger_account_id,
+       CASE WHEN net > 0 THEN 'DEBIT'::ledger_direction_type ELSE 'CREDIT'::ledger_direction_type END,
+       abs(net)
+FROM opening,
+     ledger_account la,
+     (SELECT sum(CASE WHEN direction = 'CREDIT' THEN amount_in_k ELSE -amount_in_k END) AS net FROM entries) AS totals
+WHERE la.code = 'OPENING_BALANCES' AND net IS NOT NULL AND net <> 0;
+COMMIT;
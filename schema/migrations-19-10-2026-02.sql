@@ -0,0 +1,20 @@
+-- Every webhook is saved raw before it is processed, so that it can be replayed
+CREATE TABLE IF NOT EXISTS webhook_event (
+       webhook_event_id		serial		PRIMARY KEY,
+       provider			varchar(32)	NOT NULL,
+       -- the provider's id for the event. Providers resend events, so this is unique per provider
+       event_id			varchar(128)	NOT NULL,
+       event_type		varchar(64)	NOT NULL,
+       payload			bytea		NOT NULL,
+       signature		text		,
+       signature_valid		boolean		NOT NULL,
+       status			status_type	NOT NULL DEFAULT 'PENDING',
+       failure_reason		text		,
+       attempts			integer		NOT NULL DEFAULT 0,
+       received_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       processed_at		timestamp	DEFAULT NULL
+);
+
+-- events with a bad signature are kept for inspection, but can't claim an event id
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_event_provider_event_idx ON webhook_event (provider, event_id) WHERE signature_valid;
+CREATE INDEX IF NOT EXISTS webhook_event_status_idx ON webhook_event (status, received_at);
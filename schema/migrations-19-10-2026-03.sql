@@ -0,0 +1,2 @@
+-- Payments are initialized on the server, with the provider that is then asked to verify them
+ALTER TABLE payment_processor_transaction ADD COLUMN IF NOT EXISTS payment_provider varchar(32) NOT NULL DEFAULT 'paystack';
@@ -0,0 +1,15 @@
+-- Payments that stay pending are re-verified by a job, which flags the ones it can't settle for an admin
+ALTER TABLE payment_processor_transaction ADD COLUMN IF NOT EXISTS flagged_at timestamp DEFAULT NULL;
+ALTER TABLE payment_processor_transaction ADD COLUMN IF NOT EXISTS flag_reason text;
+CREATE INDEX IF NOT EXISTS payment_processor_transaction_pending_idx ON payment_processor_transaction (verification_status, created_at);
+
+-- A nightly comparison of our payments with each provider's transactions
+CREATE TABLE IF NOT EXISTS payment_reconciliation_report (
+       report_id		serial		PRIMARY KEY,
+       provider			varchar(32)	NOT NULL,
+       report_date		date		NOT NULL,
+       matched_count		integer		NOT NULL,
+       discrepancies		jsonb		NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (provider, report_date)
+);
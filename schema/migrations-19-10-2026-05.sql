@@ -0,0 +1,38 @@
+-- Withdrawals and loan disbursements are paid out to customers' bank accounts through the provider's transfers
+CREATE TYPE payout_purpose_type AS ENUM ('WITHDRAWAL', 'LOAN_DISBURSEMENT');
+CREATE TYPE payout_status_type AS ENUM ('PENDING', 'PROCESSING', 'SUCCESSFUL', 'FAILED', 'REVERSED');
+
+CREATE TABLE IF NOT EXISTS customer_bank_account (
+       bank_account_id		serial		PRIMARY KEY,
+       customer_id		integer		NOT NULL REFERENCES customer (customer_id),
+       bank_code		varchar(8)	NOT NULL,
+       account_number		char(10)	NOT NULL,
+       account_name		varchar(128)	NOT NULL,
+       -- the provider that knows the account as recipient_code
+       recipient_provider	varchar(32)	NOT NULL,
+       recipient_code		varchar(128)	NOT NULL,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (customer_id, bank_code, account_number)
+);
+
+ALTER TABLE withdrawal_application ADD COLUMN IF NOT EXISTS withdrawal_application_id serial PRIMARY KEY;
+ALTER TABLE withdrawal_application ADD COLUMN IF NOT EXISTS bank_account_id integer REFERENCES customer_bank_account (bank_account_id);
+
+CREATE TABLE IF NOT EXISTS payout (
+       payout_id		serial			PRIMARY KEY,
+       -- sent to the provider with the transfer, which makes it idempotent
+       reference		uuid			NOT NULL UNIQUE,
+       customer_id		integer			NOT NULL REFERENCES customer (customer_id),
+       bank_account_id		integer			NOT NULL REFERENCES customer_bank_account (bank_account_id),
+       purpose			payout_purpose_type	NOT NULL,
+       -- the withdrawal application or loan application that is paid out
+       source_id		integer			NOT NULL,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       provider			varchar(32)		NOT NULL,
+       provider_transfer_id	varchar(128)		,
+       status			payout_status_type	NOT NULL DEFAULT 'PENDING',
+       failure_reason		text			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       updated_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (purpose, source_id)
+);
@@ -0,0 +1,51 @@
+-- Card payments can be refunded by admins, and are refunded when they can't be fulfilled. Disputes hold the money until they're resolved
+CREATE TYPE refund_status_type AS ENUM ('PENDING', 'PROCESSED', 'FAILED');
+CREATE TYPE dispute_status_type AS ENUM ('OPEN', 'WON', 'LOST');
+
+CREATE TABLE IF NOT EXISTS payment_refund (
+       refund_id		serial			PRIMARY KEY,
+       -- ours, so that a refund can be told apart from others of the same payment
+       reference		uuid			NOT NULL UNIQUE,
+       payment_reference	uuid			NOT NULL REFERENCES payment_processor_transaction (reference_number),
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       reason			text			NOT NULL,
+       -- admin:<id>, or system for refunds of payments that couldn't be fulfilled
+       initiated_by		varchar(64)		NOT NULL,
+       provider			varchar(32)		NOT NULL,
+       provider_refund_id	varchar(128)		,
+       status			refund_status_type	NOT NULL DEFAULT 'PENDING',
+       -- whether the amount was taken out of the account the payment went into
+       held			boolean			NOT NULL DEFAULT false,
+       failure_reason		text			,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       updated_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS payment_dispute (
+       dispute_id		serial			PRIMARY KEY,
+       provider			varchar(32)		NOT NULL,
+       provider_dispute_id	varchar(128)		NOT NULL,
+       payment_reference	uuid			NOT NULL REFERENCES payment_processor_transaction (reference_number),
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       reason			text			,
+       status			dispute_status_type	NOT NULL DEFAULT 'OPEN',
+       -- false when the customer didn't have the money when the dispute was opened
+       held			boolean			NOT NULL DEFAULT false,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       resolved_at		timestamp		,
+       UNIQUE (provider, provider_dispute_id)
+);
+
+-- who did what to money, and why. Like the ledger, it is never changed
+CREATE TABLE IF NOT EXISTS audit_log (
+       audit_log_id		serial		PRIMARY KEY,
+       actor			varchar(64)	NOT NULL,
+       action			varchar(64)	NOT NULL,
+       subject			varchar(128)	NOT NULL,
+       detail			text		NOT NULL DEFAULT '',
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_subject_idx ON audit_log (subject, created_at);
+
+CREATE TRIGGER audit_log_immutable BEFORE UPDATE OR DELETE ON audit_log FOR EACH ROW EXECUTE FUNCTION ledger_is_append_only();
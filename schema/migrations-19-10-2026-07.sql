@@ -0,0 +1,47 @@
+-- Loans are repaid in installments, with LOAN_REPAYMENT payments that go to penalties, then interest, then principal
+CREATE TYPE loan_status_type AS ENUM ('ACTIVE', 'REPAID', 'DEFAULTED');
+CREATE TYPE loan_repayment_kind_type AS ENUM ('INSTALLMENT', 'AMOUNT', 'PAYOFF');
+
+CREATE TABLE IF NOT EXISTS loan (
+       loan_id			serial			PRIMARY KEY,
+       customer_id		integer			NOT NULL REFERENCES customer (customer_id),
+       principal_in_k		bigint			NOT NULL CHECK(principal_in_k > 0),
+       status			loan_status_type	NOT NULL DEFAULT 'ACTIVE',
+       disbursed_at		timestamp		,
+       repaid_at		timestamp		,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a customer repays one loan at a time
+CREATE UNIQUE INDEX IF NOT EXISTS loan_active_customer_idx ON loan (customer_id) WHERE status = 'ACTIVE';
+
+CREATE TABLE IF NOT EXISTS loan_installment (
+       loan_installment_id	serial		PRIMARY KEY,
+       loan_id			integer		NOT NULL REFERENCES loan (loan_id),
+       installment_number	integer		NOT NULL CHECK(installment_number > 0),
+       due_date			date		NOT NULL,
+       principal_due_in_k	bigint		NOT NULL CHECK(principal_due_in_k >= 0),
+       interest_due_in_k	bigint		NOT NULL CHECK(interest_due_in_k >= 0),
+       -- penalties are added when the installment is late
+       penalty_due_in_k		bigint		NOT NULL DEFAULT 0 CHECK(penalty_due_in_k >= 0),
+       principal_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(principal_paid_in_k BETWEEN 0 AND principal_due_in_k),
+       interest_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(interest_paid_in_k BETWEEN 0 AND interest_due_in_k),
+       penalty_paid_in_k	bigint		NOT NULL DEFAULT 0 CHECK(penalty_paid_in_k BETWEEN 0 AND penalty_due_in_k),
+       paid_at			timestamp	,
+       UNIQUE (loan_id, installment_number)
+);
+
+-- what a LOAN_REPAYMENT payment was for, and what it went to once it was paid
+CREATE TABLE IF NOT EXISTS loan_repayment (
+       loan_repayment_id	serial			PRIMARY KEY,
+       payment_reference	uuid			NOT NULL UNIQUE REFERENCES payment_processor_transaction (reference_number),
+       loan_id			integer			NOT NULL REFERENCES loan (loan_id),
+       kind			loan_repayment_kind_type NOT NULL,
+       installment_number	integer			,
+       amount_in_k		bigint			NOT NULL CHECK(amount_in_k > 0),
+       penalty_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       interest_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       principal_paid_in_k	bigint			NOT NULL DEFAULT 0,
+       waived_interest_in_k	bigint			NOT NULL DEFAULT 0,
+       allocated_at		timestamp
+);
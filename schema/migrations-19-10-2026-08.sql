@@ -0,0 +1,41 @@
+-- Loan applications move through a lifecycle that admins decide on, and become loans once they are paid out
+CREATE TYPE loan_application_status_type AS ENUM ('SUBMITTED', 'UNDER_REVIEW', 'APPROVED', 'REJECTED', 'DISBURSED', 'ACTIVE', 'REPAID', 'DEFAULTED');
+-- loans whose disbursement came back after it was paid
+ALTER TYPE loan_status_type ADD VALUE 'CANCELLED';
+
+-- BVNs are 11 digits, which don't fit in an integer
+ALTER TABLE bvn ALTER COLUMN bvn TYPE bigint;
+
+ALTER TABLE loan_application
+      ADD COLUMN loan_application_id	serial		PRIMARY KEY,
+      -- the BVN the customer applied with
+      ADD COLUMN bvn			bigint		,
+      -- where the loan is paid out to
+      ADD COLUMN bank_account_id	integer		REFERENCES customer_bank_account (bank_account_id),
+      ADD COLUMN decision_note		text		NOT NULL DEFAULT '',
+      ADD COLUMN reviewed_by		integer		REFERENCES customer (customer_id),
+      ADD COLUMN reviewed_at		timestamp	,
+      -- the loan that the application became once it was paid out
+      ADD COLUMN loan_id		integer		REFERENCES loan (loan_id),
+      ADD COLUMN created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      ADD COLUMN updated_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE loan_application
+      ALTER COLUMN status DROP DEFAULT,
+      ALTER COLUMN status TYPE loan_application_status_type USING (
+      	    CASE status
+	    	 WHEN 'PENDING' THEN 'SUBMITTED'
+		 WHEN 'SUCCESSFUL' THEN 'APPROVED'
+		 ELSE 'REJECTED'
+	    END
+      )::loan_application_status_type,
+      ALTER COLUMN status SET DEFAULT 'SUBMITTED';
+
+-- only the latest of a customer's pending applications is kept
+UPDATE loan_application SET status = 'REJECTED', decision_note = 'a newer application was made'
+WHERE status = 'SUBMITTED'
+AND loan_application_id NOT IN (SELECT max(loan_application_id) FROM loan_application WHERE status = 'SUBMITTED' GROUP BY loans_account_id);
+
+-- a customer has one application in progress at a time, until its loan is repaid
+CREATE UNIQUE INDEX IF NOT EXISTS loan_application_open_idx ON loan_application (loans_account_id)
+WHERE status IN ('SUBMITTED', 'UNDER_REVIEW', 'APPROVED', 'DISBURSED', 'ACTIVE');
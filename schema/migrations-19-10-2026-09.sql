@@ -0,0 +1,23 @@
+-- Loans are priced with flat or reducing balance interest and a management fee, and repaid in weekly or monthly installments
+CREATE TYPE interest_method_type AS ENUM ('FLAT', 'REDUCING_BALANCE');
+CREATE TYPE installment_frequency_type AS ENUM ('WEEKLY', 'MONTHLY');
+
+-- what the customer was quoted when they applied; rates are in basis points
+ALTER TABLE loan_application
+      ADD COLUMN interest_method	interest_method_type		NOT NULL DEFAULT 'FLAT',
+      ADD COLUMN monthly_rate_bp	integer				NOT NULL DEFAULT 400 CHECK(monthly_rate_bp >= 0),
+      ADD COLUMN fee_rate_bp		integer				NOT NULL DEFAULT 0 CHECK(fee_rate_bp >= 0),
+      ADD COLUMN installment_frequency	installment_frequency_type	NOT NULL DEFAULT 'MONTHLY';
+
+ALTER TABLE loan
+      ADD COLUMN interest_method	interest_method_type		NOT NULL DEFAULT 'FLAT',
+      ADD COLUMN monthly_rate_bp	integer				NOT NULL DEFAULT 400 CHECK(monthly_rate_bp >= 0),
+      ADD COLUMN fee_rate_bp		integer				NOT NULL DEFAULT 0 CHECK(fee_rate_bp >= 0),
+      ADD COLUMN installment_frequency	installment_frequency_type	NOT NULL DEFAULT 'MONTHLY';
+
+-- the management fee is due with the first installment
+ALTER TABLE loan_installment
+      ADD COLUMN fee_due_in_k		bigint		NOT NULL DEFAULT 0 CHECK(fee_due_in_k >= 0),
+      ADD COLUMN fee_paid_in_k		bigint		NOT NULL DEFAULT 0 CHECK(fee_paid_in_k BETWEEN 0 AND fee_due_in_k);
+
+ALTER TABLE loan_repayment ADD COLUMN fee_paid_in_k bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+-- Late installments are marked overdue and charged penalties by the daily collections job, which also moves loans through delinquency buckets and reminds customers before and after their due dates
+CREATE TYPE delinquency_bucket_type AS ENUM ('CURRENT', '1_30', '31_60', '61_90', '90_PLUS');
+
+ALTER TABLE loan
+      ADD COLUMN days_past_due		integer				NOT NULL DEFAULT 0 CHECK(days_past_due >= 0),
+      ADD COLUMN delinquency_bucket	delinquency_bucket_type		NOT NULL DEFAULT 'CURRENT';
+
+ALTER TABLE loan_installment
+      ADD COLUMN overdue_at		timestamp,
+      -- penalties have been charged for every day up to and including this one
+      ADD COLUMN penalty_charged_through	date,
+      ADD COLUMN last_reminded_at	timestamp;
+
+CREATE INDEX loan_overdue_idx ON loan (days_past_due) WHERE status = 'ACTIVE' AND days_past_due > 0;
@@ -0,0 +1,6 @@
+-- Loan applications are credit scored when they are made. The reasons are the rules that applied, as a JSON list of code, points and description.
+ALTER TABLE loan_application
+      ADD COLUMN credit_score			integer	,
+      ADD COLUMN credit_max_amount_in_k		bigint	NOT NULL DEFAULT 0,
+      ADD COLUMN credit_max_tenor_in_days	integer	NOT NULL DEFAULT 0,
+      ADD COLUMN credit_reasons			jsonb	NOT NULL DEFAULT '[]';
@@ -0,0 +1,10 @@
+-- Customers can upload a bank statement with a loan application. What was read from it is kept for underwriters as JSON: the period it covers, monthly income, salary, average balance and repayments to other lenders.
+CREATE TYPE statement_format_type AS ENUM ('CSV', 'PDF');
+
+CREATE TABLE IF NOT EXISTS loan_application_statement (
+       loan_application_id	integer			PRIMARY KEY REFERENCES loan_application (loan_application_id),
+       file_name		varchar(255)		NOT NULL,
+       format			statement_format_type	NOT NULL,
+       analysis			jsonb			NOT NULL,
+       created_at		timestamp		NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,22 @@
+-- Larger loans need guarantors to agree to them before they can be approved. Guarantors are nominated by email or phone number and answer an invitation once they've logged in; they can put part of their solo savings on hold against the loan until it is repaid or the application is rejected.
+CREATE TYPE loan_guarantor_status_type AS ENUM ('INVITED', 'ACCEPTED', 'DECLINED');
+
+ALTER TABLE loan_application
+      ADD COLUMN guarantors_required	integer	NOT NULL DEFAULT 0 CHECK(guarantors_required >= 0);
+
+CREATE TABLE IF NOT EXISTS loan_guarantor (
+       loan_guarantor_id	serial				PRIMARY KEY,
+       loan_application_id	integer				NOT NULL REFERENCES loan_application (loan_application_id),
+       -- the email address or phone number the guarantor was nominated by
+       contact			varchar(320)			NOT NULL,
+       token			uuid				NOT NULL UNIQUE,
+       status			loan_guarantor_status_type	NOT NULL DEFAULT 'INVITED',
+       -- the customer that answered the invitation
+       customer_id		integer				REFERENCES customer (customer_id),
+       hold_in_k		bigint				NOT NULL DEFAULT 0 CHECK(hold_in_k >= 0),
+       responded_at		timestamp			,
+       created_at		timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       UNIQUE (loan_application_id, contact)
+);
+
+CREATE INDEX loan_guarantor_hold_idx ON loan_guarantor (customer_id) WHERE status = 'ACCEPTED' AND hold_in_k > 0;
@@ -0,0 +1,46 @@
+-- Investments are made in products that admins manage, each with an annual rate, a minimum amount and the tenors it can be held for. Approved applications become positions that earn simple interest until they mature, when they are paid into solo savings or rolled over into a new position.
+CREATE TYPE investment_application_status_type AS ENUM ('PENDING', 'APPROVED', 'REJECTED');
+CREATE TYPE investment_position_status_type AS ENUM ('ACTIVE', 'MATURED', 'ROLLED_OVER');
+
+CREATE TABLE IF NOT EXISTS investment_product (
+       investment_product_id	serial		PRIMARY KEY,
+       name			varchar(128)	NOT NULL UNIQUE,
+       -- in basis points a year
+       annual_rate_bp		integer		NOT NULL CHECK(annual_rate_bp > 0),
+       minimum_amount_in_k	bigint		NOT NULL CHECK(minimum_amount_in_k > 0),
+       tenors_in_days		integer[]	NOT NULL CHECK(cardinality(tenors_in_days) > 0),
+       active			boolean		NOT NULL DEFAULT TRUE,
+       created_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE investment_application
+      ADD COLUMN investment_product_id	integer	REFERENCES investment_product (investment_product_id),
+      ADD COLUMN created_at		timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      ALTER COLUMN status DROP DEFAULT,
+      ALTER COLUMN status TYPE investment_application_status_type USING (CASE status WHEN 'SUCCESSFUL' THEN 'APPROVED' WHEN 'FAILED' THEN 'REJECTED' ELSE 'PENDING' END)::investment_application_status_type,
+      ALTER COLUMN status SET DEFAULT 'PENDING';
+
+CREATE TABLE IF NOT EXISTS investment_position (
+       investment_position_id		serial				PRIMARY KEY,
+       customer_id			integer				NOT NULL REFERENCES customer (customer_id),
+       investment_product_id		integer				NOT NULL REFERENCES investment_product (investment_product_id),
+       -- the application it was opened for, or the position it was rolled over from
+       investment_application_id	integer				UNIQUE REFERENCES investment_application (investment_application_id),
+       rolled_over_from			integer				UNIQUE REFERENCES investment_position (investment_position_id),
+       principal_in_k			bigint				NOT NULL CHECK(principal_in_k > 0),
+       -- the product's rate when the position was opened
+       annual_rate_bp			integer				NOT NULL,
+       tenor_in_days			integer				NOT NULL CHECK(tenor_in_days > 0),
+       start_date			date				NOT NULL,
+       maturity_date			date				NOT NULL,
+       status				investment_position_status_type	NOT NULL DEFAULT 'ACTIVE',
+       -- whether to roll the principal and return over into a new position at maturity
+       rollover				boolean				NOT NULL DEFAULT FALSE,
+       -- the return paid at maturity
+       return_in_k			bigint				NOT NULL DEFAULT 0,
+       matured_at			timestamp			,
+       created_at			timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       CHECK (investment_application_id IS NOT NULL OR rolled_over_from IS NOT NULL)
+);
+
+CREATE INDEX investment_position_maturity_idx ON investment_position (maturity_date) WHERE status = 'ACTIVE';
@@ -0,0 +1,31 @@
+-- Investment applications are saved as drafts while the customer fills the form in, and submitted from a confirmation page. Admins approve or reject them, with a note for rejections.
+ALTER TYPE investment_application_status_type ADD VALUE 'DRAFT' BEFORE 'PENDING';
+
+-- drafts can be saved before every field is filled in
+ALTER TABLE investment_application
+      ALTER COLUMN employment_status DROP NOT NULL,
+      ALTER COLUMN date_of_employment DROP NOT NULL,
+      ALTER COLUMN employer_name DROP NOT NULL,
+      ALTER COLUMN tenure DROP NOT NULL,
+      -- TINs can have a hyphen, and account numbers can start with a 0
+      ALTER COLUMN tin DROP NOT NULL,
+      ALTER COLUMN tin TYPE varchar(13) USING tin::text,
+      ALTER COLUMN bank_account_name DROP NOT NULL,
+      ALTER COLUMN bank_account_number DROP NOT NULL,
+      ALTER COLUMN bank_account_number TYPE varchar(10) USING lpad(bank_account_number::text, 10, '0'),
+      ALTER COLUMN status SET DEFAULT 'DRAFT',
+      ADD COLUMN submitted_at		timestamp	,
+      ADD COLUMN decision_note		text		NOT NULL DEFAULT '',
+      ADD COLUMN reviewed_by		integer		REFERENCES customer (customer_id),
+      ADD COLUMN reviewed_at		timestamp	,
+      ADD COLUMN updated_at		timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE investment_application SET submitted_at = created_at WHERE status <> 'DRAFT';
+
+-- a customer has one draft at a time
+CREATE UNIQUE INDEX IF NOT EXISTS investment_application_draft_idx ON investment_application (investment_account_id)
+WHERE status = 'DRAFT';
+
+-- and one application waiting to be reviewed
+CREATE UNIQUE INDEX IF NOT EXISTS investment_application_pending_idx ON investment_application (investment_account_id)
+WHERE status = 'PENDING';
@@ -0,0 +1,11 @@
+-- Withdrawals are approved or rejected by an admin, with a note saying why, before they are paid out.
+ALTER TABLE withdrawal_application
+      ADD COLUMN decision_note		text		NOT NULL DEFAULT '',
+      ADD COLUMN reviewed_by		integer		REFERENCES customer (customer_id),
+      ADD COLUMN reviewed_at		timestamp	;
+
+-- withdrawals that were already paid out count as approved
+UPDATE withdrawal_application w SET reviewed_at = p.created_at
+FROM payout p WHERE p.purpose = 'WITHDRAWAL' AND p.source_id = w.withdrawal_application_id;
+
+CREATE INDEX IF NOT EXISTS withdrawal_application_queue_idx ON withdrawal_application (status, date_created);
@@ -0,0 +1,74 @@
+-- Admins are given roles, and roles are given permissions, so that each admin can only do what their job needs. Customers' accounts can be suspended, which stops them logging in.
+
+CREATE TABLE IF NOT EXISTS admin_role (
+       admin_role_id	serial		PRIMARY KEY,
+       name		varchar(64)	UNIQUE NOT NULL,
+       description	text		NOT NULL DEFAULT ''
+);
+
+-- permissions are defined in code, e.g. loans.approve. The super-admin role has every permission without them being listed here.
+CREATE TABLE IF NOT EXISTS admin_role_permission (
+       admin_role_id	integer		NOT NULL REFERENCES admin_role (admin_role_id) ON DELETE CASCADE,
+       permission	varchar(64)	NOT NULL,
+       PRIMARY KEY (admin_role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS admin_user_role (
+       admin_user_id	integer		NOT NULL REFERENCES admin_user (admin_user_id) ON DELETE CASCADE,
+       admin_role_id	integer		NOT NULL REFERENCES admin_role (admin_role_id),
+       -- the admin that assigned the role
+       assigned_by	integer		REFERENCES customer (customer_id),
+       assigned_at	timestamp	NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       PRIMARY KEY (admin_user_id, admin_role_id)
+);
+
+INSERT INTO admin_role (name, description) VALUES
+       ('super-admin', 'Everything, including assigning roles to other admins'),
+       ('loan-officer', 'Reviews and disburses loan applications, and follows up overdue loans'),
+       ('investment-officer', 'Manages investment products and reviews investment applications'),
+       ('operations', 'Approves withdrawals, refunds payments and replays webhooks'),
+       ('support', 'Looks up customers and what they have asked for, and suspends accounts'),
+       ('auditor', 'Sees everything, but can''t change anything')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO admin_role_permission (admin_role_id, permission)
+SELECT r.admin_role_id, p.permission
+FROM admin_role r
+JOIN (VALUES
+       ('loan-officer', 'loans.view'),
+       ('loan-officer', 'loans.approve'),
+       ('loan-officer', 'reports.view'),
+       ('loan-officer', 'users.view'),
+       ('investment-officer', 'investments.view'),
+       ('investment-officer', 'investments.manage'),
+       ('investment-officer', 'investments.approve'),
+       ('investment-officer', 'users.view'),
+       ('operations', 'withdrawals.view'),
+       ('operations', 'withdrawals.approve'),
+       ('operations', 'payments.view'),
+       ('operations', 'payments.refund'),
+       ('operations', 'webhooks.replay'),
+       ('operations', 'users.view'),
+       ('support', 'loans.view'),
+       ('support', 'investments.view'),
+       ('support', 'withdrawals.view'),
+       ('support', 'payments.view'),
+       ('support', 'users.view'),
+       ('support', 'users.suspend'),
+       ('auditor', 'loans.view'),
+       ('auditor', 'investments.view'),
+       ('auditor', 'withdrawals.view'),
+       ('auditor', 'payments.view'),
+       ('auditor', 'users.view'),
+       ('auditor', 'reports.view')
+) AS p (role, permission) ON p.role = r.name
+ON CONFLICT DO NOTHING;
+
+-- admins from before roles keep being able to do everything
+INSERT INTO admin_user_role (admin_user_id, admin_role_id)
+SELECT a.admin_user_id, r.admin_role_id FROM admin_user a, admin_role r WHERE r.name = 'super-admin'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE customer
+      ADD COLUMN suspended_at		timestamp	,
+      ADD COLUMN suspension_note	text		NOT NULL DEFAULT '';
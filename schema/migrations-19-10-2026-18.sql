@@ -0,0 +1,36 @@
+-- Balance adjustments, and withdrawals and loans larger than one admin can approve, are proposed by one admin and carried out once a different admin approves them.
+
+CREATE TYPE admin_action_status_type AS ENUM ('PENDING', 'APPROVED', 'EXECUTED', 'FAILED', 'REJECTED');
+
+-- sensitive actions that one admin proposes and a different admin approves before they are carried out
+CREATE TABLE IF NOT EXISTS admin_action (
+       admin_action_id		serial				PRIMARY KEY,
+       kind			varchar(64)			NOT NULL,
+       -- what the action is done to, as the audit log knows it, e.g. withdrawal:12
+       subject			varchar(128)			NOT NULL,
+       summary			text				NOT NULL,
+       amount_in_k		bigint				NOT NULL DEFAULT 0,
+       -- what the kind of action needs to be carried out
+       payload			jsonb				NOT NULL,
+       status			admin_action_status_type	NOT NULL DEFAULT 'PENDING',
+       -- why it was proposed
+       note			text				NOT NULL,
+       proposed_by		integer				NOT NULL REFERENCES customer (customer_id),
+       proposed_at		timestamp			NOT NULL DEFAULT CURRENT_TIMESTAMP,
+       decision_note		text				NOT NULL DEFAULT '',
+       reviewed_by		integer				REFERENCES customer (customer_id),
+       reviewed_at		timestamp			,
+       failure_reason		text				NOT NULL DEFAULT '',
+       executed_at		timestamp			,
+       -- only a different admin can approve an action
+       CHECK (status IN ('PENDING', 'REJECTED') OR reviewed_by <> proposed_by)
+);
+
+-- one action of a kind can wait for a subject at a time
+CREATE UNIQUE INDEX IF NOT EXISTS admin_action_pending_idx ON admin_action (kind, subject) WHERE status IN ('PENDING', 'APPROVED');
+CREATE INDEX IF NOT EXISTS admin_action_queue_idx ON admin_action (status, proposed_at);
+CREATE INDEX IF NOT EXISTS admin_action_subject_idx ON admin_action (subject, proposed_at);
+
+INSERT INTO admin_role_permission (admin_role_id, permission)
+SELECT admin_role_id, 'balances.adjust' FROM admin_role WHERE name = 'operations'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- A loan application whose payout failed or was reversed goes back to approved, and is paid out again with a new payout. Only one payout for a withdrawal or loan can be open at a time.
+
+ALTER TABLE payout DROP CONSTRAINT IF EXISTS payout_purpose_source_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS payout_open_source_idx ON payout (purpose, source_id) WHERE status NOT IN ('FAILED', 'REVERSED');
@@ -0,0 +1,8 @@
+-- Loans more than 90 days late are defaulted by the collections. A defaulted loan can still be repaid, and its customer can't take out another loan until it is.
+
+DROP INDEX IF EXISTS loan_active_customer_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS loan_active_customer_idx ON loan (customer_id) WHERE status IN ('ACTIVE', 'DEFAULTED');
+
+DROP INDEX IF EXISTS loan_application_open_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS loan_application_open_idx ON loan_application (loans_account_id)
+WHERE status IN ('SUBMITTED', 'UNDER_REVIEW', 'APPROVED', 'DISBURSED', 'ACTIVE', 'DEFAULTED');
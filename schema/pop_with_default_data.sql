@@ -7,4 +7,5 @@ INSERT INTO family_vault_plan_member(customer_id, family_vault_plan_id, date_add
 -- second customer
 
 INSERT INTO customer (first_name, last_name, email, email_is_verified, date_joined) VALUES ('Tester', 'Alonso', 'tester@alonso.com', true, Now());
-INSERT INTO admin (customer_id) VALUES(1);
+INSERT INTO admin_user (customer_id) VALUES(1);
+INSERT INTO admin_user_role (admin_user_id, admin_role_id) SELECT a.admin_user_id, r.admin_role_id FROM admin_user a, admin_role r WHERE a.customer_id = 1 AND r.name = 'super-admin';
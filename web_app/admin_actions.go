@@ -0,0 +1,496 @@
+package web_app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sensitive admin actions are never done by one admin alone. One admin
+// proposes the action, and it waits until a different admin approves
+// it, when it is carried out. Manual balance adjustments always wait,
+// and withdrawals and loans only when they are larger than the approval
+// policy allows one admin to approve.
+
+// How far an action has got. Approved actions are being carried out,
+// and end up executed or failed. Actions that are still approved after
+// staleAdminActionAge were interrupted, and are carried out again.
+const (
+	AdminActionPending  = "PENDING"
+	AdminActionApproved = "APPROVED"
+	AdminActionExecuted = "EXECUTED"
+	AdminActionFailed   = "FAILED"
+	AdminActionRejected = "REJECTED"
+)
+
+// staleAdminActionAge is how long an approved action can take to be
+// carried out before it is carried out again
+const staleAdminActionAge = 10 * time.Minute
+
+// The kinds of action that need a second admin, each with its own
+// payload
+const (
+	AdminActionBalanceAdjustment  = "BALANCE_ADJUSTMENT"
+	AdminActionWithdrawalApproval = "WITHDRAWAL_APPROVAL"
+	AdminActionLoanApproval       = "LOAN_APPROVAL"
+)
+
+// Audit log actions for admin actions
+const (
+	AuditAdminActionProposed = "ADMIN_ACTION_PROPOSED"
+	AuditAdminActionApproved = "ADMIN_ACTION_APPROVED"
+	AuditAdminActionRejected = "ADMIN_ACTION_REJECTED"
+	AuditAdminActionExecuted = "ADMIN_ACTION_EXECUTED"
+	AuditAdminActionFailed   = "ADMIN_ACTION_FAILED"
+)
+
+var (
+	ErrAdminActionDoesNotExist = errors.New("admin action does not exist")
+	ErrUnknownAdminAction      = errors.New("unknown kind of admin action")
+	ErrAdminActionDecided      = errors.New("the action has already been approved or rejected")
+	ErrAdminActionPending      = errors.New("the same action is already waiting to be approved")
+	ErrAdminActionSameAdmin    = errors.New("a different admin has to approve what you proposed")
+	ErrInvalidApprovalPolicy   = errors.New("invalid approval policy")
+)
+
+type AdminAction struct {
+	ID   uint
+	Kind string
+	// Subject is what the action is done to, as the audit log knows it,
+	// e.g. withdrawal:12
+	Subject string
+	Summary string
+	Amount  Money
+	Payload []byte
+	Status  string
+	// Note is why the action was proposed, and DecisionNote why it was
+	// approved or rejected
+	Note          string
+	ProposedBy    uint
+	ProposedAt    time.Time
+	DecisionNote  string
+	ReviewedBy    uint
+	ReviewedAt    time.Time
+	FailureReason string
+	ExecutedAt    time.Time
+}
+
+// AdminActionPayload is what an action of one kind needs to be carried
+// out
+type AdminActionPayload interface {
+	Kind() string
+	Subject() string
+	Summary() string
+	// Total is the money the action moves, which the queue can be
+	// sorted by
+	Total() Money
+	// execute carries the action out once approvedBy, who didn't
+	// propose it, has approved it. Decisions it makes are recorded as
+	// approvedBy's. It is run again for actions that were interrupted,
+	// so it doesn't do again what was already done.
+	execute(ctx context.Context, targets adminActionTargets, payouts *PayoutService, action AdminAction, approvedBy uint) error
+}
+
+// adminActionTargets is what admin actions are carried out on
+type adminActionTargets interface {
+	LoanApplicationStore
+	WithdrawalApplicationStore
+	PostSoloSaverAdjustment(userID uint, amount Money, credit bool, reference string) (LedgerPostingInformation, error)
+}
+
+type adminActionKind struct {
+	// permission is what the admins that propose and approve the
+	// action need
+	permission string
+	decode     func(payload []byte) (AdminActionPayload, error)
+}
+
+var adminActionKinds = map[string]adminActionKind{
+	AdminActionBalanceAdjustment:  {PermissionBalancesAdjust, decodeAdminActionPayload[BalanceAdjustment]},
+	AdminActionWithdrawalApproval: {PermissionWithdrawalsApprove, decodeAdminActionPayload[WithdrawalApproval]},
+	AdminActionLoanApproval:       {PermissionLoansApprove, decodeAdminActionPayload[LoanApproval]},
+}
+
+func decodeAdminActionPayload[P AdminActionPayload](payload []byte) (AdminActionPayload, error) {
+	var p P
+	err := json.Unmarshal(payload, &p)
+	return p, err
+}
+
+// newAdminAction is the action for payload, proposed by an admin with a
+// note saying why
+func newAdminAction(payload AdminActionPayload, proposedBy uint, note string) (AdminAction, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return AdminAction{}, err
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return AdminAction{}, err
+	}
+
+	return AdminAction{
+		Kind:       payload.Kind(),
+		Subject:    payload.Subject(),
+		Summary:    payload.Summary(),
+		Amount:     payload.Total(),
+		Payload:    encoded,
+		Status:     AdminActionPending,
+		Note:       note,
+		ProposedBy: proposedBy,
+	}, nil
+}
+
+func (a AdminAction) decode() (AdminActionPayload, error) {
+	kind, ok := adminActionKinds[a.Kind]
+	if !ok {
+		return nil, ErrUnknownAdminAction
+	}
+	return kind.decode(a.Payload)
+}
+
+// adminActionPermissions are the permissions that let an admin approve
+// or reject some kind of action, in the order they are shown
+func adminActionPermissions() []string {
+	var permissions []string
+	for _, permission := range adminPermissions {
+		for _, kind := range adminActionKinds {
+			if kind.permission == permission.Name {
+				permissions = append(permissions, permission.Name)
+				break
+			}
+		}
+	}
+	return permissions
+}
+
+// Permission is what an admin needs to approve or reject the action
+func (a AdminAction) Permission() string {
+	return adminActionKinds[a.Kind].permission
+}
+
+// SubjectLink is the admin page for what the action is done to
+func (a AdminAction) SubjectLink() string {
+	kind, id, _ := strings.Cut(a.Subject, ":")
+	switch kind {
+	case "customer":
+		return "/admin/users/" + id
+	case "withdrawal":
+		return "/admin/withdrawals/" + id
+	case "loan-application":
+		return "/admin/loan-applications/" + id
+	}
+	return ""
+}
+
+// checkAdminActionReview checks that adminID can approve or reject the
+// action. Admins can reject what they proposed, to take it back, but
+// only someone else can approve it.
+func checkAdminActionReview(action AdminAction, adminID uint, approve bool) error {
+	if action.Status != AdminActionPending {
+		return ErrAdminActionDecided
+	}
+	if approve && action.ProposedBy == adminID {
+		return ErrAdminActionSameAdmin
+	}
+	return nil
+}
+
+func isAdminActionStatus(status string) bool {
+	switch status {
+	case AdminActionPending, AdminActionApproved, AdminActionExecuted, AdminActionFailed, AdminActionRejected:
+		return true
+	}
+	return false
+}
+
+func adminActionAuditSubject(id uint) string {
+	return fmt.Sprintf("admin-action:%d", id)
+}
+
+type AdminActionStore interface {
+	// ProposeAdminAction saves a pending action and records it in the
+	// audit log. There can only be one pending action of a kind for a
+	// subject; proposing another gets ErrAdminActionPending.
+	ProposeAdminAction(action AdminAction) (AdminAction, error)
+	GetAdminAction(id uint) (AdminAction, error)
+	// GetAdminActions lists actions for the admin queue, and
+	// GetSubjectAdminActions the ones done to a subject, newest first
+	GetAdminActions(filter AdminQueueFilter) ([]AdminAction, error)
+	GetSubjectAdminActions(subject string) ([]AdminAction, error)
+	// ApproveAdminAction and RejectAdminAction decide a pending action,
+	// with a note saying why, and record it in the audit log
+	ApproveAdminAction(id, adminID uint, note string) (AdminAction, error)
+	RejectAdminAction(id, adminID uint, note string) (AdminAction, error)
+	// FinishAdminAction records whether an approved action was carried
+	// out. An empty failure is success.
+	FinishAdminAction(id uint, failure string) (AdminAction, error)
+	// GetStaleApprovedAdminActions is up to limit actions that were
+	// approved before approvedBefore and haven't been finished, oldest
+	// first
+	GetStaleApprovedAdminActions(approvedBefore time.Time, limit int) ([]AdminAction, error)
+}
+
+// approveAdminAction approves an action and carries it out. Actions
+// that couldn't be carried out are failed with why, and the error is
+// returned.
+func approveAdminAction(ctx context.Context, store AdminActionStore, targets adminActionTargets, payouts *PayoutService, id, adminID uint, note string) (AdminAction, error) {
+	action, err := store.ApproveAdminAction(id, adminID, note)
+	if err != nil {
+		return action, err
+	}
+	return executeAdminAction(ctx, store, targets, payouts, action)
+}
+
+// executeAdminAction carries out an approved action on behalf of the
+// admin that approved it, and finishes it
+func executeAdminAction(ctx context.Context, store AdminActionStore, targets adminActionTargets, payouts *PayoutService, action AdminAction) (AdminAction, error) {
+	payload, executeErr := action.decode()
+	if executeErr == nil {
+		executeErr = payload.execute(ctx, targets, payouts, action, action.ReviewedBy)
+	}
+
+	failure := ""
+	if executeErr != nil {
+		failure = executeErr.Error()
+	}
+
+	action, err := store.FinishAdminAction(action.ID, failure)
+	if err != nil {
+		return action, err
+	}
+	return action, executeErr
+}
+
+// AdminActionResumer carries out the approved actions that were
+// interrupted, e.g. by the server stopping, before they were finished.
+// Until they are, the same action can't be proposed again.
+type AdminActionResumer struct {
+	store   AdminActionStore
+	targets adminActionTargets
+	payouts *PayoutService
+	now     func() time.Time
+}
+
+func NewAdminActionResumer(store AdminActionStore, targets adminActionTargets, payouts *PayoutService) *AdminActionResumer {
+	return &AdminActionResumer{store: store, targets: targets, payouts: payouts, now: time.Now}
+}
+
+// Run carries out stale approved actions until ctx is cancelled
+func (r *AdminActionResumer) Run(ctx context.Context) {
+	ticker := time.NewTicker(stalePaymentSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Resume(ctx); err != nil {
+				log.Printf("couldn't carry out interrupted admin actions: %s", err)
+			}
+		}
+	}
+}
+
+// Resume carries out every action that has been approved for longer
+// than staleAdminActionAge, and returns them as they are now. An action
+// that fails doesn't stop the rest.
+func (r *AdminActionResumer) Resume(ctx context.Context) ([]AdminAction, error) {
+	stale, err := r.store.GetStaleApprovedAdminActions(r.now().Add(-staleAdminActionAge), stalePaymentSweepLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, action := range stale {
+		finished, err := executeAdminAction(ctx, r.store, r.targets, r.payouts, action)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("admin action %d: %w", action.ID, err))
+		}
+		if finished.ID != 0 {
+			stale[i] = finished
+		}
+	}
+
+	return stale, errors.Join(errs...)
+}
+
+// BalanceAdjustment pays money into, or takes it out of, a customer's
+// Solo Saver by hand, e.g. to correct a payment credited twice
+type BalanceAdjustment struct {
+	CustomerID uint
+	Amount     Money
+	// Credit is whether the money is paid in, rather than taken out
+	Credit bool
+}
+
+func (b BalanceAdjustment) Kind() string {
+	return AdminActionBalanceAdjustment
+}
+
+func (b BalanceAdjustment) Subject() string {
+	return customerAuditSubject(b.CustomerID)
+}
+
+func (b BalanceAdjustment) Summary() string {
+	if b.Credit {
+		return fmt.Sprintf("Pay %s into customer %d's Solo Saver", b.Amount, b.CustomerID)
+	}
+	return fmt.Sprintf("Take %s out of customer %d's Solo Saver", b.Amount, b.CustomerID)
+}
+
+func (b BalanceAdjustment) Total() Money {
+	return b.Amount
+}
+
+// execute posts the adjustment with the action's id as its reference,
+// so an adjustment that was already posted isn't posted again
+func (b BalanceAdjustment) execute(ctx context.Context, targets adminActionTargets, payouts *PayoutService, action AdminAction, approvedBy uint) error {
+	_, err := targets.PostSoloSaverAdjustment(b.CustomerID, b.Amount, b.Credit, fmt.Sprint(action.ID))
+	if errors.Is(err, ErrJournalAlreadyPosted) {
+		return nil
+	}
+	return err
+}
+
+// WithdrawalApproval approves a withdrawal larger than one admin can
+// approve, and pays it out
+type WithdrawalApproval struct {
+	WithdrawalID uint
+	Amount       Money
+}
+
+func (w WithdrawalApproval) Kind() string {
+	return AdminActionWithdrawalApproval
+}
+
+func (w WithdrawalApproval) Subject() string {
+	return withdrawalAuditSubject(w.WithdrawalID)
+}
+
+func (w WithdrawalApproval) Summary() string {
+	return fmt.Sprintf("Approve and pay out withdrawal %d of %s", w.WithdrawalID, w.Amount)
+}
+
+func (w WithdrawalApproval) Total() Money {
+	return w.Amount
+}
+
+// execute approves the withdrawal with the note it was proposed with.
+// A payout that couldn't be made leaves the withdrawal approved, to be
+// paid out again, so it doesn't fail the action.
+func (w WithdrawalApproval) execute(ctx context.Context, targets adminActionTargets, payouts *PayoutService, action AdminAction, approvedBy uint) error {
+	withdrawal, err := targets.ApproveWithdrawalApplication(w.WithdrawalID, approvedBy, action.Note)
+	// an action that was interrupted may have approved it already, and
+	// only rejected withdrawals fail
+	if err == ErrWithdrawalDecided && withdrawal.Status != StatusFailed {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payout, err := payouts.PayWithdrawal(ctx, w.WithdrawalID); err != nil {
+		log.Printf("payout %s for withdrawal %d: %s", payout.Reference, w.WithdrawalID, err)
+	}
+	return nil
+}
+
+// LoanApproval approves a loan application larger than one admin can
+// approve, and pays it out
+type LoanApproval struct {
+	ApplicationID uint
+	Amount        Money
+}
+
+func (l LoanApproval) Kind() string {
+	return AdminActionLoanApproval
+}
+
+func (l LoanApproval) Subject() string {
+	return loanApplicationAuditSubject(l.ApplicationID)
+}
+
+func (l LoanApproval) Summary() string {
+	return fmt.Sprintf("Approve and pay out loan application %d of %s", l.ApplicationID, l.Amount)
+}
+
+func (l LoanApproval) Total() Money {
+	return l.Amount
+}
+
+// execute approves the application with the note it was proposed with.
+// Payouts that fail are sent again, or given back, like the ones for
+// applications approved by one admin, so they don't fail the action.
+func (l LoanApproval) execute(ctx context.Context, targets adminActionTargets, payouts *PayoutService, action AdminAction, approvedBy uint) error {
+	application, err := targets.GetLoanApplication(l.ApplicationID)
+	if err != nil {
+		return err
+	}
+
+	// an action that was interrupted may have approved or paid it out
+	// already
+	switch application.Status {
+	case LoanApplicationApproved:
+	case LoanApplicationDisbursed, LoanApplicationActive, LoanApplicationRepaid, LoanApplicationDefaulted:
+		return nil
+	default:
+		if _, err := targets.TransitionLoanApplication(l.ApplicationID, LoanApplicationApproved, approvedBy, action.Note); err != nil {
+			return err
+		}
+	}
+
+	if payout, err := disburseLoanApplication(ctx, targets, payouts, l.ApplicationID, approvedBy); err != nil {
+		log.Printf("payout %s for loan application %d: %s", payout.Reference, l.ApplicationID, err)
+	}
+	return nil
+}
+
+// checkLoanApproval checks that an application could be approved now,
+// before it waits for a second admin to approve it
+func checkLoanApproval(application LoanApplication) error {
+	if !canTransitionLoanApplication(application.Status, LoanApplicationApproved) {
+		return fmt.Errorf("%w: %s to %s", ErrLoanApplicationTransition, application.Status, LoanApplicationApproved)
+	}
+	if !application.HasGuarantorConsent() {
+		return ErrGuarantorConsentRequired
+	}
+	return nil
+}
+
+// ApprovalPolicy is how large a withdrawal or loan one admin can
+// approve on their own. Larger ones need a second admin.
+type ApprovalPolicy struct {
+	LargeWithdrawal Money
+	LargeLoan       Money
+}
+
+var defaultApprovalPolicy = ApprovalPolicy{LargeWithdrawal: 500_000 * koboPerNaira, LargeLoan: 1_000_000 * koboPerNaira}
+
+// ApprovalPolicyFromEnv is the default policy, with whatever is set in
+// LARGE_WITHDRAWAL_AMOUNT and LARGE_LOAN_AMOUNT (in naira)
+func ApprovalPolicyFromEnv() (ApprovalPolicy, error) {
+	policy := defaultApprovalPolicy
+
+	for name, amount := range map[string]*Money{
+		"LARGE_WITHDRAWAL_AMOUNT": &policy.LargeWithdrawal,
+		"LARGE_LOAN_AMOUNT":       &policy.LargeLoan,
+	} {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := ParseMoney(value)
+			if err != nil {
+				return policy, fmt.Errorf("%w: %s %q", ErrInvalidApprovalPolicy, name, value)
+			}
+			*amount = parsed
+		}
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,442 @@
+package web_app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type FakeAdminActionStore struct {
+	actions []AdminAction
+	audit   []AuditEntry
+}
+
+func (f *FakeAdminActionStore) ProposeAdminAction(action AdminAction) (AdminAction, error) {
+	for _, existing := range f.actions {
+		if existing.Kind == action.Kind && existing.Subject == action.Subject && (existing.Status == AdminActionPending || existing.Status == AdminActionApproved) {
+			return action, ErrAdminActionPending
+		}
+	}
+
+	action.ID = uint(len(f.actions) + 1)
+	action.ProposedAt = time.Now()
+	f.actions = append(f.actions, action)
+	f.record(adminActor(action.ProposedBy), AuditAdminActionProposed, action.ID)
+	return action, nil
+}
+
+func (f *FakeAdminActionStore) GetAdminAction(id uint) (AdminAction, error) {
+	if id == 0 || int(id) > len(f.actions) {
+		return AdminAction{}, ErrAdminActionDoesNotExist
+	}
+	return f.actions[id-1], nil
+}
+
+func (f *FakeAdminActionStore) GetAdminActions(filter AdminQueueFilter) ([]AdminAction, error) {
+	var actions []AdminAction
+	for _, action := range f.actions {
+		if filter.Status == "" || action.Status == filter.Status {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+func (f *FakeAdminActionStore) GetSubjectAdminActions(subject string) ([]AdminAction, error) {
+	var actions []AdminAction
+	for _, action := range f.actions {
+		if action.Subject == subject {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+func (f *FakeAdminActionStore) ApproveAdminAction(id, adminID uint, note string) (AdminAction, error) {
+	return f.decide(id, adminID, AdminActionApproved, AuditAdminActionApproved, note)
+}
+
+func (f *FakeAdminActionStore) RejectAdminAction(id, adminID uint, note string) (AdminAction, error) {
+	return f.decide(id, adminID, AdminActionRejected, AuditAdminActionRejected, note)
+}
+
+func (f *FakeAdminActionStore) decide(id, adminID uint, status, auditAction, note string) (AdminAction, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return AdminAction{}, err
+	}
+
+	action, err := f.GetAdminAction(id)
+	if err != nil {
+		return action, err
+	}
+	if err := checkAdminActionReview(action, adminID, status == AdminActionApproved); err != nil {
+		return action, err
+	}
+
+	action.Status = status
+	action.DecisionNote = note
+	action.ReviewedBy = adminID
+	action.ReviewedAt = time.Now()
+	f.actions[id-1] = action
+	f.record(adminActor(adminID), auditAction, id)
+	return action, nil
+}
+
+func (f *FakeAdminActionStore) FinishAdminAction(id uint, failure string) (AdminAction, error) {
+	action, err := f.GetAdminAction(id)
+	if err != nil {
+		return action, err
+	}
+	if action.Status != AdminActionApproved {
+		return action, ErrAdminActionDecided
+	}
+
+	action.Status, action.FailureReason, action.ExecutedAt = AdminActionExecuted, failure, time.Now()
+	auditAction := AuditAdminActionExecuted
+	if failure != "" {
+		action.Status, auditAction = AdminActionFailed, AuditAdminActionFailed
+	}
+	f.actions[id-1] = action
+	f.record(adminActor(action.ReviewedBy), auditAction, id)
+	return action, nil
+}
+
+func (f *FakeAdminActionStore) GetStaleApprovedAdminActions(approvedBefore time.Time, limit int) ([]AdminAction, error) {
+	var actions []AdminAction
+	for _, action := range f.actions {
+		if action.Status == AdminActionApproved && action.ReviewedAt.Before(approvedBefore) && len(actions) < limit {
+			actions = append(actions, action)
+		}
+	}
+	return actions, nil
+}
+
+func (f *FakeAdminActionStore) record(actor, action string, id uint) {
+	f.audit = append(f.audit, AuditEntry{Actor: actor, Action: action, Subject: adminActionAuditSubject(id)})
+}
+
+// FakeAdjustmentTargets only carries out balance adjustments, once
+// for each reference
+type FakeAdjustmentTargets struct {
+	LoanApplicationStore
+	WithdrawalApplicationStore
+	balances map[uint]Money
+	posted   map[string]bool
+}
+
+func (f *FakeAdjustmentTargets) PostSoloSaverAdjustment(userID uint, amount Money, credit bool, reference string) (LedgerPostingInformation, error) {
+	if f.posted[reference] {
+		return LedgerPostingInformation{}, ErrJournalAlreadyPosted
+	}
+	if f.posted == nil {
+		f.posted = map[string]bool{}
+	}
+	f.posted[reference] = true
+
+	if !credit {
+		if f.balances[userID] < amount {
+			return LedgerPostingInformation{}, ErrInsufficientLedgerFund
+		}
+		amount = -amount
+	}
+	f.balances[userID] += amount
+	return LedgerPostingInformation{}, nil
+}
+
+func TestNewAdminAction(t *testing.T) {
+	for _, payload := range []AdminActionPayload{
+		BalanceAdjustment{CustomerID: 4, Amount: 2_500_00, Credit: true},
+		WithdrawalApproval{WithdrawalID: 12, Amount: 750_000_00},
+		LoanApproval{ApplicationID: 7, Amount: 2_000_000_00},
+	} {
+		action, err := newAdminAction(payload, 1, " it was credited twice ")
+		if err != nil {
+			t.Fatalf("%s: did not expect an error, got %q", payload.Kind(), err)
+		}
+		if action.Status != AdminActionPending || action.Note != "it was credited twice" || action.Amount != payload.Total() || action.Subject != payload.Subject() {
+			t.Errorf("%s: got %+v", payload.Kind(), action)
+		}
+
+		decoded, err := action.decode()
+		if err != nil || decoded != payload {
+			t.Errorf("%s: decoded %+v and %v, want %+v", payload.Kind(), decoded, err, payload)
+		}
+		if action.Permission() == "" || action.SubjectLink() == "" {
+			t.Errorf("%s: has no permission or subject link", payload.Kind())
+		}
+	}
+
+	t.Run("needs a note", func(t *testing.T) {
+		if _, err := newAdminAction(WithdrawalApproval{WithdrawalID: 12}, 1, " "); err != ErrDecisionNoteRequired {
+			t.Errorf("got %v, want %v", err, ErrDecisionNoteRequired)
+		}
+	})
+
+	t.Run("can't decode kinds it doesn't know", func(t *testing.T) {
+		if _, err := (AdminAction{Kind: "DELETE_EVERYTHING", Payload: []byte("{}")}).decode(); err != ErrUnknownAdminAction {
+			t.Errorf("got %v, want %v", err, ErrUnknownAdminAction)
+		}
+	})
+}
+
+func TestApproveAdminAction(t *testing.T) {
+	const maker, checker uint = 1, 2
+
+	propose := func(t *testing.T, store *FakeAdminActionStore, adjustment BalanceAdjustment) AdminAction {
+		t.Helper()
+		action, err := newAdminAction(adjustment, maker, "correcting a double credit")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if action, err = store.ProposeAdminAction(action); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		return action
+	}
+
+	t.Run("carries the action out once a different admin approves it", func(t *testing.T) {
+		store := &FakeAdminActionStore{}
+		targets := &FakeAdjustmentTargets{balances: map[uint]Money{4: 1_000_00}}
+		action := propose(t, store, BalanceAdjustment{CustomerID: 4, Amount: 400_00})
+
+		if _, err := approveAdminAction(context.Background(), store, targets, nil, action.ID, maker, "looks right"); err != ErrAdminActionSameAdmin {
+			t.Errorf("the maker approving it got %v, want %v", err, ErrAdminActionSameAdmin)
+		}
+		if targets.balances[4] != 1_000_00 {
+			t.Fatalf("the balance changed to %s before it was approved", targets.balances[4])
+		}
+
+		action, err := approveAdminAction(context.Background(), store, targets, nil, action.ID, checker, "looks right")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if action.Status != AdminActionExecuted || action.ReviewedBy != checker || targets.balances[4] != 600_00 {
+			t.Errorf("got %+v and a balance of %s", action, targets.balances[4])
+		}
+
+		var audited []string
+		for _, entry := range store.audit {
+			audited = append(audited, entry.Action)
+		}
+		if len(audited) != 3 || audited[0] != AuditAdminActionProposed || audited[1] != AuditAdminActionApproved || audited[2] != AuditAdminActionExecuted {
+			t.Errorf("audited %v", audited)
+		}
+
+		if _, err := approveAdminAction(context.Background(), store, targets, nil, action.ID, 3, "again"); err != ErrAdminActionDecided {
+			t.Errorf("approving it again got %v, want %v", err, ErrAdminActionDecided)
+		}
+	})
+
+	t.Run("fails actions that can't be carried out", func(t *testing.T) {
+		store := &FakeAdminActionStore{}
+		targets := &FakeAdjustmentTargets{balances: map[uint]Money{4: 100_00}}
+		action := propose(t, store, BalanceAdjustment{CustomerID: 4, Amount: 400_00})
+
+		action, err := approveAdminAction(context.Background(), store, targets, nil, action.ID, checker, "looks right")
+		if err != ErrInsufficientLedgerFund {
+			t.Errorf("got %v, want %v", err, ErrInsufficientLedgerFund)
+		}
+		if action.Status != AdminActionFailed || action.FailureReason != ErrInsufficientLedgerFund.Error() || targets.balances[4] != 100_00 {
+			t.Errorf("got %+v and a balance of %s", action, targets.balances[4])
+		}
+
+		// a failed action can be proposed again
+		propose(t, store, BalanceAdjustment{CustomerID: 4, Amount: 50_00})
+	})
+
+	t.Run("records the admin that approved it as deciding the withdrawal", func(t *testing.T) {
+		sandbox, _, payoutStore, withdrawalID := newSandboxPayouts(t, 1_000_000_00, 750_000_00)
+		withdrawals := &FakeWithdrawalApplicationStore{FakePayoutStore: payoutStore}
+		targets := &FakeAdjustmentTargets{WithdrawalApplicationStore: withdrawals}
+		payouts := NewPayoutService(withdrawals, NewPaymentProviders(sandbox))
+
+		store := &FakeAdminActionStore{}
+		action, _ := newAdminAction(WithdrawalApproval{WithdrawalID: withdrawalID, Amount: 750_000_00}, maker, "customer confirmed by phone")
+		action, _ = store.ProposeAdminAction(action)
+
+		if _, err := approveAdminAction(context.Background(), store, targets, payouts, action.ID, checker, "looks right"); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if withdrawal := withdrawals.withdrawals[withdrawalID]; withdrawal.ReviewedBy != checker || withdrawal.QueueStatus() != WithdrawalPaying {
+			t.Errorf("expected admin %d to have approved the withdrawal, got %+v", checker, withdrawal)
+		}
+		if len(withdrawals.audit) != 1 || withdrawals.audit[0].Actor != adminActor(checker) {
+			t.Errorf("audited %+v", withdrawals.audit)
+		}
+	})
+
+	t.Run("records the admin that approved it as deciding the loan application", func(t *testing.T) {
+		_, payouts, applications, id := newApprovedLoanApplication(t, 2_000_000_00)
+		// proposing it left the application under review
+		application := applications.applications[id]
+		application.Status = LoanApplicationUnderReview
+		applications.applications[id] = application
+		applications.audit = nil
+		targets := &FakeAdjustmentTargets{LoanApplicationStore: applications}
+
+		store := &FakeAdminActionStore{}
+		action, _ := newAdminAction(LoanApproval{ApplicationID: id, Amount: 2_000_000_00}, maker, "income checks out")
+		action, _ = store.ProposeAdminAction(action)
+
+		if _, err := approveAdminAction(context.Background(), store, targets, payouts, action.ID, checker, "looks right"); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if application := applications.applications[id]; application.ReviewedBy != checker {
+			t.Errorf("expected admin %d to have approved the application, got %+v", checker, application)
+		}
+		for _, entry := range applications.audit {
+			if entry.Actor != adminActor(checker) {
+				t.Errorf("expected admin %d to have made every decision, got %+v", checker, entry)
+			}
+		}
+	})
+
+	t.Run("lets the maker take back what they proposed", func(t *testing.T) {
+		store := &FakeAdminActionStore{}
+		action := propose(t, store, BalanceAdjustment{CustomerID: 4, Amount: 400_00, Credit: true})
+
+		if _, err := store.ProposeAdminAction(action); err != ErrAdminActionPending {
+			t.Errorf("proposing it twice got %v, want %v", err, ErrAdminActionPending)
+		}
+		if action, err := store.RejectAdminAction(action.ID, maker, "wrong customer"); err != nil || action.Status != AdminActionRejected {
+			t.Errorf("got %+v and %v", action, err)
+		}
+	})
+}
+
+func TestAdminActionResumer(t *testing.T) {
+	const maker, checker uint = 1, 2
+	ctx := context.Background()
+
+	// approve leaves an action approved, the way a server that stopped
+	// before carrying it out would
+	approve := func(t *testing.T, store *FakeAdminActionStore, payload AdminActionPayload) AdminAction {
+		t.Helper()
+		action, _ := newAdminAction(payload, maker, "correcting a double credit")
+		action, _ = store.ProposeAdminAction(action)
+		action, err := store.ApproveAdminAction(action.ID, checker, "looks right")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		return action
+	}
+
+	later := func() time.Time { return time.Now().Add(staleAdminActionAge + time.Minute) }
+
+	t.Run("carries out actions that were interrupted", func(t *testing.T) {
+		store := &FakeAdminActionStore{}
+		targets := &FakeAdjustmentTargets{balances: map[uint]Money{4: 1_000_00}}
+		action := approve(t, store, BalanceAdjustment{CustomerID: 4, Amount: 400_00})
+
+		resumer := NewAdminActionResumer(store, targets, nil)
+		if resumed, err := resumer.Resume(ctx); err != nil || len(resumed) != 0 {
+			t.Fatalf("an action that was just approved was carried out: %+v, %v", resumed, err)
+		}
+
+		resumer.now = later
+		resumed, err := resumer.Resume(ctx)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if len(resumed) != 1 || resumed[0].Status != AdminActionExecuted || targets.balances[4] != 600_00 {
+			t.Errorf("got %+v and a balance of %s", resumed, targets.balances[4])
+		}
+
+		// the same action can be proposed again once it is finished
+		again, _ := newAdminAction(BalanceAdjustment{CustomerID: 4, Amount: 400_00}, maker, "another double credit")
+		if _, err := store.ProposeAdminAction(again); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+		if action.Subject != again.Subject {
+			t.Errorf("proposed %s, want %s", again.Subject, action.Subject)
+		}
+	})
+
+	t.Run("doesn't post an adjustment that was already posted again", func(t *testing.T) {
+		store := &FakeAdminActionStore{}
+		targets := &FakeAdjustmentTargets{balances: map[uint]Money{4: 1_000_00}}
+		action := approve(t, store, BalanceAdjustment{CustomerID: 4, Amount: 400_00})
+		targets.PostSoloSaverAdjustment(4, 400_00, false, fmt.Sprint(action.ID))
+
+		resumer := NewAdminActionResumer(store, targets, nil)
+		resumer.now = later
+		resumed, err := resumer.Resume(ctx)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if resumed[0].Status != AdminActionExecuted || targets.balances[4] != 600_00 {
+			t.Errorf("got %+v and a balance of %s", resumed[0], targets.balances[4])
+		}
+	})
+
+	t.Run("pays out a withdrawal that was approved before it was interrupted", func(t *testing.T) {
+		sandbox, _, payoutStore, withdrawalID := newSandboxPayouts(t, 1_000_000_00, 750_000_00)
+		withdrawals := &FakeWithdrawalApplicationStore{FakePayoutStore: payoutStore}
+		targets := &FakeAdjustmentTargets{WithdrawalApplicationStore: withdrawals}
+		payouts := NewPayoutService(withdrawals, NewPaymentProviders(sandbox))
+
+		store := &FakeAdminActionStore{}
+		approve(t, store, WithdrawalApproval{WithdrawalID: withdrawalID, Amount: 750_000_00})
+		withdrawals.ApproveWithdrawalApplication(withdrawalID, checker, "customer confirmed by phone")
+
+		resumer := NewAdminActionResumer(store, targets, payouts)
+		resumer.now = later
+		resumed, err := resumer.Resume(ctx)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if resumed[0].Status != AdminActionExecuted || len(payoutStore.payouts) != 1 {
+			t.Errorf("got %+v and payouts %+v", resumed[0], payoutStore.payouts)
+		}
+	})
+
+	t.Run("leaves a loan application that was paid out alone", func(t *testing.T) {
+		_, payouts, applications, id := newApprovedLoanApplication(t, 2_000_000_00)
+		if _, err := disburseLoanApplication(ctx, applications, payouts, id, checker); err != nil {
+			t.Fatal(err)
+		}
+		targets := &FakeAdjustmentTargets{LoanApplicationStore: applications}
+
+		store := &FakeAdminActionStore{}
+		approve(t, store, LoanApproval{ApplicationID: id, Amount: 2_000_000_00})
+
+		resumer := NewAdminActionResumer(store, targets, payouts)
+		resumer.now = later
+		resumed, err := resumer.Resume(ctx)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+		if resumed[0].Status != AdminActionExecuted || applications.applications[id].Status != LoanApplicationDisbursed {
+			t.Errorf("got %+v and %+v", resumed[0], applications.applications[id])
+		}
+	})
+}
+
+func TestApprovalPolicyFromEnv(t *testing.T) {
+	t.Setenv("LARGE_WITHDRAWAL_AMOUNT", "250,000")
+
+	policy, err := ApprovalPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+	if policy.LargeWithdrawal != 250_000_00 || policy.LargeLoan != defaultApprovalPolicy.LargeLoan {
+		t.Errorf("got %+v", policy)
+	}
+
+	t.Setenv("LARGE_LOAN_AMOUNT", "a lot")
+	if _, err := ApprovalPolicyFromEnv(); err == nil {
+		t.Errorf("expected an error for an amount that isn't one")
+	}
+}
+
+func TestAdjustmentJournal(t *testing.T) {
+	for _, credit := range []bool{true, false} {
+		if err := adjustmentJournal("ADJUSTMENT:1", soloSavingsLedgerAccount(4), 400_00, credit).Validate(); err != nil {
+			t.Errorf("credit %t: did not expect an error, got %q", credit, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package web_app
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Admins work through queues of what customers have asked for: loan
+// applications, investment applications and withdrawals. Each queue is
+// filtered by status, sorted, and shown a page at a time.
+
+// How a queue can be sorted. Queues are oldest first unless asked
+// otherwise, so that what has waited longest is decided first.
+const (
+	QueueSortOldest  = "oldest"
+	QueueSortNewest  = "newest"
+	QueueSortLargest = "largest"
+)
+
+const adminQueuePageSize = 50
+
+var (
+	ErrUnknownQueueStatus   = errors.New("unknown status")
+	ErrUnknownQueueSort     = errors.New("unknown sort order")
+	ErrUnknownQueuePage     = errors.New("pages are counted from 1")
+	ErrDecisionNoteRequired = errors.New("decisions need a note saying why")
+)
+
+type AdminQueueFilter struct {
+	// Status is empty for every status
+	Status string
+	Sort   string
+	// Page counts from 1
+	Page int
+}
+
+// adminQueueFilter reads a queue's filter from its query string.
+// Statuses are upper-cased, and must be ones that isStatus knows.
+func adminQueueFilter(query url.Values, isStatus func(string) bool) (AdminQueueFilter, error) {
+	filter := AdminQueueFilter{
+		Status: strings.ToUpper(query.Get("status")),
+		Sort:   query.Get("sort"),
+		Page:   1,
+	}
+
+	if filter.Status != "" && !isStatus(filter.Status) {
+		return filter, ErrUnknownQueueStatus
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = QueueSortOldest
+	case QueueSortOldest, QueueSortNewest, QueueSortLargest:
+	default:
+		return filter, ErrUnknownQueueSort
+	}
+
+	if page := query.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return filter, ErrUnknownQueuePage
+		}
+		filter.Page = n
+	}
+
+	return filter, nil
+}
+
+// Limit is one row more than fits on a page, which tells queuePage
+// whether there is a next page
+func (f AdminQueueFilter) Limit() int {
+	return adminQueuePageSize + 1
+}
+
+func (f AdminQueueFilter) Offset() int {
+	return (max(f.Page, 1) - 1) * adminQueuePageSize
+}
+
+func (f AdminQueueFilter) HasPrevious() bool {
+	return f.Page > 1
+}
+
+// StatusLink, SortLink, PreviousLink and NextLink are query strings
+// for the queue with one part of the filter changed. Changing the
+// status or the sort goes back to the first page.
+func (f AdminQueueFilter) StatusLink(status string) string {
+	return f.link(status, f.Sort, 1)
+}
+
+func (f AdminQueueFilter) SortLink(sort string) string {
+	return f.link(f.Status, sort, 1)
+}
+
+func (f AdminQueueFilter) PreviousLink() string {
+	return f.link(f.Status, f.Sort, f.Page-1)
+}
+
+func (f AdminQueueFilter) NextLink() string {
+	return f.link(f.Status, f.Sort, f.Page+1)
+}
+
+func (f AdminQueueFilter) link(status, sort string, page int) string {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", strings.ToLower(status))
+	}
+	if sort != "" && sort != QueueSortOldest {
+		query.Set("sort", sort)
+	}
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	return "?" + query.Encode()
+}
+
+// queuePage cuts a page fetched with the filter's Limit down to size,
+// and says whether there is another page after it
+func queuePage[T any](items []T) ([]T, bool) {
+	if len(items) > adminQueuePageSize {
+		return items[:adminQueuePageSize], true
+	}
+	return items, false
+}
+
+// decisionNote is the reason an admin gave for a decision, which every
+// decision needs
+func decisionNote(note string) (string, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return note, ErrDecisionNoteRequired
+	}
+	return note, nil
+}
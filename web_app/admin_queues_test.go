@@ -0,0 +1,76 @@
+package web_app
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAdminQueueFilter(t *testing.T) {
+	filter, err := adminQueueFilter(url.Values{"status": {"under_review"}, "sort": {"largest"}, "page": {"3"}}, isLoanApplicationStatus)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+	if filter != (AdminQueueFilter{Status: LoanApplicationUnderReview, Sort: QueueSortLargest, Page: 3}) {
+		t.Errorf("got %+v", filter)
+	}
+	if filter.Offset() != 2*adminQueuePageSize || filter.Limit() != adminQueuePageSize+1 {
+		t.Errorf("got an offset of %d and a limit of %d", filter.Offset(), filter.Limit())
+	}
+
+	t.Run("is the oldest first on the first page by default", func(t *testing.T) {
+		filter, err := adminQueueFilter(url.Values{}, isLoanApplicationStatus)
+		if err != nil || filter != (AdminQueueFilter{Sort: QueueSortOldest, Page: 1}) || filter.Offset() != 0 || filter.HasPrevious() {
+			t.Errorf("got %+v and %v", filter, err)
+		}
+	})
+
+	t.Run("turns away what it doesn't know", func(t *testing.T) {
+		for name, test := range map[string]struct {
+			query url.Values
+			want  error
+		}{
+			"status": {url.Values{"status": {"lost"}}, ErrUnknownQueueStatus},
+			"sort":   {url.Values{"sort": {"random"}}, ErrUnknownQueueSort},
+			"page":   {url.Values{"page": {"0"}}, ErrUnknownQueuePage},
+		} {
+			if _, err := adminQueueFilter(test.query, isLoanApplicationStatus); err != test.want {
+				t.Errorf("%s: got %v, want %v", name, err, test.want)
+			}
+		}
+	})
+
+	t.Run("links to the queue with one part changed", func(t *testing.T) {
+		for got, want := range map[string]string{
+			filter.StatusLink("approved"): "?sort=largest&status=approved",
+			filter.SortLink("oldest"):     "?status=under_review",
+			filter.PreviousLink():         "?page=2&sort=largest&status=under_review",
+			filter.NextLink():             "?page=4&sort=largest&status=under_review",
+		} {
+			if got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		}
+	})
+}
+
+func TestQueuePage(t *testing.T) {
+	full := make([]int, adminQueuePageSize+1)
+
+	if page, hasNext := queuePage(full); len(page) != adminQueuePageSize || !hasNext {
+		t.Errorf("got %d rows, and a next page %t", len(page), hasNext)
+	}
+
+	if page, hasNext := queuePage(full[:3]); len(page) != 3 || hasNext {
+		t.Errorf("got %d rows, and a next page %t", len(page), hasNext)
+	}
+}
+
+func TestDecisionNote(t *testing.T) {
+	if note, err := decisionNote("  income checked "); err != nil || note != "income checked" {
+		t.Errorf("got %q and %v", note, err)
+	}
+
+	if _, err := decisionNote(" "); err != ErrDecisionNoteRequired {
+		t.Errorf("got %v, want %v", err, ErrDecisionNoteRequired)
+	}
+}
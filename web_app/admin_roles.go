@@ -0,0 +1,152 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Admins are given roles, and roles are given permissions. Each admin
+// route needs a permission, so an admin can only see and do what their
+// roles let them. Super-admins assign the roles.
+
+// What an admin can be allowed to do
+const (
+	PermissionLoansView          = "loans.view"
+	PermissionLoansApprove       = "loans.approve"
+	PermissionInvestmentsView    = "investments.view"
+	PermissionInvestmentsManage  = "investments.manage"
+	PermissionInvestmentsApprove = "investments.approve"
+	PermissionWithdrawalsView    = "withdrawals.view"
+	PermissionWithdrawalsApprove = "withdrawals.approve"
+	PermissionPaymentsView       = "payments.view"
+	PermissionPaymentsRefund     = "payments.refund"
+	PermissionWebhooksReplay     = "webhooks.replay"
+	PermissionUsersView          = "users.view"
+	PermissionUsersSuspend       = "users.suspend"
+	PermissionBalancesAdjust     = "balances.adjust"
+	PermissionReportsView        = "reports.view"
+	PermissionRolesAssign        = "roles.assign"
+)
+
+// RoleSuperAdmin has every permission, including ones added after its
+// admins were given it
+const RoleSuperAdmin = "super-admin"
+
+// AuditAdminRolesAssigned is the audit log action for changing an
+// admin's roles
+const AuditAdminRolesAssigned = "ADMIN_ROLES_ASSIGNED"
+
+var (
+	ErrUnknownAdminRole       = errors.New("unknown role")
+	ErrCantRemoveOwnRoleGrant = errors.New("you can't take away your own permission to assign roles")
+)
+
+type AdminPermission struct {
+	Name        string
+	Description string
+}
+
+// adminPermissions are every permission, in the order they are shown
+var adminPermissions = []AdminPermission{
+	{PermissionLoansView, "See loan applications"},
+	{PermissionLoansApprove, "Approve, reject and disburse loan applications"},
+	{PermissionInvestmentsView, "See investment products and applications"},
+	{PermissionInvestmentsManage, "Add investment products, and offer or withdraw them"},
+	{PermissionInvestmentsApprove, "Approve and reject investment applications"},
+	{PermissionWithdrawalsView, "See withdrawals"},
+	{PermissionWithdrawalsApprove, "Approve, reject and pay out withdrawals"},
+	{PermissionPaymentsView, "See payments and webhooks"},
+	{PermissionPaymentsRefund, "Refund payments"},
+	{PermissionWebhooksReplay, "Replay webhooks"},
+	{PermissionUsersView, "See customers' accounts"},
+	{PermissionUsersSuspend, "Suspend and reinstate customers' accounts"},
+	{PermissionBalancesAdjust, "Propose and approve adjustments to customers' balances"},
+	{PermissionReportsView, "See reports, like overdue loans"},
+	{PermissionRolesAssign, "Make customers admins and assign their roles"},
+}
+
+type AdminRole struct {
+	ID          uint
+	Name        string
+	Description string
+	// Permissions is empty for super-admins, who have all of them
+	Permissions []string
+}
+
+// Grants is every permission the role gives
+func (r AdminRole) Grants() []string {
+	if r.Name != RoleSuperAdmin {
+		return r.Permissions
+	}
+
+	grants := make([]string, 0, len(adminPermissions))
+	for _, permission := range adminPermissions {
+		grants = append(grants, permission.Name)
+	}
+	return grants
+}
+
+// AdminPermissions is the set of permissions an admin's roles give them
+type AdminPermissions map[string]bool
+
+func adminPermissionsFor(roles []AdminRole) AdminPermissions {
+	permissions := AdminPermissions{}
+	for _, role := range roles {
+		for _, permission := range role.Grants() {
+			permissions[permission] = true
+		}
+	}
+	return permissions
+}
+
+func (p AdminPermissions) Has(permission string) bool {
+	return p[permission]
+}
+
+type AdminUser struct {
+	CustomerID uint
+	Name       string
+	Email      string
+	Roles      []string
+}
+
+func (a AdminUser) HasRole(role string) bool {
+	return slices.Contains(a.Roles, role)
+}
+
+func adminAuditSubject(customerID uint) string {
+	return fmt.Sprintf("admin:%d", customerID)
+}
+
+// checkRoleAssignment checks that chosen are roles that exist, and that
+// admins assigning their own roles keep a role that lets them assign
+// roles. Without that, the last super-admin could lock everyone out.
+func checkRoleAssignment(roles []AdminRole, chosen []string, self bool) error {
+	var granted []AdminRole
+	for _, name := range chosen {
+		i := slices.IndexFunc(roles, func(role AdminRole) bool { return role.Name == name })
+		if i == -1 {
+			return ErrUnknownAdminRole
+		}
+		granted = append(granted, roles[i])
+	}
+
+	if self && !adminPermissionsFor(granted).Has(PermissionRolesAssign) {
+		return ErrCantRemoveOwnRoleGrant
+	}
+	return nil
+}
+
+type AdminRoleStore interface {
+	// GetAdminPermissions is what a customer's roles let them do.
+	// Customers that aren't admins get ErrNotAdmin.
+	GetAdminPermissions(customerID uint) (AdminPermissions, error)
+	GetAdminRoles() ([]AdminRole, error)
+	GetAdmins() ([]AdminUser, error)
+	// AssignAdminRoles replaces the roles of the customer with the email
+	// address, making them an admin if they weren't one, and records it
+	// in the audit log. Taking every role away stops them being an
+	// admin. Unknown email addresses get ErrAccountDoesNotExist.
+	AssignAdminRoles(email string, roles []string, assignedBy uint) (AdminUser, error)
+}
@@ -0,0 +1,159 @@
+package web_app
+
+import (
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+)
+
+var testAdminRoles = []AdminRole{
+	{ID: 1, Name: RoleSuperAdmin},
+	{ID: 2, Name: "loan-officer", Permissions: []string{PermissionLoansView, PermissionLoansApprove}},
+	{ID: 3, Name: "auditor", Permissions: []string{PermissionLoansView, PermissionReportsView}},
+}
+
+func TestAdminPermissionsFor(t *testing.T) {
+	permissions := adminPermissionsFor(testAdminRoles[1:])
+
+	for permission, want := range map[string]bool{
+		PermissionLoansView:    true,
+		PermissionLoansApprove: true,
+		PermissionReportsView:  true,
+		PermissionRolesAssign:  false,
+		"":                     false,
+	} {
+		if permissions.Has(permission) != want {
+			t.Errorf("%q: got %t, want %t", permission, !want, want)
+		}
+	}
+
+	t.Run("gives super-admins every permission", func(t *testing.T) {
+		permissions := adminPermissionsFor(testAdminRoles[:1])
+		for _, permission := range adminPermissions {
+			if !permissions.Has(permission.Name) {
+				t.Errorf("super-admins don't have %q", permission.Name)
+			}
+		}
+	})
+}
+
+func TestCheckRoleAssignment(t *testing.T) {
+	for name, test := range map[string]struct {
+		chosen []string
+		self   bool
+		want   error
+	}{
+		"roles that exist":                   {[]string{"loan-officer", "auditor"}, false, nil},
+		"no roles":                           {nil, false, nil},
+		"a role that doesn't exist":          {[]string{"loan-officer", "owner"}, false, ErrUnknownAdminRole},
+		"own roles, keeping super-admin":     {[]string{RoleSuperAdmin, "auditor"}, true, nil},
+		"own roles, losing roles.assign":     {[]string{"loan-officer"}, true, ErrCantRemoveOwnRoleGrant},
+		"own roles, stopping being an admin": {nil, true, ErrCantRemoveOwnRoleGrant},
+	} {
+		if err := checkRoleAssignment(testAdminRoles, test.chosen, test.self); err != test.want {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
+
+// FakeAdminPermissionStore gives each admin the permissions of their
+// roles. Everything else on the store is left out.
+type FakeAdminPermissionStore struct {
+	IStore
+	roles map[uint][]AdminRole
+}
+
+func (f *FakeAdminPermissionStore) GetAdminPermissions(customerID uint) (AdminPermissions, error) {
+	roles, ok := f.roles[customerID]
+	if !ok {
+		return AdminPermissions{}, ErrNotAdmin
+	}
+	return adminPermissionsFor(roles), nil
+}
+
+// loggedInRequest is a request to url from a new session for the user
+func loggedInRequest(t *testing.T, cookieStore *sessions.CookieStore, userID uint, role string, url string) *http.Request {
+	t.Helper()
+
+	login := httptest.NewRequest(http.MethodGet, "/login", nil)
+	response := httptest.NewRecorder()
+	session, _ := cookieStore.Get(login, "session")
+	storeSessionCookie(session, login, response, NewUserSession(userID, role))
+
+	r := httptest.NewRequest(http.MethodGet, url, nil)
+	for _, cookie := range response.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestRequirePermission(t *testing.T) {
+	gob.Register(&UserCookie{})
+	cookieStore := sessions.NewCookieStore([]byte("test-session-key-that-is-32-byte"))
+	store := &FakeAdminPermissionStore{roles: map[uint][]AdminRole{
+		1: testAdminRoles[1:2],
+		2: testAdminRoles[2:3],
+	}}
+	h := &HandlerManager{store: store, cookieStore: cookieStore}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for name, test := range map[string]struct {
+		userID      uint
+		role        string
+		permissions []string
+		want        int
+	}{
+		"an admin with the permission":                 {1, RoleAdmin, []string{PermissionLoansApprove}, http.StatusOK},
+		"an admin with one of the permissions":         {1, RoleAdmin, []string{PermissionBalancesAdjust, PermissionLoansApprove}, http.StatusOK},
+		"an admin that can decide some admin actions":  {1, RoleAdmin, adminActionPermissions(), http.StatusOK},
+		"an admin without the permission":              {2, RoleAdmin, []string{PermissionLoansApprove}, http.StatusForbidden},
+		"an admin that can't decide any admin actions": {2, RoleAdmin, adminActionPermissions(), http.StatusForbidden},
+		"a customer": {3, RoleBasic, []string{PermissionLoansView}, http.StatusForbidden},
+	} {
+		response := httptest.NewRecorder()
+		h.requirePermission(test.permissions...)(ok).ServeHTTP(response, loggedInRequest(t, cookieStore, test.userID, test.role, "/admin/loan-applications"))
+
+		if response.Code != test.want {
+			t.Errorf("%s: got %d, want %d", name, response.Code, test.want)
+		}
+	}
+
+	t.Run("logs out requests without a session", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		h.requirePermission(PermissionLoansView)(ok).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/admin/loan-applications", nil))
+
+		if response.Code != http.StatusTemporaryRedirect || response.Header().Get("Location") != "/login" {
+			t.Errorf("expected a redirect to log in, got %d to %q", response.Code, response.Header().Get("Location"))
+		}
+	})
+}
+
+func TestGetAdminSessionOrLogout(t *testing.T) {
+	gob.Register(&UserCookie{})
+	cookieStore := sessions.NewCookieStore([]byte("test-session-key-that-is-32-byte"))
+	h := &HandlerManager{cookieStore: cookieStore}
+
+	t.Run("accepts an admin's session", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		session, err := h.getAdminSessionOrLogout(response, loggedInRequest(t, cookieStore, 1, RoleAdmin, "/admin"))
+
+		if err != nil || session.UserID != 1 {
+			t.Errorf("expected admin 1's session, got %+v and %v", session, err)
+		}
+	})
+
+	t.Run("refuses a customer's session", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		_, err := h.getAdminSessionOrLogout(response, loggedInRequest(t, cookieStore, 2, RoleBasic, "/admin"))
+
+		if err != ErrNotAdmin || response.Code != http.StatusForbidden {
+			t.Errorf("expected %q and a 403, got %v and %d", ErrNotAdmin, err, response.Code)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package web_app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The audit log records who did what to money, and why. Rows are
+// never changed or deleted.
+
+// Actors that aren't a person
+const (
+	ActorSystem = "system"
+)
+
+type AuditEntry struct {
+	ID uint
+	// Actor is who did it, e.g. admin:3, system or a provider's name
+	Actor  string
+	Action string
+	// Subject is what it was done to, e.g. payment:<reference>
+	Subject   string
+	Detail    string
+	CreatedAt time.Time
+}
+
+type AuditStore interface {
+	RecordAudit(entry AuditEntry) error
+	// GetAuditLog lists what was done to subject, newest first
+	GetAuditLog(subject string, limit int) ([]AuditEntry, error)
+}
+
+func adminActor(userID uint) string {
+	return fmt.Sprintf("admin:%d", userID)
+}
+
+func customerActor(userID uint) string {
+	return fmt.Sprintf("customer:%d", userID)
+}
+
+func paymentAuditSubject(reference uuid.UUID) string {
+	return fmt.Sprintf("payment:%s", reference)
+}
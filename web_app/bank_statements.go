@@ -0,0 +1,715 @@
+package web_app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Customers can upload a bank statement with their loan application,
+// exported from their bank's app as a CSV or a PDF. Its transactions
+// are read out of it and summarised for underwriters: what comes in
+// each month, whether a salary does, the balance the customer keeps
+// and what they already pay other lenders.
+
+const (
+	StatementCSV = "CSV"
+	StatementPDF = "PDF"
+)
+
+// maxBankStatementSize is the largest statement that can be uploaded
+const maxBankStatementSize = 5 << 20
+
+// maxStatementAmount bounds the amounts read from a statement, so that
+// adding them up can't overflow
+const maxStatementAmount Money = 10_000_000_000_000
+
+var (
+	ErrUnreadableBankStatement = errors.New("we couldn't find any transactions in that statement. Upload the CSV or PDF your bank gave you")
+	ErrBankStatementTooLarge   = errors.New("statements can be at most 5MB")
+	ErrBankStatementNotFound   = errors.New("no bank statement was uploaded with the application")
+)
+
+// StatementTransaction is a line on a bank statement. One of Credit or
+// Debit is set.
+type StatementTransaction struct {
+	Date        time.Time
+	Description string
+	Credit      Money
+	Debit       Money
+	Balance     Money
+	// HasBalance is false when the statement didn't give the balance
+	// after the transaction
+	HasBalance bool
+}
+
+// BankStatementAnalysis is what an uploaded statement says about the
+// customer's finances. Monthly figures are averages over the months
+// the statement covers.
+type BankStatementAnalysis struct {
+	FileName string `json:"-"`
+	Format   string `json:"-"`
+
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Months       int       `json:"months"`
+	Transactions int       `json:"transactions"`
+	// Skipped is how many lines looked like transactions but couldn't
+	// be read
+	Skipped       int   `json:"skipped"`
+	TotalCredits  Money `json:"total_credits"`
+	TotalDebits   Money `json:"total_debits"`
+	MonthlyIncome Money `json:"monthly_income"`
+	// Salary is the usual amount of a credit that came in most months,
+	// and is 0 if there wasn't one
+	Salary       Money  `json:"salary"`
+	SalaryFrom   string `json:"salary_from"`
+	SalaryMonths int    `json:"salary_months"`
+	// AverageBalance is the balance at the end of each day, averaged
+	AverageBalance Money `json:"average_balance"`
+	// LoanRepayments is what goes to lenders each month
+	LoanRepayments Money    `json:"loan_repayments"`
+	Lenders        []string `json:"lenders"`
+}
+
+type BankStatementStore interface {
+	// GetLoanApplicationStatement is the analysis of the statement
+	// uploaded with an application, or ErrBankStatementNotFound
+	GetLoanApplicationStatement(applicationID uint) (BankStatementAnalysis, error)
+}
+
+// readBankStatement reads the transactions out of an uploaded statement
+// and analyses them
+func readBankStatement(fileName string, contents []byte) (BankStatementAnalysis, error) {
+	var transactions []StatementTransaction
+	var skipped int
+	format := StatementCSV
+
+	if bytes.HasPrefix(contents, []byte("%PDF-")) {
+		format = StatementPDF
+		text, err := extractPDFText(contents)
+		if err != nil {
+			return BankStatementAnalysis{}, ErrUnreadableBankStatement
+		}
+		transactions, skipped = parseStatementText(text)
+	} else {
+		transactions, skipped = parseStatementCSV(contents)
+	}
+
+	if len(transactions) == 0 {
+		return BankStatementAnalysis{}, ErrUnreadableBankStatement
+	}
+
+	analysis := analyzeBankStatement(transactions)
+	analysis.FileName = fileName
+	analysis.Format = format
+	analysis.Skipped = skipped
+	return analysis, nil
+}
+
+// uploadedBankStatement reads the statement uploaded with a loan
+// application, and is nil if there wasn't one
+func uploadedBankStatement(r *http.Request) (*BankStatementAnalysis, error) {
+	file, header, err := r.FormFile("bank-statement")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrUnreadableBankStatement
+	}
+	defer file.Close()
+
+	if header.Size > maxBankStatementSize {
+		return nil, ErrBankStatementTooLarge
+	}
+
+	contents, err := io.ReadAll(io.LimitReader(file, maxBankStatementSize))
+	if err != nil {
+		return nil, ErrUnreadableBankStatement
+	}
+
+	fileName := filepath.Base(header.Filename)
+	if len(fileName) > 255 {
+		fileName = strings.ToValidUTF8(fileName[:255], "")
+	}
+
+	analysis, err := readBankStatement(fileName, contents)
+	if err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// statementColumns are what banks call each column in their CSV
+// exports, best first, once lowercased with punctuation taken out
+var statementColumns = map[string][]string{
+	"date":        {"transaction date", "trans date", "tran date", "txn date", "posted date", "post date", "date posted", "posting date", "date time", "date", "value date"},
+	"description": {"description", "narration", "narrative", "remarks", "remark", "transaction details", "details", "particulars", "memo"},
+	"credit":      {"credit", "credits", "credit amount", "money in", "deposit", "deposits", "lodgement", "lodgements", "inflow", "cr"},
+	"debit":       {"debit", "debits", "debit amount", "money out", "withdrawal", "withdrawals", "outflow", "dr"},
+	"amount":      {"amount", "transaction amount"},
+	"direction":   {"dr cr", "cr dr", "type", "transaction type", "debit credit"},
+	"balance":     {"balance", "running balance", "closing balance", "balance after", "available balance", "ledger balance"},
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+func normalizeStatementHeader(header string) string {
+	return strings.TrimSpace(nonAlphanumeric.ReplaceAllString(strings.ToLower(header), " "))
+}
+
+// statementHeader finds the columns in a row, and is false if it isn't
+// a header row
+func statementHeader(row []string) (map[string]int, bool) {
+	names := map[string]int{}
+	for i, cell := range row {
+		if _, ok := names[normalizeStatementHeader(cell)]; !ok {
+			names[normalizeStatementHeader(cell)] = i
+		}
+	}
+
+	columns := map[string]int{}
+	for column, candidates := range statementColumns {
+		for _, candidate := range candidates {
+			if i, ok := names[candidate]; ok {
+				columns[column] = i
+				break
+			}
+		}
+	}
+
+	_, hasDate := columns["date"]
+	_, hasCredit := columns["credit"]
+	_, hasDebit := columns["debit"]
+	_, hasAmount := columns["amount"]
+	return columns, hasDate && ((hasCredit && hasDebit) || hasAmount)
+}
+
+// parseStatementCSV reads the transactions in a CSV export, which can
+// have a few lines about the account before its header. It is also how
+// many rows had a date but amounts that couldn't be read.
+func parseStatementCSV(contents []byte) ([]StatementTransaction, int) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(contents, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var transactions []StatementTransaction
+	var columns map[string]int
+	skipped := 0
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a malformed line is skipped like a line we can't read
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			break
+		}
+
+		if columns == nil {
+			if header, ok := statementHeader(row); ok {
+				columns = header
+			}
+			continue
+		}
+
+		cell := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		date, ok := parseStatementDate(cell("date"))
+		if !ok {
+			continue
+		}
+
+		transaction, ok := statementCSVTransaction(cell)
+		if !ok {
+			skipped++
+			continue
+		}
+		// rows like the opening balance move no money
+		if transaction.Credit == 0 && transaction.Debit == 0 {
+			continue
+		}
+		transaction.Date = date
+		transaction.Description = cell("description")
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, skipped
+}
+
+func statementCSVTransaction(cell func(string) string) (StatementTransaction, bool) {
+	var transaction StatementTransaction
+
+	if balance := cell("balance"); balance != "" {
+		amount, ok := parseStatementAmount(balance)
+		if !ok {
+			return transaction, false
+		}
+		transaction.Balance = amount
+		transaction.HasBalance = true
+	}
+
+	credit, creditOK := parseStatementAmount(cell("credit"))
+	debit, debitOK := parseStatementAmount(cell("debit"))
+	if creditOK && debitOK && (credit != 0 || debit != 0) {
+		// some banks show money out as a negative amount
+		transaction.Credit, transaction.Debit = absMoney(credit), absMoney(debit)
+		return transaction, (transaction.Credit == 0) != (transaction.Debit == 0)
+	}
+
+	if cell("amount") == "" {
+		// a row without amounts moves no money, like the opening balance
+		return transaction, creditOK && debitOK
+	}
+
+	amount, ok := parseStatementAmount(cell("amount"))
+	if !ok {
+		return transaction, false
+	}
+
+	direction := strings.ToLower(cell("direction"))
+	switch {
+	case strings.HasPrefix(direction, "c"):
+		transaction.Credit = absMoney(amount)
+	case strings.HasPrefix(direction, "d"):
+		transaction.Debit = absMoney(amount)
+	case amount < 0:
+		transaction.Debit = -amount
+	default:
+		transaction.Credit = amount
+	}
+	return transaction, true
+}
+
+var (
+	statementAmountPattern = regexp.MustCompile(`^\(?-?(₦|NGN)?-?\d{1,3}(,\d{3})*\.\d{2}\)?(CR|DR|Cr|Dr)?$|^\(?-?(₦|NGN)?-?\d+\.\d{2}\)?(CR|DR|Cr|Dr)?$`)
+	statementTimePattern   = regexp.MustCompile(`^\d{1,2}:\d{2}(:\d{2})?$|^(?i:am|pm)$`)
+)
+
+// parseStatementAmount reads an amount the way banks write them, e.g.
+// "1,250.00", "-₦1,250.00", "(1,250.00)" or "1,250.00CR". Money out can
+// come back negative. A blank amount, or "-", is 0.
+func parseStatementAmount(value string) (Money, bool) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), " ", "")
+	if value == "" || value == "-" {
+		return 0, true
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	switch strings.ToUpper(value[max(len(value)-2, 0):]) {
+	case "DR":
+		negative = true
+		value = value[:len(value)-2]
+	case "CR":
+		value = value[:len(value)-2]
+	}
+	if strings.HasPrefix(value, "-") {
+		negative = true
+		value = value[1:]
+	}
+	value = strings.TrimPrefix(value, "₦")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "NGN"), "-")
+
+	amount, err := ParseMoney(value)
+	if err != nil || amount > maxStatementAmount {
+		return 0, false
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, true
+}
+
+func absMoney(amount Money) Money {
+	if amount < 0 {
+		return -amount
+	}
+	return amount
+}
+
+// statementDateLayouts are the ways banks write dates, day first
+var statementDateLayouts = []string{
+	"2-Jan-2006", "2-Jan-06", "2 Jan 2006", "2 Jan 06", "2/1/2006", "2/1/06", "2-1-2006", "2.1.2006",
+	"2006-1-2", "2006/1/2", "Jan 2, 2006", "2 January 2006", "2-January-2006", "January 2, 2006",
+}
+
+// parseStatementDate reads a date with or without the time after it
+func parseStatementDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	candidates := []string{value}
+	if before, _, found := strings.Cut(value, "T"); found {
+		candidates = append(candidates, before)
+	}
+	fields := strings.Fields(value)
+	for n := len(fields) - 1; n > 0; n-- {
+		candidates = append(candidates, strings.Join(fields[:n], " "))
+	}
+
+	for _, candidate := range candidates {
+		if date, ok := statementDate(candidate); ok {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// statementDate reads a date that is nothing but the date
+func statementDate(value string) (time.Time, bool) {
+	for _, layout := range statementDateLayouts {
+		date, err := time.Parse(layout, value)
+		if err == nil && date.Year() >= 2000 && date.Year() <= time.Now().Year()+1 {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseStatementText reads the transactions in the text of a PDF
+// statement: the lines that start with a date and end with amounts.
+// Which way money went is read from the debit and credit columns when
+// both are printed, and otherwise from how the balance moved.
+func parseStatementText(text string) ([]StatementTransaction, int) {
+	var transactions []StatementTransaction
+	skipped := 0
+	var balance Money
+	hasBalance := false
+
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		lower := strings.ToLower(line)
+
+		if strings.Contains(lower, "opening balance") || strings.Contains(lower, "balance b/f") || strings.Contains(lower, "brought forward") {
+			if amount, ok := parseStatementAmount(fields[len(fields)-1]); ok {
+				balance, hasBalance = amount, true
+			}
+			continue
+		}
+
+		date, rest, ok := statementLineDate(fields)
+		if !ok {
+			continue
+		}
+		// the value date often follows the transaction date
+		if _, after, ok := statementLineDate(rest); ok {
+			rest = after
+		}
+
+		// the amounts are at the end of the line
+		amountsStart := len(rest)
+		for amountsStart > 0 && statementAmountField(rest[amountsStart-1]) {
+			amountsStart--
+		}
+		amounts := rest[amountsStart:]
+		description := strings.Join(rest[:amountsStart], " ")
+		if len(amounts) == 0 {
+			continue
+		}
+
+		values := make([]Money, len(amounts))
+		for i, field := range amounts {
+			values[i], _ = parseStatementAmount(field)
+		}
+
+		transaction := StatementTransaction{Date: date, Description: description}
+		switch {
+		case len(values) >= 3:
+			debit, credit := absMoney(values[len(values)-3]), absMoney(values[len(values)-2])
+			transaction.Debit, transaction.Credit = debit, credit
+			transaction.Balance, transaction.HasBalance = values[len(values)-1], true
+		case len(values) == 2:
+			transaction.Balance, transaction.HasBalance = values[1], true
+			amount := values[0]
+			switch {
+			case hasBalance && transaction.Balance-balance == absMoney(amount):
+				transaction.Credit = absMoney(amount)
+			case hasBalance && balance-transaction.Balance == absMoney(amount):
+				transaction.Debit = absMoney(amount)
+			case strings.HasSuffix(strings.ToUpper(amounts[0]), "CR"):
+				transaction.Credit = absMoney(amount)
+			case amount < 0:
+				transaction.Debit = -amount
+			}
+		default:
+			// a single amount has to say which way it went
+			switch amount := values[0]; {
+			case strings.HasSuffix(strings.ToUpper(amounts[0]), "CR"):
+				transaction.Credit = absMoney(amount)
+			case amount < 0:
+				transaction.Debit = -amount
+			}
+		}
+
+		if transaction.HasBalance {
+			balance, hasBalance = transaction.Balance, true
+		}
+		if (transaction.Credit == 0) == (transaction.Debit == 0) {
+			skipped++
+			continue
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, skipped
+}
+
+// statementLineDate reads the date at the start of a line's fields,
+// which can be split over three of them, and skips the time after it
+func statementLineDate(fields []string) (time.Time, []string, bool) {
+	for _, n := range []int{3, 1} {
+		if len(fields) < n {
+			continue
+		}
+		date, ok := statementDate(strings.Join(fields[:n], " "))
+		if n == 1 {
+			date, ok = parseStatementDate(fields[0])
+		}
+		if !ok {
+			continue
+		}
+		rest := fields[n:]
+		for len(rest) > 0 && statementTimePattern.MatchString(rest[0]) {
+			rest = rest[1:]
+		}
+		return date, rest, true
+	}
+	return time.Time{}, fields, false
+}
+
+func statementAmountField(field string) bool {
+	return field == "-" || statementAmountPattern.MatchString(field)
+}
+
+// salaryKeywords mark a credit as a salary wherever it came from
+var salaryKeywords = []string{"salary", "salaries", "payroll", "wages", "stipend"}
+
+// lenderKeywords mark a debit as a loan repayment, and name the lender
+// when it is one we know
+var lenderKeywords = map[string]string{
+	"loan":        "",
+	"repayment":   "",
+	"carbon":      "Carbon",
+	"fairmoney":   "FairMoney",
+	"palmcredit":  "PalmCredit",
+	"renmoney":    "Renmoney",
+	"quickcheck":  "QuickCheck",
+	"aella":       "Aella",
+	"kiakia":      "KiaKia",
+	"lidya":       "Lidya",
+	"okash":       "Okash",
+	"easemoni":    "EaseMoni",
+	"creditville": "Creditville",
+	"migo":        "Migo",
+	"specta":      "Specta",
+	"zedvance":    "Zedvance",
+	"lendigo":     "Lendigo",
+}
+
+// payerNoise are words in narrations that don't say who paid
+var payerNoise = map[string]bool{
+	"trf": true, "transfer": true, "from": true, "frm": true, "to": true, "ref": true, "nip": true, "via": true,
+	"by": true, "for": true, "mobile": true, "credit": true, "cr": true, "inward": true, "the": true, "of": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "may": true, "jun": true, "jul": true, "aug": true, "sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+	"january": true, "february": true, "march": true, "april": true, "june": true, "july": true, "august": true, "september": true, "october": true, "november": true, "december": true,
+}
+
+var nonLetters = regexp.MustCompile(`[^a-z]+`)
+
+// payerKey is what is left of a credit's narration once references,
+// dates and transfer jargon are taken out, so that credits from the
+// same payer share it
+func payerKey(description string) string {
+	var words []string
+	for _, word := range strings.Fields(nonLetters.ReplaceAllString(strings.ToLower(description), " ")) {
+		if len(word) > 1 && !payerNoise[word] {
+			words = append(words, word)
+		}
+		if len(words) == 4 {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// minimumSalary is the smallest recurring credit counted as a salary
+const minimumSalary Money = 1000000
+
+// analyzeBankStatement summarises a statement's transactions
+func analyzeBankStatement(transactions []StatementTransaction) BankStatementAnalysis {
+	transactions = append([]StatementTransaction(nil), transactions...)
+	sort.SliceStable(transactions, func(i, j int) bool { return transactions[i].Date.Before(transactions[j].Date) })
+
+	analysis := BankStatementAnalysis{
+		From:         transactions[0].Date,
+		To:           transactions[len(transactions)-1].Date,
+		Transactions: len(transactions),
+	}
+	analysis.Months = max((daysBetween(analysis.From, analysis.To)+1+15)/30, 1)
+
+	lenders := map[string]bool{}
+	var repayments Money
+	for _, transaction := range transactions {
+		analysis.TotalCredits += transaction.Credit
+		analysis.TotalDebits += transaction.Debit
+
+		description := strings.ToLower(transaction.Description)
+		if transaction.Debit == 0 {
+			continue
+		}
+		// every keyword is checked, so that a lender is named however
+		// the narration mentions the repayment
+		repayment := false
+		for keyword, lender := range lenderKeywords {
+			if strings.Contains(description, keyword) {
+				repayment = true
+				if lender != "" {
+					lenders[lender] = true
+				}
+			}
+		}
+		if repayment {
+			repayments += transaction.Debit
+		}
+	}
+
+	for lender := range lenders {
+		analysis.Lenders = append(analysis.Lenders, lender)
+	}
+	sort.Strings(analysis.Lenders)
+
+	months := Money(analysis.Months)
+	analysis.MonthlyIncome = analysis.TotalCredits / months
+	analysis.LoanRepayments = repayments / months
+	analysis.Salary, analysis.SalaryFrom, analysis.SalaryMonths = findSalary(transactions, analysis.Months)
+	analysis.AverageBalance = averageDailyBalance(transactions, analysis.From, analysis.To)
+
+	return analysis
+}
+
+// findSalary looks for credits that come in most months for about the
+// same amount. Credits that say they are a salary are looked at first,
+// then credits from the same payer. It is the salary's usual amount,
+// who it came from and how many months it came in.
+func findSalary(transactions []StatementTransaction, months int) (Money, string, int) {
+	groups := map[string][]StatementTransaction{}
+	var keys []string
+	for _, transaction := range transactions {
+		if transaction.Credit == 0 {
+			continue
+		}
+
+		key := payerKey(transaction.Description)
+		description := strings.ToLower(transaction.Description)
+		for _, keyword := range salaryKeywords {
+			if strings.Contains(description, keyword) {
+				key = "salary"
+				break
+			}
+		}
+		if key == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], transaction)
+	}
+
+	// a salary comes in at least two thirds of the months
+	needed := max(2, (months*2+2)/3)
+
+	var salary Money
+	var from string
+	var salaryMonths int
+	for _, key := range keys {
+		amount, inMonths := recurringCredit(groups[key])
+		if inMonths < needed || amount < minimumSalary {
+			continue
+		}
+		if key == "salary" {
+			return amount, groups[key][len(groups[key])-1].Description, inMonths
+		}
+		if amount > salary {
+			salary, from, salaryMonths = amount, groups[key][len(groups[key])-1].Description, inMonths
+		}
+	}
+	return salary, from, salaryMonths
+}
+
+// recurringCredit is the median of credits, and how many months had a
+// credit within a fifth of it
+func recurringCredit(credits []StatementTransaction) (Money, int) {
+	amounts := make([]Money, len(credits))
+	for i, credit := range credits {
+		amounts[i] = credit.Credit
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+	median := amounts[len(amounts)/2]
+
+	months := map[string]bool{}
+	for _, credit := range credits {
+		if absMoney(credit.Credit-median)*5 <= median {
+			months[credit.Date.Format("2006-01")] = true
+		}
+	}
+	return median, len(months)
+}
+
+// averageDailyBalance averages the balance at the end of each day from
+// from to to. Days before the first balance on the statement use the
+// balance before its transaction.
+func averageDailyBalance(transactions []StatementTransaction, from, to time.Time) Money {
+	closing := map[time.Time]Money{}
+	var opening Money
+	hasOpening := false
+	for _, transaction := range transactions {
+		if !transaction.HasBalance {
+			continue
+		}
+		if !hasOpening {
+			opening = transaction.Balance - transaction.Credit + transaction.Debit
+			hasOpening = true
+		}
+		closing[calendarDay(transaction.Date)] = transaction.Balance
+	}
+	if !hasOpening {
+		return 0
+	}
+
+	var total Money
+	days := 0
+	balance := opening
+	for day := calendarDay(from); !day.After(calendarDay(to)); day = day.AddDate(0, 0, 1) {
+		if closed, ok := closing[day]; ok {
+			balance = closed
+		}
+		total += balance
+		days++
+	}
+	return total / Money(days)
+}
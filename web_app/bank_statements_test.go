@@ -0,0 +1,184 @@
+package web_app
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func statementDay(month time.Month, day int) time.Time {
+	return time.Date(2026, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseStatementCSV(t *testing.T) {
+	t.Run("reads debit and credit columns after the account details", func(t *testing.T) {
+		contents := "\xef\xbb\xbfAccount Name,ADA OBI\nAccount Number,0123456789\n\n" +
+			"Trans. Date,Value. Date,Reference,Debits,Credits,Balance,Originating Branch,Remarks\n" +
+			"01-Oct-2026,01-Oct-2026,FT001,,\"250,000.00\",\"260,000.00\",Lekki,SALARY ACME LTD\n" +
+			"03-Oct-2026,03-Oct-2026,FT002,\"12,500.50\",,\"247,499.50\",Lekki,POS SHOPRITE\n" +
+			"04-Oct-2026,04-Oct-2026,FT003,lots,,\"247,499.50\",Lekki,UNREADABLE\n" +
+			"Total,,,\"12,500.50\",\"250,000.00\",,,\n"
+
+		transactions, skipped := parseStatementCSV([]byte(contents))
+		if len(transactions) != 2 || skipped != 1 {
+			t.Fatalf("got %d transactions and %d skipped: %+v", len(transactions), skipped, transactions)
+		}
+
+		want := StatementTransaction{Date: statementDay(time.October, 1), Description: "SALARY ACME LTD", Credit: 25000000, Balance: 26000000, HasBalance: true}
+		if transactions[0] != want {
+			t.Errorf("got %+v, want %+v", transactions[0], want)
+		}
+		if transactions[1].Debit != 1250050 || transactions[1].Credit != 0 {
+			t.Errorf("got %+v", transactions[1])
+		}
+	})
+
+	t.Run("reads signed amounts with the time they were made", func(t *testing.T) {
+		contents := "Date/Time,Money In,Money out,Category,To / From,Description,Balance\n" +
+			"02/10/26 09:15:00,\"₦5,000.00\",,inward transfer,Tunde,rent share,\"₦5,000.00\"\n" +
+			"05/10/26 18:40:11,,\"-₦2,000.00\",airtime,MTN,airtime,\"₦3,000.00\"\n"
+
+		transactions, skipped := parseStatementCSV([]byte(contents))
+		if len(transactions) != 2 || skipped != 0 {
+			t.Fatalf("got %d transactions and %d skipped", len(transactions), skipped)
+		}
+		if !transactions[0].Date.Equal(statementDay(time.October, 2)) || transactions[0].Credit != 500000 {
+			t.Errorf("got %+v", transactions[0])
+		}
+		if transactions[1].Debit != 200000 || transactions[1].Balance != 300000 {
+			t.Errorf("got %+v", transactions[1])
+		}
+	})
+
+	t.Run("reads an amount column with its direction", func(t *testing.T) {
+		contents := "Date,Narration,Amount,DR/CR\n2026-10-01,TRF FROM TUNDE,\"1,000.00\",CR\n2026-10-02,WEB PURCHASE,500.00,DR\n"
+
+		transactions, _ := parseStatementCSV([]byte(contents))
+		if len(transactions) != 2 || transactions[0].Credit != 100000 || transactions[1].Debit != 50000 || transactions[1].HasBalance {
+			t.Errorf("got %+v", transactions)
+		}
+	})
+}
+
+func TestParseStatementAmount(t *testing.T) {
+	for value, want := range map[string]Money{
+		"":            0,
+		"-":           0,
+		"1,250.00":    125000,
+		"₦1,250.50":   125050,
+		"NGN 1,250":   125000,
+		"-₦1,250.00":  -125000,
+		"(1,250.00)":  -125000,
+		"1,250.00DR":  -125000,
+		"1,250.00 CR": 125000,
+	} {
+		if got, ok := parseStatementAmount(value); !ok || got != want {
+			t.Errorf("%q: got %s %t, want %s", value, got, ok, want)
+		}
+	}
+
+	for _, value := range []string{"lots", "1,25.00", "99,999,999,999,999.00"} {
+		if _, ok := parseStatementAmount(value); ok {
+			t.Errorf("%q was read as an amount", value)
+		}
+	}
+}
+
+func TestParseStatementText(t *testing.T) {
+	text := `ACCOUNT STATEMENT
+Trans Date Value Date Narration Debit Credit Balance
+Opening Balance 10,000.00
+01 Oct 2026 01 Oct 2026 NIP TRF FROM ACME LTD SALARY 250,000.00 260,000.00
+02-Oct-2026 14:05 POS SHOPRITE LEKKI 12,500.50 247,499.50
+03-Oct-2026 CARBON LOAN REPAYMENT 20,000.00 0.00 227,499.50
+04-Oct-2026 REVERSAL 1,000.00 1,000.00 228,499.50
+Page 1 of 1 printed 19-Oct-2026`
+
+	transactions, skipped := parseStatementText(text)
+	if len(transactions) != 3 || skipped != 1 {
+		t.Fatalf("got %d transactions and %d skipped: %+v", len(transactions), skipped, transactions)
+	}
+
+	if transactions[0].Credit != 25000000 || transactions[0].Description != "NIP TRF FROM ACME LTD SALARY" || !transactions[0].Date.Equal(statementDay(time.October, 1)) {
+		t.Errorf("got %+v", transactions[0])
+	}
+	if transactions[1].Debit != 1250050 || transactions[1].Description != "POS SHOPRITE LEKKI" {
+		t.Errorf("got %+v", transactions[1])
+	}
+	if transactions[2].Debit != 2000000 || transactions[2].Balance != 22749950 {
+		t.Errorf("got %+v", transactions[2])
+	}
+}
+
+func TestAnalyzeBankStatement(t *testing.T) {
+	var transactions []StatementTransaction
+	balance := Money(5000000)
+	for _, month := range []time.Month{time.July, time.August, time.September} {
+		balance += 30000000
+		transactions = append(transactions, StatementTransaction{Date: statementDay(month, 25), Description: "NIP/ACME LTD/PAY " + month.String(), Credit: 30000000, Balance: balance, HasBalance: true})
+		balance -= 5000000
+		transactions = append(transactions, StatementTransaction{Date: statementDay(month, 28), Description: "FAIRMONEY REPAYMENT", Debit: 5000000, Balance: balance, HasBalance: true})
+	}
+	// a one off gift isn't a salary
+	balance += 50000000
+	transactions = append(transactions, StatementTransaction{Date: statementDay(time.September, 1), Description: "TRF FROM MUM", Credit: 50000000, Balance: balance, HasBalance: true})
+	transactions = append(transactions, StatementTransaction{Date: statementDay(time.July, 1), Description: "AIRTIME", Debit: 100000})
+
+	analysis := analyzeBankStatement(transactions)
+
+	if !analysis.From.Equal(statementDay(time.July, 1)) || !analysis.To.Equal(statementDay(time.September, 28)) || analysis.Months != 3 || analysis.Transactions != 8 {
+		t.Errorf("got %+v", analysis)
+	}
+	if analysis.TotalCredits != 140000000 || analysis.MonthlyIncome != 46666666 {
+		t.Errorf("got %s in, %s a month", analysis.TotalCredits, analysis.MonthlyIncome)
+	}
+	if analysis.Salary != 30000000 || analysis.SalaryMonths != 3 || analysis.SalaryFrom != "NIP/ACME LTD/PAY September" {
+		t.Errorf("got a salary of %s in %d months from %q", analysis.Salary, analysis.SalaryMonths, analysis.SalaryFrom)
+	}
+	if analysis.LoanRepayments != 5000000 || len(analysis.Lenders) != 1 || analysis.Lenders[0] != "FairMoney" {
+		t.Errorf("got %s a month to %v", analysis.LoanRepayments, analysis.Lenders)
+	}
+	if analysis.AverageBalance <= 5000000 || analysis.AverageBalance >= balance {
+		t.Errorf("got an average balance of %s", analysis.AverageBalance)
+	}
+
+	t.Run("finds no salary in credits that don't recur", func(t *testing.T) {
+		analysis := analyzeBankStatement(transactions[6:])
+		if analysis.Salary != 0 || analysis.SalaryFrom != "" {
+			t.Errorf("got %+v", analysis)
+		}
+	})
+}
+
+func TestAverageDailyBalance(t *testing.T) {
+	transactions := []StatementTransaction{
+		{Date: statementDay(time.October, 1), Credit: 1000, Balance: 3000, HasBalance: true},
+		{Date: statementDay(time.October, 3), Debit: 3000, Balance: 0, HasBalance: true},
+	}
+
+	// 3000 for the 1st and 2nd, then 0 for the 3rd and 4th
+	if got := averageDailyBalance(transactions, statementDay(time.October, 1), statementDay(time.October, 4)); got != 1500 {
+		t.Errorf("got %s, want %s", got, Money(1500))
+	}
+}
+
+func TestReadBankStatement(t *testing.T) {
+	contents := newStatementPDF(t, true, [][]string{
+		{"Date", "Narration", "Debit", "Credit", "Balance"},
+		{"", "Opening Balance", "", "", "10,000.00"},
+		{"01-Oct-2026", "SALARY ACME LTD", "", "250,000.00", "260,000.00"},
+		{"03-Oct-2026", "POS SHOPRITE", "12,500.50", "", "247,499.50"},
+	})
+
+	analysis, err := readBankStatement("october.pdf", contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Format != StatementPDF || analysis.FileName != "october.pdf" || analysis.Transactions != 2 || analysis.TotalDebits != 1250050 {
+		t.Errorf("got %+v", analysis)
+	}
+
+	if _, err := readBankStatement("notes.txt", []byte("nothing to see here")); !errors.Is(err, ErrUnreadableBankStatement) {
+		t.Errorf("got %v, want %v", err, ErrUnreadableBankStatement)
+	}
+}
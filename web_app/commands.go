@@ -0,0 +1,260 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+var ErrLedgerInvariantsBroken = errors.New("the ledger invariants do not hold")
+var ErrCommandUsage = errors.New("wrong arguments")
+
+// replayLimit caps how many failed events a single --failed replay picks up
+const replayLimit = 1000
+
+// RunCommand runs one of the maintenance commands that ship with the
+// server binary, e.g. `./api ledger-check`. Output goes to out.
+func RunCommand(name string, args []string, out io.Writer) error {
+	db := DB{}
+	db.Connect()
+	defer db.Conn.Close()
+
+	switch name {
+	case "ledger-check":
+		return ledgerCheckCommand(&db, out)
+	case "replay-webhooks":
+		payments, err := PaymentProvidersFromEnv(os.Getenv("BASE_URL"))
+		if err != nil {
+			return err
+		}
+		processor := NewPaymentEventProcessor(&db, payments, NewPayoutService(&db, payments), NewRefundService(&db, payments))
+		return replayWebhooksCommand(context.Background(), &db, NewWebhookWorker(&db, processor.Process), args, out)
+	case "reconcile-payments":
+		payments, err := PaymentProvidersFromEnv(os.Getenv("BASE_URL"))
+		if err != nil {
+			return err
+		}
+		return reconcilePaymentsCommand(context.Background(), NewPaymentReconciler(&db, payments, NewRefundService(&db, payments)), args, out)
+	case "collect-loans":
+		policy, err := LoanPenaltyPolicyFromEnv()
+		if err != nil {
+			return err
+		}
+		notifier, err := NotifiersFromEnv()
+		if err != nil {
+			return err
+		}
+		return collectLoansCommand(context.Background(), NewLoanCollector(&db, notifier, policy, os.Getenv("BASE_URL")), args, out)
+	case "mature-investments":
+		notifier, err := NotifiersFromEnv()
+		if err != nil {
+			return err
+		}
+		return matureInvestmentsCommand(context.Background(), NewInvestmentMaturer(&db, notifier, os.Getenv("BASE_URL")), args, out)
+	case "pay-withdrawal":
+		payments, err := PaymentProvidersFromEnv(os.Getenv("BASE_URL"))
+		if err != nil {
+			return err
+		}
+		return payWithdrawalCommand(context.Background(), NewPayoutService(&db, payments), args, out)
+	case "retry-payouts":
+		payments, err := PaymentProvidersFromEnv(os.Getenv("BASE_URL"))
+		if err != nil {
+			return err
+		}
+		return retryPayoutsCommand(context.Background(), NewPayoutService(&db, payments), args, out)
+	}
+
+	return fmt.Errorf("%w: %s", ErrUnknownCommand, name)
+}
+
+func ledgerCheckCommand(store IStore, out io.Writer) error {
+	discrepancies, err := store.CheckLedgerInvariants()
+	if err != nil {
+		return err
+	}
+
+	if len(discrepancies) == 0 {
+		fmt.Fprintln(out, "ledger is consistent")
+		return nil
+	}
+
+	for _, discrepancy := range discrepancies {
+		fmt.Fprintln(out, discrepancy)
+	}
+
+	return fmt.Errorf("%w: %d discrepancies", ErrLedgerInvariantsBroken, len(discrepancies))
+}
+
+// replayWebhooksCommand processes saved webhook events again. It takes
+// either event ids or --failed, which replays every failed event.
+func replayWebhooksCommand(ctx context.Context, store WebhookEventStore, worker *WebhookWorker, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: usage: replay-webhooks --failed | <event id>...", ErrCommandUsage)
+	}
+
+	var ids []uint
+
+	if len(args) == 1 && args[0] == "--failed" {
+		events, err := store.GetWebhookEvents(StatusFailed, replayLimit)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if event.SignatureValid {
+				ids = append(ids, event.ID)
+			}
+		}
+	} else {
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: %q is not an event id", ErrCommandUsage, arg)
+			}
+			ids = append(ids, uint(id))
+		}
+	}
+
+	succeeded, err := worker.Replay(ctx, ids...)
+	fmt.Fprintf(out, "replayed %d of %d events\n", succeeded, len(ids))
+
+	return err
+}
+
+// reconcilePaymentsCommand settles stale pending payments, then writes
+// the reconciliation reports for a day, yesterday unless one is given
+// as YYYY-MM-DD
+func reconcilePaymentsCommand(ctx context.Context, reconciler *PaymentReconciler, args []string, out io.Writer) error {
+	day := time.Now().AddDate(0, 0, -1)
+
+	if len(args) > 1 {
+		return fmt.Errorf("%w: usage: reconcile-payments [YYYY-MM-DD]", ErrCommandUsage)
+	}
+
+	if len(args) == 1 {
+		parsed, err := time.ParseInLocation("2006-01-02", args[0], time.Local)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a date", ErrCommandUsage, args[0])
+		}
+		day = parsed
+	}
+
+	settlement, settleErr := reconciler.SettleStalePayments(ctx)
+	fmt.Fprintf(out, "stale payments: %d fulfilled, %d failed, %d refunded, %d flagged, %d still pending\n",
+		settlement[SettlementFulfilled], settlement[SettlementFailed], settlement[SettlementRefunded], settlement[SettlementFlagged], settlement[SettlementPending])
+
+	reports, err := reconciler.Reconcile(ctx, day)
+	for _, report := range reports {
+		fmt.Fprintf(out, "%s %s: %d matched, %d discrepancies\n", report.Provider, report.Day.Format("2006-01-02"), report.Matched, len(report.Discrepancies))
+		for _, discrepancy := range report.Discrepancies {
+			fmt.Fprintf(out, "  %s %s: ours %s, theirs %s %s\n", discrepancy.Kind, discrepancy.Reference, discrepancy.OurAmount, discrepancy.ProviderAmount, discrepancy.Detail)
+		}
+	}
+
+	return errors.Join(settleErr, err)
+}
+
+// payWithdrawalCommand pays out an approved withdrawal application to
+// the bank account it was made for
+func payWithdrawalCommand(ctx context.Context, payouts *PayoutService, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: usage: pay-withdrawal <withdrawal id>", ErrCommandUsage)
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q is not a withdrawal id", ErrCommandUsage, args[0])
+	}
+
+	payout, err := payouts.PayWithdrawal(ctx, uint(id))
+	if payout.ID != 0 {
+		printPayout(out, payout)
+	}
+	return err
+}
+
+// retryPayoutsCommand sends payouts that their provider couldn't be
+// asked to send again. It takes either payout references or nothing,
+// which sends every stale pending payout.
+func retryPayoutsCommand(ctx context.Context, payouts *PayoutService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		retried, err := payouts.RetryStalePayouts(ctx)
+		for _, payout := range retried {
+			printPayout(out, payout)
+		}
+		return err
+	}
+
+	var errs []error
+	for _, arg := range args {
+		reference, err := uuid.Parse(arg)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a payout reference", ErrCommandUsage, arg)
+		}
+
+		payout, err := payouts.Retry(ctx, reference)
+		if payout.ID != 0 {
+			printPayout(out, payout)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("payout %s: %w", reference, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func printPayout(out io.Writer, payout Payout) {
+	fmt.Fprintf(out, "payout %s of %s is %s with %s\n", payout.Reference, payout.Amount, payout.Status, payout.Provider)
+}
+
+// collectLoansCommand runs the day's loan collections now, for today
+// unless a day is given as YYYY-MM-DD
+func collectLoansCommand(ctx context.Context, collector *LoanCollector, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%w: usage: collect-loans [YYYY-MM-DD]", ErrCommandUsage)
+	}
+
+	if len(args) == 1 {
+		day, err := time.ParseInLocation("2006-01-02", args[0], time.Local)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a date", ErrCommandUsage, args[0])
+		}
+		collector.now = func() time.Time { return day }
+	}
+
+	report, err := collector.Collect(ctx)
+	fmt.Fprintf(out, "collected on %d loans: %d overdue, %d moved bucket, %d defaulted, %s charged in penalties, %d reminders sent\n",
+		report.Loans, report.Overdue, report.Escalated, report.Defaulted, report.PenaltyCharged, report.Reminders)
+
+	return err
+}
+
+// matureInvestmentsCommand pays out or rolls over the investments that
+// have matured, as of today unless a day is given as YYYY-MM-DD
+func matureInvestmentsCommand(ctx context.Context, maturer *InvestmentMaturer, args []string, out io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%w: usage: mature-investments [YYYY-MM-DD]", ErrCommandUsage)
+	}
+
+	if len(args) == 1 {
+		day, err := time.ParseInLocation("2006-01-02", args[0], time.Local)
+		if err != nil {
+			return fmt.Errorf("%w: %q is not a date", ErrCommandUsage, args[0])
+		}
+		maturer.now = func() time.Time { return day }
+	}
+
+	report, err := maturer.Mature(ctx)
+	fmt.Fprintf(out, "matured %d investments: %d rolled over, %s earned, %s paid into solo savings\n",
+		report.Matured, report.RolledOver, report.Returns, report.PaidOut)
+
+	return err
+}
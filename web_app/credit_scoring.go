@@ -0,0 +1,242 @@
+package web_app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Loan applications are scored from what we already know about the
+// customer. Every rule that applies adds or takes away points, and is
+// kept with the application as a reason code, so that admins can see
+// why a customer got the score they did. The score decides the most a
+// customer can borrow, and for how long.
+
+// The signals that rules can look at
+const (
+	SignalAccountAgeDays = "ACCOUNT_AGE_DAYS"
+	// SignalSavingsBalance is the solo savings balance, in kobo
+	SignalSavingsBalance = "SAVINGS_BALANCE"
+	// SignalSavingsMonths is how many of the last 12 months the
+	// customer saved in
+	SignalSavingsMonths  = "SAVINGS_MONTHS"
+	SignalBVNOnFile      = "BVN_ON_FILE"
+	SignalBVNVerified    = "BVN_VERIFIED"
+	SignalKYCTier        = "KYC_TIER"
+	SignalLoansRepaid    = "LOANS_REPAID"
+	SignalLoansDefaulted = "LOANS_DEFAULTED"
+	// SignalWorstDaysLate is the most days any installment the customer
+	// has had was paid late, or has been late for
+	SignalWorstDaysLate = "WORST_DAYS_LATE"
+)
+
+var ErrInvalidCreditPolicy = errors.New("invalid credit policy")
+
+// CreditSignals are what a customer is scored on
+type CreditSignals struct {
+	DateJoined     time.Time
+	EmailVerified  bool
+	HasPhoneNumber bool
+	HasDateOfBirth bool
+	HasAddress     bool
+	SavingsBalance Money
+	SavingsMonths  int
+	BVNOnFile      bool
+	BVNVerified    bool
+	LoansRepaid    int
+	LoansDefaulted int
+	WorstDaysLate  int
+}
+
+// KYCTier is how much we know about who the customer is: 1 once their
+// email is verified, 2 with their phone number, date of birth and
+// address, and 3 once their BVN is verified too
+func (s CreditSignals) KYCTier() int {
+	switch {
+	case !s.EmailVerified:
+		return 0
+	case !s.HasPhoneNumber || !s.HasDateOfBirth || !s.HasAddress:
+		return 1
+	case !s.BVNVerified:
+		return 2
+	}
+	return 3
+}
+
+func (s CreditSignals) value(signal string, now time.Time) (int64, error) {
+	switch signal {
+	case SignalAccountAgeDays:
+		return int64(daysBetween(s.DateJoined, now)), nil
+	case SignalSavingsBalance:
+		return int64(s.SavingsBalance), nil
+	case SignalSavingsMonths:
+		return int64(s.SavingsMonths), nil
+	case SignalBVNOnFile:
+		return boolSignal(s.BVNOnFile), nil
+	case SignalBVNVerified:
+		return boolSignal(s.BVNVerified), nil
+	case SignalKYCTier:
+		return int64(s.KYCTier()), nil
+	case SignalLoansRepaid:
+		return int64(s.LoansRepaid), nil
+	case SignalLoansDefaulted:
+		return int64(s.LoansDefaulted), nil
+	case SignalWorstDaysLate:
+		return int64(s.WorstDaysLate), nil
+	}
+	return 0, fmt.Errorf("%w: unknown signal %q", ErrInvalidCreditPolicy, signal)
+}
+
+func boolSignal(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// CreditRule adds Points to the score when Signal is at least AtLeast
+type CreditRule struct {
+	Code        string `json:"code"`
+	Signal      string `json:"signal"`
+	AtLeast     int64  `json:"at_least"`
+	Points      int    `json:"points"`
+	Description string `json:"description"`
+}
+
+// CreditBand is what customers with a score of at least MinScore can
+// borrow
+type CreditBand struct {
+	MinScore     int    `json:"min_score"`
+	MaxAmount    Money  `json:"max_amount"`
+	MaxTenorDays uint64 `json:"max_tenor_days"`
+}
+
+type CreditPolicy struct {
+	BaseScore int          `json:"base_score"`
+	Rules     []CreditRule `json:"rules"`
+	Bands     []CreditBand `json:"bands"`
+}
+
+var defaultCreditPolicy = CreditPolicy{
+	BaseScore: 300,
+	Rules: []CreditRule{
+		{Code: "ACCOUNT_AGE_3M", Signal: SignalAccountAgeDays, AtLeast: 90, Points: 40, Description: "Has had an account for at least 3 months"},
+		{Code: "ACCOUNT_AGE_1Y", Signal: SignalAccountAgeDays, AtLeast: 365, Points: 60, Description: "Has had an account for at least a year"},
+		{Code: "SAVINGS_50K", Signal: SignalSavingsBalance, AtLeast: 5000000, Points: 50, Description: "Has at least ₦50,000 in savings"},
+		{Code: "SAVINGS_500K", Signal: SignalSavingsBalance, AtLeast: 50000000, Points: 80, Description: "Has at least ₦500,000 in savings"},
+		{Code: "SAVES_REGULARLY", Signal: SignalSavingsMonths, AtLeast: 3, Points: 50, Description: "Saved in at least 3 of the last 12 months"},
+		{Code: "SAVES_CONSISTENTLY", Signal: SignalSavingsMonths, AtLeast: 9, Points: 50, Description: "Saved in at least 9 of the last 12 months"},
+		{Code: "BVN_ON_FILE", Signal: SignalBVNOnFile, AtLeast: 1, Points: 40, Description: "Has given us their BVN"},
+		{Code: "BVN_VERIFIED", Signal: SignalBVNVerified, AtLeast: 1, Points: 60, Description: "Their BVN has been verified"},
+		{Code: "KYC_TIER_2", Signal: SignalKYCTier, AtLeast: 2, Points: 40, Description: "Has given us their phone number, date of birth and address"},
+		{Code: "LOAN_REPAID", Signal: SignalLoansRepaid, AtLeast: 1, Points: 60, Description: "Has repaid a loan"},
+		{Code: "LOANS_REPAID_3", Signal: SignalLoansRepaid, AtLeast: 3, Points: 60, Description: "Has repaid at least 3 loans"},
+		{Code: "LATE_30", Signal: SignalWorstDaysLate, AtLeast: 30, Points: -120, Description: "Has been at least 30 days late on an installment"},
+		{Code: "LATE_90", Signal: SignalWorstDaysLate, AtLeast: 90, Points: -200, Description: "Has been at least 90 days late on an installment"},
+		{Code: "DEFAULTED", Signal: SignalLoansDefaulted, AtLeast: 1, Points: -500, Description: "Has defaulted on a loan"},
+	},
+	Bands: []CreditBand{
+		{MinScore: 300, MaxAmount: 2000000, MaxTenorDays: 30},
+		{MinScore: 400, MaxAmount: 5000000, MaxTenorDays: 60},
+		{MinScore: 500, MaxAmount: 20000000, MaxTenorDays: 90},
+		{MinScore: 600, MaxAmount: 50000000, MaxTenorDays: 180},
+		{MinScore: 700, MaxAmount: 100000000, MaxTenorDays: 365},
+		{MinScore: 800, MaxAmount: 300000000, MaxTenorDays: maximumLoanDurationDays},
+	},
+}
+
+// CreditPolicyFromEnv reads the policy from the JSON file at
+// CREDIT_POLICY_FILE, or is the default policy if it isn't set
+func CreditPolicyFromEnv() (CreditPolicy, error) {
+	path, ok := os.LookupEnv("CREDIT_POLICY_FILE")
+	if !ok {
+		return defaultCreditPolicy, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return CreditPolicy{}, err
+	}
+
+	var policy CreditPolicy
+	if err := json.Unmarshal(contents, &policy); err != nil {
+		return policy, fmt.Errorf("%w: %s", ErrInvalidCreditPolicy, err)
+	}
+
+	return policy, policy.Validate()
+}
+
+// Validate checks that every rule looks at a signal that exists, and
+// that there is a band to score into
+func (p CreditPolicy) Validate() error {
+	codes := map[string]bool{}
+	for _, rule := range p.Rules {
+		if _, err := (CreditSignals{}).value(rule.Signal, time.Time{}); err != nil {
+			return err
+		}
+		if rule.Code == "" || codes[rule.Code] {
+			return fmt.Errorf("%w: rule codes must be set and different, got %q", ErrInvalidCreditPolicy, rule.Code)
+		}
+		codes[rule.Code] = true
+	}
+
+	if len(p.Bands) == 0 {
+		return fmt.Errorf("%w: there are no bands", ErrInvalidCreditPolicy)
+	}
+	return nil
+}
+
+// CreditReason is a rule that applied to an application
+type CreditReason struct {
+	Code        string `json:"code"`
+	Points      int    `json:"points"`
+	Description string `json:"description"`
+}
+
+// CreditDecision is what an application was scored, why, and what
+// the customer could borrow with that score
+type CreditDecision struct {
+	Score        int
+	Reasons      []CreditReason
+	MaxAmount    Money
+	MaxTenorDays uint64
+}
+
+// Eligible is true when the customer can borrow at least the smallest
+// loan there is
+func (d CreditDecision) Eligible() bool {
+	return d.MaxAmount >= minimumLoanAmount && d.MaxTenorDays >= minimumLoanDurationDays
+}
+
+// scoreCredit scores signals with policy, which must be valid
+func scoreCredit(policy CreditPolicy, signals CreditSignals, now time.Time) CreditDecision {
+	decision := CreditDecision{Score: policy.BaseScore}
+
+	for _, rule := range policy.Rules {
+		value, err := signals.value(rule.Signal, now)
+		if err != nil || value < rule.AtLeast {
+			continue
+		}
+		decision.Score += rule.Points
+		decision.Reasons = append(decision.Reasons, CreditReason{Code: rule.Code, Points: rule.Points, Description: rule.Description})
+	}
+
+	bands := append([]CreditBand(nil), policy.Bands...)
+	sort.Slice(bands, func(i, j int) bool { return bands[i].MinScore < bands[j].MinScore })
+	for _, band := range bands {
+		if decision.Score < band.MinScore {
+			break
+		}
+		decision.MaxAmount = band.MaxAmount
+		decision.MaxTenorDays = band.MaxTenorDays
+	}
+
+	return decision
+}
+
+type CreditStore interface {
+	GetCreditSignals(customerID uint) (CreditSignals, error)
+}
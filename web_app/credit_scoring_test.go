@@ -0,0 +1,131 @@
+package web_app
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScoreCredit(t *testing.T) {
+	t.Run("gives new customers the smallest band", func(t *testing.T) {
+		decision := scoreCredit(defaultCreditPolicy, CreditSignals{DateJoined: loanToday, EmailVerified: true}, loanToday)
+
+		if decision.Score != 300 || len(decision.Reasons) != 0 {
+			t.Errorf("got %+v", decision)
+		}
+		if decision.MaxAmount != 2000000 || decision.MaxTenorDays != 30 || !decision.Eligible() {
+			t.Errorf("got %+v", decision)
+		}
+	})
+
+	t.Run("explains what raised the score", func(t *testing.T) {
+		signals := CreditSignals{
+			DateJoined:     loanToday.AddDate(-2, 0, 0),
+			EmailVerified:  true,
+			HasPhoneNumber: true,
+			HasDateOfBirth: true,
+			HasAddress:     true,
+			SavingsBalance: 6000000,
+			SavingsMonths:  4,
+			BVNOnFile:      true,
+			LoansRepaid:    1,
+		}
+
+		decision := scoreCredit(defaultCreditPolicy, signals, loanToday)
+
+		// 300, with 100 for the account's age, 100 for savings, 40 for
+		// the BVN, 40 for the KYC tier and 60 for the repaid loan
+		if decision.Score != 640 {
+			t.Errorf("got a score of %d, want 640", decision.Score)
+		}
+		if decision.MaxAmount != 50000000 || decision.MaxTenorDays != 180 {
+			t.Errorf("got %+v", decision)
+		}
+
+		codes := map[string]bool{}
+		for _, reason := range decision.Reasons {
+			codes[reason.Code] = true
+		}
+		for _, code := range []string{"ACCOUNT_AGE_3M", "ACCOUNT_AGE_1Y", "SAVINGS_50K", "SAVES_REGULARLY", "BVN_ON_FILE", "KYC_TIER_2", "LOAN_REPAID"} {
+			if !codes[code] {
+				t.Errorf("expected %s in the reasons, got %+v", code, decision.Reasons)
+			}
+		}
+	})
+
+	t.Run("turns away customers that have defaulted", func(t *testing.T) {
+		decision := scoreCredit(defaultCreditPolicy, CreditSignals{DateJoined: loanToday.AddDate(-2, 0, 0), LoansDefaulted: 1, WorstDaysLate: 120}, loanToday)
+
+		if decision.Eligible() || decision.MaxAmount != 0 {
+			t.Errorf("got %+v", decision)
+		}
+	})
+
+	t.Run("uses the bands in order of score", func(t *testing.T) {
+		policy := CreditPolicy{
+			BaseScore: 450,
+			Bands: []CreditBand{
+				{MinScore: 500, MaxAmount: 9000000, MaxTenorDays: 90},
+				{MinScore: 400, MaxAmount: 3000000, MaxTenorDays: 30},
+			},
+		}
+
+		if decision := scoreCredit(policy, CreditSignals{}, loanToday); decision.MaxAmount != 3000000 {
+			t.Errorf("got %+v", decision)
+		}
+	})
+}
+
+func TestKYCTier(t *testing.T) {
+	full := CreditSignals{EmailVerified: true, HasPhoneNumber: true, HasDateOfBirth: true, HasAddress: true, BVNVerified: true}
+
+	noAddress := full
+	noAddress.HasAddress = false
+
+	unverifiedBVN := full
+	unverifiedBVN.BVNVerified = false
+
+	for want, signals := range []CreditSignals{{}, noAddress, unverifiedBVN, full} {
+		if got := signals.KYCTier(); got != want {
+			t.Errorf("%+v: got tier %d, want %d", signals, got, want)
+		}
+	}
+}
+
+func TestCreditPolicy(t *testing.T) {
+	if err := defaultCreditPolicy.Validate(); err != nil {
+		t.Errorf("the default policy is invalid: %s", err)
+	}
+
+	t.Run("turns away policies that can't be scored", func(t *testing.T) {
+		for name, policy := range map[string]CreditPolicy{
+			"unknown signal": {Rules: []CreditRule{{Code: "A", Signal: "SHOE_SIZE"}}, Bands: defaultCreditPolicy.Bands},
+			"repeated code":  {Rules: []CreditRule{{Code: "A", Signal: SignalKYCTier}, {Code: "A", Signal: SignalBVNOnFile}}, Bands: defaultCreditPolicy.Bands},
+			"no bands":       {Rules: defaultCreditPolicy.Rules},
+		} {
+			if err := policy.Validate(); !errors.Is(err, ErrInvalidCreditPolicy) {
+				t.Errorf("%s: got %v, want %v", name, err, ErrInvalidCreditPolicy)
+			}
+		}
+	})
+
+	t.Run("reads the policy from CREDIT_POLICY_FILE", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "credit.json")
+		contents := `{"base_score": 500, "rules": [{"code": "SAVER", "signal": "SAVINGS_MONTHS", "at_least": 1, "points": 100, "description": "Saves"}], "bands": [{"min_score": 500, "max_amount": 1000000, "max_tenor_days": 14}]}`
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CREDIT_POLICY_FILE", path)
+
+		policy, err := CreditPolicyFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decision := scoreCredit(policy, CreditSignals{SavingsMonths: 2}, loanToday)
+		if decision.Score != 600 || decision.MaxAmount != 1000000 || decision.MaxTenorDays != 14 {
+			t.Errorf("got %+v", decision)
+		}
+	})
+}
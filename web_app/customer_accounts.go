@@ -0,0 +1,54 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Admins can look up a customer's account, and suspend it. Suspended
+// customers are logged out, and can't log in again until an admin
+// reinstates them.
+
+// Audit log actions for customers' accounts
+const (
+	AuditCustomerSuspended  = "CUSTOMER_SUSPENDED"
+	AuditCustomerReinstated = "CUSTOMER_REINSTATED"
+)
+
+var (
+	ErrAccountSuspended    = errors.New("this account has been suspended")
+	ErrCantSuspendYourself = errors.New("you can't suspend your own account")
+)
+
+type CustomerAccount struct {
+	ID             uint
+	FirstName      string
+	LastName       string
+	Email          string
+	PhoneNumber    string
+	EmailVerified  bool
+	DateJoined     time.Time
+	SuspendedAt    time.Time
+	SuspensionNote string
+	// AdminRoles is empty for customers that aren't admins
+	AdminRoles []string
+}
+
+func (a CustomerAccount) Suspended() bool {
+	return !a.SuspendedAt.IsZero()
+}
+
+func customerAuditSubject(customerID uint) string {
+	return fmt.Sprintf("customer:%d", customerID)
+}
+
+type CustomerAccountStore interface {
+	// GetCustomerAccount is ErrAccountDoesNotExist for unknown customers
+	GetCustomerAccount(customerID uint) (CustomerAccount, error)
+	// SuspendCustomer and ReinstateCustomer record why in the audit log,
+	// so both need a note. Suspending a suspended customer, or
+	// reinstating one that isn't, changes nothing.
+	SuspendCustomer(customerID, adminID uint, note string) (CustomerAccount, error)
+	ReinstateCustomer(customerID, adminID uint, note string) (CustomerAccount, error)
+}
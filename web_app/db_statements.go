@@ -18,6 +18,7 @@ const GetSoloSaverScreenInformationStatement = `SELECT ssa.balance_in_k,
                FROM payment_processor_transaction AS p
                WHERE p.customer_id = $1
                  AND p.verification_status = 'PENDING'
+                 AND p.flagged_at IS NULL
            )
            THEN TRUE
            ELSE FALSE
@@ -30,14 +31,17 @@ const GetTargetSavingsScreenInformationStatement = `SELECT tsp.target_savings_pl
 
 const GetLoansScreenInformationStatement = `SELECT amount_owed_in_k FROM loans_account WHERE customer_id = $1;`
 
-const CreatePaymentProcessorPendingTransaction = `INSERT INTO payment_processor_transaction (customer_id, plan_id, reference_number, payment_originator, payment_amount_in_k) VALUES ($1, $2, $3, $4, $5);`
+const CreatePaymentProcessorPendingTransaction = `INSERT INTO payment_processor_transaction (customer_id, plan_id, reference_number, payment_originator, payment_amount_in_k, payment_provider) VALUES ($1, $2, $3, $4, $5, $6);`
 
-const GetPaystackVerificationInformation = `SELECT customer_id, plan_id, payment_originator FROM payment_processor_transaction WHERE reference_number = $1;`
+const paymentColumns = `customer_id, COALESCE(plan_id, 0), reference_number, payment_originator, payment_amount_in_k, payment_provider, fulfillment_status, COALESCE(fulfillment_failure_reason, ''), verification_status, COALESCE(verification_failure_reason, ''), created_at, verified_at, flagged_at, COALESCE(flag_reason, '')`
+
+const GetPaystackVerificationInformation = `SELECT ` + paymentColumns + ` FROM payment_processor_transaction WHERE reference_number = $1;`
 
 const AuthenticateUserStatement = `SELECT c.customer_id,
        c.email,
        CASE WHEN a.customer_id IS NOT NULL THEN TRUE ELSE FALSE END AS is_admin,
        c.email_is_verified,
+       c.suspended_at IS NOT NULL,
        ph.hash
 FROM customer c
 JOIN password_hash ph ON c.customer_id = ph.customer_id
@@ -66,8 +70,15 @@ SELECT customer_id, $5
 FROM new_customer;
 `
 
-const CreateLoanApplicationStatement = `INSERT INTO loan_application (loans_account_id, amount_requested_in_k, duration_requested_in_days) (SELECT account_id, $2, $3 FROM loans_account WHERE customer_id = $1);
-`
+const GetLoansAccountIDStatement = `SELECT account_id FROM loans_account WHERE customer_id = $1;`
+
+// applications that would be a second one in progress are turned away
+// by loan_application_open_idx
+const CreateLoanApplicationStatement = `INSERT INTO loan_application (loans_account_id, amount_requested_in_k, duration_requested_in_days, bvn, bank_account_id, interest_method, monthly_rate_bp, fee_rate_bp, installment_frequency,
+credit_score, credit_max_amount_in_k, credit_max_tenor_in_days, credit_reasons, guarantors_required)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT DO NOTHING
+RETURNING loan_application_id;`
 
 // do the one for the loans and investments accounts too
 
@@ -91,38 +102,800 @@ FROM new_family_vault nfv
 JOIN customer c ON c.email = $8
 RETURNING nfv.family_vault_plan_id;`
 
-const UpdateSoloSaverPaymentInformationStatement = `WITH transaction_update AS (
-  UPDATE payment_processor_transaction
-  SET verification_status = 'SUCCESSFUL',
-  fulfillment_status = 'SUCCESSFUL',
-  payment_amount_in_k = $1
-  WHERE reference_number = $2
-  AND verification_status = 'PENDING'
-  RETURNING payment_amount_in_k, customer_id
-)
+// The pending check makes sure that we aren't updating a previously successful payment (that could happen in a replay attack)
+const MarkPaymentVerifiedStatement = `UPDATE payment_processor_transaction
+SET verification_status = 'SUCCESSFUL',
+verified_at = CURRENT_TIMESTAMP
+WHERE reference_number = $1
+AND verification_status = 'PENDING';`
+
+// A failed fulfillment can be retried, a successful one can't
+const MarkPaymentFulfilledStatement = `UPDATE payment_processor_transaction
+SET fulfillment_status = 'SUCCESSFUL',
+fulfillment_failure_reason = NULL
+WHERE reference_number = $1
+AND verification_status = 'SUCCESSFUL'
+AND fulfillment_status <> 'SUCCESSFUL';`
+
+const RecordFulfillmentFailureStatement = `UPDATE payment_processor_transaction
+SET fulfillment_status = 'FAILED',
+fulfillment_failure_reason = $2
+WHERE reference_number = $1
+AND fulfillment_status <> 'SUCCESSFUL';`
+
+const CreditSoloSavingsBalanceStatement = `UPDATE solo_savings_account SET balance_in_k = balance_in_k + $2 WHERE customer_id = $1;`
+
+const DebitSoloSavingsBalanceStatement = `UPDATE solo_savings_account SET balance_in_k = balance_in_k - $2 WHERE customer_id = $1 AND balance_in_k >= $2;`
+
+const CreditTargetSavingsBalanceStatement = `UPDATE target_savings_plan SET balance_in_k = balance_in_k + $3 WHERE target_savings_plan_id = $1 AND customer_id = $2;`
+
+// Any member of a family vault can pay into it
+const CreditFamilyVaultBalanceStatement = `UPDATE family_vault_plan SET balance_in_k = balance_in_k + $3
+WHERE family_vault_plan_id = $1
+AND is_active
+AND EXISTS (SELECT 1 FROM family_vault_plan_member m WHERE m.family_vault_plan_id = $1 AND m.customer_id = $2);`
+
+const CreditInvestmentBalanceStatement = `UPDATE investment_account SET balance_in_k = balance_in_k + $2 WHERE customer_id = $1;`
 
--- The pending check makes sure that we aren't updating a previously successful payment (that could happen in a replay attack)
+// The Debit statements take back what a payment credited, and can't take
+// a balance below zero
+const DebitTargetSavingsBalanceStatement = `UPDATE target_savings_plan SET balance_in_k = balance_in_k - $3 WHERE target_savings_plan_id = $1 AND customer_id = $2 AND balance_in_k >= $3;`
 
-UPDATE solo_savings_account
-SET balance_in_k = balance_in_k + transaction_update.payment_amount_in_k
-FROM transaction_update WHERE solo_savings_account.customer_id = transaction_update.customer_id;`
+const DebitFamilyVaultBalanceStatement = `UPDATE family_vault_plan SET balance_in_k = balance_in_k - $2 WHERE family_vault_plan_id = $1 AND balance_in_k >= $2;`
 
-const UpdateSoloSaverPaymentFailureStatement = `UPDATE payment_processor_transaction SET verification_status = 'FAILED', fulfillment_status = 'FAILED' WHERE reference_number = $1 AND verification_status = 'PENDING';`
+// Money that was held from a family vault goes back to it whether or
+// not it is still active
+const ReturnFamilyVaultBalanceStatement = `UPDATE family_vault_plan SET balance_in_k = balance_in_k + $2 WHERE family_vault_plan_id = $1;`
+
+const DebitInvestmentBalanceStatement = `UPDATE investment_account SET balance_in_k = balance_in_k - $2 WHERE customer_id = $1 AND balance_in_k >= $2;`
+
+// Repayments can't take the amount owed below zero
+const DecreaseLoansOwedStatement = `UPDATE loans_account SET amount_owed_in_k = amount_owed_in_k - $2 WHERE customer_id = $1 AND amount_owed_in_k >= $2;`
+
+const IncreaseLoansOwedStatement = `UPDATE loans_account SET amount_owed_in_k = amount_owed_in_k + $2 WHERE customer_id = $1;`
+
+const RecordVerificationFailureStatement = `UPDATE payment_processor_transaction
+SET verification_status = 'FAILED',
+verification_failure_reason = $2,
+fulfillment_status = 'FAILED',
+verified_at = CURRENT_TIMESTAMP
+WHERE reference_number = $1
+AND verification_status = 'PENDING';`
 
 const GetInvestmentsScreenInformationStatement = `SELECT balance_in_k FROM investment_account WHERE customer_id = $1;`
 
-const GetAdminHomeScreenInformationStatement = `SELECT count(loan_application.status = 'PENDING') AS ls, count(investment_application.status = 'PENDING') AS inv, count(withdrawal_application.status = 'PENDING') AS wa FROM loan_application, investment_application, withdrawal_application;
-`
+// Each queue is counted on its own: what is waiting for an admin to decide on it
+const GetAdminHomeScreenInformationStatement = `SELECT
+(SELECT count(*) FROM loan_application WHERE status = 'SUBMITTED'),
+(SELECT count(*) FROM loan_application WHERE status = 'UNDER_REVIEW'),
+(SELECT count(*) FROM investment_application WHERE status = 'PENDING'),
+(SELECT count(*) FROM withdrawal_application WHERE status = 'PENDING' AND reviewed_at IS NULL),
+(SELECT count(*) FROM admin_action WHERE status = 'PENDING');`
+
+const UpsertLedgerAccountStatement = `INSERT INTO ledger_account (code, account_type, customer_id) VALUES ($1, $2, $3)
+ON CONFLICT (code) DO UPDATE SET code = EXCLUDED.code
+RETURNING ledger_account_id;`
+
+// Returns no rows when the idempotency key has been used before
+const CreateLedgerTransactionStatement = `INSERT INTO ledger_transaction (idempotency_key, description) VALUES ($1, $2)
+ON CONFLICT (idempotency_key) DO NOTHING
+RETURNING ledger_transaction_id;`
+
+const CreateLedgerEntryStatement = `INSERT INTO ledger_entry (ledger_transaction_id, ledger_account_id, direction, amount_in_k) VALUES ($1, $2, $3, $4);`
+
+// The balance is signed by the account's normal side: debits for assets and expenses, credits for the rest
+const GetLedgerBalanceStatement = `SELECT COALESCE(sum(CASE WHEN (le.direction = 'DEBIT') = (la.account_type IN ('ASSET', 'EXPENSE')) THEN le.amount_in_k ELSE -le.amount_in_k END), 0)
+FROM ledger_account la
+LEFT JOIN ledger_entry le ON le.ledger_account_id = la.ledger_account_id
+WHERE la.code = $1;`
+
+const GetUnbalancedLedgerTransactionsStatement = `SELECT lt.idempotency_key,
+       sum(CASE WHEN le.direction = 'DEBIT' THEN le.amount_in_k ELSE 0 END) AS debits,
+       sum(CASE WHEN le.direction = 'CREDIT' THEN le.amount_in_k ELSE 0 END) AS credits
+FROM ledger_transaction lt
+JOIN ledger_entry le ON le.ledger_transaction_id = lt.ledger_transaction_id
+GROUP BY lt.ledger_transaction_id, lt.idempotency_key
+HAVING sum(CASE WHEN le.direction = 'DEBIT' THEN le.amount_in_k ELSE -le.amount_in_k END) <> 0;`
+
+const GetLedgerBalanceMismatchesStatement = `WITH ledger_balances AS (
+    SELECT la.code,
+           sum(CASE WHEN (le.direction = 'DEBIT') = (la.account_type IN ('ASSET', 'EXPENSE')) THEN le.amount_in_k ELSE -le.amount_in_k END) AS balance_in_k
+    FROM ledger_account la
+    JOIN ledger_entry le ON le.ledger_account_id = la.ledger_account_id
+    GROUP BY la.code
+), cached_balances AS (
+    SELECT 'SOLO_SAVINGS:' || customer_id AS code, balance_in_k::bigint AS balance_in_k FROM solo_savings_account
+    UNION ALL
+    SELECT 'FAMILY_VAULT:' || family_vault_plan_id, balance_in_k FROM family_vault_plan
+    UNION ALL
+    SELECT 'TARGET_SAVINGS:' || target_savings_plan_id, balance_in_k FROM target_savings_plan
+    UNION ALL
+    SELECT 'INVESTMENT:' || customer_id, balance_in_k FROM investment_account
+    UNION ALL
+    SELECT 'LOANS_RECEIVABLE:' || customer_id, amount_owed_in_k FROM loans_account
+    UNION ALL
+    SELECT 'INVESTMENT_POSITION:' || investment_position_id, CASE WHEN status = 'ACTIVE' THEN principal_in_k ELSE 0 END FROM investment_position
+)
+SELECT COALESCE(c.code, l.code), COALESCE(c.balance_in_k, 0), COALESCE(l.balance_in_k, 0)
+FROM cached_balances c
+FULL OUTER JOIN ledger_balances l ON c.code = l.code
+WHERE COALESCE(c.balance_in_k, 0) <> COALESCE(l.balance_in_k, 0)
+AND COALESCE(c.code, l.code) ~ '^(SOLO_SAVINGS|FAMILY_VAULT|TARGET_SAVINGS|INVESTMENT|INVESTMENT_POSITION|LOANS_RECEIVABLE):';`
 
-const CreateInvestmentApplicationStatement = `WITH check_pending_applications AS (
-    SELECT count(investment_account.account_id) as pending
-    FROM investment_application
-    JOIN investment_account ON investment_application.investment_account_id = investment_account.account_id
-    WHERE investment_account.customer_id = $1
-    AND status = 'PENDING'
-), get_customer_account_id AS (
-   SELECT investment_account.account_id AS account_id FROM investment_account, investment_application WHERE investment_application.investment_account_id = investment_account.account_id AND investment_account.customer_id = $1 LIMIT 1
+// The history combines card payments, withdrawals and loan disbursement
+// payouts, which are pending until their transfer has ended. Empty
+// filter arguments mean "don't filter".
+const GetTransactionHistoryStatement = `WITH history AS (
+    SELECT p.reference_number::text AS reference,
+           CASE WHEN p.payment_originator = 'LOAN_REPAYMENT' THEN 'LOANS' ELSE p.payment_originator::text END AS product,
+           CASE WHEN p.payment_originator = 'LOAN_REPAYMENT' THEN 'OUT' ELSE 'IN' END AS direction,
+           CASE WHEN p.verification_status = 'SUCCESSFUL' THEN p.fulfillment_status::text ELSE p.verification_status::text END AS status,
+           p.payment_amount_in_k::bigint AS amount_in_k,
+           p.created_at
+    FROM payment_processor_transaction p
+    WHERE p.customer_id = $1
+    UNION ALL
+    SELECT '', 'SOLO_SAVINGS', 'OUT', w.status::text, w.amount_in_k, w.date_created
+    FROM withdrawal_application w
+    WHERE w.customer_id = $1
+    UNION ALL
+    SELECT po.reference::text, 'LOANS', 'IN',
+           CASE WHEN po.status IN ('PENDING', 'PROCESSING') THEN 'PENDING'
+                WHEN po.status = 'SUCCESSFUL' THEN 'SUCCESSFUL'
+                ELSE 'FAILED' END,
+           po.amount_in_k, po.created_at
+    FROM payout po
+    WHERE po.customer_id = $1
+    AND po.purpose = 'LOAN_DISBURSEMENT'
 )
-INSERT INTO investment_application (investment_account_id, employment_status, date_of_employment, employer_name, tenure, tin, bank_account_name, bank_account_number, amount_in_k)
-SELECT account_id, $2, $3, $4, $5, $6, $7, $8, $9
-FROM get_customer_account_id WHERE (SELECT pending FROM check_pending_applications) = 0;`
+SELECT reference, product, direction, status, amount_in_k, created_at
+FROM history
+WHERE ($2::timestamp IS NULL OR created_at >= $2)
+AND ($3::timestamp IS NULL OR created_at < $3)
+AND ($4 = '' OR product = $4)
+AND ($5 = '' OR status = $5)
+AND ($6 = '' OR direction = $6)
+ORDER BY created_at DESC
+LIMIT $7 OFFSET $8;`
+
+const GetStatementCustomerStatement = `SELECT first_name, last_name, email FROM customer WHERE customer_id = $1;`
+
+const GetStatementTargetSavingsPlanStatement = `SELECT name FROM target_savings_plan WHERE target_savings_plan_id = $1 AND customer_id = $2;`
+
+const GetStatementFamilyVaultPlanStatement = `SELECT p.family_name FROM family_vault_plan AS p
+JOIN family_vault_plan_member AS m ON m.family_vault_plan_id = p.family_vault_plan_id
+WHERE p.family_vault_plan_id = $1 AND m.customer_id = $2;`
+
+// investments are named by their product and the day they started
+const statementInvestmentPositionName = `pr.name || ' from ' || to_char(p.start_date, 'DD Mon YYYY')`
+
+const GetStatementInvestmentPositionStatement = `SELECT ` + statementInvestmentPositionName + ` FROM investment_position AS p
+JOIN investment_product AS pr ON pr.investment_product_id = p.investment_product_id
+WHERE p.investment_position_id = $1 AND p.customer_id = $2;`
+
+const GetStatementPlansStatement = `SELECT 'target-savings', target_savings_plan_id, name FROM target_savings_plan WHERE customer_id = $1
+UNION ALL
+SELECT 'family-vault', p.family_vault_plan_id, p.family_name FROM family_vault_plan AS p
+JOIN family_vault_plan_member AS m ON m.family_vault_plan_id = p.family_vault_plan_id
+WHERE m.customer_id = $1
+UNION ALL
+SELECT 'investment', p.investment_position_id, ` + statementInvestmentPositionName + ` FROM investment_position AS p
+JOIN investment_product AS pr ON pr.investment_product_id = p.investment_product_id
+WHERE p.customer_id = $1
+ORDER BY 1, 3;`
+
+const GetLedgerBalanceBeforeStatement = `SELECT COALESCE(sum(CASE WHEN (le.direction = 'DEBIT') = (la.account_type IN ('ASSET', 'EXPENSE')) THEN le.amount_in_k ELSE -le.amount_in_k END), 0)
+FROM ledger_account la
+LEFT JOIN ledger_entry le ON le.ledger_account_id = la.ledger_account_id AND le.created_at < $2
+WHERE la.code = $1;`
+
+const GetLedgerEntriesBetweenStatement = `SELECT lt.idempotency_key, lt.description, le.direction, le.amount_in_k, le.created_at
+FROM ledger_entry le
+JOIN ledger_transaction lt ON lt.ledger_transaction_id = le.ledger_transaction_id
+JOIN ledger_account la ON la.ledger_account_id = le.ledger_account_id
+WHERE la.code = $1
+AND le.created_at >= $2
+AND le.created_at < $3
+ORDER BY le.created_at, le.ledger_entry_id;`
+
+// A repeated event with a valid signature conflicts and returns no row
+const SaveWebhookEventStatement = `INSERT INTO webhook_event (provider, event_id, event_type, payload, signature, signature_valid, status, failure_reason)
+VALUES ($1, $2, $3, $4, $5, $6,
+        CASE WHEN $6 THEN 'PENDING' ELSE 'FAILED' END::status_type,
+        CASE WHEN $6 THEN NULL ELSE 'invalid signature' END)
+ON CONFLICT (provider, event_id) WHERE signature_valid DO NOTHING
+RETURNING webhook_event_id;`
+
+const GetWebhookEventIDStatement = `SELECT webhook_event_id FROM webhook_event WHERE provider = $1 AND event_id = $2 AND signature_valid;`
+
+const webhookEventColumns = `webhook_event_id, provider, event_id, event_type, payload, COALESCE(signature, ''), signature_valid, status, COALESCE(failure_reason, ''), attempts, received_at, processed_at`
+
+const GetWebhookEventStatement = `SELECT ` + webhookEventColumns + ` FROM webhook_event WHERE webhook_event_id = $1;`
+
+// An empty status lists every event
+const GetWebhookEventsStatement = `SELECT ` + webhookEventColumns + ` FROM webhook_event
+WHERE ($1 = '' OR status::text = $1)
+ORDER BY received_at DESC
+LIMIT $2;`
+
+const RecordWebhookEventOutcomeStatement = `UPDATE webhook_event
+SET status = $2,
+failure_reason = $3,
+attempts = attempts + 1,
+processed_at = CURRENT_TIMESTAMP
+WHERE webhook_event_id = $1;`
+
+// Flagged payments are left for an admin, so the job doesn't keep asking about them
+const GetStalePendingPaymentsStatement = `SELECT ` + paymentColumns + ` FROM payment_processor_transaction
+WHERE verification_status = 'PENDING'
+AND flagged_at IS NULL
+AND created_at < $1
+ORDER BY created_at
+LIMIT $2;`
+
+const FlagPaymentForReviewStatement = `UPDATE payment_processor_transaction
+SET flagged_at = CURRENT_TIMESTAMP,
+flag_reason = $2
+WHERE reference_number = $1;`
+
+const GetFlaggedPaymentsStatement = `SELECT ` + paymentColumns + ` FROM payment_processor_transaction
+WHERE flagged_at IS NOT NULL
+ORDER BY flagged_at DESC
+LIMIT $1;`
+
+const GetPaymentsCreatedBetweenStatement = `SELECT ` + paymentColumns + ` FROM payment_processor_transaction
+WHERE payment_provider = $1
+AND created_at >= $2
+AND created_at < $3
+ORDER BY created_at;`
+
+// Running a day's report again replaces it
+const SaveReconciliationReportStatement = `INSERT INTO payment_reconciliation_report (provider, report_date, matched_count, discrepancies)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (provider, report_date) DO UPDATE
+SET matched_count = EXCLUDED.matched_count,
+discrepancies = EXCLUDED.discrepancies,
+created_at = CURRENT_TIMESTAMP
+RETURNING report_id;`
+
+const GetReconciliationReportsStatement = `SELECT report_id, provider, report_date, matched_count, discrepancies, created_at FROM payment_reconciliation_report
+ORDER BY report_date DESC, provider
+LIMIT $1;`
+
+const bankAccountColumns = `bank_account_id, customer_id, bank_code, account_number, account_name, recipient_provider, recipient_code, created_at`
+
+const AddBankAccountStatement = `INSERT INTO customer_bank_account (customer_id, bank_code, account_number, account_name, recipient_provider, recipient_code)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (customer_id, bank_code, account_number) DO NOTHING
+RETURNING bank_account_id;`
+
+const GetBankAccountStatement = `SELECT ` + bankAccountColumns + ` FROM customer_bank_account WHERE customer_id = $1 AND bank_account_id = $2;`
+
+const GetBankAccountsStatement = `SELECT ` + bankAccountColumns + ` FROM customer_bank_account WHERE customer_id = $1 ORDER BY created_at;`
+
+const SaveTransferRecipientStatement = `UPDATE customer_bank_account SET recipient_provider = $2, recipient_code = $3 WHERE bank_account_id = $1;`
+
+const CreateWithdrawalApplicationStatement = `INSERT INTO withdrawal_application (customer_id, bank_account_id, amount_in_k) VALUES ($1, $2, $3) RETURNING withdrawal_application_id;`
+
+const withdrawalApplicationColumns = `w.withdrawal_application_id, w.customer_id, c.first_name || ' ' || c.last_name, COALESCE(w.bank_account_id, 0), w.amount_in_k, w.status, COALESCE(w.failure_reason, ''),
+w.decision_note, COALESCE(w.reviewed_by, 0), w.reviewed_at, COALESCE(p.status::text, ''), w.date_created
+FROM withdrawal_application w
+JOIN customer c ON c.customer_id = w.customer_id
+LEFT JOIN LATERAL (
+    SELECT status FROM payout WHERE purpose = 'WITHDRAWAL' AND source_id = w.withdrawal_application_id ORDER BY payout_id DESC LIMIT 1
+) p ON true`
+
+const GetWithdrawalApplicationStatement = `SELECT ` + withdrawalApplicationColumns + ` WHERE w.withdrawal_application_id = $1;`
+
+const LockWithdrawalApplicationStatement = `SELECT ` + withdrawalApplicationColumns + ` WHERE w.withdrawal_application_id = $1 FOR UPDATE OF w;`
+
+// PENDING is the withdrawals waiting for a decision, and PAYING the
+// pending ones that have been approved
+const GetWithdrawalApplicationsStatement = `SELECT ` + withdrawalApplicationColumns + `
+WHERE $1 = ''
+OR ($1 = 'PENDING' AND w.status = 'PENDING' AND w.reviewed_at IS NULL)
+OR ($1 = 'PAYING' AND w.status = 'PENDING' AND w.reviewed_at IS NOT NULL)
+OR ($1 IN ('SUCCESSFUL', 'FAILED') AND w.status::text = $1)
+ORDER BY CASE WHEN $2 = 'largest' THEN w.amount_in_k END DESC,
+CASE WHEN $2 = 'newest' THEN w.date_created END DESC,
+w.date_created, w.withdrawal_application_id
+LIMIT $3 OFFSET $4;`
+
+// Rejected withdrawals fail with the note as their reason
+const DecideWithdrawalApplicationStatement = `UPDATE withdrawal_application
+SET status = $2,
+failure_reason = CASE WHEN $2 = 'FAILED' THEN $3 ELSE failure_reason END,
+decision_note = $3,
+reviewed_by = $4,
+reviewed_at = CURRENT_TIMESTAMP
+WHERE withdrawal_application_id = $1 AND status = 'PENDING' AND reviewed_at IS NULL;`
+
+const UpdateWithdrawalApplicationStatusStatement = `UPDATE withdrawal_application SET status = $2, failure_reason = NULLIF($3, '') WHERE withdrawal_application_id = $1;`
+
+const payoutColumns = `payout_id, reference, customer_id, bank_account_id, purpose, source_id, amount_in_k, provider, COALESCE(provider_transfer_id, ''), status, COALESCE(failure_reason, ''), created_at, updated_at`
+
+// There is only ever one payout for a withdrawal or a loan
+const CreatePayoutStatement = `INSERT INTO payout (reference, customer_id, bank_account_id, purpose, source_id, amount_in_k, provider)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (purpose, source_id) WHERE status NOT IN ('FAILED', 'REVERSED') DO NOTHING
+RETURNING payout_id;`
+
+const GetPayoutByReferenceStatement = `SELECT ` + payoutColumns + ` FROM payout WHERE reference = $1;`
+
+const GetStalePendingPayoutsStatement = `SELECT ` + payoutColumns + ` FROM payout
+WHERE status = 'PENDING' AND created_at < $1
+ORDER BY created_at
+LIMIT $2;`
+
+// Payouts are locked while they are settled, so a webhook and a retry
+// can't both post the ledger entries for them
+const LockPayoutStatement = `SELECT ` + payoutColumns + ` FROM payout WHERE reference = $1 FOR UPDATE;`
+
+const MarkPayoutProcessingStatement = `UPDATE payout
+SET status = 'PROCESSING',
+provider_transfer_id = $2,
+updated_at = CURRENT_TIMESTAMP
+WHERE reference = $1 AND status = 'PENDING';`
+
+const UpdatePayoutStatusStatement = `UPDATE payout
+SET status = $2,
+failure_reason = NULLIF($3, ''),
+updated_at = CURRENT_TIMESTAMP
+WHERE reference = $1;`
+
+// The payment is locked while a refund is made for it, so two refunds
+// can't add up to more than it
+const LockPaymentStatement = `SELECT ` + paymentColumns + ` FROM payment_processor_transaction WHERE reference_number = $1 FOR UPDATE;`
+
+const refundColumns = `refund_id, reference, payment_reference, amount_in_k, reason, initiated_by, provider, COALESCE(provider_refund_id, ''), status, held, COALESCE(failure_reason, ''), created_at, updated_at`
+
+// Failed refunds gave the money back, so they don't count
+const GetRefundedAmountStatement = `SELECT COALESCE(sum(amount_in_k), 0) FROM payment_refund WHERE payment_reference = $1 AND status <> 'FAILED';`
+
+const CreateRefundStatement = `INSERT INTO payment_refund (reference, payment_reference, amount_in_k, reason, initiated_by, provider, held)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + refundColumns + `;`
+
+const GetRefundsStatement = `SELECT ` + refundColumns + ` FROM payment_refund WHERE payment_reference = $1 ORDER BY created_at DESC, refund_id DESC;`
+
+const GetPendingRefundStatement = `SELECT ` + refundColumns + ` FROM payment_refund
+WHERE payment_reference = $1 AND amount_in_k = $2 AND status = 'PENDING'
+ORDER BY created_at, refund_id
+LIMIT 1;`
+
+const LockRefundStatement = `SELECT ` + refundColumns + ` FROM payment_refund WHERE reference = $1 FOR UPDATE;`
+
+const MarkRefundSubmittedStatement = `UPDATE payment_refund
+SET provider_refund_id = $2,
+updated_at = CURRENT_TIMESTAMP
+WHERE reference = $1;`
+
+const UpdateRefundStatusStatement = `UPDATE payment_refund
+SET status = $2,
+failure_reason = NULLIF($3, ''),
+updated_at = CURRENT_TIMESTAMP
+WHERE reference = $1;`
+
+const disputeColumns = `dispute_id, provider, provider_dispute_id, payment_reference, amount_in_k, COALESCE(reason, ''), status, held, created_at, resolved_at`
+
+// Providers send a dispute more than once, so it is only saved the
+// first time
+const CreateDisputeStatement = `INSERT INTO payment_dispute (provider, provider_dispute_id, payment_reference, amount_in_k, reason)
+VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+ON CONFLICT (provider, provider_dispute_id) DO NOTHING
+RETURNING ` + disputeColumns + `;`
+
+const LockDisputeStatement = `SELECT ` + disputeColumns + ` FROM payment_dispute WHERE provider = $1 AND provider_dispute_id = $2 FOR UPDATE;`
+
+const GetDisputesStatement = `SELECT ` + disputeColumns + ` FROM payment_dispute WHERE payment_reference = $1 ORDER BY created_at DESC, dispute_id DESC;`
+
+const SetDisputeHeldStatement = `UPDATE payment_dispute SET held = true WHERE dispute_id = $1;`
+
+const ResolveDisputeStatement = `UPDATE payment_dispute SET status = $3, resolved_at = CURRENT_TIMESTAMP WHERE provider = $1 AND provider_dispute_id = $2;`
+
+const RecordAuditStatement = `INSERT INTO audit_log (actor, action, subject, detail) VALUES ($1, $2, $3, $4);`
+
+const GetAuditLogStatement = `SELECT audit_log_id, actor, action, subject, detail, created_at FROM audit_log
+WHERE subject = $1
+ORDER BY created_at DESC, audit_log_id DESC
+LIMIT $2;`
+
+const CreateLoanStatement = `INSERT INTO loan (customer_id, principal_in_k, disbursed_at, interest_method, monthly_rate_bp, fee_rate_bp, installment_frequency)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING loan_id;`
+
+const CreateLoanInstallmentStatement = `INSERT INTO loan_installment (loan_id, installment_number, due_date, principal_due_in_k, interest_due_in_k, fee_due_in_k)
+VALUES ($1, $2, $3, $4, $5, $6);`
+
+const loanColumns = `loan_id, customer_id, principal_in_k, status, interest_method, monthly_rate_bp, fee_rate_bp, installment_frequency, days_past_due, delinquency_bucket, disbursed_at, repaid_at, created_at`
+
+const GetActiveLoanStatement = `SELECT ` + loanColumns + ` FROM loan WHERE customer_id = $1 AND status IN ('ACTIVE', 'DEFAULTED');`
+
+// Loans are locked while a repayment is shared out over them
+const LockLoanStatement = `SELECT ` + loanColumns + ` FROM loan WHERE loan_id = $1 FOR UPDATE;`
+
+const GetLoanInstallmentsStatement = `SELECT loan_installment_id, loan_id, installment_number, due_date, principal_due_in_k, interest_due_in_k, fee_due_in_k, penalty_due_in_k, principal_paid_in_k, interest_paid_in_k, fee_paid_in_k, penalty_paid_in_k, paid_at, overdue_at, penalty_charged_through, last_reminded_at
+FROM loan_installment WHERE loan_id = $1 ORDER BY installment_number;`
+
+const UpdateLoanInstallmentStatement = `UPDATE loan_installment
+SET interest_due_in_k = $2,
+principal_paid_in_k = $3,
+interest_paid_in_k = $4,
+penalty_paid_in_k = $5,
+fee_paid_in_k = $6,
+paid_at = $7
+WHERE loan_installment_id = $1;`
+
+const MarkLoanRepaidStatement = `UPDATE loan SET status = 'REPAID', repaid_at = CURRENT_TIMESTAMP WHERE loan_id = $1;`
+
+const ReopenLoanStatement = `UPDATE loan SET status = 'ACTIVE', repaid_at = NULL WHERE loan_id = $1;`
+
+const loanRepaymentColumns = `loan_repayment_id, payment_reference, loan_id, kind, COALESCE(installment_number, 0), amount_in_k, penalty_paid_in_k, fee_paid_in_k, interest_paid_in_k, principal_paid_in_k, waived_interest_in_k, allocated_at`
+
+const CreateLoanRepaymentStatement = `INSERT INTO loan_repayment (payment_reference, loan_id, kind, installment_number, amount_in_k)
+VALUES ($1, $2, $3, NULLIF($4, 0), $5);`
+
+const GetLoanRepaymentStatement = `SELECT ` + loanRepaymentColumns + ` FROM loan_repayment WHERE payment_reference = $1;`
+
+const GetLoanRepaymentsStatement = `SELECT r.loan_repayment_id, r.payment_reference, r.loan_id, r.kind, COALESCE(r.installment_number, 0), r.amount_in_k, r.penalty_paid_in_k, r.fee_paid_in_k, r.interest_paid_in_k, r.principal_paid_in_k, r.waived_interest_in_k, r.allocated_at
+FROM loan_repayment r
+JOIN payment_processor_transaction p ON p.reference_number = r.payment_reference
+WHERE r.loan_id = $1 AND p.verification_status <> 'FAILED'
+ORDER BY p.created_at DESC;`
+
+const AllocateLoanRepaymentStatement = `UPDATE loan_repayment
+SET penalty_paid_in_k = $2,
+fee_paid_in_k = $3,
+interest_paid_in_k = $4,
+principal_paid_in_k = $5,
+waived_interest_in_k = $6,
+allocated_at = CURRENT_TIMESTAMP
+WHERE payment_reference = $1;`
+
+// ReverseLoanRepaymentStatement takes what a refund or a dispute took
+// back off what a repayment went to
+const ReverseLoanRepaymentStatement = `UPDATE loan_repayment
+SET penalty_paid_in_k = penalty_paid_in_k - $2,
+fee_paid_in_k = fee_paid_in_k - $3,
+interest_paid_in_k = interest_paid_in_k - $4,
+principal_paid_in_k = principal_paid_in_k - $5,
+waived_interest_in_k = waived_interest_in_k - $6
+WHERE payment_reference = $1;`
+
+// ReallocateLoanRepaymentStatement adds what was given back after a
+// refund failed or a dispute was won to what a repayment went to
+const ReallocateLoanRepaymentStatement = `UPDATE loan_repayment
+SET penalty_paid_in_k = penalty_paid_in_k + $2,
+fee_paid_in_k = fee_paid_in_k + $3,
+interest_paid_in_k = interest_paid_in_k + $4,
+principal_paid_in_k = principal_paid_in_k + $5,
+waived_interest_in_k = waived_interest_in_k + $6
+WHERE payment_reference = $1;`
+
+const GetBVNStatement = `SELECT lpad(bvn::text, 11, '0') FROM bvn WHERE customer_id = $1;`
+
+// BVNs that belong to another customer aren't saved
+const SaveBVNStatement = `INSERT INTO bvn (customer_id, bvn) VALUES ($1, $2) ON CONFLICT DO NOTHING;`
+
+const loanApplicationColumns = `a.loan_application_id, la.customer_id, a.amount_requested_in_k, a.duration_requested_in_days, COALESCE(lpad(a.bvn::text, 11, '0'), ''), COALESCE(a.bank_account_id, 0), a.interest_method, a.monthly_rate_bp, a.fee_rate_bp, a.installment_frequency, COALESCE(a.credit_score, 0), a.credit_max_amount_in_k, a.credit_max_tenor_in_days, a.credit_reasons, a.guarantors_required,
+(SELECT COUNT(*) FROM loan_guarantor g WHERE g.loan_application_id = a.loan_application_id AND g.status = 'ACCEPTED'), a.status, a.decision_note, COALESCE(a.reviewed_by, 0), a.reviewed_at, COALESCE(a.loan_id, 0), a.created_at, a.updated_at
+FROM loan_application a
+JOIN loans_account la ON la.account_id = a.loans_account_id`
+
+const GetLoanApplicationStatement = `SELECT ` + loanApplicationColumns + ` WHERE a.loan_application_id = $1;`
+
+const LockLoanApplicationStatement = `SELECT ` + loanApplicationColumns + ` WHERE a.loan_application_id = $1 FOR UPDATE OF a;`
+
+const LockLoanApplicationByLoanStatement = `SELECT ` + loanApplicationColumns + ` WHERE a.loan_id = $1 FOR UPDATE OF a;`
+
+const GetLoanApplicationsStatement = `SELECT ` + loanApplicationColumns + `
+WHERE $1 = '' OR a.status::text = $1
+ORDER BY CASE WHEN $2 = 'largest' THEN a.amount_requested_in_k END DESC,
+CASE WHEN $2 = 'newest' THEN a.created_at END DESC,
+a.created_at, a.loan_application_id
+LIMIT $3 OFFSET $4;`
+
+const GetCustomerLoanApplicationsStatement = `SELECT ` + loanApplicationColumns + `
+WHERE la.customer_id = $1
+ORDER BY a.created_at DESC, a.loan_application_id DESC;`
+
+// reviewed_by is only set by the admins that decide on applications
+const TransitionLoanApplicationStatement = `UPDATE loan_application
+SET status = $2,
+decision_note = CASE WHEN $3 = '' THEN decision_note ELSE $3 END,
+reviewed_by = COALESCE($4, reviewed_by),
+reviewed_at = CASE WHEN $4::integer IS NULL THEN reviewed_at ELSE CURRENT_TIMESTAMP END,
+updated_at = CURRENT_TIMESTAMP
+WHERE loan_application_id = $1 AND status = $5;`
+
+const SetLoanApplicationLoanStatement = `UPDATE loan_application SET loan_id = $2 WHERE loan_application_id = $1;`
+
+const CancelLoanStatement = `UPDATE loan SET status = 'CANCELLED' WHERE loan_id = $1;`
+
+const GetActiveLoanIDsStatement = `SELECT loan_id FROM loan WHERE status = 'ACTIVE' ORDER BY loan_id;`
+
+const DefaultLoanStatement = `UPDATE loan SET status = 'DEFAULTED' WHERE loan_id = $1 AND status = 'ACTIVE';`
+
+const MarkLoanInstallmentOverdueStatement = `UPDATE loan_installment
+SET penalty_due_in_k = $2,
+overdue_at = $3,
+penalty_charged_through = $4
+WHERE loan_installment_id = $1;`
+
+const UpdateLoanDelinquencyStatement = `UPDATE loan SET days_past_due = $2, delinquency_bucket = $3 WHERE loan_id = $1;`
+
+const MarkLoanReminderSentStatement = `UPDATE loan_installment SET last_reminded_at = $2 WHERE loan_installment_id = $1;`
+
+const GetCustomerContactStatement = `SELECT first_name, email, COALESCE(phone_number, '') FROM customer WHERE customer_id = $1;`
+
+// only what is owed on late installments counts as overdue
+const GetOverdueLoansStatement = `SELECT l.loan_id, l.customer_id, l.principal_in_k, l.status, l.interest_method, l.monthly_rate_bp, l.fee_rate_bp, l.installment_frequency, l.days_past_due, l.delinquency_bucket, l.disbursed_at, l.repaid_at, l.created_at,
+c.first_name, c.email, COALESCE(c.phone_number, ''),
+SUM(i.principal_due_in_k - i.principal_paid_in_k + i.interest_due_in_k - i.interest_paid_in_k + i.fee_due_in_k - i.fee_paid_in_k + i.penalty_due_in_k - i.penalty_paid_in_k),
+SUM(CASE WHEN i.overdue_at IS NULL THEN 0 ELSE i.principal_due_in_k - i.principal_paid_in_k + i.interest_due_in_k - i.interest_paid_in_k + i.fee_due_in_k - i.fee_paid_in_k + i.penalty_due_in_k - i.penalty_paid_in_k END)
+FROM loan l
+JOIN customer c ON c.customer_id = l.customer_id
+JOIN loan_installment i ON i.loan_id = l.loan_id
+WHERE l.status IN ('ACTIVE', 'DEFAULTED') AND l.days_past_due > 0 AND ($1 = '' OR l.delinquency_bucket::text = $1)
+GROUP BY l.loan_id, c.customer_id
+ORDER BY l.days_past_due DESC, l.loan_id
+LIMIT $2;`
+
+// savings months are the months in the last year with a savings payment
+// that went through, and days late count installments that are still
+// late up to today
+const GetCreditSignalsStatement = `SELECT c.date_joined, c.email_is_verified, COALESCE(c.phone_number, '') <> '', c.date_of_birth IS NOT NULL, COALESCE(c.postal_address, '') <> '',
+COALESCE(s.balance_in_k, 0),
+(SELECT count(DISTINCT date_trunc('month', p.created_at)) FROM payment_processor_transaction p
+ WHERE p.customer_id = c.customer_id AND p.verification_status = 'SUCCESSFUL'
+ AND p.payment_originator IN ('SOLO_SAVINGS', 'TARGET_SAVINGS', 'FAMILY_SAVINGS')
+ AND p.created_at >= CURRENT_TIMESTAMP - interval '12 months'),
+b.customer_id IS NOT NULL, COALESCE(b.is_verified, FALSE),
+(SELECT count(*) FROM loan l WHERE l.customer_id = c.customer_id AND l.status = 'REPAID'),
+(SELECT count(*) FROM loan l WHERE l.customer_id = c.customer_id AND l.status = 'DEFAULTED'),
+(SELECT COALESCE(MAX(GREATEST(COALESCE(i.paid_at::date, CURRENT_DATE) - i.due_date, 0)), 0) FROM loan_installment i
+ JOIN loan l ON l.loan_id = i.loan_id
+ WHERE l.customer_id = c.customer_id AND l.status <> 'CANCELLED')
+FROM customer c
+LEFT JOIN solo_savings_account s ON s.customer_id = c.customer_id
+LEFT JOIN bvn b ON b.customer_id = c.customer_id
+WHERE c.customer_id = $1;`
+
+const CreateLoanApplicationStatementStatement = `INSERT INTO loan_application_statement (loan_application_id, file_name, format, analysis) VALUES ($1, $2, $3, $4);`
+
+const GetLoanApplicationStatementStatement = `SELECT file_name, format, analysis FROM loan_application_statement WHERE loan_application_id = $1;`
+
+// soloSavingsOnHold is what guarantors have put on hold of their solo
+// savings ($1 is the guarantor) against loans that haven't ended
+const soloSavingsOnHold = `(SELECT COALESCE(SUM(g.hold_in_k), 0) FROM loan_guarantor g
+JOIN loan_application a ON a.loan_application_id = g.loan_application_id
+WHERE g.customer_id = $1 AND g.status = 'ACCEPTED' AND a.status NOT IN ('REJECTED', 'REPAID'))`
+
+const GetSoloSavingsOnHoldStatement = `SELECT ` + soloSavingsOnHold + `;`
+
+// withdrawals can't take what is on hold
+const WithdrawSoloSavingsBalanceStatement = `UPDATE solo_savings_account SET balance_in_k = balance_in_k - $2 WHERE customer_id = $1 AND balance_in_k - ` + soloSavingsOnHold + ` >= $2;`
+
+const LockSoloSavingsBalanceStatement = `SELECT balance_in_k FROM solo_savings_account WHERE customer_id = $1 FOR UPDATE;`
+
+const loanGuarantorColumns = `g.loan_guarantor_id, g.loan_application_id, g.contact, g.token, g.status, COALESCE(g.customer_id, 0), g.hold_in_k, g.responded_at, g.created_at`
+
+const CreateLoanGuarantorStatement = `INSERT INTO loan_guarantor AS g (loan_application_id, contact, token) VALUES ($1, $2, $3)
+ON CONFLICT (loan_application_id, contact) DO NOTHING
+RETURNING ` + loanGuarantorColumns + `;`
+
+const GetLoanGuarantorsStatement = `SELECT ` + loanGuarantorColumns + ` FROM loan_guarantor g WHERE g.loan_application_id = $1 ORDER BY g.loan_guarantor_id;`
+
+const loanGuaranteeColumns = loanGuarantorColumns + `, la.customer_id, c.first_name || ' ' || c.last_name, a.amount_requested_in_k, a.duration_requested_in_days, a.status
+FROM loan_guarantor g
+JOIN loan_application a ON a.loan_application_id = g.loan_application_id
+JOIN loans_account la ON la.account_id = a.loans_account_id
+JOIN customer c ON c.customer_id = la.customer_id`
+
+const GetLoanGuaranteeStatement = `SELECT ` + loanGuaranteeColumns + ` WHERE g.token = $1;`
+
+const GetOpenLoanGuaranteesStatement = `SELECT ` + loanGuaranteeColumns + ` WHERE g.contact = ANY($1) AND g.status = 'INVITED' ORDER BY g.created_at DESC;`
+
+const LockLoanGuaranteeStatement = `SELECT ` + loanGuaranteeColumns + ` WHERE g.token = $1 FOR UPDATE OF g;`
+
+const RespondToLoanGuarantorStatement = `UPDATE loan_guarantor SET status = $2, customer_id = $3, hold_in_k = $4, responded_at = CURRENT_TIMESTAMP WHERE loan_guarantor_id = $1;`
+
+const investmentProductColumns = `investment_product_id, name, annual_rate_bp, minimum_amount_in_k, tenors_in_days, active, created_at`
+
+// Inactive products are listed after the ones that are offered
+const GetInvestmentProductsStatement = `SELECT ` + investmentProductColumns + ` FROM investment_product
+WHERE active OR NOT $1
+ORDER BY active DESC, name;`
+
+const GetInvestmentProductStatement = `SELECT ` + investmentProductColumns + ` FROM investment_product WHERE investment_product_id = $1;`
+
+// Returns no rows when there is already a product with the name
+const CreateInvestmentProductStatement = `INSERT INTO investment_product (name, annual_rate_bp, minimum_amount_in_k, tenors_in_days) VALUES ($1, $2, $3, $4)
+ON CONFLICT (name) DO NOTHING
+RETURNING investment_product_id;`
+
+const SetInvestmentProductActiveStatement = `UPDATE investment_product SET active = $2 WHERE investment_product_id = $1;`
+
+const investmentApplicationColumns = `a.investment_application_id, acc.customer_id, c.first_name || ' ' || c.last_name, COALESCE(a.investment_product_id, 0), COALESCE(p.name, ''), a.amount_in_k, COALESCE(a.tenure, 0),
+COALESCE(a.employment_status::text, ''), a.date_of_employment, COALESCE(a.employer_name, ''), COALESCE(a.tin, ''), COALESCE(a.bank_account_name, ''), COALESCE(a.bank_account_number, ''),
+a.status, a.decision_note, COALESCE(a.reviewed_by, 0), a.reviewed_at, a.submitted_at, COALESCE(ip.investment_position_id, 0), a.created_at, a.updated_at
+FROM investment_application a
+JOIN investment_account acc ON acc.account_id = a.investment_account_id
+JOIN customer c ON c.customer_id = acc.customer_id
+LEFT JOIN investment_product p ON p.investment_product_id = a.investment_product_id
+LEFT JOIN investment_position ip ON ip.investment_application_id = a.investment_application_id`
+
+const GetInvestmentApplicationStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE a.investment_application_id = $1;`
+
+// Drafts are left out; they haven't been sent to be reviewed
+const GetInvestmentApplicationsStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE a.status <> 'DRAFT' AND ($1 = '' OR a.status::text = $1)
+ORDER BY CASE WHEN $2 = 'largest' THEN a.amount_in_k END DESC,
+CASE WHEN $2 = 'newest' THEN a.submitted_at END DESC,
+a.submitted_at, a.investment_application_id
+LIMIT $3 OFFSET $4;`
+
+const GetCustomerInvestmentApplicationsStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE acc.customer_id = $1
+ORDER BY a.created_at DESC, a.investment_application_id DESC;`
+
+const GetInvestmentApplicationDraftStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE acc.customer_id = $1 AND a.status = 'DRAFT';`
+
+const LockInvestmentApplicationDraftStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE acc.customer_id = $1 AND a.status = 'DRAFT'
+FOR UPDATE OF a;`
+
+// The customer's investment account is looked up directly, so that
+// their first application is saved too. A customer's draft is updated
+// in place.
+const SaveInvestmentApplicationDraftStatement = `INSERT INTO investment_application (investment_account_id, status, employment_status, date_of_employment, employer_name, tenure, tin, bank_account_name, bank_account_number, amount_in_k, investment_product_id)
+SELECT account_id, 'DRAFT', NULLIF($2, '')::employment_status_type, $3, NULLIF($4, ''), NULLIF($5, 0), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9, NULLIF($10, 0)
+FROM investment_account WHERE customer_id = $1
+ORDER BY account_id
+LIMIT 1
+ON CONFLICT (investment_account_id) WHERE status = 'DRAFT' DO UPDATE SET
+employment_status = EXCLUDED.employment_status,
+date_of_employment = EXCLUDED.date_of_employment,
+employer_name = EXCLUDED.employer_name,
+tenure = EXCLUDED.tenure,
+tin = EXCLUDED.tin,
+bank_account_name = EXCLUDED.bank_account_name,
+bank_account_number = EXCLUDED.bank_account_number,
+amount_in_k = EXCLUDED.amount_in_k,
+investment_product_id = EXCLUDED.investment_product_id,
+updated_at = CURRENT_TIMESTAMP
+RETURNING investment_application_id;`
+
+const HasWaitingInvestmentApplicationStatement = `SELECT EXISTS (
+    SELECT 1 FROM investment_application a
+    JOIN investment_account acc ON acc.account_id = a.investment_account_id
+    WHERE acc.customer_id = $1 AND a.status = 'PENDING'
+);`
+
+const SubmitInvestmentApplicationStatement = `UPDATE investment_application SET status = 'PENDING', submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE investment_application_id = $1 AND status = 'DRAFT';`
+
+const LockInvestmentApplicationStatement = `SELECT ` + investmentApplicationColumns + `
+WHERE a.investment_application_id = $1
+FOR UPDATE OF a;`
+
+// Sets an application that is waiting to APPROVED or REJECTED
+const DecideInvestmentApplicationStatement = `UPDATE investment_application
+SET status = $2, decision_note = $3, reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE investment_application_id = $1 AND status = 'PENDING';`
+
+const investmentPositionColumns = `ip.investment_position_id, ip.customer_id, ip.investment_product_id, p.name, COALESCE(ip.investment_application_id, 0), COALESCE(ip.rolled_over_from, 0), ip.principal_in_k, ip.annual_rate_bp, ip.tenor_in_days, ip.start_date, ip.maturity_date, ip.status, ip.rollover, ip.return_in_k, ip.matured_at`
+
+const CreateInvestmentPositionStatement = `INSERT INTO investment_position (customer_id, investment_product_id, investment_application_id, rolled_over_from, principal_in_k, annual_rate_bp, tenor_in_days, start_date, maturity_date, rollover)
+VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), $5, $6, $7, $8, $9, $10)
+RETURNING investment_position_id;`
+
+// Positions that are still active come first, soonest to mature first
+const GetCustomerInvestmentPositionsStatement = `SELECT ` + investmentPositionColumns + `
+FROM investment_position ip
+JOIN investment_product p ON p.investment_product_id = ip.investment_product_id
+WHERE ip.customer_id = $1
+ORDER BY ip.status = 'ACTIVE' DESC, ip.maturity_date, ip.investment_position_id;`
+
+const LockInvestmentPositionStatement = `SELECT ` + investmentPositionColumns + `
+FROM investment_position ip
+JOIN investment_product p ON p.investment_product_id = ip.investment_product_id
+WHERE ip.investment_position_id = $1
+FOR UPDATE OF ip;`
+
+const SetInvestmentRolloverStatement = `UPDATE investment_position SET rollover = $3
+WHERE investment_position_id = $1 AND customer_id = $2 AND status = 'ACTIVE';`
+
+const GetMaturedInvestmentPositionIDsStatement = `SELECT investment_position_id FROM investment_position
+WHERE status = 'ACTIVE' AND maturity_date <= $1
+ORDER BY maturity_date, investment_position_id;`
+
+const MatureInvestmentPositionStatement = `UPDATE investment_position SET status = $2, return_in_k = $3, matured_at = $4
+WHERE investment_position_id = $1 AND status = 'ACTIVE';`
+
+const adminRoleColumns = `r.admin_role_id, r.name, r.description,
+ARRAY(SELECT rp.permission FROM admin_role_permission rp WHERE rp.admin_role_id = r.admin_role_id ORDER BY rp.permission)`
+
+const GetAdminRolesStatement = `SELECT ` + adminRoleColumns + ` FROM admin_role r
+ORDER BY r.admin_role_id;`
+
+const GetAdminUserRolesStatement = `SELECT ` + adminRoleColumns + ` FROM admin_role r
+JOIN admin_user_role ur ON ur.admin_role_id = r.admin_role_id
+JOIN admin_user a ON a.admin_user_id = ur.admin_user_id
+WHERE a.customer_id = $1
+ORDER BY r.admin_role_id;`
+
+// the names of the roles of the admin_user a
+const adminUserRoleNames = `ARRAY(SELECT r.name FROM admin_user_role ur
+JOIN admin_role r ON r.admin_role_id = ur.admin_role_id
+WHERE ur.admin_user_id = a.admin_user_id
+ORDER BY r.admin_role_id)`
+
+const GetAdminsStatement = `SELECT c.customer_id, c.first_name || ' ' || c.last_name, c.email, ` + adminUserRoleNames + `
+FROM admin_user a
+JOIN customer c ON c.customer_id = a.customer_id
+ORDER BY c.first_name, c.last_name, c.customer_id;`
+
+const GetCustomerByEmailStatement = `SELECT customer_id, first_name || ' ' || last_name, email FROM customer WHERE email = $1;`
+
+// upserting locks the admin while their roles are replaced
+const UpsertAdminUserStatement = `INSERT INTO admin_user (customer_id) VALUES ($1)
+ON CONFLICT (customer_id) DO UPDATE SET customer_id = EXCLUDED.customer_id
+RETURNING admin_user_id;`
+
+const DeleteAdminUserStatement = `DELETE FROM admin_user WHERE customer_id = $1;`
+
+const ClearAdminUserRolesStatement = `DELETE FROM admin_user_role WHERE admin_user_id = $1;`
+
+const AssignAdminUserRolesStatement = `INSERT INTO admin_user_role (admin_user_id, admin_role_id, assigned_by)
+SELECT $1, admin_role_id, $3 FROM admin_role WHERE name = ANY($2);`
+
+const customerAccountColumns = `c.customer_id, c.first_name, c.last_name, c.email, COALESCE(c.phone_number, ''), c.email_is_verified, c.date_joined, c.suspended_at, c.suspension_note,
+ARRAY(SELECT r.name FROM admin_user a
+JOIN admin_user_role ur ON ur.admin_user_id = a.admin_user_id
+JOIN admin_role r ON r.admin_role_id = ur.admin_role_id
+WHERE a.customer_id = c.customer_id
+ORDER BY r.admin_role_id)`
+
+const GetCustomerAccountStatement = `SELECT ` + customerAccountColumns + ` FROM customer c WHERE c.customer_id = $1;`
+
+const LockCustomerAccountStatement = `SELECT ` + customerAccountColumns + ` FROM customer c WHERE c.customer_id = $1 FOR UPDATE OF c;`
+
+const SuspendCustomerStatement = `UPDATE customer SET suspended_at = $2, suspension_note = $3 WHERE customer_id = $1;`
+
+const ReinstateCustomerStatement = `UPDATE customer SET suspended_at = NULL, suspension_note = '' WHERE customer_id = $1;`
+
+const adminActionColumns = `admin_action_id, kind, subject, summary, amount_in_k, payload, status, note, proposed_by, proposed_at, decision_note, COALESCE(reviewed_by, 0), reviewed_at, failure_reason, executed_at`
+
+// an action that is already waiting for the same subject is a conflict
+const ProposeAdminActionStatement = `INSERT INTO admin_action (kind, subject, summary, amount_in_k, payload, note, proposed_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT DO NOTHING
+RETURNING ` + adminActionColumns + `;`
+
+const GetAdminActionStatement = `SELECT ` + adminActionColumns + ` FROM admin_action WHERE admin_action_id = $1;`
+
+const LockAdminActionStatement = `SELECT ` + adminActionColumns + ` FROM admin_action WHERE admin_action_id = $1 FOR UPDATE;`
+
+const GetAdminActionsStatement = `SELECT ` + adminActionColumns + ` FROM admin_action
+WHERE $1 = '' OR status::text = $1
+ORDER BY CASE WHEN $2 = 'largest' THEN amount_in_k END DESC,
+CASE WHEN $2 = 'newest' THEN proposed_at END DESC,
+proposed_at, admin_action_id
+LIMIT $3 OFFSET $4;`
+
+const GetSubjectAdminActionsStatement = `SELECT ` + adminActionColumns + ` FROM admin_action
+WHERE subject = $1
+ORDER BY proposed_at DESC, admin_action_id DESC;`
+
+const DecideAdminActionStatement = `UPDATE admin_action SET status = $2, decision_note = $3, reviewed_by = $4, reviewed_at = CURRENT_TIMESTAMP
+WHERE admin_action_id = $1 AND status = 'PENDING';`
+
+const GetStaleApprovedAdminActionsStatement = `SELECT ` + adminActionColumns + ` FROM admin_action
+WHERE status = 'APPROVED' AND reviewed_at < $1
+ORDER BY reviewed_at LIMIT $2;`
+
+const FinishAdminActionStatement = `UPDATE admin_action SET status = $2, failure_reason = $3, executed_at = CURRENT_TIMESTAMP
+WHERE admin_action_id = $1 AND status = 'APPROVED';`
@@ -0,0 +1,432 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Every day the LoanCollector marks the installments that weren't paid
+// on time as overdue, charges them penalties once their grace period
+// is over, and moves their loans through the delinquency buckets by
+// how many days late the oldest installment is. Loans more than
+// loanDefaultDays late are defaulted. Customers are reminded before an
+// installment falls due, on the day, and while it is late.
+
+// Delinquency buckets, by how many days late a loan is
+const (
+	DelinquencyCurrent = "CURRENT"
+	Delinquency1To30   = "1_30"
+	Delinquency31To60  = "31_60"
+	Delinquency61To90  = "61_90"
+	Delinquency90Plus  = "90_PLUS"
+)
+
+const (
+	// collectionHour is when the daily collections run
+	collectionHour = 1
+	// AuditLoanDelinquency is recorded when a loan moves to another
+	// delinquency bucket
+	AuditLoanDelinquency = "LOAN_DELINQUENCY"
+	// AuditLoanDefaulted is recorded when a loan is defaulted
+	AuditLoanDefaulted = "LOAN_DEFAULTED"
+	// loanDefaultDays is how many days late a loan can be before it is
+	// defaulted, which is when it moves into the 90+ bucket
+	loanDefaultDays = 90
+)
+
+// loanReminderDays are when customers are reminded about an
+// installment, in days from its due date
+var loanReminderDays = []int{-3, 0, 1, 7, 30, 60, 90}
+
+var ErrInvalidPenaltyPolicy = errors.New("invalid loan penalty policy")
+
+// LoanPenaltyPolicy is what late installments are charged
+type LoanPenaltyPolicy struct {
+	// DailyRate is charged every day on what is overdue, without
+	// penalties, in basis points
+	DailyRate int64
+	// LateFee is charged once, when the grace period is over
+	LateFee Money
+	// GraceDays is how many days after its due date an installment can
+	// be paid without penalties
+	GraceDays int
+}
+
+var defaultLoanPenaltyPolicy = LoanPenaltyPolicy{DailyRate: 10, LateFee: 0, GraceDays: 3}
+
+// LoanPenaltyPolicyFromEnv is the default policy, with whatever is set
+// in LOAN_PENALTY_DAILY_RATE_BP, LOAN_LATE_FEE (in naira) and
+// LOAN_PENALTY_GRACE_DAYS
+func LoanPenaltyPolicyFromEnv() (LoanPenaltyPolicy, error) {
+	policy := defaultLoanPenaltyPolicy
+
+	if value, ok := os.LookupEnv("LOAN_PENALTY_DAILY_RATE_BP"); ok {
+		rate, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || rate < 0 {
+			return policy, fmt.Errorf("%w: LOAN_PENALTY_DAILY_RATE_BP %q", ErrInvalidPenaltyPolicy, value)
+		}
+		policy.DailyRate = rate
+	}
+
+	if value, ok := os.LookupEnv("LOAN_LATE_FEE"); ok {
+		fee, err := ParseMoney(value)
+		if err != nil || fee < 0 {
+			return policy, fmt.Errorf("%w: LOAN_LATE_FEE %q", ErrInvalidPenaltyPolicy, value)
+		}
+		policy.LateFee = fee
+	}
+
+	if value, ok := os.LookupEnv("LOAN_PENALTY_GRACE_DAYS"); ok {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return policy, fmt.Errorf("%w: LOAN_PENALTY_GRACE_DAYS %q", ErrInvalidPenaltyPolicy, value)
+		}
+		policy.GraceDays = days
+	}
+
+	return policy, nil
+}
+
+// penalty is what installment is charged for the days since its
+// penalties were last charged, up to and including today
+func (p LoanPenaltyPolicy) penalty(installment LoanInstallment, today time.Time) Money {
+	from := calendarDay(installment.DueDate).AddDate(0, 0, p.GraceDays)
+	if !installment.PenaltyChargedThrough.IsZero() && installment.PenaltyChargedThrough.After(from) {
+		from = calendarDay(installment.PenaltyChargedThrough)
+	}
+
+	days := daysBetween(from, today)
+	if days <= 0 {
+		return 0
+	}
+
+	var penalty Money
+	if installment.PenaltyChargedThrough.IsZero() {
+		penalty = p.LateFee
+	}
+
+	overdue := installment.Amount() - installment.PrincipalPaid - installment.InterestPaid - installment.FeePaid
+	return penalty + roundMoney(float64(overdue)*float64(p.DailyRate)/10000*float64(days))
+}
+
+// LoanDelinquency is what the collections did to a loan
+type LoanDelinquency struct {
+	// Loan is the loan as it is after the collections
+	Loan           Loan
+	PreviousBucket string
+	// Changed are the installments that were marked overdue or charged
+	// penalties
+	Changed        []LoanInstallment
+	PenaltyCharged Money
+	// Defaulted is set when the loan was defaulted by these collections
+	Defaulted bool
+}
+
+func (d LoanDelinquency) Escalated() bool {
+	return d.Loan.DelinquencyBucket != d.PreviousBucket
+}
+
+// OverdueLoan is a late loan, with who to chase for it
+type OverdueLoan struct {
+	Loan
+	Contact CustomerContact
+	// Owed is what is left to pay on the whole schedule
+	Owed Money
+	// Overdue is what is owed on the installments that are late
+	Overdue Money
+}
+
+type DelinquencyStore interface {
+	GetActiveLoanIDs() ([]uint, error)
+	// AssessLoanDelinquency runs assessDelinquency on a loan and saves
+	// what changed, with loans that move bucket in the audit log
+	AssessLoanDelinquency(loanID uint, policy LoanPenaltyPolicy, today time.Time) (LoanDelinquency, error)
+	GetCustomerContact(customerID uint) (CustomerContact, error)
+	MarkLoanReminderSent(installmentID uint, at time.Time) error
+	// GetOverdueLoans lists late loans in bucket, or in every bucket
+	// if it is empty, latest first
+	GetOverdueLoans(bucket string, limit int) ([]OverdueLoan, error)
+}
+
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// daysBetween is how many calendar days to is after from
+func daysBetween(from, to time.Time) int {
+	return int(calendarDay(to).Sub(calendarDay(from)).Hours() / 24)
+}
+
+func delinquencyBucket(daysPastDue int) string {
+	switch {
+	case daysPastDue <= 0:
+		return DelinquencyCurrent
+	case daysPastDue <= 30:
+		return Delinquency1To30
+	case daysPastDue <= 60:
+		return Delinquency31To60
+	case daysPastDue <= 90:
+		return Delinquency61To90
+	}
+	return Delinquency90Plus
+}
+
+// DelinquencyLabel is the loan's bucket as it is shown to people
+func (l Loan) DelinquencyLabel() string {
+	switch l.DelinquencyBucket {
+	case Delinquency1To30:
+		return "1 to 30 days late"
+	case Delinquency31To60:
+		return "31 to 60 days late"
+	case Delinquency61To90:
+		return "61 to 90 days late"
+	case Delinquency90Plus:
+		return "over 90 days late"
+	}
+	return "up to date"
+}
+
+func isDelinquencyBucket(bucket string) bool {
+	switch bucket {
+	case DelinquencyCurrent, Delinquency1To30, Delinquency31To60, Delinquency61To90, Delinquency90Plus:
+		return true
+	}
+	return false
+}
+
+func loanAuditSubject(id uint) string {
+	return fmt.Sprintf("loan:%d", id)
+}
+
+// assessDelinquency marks a loan's late installments as overdue,
+// charges them penalties through today, and works out the bucket the
+// loan is in. The loan that is passed in isn't changed.
+func assessDelinquency(loan Loan, policy LoanPenaltyPolicy, today time.Time) LoanDelinquency {
+	delinquency := LoanDelinquency{PreviousBucket: loan.DelinquencyBucket}
+	if loan.Status != LoanActive {
+		delinquency.Loan = loan
+		return delinquency
+	}
+
+	today = calendarDay(today)
+	loan.Installments = append([]LoanInstallment(nil), loan.Installments...)
+	loan.DaysPastDue = 0
+
+	for i := range loan.Installments {
+		installment := &loan.Installments[i]
+
+		late := daysBetween(installment.DueDate, today)
+		if installment.Paid() || late <= 0 {
+			continue
+		}
+		loan.DaysPastDue = max(loan.DaysPastDue, late)
+
+		changed := false
+		if installment.OverdueAt.IsZero() {
+			installment.OverdueAt = today
+			changed = true
+		}
+
+		if late > policy.GraceDays && !installment.PenaltyChargedThrough.Equal(today) {
+			penalty := policy.penalty(*installment, today)
+			installment.PenaltyDue += penalty
+			installment.PenaltyChargedThrough = today
+			delinquency.PenaltyCharged += penalty
+			changed = true
+		}
+
+		if changed {
+			delinquency.Changed = append(delinquency.Changed, *installment)
+		}
+	}
+
+	loan.DelinquencyBucket = delinquencyBucket(loan.DaysPastDue)
+	if loan.DaysPastDue > loanDefaultDays {
+		loan.Status = LoanDefaulted
+		delinquency.Defaulted = true
+	}
+
+	delinquency.Loan = loan
+	return delinquency
+}
+
+// dueReminder is the reminder that installment should be sent today,
+// in days from its due date. Only the latest is sent when several are
+// owed.
+func dueReminder(installment LoanInstallment, today time.Time) (int, bool) {
+	if installment.Paid() {
+		return 0, false
+	}
+
+	today = calendarDay(today)
+	reminder, due := 0, false
+
+	for _, days := range loanReminderDays {
+		on := calendarDay(installment.DueDate).AddDate(0, 0, days)
+		if on.After(today) {
+			break
+		}
+		if installment.LastRemindedAt.IsZero() || calendarDay(installment.LastRemindedAt).Before(on) {
+			reminder, due = days, true
+		}
+	}
+
+	return reminder, due
+}
+
+// loanReminder is the subject and body of the reminder about an
+// installment, days from its due date
+func loanReminder(contact CustomerContact, installment LoanInstallment, days int, baseURL string) (string, string) {
+	repay := fmt.Sprintf("You can repay at %s/dashboard/loans.", baseURL)
+
+	switch {
+	case days < 0:
+		return "Your loan installment is due soon", fmt.Sprintf("Hi %s, installment %d of your loan, %s, is due on %s. %s",
+			contact.FirstName, installment.Number, installment.Outstanding(), installment.DueDate.Format("02 Jan 2006"), repay)
+	case days == 0:
+		return "Your loan installment is due today", fmt.Sprintf("Hi %s, installment %d of your loan, %s, is due today. %s",
+			contact.FirstName, installment.Number, installment.Outstanding(), repay)
+	}
+
+	return "Your loan installment is overdue", fmt.Sprintf("Hi %s, installment %d of your loan is %d days late and %s is owed on it. Penalties are charged until it is paid. %s",
+		contact.FirstName, installment.Number, days, installment.Outstanding(), repay)
+}
+
+// CollectionReport counts what a day's collections did
+type CollectionReport struct {
+	Loans          int
+	Overdue        int
+	Escalated      int
+	Defaulted      int
+	PenaltyCharged Money
+	Reminders      int
+}
+
+type LoanCollector struct {
+	store    DelinquencyStore
+	notifier Notifier
+	policy   LoanPenaltyPolicy
+	baseURL  string
+	now      func() time.Time
+}
+
+func NewLoanCollector(store DelinquencyStore, notifier Notifier, policy LoanPenaltyPolicy, baseURL string) *LoanCollector {
+	return &LoanCollector{
+		store:    store,
+		notifier: notifier,
+		policy:   policy,
+		baseURL:  baseURL,
+		now:      time.Now,
+	}
+}
+
+// Run collects on every active loan once a day until ctx is cancelled
+func (c *LoanCollector) Run(ctx context.Context) {
+	daily := time.NewTimer(nextDailyRun(c.now(), collectionHour).Sub(c.now()))
+	defer daily.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-daily.C:
+			if _, err := c.Collect(ctx); err != nil {
+				log.Printf("loan collections failed: %s", err)
+			}
+			daily.Reset(nextDailyRun(c.now(), collectionHour).Sub(c.now()))
+		}
+	}
+}
+
+// Collect assesses every active loan, then sends the reminders that
+// are due. A loan that can't be collected on doesn't stop the rest.
+// Running it twice on a day does nothing the second time.
+func (c *LoanCollector) Collect(ctx context.Context) (CollectionReport, error) {
+	var report CollectionReport
+
+	ids, err := c.store.GetActiveLoanIDs()
+	if err != nil {
+		return report, err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		delinquency, err := c.store.AssessLoanDelinquency(id, c.policy, c.now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("loan %d: %w", id, err))
+			continue
+		}
+
+		report.Loans++
+		report.PenaltyCharged += delinquency.PenaltyCharged
+		if delinquency.Loan.DaysPastDue > 0 {
+			report.Overdue++
+		}
+		if delinquency.Escalated() {
+			report.Escalated++
+		}
+		if delinquency.Defaulted {
+			report.Defaulted++
+		}
+
+		sent, err := c.remind(ctx, delinquency.Loan)
+		report.Reminders += sent
+		if err != nil {
+			errs = append(errs, fmt.Errorf("loan %d: %w", id, err))
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// remind sends the reminders that are due on loan's installments. An
+// installment counts as reminded once any of its notifications has
+// been sent.
+func (c *LoanCollector) remind(ctx context.Context, loan Loan) (int, error) {
+	var contact CustomerContact
+	var errs []error
+	sent := 0
+
+	for _, installment := range loan.Installments {
+		days, due := dueReminder(installment, c.now())
+		if !due {
+			continue
+		}
+
+		if contact == (CustomerContact{}) {
+			var err error
+			if contact, err = c.store.GetCustomerContact(loan.CustomerID); err != nil {
+				return sent, err
+			}
+		}
+
+		subject, body := loanReminder(contact, installment, days, c.baseURL)
+		reminded := false
+		for _, notification := range contact.notifications(subject, body) {
+			err := c.notifier.Notify(ctx, notification)
+			if err == ErrNotificationNotSent {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s reminder: %w", notification.Channel, err))
+				continue
+			}
+			reminded = true
+		}
+
+		if reminded {
+			if err := c.store.MarkLoanReminderSent(installment.ID, c.now()); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			sent++
+		}
+	}
+
+	return sent, errors.Join(errs...)
+}
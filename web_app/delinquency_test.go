@@ -0,0 +1,357 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// FakeDelinquencyStore assesses loans the way the database does
+type FakeDelinquencyStore struct {
+	loans    map[uint]Loan
+	contacts map[uint]CustomerContact
+	audit    []AuditEntry
+}
+
+func NewFakeDelinquencyStore(loans ...Loan) *FakeDelinquencyStore {
+	store := &FakeDelinquencyStore{loans: map[uint]Loan{}, contacts: map[uint]CustomerContact{}}
+	for _, loan := range loans {
+		store.loans[loan.ID] = loan
+	}
+	return store
+}
+
+func (f *FakeDelinquencyStore) GetActiveLoanIDs() ([]uint, error) {
+	var ids []uint
+	for id, loan := range f.loans {
+		if loan.Status == LoanActive {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *FakeDelinquencyStore) AssessLoanDelinquency(loanID uint, policy LoanPenaltyPolicy, today time.Time) (LoanDelinquency, error) {
+	loan, ok := f.loans[loanID]
+	if !ok {
+		return LoanDelinquency{}, ErrLoanDoesNotExist
+	}
+
+	delinquency := assessDelinquency(loan, policy, today)
+	f.loans[loanID] = delinquency.Loan
+	if delinquency.Escalated() {
+		f.audit = append(f.audit, AuditEntry{Actor: ActorSystem, Action: AuditLoanDelinquency, Subject: loanAuditSubject(loanID)})
+	}
+	if delinquency.Defaulted {
+		f.audit = append(f.audit, AuditEntry{Actor: ActorSystem, Action: AuditLoanDefaulted, Subject: loanAuditSubject(loanID)})
+	}
+	return delinquency, nil
+}
+
+func (f *FakeDelinquencyStore) GetCustomerContact(customerID uint) (CustomerContact, error) {
+	contact, ok := f.contacts[customerID]
+	if !ok {
+		return contact, ErrAccountDoesNotExist
+	}
+	return contact, nil
+}
+
+func (f *FakeDelinquencyStore) MarkLoanReminderSent(installmentID uint, at time.Time) error {
+	for id, loan := range f.loans {
+		for i, installment := range loan.Installments {
+			if installment.ID == installmentID {
+				loan.Installments[i].LastRemindedAt = at
+				f.loans[id] = loan
+				return nil
+			}
+		}
+	}
+	return ErrInstallmentDoesNotExist
+}
+
+func (f *FakeDelinquencyStore) GetOverdueLoans(bucket string, limit int) ([]OverdueLoan, error) {
+	var loans []OverdueLoan
+	for _, loan := range f.loans {
+		if loan.DaysPastDue > 0 && (bucket == "" || loan.DelinquencyBucket == bucket) {
+			loans = append(loans, OverdueLoan{Loan: loan, Contact: f.contacts[loan.CustomerID], Owed: loan.Outstanding()})
+		}
+	}
+	return loans, nil
+}
+
+// FakeNotifier keeps what it was asked to send, and fails the channels
+// in failing
+type FakeNotifier struct {
+	sent    []Notification
+	failing map[string]bool
+}
+
+func (f *FakeNotifier) Notify(ctx context.Context, notification Notification) error {
+	if f.failing[notification.Channel] {
+		return errors.New("provider is down")
+	}
+	f.sent = append(f.sent, notification)
+	return nil
+}
+
+// newLateLoan is a loan with one installment of 110,000 naira that fell
+// due days before loanToday
+func newLateLoan(days int) Loan {
+	return Loan{
+		ID:                1,
+		CustomerID:        7,
+		Principal:         10000000,
+		Status:            LoanActive,
+		DelinquencyBucket: DelinquencyCurrent,
+		Installments: []LoanInstallment{
+			{ID: 1, LoanID: 1, Number: 1, DueDate: loanToday.AddDate(0, 0, -days), PrincipalDue: 10000000, InterestDue: 1000000},
+		},
+	}
+}
+
+var testPenaltyPolicy = LoanPenaltyPolicy{DailyRate: 10, LateFee: 100000, GraceDays: 3}
+
+func TestDelinquencyBucket(t *testing.T) {
+	for days, want := range map[int]string{
+		0:   DelinquencyCurrent,
+		1:   Delinquency1To30,
+		30:  Delinquency1To30,
+		31:  Delinquency31To60,
+		61:  Delinquency61To90,
+		90:  Delinquency61To90,
+		91:  Delinquency90Plus,
+		400: Delinquency90Plus,
+	} {
+		if got := delinquencyBucket(days); got != want {
+			t.Errorf("%d days: got %s, want %s", days, got, want)
+		}
+	}
+}
+
+func TestAssessDelinquency(t *testing.T) {
+	t.Run("marks late installments overdue without penalties during the grace period", func(t *testing.T) {
+		delinquency := assessDelinquency(newLateLoan(3), testPenaltyPolicy, loanToday)
+
+		installment := delinquency.Loan.Installments[0]
+		if !installment.OverdueAt.Equal(loanToday) || installment.PenaltyDue != 0 {
+			t.Errorf("got %+v", installment)
+		}
+		if delinquency.Loan.DaysPastDue != 3 || delinquency.Loan.DelinquencyBucket != Delinquency1To30 || !delinquency.Escalated() {
+			t.Errorf("got %+v", delinquency.Loan)
+		}
+	})
+
+	t.Run("charges the late fee and the daily rate once the grace period is over", func(t *testing.T) {
+		delinquency := assessDelinquency(newLateLoan(5), testPenaltyPolicy, loanToday)
+
+		// two days at 0.1% of 110,000 naira, and the 1,000 naira fee
+		if want := Money(100000 + 22000); delinquency.PenaltyCharged != want || delinquency.Loan.Installments[0].PenaltyDue != want {
+			t.Errorf("got %s charged, want %s", delinquency.PenaltyCharged, want)
+		}
+	})
+
+	t.Run("charges each day once", func(t *testing.T) {
+		first := assessDelinquency(newLateLoan(5), testPenaltyPolicy, loanToday)
+
+		again := assessDelinquency(first.Loan, testPenaltyPolicy, loanToday.Add(6*time.Hour))
+		if again.PenaltyCharged != 0 || len(again.Changed) != 0 || again.Escalated() {
+			t.Errorf("the second run today did something: %+v", again)
+		}
+
+		later := assessDelinquency(first.Loan, testPenaltyPolicy, loanToday.AddDate(0, 0, 3))
+		if later.PenaltyCharged != 33000 {
+			t.Errorf("got %s for three more days, want %s", later.PenaltyCharged, Money(33000))
+		}
+	})
+
+	t.Run("doesn't charge penalties on penalties or what has been paid", func(t *testing.T) {
+		loan := newLateLoan(5)
+		loan.Installments[0].PenaltyDue = 5000000
+		loan.Installments[0].PrincipalPaid = 5000000
+
+		delinquency := assessDelinquency(loan, LoanPenaltyPolicy{DailyRate: 10, GraceDays: 3}, loanToday)
+		if delinquency.PenaltyCharged != 12000 {
+			t.Errorf("got %s, want %s", delinquency.PenaltyCharged, Money(12000))
+		}
+	})
+
+	t.Run("leaves paid installments alone", func(t *testing.T) {
+		loan := newLateLoan(45)
+		loan.Installments[0].PrincipalPaid = 10000000
+		loan.Installments[0].InterestPaid = 1000000
+
+		delinquency := assessDelinquency(loan, testPenaltyPolicy, loanToday)
+		if len(delinquency.Changed) != 0 || delinquency.Loan.DaysPastDue != 0 || delinquency.Loan.DelinquencyBucket != DelinquencyCurrent {
+			t.Errorf("got %+v", delinquency)
+		}
+	})
+
+	t.Run("moves loans to the bucket of their oldest late installment", func(t *testing.T) {
+		loan := newLateLoan(45)
+		loan.Installments = append(loan.Installments, LoanInstallment{ID: 2, LoanID: 1, Number: 2, DueDate: loanToday.AddDate(0, 0, -15), PrincipalDue: 10000000})
+
+		delinquency := assessDelinquency(loan, testPenaltyPolicy, loanToday)
+		if delinquency.Loan.DaysPastDue != 45 || delinquency.Loan.DelinquencyBucket != Delinquency31To60 {
+			t.Errorf("got %+v", delinquency.Loan)
+		}
+		if loan.Installments[0].PenaltyDue != 0 {
+			t.Error("the loan that was passed in was changed")
+		}
+	})
+
+	t.Run("defaults loans more than 90 days late", func(t *testing.T) {
+		if delinquency := assessDelinquency(newLateLoan(90), testPenaltyPolicy, loanToday); delinquency.Defaulted || delinquency.Loan.Status != LoanActive {
+			t.Errorf("a loan 90 days late was defaulted: %+v", delinquency.Loan)
+		}
+
+		delinquency := assessDelinquency(newLateLoan(91), testPenaltyPolicy, loanToday)
+		if !delinquency.Defaulted || delinquency.Loan.Status != LoanDefaulted || delinquency.Loan.DelinquencyBucket != Delinquency90Plus {
+			t.Errorf("got %+v", delinquency)
+		}
+
+		if again := assessDelinquency(delinquency.Loan, testPenaltyPolicy, loanToday.AddDate(0, 0, 1)); again.Defaulted || again.PenaltyCharged != 0 {
+			t.Errorf("a defaulted loan was collected on again: %+v", again)
+		}
+	})
+}
+
+func TestDueReminder(t *testing.T) {
+	installment := LoanInstallment{ID: 1, Number: 1, DueDate: loanToday, PrincipalDue: 10000000}
+
+	cases := []struct {
+		name     string
+		today    time.Time
+		reminded time.Time
+		want     int
+		due      bool
+	}{
+		{"too early", loanToday.AddDate(0, 0, -4), time.Time{}, 0, false},
+		{"before it is due", loanToday.AddDate(0, 0, -3), time.Time{}, -3, true},
+		{"on the day", loanToday, loanToday.AddDate(0, 0, -3), 0, true},
+		{"already reminded today", loanToday.Add(time.Hour), loanToday, 0, false},
+		{"only the latest of those missed", loanToday.AddDate(0, 0, 10), time.Time{}, 7, true},
+		{"between reminders", loanToday.AddDate(0, 0, 10), loanToday.AddDate(0, 0, 7), 0, false},
+	}
+
+	for _, c := range cases {
+		installment.LastRemindedAt = c.reminded
+		days, due := dueReminder(installment, c.today)
+		if due != c.due || days != c.want {
+			t.Errorf("%s: got %d %t, want %d %t", c.name, days, due, c.want, c.due)
+		}
+	}
+}
+
+func TestLoanCollector(t *testing.T) {
+	ctx := context.Background()
+
+	newCollector := func(loan Loan, notifier *FakeNotifier) (*LoanCollector, *FakeDelinquencyStore) {
+		store := NewFakeDelinquencyStore(loan)
+		store.contacts[7] = CustomerContact{FirstName: "Ada", Email: "ada@example.com", PhoneNumber: "+2348012345678"}
+
+		collector := NewLoanCollector(store, notifier, testPenaltyPolicy, "https://paz.test")
+		collector.now = func() time.Time { return loanToday.Add(time.Hour) }
+		return collector, store
+	}
+
+	t.Run("charges penalties and reminds the customer once a day", func(t *testing.T) {
+		notifier := &FakeNotifier{}
+		collector, store := newCollector(newLateLoan(7), notifier)
+
+		report, err := collector.Collect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Loans != 1 || report.Overdue != 1 || report.Escalated != 1 || report.Reminders != 1 || report.PenaltyCharged != 144000 {
+			t.Errorf("got %+v", report)
+		}
+		if len(notifier.sent) != 2 || notifier.sent[0].Channel != NotificationEmail || notifier.sent[1].Channel != NotificationSMS {
+			t.Errorf("expected an email and an SMS, got %+v", notifier.sent)
+		}
+		if len(store.audit) != 1 {
+			t.Errorf("expected the move to 1_30 in the audit log, got %+v", store.audit)
+		}
+
+		report, err = collector.Collect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Reminders != 0 || report.PenaltyCharged != 0 || len(notifier.sent) != 2 {
+			t.Errorf("the second run did something: %+v", report)
+		}
+	})
+
+	t.Run("counts a reminder sent on any channel", func(t *testing.T) {
+		notifier := &FakeNotifier{failing: map[string]bool{NotificationSMS: true}}
+		collector, store := newCollector(newLateLoan(1), notifier)
+
+		report, err := collector.Collect(ctx)
+		if err == nil {
+			t.Error("expected the SMS failure to be reported")
+		}
+		if report.Reminders != 1 || store.loans[1].Installments[0].LastRemindedAt.IsZero() {
+			t.Errorf("expected the email to count, got %+v", report)
+		}
+	})
+
+	t.Run("skips channels without a provider", func(t *testing.T) {
+		email := &FakeNotifier{}
+		collector, store := newCollector(newLateLoan(1), email)
+		collector.notifier = Notifiers{NotificationEmail: email}
+
+		report, err := collector.Collect(ctx)
+		if err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+		if report.Reminders != 1 || len(email.sent) != 1 || store.loans[1].Installments[0].LastRemindedAt.IsZero() {
+			t.Errorf("expected the email to count, got %+v", report)
+		}
+	})
+
+	t.Run("leaves reminders that couldn't be sent to be sent again", func(t *testing.T) {
+		collector, store := newCollector(newLateLoan(1), &FakeNotifier{})
+		collector.notifier = Notifiers{}
+
+		report, err := collector.Collect(ctx)
+		if err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+		if report.Reminders != 0 || !store.loans[1].Installments[0].LastRemindedAt.IsZero() {
+			t.Errorf("the reminder was marked sent: %+v", report)
+		}
+	})
+
+	t.Run("defaults loans more than 90 days late, once", func(t *testing.T) {
+		collector, store := newCollector(newLateLoan(91), &FakeNotifier{})
+
+		report, err := collector.Collect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Defaulted != 1 || store.loans[1].Status != LoanDefaulted {
+			t.Errorf("got %+v", report)
+		}
+		if last := store.audit[len(store.audit)-1]; last.Action != AuditLoanDefaulted || last.Subject != loanAuditSubject(1) {
+			t.Errorf("expected the default in the audit log, got %+v", store.audit)
+		}
+
+		if report, _ := collector.Collect(ctx); report.Loans != 0 || report.Defaulted != 0 {
+			t.Errorf("the defaulted loan was collected on again: %+v", report)
+		}
+	})
+
+	t.Run("sends nothing when nothing is due", func(t *testing.T) {
+		notifier := &FakeNotifier{}
+		collector, _ := newCollector(newLateLoan(-10), notifier)
+
+		report, err := collector.Collect(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Overdue != 0 || report.Reminders != 0 || len(notifier.sent) != 0 {
+			t.Errorf("got %+v", report)
+		}
+	})
+}
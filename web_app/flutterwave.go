@@ -0,0 +1,367 @@
+package web_app
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const flutterwaveBaseURL = "https://api.flutterwave.com/v3"
+
+// The webhook events that we understand. See
+// https://developer.flutterwave.com/docs/integration-guides/webhooks
+const (
+	FlutterwaveChargeCompleted   = "charge.completed"
+	FlutterwaveTransferCompleted = "transfer.completed"
+)
+
+var ErrFlutterwaveRequestFailed = errors.New("flutterwave request failed")
+
+// flutterwaveAmount is an amount in naira, with kobo after the point,
+// which is how Flutterwave sends and takes amounts
+type flutterwaveAmount Money
+
+func (a flutterwaveAmount) MarshalJSON() ([]byte, error) {
+	return []byte(Money(a).Decimal()), nil
+}
+
+func (a *flutterwaveAmount) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+
+	amount, err := ParseMoney(number.String())
+	*a = flutterwaveAmount(amount)
+	return err
+}
+
+type FlutterwaveCharge struct {
+	ID                int64             `json:"id"`
+	TxRef             string            `json:"tx_ref"`
+	FlwRef            string            `json:"flw_ref"`
+	Amount            flutterwaveAmount `json:"amount"`
+	Currency          string            `json:"currency"`
+	Status            string            `json:"status"`
+	ProcessorResponse string            `json:"processor_response"`
+	CreatedAt         time.Time         `json:"created_at"`
+}
+
+func (c FlutterwaveCharge) providerCharge() ProviderCharge {
+	status := ChargePending
+	switch c.Status {
+	case "successful":
+		status = ChargeSuccessful
+	case "failed", "cancelled":
+		status = ChargeFailed
+	}
+
+	return ProviderCharge{
+		ID:                strconv.FormatInt(c.ID, 10),
+		ProviderReference: c.TxRef,
+		Reference:         c.TxRef,
+		Amount:            Money(c.Amount),
+		Currency:          c.Currency,
+		Status:            status,
+		GatewayResponse:   c.ProcessorResponse,
+		PaidAt:            c.CreatedAt,
+	}
+}
+
+type FlutterwaveTransfer struct {
+	ID              int64             `json:"id"`
+	Reference       string            `json:"reference"`
+	Amount          flutterwaveAmount `json:"amount"`
+	Status          string            `json:"status"`
+	CompleteMessage string            `json:"complete_message"`
+}
+
+func (t FlutterwaveTransfer) providerTransfer() ProviderTransfer {
+	status := TransferPending
+	switch t.Status {
+	case "SUCCESSFUL":
+		status = TransferSuccessful
+	case "FAILED":
+		status = TransferFailed
+	}
+
+	transfer := ProviderTransfer{
+		ID:        strconv.FormatInt(t.ID, 10),
+		Reference: t.Reference,
+		Amount:    Money(t.Amount),
+		Status:    status,
+	}
+	if status == TransferFailed {
+		transfer.FailureReason = t.CompleteMessage
+	}
+	return transfer
+}
+
+// HTTPFlutterwaveClient is the Flutterwave PaymentProvider
+type HTTPFlutterwaveClient struct {
+	baseURL   string
+	secretKey string
+	// webhookHash is the secret hash set on the Flutterwave dashboard,
+	// which Flutterwave sends back with every webhook
+	webhookHash string
+	httpClient  *http.Client
+}
+
+func NewFlutterwaveClient(secretKey, webhookHash string) *HTTPFlutterwaveClient {
+	return NewFlutterwaveClientWithBaseURL(flutterwaveBaseURL, secretKey, webhookHash, &http.Client{Timeout: 15 * time.Second})
+}
+
+func NewFlutterwaveClientWithBaseURL(baseURL, secretKey, webhookHash string, httpClient *http.Client) *HTTPFlutterwaveClient {
+	return &HTTPFlutterwaveClient{baseURL: baseURL, secretKey: secretKey, webhookHash: webhookHash, httpClient: httpClient}
+}
+
+// flutterwaveResponse is the envelope around every Flutterwave API
+// response. Meta is only sent with lists.
+type flutterwaveResponse[T any] struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+	Meta    struct {
+		PageInfo struct {
+			CurrentPage int `json:"current_page"`
+			TotalPages  int `json:"total_pages"`
+		} `json:"page_info"`
+	} `json:"meta"`
+}
+
+func (c *HTTPFlutterwaveClient) Name() string {
+	return ProviderFlutterwave
+}
+
+func (c *HTTPFlutterwaveClient) Initialize(ctx context.Context, request PaymentRequest) (PaymentAuthorization, error) {
+	var response flutterwaveResponse[struct {
+		Link string `json:"link"`
+	}]
+
+	err := c.do(ctx, http.MethodPost, "/payments", map[string]any{
+		"tx_ref":       request.ReferenceNumber.String(),
+		"amount":       flutterwaveAmount(request.Amount),
+		"currency":     "NGN",
+		"redirect_url": request.CallbackURL,
+		"customer":     map[string]string{"email": request.Email},
+		"meta":         request.Metadata,
+	}, &response)
+
+	return PaymentAuthorization{AuthorizationURL: response.Data.Link}, err
+}
+
+func (c *HTTPFlutterwaveClient) Verify(ctx context.Context, reference string) (ProviderCharge, error) {
+	var response flutterwaveResponse[FlutterwaveCharge]
+	err := c.do(ctx, http.MethodGet, "/transactions/verify_by_reference?tx_ref="+url.QueryEscape(reference), nil, &response)
+	return response.Data.providerCharge(), err
+}
+
+// ListCharges lists the charges made between from and to. Flutterwave
+// only filters by day, so the rest of the days at either end are
+// dropped here.
+func (c *HTTPFlutterwaveClient) ListCharges(ctx context.Context, from, to time.Time) ([]ProviderCharge, error) {
+	var charges []ProviderCharge
+
+	for page := 1; ; page++ {
+		query := url.Values{
+			"from": {from.Format("2006-01-02")},
+			"to":   {to.Add(-time.Nanosecond).Format("2006-01-02")},
+			"page": {strconv.Itoa(page)},
+		}
+
+		var response flutterwaveResponse[[]FlutterwaveCharge]
+		if err := c.do(ctx, http.MethodGet, "/transactions?"+query.Encode(), nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, charge := range response.Data {
+			if !charge.CreatedAt.Before(from) && charge.CreatedAt.Before(to) {
+				charges = append(charges, charge.providerCharge())
+			}
+		}
+
+		if page >= response.Meta.PageInfo.TotalPages {
+			return charges, nil
+		}
+	}
+}
+
+func (c *HTTPFlutterwaveClient) WebhookSignature(header http.Header) string {
+	return header.Get("verif-hash")
+}
+
+func (c *HTTPFlutterwaveClient) ParseWebhook(body []byte, signature string) (ProviderWebhook, error) {
+	var event struct {
+		Event string          `json:"event"`
+		Data  json.RawMessage `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		return ProviderWebhook{}, err
+	}
+
+	var data struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return ProviderWebhook{}, err
+	}
+
+	webhook := ProviderWebhook{
+		EventID:        fmt.Sprintf("%s:%d", event.Event, data.ID),
+		EventType:      event.Event,
+		SignatureValid: subtle.ConstantTimeCompare([]byte(signature), []byte(c.webhookHash)) == 1,
+	}
+
+	switch event.Event {
+	case FlutterwaveChargeCompleted:
+		var charge FlutterwaveCharge
+		if err := json.Unmarshal(event.Data, &charge); err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindCharge
+		webhook.Charge = charge.providerCharge()
+	case FlutterwaveTransferCompleted:
+		var transfer FlutterwaveTransfer
+		if err := json.Unmarshal(event.Data, &transfer); err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindTransfer
+		webhook.Transfer = transfer.providerTransfer()
+	}
+
+	return webhook, nil
+}
+
+// Refund refunds a charge by our reference. Flutterwave refunds by its
+// own transaction id, so the charge is looked up first.
+func (c *HTTPFlutterwaveClient) Refund(ctx context.Context, reference string, amount Money) (ProviderRefund, error) {
+	charge, err := c.Verify(ctx, reference)
+	if err != nil {
+		return ProviderRefund{}, err
+	}
+
+	var response flutterwaveResponse[struct {
+		ID             int64             `json:"id"`
+		AmountRefunded flutterwaveAmount `json:"amount_refunded"`
+		Status         string            `json:"status"`
+	}]
+
+	err = c.do(ctx, http.MethodPost, "/transactions/"+url.PathEscape(charge.ID)+"/refund", map[string]any{
+		"amount": flutterwaveAmount(amount),
+	}, &response)
+
+	return ProviderRefund{
+		ID:        strconv.FormatInt(response.Data.ID, 10),
+		Reference: reference,
+		Amount:    Money(response.Data.AmountRefunded),
+		Status:    flutterwaveRefundStatus(response.Data.Status),
+	}, err
+}
+
+func flutterwaveRefundStatus(status string) string {
+	switch status {
+	case "completed":
+		return ProviderRefundProcessed
+	case "failed":
+		return ProviderRefundFailed
+	}
+	return ProviderRefundPending
+}
+
+// CreateTransferRecipient resolves the name on the account. Flutterwave
+// sends transfers straight to bank details, so they are the recipient
+// code.
+func (c *HTTPFlutterwaveClient) CreateTransferRecipient(ctx context.Context, account BankAccount) (TransferRecipient, error) {
+	var response flutterwaveResponse[struct {
+		AccountName string `json:"account_name"`
+	}]
+
+	err := c.do(ctx, http.MethodPost, "/accounts/resolve", map[string]any{
+		"account_number": account.AccountNumber,
+		"account_bank":   account.BankCode,
+	}, &response)
+
+	return TransferRecipient{Code: account.BankCode + ":" + account.AccountNumber, AccountName: response.Data.AccountName}, err
+}
+
+// Transfer sends money from our Flutterwave balance. Flutterwave won't
+// make two transfers with the same reference.
+func (c *HTTPFlutterwaveClient) Transfer(ctx context.Context, request TransferRequest) (ProviderTransfer, error) {
+	bankCode, accountNumber, ok := strings.Cut(request.RecipientCode, ":")
+	if !ok {
+		return ProviderTransfer{}, fmt.Errorf("%w: %q is not a flutterwave recipient", ErrFlutterwaveRequestFailed, request.RecipientCode)
+	}
+
+	var response flutterwaveResponse[FlutterwaveTransfer]
+
+	err := c.do(ctx, http.MethodPost, "/transfers", map[string]any{
+		"account_bank":   bankCode,
+		"account_number": accountNumber,
+		"amount":         flutterwaveAmount(request.Amount),
+		"currency":       "NGN",
+		"debit_currency": "NGN",
+		"reference":      request.Reference.String(),
+		"narration":      request.Reason,
+	}, &response)
+
+	return response.Data.providerTransfer(), err
+}
+
+func (c *HTTPFlutterwaveClient) VerifyTransfer(ctx context.Context, id string) (ProviderTransfer, error) {
+	var response flutterwaveResponse[FlutterwaveTransfer]
+	err := c.do(ctx, http.MethodGet, "/transfers/"+url.PathEscape(id), nil, &response)
+	return response.Data.providerTransfer(), err
+}
+
+func (c *HTTPFlutterwaveClient) do(ctx context.Context, method, path string, body any, response interface{ failure() error }) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.secretKey)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	result, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	if err := json.NewDecoder(result.Body).Decode(response); err != nil {
+		return fmt.Errorf("%w: %s returned an unreadable body (%s)", ErrFlutterwaveRequestFailed, path, result.Status)
+	}
+
+	if result.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s (%s)", ErrFlutterwaveRequestFailed, response.failure(), result.Status)
+	}
+
+	return response.failure()
+}
+
+func (r *flutterwaveResponse[T]) failure() error {
+	if r.Status == "success" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrFlutterwaveRequestFailed, r.Message)
+}
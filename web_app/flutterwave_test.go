@@ -0,0 +1,308 @@
+package web_app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewFakeFlutterwaveServer answers verification requests with the given
+// charges, keyed by tx_ref. It also makes payment links, refunds and
+// transfers, which stay new.
+func NewFakeFlutterwaveServer(t *testing.T, secretKey string, charges map[string]string) *httptest.Server {
+	t.Helper()
+
+	authorized := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Header.Get("Authorization") != "Bearer "+secretKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"status": "error", "message": "Invalid authorization key", "data": null}`)
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /transactions/verify_by_reference", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		charge, ok := charges[r.URL.Query().Get("tx_ref")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": "error", "message": "No transaction was found for this id", "data": null}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Transaction fetched successfully", "data": %s}`, charge)
+	})
+
+	// lists every charge on one page
+	mux.HandleFunc("GET /transactions", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var list []string
+		for _, charge := range charges {
+			list = append(list, charge)
+		}
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Transactions fetched", "data": [%s], "meta": {"page_info": {"total": %d, "current_page": 1, "total_pages": 1}}}`, strings.Join(list, ","), len(list))
+	})
+
+	mux.HandleFunc("POST /payments", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var body struct {
+			TxRef  string            `json:"tx_ref"`
+			Amount flutterwaveAmount `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Hosted Link", "data": {"link": "https://checkout.flutterwave.com/v3/hosted/pay/%s"}}`, body.TxRef)
+	})
+
+	mux.HandleFunc("POST /transactions/{id}/refund", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var body struct {
+			Amount json.Number `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Transaction refund initiated", "data": {"id": 75923, "amount_refunded": %s, "status": "completed"}}`, body.Amount)
+	})
+
+	mux.HandleFunc("POST /accounts/resolve", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var body struct {
+			AccountNumber string `json:"account_number"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Account details fetched", "data": {"account_number": %q, "account_name": "ADA LOVELACE"}}`, body.AccountNumber)
+	})
+
+	var transfers sync.Map
+	mux.HandleFunc("POST /transfers", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		var body struct {
+			AccountBank   string            `json:"account_bank"`
+			AccountNumber string            `json:"account_number"`
+			Amount        flutterwaveAmount `json:"amount"`
+			Reference     string            `json:"reference"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if body.AccountBank == "" || body.AccountNumber == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": "error", "message": "Invalid account", "data": null}`)
+			return
+		}
+
+		amount, _ := json.Marshal(body.Amount)
+		transfer := fmt.Sprintf(`{"id": 190626, "reference": %q, "amount": %s, "status": "NEW", "complete_message": ""}`, body.Reference, amount)
+		transfers.Store("190626", transfer)
+		fmt.Fprintf(w, `{"status": "success", "message": "Transfer Queued Successfully", "data": %s}`, transfer)
+	})
+
+	mux.HandleFunc("GET /transfers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r) {
+			return
+		}
+
+		transfer, ok := transfers.Load(r.PathValue("id"))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": "error", "message": "No transfer found", "data": null}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": "success", "message": "Transfer fetched", "data": %s}`, transfer)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFlutterwaveClient(t *testing.T) {
+	reference := uuid.New()
+	server := NewFakeFlutterwaveServer(t, "FLWSECK_TEST", map[string]string{
+		reference.String(): fmt.Sprintf(`{"id": 288200108, "tx_ref": %q, "flw_ref": "FLW-MOCK-1", "amount": 5000.5, "currency": "NGN", "status": "successful", "processor_response": "Approved by Financial Institution", "created_at": "2026-10-18T09:30:00.000Z"}`, reference),
+		"outside the day":  `{"id": 288200109, "tx_ref": "outside the day", "amount": 100, "currency": "NGN", "status": "successful", "created_at": "2026-10-17T23:59:00.000Z"}`,
+	})
+	client := NewFlutterwaveClientWithBaseURL(server.URL, "FLWSECK_TEST", "hash", server.Client())
+
+	t.Run("verifies a transaction in kobo", func(t *testing.T) {
+		charge, err := client.Verify(context.Background(), reference.String())
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if charge.Amount != 500050 || charge.Status != ChargeSuccessful || charge.ID != "288200108" || charge.Reference != reference.String() {
+			t.Errorf("unexpected charge %+v", charge)
+		}
+	})
+
+	t.Run("lists the charges made in a day", func(t *testing.T) {
+		from := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+		charges, err := client.ListCharges(context.Background(), from, from.AddDate(0, 0, 1))
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if len(charges) != 1 || charges[0].Reference != reference.String() {
+			t.Errorf("expected only the charge made that day, got %+v", charges)
+		}
+	})
+
+	t.Run("makes a payment link", func(t *testing.T) {
+		authorization, err := client.Initialize(context.Background(), PaymentRequest{ReferenceNumber: reference, Amount: 500050, Email: "ada@example.com"})
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if authorization.AuthorizationURL != "https://checkout.flutterwave.com/v3/hosted/pay/"+reference.String() {
+			t.Errorf("unexpected authorization %+v", authorization)
+		}
+	})
+
+	t.Run("refunds by our reference", func(t *testing.T) {
+		refund, err := client.Refund(context.Background(), reference.String(), 100000)
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if refund.Amount != 100000 || refund.Reference != reference.String() || refund.Status != ProviderRefundProcessed {
+			t.Errorf("unexpected refund %+v", refund)
+		}
+	})
+
+	t.Run("sends a transfer to a resolved account", func(t *testing.T) {
+		recipient, err := client.CreateTransferRecipient(context.Background(), BankAccount{BankCode: "044", AccountNumber: "0690000031"})
+
+		if err != nil || recipient.Code != "044:0690000031" || recipient.AccountName != "ADA LOVELACE" {
+			t.Fatalf("unexpected recipient %+v (%v)", recipient, err)
+		}
+
+		payout := uuid.New()
+		transfer, err := client.Transfer(context.Background(), TransferRequest{Reference: payout, RecipientCode: recipient.Code, Amount: 400050})
+		if err != nil || transfer.ID != "190626" || transfer.Status != TransferPending {
+			t.Fatalf("unexpected transfer %+v (%v)", transfer, err)
+		}
+
+		verified, err := client.VerifyTransfer(context.Background(), transfer.ID)
+		if err != nil || verified.Reference != payout.String() || verified.Amount != 400050 {
+			t.Errorf("unexpected transfer %+v (%v)", verified, err)
+		}
+
+		if _, err := client.Transfer(context.Background(), TransferRequest{Reference: payout, RecipientCode: "RCP_paystack"}); !errors.Is(err, ErrFlutterwaveRequestFailed) {
+			t.Errorf("expected another provider's recipient to be turned away, got %v", err)
+		}
+	})
+
+	t.Run("reports Flutterwave's failures", func(t *testing.T) {
+		if _, err := client.Verify(context.Background(), "unknown"); !errors.Is(err, ErrFlutterwaveRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrFlutterwaveRequestFailed, err)
+		}
+
+		wrongKey := NewFlutterwaveClientWithBaseURL(server.URL, "FLWSECK_WRONG", "hash", server.Client())
+		if _, err := wrongKey.Verify(context.Background(), reference.String()); !errors.Is(err, ErrFlutterwaveRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrFlutterwaveRequestFailed, err)
+		}
+	})
+}
+
+func TestFlutterwaveWebhooks(t *testing.T) {
+	client := NewFlutterwaveClient("FLWSECK_TEST", "hash")
+	body := []byte(`{"event": "charge.completed", "data": {"id": 285959875, "tx_ref": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 100, "currency": "NGN", "status": "successful"}}`)
+
+	t.Run("reads a charge sent with our hash", func(t *testing.T) {
+		webhook, err := client.ParseWebhook(body, "hash")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if !webhook.SignatureValid || webhook.Kind != WebhookKindCharge || webhook.EventID != "charge.completed:285959875" {
+			t.Errorf("unexpected webhook %+v", webhook)
+		}
+
+		if webhook.Charge.Amount != 10000 || webhook.Charge.Status != ChargeSuccessful {
+			t.Errorf("unexpected charge %+v", webhook.Charge)
+		}
+	})
+
+	t.Run("reports a wrong hash", func(t *testing.T) {
+		if webhook, _ := client.ParseWebhook(body, "not the hash"); webhook.SignatureValid {
+			t.Error("expected the signature to be invalid")
+		}
+	})
+
+	t.Run("maps failed charges", func(t *testing.T) {
+		webhook, _ := client.ParseWebhook([]byte(`{"event": "charge.completed", "data": {"id": 1, "amount": 100, "status": "failed"}}`), "hash")
+
+		if webhook.Charge.Status != ChargeFailed {
+			t.Errorf("expected a failed charge, got %q", webhook.Charge.Status)
+		}
+	})
+}
+
+func TestFlutterwaveTransferWebhooks(t *testing.T) {
+	client := NewFlutterwaveClient("FLWSECK_TEST", "hash")
+
+	webhook, err := client.ParseWebhook([]byte(`{"event": "transfer.completed", "data": {"id": 190626, "reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 4000.5, "status": "FAILED", "complete_message": "Account resolve failed"}}`), "hash")
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+
+	if webhook.Kind != WebhookKindTransfer || webhook.EventID != "transfer.completed:190626" {
+		t.Errorf("unexpected webhook %+v", webhook)
+	}
+
+	if webhook.Transfer.Status != TransferFailed || webhook.Transfer.Amount != 400050 || webhook.Transfer.FailureReason != "Account resolve failed" {
+		t.Errorf("unexpected transfer %+v", webhook.Transfer)
+	}
+}
+
+func TestFlutterwaveAmount(t *testing.T) {
+	amount := flutterwaveAmount(125050)
+
+	encoded, _ := json.Marshal(amount)
+	if string(encoded) != "1250.50" {
+		t.Errorf("expected 1250.50, got %s", encoded)
+	}
+
+	var decoded flutterwaveAmount
+	if err := json.Unmarshal([]byte("1250.5"), &decoded); err != nil || decoded != amount {
+		t.Errorf("expected %d, got %d (%v)", amount, decoded, err)
+	}
+
+	if err := json.Unmarshal([]byte("12.505"), &decoded); err == nil {
+		t.Error("expected fractions of a kobo to be rejected")
+	}
+}
@@ -0,0 +1,135 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// The payment originators match payment_originator_type. The
+// originator of a payment decides what it gets credited to.
+const (
+	OriginatorSoloSavings   = "SOLO_SAVINGS"
+	OriginatorTargetSavings = "TARGET_SAVINGS"
+	OriginatorFamilySavings = "FAMILY_SAVINGS"
+	OriginatorLoanRepayment = "LOAN_REPAYMENT"
+	OriginatorInvestments   = "INVESTMENTS"
+)
+
+const (
+	StatusSuccessful = "SUCCESSFUL"
+	StatusPending    = "PENDING"
+	StatusFailed     = "FAILED"
+)
+
+var (
+	ErrNoFulfiller             = errors.New("no fulfiller for this payment originator")
+	ErrFulfillmentTargetAbsent = errors.New("the account or plan this payment is for does not exist")
+	ErrPaymentNotVerified      = errors.New("the payment failed verification and cannot be fulfilled")
+)
+
+// FulfillmentStore is the part of the store that the dispatcher
+// needs. Each Fulfill method credits a verified payment to its
+// account or plan, posts the journal and marks the payment fulfilled
+// in one database transaction.
+type FulfillmentStore interface {
+	GetPaystackVerificationInformation(referenceNumber string) (PaystackTransactionInformation, error)
+	MarkPaymentVerified(referenceNumber uuid.UUID) error
+	RecordFulfillmentFailure(referenceNumber uuid.UUID, reason string) error
+	FulfillSoloSavingsPayment(payment PaystackTransactionInformation) error
+	FulfillTargetSavingsPayment(payment PaystackTransactionInformation) error
+	FulfillFamilyVaultPayment(payment PaystackTransactionInformation) error
+	FulfillLoanRepayment(payment PaystackTransactionInformation) error
+	FulfillInvestmentPayment(payment PaystackTransactionInformation) error
+}
+
+// Fulfiller credits a verified payment to whatever it was paying for
+type Fulfiller func(payment PaystackTransactionInformation) error
+
+// FulfillmentDispatcher routes a successful payment to the fulfiller
+// for its originator. Verification (did the money arrive?) and
+// fulfillment (did we credit it?) are recorded separately, so that a
+// payment that arrived but couldn't be credited can be retried.
+type FulfillmentDispatcher struct {
+	store      FulfillmentStore
+	fulfillers map[string]Fulfiller
+}
+
+func NewFulfillmentDispatcher(store FulfillmentStore) *FulfillmentDispatcher {
+	return &FulfillmentDispatcher{
+		store: store,
+		fulfillers: map[string]Fulfiller{
+			OriginatorSoloSavings:   store.FulfillSoloSavingsPayment,
+			OriginatorTargetSavings: store.FulfillTargetSavingsPayment,
+			OriginatorFamilySavings: store.FulfillFamilyVaultPayment,
+			OriginatorLoanRepayment: store.FulfillLoanRepayment,
+			OriginatorInvestments:   store.FulfillInvestmentPayment,
+		},
+	}
+}
+
+// Dispatch fulfills the payment with the given reference. Payments
+// that have already been fulfilled are left alone, so it is safe to
+// call again when Paystack retries a webhook.
+func (d *FulfillmentDispatcher) Dispatch(referenceNumber uuid.UUID, paidAmount Money) error {
+	payment, err := d.store.GetPaystackVerificationInformation(referenceNumber.String())
+	if err != nil {
+		return err
+	}
+
+	if payment.FulfillmentStatus == StatusSuccessful {
+		return nil
+	}
+
+	if payment.VerificationStatus == StatusFailed {
+		return ErrPaymentNotVerified
+	}
+
+	// the amount was set when the payment was initialized, and
+	// nothing else gets credited
+	if paidAmount != payment.PaymentAmount {
+		return fmt.Errorf("%w: expected %s, paid %s", ErrChargeAmountMismatch, payment.PaymentAmount, paidAmount)
+	}
+
+	if payment.VerificationStatus == StatusPending {
+		if err := d.store.MarkPaymentVerified(referenceNumber); err != nil {
+			return err
+		}
+		payment.VerificationStatus = StatusSuccessful
+	}
+
+	fulfiller, ok := d.fulfillers[payment.PaymentOriginator]
+	if !ok {
+		return d.fail(referenceNumber, fmt.Errorf("%w: %q", ErrNoFulfiller, payment.PaymentOriginator))
+	}
+
+	// the journal is keyed by the payment, so it having been posted
+	// means the payment was fulfilled in the meantime, e.g. by the
+	// reconciler racing a webhook
+	if err := fulfiller(payment); errors.Is(err, ErrJournalAlreadyPosted) {
+		return nil
+	} else if err != nil {
+		return d.fail(referenceNumber, err)
+	}
+
+	return nil
+}
+
+// fail records why the fulfillment failed and hands the error back
+func (d *FulfillmentDispatcher) fail(referenceNumber uuid.UUID, reason error) error {
+	if err := d.store.RecordFulfillmentFailure(referenceNumber, reason.Error()); err != nil {
+		return fmt.Errorf("%w (and recording the failure failed: %s)", reason, err)
+	}
+	return reason
+}
+
+// fulfillmentBalanceError tells a balance that isn't there, which
+// means the payment can't be fulfilled, apart from the database
+// failing, which is worth trying again
+func fulfillmentBalanceError(err error) error {
+	if err == ErrInsufficientLedgerFund {
+		return ErrFulfillmentTargetAbsent
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package web_app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// FakeFulfillmentStore records which fulfiller a payment was sent to
+type FakeFulfillmentStore struct {
+	payments  map[string]PaystackTransactionInformation
+	fulfilled []string
+	failures  map[string]string
+	failWith  error
+}
+
+func NewFakeFulfillmentStore(payments ...PaystackTransactionInformation) *FakeFulfillmentStore {
+	store := &FakeFulfillmentStore{payments: map[string]PaystackTransactionInformation{}, failures: map[string]string{}}
+	for _, payment := range payments {
+		store.payments[payment.ReferenceNumber.String()] = payment
+	}
+	return store
+}
+
+func (f *FakeFulfillmentStore) GetPaystackVerificationInformation(referenceNumber string) (PaystackTransactionInformation, error) {
+	payment, ok := f.payments[referenceNumber]
+	if !ok {
+		return payment, ErrReferenceNumberDoesNotExist
+	}
+	return payment, nil
+}
+
+func (f *FakeFulfillmentStore) MarkPaymentVerified(referenceNumber uuid.UUID) error {
+	payment := f.payments[referenceNumber.String()]
+	payment.VerificationStatus = StatusSuccessful
+	f.payments[referenceNumber.String()] = payment
+	return nil
+}
+
+func (f *FakeFulfillmentStore) RecordFulfillmentFailure(referenceNumber uuid.UUID, reason string) error {
+	f.failures[referenceNumber.String()] = reason
+	return nil
+}
+
+func (f *FakeFulfillmentStore) RecordVerificationFailure(referenceNumber uuid.UUID, reason string) error {
+	payment := f.payments[referenceNumber.String()]
+	payment.VerificationStatus = StatusFailed
+	payment.VerificationFailureReason = reason
+	f.payments[referenceNumber.String()] = payment
+	return nil
+}
+
+func (f *FakeFulfillmentStore) fulfill(originator string, payment PaystackTransactionInformation) error {
+	if f.failWith != nil {
+		return f.failWith
+	}
+	f.fulfilled = append(f.fulfilled, originator)
+	payment.FulfillmentStatus = StatusSuccessful
+	f.payments[payment.ReferenceNumber.String()] = payment
+	return nil
+}
+
+func (f *FakeFulfillmentStore) FulfillSoloSavingsPayment(payment PaystackTransactionInformation) error {
+	return f.fulfill(OriginatorSoloSavings, payment)
+}
+
+func (f *FakeFulfillmentStore) FulfillTargetSavingsPayment(payment PaystackTransactionInformation) error {
+	return f.fulfill(OriginatorTargetSavings, payment)
+}
+
+func (f *FakeFulfillmentStore) FulfillFamilyVaultPayment(payment PaystackTransactionInformation) error {
+	return f.fulfill(OriginatorFamilySavings, payment)
+}
+
+func (f *FakeFulfillmentStore) FulfillLoanRepayment(payment PaystackTransactionInformation) error {
+	return f.fulfill(OriginatorLoanRepayment, payment)
+}
+
+func (f *FakeFulfillmentStore) FulfillInvestmentPayment(payment PaystackTransactionInformation) error {
+	return f.fulfill(OriginatorInvestments, payment)
+}
+
+func pendingPayment(originator string) PaystackTransactionInformation {
+	return PaystackTransactionInformation{
+		CustomerID:         1,
+		PlanID:             7,
+		ReferenceNumber:    uuid.New(),
+		PaymentOriginator:  originator,
+		PaymentAmount:      500000,
+		PaymentProvider:    ProviderSandbox,
+		FulfillmentStatus:  StatusPending,
+		VerificationStatus: StatusPending,
+	}
+}
+
+func TestFulfillmentDispatcher(t *testing.T) {
+	t.Run("routes every originator to its own fulfiller", func(t *testing.T) {
+		for _, originator := range []string{OriginatorSoloSavings, OriginatorTargetSavings, OriginatorFamilySavings, OriginatorLoanRepayment, OriginatorInvestments} {
+			payment := pendingPayment(originator)
+			store := NewFakeFulfillmentStore(payment)
+
+			if err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount); err != nil {
+				t.Fatalf("%s: did not expect an error, got %q", originator, err)
+			}
+
+			if len(store.fulfilled) != 1 || store.fulfilled[0] != originator {
+				t.Errorf("%s: payment went to %v", originator, store.fulfilled)
+			}
+		}
+	})
+
+	t.Run("records verification before fulfilling", func(t *testing.T) {
+		payment := pendingPayment(OriginatorFamilySavings)
+		store := NewFakeFulfillmentStore(payment)
+
+		NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount)
+
+		got := store.payments[payment.ReferenceNumber.String()]
+		if got.VerificationStatus != StatusSuccessful {
+			t.Errorf("expected the payment to be verified, got %+v", got)
+		}
+	})
+
+	t.Run("only credits the amount that was initialized", func(t *testing.T) {
+		payment := pendingPayment(OriginatorFamilySavings)
+		store := NewFakeFulfillmentStore(payment)
+
+		err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, 480000)
+
+		if !errors.Is(err, ErrChargeAmountMismatch) {
+			t.Errorf("expected %q, got %v", ErrChargeAmountMismatch, err)
+		}
+
+		got := store.payments[payment.ReferenceNumber.String()]
+		if got.VerificationStatus != StatusPending || len(store.fulfilled) != 0 {
+			t.Errorf("expected the payment to be left alone, got %+v", got)
+		}
+	})
+
+	t.Run("does not fulfill a payment twice", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeFulfillmentStore(payment)
+		dispatcher := NewFulfillmentDispatcher(store)
+
+		dispatcher.Dispatch(payment.ReferenceNumber, payment.PaymentAmount)
+		dispatcher.Dispatch(payment.ReferenceNumber, payment.PaymentAmount)
+
+		if len(store.fulfilled) != 1 {
+			t.Errorf("expected one fulfillment, got %d", len(store.fulfilled))
+		}
+	})
+
+	t.Run("leaves a payment fulfilled while it was being fulfilled alone", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeFulfillmentStore(payment)
+		store.failWith = ErrJournalAlreadyPosted
+
+		if err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+
+		if len(store.failures) != 0 {
+			t.Errorf("did not expect a failure to be recorded, got %v", store.failures)
+		}
+	})
+
+	t.Run("records a fulfillment failure separately from verification", func(t *testing.T) {
+		payment := pendingPayment(OriginatorTargetSavings)
+		store := NewFakeFulfillmentStore(payment)
+		store.failWith = ErrFulfillmentTargetAbsent
+
+		err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount)
+
+		if err != ErrFulfillmentTargetAbsent {
+			t.Errorf("expected %q, got %v", ErrFulfillmentTargetAbsent, err)
+		}
+
+		if store.failures[payment.ReferenceNumber.String()] != ErrFulfillmentTargetAbsent.Error() {
+			t.Errorf("expected the failure reason to be recorded, got %v", store.failures)
+		}
+
+		if store.payments[payment.ReferenceNumber.String()].VerificationStatus != StatusSuccessful {
+			t.Error("expected the payment to stay verified")
+		}
+	})
+
+	t.Run("fails payments with an unknown originator", func(t *testing.T) {
+		payment := pendingPayment("THRIFT")
+		store := NewFakeFulfillmentStore(payment)
+
+		err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount)
+
+		if !errors.Is(err, ErrNoFulfiller) {
+			t.Errorf("expected %q, got %v", ErrNoFulfiller, err)
+		}
+
+		if store.failures[payment.ReferenceNumber.String()] == "" {
+			t.Error("expected the failure to be recorded")
+		}
+	})
+
+	t.Run("does not fulfill payments that failed verification", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.VerificationStatus = StatusFailed
+		store := NewFakeFulfillmentStore(payment)
+
+		if err := NewFulfillmentDispatcher(store).Dispatch(payment.ReferenceNumber, payment.PaymentAmount); err != ErrPaymentNotVerified {
+			t.Errorf("expected %q, got %v", ErrPaymentNotVerified, err)
+		}
+	})
+
+	t.Run("reports unknown references", func(t *testing.T) {
+		store := NewFakeFulfillmentStore()
+
+		if err := NewFulfillmentDispatcher(store).Dispatch(uuid.New(), 100); err != ErrReferenceNumberDoesNotExist {
+			t.Errorf("expected %q, got %v", ErrReferenceNumberDoesNotExist, err)
+		}
+	})
+}
+
+func TestFulfillmentBalanceError(t *testing.T) {
+	if err := fulfillmentBalanceError(ErrInsufficientLedgerFund); err != ErrFulfillmentTargetAbsent {
+		t.Errorf("a missing balance got %v, want %v", err, ErrFulfillmentTargetAbsent)
+	}
+
+	databaseDown := errors.New("connection refused")
+	if err := fulfillmentBalanceError(databaseDown); err != databaseDown || unfulfillable(err) {
+		t.Errorf("a database failure got %v, and should be tried again", err)
+	}
+}
@@ -0,0 +1,250 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Larger loans need someone to guarantee them. Applicants nominate
+// guarantors by email or phone number, and each one is sent a link to
+// an invitation that they have to log in to answer. There isn't an SMS
+// provider yet, so guarantors nominated by phone number find their
+// invitations at /dashboard/guarantees once they log in. Guarantors can
+// put some of their savings on hold against the loan, which they can't
+// withdraw until the loan is repaid or the application is rejected.
+// An application can't be approved until enough guarantors have agreed.
+
+const (
+	GuarantorInvited  = "INVITED"
+	GuarantorAccepted = "ACCEPTED"
+	GuarantorDeclined = "DECLINED"
+)
+
+const (
+	AuditLoanGuarantorInvited   = "LOAN_GUARANTOR_INVITED"
+	AuditLoanGuarantorResponded = "LOAN_GUARANTOR_RESPONDED"
+)
+
+// guarantorThreshold is the smallest loan that needs a guarantor
+const guarantorThreshold Money = 50000000
+
+// maxGuarantors is how many guarantors an application can have
+const maxGuarantors = 3
+
+var (
+	ErrGuarantorRequired        = fmt.Errorf("loans of %s or more need a guarantor", guarantorThreshold)
+	ErrInvalidGuarantorContact  = errors.New("enter your guarantor's email address or 11 digit phone number")
+	ErrOwnGuarantor             = errors.New("you can't be your own guarantor")
+	ErrTooManyGuarantors        = fmt.Errorf("an application can have at most %d guarantors", maxGuarantors)
+	ErrGuarantorNominated       = errors.New("you've already nominated that guarantor")
+	ErrGuarantorsClosed         = errors.New("guarantors can only be nominated before the application is approved")
+	ErrGuarantorConsentRequired = errors.New("the application doesn't have enough guarantors that have agreed to it yet")
+	ErrGuaranteeDoesNotExist    = errors.New("the invitation doesn't exist")
+	ErrGuaranteeNotForCustomer  = errors.New("this invitation was sent to someone else. Log in with the email address or phone number it was sent to")
+	ErrGuaranteeAnswered        = errors.New("this invitation has already been answered")
+	ErrGuaranteeClosed          = errors.New("this application has ended")
+	ErrHoldTooLarge             = errors.New("you can't put more on hold than you have free in your savings")
+)
+
+// LoanGuarantor is someone nominated to guarantee a loan application
+type LoanGuarantor struct {
+	ID            uint
+	ApplicationID uint
+	// Contact is the email address or phone number they were nominated by
+	Contact string
+	// Token is the secret in the link to their invitation
+	Token  string
+	Status string
+	// CustomerID is the customer that answered the invitation
+	CustomerID uint
+	// Hold is the savings they put on hold against the loan
+	Hold        Money
+	RespondedAt time.Time
+	CreatedAt   time.Time
+}
+
+// LoanGuarantee is an invitation with the application it is for
+type LoanGuarantee struct {
+	LoanGuarantor
+	ApplicantID       uint
+	ApplicantName     string
+	Amount            Money
+	DurationInDays    uint64
+	ApplicationStatus string
+}
+
+// Open is true while the guarantor can still answer the invitation
+func (g LoanGuarantee) Open() bool {
+	switch g.ApplicationStatus {
+	case LoanApplicationActive, LoanApplicationDefaulted:
+		return false
+	}
+	return g.Status == GuarantorInvited && (LoanApplication{Status: g.ApplicationStatus}).InProgress()
+}
+
+type GuarantorStore interface {
+	// AddLoanGuarantors nominates more guarantors for a customer's
+	// application that is in progress
+	AddLoanGuarantors(customerID, applicationID uint, contacts []string) ([]LoanGuarantor, error)
+	GetLoanGuarantors(applicationID uint) ([]LoanGuarantor, error)
+	GetLoanGuarantee(token string) (LoanGuarantee, error)
+	// GetOpenLoanGuarantees is the invitations sent to any of contacts
+	// that can still be answered, newest first
+	GetOpenLoanGuarantees(contacts []string) ([]LoanGuarantee, error)
+	// RespondToLoanGuarantee records a customer's answer to the
+	// invitation with token, and puts hold of their solo savings on
+	// hold if they accept
+	RespondToLoanGuarantee(token string, customerID uint, accept bool, hold Money) (LoanGuarantor, error)
+}
+
+// guarantorsRequired is how many guarantors have to agree to a loan
+// of amount
+func guarantorsRequired(amount Money) int {
+	if amount >= guarantorThreshold {
+		return 1
+	}
+	return 0
+}
+
+// normalizeGuarantorContact is an email address in lowercase, or a
+// Nigerian phone number in its 11 digit local form
+func normalizeGuarantorContact(contact string) (string, error) {
+	contact = strings.TrimSpace(contact)
+	if strings.Contains(contact, "@") {
+		if !validateEmail(contact) {
+			return "", ErrInvalidGuarantorContact
+		}
+		return strings.ToLower(contact), nil
+	}
+
+	phoneNumber := normalizePhoneNumber(contact)
+	if len(phoneNumber) != 11 || phoneNumber[0] != '0' {
+		return "", ErrInvalidGuarantorContact
+	}
+	return phoneNumber, nil
+}
+
+// normalizePhoneNumber takes the punctuation out of a phone number, and
+// writes +234 numbers the local way
+func normalizePhoneNumber(phoneNumber string) string {
+	var digits strings.Builder
+	for _, r := range phoneNumber {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+
+	normalized := digits.String()
+	if strings.HasPrefix(normalized, "234") && len(normalized) == 13 {
+		normalized = "0" + normalized[3:]
+	}
+	return normalized
+}
+
+// guarantorContacts reads the guarantors nominated in a form, leaving
+// out the blanks, and checks that none of them is the applicant
+func guarantorContacts(contacts []string, applicant CustomerContact) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, contact := range contacts {
+		if strings.TrimSpace(contact) == "" {
+			continue
+		}
+
+		contact, err := normalizeGuarantorContact(contact)
+		if err != nil {
+			return nil, err
+		}
+		if isGuarantor(applicant, contact) {
+			return nil, ErrOwnGuarantor
+		}
+		if seen[contact] {
+			return nil, ErrGuarantorNominated
+		}
+		seen[contact] = true
+		normalized = append(normalized, contact)
+	}
+
+	if len(normalized) > maxGuarantors {
+		return nil, ErrTooManyGuarantors
+	}
+	return normalized, nil
+}
+
+// guarantorFields is what to fill the form's guarantor fields with
+func guarantorFields(contacts []string) []string {
+	fields := make([]string, maxGuarantors)
+	copy(fields, contacts)
+	return fields
+}
+
+// isGuarantor is true when contact, as normalizeGuarantorContact has
+// it, is one of customer's
+func isGuarantor(customer CustomerContact, contact string) bool {
+	if strings.EqualFold(customer.Email, contact) {
+		return true
+	}
+	return customer.PhoneNumber != "" && normalizePhoneNumber(customer.PhoneNumber) == contact
+}
+
+// customerGuarantorContacts are the contacts that customer could have
+// been nominated by, as normalizeGuarantorContact has them
+func customerGuarantorContacts(customer CustomerContact) []string {
+	var contacts []string
+	if customer.Email != "" {
+		contacts = append(contacts, strings.ToLower(customer.Email))
+	}
+	if customer.PhoneNumber != "" {
+		contacts = append(contacts, normalizePhoneNumber(customer.PhoneNumber))
+	}
+	return contacts
+}
+
+// checkGuaranteeResponse checks that customer, who can be reached at
+// contact, can answer guarantee
+func checkGuaranteeResponse(guarantee LoanGuarantee, customerID uint, contact CustomerContact) error {
+	switch {
+	case guarantee.Status != GuarantorInvited:
+		return ErrGuaranteeAnswered
+	case !guarantee.Open():
+		return ErrGuaranteeClosed
+	case guarantee.ApplicantID == customerID:
+		return ErrOwnGuarantor
+	case !isGuarantor(contact, guarantee.Contact):
+		return ErrGuaranteeNotForCustomer
+	}
+	return nil
+}
+
+// guarantorInvitation is what guarantor is sent on the channel their
+// contact is for
+func guarantorInvitation(applicant CustomerContact, application LoanApplication, guarantor LoanGuarantor, baseURL string) Notification {
+	body := fmt.Sprintf("%s has asked you to guarantee their %s loan from Paz. If they don't repay it, you'll be liable for it. Log in or sign up with this email address or phone number, then go to %s/dashboard/guarantees/%s to agree or decline.",
+		applicant.FirstName, application.Amount, baseURL, guarantor.Token)
+
+	if strings.Contains(guarantor.Contact, "@") {
+		return Notification{Channel: NotificationEmail, To: guarantor.Contact, Subject: fmt.Sprintf("%s has asked you to guarantee a loan", applicant.FirstName), Body: body}
+	}
+	return Notification{Channel: NotificationSMS, To: guarantor.Contact, Body: body}
+}
+
+// inviteLoanGuarantors sends guarantors their invitations. Every one is
+// tried, and the first failure is returned. Invitations on a channel
+// without a provider are left for the guarantor to find once they log
+// in.
+func inviteLoanGuarantors(ctx context.Context, notifier Notifier, applicant CustomerContact, application LoanApplication, guarantors []LoanGuarantor, baseURL string) error {
+	var failed error
+	for _, guarantor := range guarantors {
+		if guarantor.Status != GuarantorInvited {
+			continue
+		}
+		err := notifier.Notify(ctx, guarantorInvitation(applicant, application, guarantor, baseURL))
+		if err != nil && err != ErrNotificationNotSent && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
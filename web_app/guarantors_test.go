@@ -0,0 +1,156 @@
+package web_app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeGuarantorContact(t *testing.T) {
+	for contact, want := range map[string]string{
+		" Tunde@Example.com ": "tunde@example.com",
+		"0803 123 4567":       "08031234567",
+		"+234 803-123-4567":   "08031234567",
+		"2348031234567":       "08031234567",
+	} {
+		if got, err := normalizeGuarantorContact(contact); err != nil || got != want {
+			t.Errorf("%q: got %q %v, want %q", contact, got, err, want)
+		}
+	}
+
+	for _, contact := range []string{"tunde@", "12345", "18031234567", "call me"} {
+		if _, err := normalizeGuarantorContact(contact); err != ErrInvalidGuarantorContact {
+			t.Errorf("%q: got %v, want %v", contact, err, ErrInvalidGuarantorContact)
+		}
+	}
+}
+
+func TestGuarantorContacts(t *testing.T) {
+	applicant := CustomerContact{FirstName: "Ada", Email: "ada@example.com", PhoneNumber: "+2348012345678"}
+
+	contacts, err := guarantorContacts([]string{"", "Tunde@example.com", " ", "0803 123 4567"}, applicant)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+	if len(contacts) != 2 || contacts[0] != "tunde@example.com" || contacts[1] != "08031234567" {
+		t.Errorf("got %q", contacts)
+	}
+
+	for name, test := range map[string]struct {
+		contacts []string
+		want     error
+	}{
+		"the applicant's email":    {[]string{"ADA@example.com"}, ErrOwnGuarantor},
+		"the applicant's phone":    {[]string{"08012345678"}, ErrOwnGuarantor},
+		"the same guarantor twice": {[]string{"08031234567", "+2348031234567"}, ErrGuarantorNominated},
+		"too many guarantors":      {[]string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}, ErrTooManyGuarantors},
+	} {
+		if _, err := guarantorContacts(test.contacts, applicant); err != test.want {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
+
+func TestCustomerGuarantorContacts(t *testing.T) {
+	contacts := customerGuarantorContacts(CustomerContact{Email: "Tunde@Example.com", PhoneNumber: "+234 803 123 4567"})
+	if len(contacts) != 2 || contacts[0] != "tunde@example.com" || contacts[1] != "08031234567" {
+		t.Errorf("got %q", contacts)
+	}
+
+	for _, contact := range contacts {
+		normalized, err := normalizeGuarantorContact(contact)
+		if err != nil || normalized != contact {
+			t.Errorf("%q isn't how a guarantor would be nominated: %q, %v", contact, normalized, err)
+		}
+	}
+}
+
+func TestGuarantorsRequired(t *testing.T) {
+	if got := guarantorsRequired(guarantorThreshold - 1); got != 0 {
+		t.Errorf("got %d guarantors under the threshold, want 0", got)
+	}
+	if got := guarantorsRequired(guarantorThreshold); got != 1 {
+		t.Errorf("got %d guarantors at the threshold, want 1", got)
+	}
+}
+
+func TestCheckGuaranteeResponse(t *testing.T) {
+	guarantor := CustomerContact{Email: "tunde@example.com", PhoneNumber: "08031234567"}
+	newGuarantee := func() LoanGuarantee {
+		return LoanGuarantee{
+			LoanGuarantor:     LoanGuarantor{Contact: "08031234567", Status: GuarantorInvited},
+			ApplicantID:       1,
+			ApplicationStatus: LoanApplicationUnderReview,
+		}
+	}
+
+	if err := checkGuaranteeResponse(newGuarantee(), 2, guarantor); err != nil {
+		t.Errorf("did not expect an error, got %q", err)
+	}
+
+	answered := newGuarantee()
+	answered.Status = GuarantorDeclined
+	closed := newGuarantee()
+	closed.ApplicationStatus = LoanApplicationRejected
+
+	for name, test := range map[string]struct {
+		guarantee  LoanGuarantee
+		customerID uint
+		contact    CustomerContact
+		want       error
+	}{
+		"already answered":  {answered, 2, guarantor, ErrGuaranteeAnswered},
+		"ended application": {closed, 2, guarantor, ErrGuaranteeClosed},
+		"the applicant":     {newGuarantee(), 1, guarantor, ErrOwnGuarantor},
+		"someone else":      {newGuarantee(), 3, CustomerContact{Email: "bola@example.com"}, ErrGuaranteeNotForCustomer},
+	} {
+		if err := checkGuaranteeResponse(test.guarantee, test.customerID, test.contact); err != test.want {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
+
+func TestInviteLoanGuarantors(t *testing.T) {
+	applicant := CustomerContact{FirstName: "Ada", Email: "ada@example.com"}
+	application := LoanApplication{ID: 1, Amount: guarantorThreshold}
+	guarantors := []LoanGuarantor{
+		{Contact: "tunde@example.com", Token: "email-token", Status: GuarantorInvited},
+		{Contact: "08031234567", Token: "sms-token", Status: GuarantorInvited},
+		{Contact: "bola@example.com", Token: "answered-token", Status: GuarantorAccepted},
+	}
+
+	notifier := &FakeNotifier{}
+	if err := inviteLoanGuarantors(context.Background(), notifier, applicant, application, guarantors, "https://paz.test"); err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+
+	if len(notifier.sent) != 2 {
+		t.Fatalf("expected only the guarantors that haven't answered to be invited, got %+v", notifier.sent)
+	}
+	if sent := notifier.sent[0]; sent.Channel != NotificationEmail || sent.To != "tunde@example.com" || !strings.Contains(sent.Body, "https://paz.test/dashboard/guarantees/email-token") {
+		t.Errorf("got %+v", sent)
+	}
+	if sent := notifier.sent[1]; sent.Channel != NotificationSMS || sent.To != "08031234567" || !strings.Contains(sent.Body, "Ada") {
+		t.Errorf("got %+v", sent)
+	}
+
+	t.Run("leaves invitations without a provider to be found on the dashboard", func(t *testing.T) {
+		email := &FakeNotifier{}
+		if err := inviteLoanGuarantors(context.Background(), Notifiers{NotificationEmail: email}, applicant, application, guarantors, "https://paz.test"); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+		if len(email.sent) != 1 || email.sent[0].To != "tunde@example.com" {
+			t.Errorf("got %+v", email.sent)
+		}
+	})
+
+	t.Run("tries every guarantor when one can't be reached", func(t *testing.T) {
+		notifier := &FakeNotifier{failing: map[string]bool{NotificationEmail: true}}
+		if err := inviteLoanGuarantors(context.Background(), notifier, applicant, application, guarantors, "https://paz.test"); err == nil {
+			t.Error("expected an error")
+		}
+		if len(notifier.sent) != 1 || notifier.sent[0].Channel != NotificationSMS {
+			t.Errorf("got %+v", notifier.sent)
+		}
+	})
+}
@@ -1,26 +1,28 @@
 package web_app
 
 import (
+	"bytes"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/TobiOkanlawon/go-sanatio"
-	"github.com/dustin/go-humanize"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/sessions"
 )
 
-func NewHandlerManager(partialsManager IPartialsManager, store IStore, cookieStore *sessions.CookieStore, paystackPublicKey, paystackSecretKey string) *HandlerManager {
-	return &HandlerManager{partialsManager, store, cookieStore, paystackPublicKey, paystackSecretKey}
+func NewHandlerManager(partialsManager IPartialsManager, store IStore, cookieStore *sessions.CookieStore, payments *PaymentProviders, baseURL string, webhooks *WebhookWorker) *HandlerManager {
+	return &HandlerManager{partialsManager, store, cookieStore, payments, baseURL, webhooks, NewPayoutService(store, payments), NewRefundService(store, payments), defaultCreditPolicy, Notifiers{}, defaultApprovalPolicy}
 }
 
 func (h *HandlerManager) indexGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -108,6 +110,10 @@ func (h *HandlerManager) loginPostHandler(w http.ResponseWriter, r *http.Request
 			errorsMap["Email"] = "Email or password is incorrect"
 		}
 
+		if err == ErrAccountSuspended {
+			errorsMap["Email"] = "This account has been suspended. Contact us to find out why"
+		}
+
 		tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
 			"Errors":         errorsMap,
 			csrf.TemplateTag: csrf.TemplateField(r),
@@ -129,9 +135,9 @@ func (h *HandlerManager) loginPostHandler(w http.ResponseWriter, r *http.Request
 	var role string
 
 	if loginInformation.UserIsAdmin {
-		role = "Admin"
+		role = RoleAdmin
 	} else {
-		role = "Basic"
+		role = RoleBasic
 	}
 
 	sessionCookie := NewUserSession(loginInformation.ID, role)
@@ -350,9 +356,9 @@ func (h *HandlerManager) dashboardHomeGetHandler(w http.ResponseWriter, r *http.
 
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
 		"FirstName":   homeScreenInformation.FirstName,
-		"Savings":     humanize.Comma(homeScreenInformation.SavingsBalance),
-		"Loans":       humanize.Comma(homeScreenInformation.LoansBalance),
-		"Investments": humanize.Comma(homeScreenInformation.InvestmentBalance),
+		"Savings":     homeScreenInformation.SavingsBalance,
+		"Loans":       homeScreenInformation.LoansBalance,
+		"Investments": homeScreenInformation.InvestmentBalance,
 		"Activities":  homeScreenInformation.Activities,
 		// "ShowModal":   homeScreenInformation.ShowModal,
 		"ShowModal": false,
@@ -368,27 +374,54 @@ func (h *HandlerManager) dashboardHomeGetHandler(w http.ResponseWriter, r *http.
 
 }
 
-func (h *HandlerManager) profileGetHandler(w http.ResponseWriter, r *http.Request) {
+// transactionsGetHandler serves both the full history at
+// /dashboard/transactions and the per-product history at
+// /dashboard/transactions/{product}
+func (h *HandlerManager) transactionsGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	templateFiles := []string{
 		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-profile.html",
+		"./web_app/templates/dashboard-transactions.html",
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
-
-	userSession, _ := h.getSessionOrLogout(w, r)
-	profileInformation, err := h.store.GetProfileScreenInformation(userSession.UserID)
-
+	userSession, err := h.getSessionOrLogout(w, r)
 	if err != nil {
-		log.Fatal(err)
-		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	product := chi.URLParam(r, "product")
+	if _, ok := transactionProducts[product]; product != "" && !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	filter, errorsMap := parseTransactionHistoryFilter(r.URL.Query(), product)
+
+	var history TransactionHistoryInformation
+	if len(errorsMap) == 0 {
+		history, err = h.store.GetTransactionHistory(userSession.UserID, filter)
+
+		if err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			log.Printf("error %q from url %q", err, r.URL.Path)
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Information":    profileInformation,
-		csrf.TemplateTag: csrf.TemplateField(r),
+		"Product":      product,
+		"ProductName":  transactionProductNames[filter.Product],
+		"Query":        r.URL.Query(),
+		"Transactions": history.Transactions,
+		"Page":         filter.Page,
+		"NextPage":     filter.QueryString(filter.Page + 1),
+		"PreviousPage": filter.QueryString(filter.Page - 1),
+		"HasNextPage":  history.HasNextPage,
+		"Errors":       errorsMap,
 	})
 
 	if err != nil {
@@ -396,95 +429,110 @@ func (h *HandlerManager) profileGetHandler(w http.ResponseWriter, r *http.Reques
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
-
-	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) savingsGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-savings.html",
+func (h *HandlerManager) statementsGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	h.renderStatementsPage(w, r, userSession.UserID, nil)
+}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+// statementsDownloadGetHandler generates the statement described by
+// the query string as a PDF or CSV attachment
+func (h *HandlerManager) statementsDownloadGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
 
-	savingsInformation, err := h.store.GetSavingsScreenInformation(userSession.UserID)
+	request, errorsMap := parseStatementRequest(r.URL.Query())
+	if len(errorsMap) != 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.renderStatementsPage(w, r, userSession.UserID, errorsMap)
+		return
+	}
 
+	statement, err := h.store.GetStatementInformation(userSession.UserID, request)
+	if err == ErrStatementPlanNotFound {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		h.renderStatementsPage(w, r, userSession.UserID, map[string]string{"Plan": "Choose one of your plans"})
+		return
+	}
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Balance": humanize.Comma(int64(savingsInformation.Balance)),
-	})
-
-	if err != nil {
+	// render into a buffer first, so that a failure doesn't leave the user with half a file
+	var body bytes.Buffer
+	if err := writeStatement(&body, request.Format, statement); err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	w.WriteHeader(200)
+	if request.Format == "pdf" {
+		w.Header().Set("Content-Type", "application/pdf")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", statement.Filename(request.Format)))
+	w.Write(body.Bytes())
 }
 
-func (h *HandlerManager) loansGetHandler(w http.ResponseWriter, r *http.Request) {
+func (h *HandlerManager) renderStatementsPage(w http.ResponseWriter, r *http.Request, userID uint, errorsMap map[string]string) {
+	plans, err := h.store.GetStatementPlans(userID)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
 	w.Header().Add("Content-Type", "text/html")
 	templateFiles := []string{
 		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-loans.html",
+		"./web_app/templates/dashboard-statements.html",
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
-
-	loansScreenInformation, err := h.store.GetLoansScreenInformation(userSession.UserID)
-
 	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Balance":         humanize.Comma(loansScreenInformation.Balance),
-		"HasPendingLoans": loansScreenInformation.HasPendingLoans,
+		"Query":  r.URL.Query(),
+		"Errors": errorsMap,
+		"Plans":  plans,
 	})
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
-		return
 	}
-
-	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) getLoansGetHandler(w http.ResponseWriter, r *http.Request) {
+func (h *HandlerManager) profileGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	templateFiles := []string{
 		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-get-loans.html",
+		"./web_app/templates/dashboard-profile.html",
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
-
-	// TODO: check if the user has pending loans, or a pending loan application, then turn the user down
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
-	// TODO: Do so on the backend too, the user shouldn't be able
-	// to submit a loan application if they have a pending loan
-	information, err := h.store.GetLoanScreenInformation(userSession.UserID)
+	userSession, _ := h.getSessionOrLogout(w, r)
+	profileInformation, err := h.store.GetProfileScreenInformation(userSession.UserID)
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		log.Printf("error %q from url %q", err, r.URL.Path)
+		log.Fatal(err)
+		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
-
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Information":    profileInformation,
 		csrf.TemplateTag: csrf.TemplateField(r),
-		"ShowBVNField":   !information.HasValidBVN,
 	})
 
 	if err != nil {
@@ -493,105 +541,53 @@ func (h *HandlerManager) getLoansGetHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) getLoansPostHandler(w http.ResponseWriter, r *http.Request) {
-
-	userSession, _ := h.getSessionOrLogout(w, r)
-
+func (h *HandlerManager) savingsGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
-	r.ParseForm()
-	amount, err := strconv.ParseUint(r.FormValue("loan-amount"), 10, 64)
-
-	if err != nil {
-		w.WriteHeader(http.StatusUnprocessableEntity)
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-savings.html",
 	}
-	// TODO: here, if the conversion fails, perhaps because of malicious entry, there won't be any repercussions
-	// TODO: FIX THIS
-	duration, err := strconv.ParseUint(r.FormValue("term-duration"), 10, 64)
 
-	if err != nil {
-		w.WriteHeader(http.StatusUnprocessableEntity)
-	}
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
-	// TODO: Add bank statement upload to the loans application page
+	userSession, _ := h.getSessionOrLogout(w, r)
 
-	bvn := r.PostFormValue("bvn")
-	var transformedBvn uint64
-	if bvn != "" {
-		transformedBvn, err = strconv.ParseUint(bvn, 10, 64)
+	savingsInformation, err := h.store.GetSavingsScreenInformation(userSession.UserID)
 
-		if err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-			log.Printf("error %q from url %q", err, r.URL.Path)
-			return
-		}
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
 
-	// TODO: this transformedBVN implementation is not clean, but it's what I've got for now
-	_, err = h.store.CreateLoanApplication(userSession.UserID, amount, duration, transformedBvn)
-
-	// TODO: handle validation and CSRF
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Balance": savingsInformation.Balance,
+	})
 
 	if err != nil {
-		var errorsMap = make(map[string]string)
-		errorsMap["Error"] = "An error occurred"
-		w.WriteHeader(http.StatusUnprocessableEntity)
-
-		log.Println(err)
-
-		// this is the default message
-		// errorsMap[""] = "An error occured"
-
-		// if err == ErrAccountDoesNotExist {
-		// 	errorsMap["Email"] = "Account does not exist"
-		// }
-
-		// if err == ErrUserNotVerified {
-		// 	errorsMap["Email"] = "Verify your email before trying to log in"
-		// }
-
-		// if err == ErrPasswordIncorrect {
-		// 	errorsMap["Email"] = "Email or password is incorrect"
-		// }
-
-		tmpl, err := template.ParseFiles("./web_app/templates/layouts/dashboard-base.html",
-			"./web_app/templates/dashboard-get-loans.html")
-
-		if err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		}
-
-		tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-			"Errors":         errorsMap,
-			csrf.TemplateTag: csrf.TemplateField(r),
-		})
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	// TODO: there should be some sort of response sent back to the user thwne they finish filling the form
-
-	http.Redirect(w, r, "/dashboard/loans", http.StatusFound)
+	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) investmentsGetHandler(w http.ResponseWriter, r *http.Request) {
-
-	// TODO: while we are still using the stop-gap implementation, we don't need the userSession. However, we still use it to log out the user
-	userSession, _ := h.getSessionOrLogout(w, r)
+func (h *HandlerManager) loansGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	templateFiles := []string{
 		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-investments.html",
+		"./web_app/templates/dashboard-loans.html",
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	userSession, _ := h.getSessionOrLogout(w, r)
 
-	information, err := h.store.GetInvestmentsScreenInformation(userSession.UserID)
+	loansScreenInformation, err := h.store.GetLoansScreenInformation(userSession.UserID)
 
-	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Balance": information.Balance,
-	})
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
@@ -599,21 +595,21 @@ func (h *HandlerManager) investmentsGetHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	w.WriteHeader(200)
-}
-
-func (h *HandlerManager) investmentsFormGetHandler(w http.ResponseWriter, r *http.Request) {
-	h.getSessionOrLogout(w, r)
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-investments-form.html",
-	}
-
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	now := time.Now()
+	nextInstallment, hasNextInstallment := loansScreenInformation.Loan.NextInstallment()
 
-	err := tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		csrf.TemplateTag: csrf.TemplateField(r),
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag:     csrf.TemplateField(r),
+		"Balance":            loansScreenInformation.Balance,
+		"HasPendingLoans":    loansScreenInformation.HasPendingLoans,
+		"HasLoan":            loansScreenInformation.HasLoan,
+		"Loan":               loansScreenInformation.Loan,
+		"Repayments":         loansScreenInformation.Repayments,
+		"Applications":       loansScreenInformation.Applications,
+		"NextInstallment":    nextInstallment,
+		"HasNextInstallment": hasNextInstallment,
+		"PayoffAmount":       loansScreenInformation.Loan.PayoffAmount(now),
+		"Today":              now,
 	})
 
 	if err != nil {
@@ -625,170 +621,2569 @@ func (h *HandlerManager) investmentsFormGetHandler(w http.ResponseWriter, r *htt
 	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) investmentsFormPostHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-
-	userSession, _ := h.getSessionOrLogout(w, r)
+// loansRepayPostHandler starts a payment for the next installments,
+// an amount of the customer's choosing, or the whole loan
+func (h *HandlerManager) loansRepayPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
 	r.ParseForm()
-	var errorsMap = make(map[string]string)
-
-	// TODO: Redo the validation with sanatio
 
-	employmentStatus := r.PostFormValue("employment-status")
-
-	if employmentStatus == "" {
-		errorsMap["EmploymentStatus"] = "Something seems wrong with this field"
-		w.WriteHeader(http.StatusUnprocessableEntity)
+	loan, err := h.store.GetActiveLoan(userSession.UserID)
+	if err == ErrLoanDoesNotExist {
+		http.Error(w, "You don't have a loan to repay", http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	if employmentStatus == "salaried" {
-		employmentStatus = "SALARIED"
-	} else if employmentStatus == "self-employed" {
-		employmentStatus = "SELF-EMPLOYED"
-	} else if employmentStatus == "retired" {
-		employmentStatus = "RETIRED"
-	} else if employmentStatus == "unemployed" {
-		employmentStatus = "UNEMPLOYED"
-	} else {
-		errorsMap["EmploymentStatus"] = "You have selected an invalid employment status"
-	}
+	kind := r.PostFormValue("repayment-kind")
 
-	yearOfEmploymentValue := r.PostFormValue("date-of-employment")
+	var installment int
+	var amount Money
 
-	if yearOfEmploymentValue == "" {
-		errorsMap["DateOfEmployment"] = "This field is required"
+	switch kind {
+	case RepaymentInstallment:
+		if installment, err = strconv.Atoi(r.PostFormValue("installment")); err != nil {
+			http.Error(w, "Select the installment you would like to pay", http.StatusUnprocessableEntity)
+			return
+		}
+	case RepaymentAmount:
+		if amount, err = ParseMoney(r.PostFormValue("repayment-amount")); err != nil {
+			http.Error(w, "Enter the amount you would like to repay", http.StatusUnprocessableEntity)
+			return
+		}
 	}
 
-	convertedYearOfEmployment, err := time.Parse("YYYY-MM-DD", yearOfEmploymentValue)
-
-	employerName := r.PostFormValue("employer-name")
-
-	if employerName == "" {
-		// TODO: make a validation abstraction
-		errorsMap["EmployerName"] = "This field is required"
+	amount, err = repaymentAmount(loan, kind, installment, amount, time.Now())
+	switch {
+	case errors.Is(err, ErrRepaymentTooLarge):
+		http.Error(w, fmt.Sprintf("You can repay at most %s", loan.PayoffAmount(time.Now())), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrInstallmentAlreadyPaid):
+		http.Error(w, "That installment has already been paid", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrInstallmentDoesNotExist):
+		http.Error(w, "Select the installment you would like to pay", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Enter the amount you would like to repay", http.StatusUnprocessableEntity)
+		return
 	}
 
-	amount, err := strconv.ParseUint(r.PostFormValue("investment-amount"), 10, 64)
+	h.checkout(w, r, userSession.UserID, loan.ID, OriginatorLoanRepayment, amount, "/dashboard/loans", func(referenceNumber uuid.UUID, provider string) error {
+		return h.store.CreateLoanRepayment(userSession.UserID, LoanRepayment{
+			PaymentReference:  referenceNumber,
+			LoanID:            loan.ID,
+			Kind:              kind,
+			InstallmentNumber: installment,
+			Amount:            amount,
+		}, provider)
+	})
+}
 
+func (h *HandlerManager) getLoansGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
 	if err != nil {
-		errorsMap["InvestmentAmount"] = "Something seems wrong with this field"
+		return
+	}
+
+	// the form asks htmx for a new quote as the customer types
+	if r.Header.Get("HX-Request") == "true" {
+		h.renderLoanQuote(w, r)
+		return
 	}
 
-	// implement a maximum for this field
-	tenure, err := strconv.ParseUint(r.PostFormValue("investment-tenure"), 10, 64)
+	h.renderGetLoan(w, r, userSession.UserID, http.StatusOK, nil)
+}
 
-	if err != nil {
-		errorsMap["InvestmentTenure"] = "Something seems wrong with this field"
+// loanQuoteData is what the loan-quote fragment shows for the amount,
+// term and frequency in the get-loan form
+func loanQuoteData(r *http.Request) map[string]interface{} {
+	amount, err := ParseMoney(r.FormValue("loan-amount"))
+	if err != nil || amount < minimumLoanAmount {
+		return map[string]interface{}{"QuoteError": fmt.Sprintf("Enter an amount of at least %s to see what you would repay", minimumLoanAmount)}
 	}
 
-	taxIdentificationNumber, err := strconv.ParseUint(r.PostFormValue("TIN"), 10, 64)
+	duration, err := strconv.ParseUint(r.FormValue("term-duration"), 10, 64)
+	if err != nil || duration < minimumLoanDurationDays || duration > maximumLoanDurationDays {
+		return map[string]interface{}{"QuoteError": fmt.Sprintf("Enter between %d and %d days to see what you would repay", minimumLoanDurationDays, maximumLoanDurationDays)}
+	}
 
+	quote, err := quoteLoan(LoanTerms{
+		LoanPricing:    defaultLoanPricing,
+		Principal:      amount,
+		DurationInDays: duration,
+		Frequency:      repaymentFrequency(r),
+	}, time.Now())
 	if err != nil {
-		errorsMap["TIN"] = "Something seems wrong with this field"
+		return map[string]interface{}{"QuoteError": "Select how often you would like to repay"}
 	}
 
-	bankAccountName := r.PostFormValue("bank-account-name")
+	return map[string]interface{}{"Quote": quote}
+}
 
-	if bankAccountName == "" {
-		errorsMap["BankAccountName"] = "This field is required"
+// repaymentFrequency is the installment frequency picked in the
+// get-loan form, monthly if none was
+func repaymentFrequency(r *http.Request) string {
+	if frequency := r.FormValue("repayment-frequency"); frequency != "" {
+		return frequency
 	}
+	return MonthlyInstallments
+}
 
-	bankAccountNumber, err := strconv.ParseUint(r.PostFormValue("bank-account-number"), 10, 64)
-
+func (h *HandlerManager) renderLoanQuote(w http.ResponseWriter, r *http.Request) {
+	fragment, err := template.ParseFiles("./web_app/templates/fragments/loan-quote.html")
 	if err != nil {
-		errorsMap["BankAccountNumber"] = "Something seems wrong with this field"
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
 
-	_, err = h.store.CreateInvestmentApplication(userSession.UserID, employmentStatus, convertedYearOfEmployment, employerName, amount, tenure, taxIdentificationNumber, bankAccountName, bankAccountNumber)
+	w.Header().Add("Content-Type", "text/html")
 
-	// TODO: handle validation and CSRF
+	if err := fragment.ExecuteTemplate(w, "loan-quote", loanQuoteData(r)); err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
 
+// getLoansPostHandler submits a loan application. Customers with an
+// application in progress can't make another.
+func (h *HandlerManager) getLoansPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
 	if err != nil {
-		errorsMap["Error"] = "An error occurred"
-		w.WriteHeader(http.StatusUnprocessableEntity)
-
-		log.Println(err)
-
-		tmpl, err := template.ParseFiles(
-			"./web_app/templates/layouts/dashboard-base.html",
-			"./web_app/templates/dashboard-investments-form.html",
-		)
+		return
+	}
+	r.ParseForm()
 
-		if err != nil {
-			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		}
+	errorsMap := make(map[string]string)
 
-		tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-			"Errors":         errorsMap,
-			csrf.TemplateTag: csrf.TemplateField(r),
-		})
-		return
+	amount, err := ParseMoney(r.PostFormValue("loan-amount"))
+	if err != nil || amount < minimumLoanAmount {
+		errorsMap["LoanAmount"] = fmt.Sprintf("Enter an amount of at least %s", minimumLoanAmount)
 	}
 
-	// TODO: there should be some sort of response sent back to the user when they finish filling the form
+	duration, err := strconv.ParseUint(r.PostFormValue("term-duration"), 10, 64)
+	if err != nil || duration < minimumLoanDurationDays || duration > maximumLoanDurationDays {
+		errorsMap["TermDuration"] = fmt.Sprintf("Enter between %d and %d days", minimumLoanDurationDays, maximumLoanDurationDays)
+	}
 
-	http.Redirect(w, r, "/dashboard/investments", http.StatusFound)
-}
+	frequency := repaymentFrequency(r)
+	if _, err := installmentCount(duration, frequency); err != nil {
+		errorsMap["RepaymentFrequency"] = "Select how often you would like to repay"
+	}
 
-// TODO: This is a HTMX route. Check for accuracy later
-func (h *HandlerManager) bvnModalGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	fragment, err := template.ParseFiles("./web_app/templates/fragments/bvn-modal.html")
+	// a bank statement is optional, and is summarised for underwriters
+	statement, err := uploadedBankStatement(r)
+	if err != nil {
+		errorsMap["BankStatement"] = err.Error()
+	}
 
+	applicant, err := h.store.GetCustomerContact(userSession.UserID)
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	err = fragment.Execute(w, nil)
+	guarantors, err := guarantorContacts(r.PostForm["guarantor"], applicant)
+	if err != nil {
+		errorsMap["Guarantors"] = err.Error()
+	} else if len(guarantors) < guarantorsRequired(amount) {
+		errorsMap["Guarantors"] = ErrGuarantorRequired.Error()
+	}
+
+	bvn := strings.TrimSpace(r.PostFormValue("bvn"))
+	if bvn != "" && validateBVN(bvn) != nil {
+		errorsMap["BVN"] = "Enter your 11 digit BVN"
+	}
 
+	// a BVN given with the application is saved with it
+	credit, err := h.creditDecision(userSession.UserID, bvn != "")
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	w.WriteHeader(200)
+	switch {
+	case !credit.Eligible():
+		errorsMap["Error"] = "We can't offer you a loan right now. Saving with us regularly and completing your profile will help."
+	case amount > credit.MaxAmount:
+		errorsMap["LoanAmount"] = fmt.Sprintf("You can borrow up to %s right now", credit.MaxAmount)
+	case duration > credit.MaxTenorDays:
+		errorsMap["TermDuration"] = fmt.Sprintf("You can borrow for up to %d days right now", credit.MaxTenorDays)
+	}
+
+	bankAccountID, err := strconv.ParseUint(r.PostFormValue("bank-account"), 10, 64)
+	if err != nil {
+		errorsMap["BankAccount"] = "Select the account the loan should be paid into"
+	} else if _, err := h.store.GetBankAccount(userSession.UserID, uint(bankAccountID)); err == ErrBankAccountDoesNotExist {
+		errorsMap["BankAccount"] = "Select the account the loan should be paid into"
+	} else if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if len(errorsMap) > 0 {
+		h.renderGetLoan(w, r, userSession.UserID, http.StatusUnprocessableEntity, errorsMap)
+		return
+	}
+
+	application := LoanApplication{
+		CustomerID:         userSession.UserID,
+		Amount:             amount,
+		DurationInDays:     duration,
+		BVN:                bvn,
+		BankAccountID:      uint(bankAccountID),
+		LoanPricing:        defaultLoanPricing,
+		Frequency:          frequency,
+		Credit:             credit,
+		Statement:          statement,
+		Guarantors:         guarantors,
+		GuarantorsRequired: guarantorsRequired(amount),
+	}
+	application.ID, err = h.store.CreateLoanApplication(application)
+
+	switch {
+	case err == nil:
+	case err == ErrBVNRequired, err == ErrInvalidBVN, err == ErrBVNInUse:
+		h.renderGetLoan(w, r, userSession.UserID, http.StatusUnprocessableEntity, map[string]string{"BVN": err.Error()})
+		return
+	case err == ErrLoanApplicationInProgress:
+		h.renderGetLoan(w, r, userSession.UserID, http.StatusUnprocessableEntity, map[string]string{"Error": err.Error()})
+		return
+	case err == ErrGuarantorNominated:
+		h.renderGetLoan(w, r, userSession.UserID, http.StatusUnprocessableEntity, map[string]string{"Guarantors": err.Error()})
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	h.inviteLoanGuarantors(r, applicant, application)
+
+	http.Redirect(w, r, "/dashboard/loans", http.StatusFound)
+}
+
+// inviteLoanGuarantors sends the guarantors of an application that
+// haven't answered yet their invitations. The application stands if
+// they can't be sent; the applicant can see who hasn't answered.
+func (h *HandlerManager) inviteLoanGuarantors(r *http.Request, applicant CustomerContact, application LoanApplication) {
+	guarantors, err := h.store.GetLoanGuarantors(application.ID)
+	if err == nil {
+		err = inviteLoanGuarantors(r.Context(), h.notifier, applicant, application, guarantors, h.baseURL)
+	}
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// loanGuarantorsPostHandler nominates more guarantors for the
+// customer's application in progress, e.g. when one has declined
+func (h *HandlerManager) loanGuarantorsPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	r.ParseForm()
+
+	information, err := h.store.GetLoanScreenInformation(userSession.UserID)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if !information.HasApplicationInProgress {
+		http.Redirect(w, r, "/dashboard/loans/get-loan", http.StatusSeeOther)
+		return
+	}
+
+	applicant, err := h.store.GetCustomerContact(userSession.UserID)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	contacts, err := guarantorContacts(r.PostForm["guarantor"], applicant)
+	if err == nil && len(contacts) == 0 {
+		err = ErrInvalidGuarantorContact
+	}
+	if err == nil {
+		_, err = h.store.AddLoanGuarantors(userSession.UserID, information.Application.ID, contacts)
+	}
+
+	switch {
+	case err == nil:
+	case err == ErrInvalidGuarantorContact, err == ErrOwnGuarantor, err == ErrGuarantorNominated, err == ErrTooManyGuarantors, err == ErrGuarantorsClosed:
+		h.renderGetLoan(w, r, userSession.UserID, http.StatusUnprocessableEntity, map[string]string{"Guarantors": err.Error()})
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	h.inviteLoanGuarantors(r, applicant, information.Application)
+
+	http.Redirect(w, r, "/dashboard/loans/get-loan", http.StatusSeeOther)
+}
+
+// guaranteesGetHandler lists the invitations to guarantee a loan that
+// were sent to the customer's email address or phone number and
+// haven't been answered
+func (h *HandlerManager) guaranteesGetHandler(w http.ResponseWriter, r *http.Request) {
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-guarantees.html",
+	}
+
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	contact, err := h.store.GetCustomerContact(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	guarantees, err := h.store.GetOpenLoanGuarantees(customerGuarantorContacts(contact))
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// customers can't guarantee their own loans
+	var open []LoanGuarantee
+	for _, guarantee := range guarantees {
+		if guarantee.ApplicantID != userSession.UserID {
+			open = append(open, guarantee)
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Guarantees": open,
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// guaranteeGetHandler shows a guarantor the loan they've been asked to
+// guarantee
+func (h *HandlerManager) guaranteeGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	h.renderGuarantee(w, r, userSession.UserID, http.StatusOK, "")
+}
+
+// guaranteePostHandler records a guarantor's answer, and the savings
+// they put on hold if they agree
+func (h *HandlerManager) guaranteePostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	r.ParseForm()
+
+	accept := r.PostFormValue("answer") == GuarantorAccepted
+
+	var hold Money
+	if value := strings.TrimSpace(r.PostFormValue("hold")); accept && value != "" {
+		if hold, err = ParseMoney(value); err != nil {
+			h.renderGuarantee(w, r, userSession.UserID, http.StatusUnprocessableEntity, "Enter the amount of your savings to put on hold, or leave it empty")
+			return
+		}
+	}
+
+	_, err = h.store.RespondToLoanGuarantee(chi.URLParam(r, "token"), userSession.UserID, accept, hold)
+
+	switch {
+	case err == nil:
+	case err == ErrGuaranteeDoesNotExist:
+		http.Error(w, "Unknown invitation", http.StatusNotFound)
+		return
+	case err == ErrGuaranteeAnswered, err == ErrGuaranteeClosed, err == ErrOwnGuarantor, err == ErrGuaranteeNotForCustomer, err == ErrHoldTooLarge:
+		h.renderGuarantee(w, r, userSession.UserID, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/guarantees/"+chi.URLParam(r, "token"), http.StatusSeeOther)
+}
+
+func (h *HandlerManager) renderGuarantee(w http.ResponseWriter, r *http.Request, userID uint, status int, responseError string) {
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-guarantee.html",
+	}
+
+	token := chi.URLParam(r, "token")
+	if _, err := uuid.Parse(token); err != nil {
+		http.Error(w, "Unknown invitation", http.StatusNotFound)
+		return
+	}
+
+	guarantee, err := h.store.GetLoanGuarantee(token)
+
+	if err == ErrGuaranteeDoesNotExist {
+		http.Error(w, "Unknown invitation", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	contact, err := h.store.GetCustomerContact(userID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	savings, err := h.store.GetSoloSaverScreenInformation(userID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// only the guarantor it was sent to can see who is asking
+	cantAnswer := checkGuaranteeResponse(guarantee, userID, contact)
+	if cantAnswer == ErrGuaranteeNotForCustomer || cantAnswer == ErrOwnGuarantor || (guarantee.CustomerID != 0 && guarantee.CustomerID != userID) {
+		guarantee = LoanGuarantee{LoanGuarantor: LoanGuarantor{Token: guarantee.Token}}
+	}
+	if responseError == "" && cantAnswer != nil && cantAnswer != ErrGuaranteeAnswered {
+		responseError = cantAnswer.Error()
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"Guarantee":      guarantee,
+		"CanAnswer":      cantAnswer == nil,
+		"Available":      savings.Balance - savings.OnHold,
+		"Error":          responseError,
+		"Hold":           r.PostFormValue("hold"),
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// creditDecision scores a customer with the handler's credit policy.
+// bvnGiven counts a BVN that is being applied with as one on file.
+func (h *HandlerManager) creditDecision(userID uint, bvnGiven bool) (CreditDecision, error) {
+	signals, err := h.store.GetCreditSignals(userID)
+	if err != nil {
+		return CreditDecision{}, err
+	}
+
+	signals.BVNOnFile = signals.BVNOnFile || bvnGiven
+	return scoreCredit(h.credit, signals, time.Now()), nil
+}
+
+func (h *HandlerManager) renderGetLoan(w http.ResponseWriter, r *http.Request, userID uint, status int, errorsMap map[string]string) {
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-get-loans.html",
+		"./web_app/templates/fragments/loan-quote.html",
+	}
+
+	information, err := h.store.GetLoanScreenInformation(userID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	credit, err := h.creditDecision(userID, false)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag:           csrf.TemplateField(r),
+		"ShowBVNField":             !information.HasValidBVN,
+		"BankAccounts":             information.BankAccounts,
+		"Application":              information.Application,
+		"HasApplicationInProgress": information.HasApplicationInProgress,
+		"Errors":                   errorsMap,
+		"LoanAmount":               r.PostFormValue("loan-amount"),
+		"TermDuration":             r.PostFormValue("term-duration"),
+		"RepaymentFrequency":       repaymentFrequency(r),
+		"LoanQuote":                loanQuoteData(r),
+		"Credit":                   credit,
+		"Guarantors":               information.Guarantors,
+		"GuarantorContacts":        guarantorFields(r.PostForm["guarantor"]),
+		"GuarantorThreshold":       guarantorThreshold,
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+func (h *HandlerManager) investmentsGetHandler(w http.ResponseWriter, r *http.Request) {
+
+	// TODO: while we are still using the stop-gap implementation, we don't need the userSession. However, we still use it to log out the user
+	userSession, _ := h.getSessionOrLogout(w, r)
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-investments.html",
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	information, err := h.store.GetInvestmentsScreenInformation(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"Balance":        information.Balance,
+		"Positions":      information.Positions,
+		"Applications":   information.Applications,
+		"Products":       information.Products,
+		"Submitted":      r.URL.Query().Get("submitted") == "true",
+		"Today":          time.Now(),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// investmentRolloverPostHandler sets whether an investment is rolled
+// over when it matures
+func (h *HandlerManager) investmentRolloverPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	positionID, err := strconv.ParseUint(chi.URLParam(r, "positionID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	err = h.store.SetInvestmentRollover(userSession.UserID, uint(positionID), r.PostFormValue("rollover") == "true")
+
+	switch {
+	case err == nil:
+	case err == ErrInvestmentPositionDoesNotExist:
+		http.Error(w, "Unknown investment", http.StatusNotFound)
+		return
+	case err == ErrInvestmentPositionEnded:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/investments", http.StatusSeeOther)
+}
+
+// investmentApplicationPayPostHandler sends the customer to pay for an
+// approved application. The payment opens the investment once its
+// webhook arrives.
+func (h *HandlerManager) investmentApplicationPayPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
+	}
+
+	application, err := h.store.GetInvestmentApplication(uint(applicationID))
+
+	if err == ErrInvestmentApplicationDoesNotExist || application.CustomerID != userSession.UserID {
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if !application.AwaitingPayment() {
+		http.Error(w, ErrInvestmentApplicationNotPayable.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.checkout(w, r, userSession.UserID, application.ID, OriginatorInvestments, application.Amount, "/dashboard/investments", func(referenceNumber uuid.UUID, provider string) error {
+		_, err := h.store.CreatePayment(userSession.UserID, application.ID, referenceNumber, OriginatorInvestments, application.Amount, provider)
+		return err
+	})
+}
+
+// investmentCertificateGetHandler downloads the certificate for one of
+// the customer's investments
+func (h *HandlerManager) investmentCertificateGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	positionID, err := strconv.ParseUint(chi.URLParam(r, "positionID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment", http.StatusNotFound)
+		return
+	}
+
+	positions, err := h.store.GetCustomerInvestmentPositions(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	index := slices.IndexFunc(positions, func(position InvestmentPosition) bool { return position.ID == uint(positionID) })
+	if index < 0 {
+		http.Error(w, "Unknown investment", http.StatusNotFound)
+		return
+	}
+
+	profile, err := h.store.GetProfileScreenInformation(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	certificate := InvestmentCertificate{
+		Position:     positions[index],
+		CustomerName: profile.FirstName + " " + profile.LastName,
+		EmailAddress: profile.EmailAddress,
+		GeneratedAt:  time.Now(),
+	}
+
+	// render into a buffer first, so that a failure doesn't leave the user with half a file
+	var body bytes.Buffer
+	if err := writeInvestmentCertificatePDF(&body, certificate); err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", certificate.Filename()))
+	w.Write(body.Bytes())
+}
+
+// investmentQuoteData is what the investment-quote fragment shows for
+// the product, amount and tenor in the investment form
+func investmentQuoteData(form url.Values, products []InvestmentProduct) map[string]interface{} {
+	productID, _ := strconv.ParseUint(form.Get("investment-product"), 10, 64)
+
+	index := slices.IndexFunc(products, func(product InvestmentProduct) bool { return product.ID == uint(productID) })
+	if index < 0 {
+		return map[string]interface{}{"QuoteError": "Choose a product to see what you would earn"}
+	}
+	product := products[index]
+
+	data := map[string]interface{}{"Product": product}
+
+	amount, err := ParseMoney(form.Get("investment-amount"))
+	if err != nil || amount < product.MinimumAmount {
+		data["QuoteError"] = fmt.Sprintf("Enter an amount of at least %s to see what you would earn", product.MinimumAmount)
+		return data
+	}
+
+	tenor, _ := strconv.ParseUint(form.Get("investment-tenure"), 10, 64)
+	quote, err := quoteInvestment(product, amount, tenor, time.Now())
+	if err != nil {
+		data["QuoteError"] = "Choose how many days to invest for to see what you would earn"
+		return data
+	}
+
+	data["Quote"] = quote
+	return data
+}
+
+// investmentsFormGetHandler shows the investment form, filled in with
+// the customer's draft if they have one
+func (h *HandlerManager) investmentsFormGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	// the form asks htmx for a new quote as the customer picks a
+	// product and types
+	if r.Header.Get("HX-Request") == "true" {
+		products, err := h.store.GetInvestmentProducts(true)
+
+		if err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			log.Printf("error %q from url %q", err, r.URL.Path)
+			return
+		}
+
+		w.Header().Add("Content-Type", "text/html")
+		fragment := template.Must(template.ParseFiles("./web_app/templates/fragments/investment-quote.html"))
+		if err := fragment.ExecuteTemplate(w, "investment-quote", investmentQuoteData(r.URL.Query(), products)); err != nil {
+			log.Printf("error %q from url %q", err, r.URL.Path)
+		}
+		return
+	}
+
+	form := url.Values{}
+	draft, err := h.store.GetInvestmentApplicationDraft(userSession.UserID)
+
+	switch {
+	case err == nil:
+		form = investmentApplicationValues(draft)
+	case err != ErrInvestmentApplicationDoesNotExist:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// the products on the investments page link here with theirs
+	if productID := r.URL.Query().Get("investment-product"); productID != "" {
+		form.Set("investment-product", productID)
+	}
+
+	h.renderInvestmentsForm(w, r, http.StatusOK, form, nil)
+}
+
+func (h *HandlerManager) renderInvestmentsForm(w http.ResponseWriter, r *http.Request, status int, form url.Values, errorsMap map[string]string) {
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-investments-form.html",
+		"./web_app/templates/fragments/investment-quote.html",
+	}
+
+	products, err := h.store.GetInvestmentProducts(true)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag:  csrf.TemplateField(r),
+		"Products":        products,
+		"Form":            form,
+		"Errors":          errorsMap,
+		"Saved":           r.URL.Query().Get("saved") == "true",
+		"InvestmentQuote": investmentQuoteData(form, products),
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// investmentsFormPostHandler saves the investment form as the
+// customer's draft. Saving for later keeps whatever has been filled in;
+// continuing needs every field, and goes on to the confirmation page.
+func (h *HandlerManager) investmentsFormPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	r.ParseForm()
+
+	application, errorsMap := investmentApplicationForm(r.PostForm, userSession.UserID, time.Now())
+
+	var product InvestmentProduct
+	if application.ProductID != 0 {
+		var err error
+		product, err = h.store.GetInvestmentProduct(application.ProductID)
+
+		switch {
+		case err == ErrInvestmentProductDoesNotExist:
+			errorsMap["InvestmentProduct"] = "Choose a product to invest in"
+			application.ProductID = 0
+		case err != nil:
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			log.Printf("error %q from url %q", err, r.URL.Path)
+			return
+		}
+	}
+
+	saving := r.PostFormValue("action") == "save"
+	if !saving {
+		for field, problem := range investmentApplicationProblems(application, product) {
+			if _, ok := errorsMap[field]; !ok {
+				errorsMap[field] = problem
+			}
+		}
+	}
+
+	if len(errorsMap) > 0 {
+		h.renderInvestmentsForm(w, r, http.StatusUnprocessableEntity, r.PostForm, errorsMap)
+		return
+	}
+
+	if _, err := h.store.SaveInvestmentApplicationDraft(application); err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if saving {
+		http.Redirect(w, r, "/dashboard/investments/form?saved=true", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/investments/form/confirm", http.StatusSeeOther)
+}
+
+// investmentsConfirmGetHandler shows the customer's draft with what it
+// would earn, for them to check before they submit it
+func (h *HandlerManager) investmentsConfirmGetHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	h.renderInvestmentConfirmation(w, r, userSession.UserID, http.StatusOK, "")
+}
+
+func (h *HandlerManager) renderInvestmentConfirmation(w http.ResponseWriter, r *http.Request, customerID uint, status int, submitError string) {
+	draft, err := h.store.GetInvestmentApplicationDraft(customerID)
+
+	if err == ErrInvestmentApplicationDoesNotExist {
+		http.Redirect(w, r, "/dashboard/investments/form", http.StatusSeeOther)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	product, err := h.store.GetInvestmentProduct(draft.ProductID)
+
+	if err != nil && err != ErrInvestmentProductDoesNotExist {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// the product may have changed since the draft was saved
+	if problems := investmentApplicationProblems(draft, product); len(problems) > 0 {
+		h.renderInvestmentsForm(w, r, http.StatusUnprocessableEntity, investmentApplicationValues(draft), problems)
+		return
+	}
+
+	quote, err := quoteInvestment(product, draft.Amount, draft.TenorInDays, time.Now())
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-investments-confirm.html",
+	))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"Application":    draft,
+		"Quote":          quote,
+		"Error":          submitError,
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// investmentsConfirmPostHandler submits the customer's draft to be
+// reviewed
+func (h *HandlerManager) investmentsConfirmPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	_, err = h.store.SubmitInvestmentApplication(userSession.UserID)
+
+	switch {
+	case err == nil:
+	case err == ErrInvestmentApplicationDoesNotExist:
+		http.Redirect(w, r, "/dashboard/investments/form", http.StatusSeeOther)
+		return
+	case err == ErrInvestmentApplicationIncomplete:
+		// the confirmation page shows the form with what is missing
+		http.Redirect(w, r, "/dashboard/investments/form/confirm", http.StatusSeeOther)
+		return
+	case err == ErrInvestmentApplicationWaiting:
+		h.renderInvestmentConfirmation(w, r, userSession.UserID, http.StatusUnprocessableEntity, "You already have an application waiting to be reviewed. You can submit this one once it has been decided.")
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/investments?submitted=true", http.StatusSeeOther)
+}
+
+// TODO: This is a HTMX route. Check for accuracy later
+func (h *HandlerManager) bvnModalGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	fragment, err := template.ParseFiles("./web_app/templates/fragments/bvn-modal.html")
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	err = fragment.Execute(w, nil)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (h *HandlerManager) addBVNPostHandler(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	bvn := r.FormValue("bvn")
+	// TODO: validation
+	if bvn == "" {
+		// TODO: send an error
+	}
+
+	// TODO: store the BVN/send it to somewhere for validation
+
+	w.Header().Add("Content-Type", "text/html")
+	fragment, err := template.ParseFiles("./web_app/templates/fragments/verification-success.html")
+
+	// TODO: handle err
+	if err != nil {
+		log.Fatalf("error with fragment %q", err)
+	}
+
+	fragment.Execute(w, VerificationData{
+		Message: "Your BVN has been verified",
+	})
+
+	w.WriteHeader(201)
+}
+
+func (h *HandlerManager) familyVaultGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-savings-family.html",
+	}
+
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	familyVaultInformation, err := h.store.GetFamilyVaultScreenInformation(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Balance":        familyVaultInformation.Balance,
+		"Plans":          familyVaultInformation.FamilyVaultBasicPlans,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (h *HandlerManager) familyVaultPostHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	// TODO: Should return a fragment for htmx requests
+
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	r.ParseForm()
+	familyName := r.PostFormValue("family-name")
+	familyMember := r.PostFormValue("family-member")
+	amount, err := ParseMoney(r.PostFormValue("amount"))
+	if err != nil {
+		http.Error(w, "Enter a valid amount", http.StatusUnprocessableEntity)
+		return
+	}
+	savingsFrequency := r.PostFormValue("savings-frequency")
+	savingsDuration, err := strconv.ParseInt(r.PostFormValue("duration"), 10, 64)
+
+	// TODO: should handle form validation here
+
+	if err != nil {
+		// TODO: return a validation error to the client here.
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+	}
+
+	information, err := h.store.CreateNewFamilyVault(userSession.UserID, familyName, familyMember, amount, savingsFrequency, savingsDuration)
+
+	if err != nil {
+		log.Printf("An error occured while trying to create a family vault %s", err)
+		h.logout(w, r)
+		return
+	}
+	// TODO: redirect on success
+	// TODO: abstract the URLs
+	http.Redirect(w, r, fmt.Sprintf("/dashboard/savings/family-vault/%d", information.PlanID), http.StatusOK)
+}
+
+func (h *HandlerManager) familyVaultPlanGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-savings-family-plan.html",
+	}
+
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	planID := chi.URLParam(r, "planID")
+	convertedPlanID, err := strconv.Atoi(planID)
+
+	if err != nil {
+		// TODO: return a 404 here
+		http.Error(w, "Something went wrong", http.StatusNotFound)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	familyVaultPlanInformation, err := h.store.GetFamilyVaultPlanScreenInformation(userSession.UserID, convertedPlanID)
+
+	if err != nil {
+		// TODO: here we would want to check the type of error and check for why it's having that error then display an appropriate error to the user with an appropriate error code
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Information":     familyVaultPlanInformation,
+		"Balance":         familyVaultPlanInformation.Balance,
+		csrf.TemplateTag:  csrf.TemplateField(r),
+		"PlanID":          planID,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// minimumTopUp is the smallest amount that can be paid into savings,
+// the same as the min on the top-up forms
+const minimumTopUp Money = 100000
+
+func (h *HandlerManager) soloSavingsAddFunds(w http.ResponseWriter, r *http.Request) {
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	// the planID field is 99909990 by convention. It doesn't mean anything for soloSavings
+	h.startPayment(w, r, userSession.UserID, 99909990, OriginatorSoloSavings, "/dashboard/savings/solo-saver")
+}
+
+func (h *HandlerManager) familySavingsAddFunds(w http.ResponseWriter, r *http.Request) {
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	planID := chi.URLParam(r, "planID")
+	convertedPlanID, err := strconv.Atoi(planID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusNotFound)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	h.startPayment(w, r, userSession.UserID, uint(convertedPlanID), OriginatorFamilySavings, "/dashboard/savings/family-vault/"+planID)
+}
+
+func (h *HandlerManager) targetSavingsAddFunds(w http.ResponseWriter, r *http.Request) {
+	userSession, _ := h.getSessionOrLogout(w, r)
+
+	planID := chi.URLParam(r, "planID")
+	convertedPlanID, err := strconv.Atoi(planID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusNotFound)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	h.startPayment(w, r, userSession.UserID, uint(convertedPlanID), OriginatorTargetSavings, "/dashboard/savings/target-savings/"+planID)
+}
+
+// startPayment takes the amount from a top-up form and makes the
+// pending payment for it under a reference number of our own. The
+// payment provider is asked for a checkout page for that amount, which
+// the customer is sent to. They come back to returnPath once they
+// have paid.
+func (h *HandlerManager) startPayment(w http.ResponseWriter, r *http.Request, userID, planID uint, originator string, returnPath string) {
+	r.ParseForm()
+
+	amount, err := ParseMoney(r.PostFormValue("top-up-amount"))
+	if err != nil || amount < minimumTopUp {
+		http.Error(w, fmt.Sprintf("Enter an amount of at least %s", minimumTopUp), http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.checkout(w, r, userID, planID, originator, amount, returnPath, func(referenceNumber uuid.UUID, provider string) error {
+		_, err := h.store.CreatePayment(userID, planID, referenceNumber, originator, amount, provider)
+		return err
+	})
+}
+
+// checkout saves a pending payment with create, then sends the
+// customer to the active provider to pay for it
+func (h *HandlerManager) checkout(w http.ResponseWriter, r *http.Request, userID, planID uint, originator string, amount Money, returnPath string, create func(referenceNumber uuid.UUID, provider string) error) {
+	profile, err := h.store.GetProfileScreenInformation(userID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	referenceNumber := h.generatePaymentUUID()
+	provider := h.payments.Active()
+
+	if err = create(referenceNumber, provider.Name()); err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		http.Error(w, "Something went wrong while trying to save your transaction", http.StatusInternalServerError)
+		return
+	}
+
+	authorization, err := provider.Initialize(r.Context(), PaymentRequest{
+		ReferenceNumber: referenceNumber,
+		Amount:          amount,
+		Email:           profile.EmailAddress,
+		CallbackURL:     h.baseURL + returnPath,
+		Metadata: map[string]string{
+			"customer_id":        strconv.FormatUint(uint64(userID), 10),
+			"plan_id":            strconv.FormatUint(uint64(planID), 10),
+			"payment_originator": originator,
+		},
+	})
+
+	if err != nil {
+		log.Printf("couldn't initialize %s payment %s: %s", provider.Name(), referenceNumber, err)
+		// so that the payment doesn't show as pending
+		if err := h.store.RecordVerificationFailure(referenceNumber, "the payment could not be initialized"); err != nil {
+			log.Printf("couldn't fail payment %s: %s", referenceNumber, err)
+		}
+		http.Error(w, "We couldn't reach our payment provider, please try again", http.StatusBadGateway)
+		return
+	}
+
+	// htmx follows the HX-Redirect header, plain form posts follow the
+	// redirect
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", authorization.AuthorizationURL)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	http.Redirect(w, r, authorization.AuthorizationURL, http.StatusSeeOther)
+}
+
+func (h *HandlerManager) soloSavingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-savings-solo.html",
+	}
+
+	userSession, _ := h.getSessionOrLogout(w, r)
+	savingsInformation, err := h.store.GetSoloSaverScreenInformation(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Information":       savingsInformation,
+		"Balance":           savingsInformation.Balance,
+		csrf.TemplateTag:    csrf.TemplateField(r),
+		"HasPendingPayment": savingsInformation.HasPendingPayment,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// soloSavingsWithdrawPostHandler applies to withdraw from the solo
+// saver to one of the customer's bank accounts. The money is paid out
+// once the application has been approved.
+func (h *HandlerManager) soloSavingsWithdrawPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	r.ParseForm()
+
+	amount, err := ParseMoney(r.PostFormValue("withdrawal-amount"))
+	if err != nil || amount <= 0 {
+		http.Error(w, "Enter the amount you would like to withdraw", http.StatusUnprocessableEntity)
+		return
+	}
+
+	bankAccountID, err := strconv.ParseUint(r.PostFormValue("bank-account"), 10, 64)
+	if err != nil {
+		http.Error(w, "Select the account to withdraw to", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, err := h.store.GetBankAccount(userSession.UserID, uint(bankAccountID)); err == ErrBankAccountDoesNotExist {
+		http.Error(w, "Select the account to withdraw to", http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	information, err := h.store.GetSoloSaverScreenInformation(userSession.UserID)
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// savings on hold for loans the customer has guaranteed can't be withdrawn
+	if available := information.Balance - information.OnHold; amount > available {
+		http.Error(w, fmt.Sprintf("You can withdraw at most %s", available), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if _, err := h.store.CreateWithdrawalApplication(userSession.UserID, uint(bankAccountID), amount); err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", "/dashboard/transactions/solo-saver")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/transactions/solo-saver", http.StatusSeeOther)
+}
+
+func (h *HandlerManager) bankAccountsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-bank-accounts.html",
+	}
+
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	accounts, err := h.store.GetBankAccounts(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Accounts":       accounts,
+		"Banks":          Banks(),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+}
+
+// bankAccountsPostHandler links a bank account. The provider checks
+// that it exists, and the name on it is shown once it is linked.
+func (h *HandlerManager) bankAccountsPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+	r.ParseForm()
+
+	_, err = h.payouts.LinkBankAccount(r.Context(), userSession.UserID, r.PostFormValue("bank-code"), strings.TrimSpace(r.PostFormValue("account-number")))
+
+	switch {
+	case errors.Is(err, ErrUnknownBank):
+		http.Error(w, "Select your bank", http.StatusUnprocessableEntity)
+		return
+	case err == ErrInvalidAccountNumber:
+		http.Error(w, "Account numbers are 10 digits", http.StatusUnprocessableEntity)
+		return
+	case err == ErrBankAccountAlreadyLinked:
+		http.Error(w, "You have already linked this account", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		// most often the bank couldn't find the account
+		http.Error(w, "We couldn't find this account. Check the details and try again", http.StatusUnprocessableEntity)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", "/dashboard/bank-accounts")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	http.Redirect(w, r, "/dashboard/bank-accounts", http.StatusSeeOther)
+}
+
+func (h *HandlerManager) targetSavingsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-savings-target.html",
+	}
+
+	userSession, _ := h.getSessionOrLogout(w, r)
+	targetSavingsInformation, err := h.store.GetTargetSavingsScreenInformation(userSession.UserID)
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Information":    targetSavingsInformation,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (h *HandlerManager) targetSavingsPostHandler(w http.ResponseWriter, r *http.Request) {
+	// w.Header().Add("Content-Type", "text/html")
+	// userSession := h.getSessionOrLogout(w, r)
+
+	// r.ParseForm()
+
+}
+
+func (h *HandlerManager) thriftGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/dashboard-thrift.html",
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err := tmpl.ExecuteTemplate(w, "base", nil)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (h *HandlerManager) thriftNewGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/thrift-new.html",
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err := tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+// func (h *HandlerManager) thriftNewPostHandler(w http.ResponseWriter, r *http.Request) {
+// 	w.Header().Add("Content-Type", "text/html")
+// 	// TODO: Should return a fragment for htmx requests
+// 	r.ParseForm()
+// 	groupTitle := r.PostFormValue("title")
+// 	description := r.PostFormValue("description")
+// 	amount, err := strconv.ParseFloat(r.PostFormValue("amount"), 64)
+
+// 	// TODO: should handle form validation here
+
+// 	if err != nil {
+// 		// TODO: return a validation error to the client here.
+// 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+// 	}
+
+// 	numbersOfMembers, err := strconv.Atoi(r.PostFormValue("number-of-members"))
+
+// 	if err != nil {
+// 		// TODO: return a validation error to the client here.
+// 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+// 	}
+// 	frequency := r.PostFormValue("frequency")
+
+// 	session, err := h.cookieStore.Get(r, "session")
+
+// 	if err != nil {
+// 		log.Fatal(err)
+// 	}
+
+// 	userCookie, err := getSessionCookie(session)
+
+// 	if err != nil {
+// 		log.Fatal(err)
+// 	}
+
+// 	userSession, err := GetSession(userCookie.SessionID)
+
+// 	_, err = h.store.CreateNewThrift(userSession.UserID, groupTitle, description, amount, numbersOfMembers, frequency)
+
+// 	if err != nil {
+// 		w.WriteHeader(401)
+// 		tmpl, err := template.ParseFiles("./web_app/templates/register.html", "./web_app/templates/layouts/pre_auth-base.html")
+
+// 		if err != nil {
+// 			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+// 		}
+
+// 		tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+// 			"Errors": map[string]string{
+// 				"email": "error with email",
+// 			},
+// 		})
+// 		return
+// 	}
+// 	// TODO: redirect on success
+// 	// TODO: abstract the URLs
+// 	http.Redirect(w, r, "/login", 301)
+// }
+
+func (h *HandlerManager) thriftPlanGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	templateFiles := []string{
+		"./web_app/templates/layouts/dashboard-base.html",
+		"./web_app/templates/thrift-individual.html",
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err := tmpl.ExecuteTemplate(w, "base", nil)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func (h *HandlerManager) adminHomeGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/index.html",
+	}
+
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err == ErrNotAdmin {
+		// This block is very important.
+		// Without this block, users will still be able to see the content of the page
+		return
+	}
+
+	information, err := h.store.GetAdminHomeScreenInformation(userSession.UserID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	// TODO: check that the user is an admin while getting their sessionCookie
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"LoanRequests":        information.LoanRequests,
+		"LoansUnderReview":    information.LoansUnderReview,
+		"InvestmentsRequests": information.InvestmentsRequests,
+		"WithdrawalRequests":  information.WithdrawalRequests,
+		"ActionsToApprove":    information.ActionsToApprove,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong while trying to load the admin home page", http.StatusInternalServerError)
+	}
+}
+
+const adminWebhookListLimit = 100
+
+func (h *HandlerManager) adminWebhooksGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/webhooks.html",
+	}
+
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	if status != "" && status != StatusPending && status != StatusSuccessful && status != StatusFailed {
+		http.Error(w, "Unknown status", http.StatusUnprocessableEntity)
+		return
+	}
+
+	events, err := h.store.GetWebhookEvents(status, adminWebhookListLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Events":    events,
+		"Status":    status,
+		"csrfField": csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminWebhookReplayPostHandler processes a saved webhook event again.
+// Fulfillment is idempotent, so replaying a successful event is safe.
+func (h *HandlerManager) adminWebhookReplayPostHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	eventID, err := strconv.ParseUint(chi.URLParam(r, "eventID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown webhook event", http.StatusNotFound)
+		return
+	}
+
+	if _, err := h.webhooks.Replay(r.Context(), uint(eventID)); err != nil {
+		if errors.Is(err, ErrWebhookEventDoesNotExist) {
+			http.Error(w, "Unknown webhook event", http.StatusNotFound)
+			return
+		}
+		// the failure is recorded on the event and shown on the list
+		log.Printf("replaying webhook event %d failed: %s", eventID, err)
+	}
+
+	http.Redirect(w, r, "/admin/webhooks?status="+strings.ToLower(r.URL.Query().Get("status")), http.StatusSeeOther)
+}
+
+const adminPaymentListLimit = 100
+
+// adminPaymentsGetHandler lists the payments that the reconciliation
+// job flagged for review, and the latest reconciliation reports
+func (h *HandlerManager) adminPaymentsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/payments.html",
+	}
+
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	if reference := strings.TrimSpace(r.URL.Query().Get("reference")); reference != "" {
+		http.Redirect(w, r, "/admin/payments/"+url.PathEscape(reference), http.StatusSeeOther)
+		return
+	}
+
+	flagged, err := h.store.GetFlaggedPayments(adminPaymentListLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	reports, err := h.store.GetReconciliationReports(adminPaymentListLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Flagged": flagged,
+		"Reports": reports,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+const adminAuditLogLimit = 50
+
+// adminPaymentGetHandler shows a payment with its refunds, disputes and
+// audit log, and a form for refunding it
+func (h *HandlerManager) adminPaymentGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.renderAdminPayment(w, r, http.StatusOK, "")
+}
+
+// adminPaymentRefundPostHandler refunds some or all of a payment
+// through the provider it was made with
+func (h *HandlerManager) adminPaymentRefundPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	reference, err := uuid.Parse(chi.URLParam(r, "reference"))
+
+	if err != nil {
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	amount, err := ParseMoney(r.PostFormValue("amount"))
+	if err != nil || amount <= 0 {
+		h.renderAdminPayment(w, r, http.StatusUnprocessableEntity, "Enter the amount to refund")
+		return
+	}
+
+	reason := strings.TrimSpace(r.PostFormValue("reason"))
+	if reason == "" {
+		h.renderAdminPayment(w, r, http.StatusUnprocessableEntity, "Enter why the payment is being refunded")
+		return
+	}
+
+	refund, err := h.refunds.Refund(r.Context(), reference, amount, reason, adminActor(userSession.UserID))
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrReferenceNumberDoesNotExist):
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrRefundTooLarge), errors.Is(err, ErrRefundNotPaid):
+		h.renderAdminPayment(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	case errors.Is(err, ErrInsufficientLedgerFund):
+		h.renderAdminPayment(w, r, http.StatusUnprocessableEntity, "The customer no longer has that much of the payment in their account")
+		return
+	case refund.ID != 0:
+		// the provider turned it down, which is shown on the refund
+		log.Printf("refund %s of payment %s failed: %s", refund.Reference, reference, err)
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/payments/"+reference.String(), http.StatusSeeOther)
+}
+
+func (h *HandlerManager) renderAdminPayment(w http.ResponseWriter, r *http.Request, status int, refundError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/payment.html",
+	}
+
+	reference, err := uuid.Parse(chi.URLParam(r, "reference"))
+
+	if err != nil {
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	}
+
+	payment, err := h.store.GetPaystackVerificationInformation(reference.String())
+
+	if err == ErrReferenceNumberDoesNotExist {
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	refunds, err := h.store.GetRefunds(reference)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	disputes, err := h.store.GetDisputes(reference)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	auditLog, err := h.store.GetAuditLog(paymentAuditSubject(reference), adminAuditLogLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Payment":        payment,
+		"Refunds":        refunds,
+		"Disputes":       disputes,
+		"AuditLog":       auditLog,
+		"RefundError":    refundError,
+		"Amount":         r.PostFormValue("amount"),
+		"Reason":         r.PostFormValue("reason"),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminLoanApplicationsGetHandler lists loan applications a page at a
+// time, oldest first unless another order is asked for
+func (h *HandlerManager) adminLoanApplicationsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/queue.html",
+		"./web_app/templates/admin/loan-applications.html",
+	}
+
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	filter, err := adminQueueFilter(r.URL.Query(), isLoanApplicationStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	applications, err := h.store.GetLoanApplications(filter)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	applications, hasNext := queuePage(applications)
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Applications": applications,
+		"Filter":       filter,
+		"HasNext":      hasNext,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminLoanApplicationGetHandler shows a loan application with the
+// customer's other applications and its audit log, and the decisions
+// that can be made on it
+func (h *HandlerManager) adminLoanApplicationGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.renderAdminLoanApplication(w, r, http.StatusOK, "")
+}
+
+// adminLoanApplicationDecisionPostHandler moves an application under
+// review, or approves or rejects it with a note saying why. Approved
+// applications are paid out straight away, and customers are told
+// when theirs is rejected.
+func (h *HandlerManager) adminLoanApplicationDecisionPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	status := r.PostFormValue("status")
+	if status != LoanApplicationUnderReview && status != LoanApplicationApproved && status != LoanApplicationRejected {
+		h.renderAdminLoanApplication(w, r, http.StatusUnprocessableEntity, "Choose a decision")
+		return
+	}
+
+	note := strings.TrimSpace(r.PostFormValue("note"))
+	if status != LoanApplicationUnderReview {
+		if note, err = decisionNote(note); err != nil {
+			h.renderAdminLoanApplication(w, r, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+
+	// large loans wait for a second admin to approve them
+	if status == LoanApplicationApproved {
+		application, err := h.store.GetLoanApplication(uint(applicationID))
+
+		if err == ErrLoanApplicationDoesNotExist {
+			http.Error(w, "Unknown loan application", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "Something went wrong", http.StatusInternalServerError)
+			log.Printf("error %q from url %q", err, r.URL.Path)
+			return
+		}
+
+		if application.Amount > h.approvals.LargeLoan {
+			if err := checkLoanApproval(application); err != nil {
+				h.renderAdminLoanApplication(w, r, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			h.proposeAdminAction(w, r, LoanApproval{ApplicationID: application.ID, Amount: application.Amount}, userSession.UserID, note, h.renderAdminLoanApplication)
+			return
+		}
+	}
+
+	application, err := h.store.TransitionLoanApplication(uint(applicationID), status, userSession.UserID, note)
+
+	switch {
+	case err == nil:
+	case err == ErrLoanApplicationDoesNotExist:
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrLoanApplicationTransition), err == ErrLoanApplicationNoteRequired, err == ErrGuarantorConsentRequired:
+		h.renderAdminLoanApplication(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	switch status {
+	case LoanApplicationApproved:
+		if err := h.disburseLoanApplication(r, application.ID, userSession.UserID); err != nil {
+			log.Printf("error %q from url %q", err, r.URL.Path)
+		}
+	case LoanApplicationRejected:
+		h.notifyCustomer(r, application.CustomerID, func(contact CustomerContact) (string, string) {
+			return loanApplicationRejectedNotice(contact, application, h.baseURL)
+		})
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/loan-applications/%d", applicationID), http.StatusSeeOther)
+}
+
+// adminLoanApplicationDisbursePostHandler pays an approved application
+// out to the customer's bank account
+func (h *HandlerManager) adminLoanApplicationDisbursePostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	}
+
+	switch err := h.disburseLoanApplication(r, uint(applicationID), userSession.UserID); {
+	case err == ErrLoanApplicationDoesNotExist:
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrLoanApplicationTransition):
+		h.renderAdminLoanApplication(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/loan-applications/%d", applicationID), http.StatusSeeOther)
+}
+
+// disburseLoanApplication pays an approved application out. Payouts
+// that fail are logged rather than returned: ones the provider couldn't
+// be asked to send are sent again by the payout sweep, failed ones are
+// given back when their transfer webhook arrives, and applications
+// that couldn't be paid out go back to approved with why as their note.
+// Only errors from before the payout was tried are returned.
+func (h *HandlerManager) disburseLoanApplication(r *http.Request, applicationID, adminID uint) error {
+	payout, err := disburseLoanApplication(r.Context(), h.store, h.payouts, applicationID, adminID)
+
+	switch {
+	case err == nil:
+	case err == ErrLoanApplicationDoesNotExist, errors.Is(err, ErrLoanApplicationTransition):
+		return err
+	case payout.ID != 0:
+		log.Printf("payout %s for loan application %d: %s", payout.Reference, applicationID, err)
+	default:
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+
+	return nil
+}
+
+func (h *HandlerManager) renderAdminLoanApplication(w http.ResponseWriter, r *http.Request, status int, decisionError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/loan-application.html",
+		"./web_app/templates/admin/actions-table.html",
+	}
+
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	}
+
+	application, err := h.store.GetLoanApplication(uint(applicationID))
+
+	if err == ErrLoanApplicationDoesNotExist {
+		http.Error(w, "Unknown loan application", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	bankAccount, err := h.store.GetBankAccount(application.CustomerID, application.BankAccountID)
+
+	if err != nil && err != ErrBankAccountDoesNotExist {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	history, err := h.store.GetCustomerLoanApplications(application.CustomerID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	auditLog, err := h.store.GetAuditLog(loanApplicationAuditSubject(application.ID), adminAuditLogLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	guarantors, err := h.store.GetLoanGuarantors(application.ID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	var statement *BankStatementAnalysis
+	analysis, err := h.store.GetLoanApplicationStatement(application.ID)
+
+	switch {
+	case err == nil:
+		statement = &analysis
+	case err != ErrBankStatementNotFound:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	adminActions, err := h.store.GetSubjectAdminActions(loanApplicationAuditSubject(application.ID))
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Application":      application,
+		"BankAccount":      bankAccount,
+		"History":          history,
+		"AuditLog":         auditLog,
+		"Statement":        statement,
+		"Guarantors":       guarantors,
+		"DecisionError":    decisionError,
+		"Note":             r.PostFormValue("note"),
+		"CanReview":        application.Status == LoanApplicationSubmitted,
+		"CanApprove":       application.Status == LoanApplicationUnderReview,
+		"CanReject":        canTransitionLoanApplication(application.Status, LoanApplicationRejected),
+		"CanDisburse":      application.Status == LoanApplicationApproved,
+		"AdminActions":     adminActions,
+		"NeedsSecondAdmin": application.Amount > h.approvals.LargeLoan,
+		csrf.TemplateTag:   csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+const adminOverdueLoanListLimit = 100
+
+// adminOverdueLoansGetHandler lists late loans, latest first, with who
+// to contact about them. ?bucket= narrows it to one delinquency bucket.
+func (h *HandlerManager) adminOverdueLoansGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/overdue-loans.html",
+	}
+
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	bucket := strings.ToUpper(r.URL.Query().Get("bucket"))
+	if bucket != "" && (!isDelinquencyBucket(bucket) || bucket == DelinquencyCurrent) {
+		http.Error(w, "Unknown bucket", http.StatusUnprocessableEntity)
+		return
+	}
+
+	loans, err := h.store.GetOverdueLoans(bucket, adminOverdueLoanListLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Loans":  loans,
+		"Bucket": bucket,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminInvestmentsGetHandler shows the investment products
+func (h *HandlerManager) adminInvestmentsGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.renderAdminInvestments(w, r, http.StatusOK, nil)
+}
+
+func (h *HandlerManager) renderAdminInvestments(w http.ResponseWriter, r *http.Request, status int, errorsMap map[string]string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/investments.html",
+	}
+
+	products, err := h.store.GetInvestmentProducts(false)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		csrf.TemplateTag: csrf.TemplateField(r),
+		"Products":       products,
+		"Errors":         errorsMap,
+		"Form":           r.PostForm,
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminInvestmentProductsPostHandler adds an investment product
+func (h *HandlerManager) adminInvestmentProductsPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	r.ParseForm()
+
+	product := InvestmentProduct{Name: strings.TrimSpace(r.PostFormValue("name"))}
+
+	// the rate is entered as a percentage, e.g. 12.5
+	rate, err := ParseMoney(r.PostFormValue("annual-rate"))
+	if err != nil {
+		h.renderAdminInvestments(w, r, http.StatusUnprocessableEntity, map[string]string{"Product": "Enter the rate as a percentage a year, e.g. 12.5"})
+		return
+	}
+	product.AnnualRate = int64(rate)
+
+	if product.MinimumAmount, err = ParseMoney(r.PostFormValue("minimum-amount")); err != nil {
+		h.renderAdminInvestments(w, r, http.StatusUnprocessableEntity, map[string]string{"Product": "Enter the smallest amount that can be invested"})
+		return
+	}
+
+	if product.Tenors, err = parseInvestmentTenors(r.PostFormValue("tenors")); err != nil {
+		h.renderAdminInvestments(w, r, http.StatusUnprocessableEntity, map[string]string{"Product": err.Error()})
+		return
+	}
+
+	_, err = h.store.CreateInvestmentProduct(product, userSession.UserID)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidInvestmentProduct), err == ErrInvestmentProductExists:
+		h.renderAdminInvestments(w, r, http.StatusUnprocessableEntity, map[string]string{"Product": err.Error()})
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/investments", http.StatusSeeOther)
+}
+
+// adminInvestmentProductActivePostHandler stops offering a product, or
+// offers it again. Positions that are already open keep their terms.
+func (h *HandlerManager) adminInvestmentProductActivePostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	productID, err := strconv.ParseUint(chi.URLParam(r, "productID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment product", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	err = h.store.SetInvestmentProductActive(uint(productID), r.PostFormValue("active") == "true", userSession.UserID)
+
+	switch {
+	case err == nil:
+	case err == ErrInvestmentProductDoesNotExist:
+		http.Error(w, "Unknown investment product", http.StatusNotFound)
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/investments", http.StatusSeeOther)
+}
+
+// adminInvestmentApplicationsGetHandler lists submitted investment
+// applications, oldest first, so that the ones that have waited
+// longest are decided first
+func (h *HandlerManager) adminInvestmentApplicationsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/queue.html",
+		"./web_app/templates/admin/investment-applications.html",
+	}
+
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	filter, err := adminQueueFilter(r.URL.Query(), isInvestmentApplicationStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	applications, err := h.store.GetInvestmentApplications(filter)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	applications, hasNext := queuePage(applications)
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Applications": applications,
+		"Filter":       filter,
+		"HasNext":      hasNext,
+	})
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminInvestmentApplicationGetHandler shows an investment application
+// with the customer's other applications and its audit log
+func (h *HandlerManager) adminInvestmentApplicationGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	h.renderAdminInvestmentApplication(w, r, http.StatusOK, "")
+}
+
+// adminInvestmentApplicationDecisionPostHandler approves an
+// application, so that the customer can pay for it, or rejects it.
+// Either way the customer is told, with the note saying why.
+func (h *HandlerManager) adminInvestmentApplicationDecisionPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+
+	var application InvestmentApplication
+
+	switch r.PostFormValue("status") {
+	case InvestmentApplicationApproved:
+		application, err = h.store.ApproveInvestmentApplication(uint(applicationID), userSession.UserID, r.PostFormValue("note"))
+	case InvestmentApplicationRejected:
+		application, err = h.store.RejectInvestmentApplication(uint(applicationID), userSession.UserID, r.PostFormValue("note"))
+	default:
+		h.renderAdminInvestmentApplication(w, r, http.StatusUnprocessableEntity, "Choose a decision")
+		return
+	}
+
+	switch {
+	case err == nil:
+	case err == ErrInvestmentApplicationDoesNotExist:
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
+	case err == ErrInvestmentApplicationDecided, err == ErrDecisionNoteRequired, err == ErrInvestmentProductDoesNotExist, err == ErrInvestmentBelowMinimum, err == ErrInvestmentTenor:
+		h.renderAdminInvestmentApplication(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	h.notifyCustomer(r, application.CustomerID, func(contact CustomerContact) (string, string) {
+		return investmentApplicationDecisionNotice(contact, application, h.baseURL)
+	})
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/investment-applications/%d", applicationID), http.StatusSeeOther)
 }
 
-func (h *HandlerManager) addBVNPostHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+func (h *HandlerManager) renderAdminInvestmentApplication(w http.ResponseWriter, r *http.Request, status int, decisionError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/investment-application.html",
+	}
 
-	bvn := r.FormValue("bvn")
-	// TODO: validation
-	if bvn == "" {
-		// TODO: send an error
+	applicationID, err := strconv.ParseUint(chi.URLParam(r, "applicationID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
 	}
 
-	// TODO: store the BVN/send it to somewhere for validation
+	application, err := h.store.GetInvestmentApplication(uint(applicationID))
 
-	w.Header().Add("Content-Type", "text/html")
-	fragment, err := template.ParseFiles("./web_app/templates/fragments/verification-success.html")
+	// drafts haven't been sent to be reviewed
+	if err == ErrInvestmentApplicationDoesNotExist || application.Status == InvestmentApplicationDraft {
+		http.Error(w, "Unknown investment application", http.StatusNotFound)
+		return
+	}
 
-	// TODO: handle err
 	if err != nil {
-		log.Fatalf("error with fragment %q", err)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
 
-	fragment.Execute(w, VerificationData{
-		Message: "Your BVN has been verified",
+	applications, err := h.store.GetCustomerInvestmentApplications(application.CustomerID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	auditLog, err := h.store.GetAuditLog(investmentApplicationAuditSubject(application.ID), adminAuditLogLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	var history []InvestmentApplication
+	for _, other := range applications {
+		if other.Status != InvestmentApplicationDraft {
+			history = append(history, other)
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Application":    application,
+		"History":        history,
+		"AuditLog":       auditLog,
+		"DecisionError":  decisionError,
+		"Note":           r.PostFormValue("note"),
+		"CanDecide":      application.Status == InvestmentApplicationPending,
+		csrf.TemplateTag: csrf.TemplateField(r),
 	})
 
-	w.WriteHeader(201)
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
 }
 
-func (h *HandlerManager) familyVaultGetHandler(w http.ResponseWriter, r *http.Request) {
+// adminWithdrawalsGetHandler lists solo saver withdrawals a page at a
+// time, oldest first unless another order is asked for
+func (h *HandlerManager) adminWithdrawalsGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
+
 	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-savings-family.html",
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/queue.html",
+		"./web_app/templates/admin/withdrawals.html",
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	_, err := h.getAdminSessionOrLogout(w, r)
 
-	familyVaultInformation, err := h.store.GetFamilyVaultScreenInformation(userSession.UserID)
+	if err != nil {
+		return
+	}
+
+	filter, err := adminQueueFilter(r.URL.Query(), isWithdrawalQueueStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	withdrawals, err := h.store.GetWithdrawalApplications(filter)
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
@@ -796,78 +3191,198 @@ func (h *HandlerManager) familyVaultGetHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	withdrawals, hasNext := queuePage(withdrawals)
+
 	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Balance":        familyVaultInformation.Balance,
-		"Plans":          familyVaultInformation.FamilyVaultBasicPlans,
-		csrf.TemplateTag: csrf.TemplateField(r),
+		"Withdrawals": withdrawals,
+		"Filter":      filter,
+		"HasNext":     hasNext,
 	})
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminWithdrawalGetHandler shows a withdrawal with what the customer
+// can withdraw and its audit log
+func (h *HandlerManager) adminWithdrawalGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
 		return
 	}
 
-	w.WriteHeader(200)
+	h.renderAdminWithdrawal(w, r, http.StatusOK, "")
 }
 
-func (h *HandlerManager) familyVaultPostHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	// TODO: Should return a fragment for htmx requests
+// adminWithdrawalDecisionPostHandler approves a withdrawal and pays it
+// out, or rejects it and tells the customer why
+func (h *HandlerManager) adminWithdrawalDecisionPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	withdrawalID, err := strconv.ParseUint(chi.URLParam(r, "withdrawalID"), 10, 64)
+
+	if err != nil {
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
+		return
+	}
 
 	r.ParseForm()
-	familyName := r.PostFormValue("family-name")
-	familyMember := r.PostFormValue("family-member")
-	amount, err := strconv.ParseFloat(r.PostFormValue("amount"), 64)
-	savingsFrequency := r.PostFormValue("savings-frequency")
-	savingsDuration, err := strconv.ParseInt(r.PostFormValue("duration"), 10, 64)
 
-	// TODO: should handle form validation here
+	var payout Payout
+
+	switch r.PostFormValue("status") {
+	case WithdrawalApproved:
+		// large withdrawals wait for a second admin to approve them
+		var withdrawal WithdrawalApplication
+		if withdrawal, err = h.store.GetWithdrawalApplication(uint(withdrawalID)); err == nil && withdrawal.Amount > h.approvals.LargeWithdrawal {
+			if withdrawal.QueueStatus() != StatusPending {
+				h.renderAdminWithdrawal(w, r, http.StatusUnprocessableEntity, ErrWithdrawalDecided.Error())
+				return
+			}
+			h.proposeAdminAction(w, r, WithdrawalApproval{WithdrawalID: withdrawal.ID, Amount: withdrawal.Amount}, userSession.UserID, r.PostFormValue("note"), h.renderAdminWithdrawal)
+			return
+		}
+		if err == nil {
+			payout, err = approveWithdrawal(r.Context(), h.store, h.payouts, uint(withdrawalID), userSession.UserID, r.PostFormValue("note"))
+		}
+	case WithdrawalRejected:
+		var withdrawal WithdrawalApplication
+		if withdrawal, err = h.store.RejectWithdrawalApplication(uint(withdrawalID), userSession.UserID, r.PostFormValue("note")); err == nil {
+			h.notifyCustomer(r, withdrawal.CustomerID, func(contact CustomerContact) (string, string) {
+				return withdrawalRejectedNotice(contact, withdrawal, h.baseURL)
+			})
+		}
+	default:
+		h.renderAdminWithdrawal(w, r, http.StatusUnprocessableEntity, "Choose a decision")
+		return
+	}
+
+	switch {
+	case err == nil:
+	case err == ErrWithdrawalDoesNotExist:
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
+		return
+	case err == ErrWithdrawalDecided, err == ErrDecisionNoteRequired:
+		h.renderAdminWithdrawal(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	case payout.ID != 0:
+		// the payout is sent again, or given back, when its transfer
+		// webhook arrives
+		log.Printf("payout %s for withdrawal %d: %s", payout.Reference, withdrawalID, err)
+	default:
+		// the withdrawal stays approved, and can be paid out again
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/withdrawals/%d", withdrawalID), http.StatusSeeOther)
+}
+
+// adminWithdrawalPayoutPostHandler pays out an approved withdrawal that
+// couldn't be paid out when it was approved
+func (h *HandlerManager) adminWithdrawalPayoutPostHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
 
 	if err != nil {
-		// TODO: return a validation error to the client here.
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		return
 	}
 
-	information, err := h.store.CreateNewFamilyVault(userSession.UserID, familyName, familyMember, amount, savingsFrequency, savingsDuration)
+	withdrawalID, err := strconv.ParseUint(chi.URLParam(r, "withdrawalID"), 10, 64)
 
 	if err != nil {
-		log.Printf("An error occured while trying to create a family vault %s", err)
-		h.logout(w, r)
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
 		return
 	}
-	// TODO: redirect on success
-	// TODO: abstract the URLs
-	http.Redirect(w, r, fmt.Sprintf("/dashboard/savings/family-vault/%d", information.PlanID), http.StatusOK)
+
+	withdrawal, err := h.store.GetWithdrawalApplication(uint(withdrawalID))
+
+	if err == ErrWithdrawalDoesNotExist {
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	if !withdrawal.CanPayOut() {
+		h.renderAdminWithdrawal(w, r, http.StatusUnprocessableEntity, "Only approved withdrawals that haven't been paid out can be paid out")
+		return
+	}
+
+	if payout, err := h.payouts.PayWithdrawal(r.Context(), withdrawal.ID); err != nil && payout.ID != 0 {
+		log.Printf("payout %s for withdrawal %d: %s", payout.Reference, withdrawalID, err)
+	} else if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/withdrawals/%d", withdrawalID), http.StatusSeeOther)
 }
 
-func (h *HandlerManager) familyVaultPlanGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
+func (h *HandlerManager) renderAdminWithdrawal(w http.ResponseWriter, r *http.Request, status int, decisionError string) {
 	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-savings-family-plan.html",
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/withdrawal.html",
+		"./web_app/templates/admin/actions-table.html",
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	withdrawalID, err := strconv.ParseUint(chi.URLParam(r, "withdrawalID"), 10, 64)
 
-	planID := chi.URLParam(r, "planID")
-	convertedPlanID, err := strconv.Atoi(planID)
+	if err != nil {
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
+		return
+	}
+
+	withdrawal, err := h.store.GetWithdrawalApplication(uint(withdrawalID))
+
+	if err == ErrWithdrawalDoesNotExist {
+		http.Error(w, "Unknown withdrawal", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
-		// TODO: return a 404 here
-		http.Error(w, "Something went wrong", http.StatusNotFound)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	familyVaultPlanInformation, err := h.store.GetFamilyVaultPlanScreenInformation(userSession.UserID, convertedPlanID)
+	bankAccount, err := h.store.GetBankAccount(withdrawal.CustomerID, withdrawal.BankAccountID)
+
+	if err != nil && err != ErrBankAccountDoesNotExist {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	savings, err := h.store.GetSoloSaverScreenInformation(withdrawal.CustomerID)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	auditLog, err := h.store.GetAuditLog(withdrawalAuditSubject(withdrawal.ID), adminAuditLogLimit)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	adminActions, err := h.store.GetSubjectAdminActions(withdrawalAuditSubject(withdrawal.ID))
 
 	if err != nil {
-		// TODO: here we would want to check the type of error and check for why it's having that error then display an appropriate error to the user with an appropriate error code
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
@@ -875,140 +3390,221 @@ func (h *HandlerManager) familyVaultPlanGetHandler(w http.ResponseWriter, r *htt
 
 	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Information":     familyVaultPlanInformation,
-		"Balance":         familyVaultPlanInformation.Balance,
-		"csrfToken":       csrf.Token(r),
-		"ReferenceNumber": h.generatePaymentUUID(),
-		"PlanID":          planID,
+		"Withdrawal":  withdrawal,
+		"BankAccount": bankAccount,
+		// savings on hold for loans the customer has guaranteed can't
+		// be withdrawn
+		"Available":        savings.Balance - savings.OnHold,
+		"AuditLog":         auditLog,
+		"DecisionError":    decisionError,
+		"Note":             r.PostFormValue("note"),
+		"CanDecide":        withdrawal.QueueStatus() == StatusPending,
+		"AdminActions":     adminActions,
+		"NeedsSecondAdmin": withdrawal.Amount > h.approvals.LargeWithdrawal,
+		csrf.TemplateTag:   csrf.TemplateField(r),
 	})
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminRolesGetHandler shows every admin with their roles, and what
+// each role lets them do
+func (h *HandlerManager) adminRolesGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	h.renderAdminRoles(w, r, http.StatusOK, "")
 }
 
-func (h *HandlerManager) soloSavingsAddFunds(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
+// adminRolesPostHandler replaces the roles of the customer with the
+// email address, making them an admin if they weren't one
+func (h *HandlerManager) adminRolesPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	if err != nil {
+		return
+	}
+
+	r.ParseForm()
+
+	admin, err := h.store.AssignAdminRoles(r.PostFormValue("email"), r.PostForm["role"], userSession.UserID)
 
-	decoder := json.NewDecoder(r.Body)
-	var data SoloSaverAddFundsRequestType
+	switch err {
+	case nil:
+	case ErrAccountDoesNotExist:
+		h.renderAdminRoles(w, r, http.StatusUnprocessableEntity, "No customer has that email address")
+		return
+	case ErrUnknownAdminRole, ErrCantRemoveOwnRoleGrant:
+		h.renderAdminRoles(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
 
-	err := decoder.Decode(&data)
+	// whether someone is an admin is decided when they log in, so
+	// others are logged out for their new roles to take effect
+	if admin.CustomerID != userSession.UserID {
+		EndUserSessions(admin.CustomerID)
+	}
 
-	// we receive the data from the frontend, then we update the DB with the information as a pending payment.
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
 
-	// when that payment gets verified, then it becomes a
-	// successful payment.
+func (h *HandlerManager) renderAdminRoles(w http.ResponseWriter, r *http.Request, status int, assignError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/roles.html",
+	}
 
-	// but it hardly gets verified in this flow
+	admins, err := h.store.GetAdmins()
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusBadRequest)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	// the planID field is 99909990 by convention. It doesn't mean anything for soloSavings
-	_, err = h.store.CreatePayment(userSession.UserID, 99909990, data.ReferenceNumber, "SOLO_SAVINGS", data.Amount)
+	roles, err := h.store.GetAdminRoles()
 
 	if err != nil {
-		http.Error(w, "Something went wrong while trying to save your transaction", http.StatusInternalServerError)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *HandlerManager) familySavingsAddFunds(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
 
-	decoder := json.NewDecoder(r.Body)
-	var data SoloSaverAddFundsRequestType
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Admins":         admins,
+		"Roles":          roles,
+		"Permissions":    adminPermissions,
+		"AssignError":    assignError,
+		"Email":          r.PostFormValue("email"),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
 
-	err := decoder.Decode(&data)
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
 
-	planID := chi.URLParam(r, "planID")
-	convertedPlanID, err := strconv.Atoi(planID)
+// adminUserGetHandler shows a customer's account, whether it is
+// suspended, and its audit log
+func (h *HandlerManager) adminUserGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
 
-	// we receive the data from the frontend, then we update the DB with the information as a pending payment.
+	if err != nil {
+		return
+	}
 
-	// when that payment gets verified, then it becomes a
-	// successful payment.
+	h.renderAdminUser(w, r, http.StatusOK, "")
+}
 
-	// but it hardly gets verified in this flow
+// adminUserSuspensionPostHandler suspends a customer's account and logs
+// them out, or reinstates it
+func (h *HandlerManager) adminUserSuspensionPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusBadRequest)
-		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	// the planID field is 99909990 by convention. It doesn't mean anything for soloSavings
-	_, err = h.store.CreatePayment(userSession.UserID, uint(convertedPlanID), data.ReferenceNumber, "FAMILY_SAVINGS", data.Amount)
+	customerID, err := strconv.ParseUint(chi.URLParam(r, "customerID"), 10, 64)
 
 	if err != nil {
-		http.Error(w, "Something went wrong while trying to save your transaction", http.StatusInternalServerError)
+		http.Error(w, "Unknown customer", http.StatusNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
+	r.ParseForm()
 
-func (h *HandlerManager) targetSavingsAddFunds(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "application/json")
+	switch r.PostFormValue("suspended") {
+	case "true":
+		if _, err = h.store.SuspendCustomer(uint(customerID), userSession.UserID, r.PostFormValue("note")); err == nil {
+			EndUserSessions(uint(customerID))
+		}
+	case "false":
+		_, err = h.store.ReinstateCustomer(uint(customerID), userSession.UserID, r.PostFormValue("note"))
+	default:
+		h.renderAdminUser(w, r, http.StatusUnprocessableEntity, "Choose whether to suspend or reinstate the account")
+		return
+	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
+	switch err {
+	case nil:
+	case ErrAccountDoesNotExist:
+		http.Error(w, "Unknown customer", http.StatusNotFound)
+		return
+	case ErrDecisionNoteRequired, ErrCantSuspendYourself:
+		h.renderAdminUser(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
 
-	decoder := json.NewDecoder(r.Body)
-	var data SoloSaverAddFundsRequestType
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d", customerID), http.StatusSeeOther)
+}
 
-	err := decoder.Decode(&data)
+func (h *HandlerManager) renderAdminUser(w http.ResponseWriter, r *http.Request, status int, formError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/user.html",
+		"./web_app/templates/admin/actions-table.html",
+	}
 
-	planID := chi.URLParam(r, "planID")
-	convertedPlanID, err := strconv.Atoi(planID)
+	customerID, err := strconv.ParseUint(chi.URLParam(r, "customerID"), 10, 64)
 
-	// we receive the data from the frontend, then we update the DB with the information as a pending payment.
+	if err != nil {
+		http.Error(w, "Unknown customer", http.StatusNotFound)
+		return
+	}
 
-	// when that payment gets verified, then it becomes a
-	// successful payment.
+	account, err := h.store.GetCustomerAccount(uint(customerID))
 
-	// but it hardly gets verified in this flow
+	if err == ErrAccountDoesNotExist {
+		http.Error(w, "Unknown customer", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusBadRequest)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	// the planID field is 99909990 by convention. It doesn't mean anything for soloSavings
-	_, err = h.store.CreatePayment(userSession.UserID, uint(convertedPlanID), data.ReferenceNumber, "TARGET_SAVINGS", data.Amount)
+	auditLog, err := h.store.GetAuditLog(customerAuditSubject(account.ID), adminAuditLogLimit)
 
 	if err != nil {
-		http.Error(w, "Something went wrong while trying to save your transaction", http.StatusInternalServerError)
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
+	roleLog, err := h.store.GetAuditLog(adminAuditSubject(account.ID), adminAuditLogLimit)
 
-func (h *HandlerManager) soloSavingsGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-savings-solo.html",
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
-	savingsInformation, err := h.store.GetSoloSaverScreenInformation(userSession.UserID)
+	adminActions, err := h.store.GetSubjectAdminActions(customerAuditSubject(account.ID))
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
@@ -1018,68 +3614,107 @@ func (h *HandlerManager) soloSavingsGetHandler(w http.ResponseWriter, r *http.Re
 
 	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
+
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Information":       savingsInformation,
-		"Balance":           humanize.Comma(int64(savingsInformation.Balance)),
-		"csrfToken":         csrf.Token(r),
-		"ReferenceNumber":   h.generatePaymentUUID(),
-		"PublicKey":         h.paystackPublicKey,
-		"HasPendingPayment": savingsInformation.HasPendingPayment,
+		"Account":        account,
+		"AuditLog":       auditLog,
+		"RoleLog":        roleLog,
+		"FormError":      formError,
+		"Note":           r.PostFormValue("note"),
+		"AdminActions":   adminActions,
+		"Amount":         r.PostFormValue("amount"),
+		"Adjusting":      strings.HasSuffix(r.URL.Path, "/adjustments"),
+		csrf.TemplateTag: csrf.TemplateField(r),
 	})
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
-		return
 	}
-
-	w.WriteHeader(200)
 }
 
-func (h *HandlerManager) targetSavingsGetHandler(w http.ResponseWriter, r *http.Request) {
+// adminActionsGetHandler lists the actions that admins have proposed,
+// waiting ones oldest first
+func (h *HandlerManager) adminActionsGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
+
 	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-savings-target.html",
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/queue.html",
+		"./web_app/templates/admin/actions.html",
 	}
 
-	userSession, _ := h.getSessionOrLogout(w, r)
-	targetSavingsInformation, err := h.store.GetTargetSavingsScreenInformation(userSession.UserID)
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
+		return
+	}
+
+	filter, err := adminQueueFilter(r.URL.Query(), isAdminActionStatus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	actions, err := h.store.GetAdminActions(filter)
+
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
+
+	actions, hasNext := queuePage(actions)
 
 	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
 	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"Information":    targetSavingsInformation,
-		csrf.TemplateTag: csrf.TemplateField(r),
+		"Actions": actions,
+		"Filter":  filter,
+		"HasNext": hasNext,
 	})
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+// adminActionGetHandler shows an action with its audit log
+func (h *HandlerManager) adminActionGetHandler(w http.ResponseWriter, r *http.Request) {
+	_, err := h.getAdminSessionOrLogout(w, r)
+
+	if err != nil {
 		return
 	}
 
-	w.WriteHeader(200)
+	h.renderAdminAction(w, r, http.StatusOK, "")
 }
 
-func (h *HandlerManager) targetSavingsPostHandler(w http.ResponseWriter, r *http.Request) {
-	// w.Header().Add("Content-Type", "text/html")
-	// userSession := h.getSessionOrLogout(w, r)
+// adminActionDecisionPostHandler approves an action and carries it out,
+// or rejects it. Only admins with the permission the action needs can
+// decide it, and only one that didn't propose it can approve it.
+func (h *HandlerManager) adminActionDecisionPostHandler(w http.ResponseWriter, r *http.Request) {
+	userSession, err := h.getAdminSessionOrLogout(w, r)
 
-	// r.ParseForm()
+	if err != nil {
+		return
+	}
 
-}
+	actionID, err := strconv.ParseUint(chi.URLParam(r, "actionID"), 10, 64)
 
-func (h *HandlerManager) thriftGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/dashboard-thrift.html",
+	if err != nil {
+		http.Error(w, "Unknown admin action", http.StatusNotFound)
+		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	action, err := h.store.GetAdminAction(uint(actionID))
 
-	err := tmpl.ExecuteTemplate(w, "base", nil)
+	if err == ErrAdminActionDoesNotExist {
+		http.Error(w, "Unknown admin action", http.StatusNotFound)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
@@ -1087,100 +3722,104 @@ func (h *HandlerManager) thriftGetHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	w.WriteHeader(200)
-}
+	permissions, err := h.store.GetAdminPermissions(userSession.UserID)
 
-func (h *HandlerManager) thriftNewGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/thrift-new.html",
+	if err != nil && err != ErrNotAdmin {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	if !permissions.Has(action.Permission()) {
+		http.Error(w, fmt.Sprintf("Forbidden: you need the %s permission", action.Permission()), http.StatusForbidden)
+		return
+	}
 
-	err := tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		csrf.TemplateTag: csrf.TemplateField(r),
-	})
+	r.ParseForm()
 
-	if err != nil {
+	switch r.PostFormValue("status") {
+	case AdminActionApproved:
+		action, err = approveAdminAction(r.Context(), h.store, h.store, h.payouts, action.ID, userSession.UserID, r.PostFormValue("note"))
+	case AdminActionRejected:
+		action, err = h.store.RejectAdminAction(action.ID, userSession.UserID, r.PostFormValue("note"))
+	default:
+		h.renderAdminAction(w, r, http.StatusUnprocessableEntity, "Choose a decision")
+		return
+	}
+
+	switch {
+	case err == nil:
+	case err == ErrDecisionNoteRequired, err == ErrAdminActionDecided, err == ErrAdminActionSameAdmin:
+		h.renderAdminAction(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	case action.Status == AdminActionFailed:
+		// the failure is shown with the action
+		log.Printf("admin action %d failed: %s", action.ID, err)
+	default:
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
 		log.Printf("error %q from url %q", err, r.URL.Path)
 		return
 	}
 
-	w.WriteHeader(200)
+	http.Redirect(w, r, fmt.Sprintf("/admin/actions/%d", actionID), http.StatusSeeOther)
 }
 
-// func (h *HandlerManager) thriftNewPostHandler(w http.ResponseWriter, r *http.Request) {
-// 	w.Header().Add("Content-Type", "text/html")
-// 	// TODO: Should return a fragment for htmx requests
-// 	r.ParseForm()
-// 	groupTitle := r.PostFormValue("title")
-// 	description := r.PostFormValue("description")
-// 	amount, err := strconv.ParseFloat(r.PostFormValue("amount"), 64)
-
-// 	// TODO: should handle form validation here
-
-// 	if err != nil {
-// 		// TODO: return a validation error to the client here.
-// 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-// 	}
-
-// 	numbersOfMembers, err := strconv.Atoi(r.PostFormValue("number-of-members"))
-
-// 	if err != nil {
-// 		// TODO: return a validation error to the client here.
-// 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-// 	}
-// 	frequency := r.PostFormValue("frequency")
+// proposeAdminAction saves an action for a second admin to approve, and
+// shows it. What is wrong with the proposal is shown with render.
+func (h *HandlerManager) proposeAdminAction(w http.ResponseWriter, r *http.Request, payload AdminActionPayload, adminID uint, note string, render func(http.ResponseWriter, *http.Request, int, string)) {
+	action, err := newAdminAction(payload, adminID, note)
 
-// 	session, err := h.cookieStore.Get(r, "session")
+	if err == nil {
+		action, err = h.store.ProposeAdminAction(action)
+	}
 
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
+	switch err {
+	case nil:
+	case ErrDecisionNoteRequired, ErrAdminActionPending:
+		render(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	default:
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
 
-// 	userCookie, err := getSessionCookie(session)
+	http.Redirect(w, r, fmt.Sprintf("/admin/actions/%d", action.ID), http.StatusSeeOther)
+}
 
-// 	if err != nil {
-// 		log.Fatal(err)
-// 	}
+func (h *HandlerManager) renderAdminAction(w http.ResponseWriter, r *http.Request, status int, decisionError string) {
+	templateFiles := []string{
+		"./web_app/templates/admin/base.html",
+		"./web_app/templates/admin/action.html",
+	}
 
-// 	userSession, err := GetSession(userCookie.SessionID)
+	userSession, err := h.getAdminSessionOrLogout(w, r)
 
-// 	_, err = h.store.CreateNewThrift(userSession.UserID, groupTitle, description, amount, numbersOfMembers, frequency)
+	if err != nil {
+		return
+	}
 
-// 	if err != nil {
-// 		w.WriteHeader(401)
-// 		tmpl, err := template.ParseFiles("./web_app/templates/register.html", "./web_app/templates/layouts/pre_auth-base.html")
+	actionID, err := strconv.ParseUint(chi.URLParam(r, "actionID"), 10, 64)
 
-// 		if err != nil {
-// 			http.Error(w, "Something went wrong", http.StatusInternalServerError)
-// 		}
+	if err != nil {
+		http.Error(w, "Unknown admin action", http.StatusNotFound)
+		return
+	}
 
-// 		tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-// 			"Errors": map[string]string{
-// 				"email": "error with email",
-// 			},
-// 		})
-// 		return
-// 	}
-// 	// TODO: redirect on success
-// 	// TODO: abstract the URLs
-// 	http.Redirect(w, r, "/login", 301)
-// }
+	action, err := h.store.GetAdminAction(uint(actionID))
 
-func (h *HandlerManager) thriftPlanGetHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	templateFiles := []string{
-		"./web_app/templates/layouts/dashboard-base.html",
-		"./web_app/templates/thrift-individual.html",
+	if err == ErrAdminActionDoesNotExist {
+		http.Error(w, "Unknown admin action", http.StatusNotFound)
+		return
 	}
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
+	}
 
-	err := tmpl.ExecuteTemplate(w, "base", nil)
+	auditLog, err := h.store.GetAuditLog(adminActionAuditSubject(action.ID), adminAuditLogLimit)
 
 	if err != nil {
 		http.Error(w, "Something went wrong", http.StatusInternalServerError)
@@ -1188,46 +3827,70 @@ func (h *HandlerManager) thriftPlanGetHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	w.WriteHeader(200)
-}
+	tmpl := template.Must(template.ParseFiles(templateFiles...))
 
-func (h *HandlerManager) adminHomeGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(status)
 
-	templateFiles := []string{
-		"./web_app/templates/admin/base.html",
-		"./web_app/templates/admin/index.html",
+	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
+		"Action":         action,
+		"AuditLog":       auditLog,
+		"DecisionError":  decisionError,
+		"Note":           r.PostFormValue("note"),
+		"CanDecide":      action.Status == AdminActionPending,
+		"ProposedByYou":  action.ProposedBy == userSession.UserID,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+
+	if err != nil {
+		log.Printf("error %q from url %q", err, r.URL.Path)
 	}
+}
 
+// adminUserAdjustmentPostHandler proposes paying money into, or taking
+// it out of, a customer's Solo Saver, for a second admin to approve
+func (h *HandlerManager) adminUserAdjustmentPostHandler(w http.ResponseWriter, r *http.Request) {
 	userSession, err := h.getAdminSessionOrLogout(w, r)
 
-	if err == ErrNotAdmin {
-		// This block is very important.
-		// Without this block, users will still be able to see the content of the page
+	if err != nil {
 		return
 	}
 
-	information, err := h.store.GetAdminHomeScreenInformation(userSession.UserID)
+	customerID, err := strconv.ParseUint(chi.URLParam(r, "customerID"), 10, 64)
 
 	if err != nil {
-		http.Error(w, "Something went wrong", http.StatusInternalServerError)
-		log.Printf("error %q from url %q", err, r.URL.Path)
+		http.Error(w, "Unknown customer", http.StatusNotFound)
 		return
 	}
 
-	// TODO: check that the user is an admin while getting their sessionCookie
+	r.ParseForm()
 
-	tmpl := template.Must(template.ParseFiles(templateFiles...))
+	amount, err := ParseMoney(r.PostFormValue("amount"))
+	if err != nil || amount <= 0 {
+		h.renderAdminUser(w, r, http.StatusUnprocessableEntity, "Enter the amount to adjust their balance by")
+		return
+	}
 
-	err = tmpl.ExecuteTemplate(w, "base", map[string]interface{}{
-		"LoanRequests":        information.LoanRequests,
-		"InvestmentsRequests": information.InvestmentsRequests,
-		"WithdrawalRequests":  information.WithdrawalRequests,
-	})
+	adjustment := BalanceAdjustment{CustomerID: uint(customerID), Amount: amount}
+	switch r.PostFormValue("direction") {
+	case "credit":
+		adjustment.Credit = true
+	case "debit":
+	default:
+		h.renderAdminUser(w, r, http.StatusUnprocessableEntity, "Choose whether to pay the money in or take it out")
+		return
+	}
 
-	if err != nil {
-		http.Error(w, "Something went wrong while trying to load the admin home page", http.StatusInternalServerError)
+	if _, err := h.store.GetCustomerAccount(uint(customerID)); err == ErrAccountDoesNotExist {
+		http.Error(w, "Unknown customer", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+		return
 	}
+
+	h.proposeAdminAction(w, r, adjustment, userSession.UserID, r.PostFormValue("note"), h.renderAdminUser)
 }
 
 func (h *HandlerManager) logoutGetHandler(w http.ResponseWriter, r *http.Request) {
@@ -1299,19 +3962,48 @@ func (h *HandlerManager) getAdminSessionOrLogout(w http.ResponseWriter, r *http.
 
 	userSession, err := GetSession(sessionCookie.SessionID)
 
-	if userSession.Role != "admin" {
-		http.Error(w, "Forbidden: not an admin", http.StatusForbidden)
-		return UserSession{}, ErrNotAdmin
-	}
-
 	if err != nil {
 		h.logout(w, r)
 		return UserSession{}, err
 	}
 
+	if userSession.Role != RoleAdmin {
+		http.Error(w, "Forbidden: not an admin", http.StatusForbidden)
+		return UserSession{}, ErrNotAdmin
+	}
+
 	return userSession, nil
 }
 
+// requirePermission is middleware for admin routes that only lets
+// admins with one of the permissions through
+func (h *HandlerManager) requirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userSession, err := h.getAdminSessionOrLogout(w, r)
+
+			if err != nil {
+				return
+			}
+
+			granted, err := h.store.GetAdminPermissions(userSession.UserID)
+
+			if err != nil && err != ErrNotAdmin {
+				http.Error(w, "Something went wrong", http.StatusInternalServerError)
+				log.Printf("error %q from url %q", err, r.URL.Path)
+				return
+			}
+
+			if !slices.ContainsFunc(permissions, granted.Has) {
+				http.Error(w, fmt.Sprintf("Forbidden: you need the %s permission", strings.Join(permissions, " or ")), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func (h *HandlerManager) logout(w http.ResponseWriter, r *http.Request) {
 
 	session, err := h.cookieStore.Get(r, "session")
@@ -1326,6 +4018,21 @@ func (h *HandlerManager) logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
 }
 
+// notifyCustomer sends a customer the notice for something an admin
+// decided. The decision stands if they can't be told, so failures are
+// only logged.
+func (h *HandlerManager) notifyCustomer(r *http.Request, customerID uint, notice func(contact CustomerContact) (string, string)) {
+	contact, err := h.store.GetCustomerContact(customerID)
+	if err == nil {
+		subject, body := notice(contact)
+		err = notifyContact(r.Context(), h.notifier, contact, subject, body)
+	}
+
+	if err != nil {
+		log.Printf("error %q notifying customer %d from url %q", err, customerID, r.URL.Path)
+	}
+}
+
 // generates UUIDs for payment related purposes
 func (h *HandlerManager) generatePaymentUUID() uuid.UUID {
 
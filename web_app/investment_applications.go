@@ -0,0 +1,333 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Customers fill the investment form in as a draft, which they can
+// save and come back to, then submit it from a confirmation page.
+// Submitted applications wait for an admin to approve or reject them.
+// A customer has one draft, and one application waiting, at a time.
+// Approved applications are paid for through the payment flow, and the
+// payment opens the investment.
+
+// Investment application statuses
+const (
+	InvestmentApplicationDraft    = "DRAFT"
+	InvestmentApplicationPending  = "PENDING"
+	InvestmentApplicationApproved = "APPROVED"
+	InvestmentApplicationRejected = "REJECTED"
+)
+
+// Audit log actions for investment applications
+const (
+	AuditInvestmentApplicationSubmitted = "INVESTMENT_APPLICATION_SUBMITTED"
+	AuditInvestmentApplicationApproved  = "INVESTMENT_APPLICATION_APPROVED"
+	AuditInvestmentApplicationRejected  = "INVESTMENT_APPLICATION_REJECTED"
+	AuditInvestmentApplicationFunded    = "INVESTMENT_APPLICATION_FUNDED"
+)
+
+// employmentStatuses are the employment_status_type values
+var employmentStatuses = []string{"SALARIED", "SELF-EMPLOYED", "RETIRED", "UNEMPLOYED"}
+
+var (
+	ErrInvestmentApplicationDoesNotExist = errors.New("the investment application doesn't exist")
+	ErrInvestmentApplicationDecided      = errors.New("the investment application has already been decided")
+	ErrInvestmentApplicationIncomplete   = errors.New("the investment application isn't complete")
+	ErrInvestmentApplicationWaiting      = errors.New("you already have an investment application waiting to be reviewed")
+	ErrInvestmentApplicationNotPayable   = errors.New("the investment application isn't waiting to be paid for")
+	ErrInvalidTIN                        = errors.New("TINs are 10 digits, or 8 digits, a hyphen and 4 digits")
+)
+
+// tinPattern matches the 10 digit TINs the Joint Tax Board issues and
+// the older FIRS ones, which are 8 digits, a hyphen and 4 digits
+var tinPattern = regexp.MustCompile(`^[0-9]{10}$|^[0-9]{8}-[0-9]{4}$`)
+
+// InvestmentApplication is a customer's request to invest in a product.
+// Drafts can have any of the customer's details missing.
+type InvestmentApplication struct {
+	ID           uint
+	CustomerID   uint
+	CustomerName string
+	ProductID    uint
+	ProductName  string
+	Amount       Money
+	TenorInDays  uint64
+
+	EmploymentStatus  string
+	DateOfEmployment  time.Time
+	EmployerName      string
+	TIN               string
+	BankAccountName   string
+	BankAccountNumber string
+
+	Status       string
+	DecisionNote string
+	// ReviewedBy is the admin that approved or rejected the application
+	ReviewedBy  uint
+	ReviewedAt  time.Time
+	SubmittedAt time.Time
+	// PositionID is the investment that paying for the application
+	// opened
+	PositionID uint
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// AwaitingPayment is true once the application is approved, until it
+// has been paid for
+func (a InvestmentApplication) AwaitingPayment() bool {
+	return a.Status == InvestmentApplicationApproved && a.PositionID == 0
+}
+
+// IsEmployed is false for customers that don't have an employer to
+// give the details of
+func (a InvestmentApplication) IsEmployed() bool {
+	switch a.EmploymentStatus {
+	case "RETIRED", "UNEMPLOYED":
+		return false
+	}
+	return true
+}
+
+// normalizeTIN checks a tax identification number, and takes out the
+// spaces it was typed with
+func normalizeTIN(tin string) (string, error) {
+	tin = strings.Join(strings.Fields(tin), "")
+	if !tinPattern.MatchString(tin) {
+		return "", ErrInvalidTIN
+	}
+	return tin, nil
+}
+
+// investmentApplicationForm reads the investment form into an
+// application. Fields that are left empty are left out, so that drafts
+// can be saved part of the way through; the errors are for the fields
+// that were filled in wrongly.
+func investmentApplicationForm(form url.Values, customerID uint, today time.Time) (InvestmentApplication, map[string]string) {
+	application := InvestmentApplication{CustomerID: customerID}
+	errorsMap := make(map[string]string)
+
+	if status := form.Get("employment-status"); status != "" {
+		if slices.Contains(employmentStatuses, status) {
+			application.EmploymentStatus = status
+		} else {
+			errorsMap["EmploymentStatus"] = "You have selected an invalid employment status"
+		}
+	}
+
+	if value := strings.TrimSpace(form.Get("date-of-employment")); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		switch {
+		case err != nil:
+			errorsMap["DateOfEmployment"] = "Enter the date you started working there"
+		case date.After(today):
+			errorsMap["DateOfEmployment"] = "This date can't be in the future"
+		default:
+			application.DateOfEmployment = date
+		}
+	}
+
+	application.EmployerName = strings.TrimSpace(form.Get("employer-name"))
+	if len(application.EmployerName) > 128 {
+		errorsMap["EmployerName"] = "Employer names can be at most 128 characters"
+	}
+
+	if value := form.Get("investment-product"); value != "" {
+		productID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			errorsMap["InvestmentProduct"] = "Choose a product to invest in"
+		}
+		application.ProductID = uint(productID)
+	}
+
+	if value := strings.TrimSpace(form.Get("investment-amount")); value != "" {
+		amount, err := ParseMoney(value)
+		if err != nil || amount <= 0 {
+			errorsMap["InvestmentAmount"] = "Enter an amount in naira, e.g. 50000"
+		} else {
+			application.Amount = amount
+		}
+	}
+
+	if value := strings.TrimSpace(form.Get("investment-tenure")); value != "" {
+		tenure, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || tenure == 0 || tenure > maxInvestmentTenorDays {
+			errorsMap["InvestmentTenure"] = fmt.Sprintf("Enter a number of days up to %d", maxInvestmentTenorDays)
+		} else {
+			application.TenorInDays = tenure
+		}
+	}
+
+	if value := strings.TrimSpace(form.Get("TIN")); value != "" {
+		tin, err := normalizeTIN(value)
+		if err != nil {
+			errorsMap["TIN"] = "Enter your TIN as 10 digits, or as 8 digits, a hyphen and 4 digits"
+		}
+		application.TIN = tin
+	}
+
+	application.BankAccountName = strings.TrimSpace(form.Get("bank-account-name"))
+	if len(application.BankAccountName) > 64 {
+		errorsMap["BankAccountName"] = "Account names can be at most 64 characters"
+	}
+
+	if value := strings.Join(strings.Fields(form.Get("bank-account-number")), ""); value != "" {
+		if accountNumberRegex.MatchString(value) {
+			application.BankAccountNumber = value
+		} else {
+			errorsMap["BankAccountNumber"] = "Account numbers are 10 digits"
+		}
+	}
+
+	return application, errorsMap
+}
+
+// investmentApplicationValues is the investment form filled in with an
+// application, for picking a draft back up
+func investmentApplicationValues(application InvestmentApplication) url.Values {
+	form := url.Values{}
+	form.Set("employment-status", application.EmploymentStatus)
+	if !application.DateOfEmployment.IsZero() {
+		form.Set("date-of-employment", application.DateOfEmployment.Format("2006-01-02"))
+	}
+	form.Set("employer-name", application.EmployerName)
+	if application.ProductID != 0 {
+		form.Set("investment-product", strconv.FormatUint(uint64(application.ProductID), 10))
+	}
+	if application.Amount != 0 {
+		form.Set("investment-amount", application.Amount.Decimal())
+	}
+	if application.TenorInDays != 0 {
+		form.Set("investment-tenure", strconv.FormatUint(application.TenorInDays, 10))
+	}
+	form.Set("TIN", application.TIN)
+	form.Set("bank-account-name", application.BankAccountName)
+	form.Set("bank-account-number", application.BankAccountNumber)
+	return form
+}
+
+// investmentApplicationProblems are what stops an application from
+// being submitted: the details it is missing, and a product, amount or
+// tenor that can't be invested in. product is the application's
+// product, or the zero value if it doesn't have one.
+func investmentApplicationProblems(application InvestmentApplication, product InvestmentProduct) map[string]string {
+	problems := make(map[string]string)
+	const required = "This field is required"
+
+	if application.EmploymentStatus == "" {
+		problems["EmploymentStatus"] = "Choose your employment status"
+	}
+	if application.IsEmployed() {
+		if application.DateOfEmployment.IsZero() {
+			problems["DateOfEmployment"] = required
+		}
+		if application.EmployerName == "" {
+			problems["EmployerName"] = required
+		}
+	}
+	if application.TIN == "" {
+		problems["TIN"] = required
+	}
+	if application.BankAccountName == "" {
+		problems["BankAccountName"] = required
+	}
+	if application.BankAccountNumber == "" {
+		problems["BankAccountNumber"] = required
+	}
+
+	switch {
+	case application.ProductID == 0 || product.ID != application.ProductID:
+		problems["InvestmentProduct"] = "Choose a product to invest in"
+	case !product.Active:
+		problems["InvestmentProduct"] = "We no longer offer this product. Choose another one"
+	case application.Amount == 0:
+		problems["InvestmentAmount"] = required
+	case application.TenorInDays == 0:
+		problems["InvestmentTenure"] = required
+	default:
+		if _, err := quoteInvestment(product, application.Amount, application.TenorInDays, time.Now()); err == ErrInvestmentBelowMinimum {
+			problems["InvestmentAmount"] = fmt.Sprintf("You can invest at least %s in %s", product.MinimumAmount, product.Name)
+		} else if err == ErrInvestmentTenor {
+			problems["InvestmentTenure"] = fmt.Sprintf("%s can be held for %s days", product.Name, investmentTenorsText(product.Tenors))
+		}
+	}
+
+	return problems
+}
+
+// checkInvestmentPayment is why a payment can't open its application's
+// investment, or nil if it can. Payments that can't are kept in the
+// customer's investment balance.
+func checkInvestmentPayment(application InvestmentApplication, payment PaystackTransactionInformation) error {
+	if application.CustomerID != payment.CustomerID {
+		return ErrInvestmentApplicationDoesNotExist
+	}
+	if !application.AwaitingPayment() {
+		return ErrInvestmentApplicationNotPayable
+	}
+	if application.Amount != payment.PaymentAmount {
+		return fmt.Errorf("%w: expected %s, paid %s", ErrChargeAmountMismatch, application.Amount, payment.PaymentAmount)
+	}
+	return nil
+}
+
+func isInvestmentApplicationStatus(status string) bool {
+	switch status {
+	case InvestmentApplicationPending, InvestmentApplicationApproved, InvestmentApplicationRejected:
+		return true
+	}
+	return false
+}
+
+// investmentApplicationDecisionNotice tells the customer what was
+// decided, and how to pay for an approved application
+func investmentApplicationDecisionNotice(contact CustomerContact, application InvestmentApplication, baseURL string) (string, string) {
+	if application.Status == InvestmentApplicationApproved {
+		return "Your investment application has been approved", fmt.Sprintf("Hi %s, your application to invest %s in %s for %d days has been approved. Pay for it at %s/dashboard/investments to open your investment.",
+			contact.FirstName, application.Amount, application.ProductName, application.TenorInDays, baseURL)
+	}
+
+	return "Your investment application wasn't approved", fmt.Sprintf("Hi %s, we couldn't approve your application to invest %s in %s: %s. You can apply again at %s/dashboard/investments/form.",
+		contact.FirstName, application.Amount, application.ProductName, application.DecisionNote, baseURL)
+}
+
+func investmentApplicationAuditSubject(id uint) string {
+	return fmt.Sprintf("investment-application:%d", id)
+}
+
+type InvestmentApplicationStore interface {
+	// GetInvestmentApplicationDraft returns the customer's draft, or
+	// ErrInvestmentApplicationDoesNotExist if they don't have one
+	GetInvestmentApplicationDraft(customerID uint) (InvestmentApplication, error)
+	// SaveInvestmentApplicationDraft saves the application as its
+	// customer's draft, starting one if they don't have one
+	SaveInvestmentApplicationDraft(application InvestmentApplication) (uint, error)
+	// SubmitInvestmentApplication sends the customer's draft to be
+	// reviewed. Drafts that investmentApplicationProblems finds
+	// problems with get ErrInvestmentApplicationIncomplete, and
+	// customers with an application waiting already get
+	// ErrInvestmentApplicationWaiting.
+	SubmitInvestmentApplication(customerID uint) (InvestmentApplication, error)
+	GetInvestmentApplication(id uint) (InvestmentApplication, error)
+	// GetInvestmentApplications lists submitted applications for the
+	// admin queue
+	GetInvestmentApplications(filter AdminQueueFilter) ([]InvestmentApplication, error)
+	// GetCustomerInvestmentApplications lists a customer's
+	// applications, their draft included, newest first
+	GetCustomerInvestmentApplications(customerID uint) ([]InvestmentApplication, error)
+	// ApproveInvestmentApplication approves an application that is
+	// waiting, so that the customer can pay for it. Its product has to
+	// allow the amount and tenor still.
+	ApproveInvestmentApplication(id, adminID uint, note string) (InvestmentApplication, error)
+	// RejectInvestmentApplication rejects an application that is
+	// waiting. Both decisions need a note saying why.
+	RejectInvestmentApplication(id, adminID uint, note string) (InvestmentApplication, error)
+}
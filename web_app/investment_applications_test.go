@@ -0,0 +1,174 @@
+package web_app
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTIN(t *testing.T) {
+	for tin, want := range map[string]string{
+		"1234567890":     "1234567890",
+		" 12345678-0001": "12345678-0001",
+		"123 456 7890":   "1234567890",
+	} {
+		if got, err := normalizeTIN(tin); err != nil || got != want {
+			t.Errorf("%q: got %q %v, want %q", tin, got, err, want)
+		}
+	}
+
+	for _, tin := range []string{"123456789", "12345678901", "1234567-00001", "12345678-001", "ABCDEFGHIJ"} {
+		if _, err := normalizeTIN(tin); err != ErrInvalidTIN {
+			t.Errorf("%q: got %v, want %v", tin, err, ErrInvalidTIN)
+		}
+	}
+}
+
+func newInvestmentApplicationForm() url.Values {
+	return url.Values{
+		"employment-status":   {"SALARIED"},
+		"date-of-employment":  {"2020-03-01"},
+		"employer-name":       {" Paz Ltd "},
+		"investment-product":  {"1"},
+		"investment-amount":   {"100000"},
+		"investment-tenure":   {"180"},
+		"TIN":                 {"12345678-0001"},
+		"bank-account-name":   {"Ada Obi"},
+		"bank-account-number": {"0123456789"},
+	}
+}
+
+func TestInvestmentApplicationForm(t *testing.T) {
+	today := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+	application, errorsMap := investmentApplicationForm(newInvestmentApplicationForm(), 7, today)
+	if len(errorsMap) != 0 {
+		t.Fatalf("did not expect errors, got %v", errorsMap)
+	}
+	if application.CustomerID != 7 || application.EmployerName != "Paz Ltd" || application.Amount != 10000000 || application.TenorInDays != 180 ||
+		!application.DateOfEmployment.Equal(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)) || application.BankAccountNumber != "0123456789" {
+		t.Errorf("got %+v", application)
+	}
+
+	t.Run("keeps what is filled in of a draft", func(t *testing.T) {
+		application, errorsMap := investmentApplicationForm(url.Values{"employer-name": {"Paz Ltd"}, "investment-amount": {""}}, 7, today)
+		if len(errorsMap) != 0 || application.EmployerName != "Paz Ltd" || application.Amount != 0 {
+			t.Errorf("got %+v and %v", application, errorsMap)
+		}
+	})
+
+	t.Run("reports the fields that are filled in wrongly", func(t *testing.T) {
+		form := newInvestmentApplicationForm()
+		form.Set("employment-status", "self-employment")
+		form.Set("date-of-employment", "2027-01-01")
+		form.Set("investment-amount", "a lot")
+		form.Set("investment-tenure", "3650")
+		form.Set("TIN", "12345")
+		form.Set("bank-account-number", "12345")
+
+		_, errorsMap := investmentApplicationForm(form, 7, today)
+		for _, field := range []string{"EmploymentStatus", "DateOfEmployment", "InvestmentAmount", "InvestmentTenure", "TIN", "BankAccountNumber"} {
+			if errorsMap[field] == "" {
+				t.Errorf("expected an error for %s, got %v", field, errorsMap)
+			}
+		}
+		if len(errorsMap) != 6 {
+			t.Errorf("got %v", errorsMap)
+		}
+	})
+
+	t.Run("fills the form back in from a draft", func(t *testing.T) {
+		draft, _ := investmentApplicationForm(investmentApplicationValues(application), 7, today)
+		if draft != application {
+			t.Errorf("got %+v, want %+v", draft, application)
+		}
+	})
+}
+
+func TestInvestmentApplicationProblems(t *testing.T) {
+	today := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	application, _ := investmentApplicationForm(newInvestmentApplicationForm(), 7, today)
+
+	if problems := investmentApplicationProblems(application, testInvestmentProduct); len(problems) != 0 {
+		t.Errorf("did not expect problems, got %v", problems)
+	}
+
+	t.Run("needs every detail", func(t *testing.T) {
+		problems := investmentApplicationProblems(InvestmentApplication{CustomerID: 7}, InvestmentProduct{})
+		for _, field := range []string{"EmploymentStatus", "DateOfEmployment", "EmployerName", "TIN", "BankAccountName", "BankAccountNumber", "InvestmentProduct"} {
+			if problems[field] == "" {
+				t.Errorf("expected a problem with %s, got %v", field, problems)
+			}
+		}
+	})
+
+	t.Run("doesn't need an employer from customers that aren't employed", func(t *testing.T) {
+		for _, status := range []string{"UNEMPLOYED", "RETIRED"} {
+			notEmployed := application
+			notEmployed.EmploymentStatus = status
+			notEmployed.EmployerName = ""
+			notEmployed.DateOfEmployment = time.Time{}
+			if problems := investmentApplicationProblems(notEmployed, testInvestmentProduct); len(problems) != 0 {
+				t.Errorf("%s: did not expect problems, got %v", status, problems)
+			}
+		}
+	})
+
+	t.Run("needs what the product allows", func(t *testing.T) {
+		inactive := testInvestmentProduct
+		inactive.Active = false
+		small := application
+		small.Amount = 100
+		short := application
+		short.TenorInDays = 30
+
+		for name, test := range map[string]struct {
+			application InvestmentApplication
+			product     InvestmentProduct
+			field       string
+		}{
+			"no longer offered": {application, inactive, "InvestmentProduct"},
+			"below the minimum": {small, testInvestmentProduct, "InvestmentAmount"},
+			"another tenor":     {short, testInvestmentProduct, "InvestmentTenure"},
+		} {
+			problems := investmentApplicationProblems(test.application, test.product)
+			if len(problems) != 1 || problems[test.field] == "" {
+				t.Errorf("%s: got %v", name, problems)
+			}
+		}
+	})
+}
+
+func TestCheckInvestmentPayment(t *testing.T) {
+	approved := InvestmentApplication{ID: 3, CustomerID: 7, Amount: 10000000, Status: InvestmentApplicationApproved}
+	payment := PaystackTransactionInformation{CustomerID: 7, PlanID: 3, PaymentOriginator: OriginatorInvestments, PaymentAmount: 10000000}
+
+	if err := checkInvestmentPayment(approved, payment); err != nil {
+		t.Errorf("did not expect an error, got %q", err)
+	}
+
+	pending := approved
+	pending.Status = InvestmentApplicationPending
+	paid := approved
+	paid.PositionID = 12
+	someoneElse := payment
+	someoneElse.CustomerID = 8
+	short := payment
+	short.PaymentAmount = 5000000
+
+	for name, test := range map[string]struct {
+		application InvestmentApplication
+		payment     PaystackTransactionInformation
+		want        error
+	}{
+		"someone else's":   {approved, someoneElse, ErrInvestmentApplicationDoesNotExist},
+		"not approved":     {pending, payment, ErrInvestmentApplicationNotPayable},
+		"already paid for": {paid, payment, ErrInvestmentApplicationNotPayable},
+		"the wrong amount": {approved, short, ErrChargeAmountMismatch},
+	} {
+		if err := checkInvestmentPayment(test.application, test.payment); !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package web_app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// InvestmentCertificate is what a customer is given for an investment,
+// with its terms. It is written from the position as it was opened.
+type InvestmentCertificate struct {
+	Position     InvestmentPosition
+	CustomerName string
+	EmailAddress string
+	GeneratedAt  time.Time
+}
+
+// Number is the certificate number printed on it
+func (c InvestmentCertificate) Number() string {
+	return fmt.Sprintf("PAZ-INV-%06d", c.Position.ID)
+}
+
+func (c InvestmentCertificate) Filename() string {
+	return fmt.Sprintf("paz-investment-certificate-%d.pdf", c.Position.ID)
+}
+
+// Terms are the terms the investment was opened on
+func (c InvestmentCertificate) Terms() []string {
+	position := c.Position
+	atMaturity := "paid, with its return, into your Solo Saver"
+	if position.Rollover {
+		atMaturity = "rolled over, with its return, into a new investment for the same tenor at the product's rate then, or paid into your Solo Saver if the product is no longer offered for it"
+	}
+
+	return []string{
+		fmt.Sprintf("The investment earns simple interest of %s a year on its principal, counted over a 365 day year, for %d days.", position.RatePercent(), position.TenorInDays),
+		"The rate is fixed for the tenor of the investment, even if the product's rate changes.",
+		fmt.Sprintf("On %s it is %s. You can change this from your dashboard until it matures.", position.MaturityDate.Format("2 Jan 2006"), atMaturity),
+	}
+}
+
+// writeInvestmentCertificatePDF renders the certificate with the core
+// PDF fonts, like writeStatementPDF, so amounts are labelled NGN
+func writeInvestmentCertificatePDF(w io.Writer, certificate InvestmentCertificate) error {
+	position := certificate.Position
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(fmt.Sprintf("Paz Finance investment certificate %s", certificate.Number()), true)
+	pdf.SetAuthor("Paz Finance", true)
+	pdf.SetAutoPageBreak(true, 15)
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(78, 90, 102)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Generated %s", certificate.GeneratedAt.Format("2 Jan 2006 15:04")), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+
+	// brand header
+	pdf.SetFillColor(36, 61, 125)
+	pdf.Rect(0, 0, 210, 28, "F")
+	if _, err := os.Stat(statementLogoPath); err == nil {
+		pdf.ImageOptions(statementLogoPath, 10, 7, 0, 14, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetXY(100, 10)
+	pdf.CellFormat(100, 8, "Investment certificate", "", 0, "R", false, 0, "")
+
+	pdf.SetTextColor(41, 39, 39)
+	pdf.SetXY(10, 36)
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, 6, fmt.Sprintf("This certifies that %s has invested with Paz Finance on the terms below.", certificate.CustomerName), "", "L", false)
+	pdf.Ln(4)
+
+	details := [][2]string{
+		{"Certificate", certificate.Number()},
+		{"Investor", certificate.CustomerName},
+		{"Email", certificate.EmailAddress},
+		{"Product", position.ProductName},
+		{"Amount", "NGN " + position.Principal.Grouped()},
+		{"Rate", position.RatePercent() + " a year"},
+		{"Tenor", fmt.Sprintf("%d days", position.TenorInDays)},
+		{"Start date", position.StartDate.Format("2 Jan 2006")},
+		{"Maturity date", position.MaturityDate.Format("2 Jan 2006")},
+		{"Return at maturity", "NGN " + position.ExpectedReturn().Grouped()},
+		{"Value at maturity", "NGN " + (position.Principal + position.ExpectedReturn()).Grouped()},
+	}
+	for _, detail := range details {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(50, 7, detail[0], "B", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 7, detail[1], "B", 1, "L", false, 0, "")
+	}
+	pdf.Ln(6)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(0, 8, "Terms", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, term := range certificate.Terms() {
+		pdf.MultiCell(0, 6, "- "+term, "", "L", false)
+	}
+
+	return pdf.Output(w)
+}
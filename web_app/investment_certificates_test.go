@@ -0,0 +1,55 @@
+package web_app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testInvestmentCertificate() InvestmentCertificate {
+	start := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	return InvestmentCertificate{
+		Position: InvestmentPosition{
+			ID: 12, CustomerID: 7, ProductID: 1, ProductName: "Paz Fixed", Principal: 10000000, AnnualRate: 1200,
+			TenorInDays: 180, StartDate: start, MaturityDate: start.AddDate(0, 0, 180), Status: "ACTIVE",
+		},
+		CustomerName: "Ada Obi",
+		EmailAddress: "ada@example.com",
+		GeneratedAt:  start,
+	}
+}
+
+func TestInvestmentCertificate(t *testing.T) {
+	certificate := testInvestmentCertificate()
+
+	if got := certificate.Number(); got != "PAZ-INV-000012" {
+		t.Errorf("got number %q", got)
+	}
+	if got := certificate.Filename(); got != "paz-investment-certificate-12.pdf" {
+		t.Errorf("got filename %q", got)
+	}
+
+	t.Run("says what happens at maturity", func(t *testing.T) {
+		if terms := strings.Join(certificate.Terms(), " "); !strings.Contains(terms, "Solo Saver") || strings.Contains(terms, "rolled over") {
+			t.Errorf("got terms %q", terms)
+		}
+
+		certificate.Position.Rollover = true
+		if terms := strings.Join(certificate.Terms(), " "); !strings.Contains(terms, "rolled over") {
+			t.Errorf("got terms %q", terms)
+		}
+	})
+
+	t.Run("writes a PDF", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := writeInvestmentCertificatePDF(&buffer, testInvestmentCertificate()); err != nil {
+			t.Fatalf("did not expect an error writing the PDF: %q", err)
+		}
+
+		if !bytes.HasPrefix(buffer.Bytes(), []byte("%PDF-")) {
+			t.Error("expected the output to be a PDF document")
+		}
+	})
+}
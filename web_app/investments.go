@@ -0,0 +1,395 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Customers invest in products that admins manage. A product has an
+// annual rate, a minimum amount and the tenors it can be held for.
+// Approved applications become positions that earn simple interest on
+// their principal until they mature. Every day the InvestmentMaturer
+// pays matured positions, with their return, into the customer's solo
+// savings, or rolls them over into a new position when the customer
+// asked for that.
+
+const (
+	InvestmentPositionActive     = "ACTIVE"
+	InvestmentPositionMatured    = "MATURED"
+	InvestmentPositionRolledOver = "ROLLED_OVER"
+)
+
+const (
+	AuditInvestmentProduct  = "INVESTMENT_PRODUCT"
+	AuditInvestmentRollover = "INVESTMENT_ROLLOVER"
+	AuditInvestmentMatured  = "INVESTMENT_MATURED"
+)
+
+const (
+	// maturityHour is when the daily maturities run
+	maturityHour = 3
+	// maxInvestmentTenorDays is the longest tenor a product can offer
+	maxInvestmentTenorDays = 1825
+)
+
+var (
+	ErrInvalidInvestmentProduct       = errors.New("invalid investment product")
+	ErrInvestmentProductExists        = errors.New("there is already a product with that name")
+	ErrInvestmentProductDoesNotExist  = errors.New("the investment product doesn't exist")
+	ErrInvestmentProductInactive      = errors.New("the investment product is no longer offered")
+	ErrInvestmentBelowMinimum         = errors.New("the amount is below the product's minimum")
+	ErrInvestmentTenor                = errors.New("the product can't be held for that tenor")
+	ErrInvestmentPositionDoesNotExist = errors.New("the investment doesn't exist")
+	ErrInvestmentPositionEnded        = errors.New("the investment has already matured")
+)
+
+type InvestmentProduct struct {
+	ID   uint
+	Name string
+	// AnnualRate is in basis points
+	AnnualRate    int64
+	MinimumAmount Money
+	// Tenors are how many days the product can be held for, shortest
+	// first
+	Tenors    []uint64
+	Active    bool
+	CreatedAt time.Time
+}
+
+// Validate checks what an admin entered for a product
+func (p InvestmentProduct) Validate() error {
+	switch {
+	case strings.TrimSpace(p.Name) == "" || len(p.Name) > 128:
+		return fmt.Errorf("%w: give it a name of up to 128 characters", ErrInvalidInvestmentProduct)
+	case p.AnnualRate <= 0 || p.AnnualRate > 10000:
+		return fmt.Errorf("%w: the rate has to be between 0.01%% and 100%% a year", ErrInvalidInvestmentProduct)
+	case p.MinimumAmount <= 0:
+		return fmt.Errorf("%w: the minimum amount has to be more than %s", ErrInvalidInvestmentProduct, Money(0))
+	case len(p.Tenors) == 0:
+		return fmt.Errorf("%w: give it at least one tenor", ErrInvalidInvestmentProduct)
+	}
+
+	for _, tenor := range p.Tenors {
+		if tenor == 0 || tenor > maxInvestmentTenorDays {
+			return fmt.Errorf("%w: tenors have to be between 1 and %d days", ErrInvalidInvestmentProduct, maxInvestmentTenorDays)
+		}
+	}
+	return nil
+}
+
+func (p InvestmentProduct) AllowsTenor(tenor uint64) bool {
+	return slices.Contains(p.Tenors, tenor)
+}
+
+// TenorsText is the product's tenors as they are written in a sentence
+func (p InvestmentProduct) TenorsText() string {
+	return investmentTenorsText(p.Tenors)
+}
+
+// RatePercent is the annual rate as it is shown to people, e.g. 12.5%
+func (p InvestmentProduct) RatePercent() string {
+	return ratePercent(p.AnnualRate)
+}
+
+func ratePercent(rate int64) string {
+	return strconv.FormatFloat(float64(rate)/100, 'f', -1, 64) + "%"
+}
+
+// investmentTenorsText lists tenors the way they are written in a
+// sentence, e.g. "90, 180 or 365"
+func investmentTenorsText(tenors []uint64) string {
+	var text strings.Builder
+	for i, tenor := range tenors {
+		switch {
+		case i == 0:
+		case i == len(tenors)-1:
+			text.WriteString(" or ")
+		default:
+			text.WriteString(", ")
+		}
+		text.WriteString(strconv.FormatUint(tenor, 10))
+	}
+	return text.String()
+}
+
+// parseInvestmentTenors reads tenors written like "90, 180, 365",
+// sorted and without repeats
+func parseInvestmentTenors(value string) ([]uint64, error) {
+	var tenors []uint64
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		tenor, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q isn't a number of days", ErrInvalidInvestmentProduct, field)
+		}
+		tenors = append(tenors, tenor)
+	}
+
+	slices.Sort(tenors)
+	return slices.Compact(tenors), nil
+}
+
+// investmentReturn is the simple interest principal earns at rate, in
+// basis points a year, over days
+func investmentReturn(principal Money, rate int64, days int) Money {
+	if days <= 0 {
+		return 0
+	}
+	return roundMoney(float64(principal) * float64(rate) / 10000 * float64(days) / 365)
+}
+
+// InvestmentQuote is what an investment would earn
+type InvestmentQuote struct {
+	Product       InvestmentProduct
+	Amount        Money
+	TenorInDays   uint64
+	MaturityDate  time.Time
+	Return        Money
+	MaturityValue Money
+}
+
+// quoteInvestment works out what amount would earn in product over
+// tenor days, for an investment that starts on start
+func quoteInvestment(product InvestmentProduct, amount Money, tenor uint64, start time.Time) (InvestmentQuote, error) {
+	quote := InvestmentQuote{Product: product, Amount: amount, TenorInDays: tenor}
+
+	if amount < product.MinimumAmount {
+		return quote, ErrInvestmentBelowMinimum
+	}
+	if !product.AllowsTenor(tenor) {
+		return quote, ErrInvestmentTenor
+	}
+
+	quote.MaturityDate = calendarDay(start).AddDate(0, 0, int(tenor))
+	quote.Return = investmentReturn(amount, product.AnnualRate, int(tenor))
+	quote.MaturityValue = amount + quote.Return
+	return quote, nil
+}
+
+// InvestmentPosition is money that is invested, from the day it
+// starts until it matures
+type InvestmentPosition struct {
+	ID            uint
+	CustomerID    uint
+	ProductID     uint
+	ProductName   string
+	ApplicationID uint
+	// RolledOverFrom is the position this one was rolled over from
+	RolledOverFrom uint
+	Principal      Money
+	// AnnualRate is the product's rate, in basis points, when the
+	// position was opened
+	AnnualRate   int64
+	TenorInDays  uint64
+	StartDate    time.Time
+	MaturityDate time.Time
+	Status       string
+	// Rollover is whether to reinvest the principal and return at
+	// maturity rather than pay them out
+	Rollover bool
+	// Return is what was paid at maturity
+	Return    Money
+	MaturedAt time.Time
+}
+
+// ExpectedReturn is what the position earns if it is held until it
+// matures
+func (p InvestmentPosition) ExpectedReturn() Money {
+	return investmentReturn(p.Principal, p.AnnualRate, int(p.TenorInDays))
+}
+
+// AccruedReturn is what the position has earned by the end of on
+func (p InvestmentPosition) AccruedReturn(on time.Time) Money {
+	if p.Status != InvestmentPositionActive {
+		return p.Return
+	}
+	return investmentReturn(p.Principal, p.AnnualRate, min(daysBetween(p.StartDate, on), int(p.TenorInDays)))
+}
+
+func (p InvestmentPosition) IsMatured(on time.Time) bool {
+	return !calendarDay(on).Before(calendarDay(p.MaturityDate))
+}
+
+func (p InvestmentPosition) RatePercent() string {
+	return ratePercent(p.AnnualRate)
+}
+
+// InvestmentMaturity is what happened to a position when it matured
+type InvestmentMaturity struct {
+	// Position is the position as it is after it matured
+	Position InvestmentPosition
+	// RolledOverTo is the new position when it was rolled over
+	RolledOverTo *InvestmentPosition
+	// PaidOut is what went into solo savings when it wasn't
+	PaidOut Money
+}
+
+// matureInvestment works out what happens to position when it matures
+// on today. It is rolled over into product at the product's current
+// rate if the customer asked for that and the product is still offered
+// for the same tenor, or paid out otherwise. Nothing is saved, and the
+// rolled over position has no ID yet.
+func matureInvestment(position InvestmentPosition, product InvestmentProduct, today time.Time) InvestmentMaturity {
+	position.Return = position.ExpectedReturn()
+	position.MaturedAt = today
+	maturity := InvestmentMaturity{}
+
+	if position.Rollover && product.Active && product.AllowsTenor(position.TenorInDays) {
+		position.Status = InvestmentPositionRolledOver
+		// the new position starts when the old one matured, however
+		// late the maturities ran
+		start := calendarDay(position.MaturityDate)
+		maturity.RolledOverTo = &InvestmentPosition{
+			CustomerID:     position.CustomerID,
+			ProductID:      product.ID,
+			ProductName:    product.Name,
+			RolledOverFrom: position.ID,
+			Principal:      position.Principal + position.Return,
+			AnnualRate:     product.AnnualRate,
+			TenorInDays:    position.TenorInDays,
+			StartDate:      start,
+			MaturityDate:   start.AddDate(0, 0, int(position.TenorInDays)),
+			Status:         InvestmentPositionActive,
+			Rollover:       true,
+		}
+	} else {
+		position.Status = InvestmentPositionMatured
+		maturity.PaidOut = position.Principal + position.Return
+	}
+
+	maturity.Position = position
+	return maturity
+}
+
+func investmentProductAuditSubject(id uint) string {
+	return fmt.Sprintf("investment-product:%d", id)
+}
+
+func investmentPositionAuditSubject(id uint) string {
+	return fmt.Sprintf("investment-position:%d", id)
+}
+
+type InvestmentStore interface {
+	// GetInvestmentProducts lists the products, only those that are
+	// offered if activeOnly is true
+	GetInvestmentProducts(activeOnly bool) ([]InvestmentProduct, error)
+	GetInvestmentProduct(id uint) (InvestmentProduct, error)
+	CreateInvestmentProduct(product InvestmentProduct, adminID uint) (uint, error)
+	SetInvestmentProductActive(id uint, active bool, adminID uint) error
+	GetCustomerInvestmentPositions(customerID uint) ([]InvestmentPosition, error)
+	SetInvestmentRollover(customerID, positionID uint, rollover bool) error
+}
+
+type InvestmentMaturityStore interface {
+	// GetMaturedInvestmentPositionIDs lists the active positions that
+	// mature on or before on
+	GetMaturedInvestmentPositionIDs(on time.Time) ([]uint, error)
+	// MatureInvestmentPosition runs matureInvestment on a position and
+	// saves it, moving the money on the ledger
+	MatureInvestmentPosition(id uint, today time.Time) (InvestmentMaturity, error)
+	GetCustomerContact(customerID uint) (CustomerContact, error)
+}
+
+// investmentMaturityNotice is the subject and body of what customers
+// are sent when their investment matures
+func investmentMaturityNotice(contact CustomerContact, maturity InvestmentMaturity, baseURL string) (string, string) {
+	position := maturity.Position
+	if next := maturity.RolledOverTo; next != nil {
+		return "Your investment has been rolled over", fmt.Sprintf("Hi %s, your %s investment matured and earned %s. We've reinvested %s at %s a year until %s. See it at %s/dashboard/investments.",
+			contact.FirstName, position.ProductName, position.Return, next.Principal, next.RatePercent(), next.MaturityDate.Format("02 Jan 2006"), baseURL)
+	}
+
+	return "Your investment has matured", fmt.Sprintf("Hi %s, your %s investment matured and earned %s. We've paid %s into your Solo Saver at %s/dashboard/savings/solo-saver.",
+		contact.FirstName, position.ProductName, position.Return, maturity.PaidOut, baseURL)
+}
+
+// MaturityReport counts what a day's maturities did
+type MaturityReport struct {
+	Matured    int
+	RolledOver int
+	PaidOut    Money
+	Returns    Money
+}
+
+type InvestmentMaturer struct {
+	store    InvestmentMaturityStore
+	notifier Notifier
+	baseURL  string
+	now      func() time.Time
+}
+
+func NewInvestmentMaturer(store InvestmentMaturityStore, notifier Notifier, baseURL string) *InvestmentMaturer {
+	return &InvestmentMaturer{
+		store:    store,
+		notifier: notifier,
+		baseURL:  baseURL,
+		now:      time.Now,
+	}
+}
+
+// Run matures investments once a day until ctx is cancelled
+func (m *InvestmentMaturer) Run(ctx context.Context) {
+	daily := time.NewTimer(nextDailyRun(m.now(), maturityHour).Sub(m.now()))
+	defer daily.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-daily.C:
+			if _, err := m.Mature(ctx); err != nil {
+				log.Printf("investment maturities failed: %s", err)
+			}
+			daily.Reset(nextDailyRun(m.now(), maturityHour).Sub(m.now()))
+		}
+	}
+}
+
+// Mature pays out or rolls over every position that has matured, and
+// tells their customers. A position that can't be matured doesn't stop
+// the rest, and running it twice on a day does nothing the second time.
+func (m *InvestmentMaturer) Mature(ctx context.Context) (MaturityReport, error) {
+	var report MaturityReport
+
+	ids, err := m.store.GetMaturedInvestmentPositionIDs(m.now())
+	if err != nil {
+		return report, err
+	}
+
+	var errs []error
+	for _, id := range ids {
+		maturity, err := m.store.MatureInvestmentPosition(id, m.now())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("investment %d: %w", id, err))
+			continue
+		}
+
+		report.Matured++
+		report.Returns += maturity.Position.Return
+		report.PaidOut += maturity.PaidOut
+		if maturity.RolledOverTo != nil {
+			report.RolledOver++
+		}
+
+		if err := m.notify(ctx, maturity); err != nil {
+			errs = append(errs, fmt.Errorf("investment %d: %w", id, err))
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+func (m *InvestmentMaturer) notify(ctx context.Context, maturity InvestmentMaturity) error {
+	contact, err := m.store.GetCustomerContact(maturity.Position.CustomerID)
+	if err != nil {
+		return err
+	}
+
+	subject, body := investmentMaturityNotice(contact, maturity, m.baseURL)
+	return notifyContact(ctx, m.notifier, contact, subject, body)
+}
@@ -0,0 +1,280 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FakeInvestmentMaturityStore matures positions the way the database
+// does, keeping the balances the ledger would move
+type FakeInvestmentMaturityStore struct {
+	positions   map[uint]InvestmentPosition
+	products    map[uint]InvestmentProduct
+	contacts    map[uint]CustomerContact
+	soloSavings map[uint]Money
+}
+
+func NewFakeInvestmentMaturityStore(products ...InvestmentProduct) *FakeInvestmentMaturityStore {
+	store := &FakeInvestmentMaturityStore{
+		positions:   map[uint]InvestmentPosition{},
+		products:    map[uint]InvestmentProduct{},
+		contacts:    map[uint]CustomerContact{},
+		soloSavings: map[uint]Money{},
+	}
+	for _, product := range products {
+		store.products[product.ID] = product
+	}
+	return store
+}
+
+func (f *FakeInvestmentMaturityStore) GetMaturedInvestmentPositionIDs(on time.Time) ([]uint, error) {
+	var ids []uint
+	for id, position := range f.positions {
+		if position.Status == InvestmentPositionActive && position.IsMatured(on) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (f *FakeInvestmentMaturityStore) MatureInvestmentPosition(id uint, today time.Time) (InvestmentMaturity, error) {
+	position, ok := f.positions[id]
+	if !ok {
+		return InvestmentMaturity{}, ErrInvestmentPositionDoesNotExist
+	}
+	if position.Status != InvestmentPositionActive {
+		return InvestmentMaturity{}, ErrInvestmentPositionEnded
+	}
+
+	maturity := matureInvestment(position, f.products[position.ProductID], today)
+	if next := maturity.RolledOverTo; next != nil {
+		next.ID = uint(len(f.positions) + 1)
+		f.positions[next.ID] = *next
+	}
+	f.soloSavings[position.CustomerID] += maturity.PaidOut
+	f.positions[id] = maturity.Position
+	return maturity, nil
+}
+
+func (f *FakeInvestmentMaturityStore) GetCustomerContact(customerID uint) (CustomerContact, error) {
+	return f.contacts[customerID], nil
+}
+
+var testInvestmentProduct = InvestmentProduct{ID: 1, Name: "Paz Fixed", AnnualRate: 1200, MinimumAmount: 1000000, Tenors: []uint64{90, 180, 365}, Active: true}
+
+func TestInvestmentProduct(t *testing.T) {
+	if err := testInvestmentProduct.Validate(); err != nil {
+		t.Errorf("did not expect an error, got %q", err)
+	}
+
+	for name, change := range map[string]func(*InvestmentProduct){
+		"no name":        func(p *InvestmentProduct) { p.Name = " " },
+		"no rate":        func(p *InvestmentProduct) { p.AnnualRate = 0 },
+		"no minimum":     func(p *InvestmentProduct) { p.MinimumAmount = 0 },
+		"no tenors":      func(p *InvestmentProduct) { p.Tenors = nil },
+		"too long":       func(p *InvestmentProduct) { p.Tenors = []uint64{90, 3650} },
+		"no time at all": func(p *InvestmentProduct) { p.Tenors = []uint64{0} },
+	} {
+		product := testInvestmentProduct
+		change(&product)
+		if err := product.Validate(); !errors.Is(err, ErrInvalidInvestmentProduct) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidInvestmentProduct)
+		}
+	}
+
+	if got := testInvestmentProduct.RatePercent(); got != "12%" {
+		t.Errorf("got a rate of %q", got)
+	}
+	if got := (InvestmentProduct{AnnualRate: 1075}).RatePercent(); got != "10.75%" {
+		t.Errorf("got a rate of %q", got)
+	}
+	if got := testInvestmentProduct.TenorsText(); got != "90, 180 or 365" {
+		t.Errorf("got tenors of %q", got)
+	}
+}
+
+func TestParseInvestmentTenors(t *testing.T) {
+	tenors, err := parseInvestmentTenors("365, 90,180 90")
+	if err != nil || !slices.Equal(tenors, []uint64{90, 180, 365}) {
+		t.Errorf("got %v %v", tenors, err)
+	}
+
+	if _, err := parseInvestmentTenors("90, a year"); !errors.Is(err, ErrInvalidInvestmentProduct) {
+		t.Errorf("got %v, want %v", err, ErrInvalidInvestmentProduct)
+	}
+}
+
+func TestQuoteInvestment(t *testing.T) {
+	start := time.Date(2026, time.October, 19, 15, 30, 0, 0, time.UTC)
+
+	quote, err := quoteInvestment(testInvestmentProduct, 10000000, 365, start)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+	if quote.Return != 1200000 || quote.MaturityValue != 11200000 || !quote.MaturityDate.Equal(time.Date(2027, time.October, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 12,000 on 100,000 after a year, got %+v", quote)
+	}
+
+	if quote, _ := quoteInvestment(testInvestmentProduct, 10000000, 90, start); quote.Return != 295890 {
+		t.Errorf("expected 2,958.90 after 90 days, got %s", quote.Return)
+	}
+
+	if _, err := quoteInvestment(testInvestmentProduct, 999999, 90, start); err != ErrInvestmentBelowMinimum {
+		t.Errorf("got %v, want %v", err, ErrInvestmentBelowMinimum)
+	}
+	if _, err := quoteInvestment(testInvestmentProduct, 10000000, 100, start); err != ErrInvestmentTenor {
+		t.Errorf("got %v, want %v", err, ErrInvestmentTenor)
+	}
+}
+
+func newInvestmentPosition(start time.Time, rollover bool) InvestmentPosition {
+	return InvestmentPosition{
+		ID:           1,
+		CustomerID:   7,
+		ProductID:    testInvestmentProduct.ID,
+		ProductName:  testInvestmentProduct.Name,
+		Principal:    10000000,
+		AnnualRate:   1000,
+		TenorInDays:  365,
+		StartDate:    start,
+		MaturityDate: start.AddDate(0, 0, 365),
+		Status:       InvestmentPositionActive,
+		Rollover:     rollover,
+	}
+}
+
+func TestInvestmentPosition(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	position := newInvestmentPosition(start, false)
+
+	if got := position.ExpectedReturn(); got != 1000000 {
+		t.Errorf("expected 10,000 at maturity, got %s", got)
+	}
+	if got := position.AccruedReturn(start.AddDate(0, 0, 73)); got != 200000 {
+		t.Errorf("expected 2,000 after 73 days, got %s", got)
+	}
+	if got := position.AccruedReturn(start.AddDate(2, 0, 0)); got != 1000000 {
+		t.Errorf("expected no more than the expected return after it matures, got %s", got)
+	}
+	if position.IsMatured(position.MaturityDate.Add(-time.Hour)) || !position.IsMatured(position.MaturityDate.Add(time.Hour)) {
+		t.Error("expected the position to mature on its maturity date")
+	}
+}
+
+func TestMatureInvestment(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	today := start.AddDate(0, 0, 367)
+
+	t.Run("pays the principal and return out", func(t *testing.T) {
+		maturity := matureInvestment(newInvestmentPosition(start, false), testInvestmentProduct, today)
+
+		if maturity.Position.Status != InvestmentPositionMatured || maturity.Position.Return != 1000000 || maturity.PaidOut != 11000000 || maturity.RolledOverTo != nil {
+			t.Errorf("got %+v", maturity)
+		}
+	})
+
+	t.Run("rolls over at the product's current rate from the maturity date", func(t *testing.T) {
+		position := newInvestmentPosition(start, true)
+		maturity := matureInvestment(position, testInvestmentProduct, today)
+
+		next := maturity.RolledOverTo
+		if maturity.Position.Status != InvestmentPositionRolledOver || maturity.PaidOut != 0 || next == nil {
+			t.Fatalf("got %+v", maturity)
+		}
+		if next.Principal != 11000000 || next.AnnualRate != 1200 || next.RolledOverFrom != 1 || !next.Rollover || !next.StartDate.Equal(position.MaturityDate) || !next.MaturityDate.Equal(position.MaturityDate.AddDate(0, 0, 365)) {
+			t.Errorf("got %+v", next)
+		}
+	})
+
+	t.Run("pays out when the product is no longer offered for the tenor", func(t *testing.T) {
+		for name, product := range map[string]InvestmentProduct{
+			"inactive":    {ID: 1, AnnualRate: 1200, Tenors: []uint64{365}},
+			"other tenor": {ID: 1, AnnualRate: 1200, Tenors: []uint64{90}, Active: true},
+		} {
+			maturity := matureInvestment(newInvestmentPosition(start, true), product, today)
+			if maturity.RolledOverTo != nil || maturity.PaidOut != 11000000 {
+				t.Errorf("%s: got %+v", name, maturity)
+			}
+		}
+	})
+}
+
+func TestInvestmentMaturer(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	newMaturer := func(notifier *FakeNotifier, positions ...InvestmentPosition) (*InvestmentMaturer, *FakeInvestmentMaturityStore) {
+		store := NewFakeInvestmentMaturityStore(testInvestmentProduct)
+		store.contacts[7] = CustomerContact{FirstName: "Ada", Email: "ada@example.com", PhoneNumber: "+2348012345678"}
+		for _, position := range positions {
+			store.positions[position.ID] = position
+		}
+
+		maturer := NewInvestmentMaturer(store, notifier, "https://paz.test")
+		maturer.now = func() time.Time { return start.AddDate(0, 0, 365).Add(time.Hour) }
+		return maturer, store
+	}
+
+	t.Run("pays out and rolls over the positions that have matured", func(t *testing.T) {
+		notMatured := newInvestmentPosition(start.AddDate(0, 0, 1), false)
+		notMatured.ID = 2
+		rolledOver := newInvestmentPosition(start, true)
+		rolledOver.ID = 3
+
+		notifier := &FakeNotifier{}
+		maturer, store := newMaturer(notifier, newInvestmentPosition(start, false), notMatured, rolledOver)
+
+		report, err := maturer.Mature(context.Background())
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if report.Matured != 2 || report.RolledOver != 1 || report.PaidOut != 11000000 || report.Returns != 2000000 {
+			t.Errorf("got %+v", report)
+		}
+		if store.soloSavings[7] != 11000000 || store.positions[2].Status != InvestmentPositionActive {
+			t.Errorf("got %s in solo savings and %+v", store.soloSavings[7], store.positions[2])
+		}
+		if len(store.positions) != 4 {
+			t.Errorf("expected a new position for the rollover, got %d positions", len(store.positions))
+		}
+
+		// an email and an SMS for each
+		if len(notifier.sent) != 4 || !strings.Contains(notifier.sent[0].Body, "paid ₦110,000.00 into your Solo Saver") || !strings.Contains(notifier.sent[2].Body, "reinvested ₦110,000.00") {
+			t.Errorf("got %+v", notifier.sent)
+		}
+
+		if report, _ := maturer.Mature(context.Background()); report.Matured != 0 {
+			t.Errorf("expected nothing to mature the second time, got %+v", report)
+		}
+	})
+
+	t.Run("matures positions when the notices can't be sent", func(t *testing.T) {
+		notifier := &FakeNotifier{failing: map[string]bool{NotificationEmail: true, NotificationSMS: true}}
+		maturer, store := newMaturer(notifier, newInvestmentPosition(start, false))
+
+		report, err := maturer.Mature(context.Background())
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if report.Matured != 1 || store.positions[1].Status != InvestmentPositionMatured {
+			t.Errorf("got %+v and %+v", report, store.positions[1])
+		}
+	})
+}
+
+func TestInvestmentAuditSubjects(t *testing.T) {
+	for subject, want := range map[string]string{
+		investmentProductAuditSubject(3):     "investment-product:3",
+		investmentPositionAuditSubject(8):    "investment-position:8",
+		investmentApplicationAuditSubject(5): "investment-application:5",
+	} {
+		if subject != want {
+			t.Errorf("got %q, want %q", subject, want)
+		}
+	}
+}
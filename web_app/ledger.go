@@ -0,0 +1,482 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The ledger is a double-entry journal. Every movement of money is
+// recorded as a JournalTransaction made up of at least two entries
+// whose debits and credits are equal. The balance columns on the
+// account tables (solo_savings_account.balance_in_k and friends) are
+// kept as a cache that is updated in the same database transaction as
+// the journal, and the ledger-check command verifies that the cache
+// still agrees with the journal.
+
+type LedgerAccountType string
+
+const (
+	LedgerAsset     LedgerAccountType = "ASSET"
+	LedgerLiability LedgerAccountType = "LIABILITY"
+	LedgerEquity    LedgerAccountType = "EQUITY"
+	LedgerIncome    LedgerAccountType = "INCOME"
+	LedgerExpense   LedgerAccountType = "EXPENSE"
+)
+
+type LedgerDirection string
+
+const (
+	LedgerDebit  LedgerDirection = "DEBIT"
+	LedgerCredit LedgerDirection = "CREDIT"
+)
+
+var (
+	ErrJournalUnbalanced      = errors.New("journal debits and credits do not balance")
+	ErrJournalTooFewEntries   = errors.New("a journal needs at least two entries")
+	ErrJournalInvalidAmount   = errors.New("journal entry amounts must be greater than zero")
+	ErrJournalMissingKey      = errors.New("a journal needs an idempotency key")
+	ErrJournalAlreadyPosted   = errors.New("a journal with this idempotency key has already been posted")
+	ErrJournalInvalidAccount  = errors.New("journal entry has an invalid account")
+	ErrInsufficientLedgerFund = errors.New("account does not have enough funds for this posting")
+)
+
+type LedgerAccount struct {
+	// Code uniquely identifies the account, e.g. SOLO_SAVINGS:12
+	Code       string
+	Type       LedgerAccountType
+	CustomerID uint
+}
+
+type LedgerEntry struct {
+	Account   LedgerAccount
+	Direction LedgerDirection
+	Amount    Money
+}
+
+type JournalTransaction struct {
+	// IdempotencyKey stops the same business event (a payment
+	// reference, a withdrawal id) from being journalled twice
+	IdempotencyKey string
+	Description    string
+	Entries        []LedgerEntry
+}
+
+// Validate checks that the journal can be posted. It doesn't touch
+// the database.
+func (j JournalTransaction) Validate() error {
+	if j.IdempotencyKey == "" {
+		return ErrJournalMissingKey
+	}
+
+	if len(j.Entries) < 2 {
+		return ErrJournalTooFewEntries
+	}
+
+	var debits, credits Money
+	for _, entry := range j.Entries {
+		if entry.Account.Code == "" || entry.Account.Type == "" {
+			return ErrJournalInvalidAccount
+		}
+
+		if entry.Amount <= 0 {
+			return ErrJournalInvalidAmount
+		}
+
+		var err error
+		switch entry.Direction {
+		case LedgerDebit:
+			debits, err = debits.Add(entry.Amount)
+		case LedgerCredit:
+			credits, err = credits.Add(entry.Amount)
+		default:
+			return fmt.Errorf("unknown ledger direction %q", entry.Direction)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if debits != credits {
+		return ErrJournalUnbalanced
+	}
+
+	return nil
+}
+
+// normalBalance returns the signed effect of an entry on its
+// account's balance. Assets and expenses grow with debits, the rest
+// grow with credits.
+func normalBalance(accountType LedgerAccountType, direction LedgerDirection, amount Money) Money {
+	debitNormal := accountType == LedgerAsset || accountType == LedgerExpense
+
+	if (direction == LedgerDebit) == debitNormal {
+		return amount
+	}
+	return -amount
+}
+
+// Platform accounts
+
+func cashAtPaystackLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "CASH_AT_PAYSTACK", Type: LedgerAsset}
+}
+
+// payoutsInTransitLedgerAccount holds the money for payouts that the
+// provider hasn't finished sending
+func payoutsInTransitLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "PAYOUTS_IN_TRANSIT", Type: LedgerLiability}
+}
+
+// refundsInTransitLedgerAccount holds the money for refunds that the
+// provider hasn't finished sending
+func refundsInTransitLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "REFUNDS_IN_TRANSIT", Type: LedgerLiability}
+}
+
+// disputedFundsLedgerAccount holds the money for payments that are
+// being disputed
+func disputedFundsLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "DISPUTED_FUNDS", Type: LedgerLiability}
+}
+
+// chargebackLossesLedgerAccount is money lost to disputes that we
+// couldn't hold from the customer
+func chargebackLossesLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "CHARGEBACK_LOSSES", Type: LedgerExpense}
+}
+
+// loanInterestIncomeLedgerAccount is the interest that customers pay
+// on their loans
+func loanInterestIncomeLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "LOAN_INTEREST_INCOME", Type: LedgerIncome}
+}
+
+// loanPenaltyIncomeLedgerAccount is what customers pay for being late
+// with their installments
+func loanPenaltyIncomeLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "LOAN_PENALTY_INCOME", Type: LedgerIncome}
+}
+
+func loanFeeIncomeLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "LOAN_FEE_INCOME", Type: LedgerIncome}
+}
+
+// adjustmentsLedgerAccount is what customers' balances have been
+// corrected by, by hand
+func adjustmentsLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "MANUAL_ADJUSTMENTS", Type: LedgerExpense}
+}
+
+func interestExpenseLedgerAccount() LedgerAccount {
+	return LedgerAccount{Code: "INTEREST_EXPENSE", Type: LedgerExpense}
+}
+
+// Customer accounts. Savings owed to customers are liabilities of
+// Paz, money lent out is an asset.
+
+func soloSavingsLedgerAccount(customerID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("SOLO_SAVINGS:%d", customerID), Type: LedgerLiability, CustomerID: customerID}
+}
+
+func familyVaultLedgerAccount(planID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("FAMILY_VAULT:%d", planID), Type: LedgerLiability}
+}
+
+func targetSavingsLedgerAccount(customerID, planID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("TARGET_SAVINGS:%d", planID), Type: LedgerLiability, CustomerID: customerID}
+}
+
+func investmentLedgerAccount(customerID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("INVESTMENT:%d", customerID), Type: LedgerLiability, CustomerID: customerID}
+}
+
+func investmentPositionLedgerAccount(customerID, positionID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("INVESTMENT_POSITION:%d", positionID), Type: LedgerLiability, CustomerID: customerID}
+}
+
+func loansReceivableLedgerAccount(customerID uint) LedgerAccount {
+	return LedgerAccount{Code: fmt.Sprintf("LOANS_RECEIVABLE:%d", customerID), Type: LedgerAsset, CustomerID: customerID}
+}
+
+// Journal builders for the movements we support
+
+// depositJournal records money that arrived at Paystack on behalf of a customer's account
+func depositJournal(idempotencyKey string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("deposit into %s", account.Code),
+		Entries: []LedgerEntry{
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// withdrawalJournal records money paid out of a customer's account
+func withdrawalJournal(idempotencyKey string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("withdrawal from %s", account.Code),
+		Entries: []LedgerEntry{
+			{Account: account, Direction: LedgerDebit, Amount: amount},
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// interestJournal records interest that Paz pays into a customer's account
+func interestJournal(idempotencyKey string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("interest posted to %s", account.Code),
+		Entries: []LedgerEntry{
+			{Account: interestExpenseLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// adjustmentJournal records an admin paying money into, or taking it
+// out of, a customer's account by hand
+func adjustmentJournal(idempotencyKey string, account LedgerAccount, amount Money, credit bool) JournalTransaction {
+	if credit {
+		return JournalTransaction{
+			IdempotencyKey: idempotencyKey,
+			Description:    fmt.Sprintf("adjustment paid into %s", account.Code),
+			Entries: []LedgerEntry{
+				{Account: adjustmentsLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+				{Account: account, Direction: LedgerCredit, Amount: amount},
+			},
+		}
+	}
+
+	return JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("adjustment taken out of %s", account.Code),
+		Entries: []LedgerEntry{
+			{Account: account, Direction: LedgerDebit, Amount: amount},
+			{Account: adjustmentsLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// transferJournal records money moving between two accounts that
+// Paz owes a customer, e.g. into an investment and out at maturity
+func transferJournal(idempotencyKey string, from, to LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("transfer from %s to %s", from.Code, to.Code),
+		Entries: []LedgerEntry{
+			{Account: from, Direction: LedgerDebit, Amount: amount},
+			{Account: to, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// loanRepaymentJournal records money a customer paid back on a loan.
+// Only the principal comes off what they owe; interest, fees and
+// penalties are income.
+func loanRepaymentJournal(idempotencyKey string, customerID uint, allocation LoanAllocation) JournalTransaction {
+	journal := JournalTransaction{
+		IdempotencyKey: idempotencyKey,
+		Description:    fmt.Sprintf("loan repayment from customer %d", customerID),
+		Entries: []LedgerEntry{
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerDebit, Amount: allocation.PenaltyPaid + allocation.FeePaid + allocation.InterestPaid + allocation.PrincipalPaid},
+		},
+	}
+
+	for _, credit := range loanRepaymentPortions(customerID, allocation) {
+		credit.Direction = LedgerCredit
+		journal.Entries = append(journal.Entries, credit)
+	}
+
+	return journal
+}
+
+// loanRepaymentPortions are the accounts that the parts of a loan
+// repayment went to, without a direction. Parts of nothing are left out.
+func loanRepaymentPortions(customerID uint, allocation LoanAllocation) []LedgerEntry {
+	var portions []LedgerEntry
+	for _, portion := range []LedgerEntry{
+		{Account: loanPenaltyIncomeLedgerAccount(), Amount: allocation.PenaltyPaid},
+		{Account: loanFeeIncomeLedgerAccount(), Amount: allocation.FeePaid},
+		{Account: loanInterestIncomeLedgerAccount(), Amount: allocation.InterestPaid},
+		{Account: loansReceivableLedgerAccount(customerID), Amount: allocation.PrincipalPaid},
+	} {
+		if portion.Amount > 0 {
+			portions = append(portions, portion)
+		}
+	}
+	return portions
+}
+
+// splitJournalEntry shares a journal's entry on account out over
+// portions, in the entry's direction. Refunds and disputes of a loan
+// repayment use it to take each part of the repayment back from where
+// it went.
+func splitJournalEntry(journal JournalTransaction, account LedgerAccount, portions []LedgerEntry) JournalTransaction {
+	var entries []LedgerEntry
+	for _, entry := range journal.Entries {
+		if entry.Account.Code != account.Code {
+			entries = append(entries, entry)
+			continue
+		}
+		for _, portion := range portions {
+			portion.Direction = entry.Direction
+			entries = append(entries, portion)
+		}
+	}
+	journal.Entries = entries
+	return journal
+}
+
+// payoutHoldJournal takes a payout's money out of a customer's account
+// while the provider sends it
+func payoutHoldJournal(reference string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("PAYOUT:%s", reference),
+		Description:    fmt.Sprintf("payout %s from %s", reference, account.Code),
+		Entries: []LedgerEntry{
+			{Account: account, Direction: LedgerDebit, Amount: amount},
+			{Account: payoutsInTransitLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// payoutSettledJournal records a payout that the provider sent
+func payoutSettledJournal(reference string, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("PAYOUT_SETTLED:%s", reference),
+		Description:    fmt.Sprintf("payout %s sent", reference),
+		Entries: []LedgerEntry{
+			{Account: payoutsInTransitLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// payoutReleasedJournal gives back the money of a payout that was
+// never sent
+func payoutReleasedJournal(reference string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("PAYOUT_RELEASED:%s", reference),
+		Description:    fmt.Sprintf("payout %s failed, returned to %s", reference, account.Code),
+		Entries: []LedgerEntry{
+			{Account: payoutsInTransitLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// payoutReversedJournal gives back the money of a payout that was sent,
+// then came back to us
+func payoutReversedJournal(reference string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("PAYOUT_REVERSED:%s", reference),
+		Description:    fmt.Sprintf("payout %s reversed, returned to %s", reference, account.Code),
+		Entries: []LedgerEntry{
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// refundHoldJournal takes a refund's amount out of what the payment
+// was credited to while the provider sends it back
+func refundHoldJournal(reference string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("REFUND:%s", reference),
+		Description:    fmt.Sprintf("refund %s from %s", reference, account.Code),
+		Entries: []LedgerEntry{
+			{Account: account, Direction: LedgerDebit, Amount: amount},
+			{Account: refundsInTransitLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// refundProcessedJournal records a refund that the provider sent
+func refundProcessedJournal(reference string, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("REFUND_PROCESSED:%s", reference),
+		Description:    fmt.Sprintf("refund %s sent", reference),
+		Entries: []LedgerEntry{
+			{Account: refundsInTransitLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// refundFailedJournal gives back the amount of a refund that was
+// never sent
+func refundFailedJournal(reference string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("REFUND_FAILED:%s", reference),
+		Description:    fmt.Sprintf("refund %s failed, returned to %s", reference, account.Code),
+		Entries: []LedgerEntry{
+			{Account: refundsInTransitLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// disputeHoldJournal holds a disputed amount out of what the payment
+// was credited to
+func disputeHoldJournal(key string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("DISPUTE:%s", key),
+		Description:    fmt.Sprintf("dispute %s held from %s", key, account.Code),
+		Entries: []LedgerEntry{
+			{Account: account, Direction: LedgerDebit, Amount: amount},
+			{Account: disputedFundsLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// disputeWonJournal gives back a held amount once a dispute is decided
+// in our favour
+func disputeWonJournal(key string, account LedgerAccount, amount Money) JournalTransaction {
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("DISPUTE_WON:%s", key),
+		Description:    fmt.Sprintf("dispute %s won, returned to %s", key, account.Code),
+		Entries: []LedgerEntry{
+			{Account: disputedFundsLedgerAccount(), Direction: LedgerDebit, Amount: amount},
+			{Account: account, Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+// disputeLostJournal records the money that the bank took back for a
+// lost dispute. held is false when it couldn't be held from the
+// customer, and Paz bears the loss.
+func disputeLostJournal(key string, held bool, amount Money) JournalTransaction {
+	from := disputedFundsLedgerAccount()
+	if !held {
+		from = chargebackLossesLedgerAccount()
+	}
+
+	return JournalTransaction{
+		IdempotencyKey: fmt.Sprintf("DISPUTE_LOST:%s", key),
+		Description:    fmt.Sprintf("dispute %s lost", key),
+		Entries: []LedgerEntry{
+			{Account: from, Direction: LedgerDebit, Amount: amount},
+			{Account: cashAtPaystackLedgerAccount(), Direction: LedgerCredit, Amount: amount},
+		},
+	}
+}
+
+type LedgerDiscrepancy struct {
+	AccountCode string
+	// CachedBalance is what the account table says, LedgerBalance is what the journal says
+	CachedBalance Money
+	LedgerBalance Money
+	Reason        string
+}
+
+func (l LedgerDiscrepancy) String() string {
+	return fmt.Sprintf("%s: %s (cached %s, ledger %s)", l.AccountCode, l.Reason, l.CachedBalance, l.LedgerBalance)
+}
+
+type LedgerPostingInformation struct {
+	LedgerTransactionID uint
+}
@@ -0,0 +1,118 @@
+package web_app
+
+import "testing"
+
+func TestJournalValidation(t *testing.T) {
+	t.Run("accepts a balanced deposit journal", func(t *testing.T) {
+		journal := depositJournal("PAYMENT:1", soloSavingsLedgerAccount(1), 50000)
+
+		if err := journal.Validate(); err != nil {
+			t.Errorf("expected a balanced journal to be valid, got %q", err)
+		}
+	})
+
+	t.Run("rejects a journal whose debits and credits differ", func(t *testing.T) {
+		journal := JournalTransaction{
+			IdempotencyKey: "unbalanced",
+			Entries: []LedgerEntry{
+				{Account: cashAtPaystackLedgerAccount(), Direction: LedgerDebit, Amount: 100},
+				{Account: soloSavingsLedgerAccount(1), Direction: LedgerCredit, Amount: 90},
+			},
+		}
+
+		if err := journal.Validate(); err != ErrJournalUnbalanced {
+			t.Errorf("expected %q, got %v", ErrJournalUnbalanced, err)
+		}
+	})
+
+	t.Run("rejects a journal with a single entry", func(t *testing.T) {
+		journal := JournalTransaction{
+			IdempotencyKey: "single",
+			Entries: []LedgerEntry{
+				{Account: cashAtPaystackLedgerAccount(), Direction: LedgerDebit, Amount: 100},
+			},
+		}
+
+		if err := journal.Validate(); err != ErrJournalTooFewEntries {
+			t.Errorf("expected %q, got %v", ErrJournalTooFewEntries, err)
+		}
+	})
+
+	t.Run("rejects zero and negative amounts", func(t *testing.T) {
+		for _, amount := range []Money{0, -100} {
+			journal := withdrawalJournal("WITHDRAWAL:1", soloSavingsLedgerAccount(1), amount)
+
+			if err := journal.Validate(); err != ErrJournalInvalidAmount {
+				t.Errorf("expected %q for amount %s, got %v", ErrJournalInvalidAmount, amount, err)
+			}
+		}
+	})
+
+	t.Run("rejects a journal without an idempotency key", func(t *testing.T) {
+		journal := interestJournal("", soloSavingsLedgerAccount(1), 100)
+
+		if err := journal.Validate(); err != ErrJournalMissingKey {
+			t.Errorf("expected %q, got %v", ErrJournalMissingKey, err)
+		}
+	})
+}
+
+func TestNormalBalance(t *testing.T) {
+	tt := []struct {
+		name      string
+		account   LedgerAccount
+		direction LedgerDirection
+		want      Money
+	}{
+		{"a credit grows a savings liability", soloSavingsLedgerAccount(1), LedgerCredit, 100},
+		{"a debit shrinks a savings liability", soloSavingsLedgerAccount(1), LedgerDebit, -100},
+		{"a debit grows cash", cashAtPaystackLedgerAccount(), LedgerDebit, 100},
+		{"a debit grows interest expense", interestExpenseLedgerAccount(), LedgerDebit, 100},
+		{"a credit shrinks loans receivable", loansReceivableLedgerAccount(1), LedgerCredit, -100},
+	}
+
+	for _, value := range tt {
+		got := normalBalance(value.account.Type, value.direction, 100)
+
+		if got != value.want {
+			t.Errorf("%s: wanted %s but got %s", value.name, value.want, got)
+		}
+	}
+}
+
+func TestPayoutJournals(t *testing.T) {
+	account := soloSavingsLedgerAccount(1)
+
+	// what each journal does to the customer, and to the money in transit
+	tt := []struct {
+		name      string
+		journal   JournalTransaction
+		customer  Money
+		inTransit Money
+	}{
+		{"hold", payoutHoldJournal("ref", account, 100), -100, 100},
+		{"settled", payoutSettledJournal("ref", 100), 0, -100},
+		{"released", payoutReleasedJournal("ref", account, 100), 100, -100},
+		{"reversed", payoutReversedJournal("ref", account, 100), 100, 0},
+	}
+
+	for _, value := range tt {
+		if err := value.journal.Validate(); err != nil {
+			t.Errorf("%s: expected a valid journal, got %q", value.name, err)
+		}
+
+		var customer, inTransit Money
+		for _, entry := range value.journal.Entries {
+			switch entry.Account.Code {
+			case account.Code:
+				customer += normalBalance(entry.Account.Type, entry.Direction, entry.Amount)
+			case payoutsInTransitLedgerAccount().Code:
+				inTransit += normalBalance(entry.Account.Type, entry.Direction, entry.Amount)
+			}
+		}
+
+		if customer != value.customer || inTransit != value.inTransit {
+			t.Errorf("%s: wanted %s to the customer and %s in transit, got %s and %s", value.name, value.customer, value.inTransit, customer, inTransit)
+		}
+	}
+}
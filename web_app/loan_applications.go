@@ -0,0 +1,232 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// A loan application is submitted by a customer, reviewed and decided
+// on by an admin, then paid out to the customer's bank account. It
+// becomes an active loan once the payout has gone through, and ends
+// when the loan is repaid or defaulted on. Every change of status is
+// kept in the audit log.
+
+// Loan application statuses
+const (
+	LoanApplicationSubmitted   = "SUBMITTED"
+	LoanApplicationUnderReview = "UNDER_REVIEW"
+	LoanApplicationApproved    = "APPROVED"
+	LoanApplicationRejected    = "REJECTED"
+	// LoanApplicationDisbursed applications are being paid out
+	LoanApplicationDisbursed = "DISBURSED"
+	LoanApplicationActive    = "ACTIVE"
+	LoanApplicationRepaid    = "REPAID"
+	LoanApplicationDefaulted = "DEFAULTED"
+)
+
+// loanApplicationTransitions are the statuses that an application can
+// move to from each status
+var loanApplicationTransitions = map[string][]string{
+	LoanApplicationSubmitted:   {LoanApplicationUnderReview, LoanApplicationRejected},
+	LoanApplicationUnderReview: {LoanApplicationApproved, LoanApplicationRejected},
+	LoanApplicationApproved:    {LoanApplicationDisbursed, LoanApplicationRejected},
+	// payouts that don't go through, or come back, send the
+	// application back to approved
+	LoanApplicationDisbursed: {LoanApplicationActive, LoanApplicationApproved},
+	LoanApplicationActive:    {LoanApplicationRepaid, LoanApplicationDefaulted, LoanApplicationApproved},
+	LoanApplicationDefaulted: {LoanApplicationRepaid},
+	// refunds and disputes of a repayment can take back what paid
+	// the loan off
+	LoanApplicationRepaid: {LoanApplicationActive},
+}
+
+// Audit log actions for loan applications
+const (
+	AuditLoanApplicationSubmitted = "LOAN_APPLICATION_SUBMITTED"
+	AuditLoanApplicationStatus    = "LOAN_APPLICATION_STATUS"
+)
+
+// The bounds of what can be applied for
+const (
+	minimumLoanAmount       Money = 100000
+	minimumLoanDurationDays       = 3
+	maximumLoanDurationDays       = 1000
+)
+
+var (
+	ErrLoanApplicationDoesNotExist = errors.New("loan application does not exist")
+	ErrLoanApplicationInProgress   = errors.New("you already have a loan application in progress")
+	ErrLoanApplicationTransition   = errors.New("the loan application can't move to that status")
+	ErrLoanApplicationNoteRequired = errors.New("rejections need a note saying why")
+	ErrBVNRequired                 = errors.New("a BVN is needed to apply for a loan")
+	ErrInvalidBVN                  = errors.New("BVNs are 11 digits")
+	ErrBVNInUse                    = errors.New("that BVN belongs to another account")
+)
+
+var bvnPattern = regexp.MustCompile(`^[0-9]{11}$`)
+
+type LoanApplication struct {
+	ID             uint
+	CustomerID     uint
+	Amount         Money
+	DurationInDays uint64
+	BVN            string
+	BankAccountID  uint
+	// the application is priced when it is made, and its loan keeps
+	// that price
+	LoanPricing
+	Frequency string
+	// Credit is what the customer was scored when they applied
+	Credit CreditDecision
+	// Statement is what was read from the bank statement the customer
+	// uploaded when they applied. It is only set on new applications;
+	// GetLoanApplicationStatement has it after that.
+	Statement *BankStatementAnalysis
+	// Guarantors are the email addresses and phone numbers of the
+	// guarantors nominated with a new application
+	Guarantors []string
+	// GuarantorsRequired is how many guarantors have to agree before
+	// the application can be approved
+	GuarantorsRequired int
+	GuarantorsAccepted int
+	Status             string
+	DecisionNote       string
+	// ReviewedBy is the admin that last acted on the application
+	ReviewedBy uint
+	ReviewedAt time.Time
+	// LoanID is set once the application has been paid out
+	LoanID    uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// InProgress is true until the application is rejected, or its loan
+// is repaid. A customer whose loan defaulted can't apply again until
+// it is repaid.
+func (a LoanApplication) InProgress() bool {
+	switch a.Status {
+	case LoanApplicationRejected, LoanApplicationRepaid:
+		return false
+	}
+	return true
+}
+
+// HasGuarantorConsent is true once enough guarantors have agreed to
+// the application for it to be approved
+func (a LoanApplication) HasGuarantorConsent() bool {
+	return a.GuarantorsAccepted >= a.GuarantorsRequired
+}
+
+type LoanApplicationStore interface {
+	// CreateLoanApplication saves a submitted application, and the BVN
+	// the customer applied with if it isn't on file yet. Customers with
+	// an application in progress get ErrLoanApplicationInProgress.
+	CreateLoanApplication(application LoanApplication) (uint, error)
+	GetLoanApplication(id uint) (LoanApplication, error)
+	// GetLoanApplications lists applications for the admin queue
+	GetLoanApplications(filter AdminQueueFilter) ([]LoanApplication, error)
+	// GetCustomerLoanApplications lists a customer's applications,
+	// newest first
+	GetCustomerLoanApplications(customerID uint) ([]LoanApplication, error)
+	// GetBVN is the BVN on file for a customer, or "" if there isn't one
+	GetBVN(customerID uint) (string, error)
+	// TransitionLoanApplication moves an application to status and
+	// records who did it in the audit log. A reviewer of 0 is the
+	// system.
+	TransitionLoanApplication(id uint, status string, reviewer uint, note string) (LoanApplication, error)
+}
+
+func canTransitionLoanApplication(from, to string) bool {
+	for _, status := range loanApplicationTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+func isLoanApplicationStatus(status string) bool {
+	switch status {
+	case LoanApplicationSubmitted, LoanApplicationUnderReview, LoanApplicationApproved, LoanApplicationRejected,
+		LoanApplicationDisbursed, LoanApplicationActive, LoanApplicationRepaid, LoanApplicationDefaulted:
+		return true
+	}
+	return false
+}
+
+func loanApplicationAuditSubject(id uint) string {
+	return fmt.Sprintf("loan-application:%d", id)
+}
+
+func loanApplicationRejectedNotice(contact CustomerContact, application LoanApplication, baseURL string) (string, string) {
+	return "Your loan application wasn't approved", fmt.Sprintf("Hi %s, we couldn't approve your application to borrow %s: %s. See your loans at %s/dashboard/loans.",
+		contact.FirstName, application.Amount, application.DecisionNote, baseURL)
+}
+
+func validateBVN(bvn string) error {
+	if !bvnPattern.MatchString(bvn) {
+		return ErrInvalidBVN
+	}
+	return nil
+}
+
+// Terms is what the application asks to borrow, at the price it was
+// made with
+func (a LoanApplication) Terms() LoanTerms {
+	return LoanTerms{
+		LoanPricing:    a.LoanPricing,
+		Principal:      a.Amount,
+		DurationInDays: a.DurationInDays,
+		Frequency:      a.Frequency,
+	}
+}
+
+// loanApplicationSchedule is the loan that an application becomes
+// when it is paid out on disbursedAt, with its amortization schedule
+func loanApplicationSchedule(application LoanApplication, disbursedAt time.Time) (Loan, error) {
+	quote, err := quoteLoan(application.Terms(), disbursedAt)
+	if err != nil {
+		return Loan{}, err
+	}
+
+	return Loan{
+		CustomerID:   application.CustomerID,
+		Principal:    application.Amount,
+		Status:       LoanActive,
+		LoanPricing:  application.LoanPricing,
+		Frequency:    application.Frequency,
+		DisbursedAt:  disbursedAt,
+		Installments: quote.Installments,
+	}, nil
+}
+
+// disburseLoanApplication pays an approved application out to the bank
+// account it was made with. The loan is made once the payout's
+// transfer has gone through.
+func disburseLoanApplication(ctx context.Context, store LoanApplicationStore, payouts *PayoutService, id, reviewer uint) (Payout, error) {
+	application, err := store.TransitionLoanApplication(id, LoanApplicationDisbursed, reviewer, "")
+	if err != nil {
+		return Payout{}, err
+	}
+
+	payout, err := payouts.Pay(ctx, Payout{
+		CustomerID:    application.CustomerID,
+		BankAccountID: application.BankAccountID,
+		Purpose:       PayoutPurposeLoanDisbursement,
+		SourceID:      application.ID,
+		Amount:        application.Amount,
+	})
+
+	// payouts that were made are settled by their transfer webhooks, or
+	// sent again. The others never held any money.
+	if err != nil && payout.ID == 0 {
+		if _, transitionErr := store.TransitionLoanApplication(id, LoanApplicationApproved, 0, fmt.Sprintf("the payout couldn't be made: %s", err)); transitionErr != nil {
+			return payout, errors.Join(err, transitionErr)
+		}
+	}
+
+	return payout, err
+}
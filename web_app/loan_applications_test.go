@@ -0,0 +1,330 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeLoanApplicationStore moves applications through their statuses
+// the way the database does, including when their payouts end
+type FakeLoanApplicationStore struct {
+	*FakePayoutStore
+	applications map[uint]LoanApplication
+	loans        map[uint]Loan
+	audit        []AuditEntry
+}
+
+func NewFakeLoanApplicationStore() *FakeLoanApplicationStore {
+	return &FakeLoanApplicationStore{
+		FakePayoutStore: NewFakePayoutStore(),
+		applications:    map[uint]LoanApplication{},
+		loans:           map[uint]Loan{},
+	}
+}
+
+func (f *FakeLoanApplicationStore) CreateLoanApplication(application LoanApplication) (uint, error) {
+	for _, existing := range f.applications {
+		if existing.CustomerID == application.CustomerID && existing.InProgress() {
+			return 0, ErrLoanApplicationInProgress
+		}
+	}
+
+	application.ID = uint(len(f.applications) + 1)
+	application.Status = LoanApplicationSubmitted
+	f.applications[application.ID] = application
+	return application.ID, nil
+}
+
+func (f *FakeLoanApplicationStore) GetLoanApplication(id uint) (LoanApplication, error) {
+	application, ok := f.applications[id]
+	if !ok {
+		return application, ErrLoanApplicationDoesNotExist
+	}
+	return application, nil
+}
+
+func (f *FakeLoanApplicationStore) GetLoanApplications(filter AdminQueueFilter) ([]LoanApplication, error) {
+	var applications []LoanApplication
+	for _, application := range f.applications {
+		if filter.Status == "" || application.Status == filter.Status {
+			applications = append(applications, application)
+		}
+	}
+	return applications, nil
+}
+
+func (f *FakeLoanApplicationStore) GetCustomerLoanApplications(customerID uint) ([]LoanApplication, error) {
+	var applications []LoanApplication
+	for _, application := range f.applications {
+		if application.CustomerID == customerID {
+			applications = append(applications, application)
+		}
+	}
+	return applications, nil
+}
+
+func (f *FakeLoanApplicationStore) GetBVN(customerID uint) (string, error) {
+	return "", nil
+}
+
+func (f *FakeLoanApplicationStore) TransitionLoanApplication(id uint, status string, reviewer uint, note string) (LoanApplication, error) {
+	application, err := f.GetLoanApplication(id)
+	if err != nil {
+		return application, err
+	}
+
+	if !canTransitionLoanApplication(application.Status, status) {
+		return application, ErrLoanApplicationTransition
+	}
+	if status == LoanApplicationRejected && note == "" {
+		return application, ErrLoanApplicationNoteRequired
+	}
+	if status == LoanApplicationApproved && !application.HasGuarantorConsent() {
+		return application, ErrGuarantorConsentRequired
+	}
+
+	actor := ActorSystem
+	if reviewer != 0 {
+		actor = adminActor(reviewer)
+		application.ReviewedBy = reviewer
+	}
+	if note != "" {
+		application.DecisionNote = note
+	}
+
+	f.audit = append(f.audit, AuditEntry{Actor: actor, Action: AuditLoanApplicationStatus, Subject: loanApplicationAuditSubject(id), Detail: application.Status + " to " + status})
+	application.Status = status
+	f.applications[id] = application
+	return application, nil
+}
+
+func (f *FakeLoanApplicationStore) SettlePayout(reference uuid.UUID) error {
+	if err := f.FakePayoutStore.SettlePayout(reference); err != nil {
+		return err
+	}
+	return f.endDisbursement(reference)
+}
+
+func (f *FakeLoanApplicationStore) FailPayout(reference uuid.UUID, status, reason string) error {
+	if err := f.FakePayoutStore.FailPayout(reference, status, reason); err != nil {
+		return err
+	}
+	return f.endDisbursement(reference)
+}
+
+func (f *FakeLoanApplicationStore) endDisbursement(reference uuid.UUID) error {
+	payout := f.payouts[reference]
+	application := f.applications[payout.SourceID]
+
+	if payout.Status == PayoutSuccessful {
+		if application.Status != LoanApplicationDisbursed {
+			return nil
+		}
+		loan, err := loanApplicationSchedule(application, time.Now())
+		if err != nil {
+			return err
+		}
+		application.LoanID = uint(len(f.loans) + 1)
+		f.loans[application.LoanID] = loan
+		f.applications[application.ID] = application
+		_, err = f.TransitionLoanApplication(application.ID, LoanApplicationActive, 0, "")
+		return err
+	}
+
+	if application.Status != LoanApplicationDisbursed && application.Status != LoanApplicationActive {
+		return nil
+	}
+	_, err := f.TransitionLoanApplication(application.ID, LoanApplicationApproved, 0, "the payout was "+payout.Status)
+	return err
+}
+
+// newApprovedLoanApplication links a bank account for customer 1 and
+// approves their application for amount
+func newApprovedLoanApplication(t *testing.T, amount Money) (*SandboxProvider, *PayoutService, *FakeLoanApplicationStore, uint) {
+	t.Helper()
+
+	store := NewFakeLoanApplicationStore()
+	fulfillment := NewFakeFulfillmentStore()
+	sandbox := newSandboxProcessor(t, fulfillment, store, NewFakeRefundStore(fulfillment))
+	payouts := NewPayoutService(store, NewPaymentProviders(sandbox))
+
+	account, err := payouts.LinkBankAccount(context.Background(), 1, "058", "0123456789")
+	if err != nil {
+		t.Fatalf("did not expect an error linking the account, got %q", err)
+	}
+
+	id, _ := store.CreateLoanApplication(LoanApplication{CustomerID: 1, Amount: amount, DurationInDays: 30, BVN: "22123456789", BankAccountID: account.ID, LoanPricing: defaultLoanPricing, Frequency: MonthlyInstallments})
+	store.TransitionLoanApplication(id, LoanApplicationUnderReview, 2, "")
+	store.TransitionLoanApplication(id, LoanApplicationApproved, 2, "")
+	return sandbox, payouts, store, id
+}
+
+func TestLoanApplicationTransitions(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{LoanApplicationSubmitted, LoanApplicationUnderReview, true},
+		{LoanApplicationSubmitted, LoanApplicationApproved, false},
+		{LoanApplicationUnderReview, LoanApplicationApproved, true},
+		{LoanApplicationApproved, LoanApplicationDisbursed, true},
+		{LoanApplicationDisbursed, LoanApplicationActive, true},
+		{LoanApplicationActive, LoanApplicationRepaid, true},
+		{LoanApplicationRejected, LoanApplicationApproved, false},
+		{LoanApplicationRepaid, LoanApplicationActive, true},
+		{LoanApplicationRepaid, LoanApplicationApproved, false},
+	}
+
+	for _, c := range cases {
+		if got := canTransitionLoanApplication(c.from, c.to); got != c.want {
+			t.Errorf("%s to %s: got %t, want %t", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestLoanApplications(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("turns away a second application in progress", func(t *testing.T) {
+		store := NewFakeLoanApplicationStore()
+		store.CreateLoanApplication(LoanApplication{CustomerID: 1, Amount: 5000000})
+
+		if _, err := store.CreateLoanApplication(LoanApplication{CustomerID: 1, Amount: 5000000}); err != ErrLoanApplicationInProgress {
+			t.Errorf("got %v, want %v", err, ErrLoanApplicationInProgress)
+		}
+	})
+
+	t.Run("becomes a loan once it has been paid out", func(t *testing.T) {
+		sandbox, payouts, store, id := newApprovedLoanApplication(t, 5000000)
+
+		payout, err := disburseLoanApplication(ctx, store, payouts, id, 2)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if application := store.applications[id]; application.Status != LoanApplicationDisbursed {
+			t.Errorf("expected the application to be disbursed, got %+v", application)
+		}
+
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+
+		application := store.applications[id]
+		if application.Status != LoanApplicationActive || application.LoanID == 0 {
+			t.Fatalf("expected the application to be active with a loan, got %+v", application)
+		}
+
+		if loan := store.loans[application.LoanID]; loan.Principal != 5000000 || loan.Outstanding() != 5250000 {
+			t.Errorf("expected a loan of 50,000 with 4%% interest and a 1%% fee, got %+v", loan)
+		}
+	})
+
+	t.Run("goes back to approved when the payout fails", func(t *testing.T) {
+		sandbox, payouts, store, id := newApprovedLoanApplication(t, 5000000)
+
+		payout, _ := disburseLoanApplication(ctx, store, payouts, id, 2)
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferFailed)
+
+		if application := store.applications[id]; application.Status != LoanApplicationApproved || application.DecisionNote == "" {
+			t.Errorf("expected the application to be approved again with why, got %+v", application)
+		}
+	})
+
+	t.Run("can be paid out again once the payout fails or is reversed", func(t *testing.T) {
+		for _, status := range []string{TransferFailed, TransferReversed} {
+			sandbox, payouts, store, id := newApprovedLoanApplication(t, 5000000)
+
+			payout, _ := disburseLoanApplication(ctx, store, payouts, id, 2)
+			if status == TransferReversed {
+				sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+			}
+			sandbox.CompleteTransfer(ctx, payout.Reference.String(), status)
+			if application := store.applications[id]; application.Status != LoanApplicationApproved {
+				t.Fatalf("%s: expected the application to be approved again, got %+v", status, application)
+			}
+
+			again, err := disburseLoanApplication(ctx, store, payouts, id, 2)
+			if err != nil {
+				t.Fatalf("%s: did not expect an error paying it out again, got %q", status, err)
+			}
+			if again.Reference == payout.Reference {
+				t.Errorf("%s: expected a new payout", status)
+			}
+
+			sandbox.CompleteTransfer(ctx, again.Reference.String(), TransferSuccessful)
+			if application := store.applications[id]; application.Status != LoanApplicationActive || application.LoanID == 0 {
+				t.Errorf("%s: expected the application to be active with a loan, got %+v", status, application)
+			}
+		}
+	})
+
+	t.Run("only pays out approved applications", func(t *testing.T) {
+		_, payouts, store, id := newApprovedLoanApplication(t, 5000000)
+		store.TransitionLoanApplication(id, LoanApplicationRejected, 2, "income too low")
+
+		if _, err := disburseLoanApplication(ctx, store, payouts, id, 2); !errors.Is(err, ErrLoanApplicationTransition) {
+			t.Errorf("got %v, want %v", err, ErrLoanApplicationTransition)
+		}
+
+		if len(store.payouts) != 0 {
+			t.Errorf("expected no payout, got %d", len(store.payouts))
+		}
+	})
+
+	t.Run("needs a note to reject", func(t *testing.T) {
+		_, _, store, id := newApprovedLoanApplication(t, 5000000)
+
+		if _, err := store.TransitionLoanApplication(id, LoanApplicationRejected, 2, ""); err != ErrLoanApplicationNoteRequired {
+			t.Errorf("got %v, want %v", err, ErrLoanApplicationNoteRequired)
+		}
+	})
+
+	t.Run("can't be approved until its guarantors agree", func(t *testing.T) {
+		store := NewFakeLoanApplicationStore()
+		id, _ := store.CreateLoanApplication(LoanApplication{CustomerID: 1, Amount: guarantorThreshold, GuarantorsRequired: 1})
+		store.TransitionLoanApplication(id, LoanApplicationUnderReview, 2, "")
+
+		if _, err := store.TransitionLoanApplication(id, LoanApplicationApproved, 2, ""); err != ErrGuarantorConsentRequired {
+			t.Fatalf("got %v, want %v", err, ErrGuarantorConsentRequired)
+		}
+
+		application := store.applications[id]
+		application.GuarantorsAccepted = 1
+		store.applications[id] = application
+
+		if _, err := store.TransitionLoanApplication(id, LoanApplicationApproved, 2, ""); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+	})
+
+	t.Run("goes back to approved when the payout can't be made", func(t *testing.T) {
+		_, payouts, store, id := newApprovedLoanApplication(t, 5000000)
+		application := store.applications[id]
+		application.BankAccountID = 99
+		store.applications[id] = application
+
+		if _, err := disburseLoanApplication(ctx, store, payouts, id, 2); !errors.Is(err, ErrBankAccountDoesNotExist) {
+			t.Errorf("got %v, want %v", err, ErrBankAccountDoesNotExist)
+		}
+
+		if application := store.applications[id]; application.Status != LoanApplicationApproved {
+			t.Errorf("expected the application to be approved again, got %+v", application)
+		}
+	})
+}
+
+func TestValidateBVN(t *testing.T) {
+	for bvn, want := range map[string]error{
+		"22123456789":  nil,
+		"2212345678":   ErrInvalidBVN,
+		"221234567890": ErrInvalidBVN,
+		"2212345678a":  ErrInvalidBVN,
+	} {
+		if err := validateBVN(bvn); err != want {
+			t.Errorf("%q: got %v, want %v", bvn, err, want)
+		}
+	}
+}
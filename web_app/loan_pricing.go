@@ -0,0 +1,158 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Loans are priced with a monthly interest rate, charged either flat on
+// the whole principal or on the balance that is still owed, and a
+// management fee that is due with the first installment. Installments
+// are weekly or monthly, over the term the customer asked for.
+
+// How interest is charged
+const (
+	// InterestFlat charges interest on the whole principal for every
+	// installment
+	InterestFlat = "FLAT"
+	// InterestReducingBalance charges interest on what is still owed,
+	// with installments of the same amount
+	InterestReducingBalance = "REDUCING_BALANCE"
+)
+
+// How often installments fall due
+const (
+	WeeklyInstallments  = "WEEKLY"
+	MonthlyInstallments = "MONTHLY"
+)
+
+var (
+	ErrUnknownInterestMethod       = errors.New("unknown interest method")
+	ErrUnknownInstallmentFrequency = errors.New("unknown installment frequency")
+)
+
+type LoanPricing struct {
+	InterestMethod string
+	// MonthlyRate is the interest charged a month, in basis points
+	MonthlyRate int64
+	// FeeRate is the management fee, in basis points of the principal
+	FeeRate int64
+}
+
+// defaultLoanPricing is what new loan applications are priced at
+var defaultLoanPricing = LoanPricing{InterestMethod: InterestFlat, MonthlyRate: 400, FeeRate: 100}
+
+type LoanTerms struct {
+	LoanPricing
+	Principal      Money
+	DurationInDays uint64
+	Frequency      string
+}
+
+// LoanQuote is what a loan costs, with the schedule it is repaid on
+type LoanQuote struct {
+	Terms        LoanTerms
+	Installments []LoanInstallment
+	// InstallmentAmount is the regular installment, without the fee
+	InstallmentAmount Money
+	Fee               Money
+	TotalInterest     Money
+	// TotalRepayment is everything the customer pays back
+	TotalRepayment Money
+}
+
+// installmentCount is how many installments a term is repaid in, at
+// least one
+func installmentCount(durationInDays uint64, frequency string) (int, error) {
+	var period uint64
+	switch frequency {
+	case WeeklyInstallments:
+		period = 7
+	case MonthlyInstallments:
+		period = 30
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownInstallmentFrequency, frequency)
+	}
+
+	return int(max((durationInDays+period-1)/period, 1)), nil
+}
+
+// installmentRate is the interest rate for each installment's period
+func installmentRate(monthlyRate int64, frequency string) float64 {
+	rate := float64(monthlyRate) / 10000
+	if frequency == WeeklyInstallments {
+		return rate * 7 / 30
+	}
+	return rate
+}
+
+func installmentDueDate(start time.Time, frequency string, number int) time.Time {
+	if frequency == WeeklyInstallments {
+		return start.AddDate(0, 0, 7*number)
+	}
+	return start.AddDate(0, number, 0)
+}
+
+func roundMoney(amount float64) Money {
+	return Money(math.Round(amount))
+}
+
+// quoteLoan prices a loan and works out its amortization schedule, for
+// a loan that is paid out on start
+func quoteLoan(terms LoanTerms, start time.Time) (LoanQuote, error) {
+	quote := LoanQuote{Terms: terms}
+
+	count, err := installmentCount(terms.DurationInDays, terms.Frequency)
+	if err != nil {
+		return quote, err
+	}
+
+	rate := installmentRate(terms.MonthlyRate, terms.Frequency)
+	principal := float64(terms.Principal)
+	balance := terms.Principal
+
+	var payment float64
+	switch terms.InterestMethod {
+	case InterestFlat:
+	case InterestReducingBalance:
+		payment = principal / float64(count)
+		if rate > 0 {
+			payment = principal * rate / (1 - math.Pow(1+rate, -float64(count)))
+		}
+	default:
+		return quote, fmt.Errorf("%w: %q", ErrUnknownInterestMethod, terms.InterestMethod)
+	}
+
+	for number := 1; number <= count; number++ {
+		installment := LoanInstallment{
+			Number:  number,
+			DueDate: installmentDueDate(start, terms.Frequency, number),
+		}
+
+		if terms.InterestMethod == InterestFlat {
+			installment.InterestDue = roundMoney(principal * rate)
+			installment.PrincipalDue = terms.Principal / Money(count)
+		} else {
+			installment.InterestDue = roundMoney(float64(balance) * rate)
+			installment.PrincipalDue = roundMoney(payment) - installment.InterestDue
+		}
+
+		// the last installment pays off whatever rounding left over
+		if number == count || installment.PrincipalDue > balance {
+			installment.PrincipalDue = balance
+		}
+		balance -= installment.PrincipalDue
+
+		quote.TotalInterest += installment.InterestDue
+		quote.Installments = append(quote.Installments, installment)
+	}
+
+	quote.Fee = roundMoney(principal * float64(terms.FeeRate) / 10000)
+	quote.Installments[0].FeeDue = quote.Fee
+	quote.InstallmentAmount = quote.Installments[0].PrincipalDue + quote.Installments[0].InterestDue
+	quote.TotalRepayment = terms.Principal + quote.TotalInterest + quote.Fee
+
+	return quote, nil
+}
@@ -0,0 +1,108 @@
+package web_app
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuoteLoan(t *testing.T) {
+	t.Run("charges flat interest on the whole principal", func(t *testing.T) {
+		quote, err := quoteLoan(LoanTerms{
+			LoanPricing:    LoanPricing{InterestMethod: InterestFlat, MonthlyRate: 400, FeeRate: 100},
+			Principal:      30000000,
+			DurationInDays: 90,
+			Frequency:      MonthlyInstallments,
+		}, loanToday)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(quote.Installments) != 3 {
+			t.Fatalf("got %d installments, want 3", len(quote.Installments))
+		}
+		if quote.InstallmentAmount != 11200000 || quote.TotalInterest != 3600000 || quote.Fee != 300000 {
+			t.Errorf("got %+v", quote)
+		}
+		if want := Money(30000000 + 3600000 + 300000); quote.TotalRepayment != want {
+			t.Errorf("got %s, want %s", quote.TotalRepayment, want)
+		}
+		if !quote.Installments[2].DueDate.Equal(loanToday.AddDate(0, 3, 0)) {
+			t.Errorf("the last installment is due on %s", quote.Installments[2].DueDate)
+		}
+	})
+
+	t.Run("charges less on a reducing balance", func(t *testing.T) {
+		terms := LoanTerms{
+			LoanPricing:    LoanPricing{InterestMethod: InterestReducingBalance, MonthlyRate: 400},
+			Principal:      30000000,
+			DurationInDays: 90,
+			Frequency:      MonthlyInstallments,
+		}
+
+		quote, err := quoteLoan(terms, loanToday)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 300,000 at 4% a month over three months is 108,104.56 an installment
+		if quote.InstallmentAmount != 10810456 {
+			t.Errorf("got an installment of %s", quote.InstallmentAmount)
+		}
+		if quote.TotalInterest >= 3600000 {
+			t.Errorf("got %s of interest, want less than flat", quote.TotalInterest)
+		}
+		if quote.Installments[0].InterestDue <= quote.Installments[2].InterestDue {
+			t.Error("interest should go down as the balance does")
+		}
+	})
+
+	t.Run("repays the whole principal", func(t *testing.T) {
+		for _, method := range []string{InterestFlat, InterestReducingBalance} {
+			quote, err := quoteLoan(LoanTerms{
+				LoanPricing:    LoanPricing{InterestMethod: method, MonthlyRate: 350},
+				Principal:      10000001,
+				DurationInDays: 100,
+				Frequency:      WeeklyInstallments,
+			}, loanToday)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var principal Money
+			for _, installment := range quote.Installments {
+				principal += installment.PrincipalDue
+			}
+			if principal != 10000001 {
+				t.Errorf("%s: the schedule repays %s", method, principal)
+			}
+			if len(quote.Installments) != 15 {
+				t.Errorf("%s: got %d weekly installments, want 15", method, len(quote.Installments))
+			}
+		}
+	})
+
+	t.Run("puts the fee on the first installment", func(t *testing.T) {
+		quote, err := quoteLoan(LoanTerms{
+			LoanPricing:    defaultLoanPricing,
+			Principal:      5000000,
+			DurationInDays: 60,
+			Frequency:      MonthlyInstallments,
+		}, loanToday)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if quote.Installments[0].FeeDue != 50000 || quote.Installments[1].FeeDue != 0 {
+			t.Errorf("got %+v", quote.Installments)
+		}
+	})
+
+	t.Run("turns away unknown terms", func(t *testing.T) {
+		if _, err := quoteLoan(LoanTerms{LoanPricing: LoanPricing{InterestMethod: "COMPOUND"}, Principal: 100000, DurationInDays: 30, Frequency: MonthlyInstallments}, loanToday); !errors.Is(err, ErrUnknownInterestMethod) {
+			t.Errorf("got %v, want %v", err, ErrUnknownInterestMethod)
+		}
+		if _, err := quoteLoan(LoanTerms{LoanPricing: defaultLoanPricing, Principal: 100000, DurationInDays: 30, Frequency: "DAILY"}, loanToday); !errors.Is(err, ErrUnknownInstallmentFrequency) {
+			t.Errorf("got %v, want %v", err, ErrUnknownInstallmentFrequency)
+		}
+	})
+}
@@ -0,0 +1,375 @@
+package web_app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A loan is paid back in installments. Each installment has principal
+// and interest due on a date, the management fee on the first, and
+// penalties once it is late. Whatever a customer pays goes to
+// penalties first, then fees, then interest that is due, then
+// principal, oldest installment first. Interest that isn't due yet is
+// waived when the principal is paid off early.
+
+// Loan statuses
+const (
+	LoanActive    = "ACTIVE"
+	LoanRepaid    = "REPAID"
+	LoanDefaulted = "DEFAULTED"
+)
+
+// What a repayment pays for
+const (
+	// RepaymentInstallment pays an installment, and any before it that
+	// are still owed
+	RepaymentInstallment = "INSTALLMENT"
+	// RepaymentAmount pays whatever amount the customer chose
+	RepaymentAmount = "AMOUNT"
+	// RepaymentPayoff pays off the whole loan early
+	RepaymentPayoff = "PAYOFF"
+)
+
+var (
+	ErrLoanDoesNotExist          = errors.New("loan does not exist")
+	ErrLoanNotActive             = errors.New("the loan is not being repaid")
+	ErrInstallmentDoesNotExist   = errors.New("installment does not exist")
+	ErrInstallmentAlreadyPaid    = errors.New("the installment has already been paid")
+	ErrRepaymentInvalidAmount    = errors.New("repayments must be more than zero")
+	ErrRepaymentTooLarge         = errors.New("the repayment is more than what is owed on the loan")
+	ErrLoanRepaymentDoesNotExist = errors.New("loan repayment does not exist")
+	ErrRepaymentReversalTooLarge = errors.New("the amount is more than what is left of the repayment")
+)
+
+type LoanInstallment struct {
+	ID            uint
+	LoanID        uint
+	Number        int
+	DueDate       time.Time
+	PrincipalDue  Money
+	InterestDue   Money
+	FeeDue        Money
+	PenaltyDue    Money
+	PrincipalPaid Money
+	InterestPaid  Money
+	FeePaid       Money
+	PenaltyPaid   Money
+	PaidAt        time.Time
+	// OverdueAt is when the installment was first found to be late
+	OverdueAt time.Time
+	// PenaltyChargedThrough is the last day penalties were charged for
+	PenaltyChargedThrough time.Time
+	LastRemindedAt        time.Time
+}
+
+// Outstanding is what is left to pay on the installment
+func (i LoanInstallment) Outstanding() Money {
+	return i.PrincipalDue - i.PrincipalPaid + i.InterestDue - i.InterestPaid + i.FeeDue - i.FeePaid + i.PenaltyDue - i.PenaltyPaid
+}
+
+// Amount is what the installment was for, without penalties
+func (i LoanInstallment) Amount() Money {
+	return i.PrincipalDue + i.InterestDue + i.FeeDue
+}
+
+func (i LoanInstallment) Paid() bool {
+	return i.Outstanding() == 0
+}
+
+// IsDue is true once the installment's due date has come
+func (i LoanInstallment) IsDue(on time.Time) bool {
+	return !i.DueDate.After(on)
+}
+
+type Loan struct {
+	ID         uint
+	CustomerID uint
+	Principal  Money
+	LoanPricing
+	Frequency   string
+	Status      string
+	DaysPastDue int
+	// DelinquencyBucket is how late the loan is, from the last time the
+	// collections ran
+	DelinquencyBucket string
+	DisbursedAt       time.Time
+	RepaidAt          time.Time
+	CreatedAt         time.Time
+	Installments      []LoanInstallment
+}
+
+// Outstanding is what is left to pay on the whole schedule, including
+// interest that isn't due yet
+func (l Loan) Outstanding() Money {
+	var outstanding Money
+	for _, installment := range l.Installments {
+		outstanding += installment.Outstanding()
+	}
+	return outstanding
+}
+
+// OutstandingPrincipal is the part of the loan that hasn't been paid back
+func (l Loan) OutstandingPrincipal() Money {
+	var outstanding Money
+	for _, installment := range l.Installments {
+		outstanding += installment.PrincipalDue - installment.PrincipalPaid
+	}
+	return outstanding
+}
+
+// NextInstallment is the first installment that hasn't been paid
+func (l Loan) NextInstallment() (LoanInstallment, bool) {
+	for _, installment := range l.Installments {
+		if !installment.Paid() {
+			return installment, true
+		}
+	}
+	return LoanInstallment{}, false
+}
+
+// InstallmentAmount is what it costs to pay installment number, with
+// the installments before it that are still owed
+func (l Loan) InstallmentAmount(number int) (Money, error) {
+	var amount Money
+	for _, installment := range l.Installments {
+		if installment.Number > number {
+			break
+		}
+		amount += installment.Outstanding()
+
+		if installment.Number == number {
+			if installment.Paid() {
+				return 0, ErrInstallmentAlreadyPaid
+			}
+			return amount, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %d", ErrInstallmentDoesNotExist, number)
+}
+
+// PayoffAmount is what it costs to pay the loan off on a day: the
+// penalties and fees, the interest that is due by then and all of the
+// principal
+func (l Loan) PayoffAmount(on time.Time) Money {
+	var amount Money
+	for _, installment := range l.Installments {
+		amount += installment.PenaltyDue - installment.PenaltyPaid + installment.FeeDue - installment.FeePaid + installment.PrincipalDue - installment.PrincipalPaid
+		if installment.IsDue(on) {
+			amount += installment.InterestDue - installment.InterestPaid
+		}
+	}
+	return amount
+}
+
+// Repayable is whether the loan can still be repaid. Defaulted loans
+// can, so that what is owed can be recovered.
+func (l Loan) Repayable() bool {
+	return l.Status == LoanActive || l.Status == LoanDefaulted
+}
+
+type LoanStore interface {
+	// CreateLoan saves a loan with its schedule
+	CreateLoan(loan Loan) (uint, error)
+	// GetActiveLoan is the loan that a customer is repaying, with its
+	// schedule, whether it is active or defaulted
+	GetActiveLoan(customerID uint) (Loan, error)
+	GetLoanRepayments(loanID uint) ([]LoanRepayment, error)
+	// CreateLoanRepayment makes the pending LOAN_REPAYMENT payment
+	// for a repayment
+	CreateLoanRepayment(customerID uint, repayment LoanRepayment, provider string) error
+}
+
+// LoanRepayment is a payment towards a loan, and what it went to once
+// it was paid
+type LoanRepayment struct {
+	ID               uint
+	PaymentReference uuid.UUID
+	LoanID           uint
+	Kind             string
+	// InstallmentNumber is set for RepaymentInstallment repayments
+	InstallmentNumber int
+	Amount            Money
+	PenaltyPaid       Money
+	FeePaid           Money
+	InterestPaid      Money
+	PrincipalPaid     Money
+	WaivedInterest    Money
+	AllocatedAt       time.Time
+}
+
+// LoanAllocation is how a repayment was shared out over a loan's
+// installments
+type LoanAllocation struct {
+	PenaltyPaid   Money
+	FeePaid       Money
+	InterestPaid  Money
+	PrincipalPaid Money
+	// WaivedInterest is the interest that wasn't due yet when the
+	// principal was paid off
+	WaivedInterest Money
+	// Installments is the schedule after the repayment
+	Installments []LoanInstallment
+	Repaid       bool
+}
+
+// allocateRepayment shares amount out over a loan's installments,
+// penalties first, then fees, then interest, then principal. Interest is only
+// paid once it is due on, or when its installment is one of the first
+// through that are being paid for. Amounts that would be left over
+// are turned away.
+func allocateRepayment(loan Loan, amount Money, on time.Time, through int) (LoanAllocation, error) {
+	var allocation LoanAllocation
+
+	if amount <= 0 {
+		return allocation, ErrRepaymentInvalidAmount
+	}
+
+	installments := make([]LoanInstallment, len(loan.Installments))
+	copy(installments, loan.Installments)
+	left := amount
+
+	pay := func(due, paid *Money) Money {
+		payment := min(*due-*paid, left)
+		*paid += payment
+		left -= payment
+		return payment
+	}
+
+	for i := range installments {
+		allocation.PenaltyPaid += pay(&installments[i].PenaltyDue, &installments[i].PenaltyPaid)
+	}
+
+	for i := range installments {
+		allocation.FeePaid += pay(&installments[i].FeeDue, &installments[i].FeePaid)
+	}
+
+	for i := range installments {
+		if installments[i].IsDue(on) || installments[i].Number <= through {
+			allocation.InterestPaid += pay(&installments[i].InterestDue, &installments[i].InterestPaid)
+		}
+	}
+
+	for i := range installments {
+		allocation.PrincipalPaid += pay(&installments[i].PrincipalDue, &installments[i].PrincipalPaid)
+	}
+
+	if left > 0 {
+		return LoanAllocation{}, fmt.Errorf("%w: %s more than the %s that can be paid", ErrRepaymentTooLarge, left, amount-left)
+	}
+
+	allocation.Repaid = true
+	for _, installment := range installments {
+		if installment.PrincipalPaid != installment.PrincipalDue {
+			allocation.Repaid = false
+		}
+	}
+
+	for i := range installments {
+		if allocation.Repaid {
+			allocation.WaivedInterest += installments[i].InterestDue - installments[i].InterestPaid
+			installments[i].InterestDue = installments[i].InterestPaid
+		}
+
+		if installments[i].Paid() && installments[i].PaidAt.IsZero() {
+			installments[i].PaidAt = on
+		}
+	}
+
+	allocation.Installments = installments
+	return allocation, nil
+}
+
+// reverseRepayment takes amount of a repayment back off a loan's
+// installments, in the opposite order to allocateRepayment: principal
+// first, then interest, then fees, then penalties, from the latest
+// installment back. Only what the repayment went to can be taken back.
+// Interest that was waived when the repayment paid the loan off is
+// owed again, with the last installment, once the loan isn't paid off.
+// The allocation that comes back is what was taken back, with the
+// schedule after it and whether the loan is still paid off.
+func reverseRepayment(loan Loan, repayment LoanRepayment, amount Money) (LoanAllocation, error) {
+	var reversal LoanAllocation
+
+	if amount <= 0 {
+		return reversal, ErrRepaymentInvalidAmount
+	}
+	if left := repayment.PenaltyPaid + repayment.FeePaid + repayment.InterestPaid + repayment.PrincipalPaid; amount > left {
+		return reversal, fmt.Errorf("%w: at most %s can be taken back", ErrRepaymentReversalTooLarge, left)
+	}
+
+	installments := make([]LoanInstallment, len(loan.Installments))
+	copy(installments, loan.Installments)
+	left := amount
+
+	take := func(allocated Money, paid func(*LoanInstallment) *Money) Money {
+		var taken Money
+		for i := len(installments) - 1; i >= 0; i-- {
+			payment := min(*paid(&installments[i]), allocated-taken, left)
+			*paid(&installments[i]) -= payment
+			taken += payment
+			left -= payment
+		}
+		return taken
+	}
+
+	reversal.PrincipalPaid = take(repayment.PrincipalPaid, func(i *LoanInstallment) *Money { return &i.PrincipalPaid })
+	reversal.InterestPaid = take(repayment.InterestPaid, func(i *LoanInstallment) *Money { return &i.InterestPaid })
+	reversal.FeePaid = take(repayment.FeePaid, func(i *LoanInstallment) *Money { return &i.FeePaid })
+	reversal.PenaltyPaid = take(repayment.PenaltyPaid, func(i *LoanInstallment) *Money { return &i.PenaltyPaid })
+
+	if left > 0 {
+		return LoanAllocation{}, fmt.Errorf("%w: %s more than the installments were paid", ErrRepaymentReversalTooLarge, left)
+	}
+
+	if reversal.PrincipalPaid > 0 && repayment.WaivedInterest > 0 && len(installments) > 0 {
+		installments[len(installments)-1].InterestDue += repayment.WaivedInterest
+		reversal.WaivedInterest = repayment.WaivedInterest
+	}
+
+	reversal.Repaid = true
+	for i := range installments {
+		if !installments[i].Paid() {
+			installments[i].PaidAt = time.Time{}
+			reversal.Repaid = false
+		}
+	}
+
+	reversal.Installments = installments
+	return reversal, nil
+}
+
+// repaymentThrough is the installment that a repayment pays up to, for
+// allocateRepayment
+func repaymentThrough(repayment LoanRepayment) int {
+	if repayment.Kind == RepaymentInstallment {
+		return repayment.InstallmentNumber
+	}
+	return 0
+}
+
+// repaymentAmount works out what a repayment of kind costs. amount is
+// only used for RepaymentAmount.
+func repaymentAmount(loan Loan, kind string, installment int, amount Money, on time.Time) (Money, error) {
+	if !loan.Repayable() {
+		return 0, ErrLoanNotActive
+	}
+
+	switch kind {
+	case RepaymentInstallment:
+		return loan.InstallmentAmount(installment)
+	case RepaymentPayoff:
+		return loan.PayoffAmount(on), nil
+	case RepaymentAmount:
+		if amount <= 0 {
+			return 0, ErrRepaymentInvalidAmount
+		}
+		if payoff := loan.PayoffAmount(on); amount > payoff {
+			return 0, fmt.Errorf("%w: at most %s can be paid", ErrRepaymentTooLarge, payoff)
+		}
+		return amount, nil
+	}
+	return 0, fmt.Errorf("unknown repayment kind %q", kind)
+}
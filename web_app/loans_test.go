@@ -0,0 +1,267 @@
+package web_app
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var loanToday = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+// newTestLoan is a loan of 300,000 naira over three months, whose first
+// installment fell due a week ago with a 5,000 naira penalty
+func newTestLoan() Loan {
+	loan := Loan{ID: 4, CustomerID: 7, Principal: 30000000, Status: LoanActive}
+	for number := 1; number <= 3; number++ {
+		loan.Installments = append(loan.Installments, LoanInstallment{
+			ID:           uint(number),
+			LoanID:       4,
+			Number:       number,
+			DueDate:      loanToday.AddDate(0, number-1, -7),
+			PrincipalDue: 10000000,
+			InterestDue:  1200000,
+		})
+	}
+	loan.Installments[0].PenaltyDue = 500000
+	return loan
+}
+
+func TestLoanAmounts(t *testing.T) {
+	loan := newTestLoan()
+
+	t.Run("installments include those before them", func(t *testing.T) {
+		amount, err := loan.InstallmentAmount(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Money(11700000 + 11200000); amount != want {
+			t.Errorf("got %s, want %s", amount, want)
+		}
+	})
+
+	t.Run("pays off the principal with the interest that is due", func(t *testing.T) {
+		if amount, want := loan.PayoffAmount(loanToday), Money(500000+30000000+1200000); amount != want {
+			t.Errorf("got %s, want %s", amount, want)
+		}
+	})
+
+	t.Run("turns away installments that don't exist", func(t *testing.T) {
+		if _, err := loan.InstallmentAmount(4); !errors.Is(err, ErrInstallmentDoesNotExist) {
+			t.Errorf("got %v, want %v", err, ErrInstallmentDoesNotExist)
+		}
+	})
+
+	t.Run("turns away amounts over the payoff", func(t *testing.T) {
+		if _, err := repaymentAmount(loan, RepaymentAmount, 0, 40000000, loanToday); !errors.Is(err, ErrRepaymentTooLarge) {
+			t.Errorf("got %v, want %v", err, ErrRepaymentTooLarge)
+		}
+	})
+
+	t.Run("only repays active loans", func(t *testing.T) {
+		repaid := newTestLoan()
+		repaid.Status = LoanRepaid
+		if _, err := repaymentAmount(repaid, RepaymentPayoff, 0, 0, loanToday); err != ErrLoanNotActive {
+			t.Errorf("got %v, want %v", err, ErrLoanNotActive)
+		}
+	})
+
+	t.Run("repays defaulted loans", func(t *testing.T) {
+		defaulted := newTestLoan()
+		defaulted.Status = LoanDefaulted
+		if amount, err := repaymentAmount(defaulted, RepaymentPayoff, 0, 0, loanToday); err != nil || amount != defaulted.PayoffAmount(loanToday) {
+			t.Errorf("got %s and %v", amount, err)
+		}
+	})
+}
+
+func TestAllocateRepayment(t *testing.T) {
+	t.Run("pays penalties, then interest, then principal", func(t *testing.T) {
+		loan := newTestLoan()
+
+		allocation, err := allocateRepayment(loan, 2000000, loanToday, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if allocation.PenaltyPaid != 500000 || allocation.InterestPaid != 1200000 || allocation.PrincipalPaid != 300000 {
+			t.Errorf("got %+v", allocation)
+		}
+		if allocation.Repaid {
+			t.Error("the loan shouldn't be repaid")
+		}
+		if loan.Installments[0].PenaltyPaid != 0 {
+			t.Error("the loan's own schedule was changed")
+		}
+	})
+
+	t.Run("pays the fee before interest", func(t *testing.T) {
+		loan := newTestLoan()
+		loan.Installments[0].FeeDue = 300000
+
+		allocation, err := allocateRepayment(loan, 1000000, loanToday, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if allocation.PenaltyPaid != 500000 || allocation.FeePaid != 300000 || allocation.InterestPaid != 200000 {
+			t.Errorf("got %+v", allocation)
+		}
+	})
+
+	t.Run("marks paid installments", func(t *testing.T) {
+		loan := newTestLoan()
+		amount, _ := loan.InstallmentAmount(2)
+
+		allocation, err := allocateRepayment(loan, amount, loanToday, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, installment := range allocation.Installments[:2] {
+			if !installment.Paid() || !installment.PaidAt.Equal(loanToday) {
+				t.Errorf("installment %d isn't paid: %+v", installment.Number, installment)
+			}
+		}
+		if allocation.Installments[2].Paid() {
+			t.Error("installment 3 shouldn't be paid")
+		}
+	})
+
+	t.Run("waives interest that isn't due when paid off early", func(t *testing.T) {
+		loan := newTestLoan()
+
+		allocation, err := allocateRepayment(loan, loan.PayoffAmount(loanToday), loanToday, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !allocation.Repaid {
+			t.Error("the loan should be repaid")
+		}
+		if allocation.WaivedInterest != 2400000 {
+			t.Errorf("got %s waived, want %s", allocation.WaivedInterest, Money(2400000))
+		}
+		if outstanding := (Loan{Installments: allocation.Installments}).Outstanding(); outstanding != 0 {
+			t.Errorf("%s is still outstanding", outstanding)
+		}
+	})
+
+	t.Run("turns away what is more than is owed", func(t *testing.T) {
+		loan := newTestLoan()
+
+		if _, err := allocateRepayment(loan, loan.Outstanding()+1, loanToday, 3); !errors.Is(err, ErrRepaymentTooLarge) {
+			t.Errorf("got %v, want %v", err, ErrRepaymentTooLarge)
+		}
+	})
+
+	t.Run("posts a balanced journal", func(t *testing.T) {
+		loan := newTestLoan()
+
+		allocation, err := allocateRepayment(loan, 2000000, loanToday, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		journal := loanRepaymentJournal("LOAN_REPAYMENT:test", loan.CustomerID, allocation)
+		if err := journal.Validate(); err != nil {
+			t.Error(err)
+		}
+		if len(journal.Entries) != 4 {
+			t.Errorf("got %d entries, want 4", len(journal.Entries))
+		}
+	})
+}
+
+func TestReverseRepayment(t *testing.T) {
+	// repay pays amount into loan, and is the repayment with what it went to
+	repay := func(t *testing.T, loan Loan, amount Money) (Loan, LoanRepayment) {
+		t.Helper()
+		allocation, err := allocateRepayment(loan, amount, loanToday, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loan.Installments = allocation.Installments
+		if allocation.Repaid {
+			loan.Status = LoanRepaid
+		}
+		return loan, LoanRepayment{Amount: amount, PenaltyPaid: allocation.PenaltyPaid, FeePaid: allocation.FeePaid, InterestPaid: allocation.InterestPaid, PrincipalPaid: allocation.PrincipalPaid, WaivedInterest: allocation.WaivedInterest}
+	}
+
+	t.Run("takes back principal, then interest, then penalties", func(t *testing.T) {
+		loan, repayment := repay(t, newTestLoan(), 2000000)
+
+		reversal, err := reverseRepayment(loan, repayment, 1000000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reversal.PrincipalPaid != 300000 || reversal.InterestPaid != 700000 || reversal.PenaltyPaid != 0 {
+			t.Errorf("got %+v", reversal)
+		}
+		first := reversal.Installments[0]
+		if first.PrincipalPaid != 0 || first.InterestPaid != 500000 || first.PenaltyPaid != 500000 {
+			t.Errorf("got %+v", first)
+		}
+		if loan.Installments[0].PrincipalPaid != 300000 {
+			t.Error("the loan's own schedule was changed")
+		}
+	})
+
+	t.Run("reopens the installments and owes the waived interest again", func(t *testing.T) {
+		loan := newTestLoan()
+		loan, repayment := repay(t, loan, loan.PayoffAmount(loanToday))
+
+		reversal, err := reverseRepayment(loan, repayment, repayment.Amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if reversal.Repaid {
+			t.Error("the loan shouldn't be repaid")
+		}
+		if reversal.PrincipalPaid != 30000000 || reversal.InterestPaid != 1200000 || reversal.PenaltyPaid != 500000 || reversal.WaivedInterest != 2400000 {
+			t.Errorf("got %+v", reversal)
+		}
+		for _, installment := range reversal.Installments {
+			if installment.Paid() || !installment.PaidAt.IsZero() {
+				t.Errorf("installment %d is still paid: %+v", installment.Number, installment)
+			}
+		}
+		if owed := (Loan{Installments: reversal.Installments}).Outstanding(); owed != newTestLoan().Outstanding() {
+			t.Errorf("%s is owed, want %s", owed, newTestLoan().Outstanding())
+		}
+	})
+
+	t.Run("only takes back what is left of the repayment", func(t *testing.T) {
+		loan, repayment := repay(t, newTestLoan(), 2000000)
+
+		if _, err := reverseRepayment(loan, repayment, 2000001); !errors.Is(err, ErrRepaymentReversalTooLarge) {
+			t.Errorf("got %v, want %v", err, ErrRepaymentReversalTooLarge)
+		}
+	})
+
+	t.Run("posts a balanced refund out of income and receivables", func(t *testing.T) {
+		loan, repayment := repay(t, newTestLoan(), 2000000)
+
+		reversal, err := reverseRepayment(loan, repayment, 1000000)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		receivable := loansReceivableLedgerAccount(loan.CustomerID)
+		journal := splitJournalEntry(refundHoldJournal("test", receivable, 1000000), receivable, loanRepaymentPortions(loan.CustomerID, reversal))
+		if err := journal.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		debits := map[string]Money{}
+		for _, entry := range journal.Entries {
+			if entry.Direction == LedgerDebit {
+				debits[entry.Account.Code] = entry.Amount
+			}
+		}
+		if debits[receivable.Code] != 300000 || debits[loanInterestIncomeLedgerAccount().Code] != 700000 || len(debits) != 2 {
+			t.Errorf("got debits %v", debits)
+		}
+	})
+}
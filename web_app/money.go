@@ -0,0 +1,211 @@
+package web_app
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in kobo. Every amount that we store, compute with
+// or show passes through it, so that naira never get truncated or
+// rounded through a float on the way.
+type Money int64
+
+const koboPerNaira = 100
+
+var (
+	ErrMoneyOverflow = errors.New("amount is too large")
+	ErrInvalidMoney  = errors.New("amount is not a valid naira amount")
+	ErrNegativeMoney = errors.New("amount cannot be negative")
+)
+
+// Naira builds an amount from a whole number of naira
+func Naira(naira int64) (Money, error) {
+	return Money(naira).Mul(koboPerNaira)
+}
+
+// ParseMoney reads an amount typed in by a user, e.g. "1,250.50",
+// "₦1250.5" or "NGN 1,250". Commas must group thousands and there can
+// be at most two decimal places.
+func ParseMoney(input string) (Money, error) {
+	value := strings.TrimSpace(input)
+	value = strings.TrimPrefix(value, "₦")
+	if len(value) >= 3 && strings.EqualFold(value[:3], "NGN") {
+		value = value[3:]
+	}
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(value, "-") {
+		return 0, ErrNegativeMoney
+	}
+
+	whole, fraction, hasFraction := strings.Cut(value, ".")
+	if whole == "" || (hasFraction && (fraction == "" || len(fraction) > 2)) {
+		return 0, ErrInvalidMoney
+	}
+
+	if strings.Contains(whole, ",") {
+		groups := strings.Split(whole, ",")
+		if len(groups[0]) == 0 || len(groups[0]) > 3 {
+			return 0, ErrInvalidMoney
+		}
+		for _, group := range groups[1:] {
+			if len(group) != 3 {
+				return 0, ErrInvalidMoney
+			}
+		}
+		whole = strings.Join(groups, "")
+	}
+
+	if !isDigits(whole) || !isDigits(fraction) {
+		return 0, ErrInvalidMoney
+	}
+
+	naira, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, ErrMoneyOverflow
+	}
+
+	amount, err := Naira(naira)
+	if err != nil {
+		return 0, err
+	}
+
+	// "1250.5" is fifty kobo, not five
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	kobo, _ := strconv.ParseInt(fraction, 10, 64)
+
+	return amount.Add(Money(kobo))
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if (other > 0 && m > math.MaxInt64-other) || (other < 0 && m < math.MinInt64-other) {
+		return 0, ErrMoneyOverflow
+	}
+	return m + other, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if (other < 0 && m > math.MaxInt64+other) || (other > 0 && m < math.MinInt64+other) {
+		return 0, ErrMoneyOverflow
+	}
+	return m - other, nil
+}
+
+func (m Money) Mul(factor int64) (Money, error) {
+	if m == 0 || factor == 0 {
+		return 0, nil
+	}
+
+	result := m * Money(factor)
+	if result/Money(factor) != m || (m == -1 && factor == math.MinInt64) || (factor == -1 && m == math.MinInt64) {
+		return 0, ErrMoneyOverflow
+	}
+	return result, nil
+}
+
+func (m Money) Kobo() int64 {
+	return int64(m)
+}
+
+func (m Money) IsZero() bool {
+	return m == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m < 0
+}
+
+// String formats the amount for people, e.g. ₦1,250.50
+func (m Money) String() string {
+	if m < 0 {
+		return "-₦" + groupedKobo(m.abs())
+	}
+	return "₦" + groupedKobo(m.abs())
+}
+
+// Grouped is the amount without the naira sign, e.g. 1,250.50. It's
+// for places that label the currency themselves.
+func (m Money) Grouped() string {
+	if m < 0 {
+		return "-" + groupedKobo(m.abs())
+	}
+	return groupedKobo(m.abs())
+}
+
+// Decimal is the amount for machines, e.g. 1250.50
+func (m Money) Decimal() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+	}
+	kobo := m.abs()
+	return fmt.Sprintf("%s%d.%02d", sign, kobo/koboPerNaira, kobo%koboPerNaira)
+}
+
+// abs works on uint64 so that the smallest int64 doesn't overflow
+func (m Money) abs() uint64 {
+	if m < 0 {
+		return uint64(-(m + 1)) + 1
+	}
+	return uint64(m)
+}
+
+func groupedKobo(kobo uint64) string {
+	digits := strconv.FormatUint(kobo/koboPerNaira, 10)
+
+	var builder strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteRune(digit)
+	}
+	fmt.Fprintf(&builder, ".%02d", kobo%koboPerNaira)
+	return builder.String()
+}
+
+// Scan reads a kobo column. NULL balances are treated as zero, which
+// is what every NULL balance in the schema means.
+func (m *Money) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(value)
+	case []byte:
+		return m.scanString(string(value))
+	case string:
+		return m.scanString(value)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(value string) error {
+	kobo, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", value, err)
+	}
+	*m = Money(kobo)
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
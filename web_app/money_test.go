@@ -0,0 +1,153 @@
+package web_app
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tt := []struct {
+		input string
+		want  Money
+	}{
+		{"1,250.50", 125050},
+		{"1250.5", 125050},
+		{"1250", 125000},
+		{"₦1,250.05", 125005},
+		{"NGN 2,000,000", 200000000},
+		{"  0.99 ", 99},
+	}
+
+	for _, value := range tt {
+		got, err := ParseMoney(value.input)
+
+		if err != nil {
+			t.Errorf("%q: did not expect an error, got %q", value.input, err)
+			continue
+		}
+
+		if got != value.want {
+			t.Errorf("%q: wanted %d but got %d", value.input, value.want, got)
+		}
+	}
+
+	t.Run("rejects malformed amounts", func(t *testing.T) {
+		for _, input := range []string{"", "abc", "1.234", "1,25,000", ",250", "12.", "1e3", "1 250"} {
+			if _, err := ParseMoney(input); err != ErrInvalidMoney {
+				t.Errorf("%q: expected %q, got %v", input, ErrInvalidMoney, err)
+			}
+		}
+	})
+
+	t.Run("rejects negative amounts", func(t *testing.T) {
+		if _, err := ParseMoney("-500"); err != ErrNegativeMoney {
+			t.Errorf("expected %q, got %v", ErrNegativeMoney, err)
+		}
+	})
+
+	t.Run("rejects amounts that overflow", func(t *testing.T) {
+		if _, err := ParseMoney("92233720368547758.08"); err != ErrMoneyOverflow {
+			t.Errorf("expected %q, got %v", ErrMoneyOverflow, err)
+		}
+	})
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	t.Run("adds and subtracts", func(t *testing.T) {
+		sum, err := Money(150).Add(250)
+		if err != nil || sum != 400 {
+			t.Errorf("expected 400, got %d (%v)", sum, err)
+		}
+
+		difference, err := Money(150).Sub(250)
+		if err != nil || difference != -100 {
+			t.Errorf("expected -100, got %d (%v)", difference, err)
+		}
+	})
+
+	t.Run("reports overflow instead of wrapping", func(t *testing.T) {
+		if _, err := Money(math.MaxInt64).Add(1); err != ErrMoneyOverflow {
+			t.Errorf("expected %q adding, got %v", ErrMoneyOverflow, err)
+		}
+
+		if _, err := Money(math.MinInt64).Sub(1); err != ErrMoneyOverflow {
+			t.Errorf("expected %q subtracting, got %v", ErrMoneyOverflow, err)
+		}
+
+		if _, err := Money(math.MaxInt64 / 2).Mul(3); err != ErrMoneyOverflow {
+			t.Errorf("expected %q multiplying, got %v", ErrMoneyOverflow, err)
+		}
+	})
+
+	t.Run("builds amounts from naira", func(t *testing.T) {
+		amount, err := Naira(5000)
+		if err != nil || amount != 500000 {
+			t.Errorf("expected 500000 kobo, got %d (%v)", amount, err)
+		}
+	})
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	tt := []struct {
+		amount  Money
+		str     string
+		grouped string
+		decimal string
+	}{
+		{0, "₦0.00", "0.00", "0.00"},
+		{5, "₦0.05", "0.05", "0.05"},
+		{125050, "₦1,250.50", "1,250.50", "1250.50"},
+		{99999, "₦999.99", "999.99", "999.99"},
+		{200000000, "₦2,000,000.00", "2,000,000.00", "2000000.00"},
+		{-125050, "-₦1,250.50", "-1,250.50", "-1250.50"},
+		{math.MinInt64, "-₦92,233,720,368,547,758.08", "-92,233,720,368,547,758.08", "-92233720368547758.08"},
+	}
+
+	for _, value := range tt {
+		if got := value.amount.String(); got != value.str {
+			t.Errorf("String: wanted %q but got %q", value.str, got)
+		}
+
+		if got := value.amount.Grouped(); got != value.grouped {
+			t.Errorf("Grouped: wanted %q but got %q", value.grouped, got)
+		}
+
+		if got := value.amount.Decimal(); got != value.decimal {
+			t.Errorf("Decimal: wanted %q but got %q", value.decimal, got)
+		}
+	}
+}
+
+func TestMoneySQL(t *testing.T) {
+	for _, src := range []any{int64(125050), []byte("125050"), "125050"} {
+		var amount Money
+
+		if err := amount.Scan(src); err != nil || amount != 125050 {
+			t.Errorf("scanning %T: expected 125050, got %d (%v)", src, amount, err)
+		}
+	}
+
+	t.Run("NULL is zero", func(t *testing.T) {
+		amount := Money(10)
+
+		if err := amount.Scan(nil); err != nil || amount != 0 {
+			t.Errorf("expected 0, got %d (%v)", amount, err)
+		}
+	})
+
+	t.Run("rejects floats", func(t *testing.T) {
+		var amount Money
+
+		if err := amount.Scan(12.5); err == nil {
+			t.Error("expected an error scanning a float")
+		}
+	})
+
+	t.Run("is stored as kobo", func(t *testing.T) {
+		value, err := Money(125050).Value()
+
+		if err != nil || value != int64(125050) {
+			t.Errorf("expected int64 125050, got %v (%v)", value, err)
+		}
+	})
+}
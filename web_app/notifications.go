@@ -0,0 +1,153 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Customers are sent notifications on every channel they can be
+// reached on. Emails are sent over SMTP once SMTP_HOST is set; there
+// isn't an SMS provider yet. Notifications on a channel without a
+// provider fail with ErrNotificationNotSent, and are skipped rather
+// than counted as failures by those sending to a customer, so that a
+// channel that was never set up doesn't fail every notice.
+
+// How a notification is sent
+const (
+	NotificationEmail = "EMAIL"
+	NotificationSMS   = "SMS"
+)
+
+var (
+	ErrNotificationNotSent = errors.New("there is no provider set up to send it")
+	ErrInvalidNotification = errors.New("notification addresses and subjects can't have line breaks in them")
+)
+
+type Notification struct {
+	Channel string
+	// To is an email address or a phone number, depending on the channel
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// CustomerContact is who a customer is and how to reach them
+type CustomerContact struct {
+	FirstName   string
+	Email       string
+	PhoneNumber string
+}
+
+// notifications is what can be sent to contact for a message, one per
+// channel they can be reached on
+func (c CustomerContact) notifications(subject, body string) []Notification {
+	var notifications []Notification
+	if c.Email != "" {
+		notifications = append(notifications, Notification{Channel: NotificationEmail, To: c.Email, Subject: subject, Body: body})
+	}
+	if c.PhoneNumber != "" {
+		notifications = append(notifications, Notification{Channel: NotificationSMS, To: c.PhoneNumber, Body: body})
+	}
+	return notifications
+}
+
+// notifyContact sends a message to contact on every channel they can be
+// reached on that has a provider. One channel failing doesn't stop the
+// others.
+func notifyContact(ctx context.Context, notifier Notifier, contact CustomerContact, subject, body string) error {
+	var errs []error
+	for _, notification := range contact.notifications(subject, body) {
+		if err := notifier.Notify(ctx, notification); err != nil && err != ErrNotificationNotSent {
+			errs = append(errs, fmt.Errorf("%s notice: %w", notification.Channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Notifiers sends each notification with the notifier for its channel
+type Notifiers map[string]Notifier
+
+func (n Notifiers) Notify(ctx context.Context, notification Notification) error {
+	notifier, ok := n[notification.Channel]
+	if !ok {
+		return ErrNotificationNotSent
+	}
+	return notifier.Notify(ctx, notification)
+}
+
+// NotifiersFromEnv sends emails through the SMTP server at SMTP_HOST
+// and SMTP_PORT (587 unless it is set), as EMAIL_FROM, logging in with
+// SMTP_USERNAME and SMTP_PASSWORD if they are set. There isn't an SMS
+// provider yet.
+func NotifiersFromEnv() (Notifiers, error) {
+	notifiers := Notifiers{}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return notifiers, nil
+	}
+
+	from := os.Getenv("EMAIL_FROM")
+	if from == "" {
+		return notifiers, errors.New("EMAIL_FROM must be set to send emails")
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	notifiers[NotificationEmail] = NewSMTPNotifier(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	return notifiers, nil
+}
+
+// SMTPNotifier sends emails as plain text through an SMTP server
+type SMTPNotifier struct {
+	address string
+	auth    smtp.Auth
+	from    string
+}
+
+func NewSMTPNotifier(host, port, username, password, from string) *SMTPNotifier {
+	notifier := &SMTPNotifier{address: net.JoinHostPort(host, port), from: from}
+	if username != "" {
+		notifier.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return notifier
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, notification Notification) error {
+	message, err := emailMessage(n.from, notification)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(n.address, n.auth, n.from, []string{notification.To}, message)
+}
+
+// emailMessage is the notification as an email, with its headers
+func emailMessage(from string, notification Notification) ([]byte, error) {
+	for _, header := range []string{from, notification.To, notification.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidNotification
+		}
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", notification.To)
+	fmt.Fprintf(&message, "Subject: %s\r\n", notification.Subject)
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	message.WriteString("\r\n")
+	return []byte(message.String()), nil
+}
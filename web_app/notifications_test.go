@@ -0,0 +1,55 @@
+package web_app
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNotifiers(t *testing.T) {
+	email := &FakeNotifier{}
+	notifiers := Notifiers{NotificationEmail: email}
+
+	if err := notifiers.Notify(context.Background(), Notification{Channel: NotificationEmail, To: "ada@example.com"}); err != nil || len(email.sent) != 1 {
+		t.Errorf("expected the email to be sent, got %v", err)
+	}
+
+	if err := notifiers.Notify(context.Background(), Notification{Channel: NotificationSMS, To: "+2348012345678"}); err != ErrNotificationNotSent {
+		t.Errorf("an SMS without a provider got %v, want %v", err, ErrNotificationNotSent)
+	}
+}
+
+func TestNotifiersFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	if notifiers, err := NotifiersFromEnv(); err != nil || len(notifiers) != 0 {
+		t.Errorf("expected no notifiers, got %v and %v", notifiers, err)
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("EMAIL_FROM", "")
+	if _, err := NotifiersFromEnv(); err == nil {
+		t.Error("expected an error without EMAIL_FROM")
+	}
+
+	t.Setenv("EMAIL_FROM", "Paz <hello@paz.test>")
+	if notifiers, err := NotifiersFromEnv(); err != nil || notifiers[NotificationEmail] == nil {
+		t.Errorf("expected an email notifier, got %v and %v", notifiers, err)
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	notification := Notification{Channel: NotificationEmail, To: "ada@example.com", Subject: "Your loan installment is due today", Body: "Hi Ada,\nit is due today."}
+
+	message, err := emailMessage("hello@paz.test", notification)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+	if !strings.HasPrefix(string(message), "From: hello@paz.test\r\nTo: ada@example.com\r\nSubject: Your loan installment is due today\r\n") || !strings.HasSuffix(string(message), "\r\n\r\nHi Ada,\r\nit is due today.\r\n") {
+		t.Errorf("got %q", message)
+	}
+
+	notification.To = "ada@example.com\r\nBcc: everyone@example.com"
+	if _, err := emailMessage("hello@paz.test", notification); err != ErrInvalidNotification {
+		t.Errorf("got %v, want %v", err, ErrInvalidNotification)
+	}
+}
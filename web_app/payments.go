@@ -0,0 +1,353 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The payment providers that we can take money through
+const (
+	ProviderPaystack    = "paystack"
+	ProviderFlutterwave = "flutterwave"
+	ProviderSandbox     = "sandbox"
+)
+
+// Charge statuses. Every provider's own statuses are mapped onto these.
+const (
+	ChargeSuccessful = "success"
+	ChargePending    = "pending"
+	ChargeFailed     = "failed"
+)
+
+// The kinds of webhook that we act on
+const (
+	WebhookKindCharge   = "charge"
+	WebhookKindTransfer = "transfer"
+	WebhookKindRefund   = "refund"
+	WebhookKindDispute  = "dispute"
+)
+
+var (
+	ErrUnknownPaymentProvider  = errors.New("unknown payment provider")
+	ErrChargeNotSuccessful     = errors.New("the provider says the charge was not successful")
+	ErrChargeCurrencyMismatch  = errors.New("the charge is not in naira")
+	ErrChargeAmountMismatch    = errors.New("the charge amount does not match the pending payment")
+	ErrChargeReferenceMismatch = errors.New("the charge reference does not match the pending payment")
+)
+
+// PaymentProvider is a payment gateway. Everything outside of a
+// provider's own file talks to it through this interface.
+type PaymentProvider interface {
+	Name() string
+	// Initialize starts a payment and returns where the customer
+	// should be sent to pay
+	Initialize(ctx context.Context, request PaymentRequest) (PaymentAuthorization, error)
+	// Verify asks the provider what happened to a charge. reference is
+	// the provider's reference for it.
+	Verify(ctx context.Context, reference string) (ProviderCharge, error)
+	// ListCharges lists the charges made between from and to, for
+	// reconciling them with our records
+	ListCharges(ctx context.Context, from, to time.Time) ([]ProviderCharge, error)
+	// WebhookSignature reads the provider's signature off a webhook
+	WebhookSignature(header http.Header) string
+	// ParseWebhook checks the signature of a webhook body and reads it
+	ParseWebhook(body []byte, signature string) (ProviderWebhook, error)
+	// Refund gives back some or all of a successful charge
+	Refund(ctx context.Context, reference string, amount Money) (ProviderRefund, error)
+	// CreateTransferRecipient registers a bank account that we can
+	// send money to. Providers check that the account exists, and tell
+	// us the name on it.
+	CreateTransferRecipient(ctx context.Context, account BankAccount) (TransferRecipient, error)
+	// Transfer sends money to a recipient
+	Transfer(ctx context.Context, request TransferRequest) (ProviderTransfer, error)
+	// VerifyTransfer asks the provider what happened to a transfer. id
+	// is the provider's id for it.
+	VerifyTransfer(ctx context.Context, id string) (ProviderTransfer, error)
+}
+
+type PaymentRequest struct {
+	ReferenceNumber uuid.UUID
+	Amount          Money
+	Email           string
+	// CallbackURL is where the provider sends the customer after they pay
+	CallbackURL string
+	Metadata    map[string]string
+}
+
+type PaymentAuthorization struct {
+	AuthorizationURL string
+	// AccessCode is for providers with an inline checkout, which can
+	// be opened with it instead of redirecting
+	AccessCode string
+}
+
+type ProviderCharge struct {
+	// ID and ProviderReference are the provider's. Reference is our
+	// reference number, which some providers keep in another field.
+	ID                string
+	ProviderReference string
+	Reference         string
+	Amount            Money
+	Currency          string
+	Status            string
+	GatewayResponse   string
+	PaidAt            time.Time
+}
+
+// ReferenceNumber is the reference we generated for the payment
+func (c ProviderCharge) ReferenceNumber() (uuid.UUID, error) {
+	return uuid.Parse(c.Reference)
+}
+
+type ProviderRefund struct {
+	ID string
+	// Reference is the refunded payment's
+	Reference string
+	Amount    Money
+	// Status is one of the ProviderRefund statuses
+	Status string
+}
+
+type ProviderWebhook struct {
+	// EventID identifies the event at the provider, so that resent
+	// events can be recognised
+	EventID        string
+	EventType      string
+	Kind           string
+	SignatureValid bool
+	// Charge is set on charge webhooks
+	Charge ProviderCharge
+	// Transfer is set on transfer webhooks
+	Transfer ProviderTransfer
+	// Refund is set on refund webhooks
+	Refund ProviderRefund
+	// Dispute is set on dispute webhooks
+	Dispute ProviderDispute
+}
+
+// PaymentProviders holds every provider that we have keys for. New
+// payments go through the active one, but webhooks can come from any
+// of them, e.g. for payments made before we switched.
+type PaymentProviders struct {
+	active    string
+	providers map[string]PaymentProvider
+}
+
+func NewPaymentProviders(active PaymentProvider, others ...PaymentProvider) *PaymentProviders {
+	providers := &PaymentProviders{active: active.Name(), providers: map[string]PaymentProvider{}}
+	for _, provider := range append(others, active) {
+		providers.providers[provider.Name()] = provider
+	}
+	return providers
+}
+
+func (p *PaymentProviders) Active() PaymentProvider {
+	return p.providers[p.active]
+}
+
+// All lists every provider, ordered by name
+func (p *PaymentProviders) All() []PaymentProvider {
+	names := make([]string, 0, len(p.providers))
+	for name := range p.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	providers := make([]PaymentProvider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, p.providers[name])
+	}
+	return providers
+}
+
+func (p *PaymentProviders) Get(name string) (PaymentProvider, error) {
+	provider, ok := p.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownPaymentProvider, name)
+	}
+	return provider, nil
+}
+
+// PaymentProvidersFromEnv sets up every provider whose keys are in
+// the environment. PAYMENT_PROVIDER picks the one that new payments go
+// through, and is paystack unless it is set. The sandbox is only set
+// up when it is the active provider. baseURL is where the server can
+// be reached, for the sandbox's checkout page and webhooks.
+func PaymentProvidersFromEnv(baseURL string) (*PaymentProviders, error) {
+	active, ok := os.LookupEnv("PAYMENT_PROVIDER")
+	if !ok {
+		active = ProviderPaystack
+	}
+
+	var providers []PaymentProvider
+
+	if secretKey, ok := os.LookupEnv("PAYSTACK_SECRET_KEY"); ok {
+		providers = append(providers, NewPaystackClient(secretKey))
+	}
+
+	if secretKey, ok := os.LookupEnv("FLUTTERWAVE_SECRET_KEY"); ok {
+		// an empty hash would match webhooks sent without one
+		webhookHash := os.Getenv("FLUTTERWAVE_WEBHOOK_HASH")
+		if webhookHash == "" {
+			return nil, errors.New("did not find the flutterwave webhook hash")
+		}
+		providers = append(providers, NewFlutterwaveClient(secretKey, webhookHash))
+	}
+
+	if active == ProviderSandbox {
+		secretKey, ok := os.LookupEnv("SANDBOX_SECRET_KEY")
+		if !ok {
+			secretKey = sandboxDefaultSecretKey
+		}
+		providers = append(providers, NewSandboxProvider(baseURL, secretKey, &http.Client{Timeout: 15 * time.Second}))
+	}
+
+	for i, provider := range providers {
+		if provider.Name() == active {
+			return NewPaymentProviders(provider, append(providers[:i:i], providers[i+1:]...)...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: did not find the keys for %q", ErrUnknownPaymentProvider, active)
+}
+
+// PaymentEventStore is the part of the store that the event processor
+// needs
+type PaymentEventStore interface {
+	FulfillmentStore
+	RecordVerificationFailure(referenceNumber uuid.UUID, reason string) error
+}
+
+// PaymentEventProcessor acts on saved payment webhook events, whichever
+// provider they came from
+type PaymentEventProcessor struct {
+	store       PaymentEventStore
+	providers   *PaymentProviders
+	fulfillment *FulfillmentDispatcher
+	payouts     *PayoutService
+	refunds     *RefundService
+}
+
+func NewPaymentEventProcessor(store PaymentEventStore, providers *PaymentProviders, payouts *PayoutService, refunds *RefundService) *PaymentEventProcessor {
+	return &PaymentEventProcessor{store: store, providers: providers, fulfillment: NewFulfillmentDispatcher(store), payouts: payouts, refunds: refunds}
+}
+
+// Process acts on a webhook event whose signature has already been
+// checked. Errors are worth retrying; events that we can't do anything
+// with are logged and dropped.
+func (p *PaymentEventProcessor) Process(ctx context.Context, event WebhookEvent) error {
+	provider, err := p.providers.Get(event.Provider)
+	if err != nil {
+		return err
+	}
+
+	// the signature was checked when the event was saved, and the
+	// provider's key may have changed since
+	webhook, err := provider.ParseWebhook(event.Payload, event.Signature)
+	if err != nil {
+		return err
+	}
+
+	switch webhook.Kind {
+	case WebhookKindCharge:
+		return p.processCharge(ctx, provider, webhook.Charge)
+	case WebhookKindTransfer:
+		return p.payouts.HandleTransfer(ctx, provider, webhook.Transfer)
+	case WebhookKindRefund:
+		return p.refunds.HandleRefund(ctx, provider, webhook.Refund)
+	case WebhookKindDispute:
+		return p.refunds.HandleDispute(ctx, provider, webhook.Dispute)
+	}
+
+	log.Printf("unknown %s event %q", provider.Name(), webhook.EventType)
+	return nil
+}
+
+func (p *PaymentEventProcessor) processCharge(ctx context.Context, provider PaymentProvider, charge ProviderCharge) error {
+	referenceNumber, err := charge.ReferenceNumber()
+	if err != nil {
+		log.Printf("ignoring %s charge with reference %q that isn't ours", provider.Name(), charge.Reference)
+		return nil
+	}
+
+	payment, err := p.store.GetPaystackVerificationInformation(referenceNumber.String())
+	if err == ErrReferenceNumberDoesNotExist {
+		log.Printf("ignoring %s charge for unknown reference %s", provider.Name(), referenceNumber)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payment.PaymentProvider != provider.Name() {
+		log.Printf("ignoring %s charge for payment %s, which was initialized with %s", provider.Name(), referenceNumber, payment.PaymentProvider)
+		return nil
+	}
+
+	if charge.Status == ChargeFailed {
+		return p.store.RecordVerificationFailure(referenceNumber, charge.GatewayResponse)
+	}
+
+	// a webhook for another amount is turned away before we ask the
+	// provider about it
+	if charge.Amount != payment.PaymentAmount {
+		reason := fmt.Errorf("%w: expected %s, paid %s", ErrChargeAmountMismatch, payment.PaymentAmount, charge.Amount)
+		log.Printf("payment %s failed verification: %s", referenceNumber, reason)
+		return p.store.RecordVerificationFailure(referenceNumber, reason.Error())
+	}
+
+	// the webhook says the charge succeeded, but we only believe the
+	// provider's API
+	verifyReference := charge.ProviderReference
+	if verifyReference == "" {
+		verifyReference = referenceNumber.String()
+	}
+
+	verified, err := provider.Verify(ctx, verifyReference)
+	if err != nil {
+		return err
+	}
+
+	if err := confirmCharge(verified, payment); err != nil {
+		log.Printf("payment %s failed verification: %s", referenceNumber, err)
+		return p.store.RecordVerificationFailure(referenceNumber, err.Error())
+	}
+
+	err = p.fulfillment.Dispatch(referenceNumber, verified.Amount)
+	if unfulfillable(err) {
+		// the customer paid for something that isn't there any more
+		return p.refunds.RefundUnfulfillable(ctx, referenceNumber, err)
+	}
+	return err
+}
+
+// confirmCharge checks what the provider says about a charge against
+// the payment we were expecting. Nothing gets credited unless it
+// passes.
+func confirmCharge(charge ProviderCharge, payment PaystackTransactionInformation) error {
+	if charge.Status != ChargeSuccessful {
+		return fmt.Errorf("%w: %s", ErrChargeNotSuccessful, charge.Status)
+	}
+
+	if charge.Currency != "NGN" {
+		return fmt.Errorf("%w: %s", ErrChargeCurrencyMismatch, charge.Currency)
+	}
+
+	if reference, err := charge.ReferenceNumber(); err != nil || reference != payment.ReferenceNumber {
+		return ErrChargeReferenceMismatch
+	}
+
+	if charge.Amount != payment.PaymentAmount {
+		return fmt.Errorf("%w: expected %s, paid %s", ErrChargeAmountMismatch, payment.PaymentAmount, charge.Amount)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newSandboxPayments(t *testing.T, store *FakeFulfillmentStore) *SandboxProvider {
+	t.Helper()
+	return newSandboxProcessor(t, store, NewFakePayoutStore(), NewFakeRefundStore(store))
+}
+
+// newSandboxProcessor points a sandbox at a server that processes its
+// webhooks straight away, the way the webhook handler and worker would
+func newSandboxProcessor(t *testing.T, store PaymentEventStore, payouts PayoutStore, refunds RefundStore) *SandboxProvider {
+	t.Helper()
+
+	var processor *PaymentEventProcessor
+	var sandbox *SandboxProvider
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/utility/webhooks/sandbox" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		signature := sandbox.WebhookSignature(r.Header)
+
+		if webhook, err := sandbox.ParseWebhook(body, signature); err != nil || !webhook.SignatureValid {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if err := processor.Process(r.Context(), WebhookEvent{Provider: ProviderSandbox, Payload: body, Signature: signature, SignatureValid: true}); err != nil {
+			t.Errorf("did not expect an error processing the webhook, got %q", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	sandbox = NewSandboxProvider(server.URL, "sk_sandbox", server.Client())
+	providers := NewPaymentProviders(sandbox)
+	processor = NewPaymentEventProcessor(store, providers, NewPayoutService(payouts, providers), NewRefundService(refunds, providers))
+	return sandbox
+}
+
+func TestPaymentEventProcessor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fulfills a payment once it has been paid", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeFulfillmentStore(payment)
+		sandbox := newSandboxPayments(t, store)
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+
+		if _, err := sandbox.Complete(ctx, payment.ReferenceNumber.String(), true); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if len(store.fulfilled) != 1 || store.fulfilled[0] != OriginatorSoloSavings {
+			t.Errorf("expected the payment to be fulfilled, got %v", store.fulfilled)
+		}
+	})
+
+	t.Run("fails a declined payment", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeFulfillmentStore(payment)
+		sandbox := newSandboxPayments(t, store)
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), false)
+
+		if got := store.payments[payment.ReferenceNumber.String()]; got.VerificationStatus != StatusFailed || len(store.fulfilled) != 0 {
+			t.Errorf("expected the payment to fail verification, got %+v", got)
+		}
+	})
+
+	t.Run("does not credit a charge for another amount", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeFulfillmentStore(payment)
+		sandbox := newSandboxPayments(t, store)
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: 100})
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+
+		got := store.payments[payment.ReferenceNumber.String()]
+		if got.VerificationStatus != StatusFailed || len(store.fulfilled) != 0 {
+			t.Errorf("expected the payment to fail verification, got %+v", got)
+		}
+	})
+
+	t.Run("only takes charges from the provider the payment was made with", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.PaymentProvider = ProviderPaystack
+		store := NewFakeFulfillmentStore(payment)
+		sandbox := newSandboxPayments(t, store)
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+
+		if got := store.payments[payment.ReferenceNumber.String()]; got.VerificationStatus != StatusPending || len(store.fulfilled) != 0 {
+			t.Errorf("expected the payment to be left alone, got %+v", got)
+		}
+	})
+
+	t.Run("ignores charges that aren't ours", func(t *testing.T) {
+		store := NewFakeFulfillmentStore()
+		sandbox := newSandboxPayments(t, store)
+		reference := uuid.New()
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 100})
+
+		if _, err := sandbox.Complete(ctx, reference.String(), true); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+	})
+
+	t.Run("rejects events from providers we don't have", func(t *testing.T) {
+		processor := NewPaymentEventProcessor(NewFakeFulfillmentStore(), NewPaymentProviders(NewSandboxProvider("", "sk_sandbox", nil)), nil, nil)
+
+		if err := processor.Process(ctx, WebhookEvent{Provider: "stripe"}); !errors.Is(err, ErrUnknownPaymentProvider) {
+			t.Errorf("expected %q, got %v", ErrUnknownPaymentProvider, err)
+		}
+	})
+}
+
+func TestPaymentProviders(t *testing.T) {
+	paystack := NewPaystackClient("sk_test")
+	flutterwave := NewFlutterwaveClient("FLWSECK_TEST", "hash")
+	providers := NewPaymentProviders(flutterwave, paystack)
+
+	if providers.Active() != flutterwave {
+		t.Errorf("expected flutterwave to be active, got %s", providers.Active().Name())
+	}
+
+	if provider, err := providers.Get(ProviderPaystack); err != nil || provider != paystack {
+		t.Errorf("expected to get paystack, got %v (%v)", provider, err)
+	}
+
+	if _, err := providers.Get(ProviderSandbox); !errors.Is(err, ErrUnknownPaymentProvider) {
+		t.Errorf("expected %q, got %v", ErrUnknownPaymentProvider, err)
+	}
+}
+
+func TestPaymentProvidersFromEnv(t *testing.T) {
+	t.Setenv("PAYMENT_PROVIDER", ProviderFlutterwave)
+	t.Setenv("FLUTTERWAVE_SECRET_KEY", "FLWSECK_TEST")
+
+	t.Setenv("FLUTTERWAVE_WEBHOOK_HASH", "")
+	if _, err := PaymentProvidersFromEnv(""); err == nil {
+		t.Errorf("expected an error for an empty webhook hash")
+	}
+
+	t.Setenv("FLUTTERWAVE_WEBHOOK_HASH", "hash")
+	if providers, err := PaymentProvidersFromEnv(""); err != nil || providers.Active().Name() != ProviderFlutterwave {
+		t.Errorf("expected flutterwave to be active, got %v", err)
+	}
+}
+
+func TestConfirmCharge(t *testing.T) {
+	payment := PaystackTransactionInformation{ReferenceNumber: uuid.New(), PaymentAmount: 500000}
+	valid := ProviderCharge{Reference: payment.ReferenceNumber.String(), Amount: 500000, Currency: "NGN", Status: ChargeSuccessful}
+
+	if err := confirmCharge(valid, payment); err != nil {
+		t.Errorf("expected a matching charge to be confirmed, got %q", err)
+	}
+
+	tt := []struct {
+		name   string
+		change func(*ProviderCharge)
+		want   error
+	}{
+		{"a failed charge", func(c *ProviderCharge) { c.Status = ChargeFailed }, ErrChargeNotSuccessful},
+		{"a pending charge", func(c *ProviderCharge) { c.Status = ChargePending }, ErrChargeNotSuccessful},
+		{"a charge in dollars", func(c *ProviderCharge) { c.Currency = "USD" }, ErrChargeCurrencyMismatch},
+		{"a charge for less", func(c *ProviderCharge) { c.Amount = 100 }, ErrChargeAmountMismatch},
+		{"someone else's charge", func(c *ProviderCharge) { c.Reference = uuid.NewString() }, ErrChargeReferenceMismatch},
+	}
+
+	for _, value := range tt {
+		charge := valid
+		value.change(&charge)
+
+		if err := confirmCharge(charge, payment); !errors.Is(err, value.want) {
+			t.Errorf("%s: expected %q, got %v", value.name, value.want, err)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payouts send money out of Paz to a customer's bank account, for
+// withdrawals and loan disbursements. The money is held on the ledger
+// when the payout is made, then either settled or given back once the
+// provider's transfer webhook tells us what happened to the transfer.
+
+// stalePayoutAge is how long a payout can stay pending before it is sent
+// to its provider again. Pending payouts were never accepted by the
+// provider, so no webhook will come for them.
+const stalePayoutAge = 10 * time.Minute
+
+// Transfer statuses. Every provider's own statuses are mapped onto these.
+const (
+	TransferPending    = "pending"
+	TransferSuccessful = "success"
+	TransferFailed     = "failed"
+	// TransferReversed transfers were paid, then came back to us
+	TransferReversed = "reversed"
+)
+
+// What a payout is for
+const (
+	PayoutPurposeWithdrawal       = "WITHDRAWAL"
+	PayoutPurposeLoanDisbursement = "LOAN_DISBURSEMENT"
+)
+
+// Payout statuses
+const (
+	// PayoutPending payouts have had their money held, but the
+	// provider hasn't accepted the transfer yet
+	PayoutPending    = "PENDING"
+	PayoutProcessing = "PROCESSING"
+	PayoutSuccessful = "SUCCESSFUL"
+	PayoutFailed     = "FAILED"
+	PayoutReversed   = "REVERSED"
+)
+
+var (
+	ErrBankAccountDoesNotExist   = errors.New("bank account does not exist")
+	ErrBankAccountAlreadyLinked  = errors.New("bank account has already been linked")
+	ErrUnknownBank               = errors.New("unknown bank")
+	ErrInvalidAccountNumber      = errors.New("account numbers are 10 digits")
+	ErrPayoutDoesNotExist        = errors.New("payout does not exist")
+	ErrPayoutAlreadyExists       = errors.New("a payout has already been made for this")
+	ErrWithdrawalDoesNotExist    = errors.New("withdrawal does not exist")
+	ErrWithdrawalNotPending      = errors.New("withdrawal is no longer pending")
+	ErrWithdrawalNotApproved     = errors.New("withdrawal hasn't been approved by an admin")
+	ErrTransferReferenceMismatch = errors.New("the transfer reference does not match the payout")
+	ErrTransferAmountMismatch    = errors.New("the transfer amount does not match the payout")
+)
+
+// nigerianBanks are the banks that customers can link accounts at,
+// by their NIBSS bank code
+var nigerianBanks = map[string]string{
+	"044":    "Access Bank",
+	"023":    "Citibank Nigeria",
+	"050":    "Ecobank Nigeria",
+	"070":    "Fidelity Bank",
+	"011":    "First Bank of Nigeria",
+	"214":    "First City Monument Bank",
+	"058":    "Guaranty Trust Bank",
+	"030":    "Heritage Bank",
+	"082":    "Keystone Bank",
+	"50211":  "Kuda Bank",
+	"50515":  "Moniepoint MFB",
+	"999992": "OPay",
+	"076":    "Polaris Bank",
+	"101":    "Providus Bank",
+	"221":    "Stanbic IBTC Bank",
+	"068":    "Standard Chartered Bank",
+	"232":    "Sterling Bank",
+	"032":    "Union Bank of Nigeria",
+	"033":    "United Bank For Africa",
+	"215":    "Unity Bank",
+	"035":    "Wema Bank",
+	"057":    "Zenith Bank",
+}
+
+type Bank struct {
+	Code string
+	Name string
+}
+
+// Banks lists the banks that customers can link accounts at, by name
+func Banks() []Bank {
+	banks := make([]Bank, 0, len(nigerianBanks))
+	for code, name := range nigerianBanks {
+		banks = append(banks, Bank{Code: code, Name: name})
+	}
+	sort.Slice(banks, func(i, j int) bool { return banks[i].Name < banks[j].Name })
+	return banks
+}
+
+var accountNumberRegex = regexp.MustCompile(`^[0-9]{10}$`)
+
+type BankAccount struct {
+	ID            uint
+	CustomerID    uint
+	BankCode      string
+	AccountNumber string
+	// AccountName is the name on the account, as the provider resolved it
+	AccountName string
+	// RecipientCode is what RecipientProvider knows the account as.
+	// A new one is made when we switch providers.
+	RecipientProvider string
+	RecipientCode     string
+	CreatedAt         time.Time
+}
+
+func (a BankAccount) BankName() string {
+	return nigerianBanks[a.BankCode]
+}
+
+// MaskedAccountNumber only shows the last four digits
+func (a BankAccount) MaskedAccountNumber() string {
+	if len(a.AccountNumber) < 4 {
+		return a.AccountNumber
+	}
+	return "******" + a.AccountNumber[len(a.AccountNumber)-4:]
+}
+
+type TransferRecipient struct {
+	Code        string
+	AccountName string
+}
+
+type TransferRequest struct {
+	// Reference is the payout's, and makes the transfer idempotent:
+	// providers won't send money twice for the same reference
+	Reference     uuid.UUID
+	RecipientCode string
+	Amount        Money
+	Reason        string
+}
+
+type ProviderTransfer struct {
+	// ID is the provider's. Reference is our payout's reference.
+	ID            string
+	Reference     string
+	Amount        Money
+	Status        string
+	FailureReason string
+}
+
+type Payout struct {
+	ID            uint
+	Reference     uuid.UUID
+	CustomerID    uint
+	BankAccountID uint
+	Purpose       string
+	// SourceID is the id of what the payout is for, e.g. the
+	// withdrawal application. There is only ever one payout for it.
+	SourceID      uint
+	Amount        Money
+	Provider      string
+	TransferID    string
+	Status        string
+	FailureReason string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type WithdrawalApplication struct {
+	ID            uint
+	CustomerID    uint
+	CustomerName  string
+	BankAccountID uint
+	Amount        Money
+	Status        string
+	FailureReason string
+	// DecisionNote is why an admin approved or rejected it
+	DecisionNote string
+	ReviewedBy   uint
+	ReviewedAt   time.Time
+	// PayoutStatus is empty until it has been paid out
+	PayoutStatus string
+	CreatedAt    time.Time
+}
+
+// payoutLedgerAccount is the customer account that a payout's money
+// comes out of
+func payoutLedgerAccount(payout Payout) (LedgerAccount, error) {
+	switch payout.Purpose {
+	case PayoutPurposeWithdrawal:
+		return soloSavingsLedgerAccount(payout.CustomerID), nil
+	case PayoutPurposeLoanDisbursement:
+		return loansReceivableLedgerAccount(payout.CustomerID), nil
+	}
+	return LedgerAccount{}, fmt.Errorf("unknown payout purpose %q", payout.Purpose)
+}
+
+type PayoutStore interface {
+	AddBankAccount(account BankAccount) (uint, error)
+	GetBankAccount(customerID, bankAccountID uint) (BankAccount, error)
+	GetBankAccounts(customerID uint) ([]BankAccount, error)
+	SaveTransferRecipient(bankAccountID uint, provider, recipientCode string) error
+	CreateWithdrawalApplication(customerID, bankAccountID uint, amount Money) (uint, error)
+	GetWithdrawalApplication(id uint) (WithdrawalApplication, error)
+	// CreatePayout saves the payout and holds its money on the ledger
+	// in one transaction
+	CreatePayout(payout Payout) (uint, error)
+	GetPayoutByReference(reference uuid.UUID) (Payout, error)
+	MarkPayoutProcessing(reference uuid.UUID, transferID string) error
+	// SettlePayout and FailPayout post the ledger entries for the end
+	// of a payout and update what it was for. Payouts that have
+	// already ended are left alone, except that a successful payout
+	// can still be reversed.
+	SettlePayout(reference uuid.UUID) error
+	FailPayout(reference uuid.UUID, status, reason string) error
+	// GetStalePendingPayouts lists payouts made before createdBefore
+	// that are still pending, oldest first
+	GetStalePendingPayouts(createdBefore time.Time, limit int) ([]Payout, error)
+}
+
+type PayoutService struct {
+	store     PayoutStore
+	providers *PaymentProviders
+	now       func() time.Time
+}
+
+func NewPayoutService(store PayoutStore, providers *PaymentProviders) *PayoutService {
+	return &PayoutService{store: store, providers: providers, now: time.Now}
+}
+
+// LinkBankAccount registers a customer's bank account with the active
+// provider, which also checks that it exists and tells us its name
+func (s *PayoutService) LinkBankAccount(ctx context.Context, customerID uint, bankCode, accountNumber string) (BankAccount, error) {
+	if _, ok := nigerianBanks[bankCode]; !ok {
+		return BankAccount{}, fmt.Errorf("%w: %q", ErrUnknownBank, bankCode)
+	}
+
+	if !accountNumberRegex.MatchString(accountNumber) {
+		return BankAccount{}, ErrInvalidAccountNumber
+	}
+
+	account := BankAccount{CustomerID: customerID, BankCode: bankCode, AccountNumber: accountNumber}
+	provider := s.providers.Active()
+
+	recipient, err := provider.CreateTransferRecipient(ctx, account)
+	if err != nil {
+		return account, err
+	}
+
+	account.AccountName = recipient.AccountName
+	account.RecipientProvider = provider.Name()
+	account.RecipientCode = recipient.Code
+
+	account.ID, err = s.store.AddBankAccount(account)
+	return account, err
+}
+
+// PayWithdrawal pays out an approved withdrawal application to the bank
+// account it was made for
+func (s *PayoutService) PayWithdrawal(ctx context.Context, withdrawalID uint) (Payout, error) {
+	withdrawal, err := s.store.GetWithdrawalApplication(withdrawalID)
+	if err != nil {
+		return Payout{}, err
+	}
+
+	if withdrawal.Status != StatusPending {
+		return Payout{}, ErrWithdrawalNotPending
+	}
+
+	// rejecting a withdrawal fails it, so a pending withdrawal that has
+	// been decided was approved
+	if !withdrawal.Decided() {
+		return Payout{}, ErrWithdrawalNotApproved
+	}
+
+	return s.Pay(ctx, Payout{
+		CustomerID:    withdrawal.CustomerID,
+		BankAccountID: withdrawal.BankAccountID,
+		Purpose:       PayoutPurposeWithdrawal,
+		SourceID:      withdrawal.ID,
+		Amount:        withdrawal.Amount,
+	})
+}
+
+// Pay holds the payout's money and asks the active provider to send
+// it. A payout that the provider couldn't be asked about stays pending
+// and can be sent again with Retry.
+func (s *PayoutService) Pay(ctx context.Context, payout Payout) (Payout, error) {
+	account, err := s.store.GetBankAccount(payout.CustomerID, payout.BankAccountID)
+	if err != nil {
+		return payout, err
+	}
+
+	provider := s.providers.Active()
+
+	if account.RecipientProvider != provider.Name() || account.RecipientCode == "" {
+		recipient, err := provider.CreateTransferRecipient(ctx, account)
+		if err != nil {
+			return payout, err
+		}
+
+		if err := s.store.SaveTransferRecipient(account.ID, provider.Name(), recipient.Code); err != nil {
+			return payout, err
+		}
+		account.RecipientCode = recipient.Code
+	}
+
+	payout.Reference = uuid.New()
+	payout.Provider = provider.Name()
+	payout.Status = PayoutPending
+
+	payout.ID, err = s.store.CreatePayout(payout)
+	if err != nil {
+		return payout, err
+	}
+
+	return s.send(ctx, provider, payout, account.RecipientCode)
+}
+
+// Retry sends a pending payout to its provider again. The reference is
+// the same, so the provider won't pay it twice.
+func (s *PayoutService) Retry(ctx context.Context, reference uuid.UUID) (Payout, error) {
+	payout, err := s.store.GetPayoutByReference(reference)
+	if err != nil {
+		return payout, err
+	}
+
+	if payout.Status != PayoutPending {
+		return payout, nil
+	}
+
+	provider, err := s.providers.Get(payout.Provider)
+	if err != nil {
+		return payout, err
+	}
+
+	account, err := s.store.GetBankAccount(payout.CustomerID, payout.BankAccountID)
+	if err != nil {
+		return payout, err
+	}
+
+	return s.send(ctx, provider, payout, account.RecipientCode)
+}
+
+// Run sends stale payouts again until ctx is cancelled
+func (s *PayoutService) Run(ctx context.Context) {
+	ticker := time.NewTicker(stalePaymentSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RetryStalePayouts(ctx); err != nil {
+				log.Printf("couldn't send stale payouts again: %s", err)
+			}
+		}
+	}
+}
+
+// RetryStalePayouts sends every payout that has been pending for longer
+// than stalePayoutAge to its provider again, and returns them as they
+// are now. A payout that can't be sent doesn't stop the rest.
+func (s *PayoutService) RetryStalePayouts(ctx context.Context) ([]Payout, error) {
+	stale, err := s.store.GetStalePendingPayouts(s.now().Add(-stalePayoutAge), stalePaymentSweepLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, payout := range stale {
+		retried, err := s.Retry(ctx, payout.Reference)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("payout %s: %w", payout.Reference, err))
+			continue
+		}
+		stale[i] = retried
+	}
+
+	return stale, errors.Join(errs...)
+}
+
+func (s *PayoutService) send(ctx context.Context, provider PaymentProvider, payout Payout, recipientCode string) (Payout, error) {
+	transfer, err := provider.Transfer(ctx, TransferRequest{
+		Reference:     payout.Reference,
+		RecipientCode: recipientCode,
+		Amount:        payout.Amount,
+		Reason:        fmt.Sprintf("Paz %s", payoutReason(payout.Purpose)),
+	})
+	if err != nil {
+		return payout, err
+	}
+
+	if err := s.store.MarkPayoutProcessing(payout.Reference, transfer.ID); err != nil {
+		return payout, err
+	}
+
+	payout.TransferID = transfer.ID
+	payout.Status = PayoutProcessing
+	return payout, s.settle(payout, transfer)
+}
+
+func payoutReason(purpose string) string {
+	if purpose == PayoutPurposeLoanDisbursement {
+		return "loan disbursement"
+	}
+	return "withdrawal"
+}
+
+// HandleTransfer acts on a transfer webhook. The webhook is only taken
+// as a hint: what happened is asked of the provider before any money
+// is settled or given back.
+func (s *PayoutService) HandleTransfer(ctx context.Context, provider PaymentProvider, transfer ProviderTransfer) error {
+	reference, err := uuid.Parse(transfer.Reference)
+	if err != nil {
+		log.Printf("ignoring %s transfer with reference %q that isn't ours", provider.Name(), transfer.Reference)
+		return nil
+	}
+
+	payout, err := s.store.GetPayoutByReference(reference)
+	if err == ErrPayoutDoesNotExist {
+		log.Printf("ignoring %s transfer for unknown payout %s", provider.Name(), reference)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payout.Provider != provider.Name() {
+		log.Printf("ignoring %s transfer for payout %s, which was sent with %s", provider.Name(), reference, payout.Provider)
+		return nil
+	}
+
+	verified, err := provider.VerifyTransfer(ctx, transfer.ID)
+	if err != nil {
+		return err
+	}
+
+	if verified.Reference != payout.Reference.String() {
+		return fmt.Errorf("%w: %s", ErrTransferReferenceMismatch, verified.Reference)
+	}
+
+	if verified.Amount != payout.Amount {
+		return fmt.Errorf("%w: expected %s, sent %s", ErrTransferAmountMismatch, payout.Amount, verified.Amount)
+	}
+
+	return s.settle(payout, verified)
+}
+
+// settle ends a payout if the provider says its transfer has ended
+func (s *PayoutService) settle(payout Payout, transfer ProviderTransfer) error {
+	switch transfer.Status {
+	case TransferSuccessful:
+		return s.store.SettlePayout(payout.Reference)
+	case TransferFailed:
+		reason := transfer.FailureReason
+		if reason == "" {
+			reason = fmt.Sprintf("%s could not send the transfer", payout.Provider)
+		}
+		return s.store.FailPayout(payout.Reference, PayoutFailed, reason)
+	case TransferReversed:
+		reason := transfer.FailureReason
+		if reason == "" {
+			reason = fmt.Sprintf("%s reversed the transfer", payout.Provider)
+		}
+		return s.store.FailPayout(payout.Reference, PayoutReversed, reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,453 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakePayoutStore keeps solo saver balances and loans owed, and moves
+// them the way the ledger entries for payouts would
+type FakePayoutStore struct {
+	accounts    map[uint]BankAccount
+	withdrawals map[uint]WithdrawalApplication
+	payouts     map[uuid.UUID]Payout
+	balances    map[uint]Money
+	loansOwed   map[uint]Money
+	journals    []string
+}
+
+func NewFakePayoutStore() *FakePayoutStore {
+	return &FakePayoutStore{
+		accounts:    map[uint]BankAccount{},
+		withdrawals: map[uint]WithdrawalApplication{},
+		payouts:     map[uuid.UUID]Payout{},
+		balances:    map[uint]Money{},
+		loansOwed:   map[uint]Money{},
+	}
+}
+
+func (f *FakePayoutStore) AddBankAccount(account BankAccount) (uint, error) {
+	for _, linked := range f.accounts {
+		if linked.CustomerID == account.CustomerID && linked.BankCode == account.BankCode && linked.AccountNumber == account.AccountNumber {
+			return 0, ErrBankAccountAlreadyLinked
+		}
+	}
+
+	account.ID = uint(len(f.accounts) + 1)
+	f.accounts[account.ID] = account
+	return account.ID, nil
+}
+
+func (f *FakePayoutStore) GetBankAccount(customerID, bankAccountID uint) (BankAccount, error) {
+	account, ok := f.accounts[bankAccountID]
+	if !ok || account.CustomerID != customerID {
+		return BankAccount{}, ErrBankAccountDoesNotExist
+	}
+	return account, nil
+}
+
+func (f *FakePayoutStore) GetBankAccounts(customerID uint) ([]BankAccount, error) {
+	var accounts []BankAccount
+	for _, account := range f.accounts {
+		if account.CustomerID == customerID {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+func (f *FakePayoutStore) SaveTransferRecipient(bankAccountID uint, provider, recipientCode string) error {
+	account := f.accounts[bankAccountID]
+	account.RecipientProvider = provider
+	account.RecipientCode = recipientCode
+	f.accounts[bankAccountID] = account
+	return nil
+}
+
+func (f *FakePayoutStore) CreateWithdrawalApplication(customerID, bankAccountID uint, amount Money) (uint, error) {
+	id := uint(len(f.withdrawals) + 1)
+	f.withdrawals[id] = WithdrawalApplication{ID: id, CustomerID: customerID, BankAccountID: bankAccountID, Amount: amount, Status: StatusPending}
+	return id, nil
+}
+
+func (f *FakePayoutStore) GetWithdrawalApplication(id uint) (WithdrawalApplication, error) {
+	withdrawal, ok := f.withdrawals[id]
+	if !ok {
+		return withdrawal, ErrWithdrawalDoesNotExist
+	}
+	return withdrawal, nil
+}
+
+// move changes the cached balance of the account a payout's money
+// comes out of. A positive amount gives money back to the customer.
+func (f *FakePayoutStore) move(payout Payout, amount Money) error {
+	if payout.Purpose == PayoutPurposeLoanDisbursement {
+		f.loansOwed[payout.CustomerID] -= amount
+		return nil
+	}
+
+	if f.balances[payout.CustomerID]+amount < 0 {
+		return ErrInsufficientLedgerFund
+	}
+	f.balances[payout.CustomerID] += amount
+	return nil
+}
+
+func (f *FakePayoutStore) CreatePayout(payout Payout) (uint, error) {
+	for _, existing := range f.payouts {
+		open := existing.Status != PayoutFailed && existing.Status != PayoutReversed
+		if existing.Purpose == payout.Purpose && existing.SourceID == payout.SourceID && open {
+			return 0, ErrPayoutAlreadyExists
+		}
+	}
+
+	if err := f.move(payout, -payout.Amount); err != nil {
+		return 0, err
+	}
+
+	payout.ID = uint(len(f.payouts) + 1)
+	payout.CreatedAt = time.Now()
+	f.payouts[payout.Reference] = payout
+	f.journals = append(f.journals, payoutHoldJournal(payout.Reference.String(), LedgerAccount{}, payout.Amount).IdempotencyKey)
+	return payout.ID, nil
+}
+
+func (f *FakePayoutStore) GetPayoutByReference(reference uuid.UUID) (Payout, error) {
+	payout, ok := f.payouts[reference]
+	if !ok {
+		return payout, ErrPayoutDoesNotExist
+	}
+	return payout, nil
+}
+
+func (f *FakePayoutStore) GetStalePendingPayouts(createdBefore time.Time, limit int) ([]Payout, error) {
+	var payouts []Payout
+	for _, payout := range f.payouts {
+		if payout.Status == PayoutPending && payout.CreatedAt.Before(createdBefore) && len(payouts) < limit {
+			payouts = append(payouts, payout)
+		}
+	}
+	return payouts, nil
+}
+
+func (f *FakePayoutStore) MarkPayoutProcessing(reference uuid.UUID, transferID string) error {
+	payout := f.payouts[reference]
+	if payout.Status == PayoutPending {
+		payout.Status = PayoutProcessing
+		payout.TransferID = transferID
+		f.payouts[reference] = payout
+	}
+	return nil
+}
+
+func (f *FakePayoutStore) SettlePayout(reference uuid.UUID) error {
+	payout, err := f.GetPayoutByReference(reference)
+	if err != nil {
+		return err
+	}
+
+	if payout.Status != PayoutPending && payout.Status != PayoutProcessing {
+		return nil
+	}
+
+	f.journals = append(f.journals, payoutSettledJournal(reference.String(), payout.Amount).IdempotencyKey)
+	f.end(payout, PayoutSuccessful, "")
+	return nil
+}
+
+func (f *FakePayoutStore) FailPayout(reference uuid.UUID, status, reason string) error {
+	payout, err := f.GetPayoutByReference(reference)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case payout.Status == PayoutPending || payout.Status == PayoutProcessing:
+		f.journals = append(f.journals, payoutReleasedJournal(reference.String(), LedgerAccount{}, payout.Amount).IdempotencyKey)
+	case payout.Status == PayoutSuccessful && status == PayoutReversed:
+		f.journals = append(f.journals, payoutReversedJournal(reference.String(), LedgerAccount{}, payout.Amount).IdempotencyKey)
+	default:
+		return nil
+	}
+
+	f.move(payout, payout.Amount)
+	f.end(payout, status, reason)
+	return nil
+}
+
+func (f *FakePayoutStore) end(payout Payout, status, reason string) {
+	payout.Status = status
+	payout.FailureReason = reason
+	f.payouts[payout.Reference] = payout
+
+	if payout.Purpose == PayoutPurposeWithdrawal {
+		withdrawal := f.withdrawals[payout.SourceID]
+		withdrawal.Status = StatusSuccessful
+		if status != PayoutSuccessful {
+			withdrawal.Status = StatusFailed
+		}
+		withdrawal.FailureReason = reason
+		f.withdrawals[payout.SourceID] = withdrawal
+	}
+}
+
+// newSandboxPayouts links a bank account for customer 1, who has
+// balance in their solo saver, and applies to withdraw amount to it
+func newSandboxPayouts(t *testing.T, balance, amount Money) (*SandboxProvider, *PayoutService, *FakePayoutStore, uint) {
+	t.Helper()
+
+	store := NewFakePayoutStore()
+	store.balances[1] = balance
+	fulfillment := NewFakeFulfillmentStore()
+	sandbox := newSandboxProcessor(t, fulfillment, store, NewFakeRefundStore(fulfillment))
+	payouts := NewPayoutService(store, NewPaymentProviders(sandbox))
+
+	account, err := payouts.LinkBankAccount(context.Background(), 1, "058", "0123456789")
+	if err != nil {
+		t.Fatalf("did not expect an error linking the account, got %q", err)
+	}
+
+	withdrawalID, _ := store.CreateWithdrawalApplication(1, account.ID, amount)
+	return sandbox, payouts, store, withdrawalID
+}
+
+// UnreachableSandbox is a sandbox that can't be asked to send transfers
+// while it is down
+type UnreachableSandbox struct {
+	*SandboxProvider
+	down bool
+}
+
+func (u *UnreachableSandbox) Transfer(ctx context.Context, request TransferRequest) (ProviderTransfer, error) {
+	if u.down {
+		return ProviderTransfer{}, errors.New("connection refused")
+	}
+	return u.SandboxProvider.Transfer(ctx, request)
+}
+
+// approve marks a withdrawal approved by admin 1, so that it can be paid
+func (f *FakePayoutStore) approve(withdrawalID uint) {
+	withdrawal := f.withdrawals[withdrawalID]
+	withdrawal.ReviewedBy = 1
+	withdrawal.ReviewedAt = time.Now()
+	f.withdrawals[withdrawalID] = withdrawal
+}
+
+func TestPayouts(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds the money until the transfer succeeds", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+
+		payout, err := payouts.PayWithdrawal(ctx, withdrawalID)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if payout.Status != PayoutProcessing || store.balances[1] != 600000 {
+			t.Errorf("expected the money to be held while the transfer is sent, got %+v and a balance of %s", payout, store.balances[1])
+		}
+
+		if err := sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if got := store.payouts[payout.Reference]; got.Status != PayoutSuccessful || store.balances[1] != 600000 {
+			t.Errorf("expected the payout to be settled, got %+v and a balance of %s", got, store.balances[1])
+		}
+
+		if withdrawal := store.withdrawals[withdrawalID]; withdrawal.Status != StatusSuccessful {
+			t.Errorf("expected the withdrawal to succeed, got %+v", withdrawal)
+		}
+	})
+
+	t.Run("gives the money back when the transfer fails", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+
+		payout, _ := payouts.PayWithdrawal(ctx, withdrawalID)
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferFailed)
+
+		if got := store.payouts[payout.Reference]; got.Status != PayoutFailed || got.FailureReason == "" || store.balances[1] != 1000000 {
+			t.Errorf("expected the payout to fail, got %+v and a balance of %s", got, store.balances[1])
+		}
+
+		if withdrawal := store.withdrawals[withdrawalID]; withdrawal.Status != StatusFailed {
+			t.Errorf("expected the withdrawal to fail, got %+v", withdrawal)
+		}
+	})
+
+	t.Run("gives the money back when a sent transfer is reversed", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+
+		payout, _ := payouts.PayWithdrawal(ctx, withdrawalID)
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferReversed)
+
+		if got := store.payouts[payout.Reference]; got.Status != PayoutReversed || store.balances[1] != 1000000 {
+			t.Errorf("expected the payout to be reversed, got %+v and a balance of %s", got, store.balances[1])
+		}
+
+		want := []string{"PAYOUT:", "PAYOUT_SETTLED:", "PAYOUT_REVERSED:"}
+		for i, key := range store.journals {
+			if key != want[i]+payout.Reference.String() {
+				t.Errorf("expected journal %s, got %s", want[i], key)
+			}
+		}
+	})
+
+	t.Run("doesn't pay a withdrawal that hasn't been approved", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+
+		if _, err := payouts.PayWithdrawal(ctx, withdrawalID); err != ErrWithdrawalNotApproved {
+			t.Errorf("expected %q, got %v", ErrWithdrawalNotApproved, err)
+		}
+
+		if len(sandbox.transfers) != 0 || store.balances[1] != 1000000 {
+			t.Errorf("did not expect the money to move, got %v and a balance of %s", sandbox.transfers, store.balances[1])
+		}
+	})
+
+	t.Run("sends a payout the provider couldn't be asked about again", func(t *testing.T) {
+		sandbox, _, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+		provider := &UnreachableSandbox{SandboxProvider: sandbox, down: true}
+		payouts := NewPayoutService(store, NewPaymentProviders(provider))
+
+		payout, err := payouts.PayWithdrawal(ctx, withdrawalID)
+		if err == nil || payout.Status != PayoutPending || store.balances[1] != 600000 {
+			t.Fatalf("expected the payout to stay pending with its money held, got %+v, %v and a balance of %s", payout, err, store.balances[1])
+		}
+
+		if retried, err := payouts.RetryStalePayouts(ctx); err != nil || len(retried) != 0 {
+			t.Errorf("did not expect a payout that was just made to be sent again, got %v and %v", retried, err)
+		}
+
+		provider.down = false
+		payouts.now = func() time.Time { return time.Now().Add(stalePayoutAge + time.Minute) }
+
+		retried, err := payouts.RetryStalePayouts(ctx)
+		if err != nil || len(retried) != 1 || retried[0].Status != PayoutProcessing {
+			t.Fatalf("expected the payout to be sent, got %+v and %v", retried, err)
+		}
+
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+		if withdrawal := store.withdrawals[withdrawalID]; withdrawal.Status != StatusSuccessful || store.balances[1] != 600000 {
+			t.Errorf("expected the withdrawal to be paid once, got %+v and a balance of %s", withdrawal, store.balances[1])
+		}
+	})
+
+	t.Run("doesn't pay a withdrawal twice", func(t *testing.T) {
+		_, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+
+		payouts.PayWithdrawal(ctx, withdrawalID)
+
+		if _, err := payouts.PayWithdrawal(ctx, withdrawalID); err != ErrPayoutAlreadyExists {
+			t.Errorf("expected %q, got %v", ErrPayoutAlreadyExists, err)
+		}
+
+		if store.balances[1] != 600000 {
+			t.Errorf("expected the money to be held once, got a balance of %s", store.balances[1])
+		}
+	})
+
+	t.Run("doesn't pay out more than the balance", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 100000, 400000)
+		store.approve(withdrawalID)
+
+		if _, err := payouts.PayWithdrawal(ctx, withdrawalID); err != ErrInsufficientLedgerFund {
+			t.Errorf("expected %q, got %v", ErrInsufficientLedgerFund, err)
+		}
+
+		if len(sandbox.transfers) != 0 {
+			t.Errorf("did not expect a transfer, got %v", sandbox.transfers)
+		}
+	})
+
+	t.Run("disburses loans from loans receivable", func(t *testing.T) {
+		sandbox, payouts, store, _ := newSandboxPayouts(t, 0, 0)
+
+		payout, err := payouts.Pay(ctx, Payout{CustomerID: 1, BankAccountID: 1, Purpose: PayoutPurposeLoanDisbursement, SourceID: 7, Amount: 5000000})
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+
+		if store.loansOwed[1] != 5000000 || store.payouts[payout.Reference].Status != PayoutSuccessful {
+			t.Errorf("expected the customer to owe the loan, got %s", store.loansOwed[1])
+		}
+	})
+
+	t.Run("only settles what the provider confirms", func(t *testing.T) {
+		sandbox, payouts, store, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store.approve(withdrawalID)
+		payout, _ := payouts.PayWithdrawal(ctx, withdrawalID)
+
+		// a forged webhook says the transfer went through, but the
+		// sandbox still has it as pending
+		forged := ProviderTransfer{ID: payout.TransferID, Reference: payout.Reference.String(), Amount: payout.Amount, Status: TransferSuccessful}
+		if err := payouts.HandleTransfer(ctx, sandbox, forged); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if got := store.payouts[payout.Reference]; got.Status != PayoutProcessing {
+			t.Errorf("expected the payout to still be processing, got %+v", got)
+		}
+	})
+
+	t.Run("ignores transfers that aren't ours", func(t *testing.T) {
+		sandbox, _, _, _ := newSandboxPayouts(t, 0, 0)
+		recipient, _ := sandbox.CreateTransferRecipient(ctx, BankAccount{BankCode: "058", AccountNumber: "0123456789"})
+		transfer, _ := sandbox.Transfer(ctx, TransferRequest{Reference: uuid.New(), RecipientCode: recipient.Code, Amount: 100})
+
+		if err := sandbox.CompleteTransfer(ctx, transfer.Reference, TransferSuccessful); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+	})
+}
+
+func TestLinkBankAccount(t *testing.T) {
+	ctx := context.Background()
+	store := NewFakePayoutStore()
+	sandbox := NewSandboxProvider("", "sk_sandbox", nil)
+	payouts := NewPayoutService(store, NewPaymentProviders(sandbox))
+
+	account, err := payouts.LinkBankAccount(ctx, 1, "058", "0123456789")
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+
+	if account.AccountName == "" || account.RecipientProvider != ProviderSandbox || account.RecipientCode == "" || account.BankName() != "Guaranty Trust Bank" {
+		t.Errorf("expected the provider to resolve the account, got %+v", account)
+	}
+
+	if account.MaskedAccountNumber() != "******6789" {
+		t.Errorf("expected only the last four digits, got %q", account.MaskedAccountNumber())
+	}
+
+	tt := []struct {
+		name          string
+		bankCode      string
+		accountNumber string
+		want          error
+	}{
+		{"a bank we don't know", "999", "0123456789", ErrUnknownBank},
+		{"a short account number", "058", "012345", ErrInvalidAccountNumber},
+		{"letters in the account number", "058", "01234567ab", ErrInvalidAccountNumber},
+		{"an account that is already linked", "058", "0123456789", ErrBankAccountAlreadyLinked},
+	}
+
+	for _, value := range tt {
+		if _, err := payouts.LinkBankAccount(ctx, 1, value.bankCode, value.accountNumber); !errors.Is(err, value.want) {
+			t.Errorf("%s: expected %q, got %v", value.name, value.want, err)
+		}
+	}
+}
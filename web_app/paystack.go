@@ -0,0 +1,524 @@
+package web_app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const paystackBaseURL = "https://api.paystack.co"
+
+// The webhook events that we understand. See
+// https://paystack.com/docs/payments/webhooks/#supported-events
+const (
+	PaystackChargeSuccess         = "charge.success"
+	PaystackPaymentRequestSuccess = "paymentrequest.success"
+	PaystackPaymentRequestFailure = "paymentrequest.failure"
+	PaystackTransferSuccess       = "transfer.success"
+	PaystackTransferFailed        = "transfer.failed"
+	PaystackTransferReversed      = "transfer.reversed"
+	PaystackRefundPending         = "refund.pending"
+	PaystackRefundProcessed       = "refund.processed"
+	PaystackRefundFailed          = "refund.failed"
+	PaystackDisputeCreate         = "charge.dispute.create"
+	PaystackDisputeRemind         = "charge.dispute.remind"
+	PaystackDisputeResolve        = "charge.dispute.resolve"
+)
+
+var (
+	ErrPaystackRequestFailed  = errors.New("paystack request failed")
+	ErrPaystackWrongEventType = errors.New("paystack event is not of this type")
+)
+
+// PaystackEvent is a webhook body. Data is decoded by the typed
+// accessors below once we know what kind of event it is.
+type PaystackEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type PaystackCharge struct {
+	ID        int64  `json:"id"`
+	Reference string `json:"reference"`
+	// OfflineReference is set on payment request charges
+	OfflineReference string    `json:"offline_reference"`
+	Amount           Money     `json:"amount"`
+	Currency         string    `json:"currency"`
+	Status           string    `json:"status"`
+	GatewayResponse  string    `json:"gateway_response"`
+	PaidAt           time.Time `json:"paid_at"`
+}
+
+// ReferenceNumber is the reference we generated for the payment
+func (c PaystackCharge) ReferenceNumber() (uuid.UUID, error) {
+	if c.OfflineReference != "" {
+		return uuid.Parse(c.OfflineReference)
+	}
+	return uuid.Parse(c.Reference)
+}
+
+type PaystackTransfer struct {
+	ID           int64  `json:"id"`
+	TransferCode string `json:"transfer_code"`
+	Reference    string `json:"reference"`
+	Amount       Money  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason"`
+}
+
+type PaystackRefund struct {
+	ID                   int64  `json:"id"`
+	TransactionReference string `json:"transaction_reference"`
+	RefundReference      string `json:"refund_reference"`
+	Amount               Money  `json:"amount"`
+	Currency             string `json:"currency"`
+	Status               string `json:"status"`
+}
+
+type PaystackDispute struct {
+	ID           int64  `json:"id"`
+	RefundAmount Money  `json:"refund_amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+	// Resolution is set once the dispute is resolved. "declined" means
+	// the bank sided with us.
+	Resolution  string `json:"resolution"`
+	Category    string `json:"category"`
+	Transaction struct {
+		Reference string `json:"reference"`
+		Amount    Money  `json:"amount"`
+	} `json:"transaction"`
+}
+
+func ParsePaystackEvent(body []byte) (PaystackEvent, error) {
+	var event PaystackEvent
+	err := json.Unmarshal(body, &event)
+	return event, err
+}
+
+func (e PaystackEvent) IsCharge() bool {
+	return e.Event == PaystackChargeSuccess || e.Event == PaystackPaymentRequestSuccess || e.Event == PaystackPaymentRequestFailure
+}
+
+func (e PaystackEvent) IsTransfer() bool {
+	return e.Event == PaystackTransferSuccess || e.Event == PaystackTransferFailed || e.Event == PaystackTransferReversed
+}
+
+func (e PaystackEvent) IsRefund() bool {
+	return e.Event == PaystackRefundPending || e.Event == PaystackRefundProcessed || e.Event == PaystackRefundFailed
+}
+
+func (e PaystackEvent) IsDispute() bool {
+	return e.Event == PaystackDisputeCreate || e.Event == PaystackDisputeRemind || e.Event == PaystackDisputeResolve
+}
+
+func (e PaystackEvent) Charge() (PaystackCharge, error) {
+	var charge PaystackCharge
+	if !e.IsCharge() {
+		return charge, ErrPaystackWrongEventType
+	}
+	err := json.Unmarshal(e.Data, &charge)
+	return charge, err
+}
+
+func (e PaystackEvent) Transfer() (PaystackTransfer, error) {
+	var transfer PaystackTransfer
+	if !e.IsTransfer() {
+		return transfer, ErrPaystackWrongEventType
+	}
+	err := json.Unmarshal(e.Data, &transfer)
+	return transfer, err
+}
+
+func (e PaystackEvent) Refund() (PaystackRefund, error) {
+	var refund PaystackRefund
+	if !e.IsRefund() {
+		return refund, ErrPaystackWrongEventType
+	}
+	err := json.Unmarshal(e.Data, &refund)
+	return refund, err
+}
+
+func (e PaystackEvent) Dispute() (PaystackDispute, error) {
+	var dispute PaystackDispute
+	if !e.IsDispute() {
+		return dispute, ErrPaystackWrongEventType
+	}
+	err := json.Unmarshal(e.Data, &dispute)
+	return dispute, err
+}
+
+// providerCharge maps a Paystack charge onto our own charge type
+func (c PaystackCharge) providerCharge() ProviderCharge {
+	reference := c.Reference
+	if c.OfflineReference != "" {
+		reference = c.OfflineReference
+	}
+
+	return ProviderCharge{
+		ID:                strconv.FormatInt(c.ID, 10),
+		ProviderReference: c.Reference,
+		Reference:         reference,
+		Amount:            c.Amount,
+		Currency:          c.Currency,
+		Status:            paystackChargeStatus(c.Status),
+		GatewayResponse:   c.GatewayResponse,
+		PaidAt:            c.PaidAt,
+	}
+}
+
+// providerTransfer maps a Paystack transfer onto our own transfer type
+func (t PaystackTransfer) providerTransfer() ProviderTransfer {
+	return ProviderTransfer{
+		ID:        strconv.FormatInt(t.ID, 10),
+		Reference: t.Reference,
+		Amount:    t.Amount,
+		Status:    paystackTransferStatus(t.Status),
+	}
+}
+
+func paystackTransferStatus(status string) string {
+	switch status {
+	case "success":
+		return TransferSuccessful
+	case "failed", "abandoned", "blocked", "rejected":
+		return TransferFailed
+	case "reversed":
+		return TransferReversed
+	}
+	return TransferPending
+}
+
+func (r PaystackRefund) providerRefund() ProviderRefund {
+	return ProviderRefund{
+		ID:        strconv.FormatInt(r.ID, 10),
+		Reference: r.TransactionReference,
+		Amount:    r.Amount,
+		Status:    paystackRefundStatus(r.Status),
+	}
+}
+
+func paystackRefundStatus(status string) string {
+	switch status {
+	case "processed":
+		return ProviderRefundProcessed
+	case "failed":
+		return ProviderRefundFailed
+	}
+	return ProviderRefundPending
+}
+
+// providerDispute maps a Paystack dispute onto ours. Disputes for less
+// than the whole charge have a refund amount.
+func (d PaystackDispute) providerDispute(resolved bool) ProviderDispute {
+	amount := d.RefundAmount
+	if amount == 0 {
+		amount = d.Transaction.Amount
+	}
+
+	status := DisputeOpen
+	switch {
+	case resolved && d.Resolution == "declined":
+		status = DisputeWon
+	case resolved:
+		status = DisputeLost
+	}
+
+	return ProviderDispute{
+		ID:        strconv.FormatInt(d.ID, 10),
+		Reference: d.Transaction.Reference,
+		Amount:    amount,
+		Status:    status,
+		Reason:    d.Category,
+	}
+}
+
+func paystackChargeStatus(status string) string {
+	switch status {
+	case "success":
+		return ChargeSuccessful
+	case "failed", "abandoned", "reversed":
+		return ChargeFailed
+	}
+	return ChargePending
+}
+
+// paystackEventID builds an id for a Paystack event. Paystack doesn't
+// send one, so we use the event type and the id of the object it is
+// about, falling back to a hash of the body.
+func paystackEventID(event PaystackEvent, body []byte) string {
+	var data struct {
+		ID json.Number `json:"id"`
+	}
+
+	if err := json.Unmarshal(event.Data, &data); err == nil && data.ID != "" {
+		return fmt.Sprintf("%s:%s", event.Event, data.ID)
+	}
+
+	hash := sha256.Sum256(body)
+	return fmt.Sprintf("%s:%s", event.Event, hex.EncodeToString(hash[:]))
+}
+
+func validateMAC(message, messageMAC, signingKey []byte) bool {
+	// the signingKey is, in this case, the secret key from Paystack.
+	// Paystack sends the signature hex encoded
+	mac := hmac.New(sha512.New, signingKey)
+	mac.Write(message)
+	expectedMAC := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal(messageMAC, []byte(expectedMAC))
+}
+
+// HTTPPaystackClient is the Paystack PaymentProvider
+type HTTPPaystackClient struct {
+	baseURL    string
+	secretKey  string
+	httpClient *http.Client
+}
+
+func NewPaystackClient(secretKey string) *HTTPPaystackClient {
+	return NewPaystackClientWithBaseURL(paystackBaseURL, secretKey, &http.Client{Timeout: 15 * time.Second})
+}
+
+func NewPaystackClientWithBaseURL(baseURL, secretKey string, httpClient *http.Client) *HTTPPaystackClient {
+	return &HTTPPaystackClient{baseURL: baseURL, secretKey: secretKey, httpClient: httpClient}
+}
+
+// paystackResponse is the envelope around every Paystack API response.
+// Meta is only sent with lists.
+type paystackResponse[T any] struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    T      `json:"data"`
+	Meta    struct {
+		Page      int `json:"page"`
+		PageCount int `json:"pageCount"`
+	} `json:"meta"`
+}
+
+func (c *HTTPPaystackClient) Name() string {
+	return ProviderPaystack
+}
+
+func (c *HTTPPaystackClient) Initialize(ctx context.Context, request PaymentRequest) (PaymentAuthorization, error) {
+	var response paystackResponse[struct {
+		AuthorizationURL string `json:"authorization_url"`
+		AccessCode       string `json:"access_code"`
+	}]
+
+	err := c.do(ctx, http.MethodPost, "/transaction/initialize", map[string]any{
+		"email":        request.Email,
+		"amount":       request.Amount,
+		"currency":     "NGN",
+		"reference":    request.ReferenceNumber.String(),
+		"callback_url": request.CallbackURL,
+		"metadata":     request.Metadata,
+	}, &response)
+
+	return PaymentAuthorization{AuthorizationURL: response.Data.AuthorizationURL, AccessCode: response.Data.AccessCode}, err
+}
+
+func (c *HTTPPaystackClient) Verify(ctx context.Context, reference string) (ProviderCharge, error) {
+	var response paystackResponse[PaystackCharge]
+	err := c.do(ctx, http.MethodGet, "/transaction/verify/"+url.PathEscape(reference), nil, &response)
+	return response.Data.providerCharge(), err
+}
+
+func (c *HTTPPaystackClient) ListCharges(ctx context.Context, from, to time.Time) ([]ProviderCharge, error) {
+	var charges []ProviderCharge
+
+	for page := 1; ; page++ {
+		query := url.Values{
+			"from":    {from.UTC().Format(time.RFC3339)},
+			"to":      {to.UTC().Format(time.RFC3339)},
+			"perPage": {"100"},
+			"page":    {strconv.Itoa(page)},
+		}
+
+		var response paystackResponse[[]PaystackCharge]
+		if err := c.do(ctx, http.MethodGet, "/transaction?"+query.Encode(), nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, charge := range response.Data {
+			charges = append(charges, charge.providerCharge())
+		}
+
+		if page >= response.Meta.PageCount {
+			return charges, nil
+		}
+	}
+}
+
+func (c *HTTPPaystackClient) WebhookSignature(header http.Header) string {
+	return header.Get("x-paystack-signature")
+}
+
+func (c *HTTPPaystackClient) ParseWebhook(body []byte, signature string) (ProviderWebhook, error) {
+	event, err := ParsePaystackEvent(body)
+	if err != nil {
+		return ProviderWebhook{}, err
+	}
+
+	webhook := ProviderWebhook{
+		EventID:        paystackEventID(event, body),
+		EventType:      event.Event,
+		SignatureValid: validateMAC(body, []byte(signature), []byte(c.secretKey)),
+	}
+
+	switch {
+	case event.IsCharge():
+		charge, err := event.Charge()
+		if err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindCharge
+		webhook.Charge = charge.providerCharge()
+		if event.Event == PaystackPaymentRequestFailure {
+			webhook.Charge.Status = ChargeFailed
+		}
+	case event.IsTransfer():
+		transfer, err := event.Transfer()
+		if err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindTransfer
+		webhook.Transfer = transfer.providerTransfer()
+	case event.IsRefund():
+		refund, err := event.Refund()
+		if err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindRefund
+		webhook.Refund = refund.providerRefund()
+	case event.IsDispute():
+		dispute, err := event.Dispute()
+		if err != nil {
+			return webhook, err
+		}
+		webhook.Kind = WebhookKindDispute
+		webhook.Dispute = dispute.providerDispute(event.Event == PaystackDisputeResolve)
+	}
+
+	return webhook, nil
+}
+
+func (c *HTTPPaystackClient) Refund(ctx context.Context, reference string, amount Money) (ProviderRefund, error) {
+	var response paystackResponse[struct {
+		ID          int64  `json:"id"`
+		Amount      Money  `json:"amount"`
+		Status      string `json:"status"`
+		Transaction struct {
+			Reference string `json:"reference"`
+		} `json:"transaction"`
+	}]
+
+	err := c.do(ctx, http.MethodPost, "/refund", map[string]any{
+		"transaction": reference,
+		"amount":      amount,
+	}, &response)
+
+	return ProviderRefund{
+		ID:        strconv.FormatInt(response.Data.ID, 10),
+		Reference: response.Data.Transaction.Reference,
+		Amount:    response.Data.Amount,
+		Status:    paystackRefundStatus(response.Data.Status),
+	}, err
+}
+
+func (c *HTTPPaystackClient) CreateTransferRecipient(ctx context.Context, account BankAccount) (TransferRecipient, error) {
+	var response paystackResponse[struct {
+		RecipientCode string `json:"recipient_code"`
+		Details       struct {
+			AccountName string `json:"account_name"`
+		} `json:"details"`
+	}]
+
+	err := c.do(ctx, http.MethodPost, "/transferrecipient", map[string]any{
+		"type":           "nuban",
+		"name":           account.AccountName,
+		"account_number": account.AccountNumber,
+		"bank_code":      account.BankCode,
+		"currency":       "NGN",
+	}, &response)
+
+	return TransferRecipient{Code: response.Data.RecipientCode, AccountName: response.Data.Details.AccountName}, err
+}
+
+// Transfer sends money from our Paystack balance. Paystack won't make
+// two transfers with the same reference.
+func (c *HTTPPaystackClient) Transfer(ctx context.Context, request TransferRequest) (ProviderTransfer, error) {
+	var response paystackResponse[PaystackTransfer]
+
+	err := c.do(ctx, http.MethodPost, "/transfer", map[string]any{
+		"source":    "balance",
+		"amount":    request.Amount,
+		"recipient": request.RecipientCode,
+		"reference": request.Reference.String(),
+		"reason":    request.Reason,
+	}, &response)
+
+	return response.Data.providerTransfer(), err
+}
+
+func (c *HTTPPaystackClient) VerifyTransfer(ctx context.Context, id string) (ProviderTransfer, error) {
+	var response paystackResponse[PaystackTransfer]
+	err := c.do(ctx, http.MethodGet, "/transfer/"+url.PathEscape(id), nil, &response)
+	return response.Data.providerTransfer(), err
+}
+
+func (c *HTTPPaystackClient) do(ctx context.Context, method, path string, body any, response interface{ failure() error }) error {
+	var requestBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.secretKey)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	result, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	if err := json.NewDecoder(result.Body).Decode(response); err != nil {
+		return fmt.Errorf("%w: %s returned an unreadable body (%s)", ErrPaystackRequestFailed, path, result.Status)
+	}
+
+	if result.StatusCode >= 300 {
+		return fmt.Errorf("%w: %s (%s)", ErrPaystackRequestFailed, response.failure(), result.Status)
+	}
+
+	return response.failure()
+}
+
+func (r *paystackResponse[T]) failure() error {
+	if r.Status {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrPaystackRequestFailed, r.Message)
+}
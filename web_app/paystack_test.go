@@ -0,0 +1,449 @@
+package web_app
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewFakePaystackServer answers transaction verification requests with
+// the given charges, keyed by reference. It also initializes payments,
+// queues refunds and makes transfers, which stay pending.
+func NewFakePaystackServer(t *testing.T, secretKey string, charges map[string]string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /transaction/verify/{reference}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+secretKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"status": false, "message": "Invalid key"}`)
+			return
+		}
+
+		charge, ok := charges[r.PathValue("reference")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": false, "message": "Transaction reference not found"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": true, "message": "Verification successful", "data": %s}`, charge)
+	})
+
+	mux.HandleFunc("POST /transaction/initialize", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reference string `json:"reference"`
+			Amount    Money  `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if body.Amount <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": false, "message": "Invalid Amount Sent"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": true, "message": "Authorization URL created", "data": {"authorization_url": "https://checkout.paystack.com/%s", "access_code": "%s", "reference": %q}}`, body.Reference, body.Reference, body.Reference)
+	})
+
+	// lists every charge, a page at a time
+	mux.HandleFunc("GET /transaction", func(w http.ResponseWriter, r *http.Request) {
+		var references []string
+		for reference := range charges {
+			references = append(references, reference)
+		}
+		sort.Strings(references)
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(references) {
+			fmt.Fprintf(w, `{"status": true, "message": "Transactions retrieved", "data": [], "meta": {"page": %d, "pageCount": %d}}`, page, len(references))
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": true, "message": "Transactions retrieved", "data": [%s], "meta": {"page": %d, "pageCount": %d}}`, charges[references[page-1]], page, len(references))
+	})
+
+	mux.HandleFunc("POST /refund", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Transaction string `json:"transaction"`
+			Amount      Money  `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		fmt.Fprintf(w, `{"status": true, "message": "Refund has been queued for processing", "data": {"id": 3018284, "amount": %d, "status": "pending", "transaction": {"reference": %q}}}`, body.Amount, body.Transaction)
+	})
+
+	mux.HandleFunc("POST /transferrecipient", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			AccountNumber string `json:"account_number"`
+			BankCode      string `json:"bank_code"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if body.AccountNumber == "0000000000" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"status": false, "message": "Cannot resolve account"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": true, "message": "Transfer recipient created successfully", "data": {"recipient_code": "RCP_%s", "details": {"account_number": %q, "account_name": "ADA LOVELACE", "bank_code": %q}}}`, body.AccountNumber, body.AccountNumber, body.BankCode)
+	})
+
+	var transfers sync.Map
+	mux.HandleFunc("POST /transfer", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reference string `json:"reference"`
+			Amount    Money  `json:"amount"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		transfer := fmt.Sprintf(`{"id": 57, "transfer_code": "TRF_1", "reference": %q, "amount": %d, "currency": "NGN", "status": "pending"}`, body.Reference, body.Amount)
+		transfers.Store("57", transfer)
+		fmt.Fprintf(w, `{"status": true, "message": "Transfer has been queued", "data": %s}`, transfer)
+	})
+
+	mux.HandleFunc("GET /transfer/{id}", func(w http.ResponseWriter, r *http.Request) {
+		transfer, ok := transfers.Load(r.PathValue("id"))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"status": false, "message": "Transfer not found"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status": true, "message": "Transfer retrieved", "data": %s}`, transfer)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPaystackClient(t *testing.T) {
+	reference := uuid.New()
+	abandoned := uuid.New()
+	server := NewFakePaystackServer(t, "sk_test", map[string]string{
+		reference.String(): fmt.Sprintf(`{"id": 4099, "reference": %q, "amount": 500000, "currency": "NGN", "status": "success", "paid_at": "2024-04-01T10:00:00.000Z"}`, reference),
+		abandoned.String(): fmt.Sprintf(`{"id": 4100, "reference": %q, "amount": 250000, "currency": "NGN", "status": "abandoned"}`, abandoned),
+	})
+
+	t.Run("verifies a transaction", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		charge, err := client.Verify(context.Background(), reference.String())
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if charge.Amount != 500000 || charge.Status != ChargeSuccessful || charge.Currency != "NGN" || charge.ID != "4099" {
+			t.Errorf("unexpected charge %+v", charge)
+		}
+	})
+
+	t.Run("initializes a payment", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		authorization, err := client.Initialize(context.Background(), PaymentRequest{ReferenceNumber: reference, Amount: 500000, Email: "ada@example.com"})
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if authorization.AuthorizationURL != "https://checkout.paystack.com/"+reference.String() || authorization.AccessCode != reference.String() {
+			t.Errorf("unexpected authorization %+v", authorization)
+		}
+
+		if _, err := client.Initialize(context.Background(), PaymentRequest{ReferenceNumber: reference}); !errors.Is(err, ErrPaystackRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrPaystackRequestFailed, err)
+		}
+	})
+
+	t.Run("lists charges across pages", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		charges, err := client.ListCharges(context.Background(), time.Now().AddDate(0, 0, -1), time.Now())
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if len(charges) != 2 {
+			t.Fatalf("expected a charge from each page, got %+v", charges)
+		}
+
+		for _, charge := range charges {
+			if charge.Reference == abandoned.String() && charge.Status != ChargeFailed {
+				t.Errorf("expected an abandoned charge to have failed, got %+v", charge)
+			}
+		}
+	})
+
+	t.Run("refunds a charge", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		refund, err := client.Refund(context.Background(), reference.String(), 20000)
+
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if refund.Amount != 20000 || refund.Reference != reference.String() || refund.Status != ProviderRefundPending {
+			t.Errorf("unexpected refund %+v", refund)
+		}
+	})
+
+	t.Run("sends a transfer to a bank account", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		recipient, err := client.CreateTransferRecipient(context.Background(), BankAccount{BankCode: "058", AccountNumber: "0123456789"})
+
+		if err != nil || recipient.Code != "RCP_0123456789" || recipient.AccountName != "ADA LOVELACE" {
+			t.Fatalf("unexpected recipient %+v (%v)", recipient, err)
+		}
+
+		payout := uuid.New()
+		transfer, err := client.Transfer(context.Background(), TransferRequest{Reference: payout, RecipientCode: recipient.Code, Amount: 400000})
+		if err != nil || transfer.ID != "57" || transfer.Status != TransferPending {
+			t.Fatalf("unexpected transfer %+v (%v)", transfer, err)
+		}
+
+		verified, err := client.VerifyTransfer(context.Background(), transfer.ID)
+		if err != nil || verified.Reference != payout.String() || verified.Amount != 400000 {
+			t.Errorf("unexpected transfer %+v (%v)", verified, err)
+		}
+	})
+
+	t.Run("reports accounts that can't be resolved", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		_, err := client.CreateTransferRecipient(context.Background(), BankAccount{BankCode: "058", AccountNumber: "0000000000"})
+
+		if !errors.Is(err, ErrPaystackRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrPaystackRequestFailed, err)
+		}
+	})
+
+	t.Run("reports Paystack's failures", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_test", server.Client())
+		_, err := client.Verify(context.Background(), "unknown")
+
+		if !errors.Is(err, ErrPaystackRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrPaystackRequestFailed, err)
+		}
+	})
+
+	t.Run("sends the secret key", func(t *testing.T) {
+		client := NewPaystackClientWithBaseURL(server.URL, "sk_wrong", server.Client())
+		_, err := client.Verify(context.Background(), reference.String())
+
+		if !errors.Is(err, ErrPaystackRequestFailed) {
+			t.Errorf("expected %q, got %v", ErrPaystackRequestFailed, err)
+		}
+	})
+}
+
+func TestPaystackEvents(t *testing.T) {
+	t.Run("reads a charge.success event", func(t *testing.T) {
+		event, err := ParsePaystackEvent([]byte(`{"event": "charge.success", "data": {"reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 150050, "currency": "NGN", "status": "success"}}`))
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		charge, err := event.Charge()
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		reference, err := charge.ReferenceNumber()
+		if err != nil || reference.String() != "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10" || charge.Amount != 150050 {
+			t.Errorf("unexpected charge %+v", charge)
+		}
+	})
+
+	t.Run("payment requests use the offline reference", func(t *testing.T) {
+		event, _ := ParsePaystackEvent([]byte(`{"event": "paymentrequest.success", "data": {"reference": "PRQ_1", "offline_reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 100}}`))
+		charge, _ := event.Charge()
+
+		if reference, err := charge.ReferenceNumber(); err != nil || reference.String() != "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10" {
+			t.Errorf("expected the offline reference, got %v (%v)", reference, err)
+		}
+	})
+
+	t.Run("reads transfer and refund events", func(t *testing.T) {
+		transferEvent, _ := ParsePaystackEvent([]byte(`{"event": "transfer.success", "data": {"transfer_code": "TRF_1", "amount": 20000, "status": "success"}}`))
+		transfer, err := transferEvent.Transfer()
+		if err != nil || transfer.TransferCode != "TRF_1" || transfer.Amount != 20000 {
+			t.Errorf("unexpected transfer %+v (%v)", transfer, err)
+		}
+
+		refundEvent, _ := ParsePaystackEvent([]byte(`{"event": "refund.processed", "data": {"transaction_reference": "abc", "amount": 300, "status": "processed"}}`))
+		refund, err := refundEvent.Refund()
+		if err != nil || refund.TransactionReference != "abc" || refund.Amount != 300 {
+			t.Errorf("unexpected refund %+v (%v)", refund, err)
+		}
+	})
+
+	t.Run("the typed accessors check the event type", func(t *testing.T) {
+		event, _ := ParsePaystackEvent([]byte(`{"event": "transfer.success", "data": {}}`))
+
+		if _, err := event.Charge(); err != ErrPaystackWrongEventType {
+			t.Errorf("expected %q, got %v", ErrPaystackWrongEventType, err)
+		}
+	})
+}
+
+func TestPaystackWebhooks(t *testing.T) {
+	client := NewPaystackClientWithBaseURL("", "sk_test", nil)
+	body := []byte(`{"event": "charge.success", "data": {"id": 4099, "reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 150050, "currency": "NGN", "status": "success"}}`)
+
+	t.Run("reads a signed charge", func(t *testing.T) {
+		webhook, err := client.ParseWebhook(body, paystackSignature(body, "sk_test"))
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if !webhook.SignatureValid || webhook.Kind != WebhookKindCharge || webhook.EventID != "charge.success:4099" {
+			t.Errorf("unexpected webhook %+v", webhook)
+		}
+
+		if webhook.Charge.Amount != 150050 || webhook.Charge.Status != ChargeSuccessful {
+			t.Errorf("unexpected charge %+v", webhook.Charge)
+		}
+	})
+
+	t.Run("reports a bad signature", func(t *testing.T) {
+		webhook, err := client.ParseWebhook(body, paystackSignature(body, "sk_other"))
+
+		if err != nil || webhook.SignatureValid {
+			t.Errorf("expected the signature to be invalid, got %+v (%v)", webhook, err)
+		}
+	})
+
+	t.Run("failed payment requests are failed charges", func(t *testing.T) {
+		body := []byte(`{"event": "paymentrequest.failure", "data": {"reference": "PRQ_1", "offline_reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "status": "pending"}}`)
+		webhook, _ := client.ParseWebhook(body, "")
+
+		if webhook.Charge.Status != ChargeFailed || webhook.Charge.ProviderReference != "PRQ_1" || webhook.Charge.Reference != "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10" {
+			t.Errorf("unexpected charge %+v", webhook.Charge)
+		}
+	})
+
+	t.Run("reads a transfer", func(t *testing.T) {
+		body := []byte(`{"event": "transfer.reversed", "data": {"id": 57, "transfer_code": "TRF_1", "reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 400000, "status": "reversed"}}`)
+		webhook, _ := client.ParseWebhook(body, "")
+
+		if webhook.Transfer.ID != "57" || webhook.Transfer.Status != TransferReversed || webhook.Transfer.Amount != 400000 {
+			t.Errorf("unexpected transfer %+v", webhook.Transfer)
+		}
+	})
+
+	t.Run("tells transfers and refunds apart", func(t *testing.T) {
+		transfer, _ := client.ParseWebhook([]byte(`{"event": "transfer.success", "data": {}}`), "")
+		refund, _ := client.ParseWebhook([]byte(`{"event": "refund.processed", "data": {}}`), "")
+
+		if transfer.Kind != WebhookKindTransfer || refund.Kind != WebhookKindRefund {
+			t.Errorf("unexpected kinds %q and %q", transfer.Kind, refund.Kind)
+		}
+	})
+
+	t.Run("reads a refund", func(t *testing.T) {
+		body := []byte(`{"event": "refund.processed", "data": {"id": 12, "transaction_reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 30000, "status": "processed"}}`)
+		webhook, _ := client.ParseWebhook(body, "")
+
+		want := ProviderRefund{ID: "12", Reference: "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", Amount: 30000, Status: ProviderRefundProcessed}
+		if webhook.Refund != want {
+			t.Errorf("expected %+v, got %+v", want, webhook.Refund)
+		}
+	})
+
+	t.Run("reads disputes", func(t *testing.T) {
+		cases := []struct {
+			body   string
+			status string
+			amount Money
+		}{
+			{`{"event": "charge.dispute.create", "data": {"id": 9, "refund_amount": 0, "status": "awaiting-merchant-feedback", "category": "chargeback", "transaction": {"reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 150050}}}`, DisputeOpen, 150050},
+			{`{"event": "charge.dispute.resolve", "data": {"id": 9, "refund_amount": 50000, "resolution": "declined", "transaction": {"reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 150050}}}`, DisputeWon, 50000},
+			{`{"event": "charge.dispute.resolve", "data": {"id": 9, "resolution": "merchant-accepted", "transaction": {"reference": "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10", "amount": 150050}}}`, DisputeLost, 150050},
+		}
+
+		for _, c := range cases {
+			webhook, err := client.ParseWebhook([]byte(c.body), "")
+			if err != nil {
+				t.Fatalf("did not expect an error, got %q", err)
+			}
+
+			dispute := webhook.Dispute
+			if webhook.Kind != WebhookKindDispute || dispute.ID != "9" || dispute.Status != c.status || dispute.Amount != c.amount || dispute.Reference != "ffb3f2a8-5c4e-4b8b-9d1a-0c3c4f6f9a10" {
+				t.Errorf("expected a %s dispute of %s, got %+v", c.status, c.amount, webhook)
+			}
+		}
+	})
+}
+
+func paystackSignature(body []byte, secretKey string) string {
+	mac := hmac.New(sha512.New, []byte(secretKey))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidMACFunction(t *testing.T) {
+	body := []byte(`{"event": "charge.success"}`)
+	signature := []byte(paystackSignature(body, "sk_test"))
+
+	t.Run("it passes when the macs match", func(t *testing.T) {
+		if !validateMAC(body, signature, []byte("sk_test")) {
+			t.Error("expected Paystack's hex signature to be valid")
+		}
+	})
+
+	t.Run("it fails when the macs do not match", func(t *testing.T) {
+		if validateMAC(body, signature, []byte("sk_other")) {
+			t.Error("expected a signature made with another key to be invalid")
+		}
+
+		if validateMAC([]byte(`{"event": "charge.success", "amount": 1}`), signature, []byte("sk_test")) {
+			t.Error("expected a signature for another body to be invalid")
+		}
+	})
+}
+
+func TestPaystackEventID(t *testing.T) {
+	body := []byte(`{"event": "charge.success", "data": {"id": 302961, "reference": "abc"}}`)
+	event, _ := ParsePaystackEvent(body)
+
+	if id := paystackEventID(event, body); id != "charge.success:302961" {
+		t.Errorf("expected the id to come from the charge, got %q", id)
+	}
+
+	t.Run("the same body always gets the same id", func(t *testing.T) {
+		body := []byte(`{"event": "transfer.failed", "data": {"reference": "abc"}}`)
+		event, _ := ParsePaystackEvent(body)
+
+		if paystackEventID(event, body) != paystackEventID(event, body) {
+			t.Error("expected the fallback id to be stable")
+		}
+	})
+
+	t.Run("resent events are de-duplicated", func(t *testing.T) {
+		store := NewFakeWebhookEventStore()
+		event := WebhookEvent{Provider: "paystack", EventID: paystackEventID(event, body), Payload: body, SignatureValid: true}
+
+		first, duplicate, _ := store.SaveWebhookEvent(event)
+		if duplicate {
+			t.Fatal("did not expect the first event to be a duplicate")
+		}
+
+		second, duplicate, _ := store.SaveWebhookEvent(event)
+		if !duplicate || first != second {
+			t.Errorf("expected the resent event to be a duplicate of %d, got %d (%v)", first, second, duplicate)
+		}
+	})
+}
@@ -0,0 +1,427 @@
+package web_app
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Banks export statements as PDFs whose pages draw their text with
+// simple fonts, so the text can be read back out of the page content
+// streams without a PDF library. Scanned statements, and ones drawn
+// with composite fonts, have no text that can be read this way.
+
+var (
+	ErrNotPDF      = errors.New("the file is not a PDF")
+	ErrNoPDFText   = errors.New("the PDF has no text that can be read")
+	ErrPDFTooLarge = errors.New("the PDF inflates to more than can be read")
+)
+
+const (
+	// maxPDFStreamSize bounds how much a single stream can inflate to
+	maxPDFStreamSize = 16 << 20
+	// maxPDFDecodedSize bounds how much all of a PDF's streams can
+	// inflate to, so that many small streams can't add up to more
+	// than one large one would be let
+	maxPDFDecodedSize = 64 << 20
+)
+
+// extractPDFText is the text of every page in a PDF, a line for each
+// row of text. PDFs whose streams inflate to more than
+// maxPDFDecodedSize are turned away.
+func extractPDFText(contents []byte) (string, error) {
+	if !bytes.HasPrefix(contents, []byte("%PDF-")) {
+		return "", ErrNotPDF
+	}
+
+	var lines []string
+	budget := maxPDFDecodedSize
+	rest := contents
+	for {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		// "endstream" has "stream" in it too
+		if bytes.HasSuffix(rest[:start], []byte("end")) {
+			rest = rest[start+len("stream"):]
+			continue
+		}
+
+		dict := rest[:start]
+		if i := bytes.LastIndex(dict, []byte("obj")); i >= 0 {
+			dict = dict[i:]
+		}
+
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		rest = body[end+len("endstream"):]
+
+		content, ok := decodePDFStream(dict, body[:end], min(maxPDFStreamSize, budget+1))
+		if !ok {
+			continue
+		}
+		if len(content) > budget {
+			return "", ErrPDFTooLarge
+		}
+		budget -= len(content)
+		lines = append(lines, pdfContentLines(content)...)
+	}
+
+	if len(lines) == 0 {
+		return "", ErrNoPDFText
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// decodePDFStream is the data in a stream that could hold page content,
+// inflated to at most limit bytes, and false for fonts, images and
+// streams in filters we can't read
+func decodePDFStream(dict, data []byte, limit int) ([]byte, bool) {
+	for _, skip := range []string{"/Image", "/XRef", "/ObjStm", "/Length1", "/Type1C", "/CIDFontType0C", "/OpenType", "/Metadata"} {
+		if bytes.Contains(dict, []byte(skip)) {
+			return nil, false
+		}
+	}
+
+	if !bytes.Contains(dict, []byte("/Filter")) {
+		return data, true
+	}
+	if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Count(dict, []byte("Decode")) > 1 {
+		return nil, false
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+
+	// streams are often followed by an end of line that isn't part of
+	// the compressed data, so what inflated before an error is kept
+	decoded, err := io.ReadAll(io.LimitReader(reader, int64(limit)))
+	if err != nil && len(decoded) == 0 {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// pdfText is a run of text drawn at a point on the page
+type pdfText struct {
+	x, y float64
+	text string
+}
+
+// pdfOperand is a value in a content stream: a number, a string, or an
+// array of them
+type pdfOperand struct {
+	number   float64
+	isNumber bool
+	text     string
+	isText   bool
+	array    []pdfOperand
+}
+
+// pdfContentLines runs the text operators in a content stream, and
+// puts the text drawn at the same height on the same line, top to
+// bottom and left to right
+func pdfContentLines(content []byte) []string {
+	var (
+		runs     []pdfText
+		operands []pdfOperand
+		arrays   [][]pdfOperand
+		// the line matrix's scale and origin, which is where text is drawn
+		scaleX, scaleY = 1.0, 1.0
+		x, y           float64
+		leading        float64
+		// moved is true when the next text starts a new run
+		moved = true
+	)
+
+	show := func(text string) {
+		if text == "" {
+			return
+		}
+		if moved || len(runs) == 0 {
+			runs = append(runs, pdfText{x: x, y: y, text: text})
+			moved = false
+			return
+		}
+		runs[len(runs)-1].text += text
+	}
+	push := func(operand pdfOperand) {
+		if len(arrays) > 0 {
+			arrays[len(arrays)-1] = append(arrays[len(arrays)-1], operand)
+			return
+		}
+		operands = append(operands, operand)
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) || !operands[i].isNumber {
+			return 0
+		}
+		return operands[i].number
+	}
+	nextLine := func() {
+		y -= leading * scaleY
+		moved = true
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case isPDFWhitespace(c):
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			text, next := readPDFString(content, i)
+			push(pdfOperand{text: text, isText: true})
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] == '<', c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			text, next := readPDFHexString(content, i)
+			push(pdfOperand{text: text, isText: true})
+			i = next
+		case c == '[':
+			arrays = append(arrays, nil)
+			i++
+		case c == ']':
+			if len(arrays) > 0 {
+				array := arrays[len(arrays)-1]
+				arrays = arrays[:len(arrays)-1]
+				push(pdfOperand{array: array})
+			}
+			i++
+		case c == '{' || c == '}' || c == ')' || c == '>':
+			i++
+		default:
+			start := i
+			if c == '/' {
+				i++
+			}
+			for i < len(content) && !isPDFWhitespace(content[i]) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			if start == i {
+				i++
+				continue
+			}
+			token := string(content[start:i])
+
+			if token[0] == '/' {
+				push(pdfOperand{})
+				continue
+			}
+			if value, err := strconv.ParseFloat(token, 64); err == nil {
+				push(pdfOperand{number: value, isNumber: true})
+				continue
+			}
+
+			switch token {
+			case "BT":
+				scaleX, scaleY, x, y = 1, 1, 0, 0
+				moved = true
+			case "Td", "TD":
+				x += number(len(operands)-2) * scaleX
+				y += number(len(operands)-1) * scaleY
+				if token == "TD" {
+					leading = -number(len(operands) - 1)
+				}
+				moved = true
+			case "Tm":
+				scaleX, scaleY = number(len(operands)-6), number(len(operands)-3)
+				if scaleX == 0 {
+					scaleX = 1
+				}
+				if scaleY == 0 {
+					scaleY = 1
+				}
+				x, y = number(len(operands)-2), number(len(operands)-1)
+				moved = true
+			case "TL":
+				leading = number(len(operands) - 1)
+			case "T*":
+				nextLine()
+			case "Tj", "'", "\"":
+				if token != "Tj" {
+					nextLine()
+				}
+				if len(operands) > 0 && operands[len(operands)-1].isText {
+					show(operands[len(operands)-1].text)
+				}
+			case "TJ":
+				if len(operands) > 0 {
+					for _, part := range operands[len(operands)-1].array {
+						switch {
+						case part.isText:
+							show(part.text)
+						// a wide gap between glyphs is a space
+						case part.isNumber && part.number < -200:
+							show(" ")
+						}
+					}
+				}
+			case "ID":
+				// inline image data is skipped up to its end
+				if end := bytes.Index(content[i:], []byte("EI")); end >= 0 {
+					i += end + len("EI")
+				} else {
+					i = len(content)
+				}
+			}
+			operands = operands[:0]
+		}
+	}
+
+	return pdfLines(runs)
+}
+
+// pdfLines groups runs of text that sit at the same height
+func pdfLines(runs []pdfText) []string {
+	sort.SliceStable(runs, func(i, j int) bool {
+		if math.Abs(runs[i].y-runs[j].y) > 1 {
+			return runs[i].y > runs[j].y
+		}
+		return runs[i].x < runs[j].x
+	})
+
+	var lines []string
+	var line []string
+	lineY := math.NaN()
+	for _, run := range runs {
+		text := strings.TrimSpace(run.text)
+		if text == "" {
+			continue
+		}
+		if len(line) > 0 && math.Abs(run.y-lineY) > 1 {
+			lines = append(lines, strings.Join(line, " "))
+			line = nil
+		}
+		if len(line) == 0 {
+			lineY = run.y
+		}
+		line = append(line, text)
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.Join(line, " "))
+	}
+	return lines
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// readPDFString reads the literal string starting at content[start],
+// which is "(", and is where the string ends
+func readPDFString(content []byte, start int) (string, int) {
+	var text []byte
+	depth := 0
+	i := start
+	for i < len(content) {
+		c := content[i]
+		i++
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfTextString(text), i
+			}
+		case '\\':
+			if i >= len(content) {
+				continue
+			}
+			escaped := content[i]
+			i++
+			switch escaped {
+			case 'n':
+				text = append(text, '\n')
+			case 'r':
+				text = append(text, '\r')
+			case 't':
+				text = append(text, '\t')
+			case 'b', 'f':
+			case '\r':
+				// an escaped end of line continues the string on the next line
+				if i < len(content) && content[i] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					value := int(escaped - '0')
+					for n := 0; n < 2 && i < len(content) && content[i] >= '0' && content[i] <= '7'; n++ {
+						value = value*8 + int(content[i]-'0')
+						i++
+					}
+					text = append(text, byte(value))
+				} else {
+					text = append(text, escaped)
+				}
+			}
+			continue
+		}
+		text = append(text, c)
+	}
+	return pdfTextString(text), i
+}
+
+// readPDFHexString reads the hex string starting at content[start],
+// which is "<", and is where the string ends
+func readPDFHexString(content []byte, start int) (string, int) {
+	var digits []byte
+	i := start + 1
+	for i < len(content) && content[i] != '>' {
+		if !isPDFWhitespace(content[i]) {
+			digits = append(digits, content[i])
+		}
+		i++
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	text := make([]byte, 0, len(digits)/2)
+	for j := 0; j < len(digits); j += 2 {
+		value, err := strconv.ParseUint(string(digits[j:j+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		text = append(text, byte(value))
+	}
+	return pdfTextString(text), i + 1
+}
+
+// pdfTextString reads the bytes of a string drawn with a simple font,
+// which are close enough to Latin-1 for the dates, amounts and
+// narrations on a statement
+func pdfTextString(text []byte) string {
+	runes := make([]rune, len(text))
+	for i, b := range text {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
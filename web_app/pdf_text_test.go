@@ -0,0 +1,101 @@
+package web_app
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// newStatementPDF draws rows as a table, the way banks' statement
+// exports do
+func newStatementPDF(t *testing.T, compress bool, rows [][]string) []byte {
+	t.Helper()
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetCompression(compress)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.AddPage()
+	pdf.CellFormat(0, 8, "ACCOUNT STATEMENT (Ada Obi)", "", 1, "L", false, 0, "")
+
+	widths := []float64{25, 75, 30, 30, 30}
+	for _, row := range rows {
+		for i, cell := range row {
+			pdf.CellFormat(widths[i], 6, cell, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	rows := [][]string{
+		{"Date", "Narration", "Debit", "Credit", "Balance"},
+		{"01-Oct-2026", "SALARY (OCT) ACME LTD", "", "250,000.00", "260,000.00"},
+		{"03-Oct-2026", "POS PURCHASE \\ SHOPRITE", "12,500.50", "", "247,499.50"},
+	}
+
+	for _, compress := range []bool{true, false} {
+		text, err := extractPDFText(newStatementPDF(t, compress, rows))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(text, "\n")
+		want := []string{
+			"ACCOUNT STATEMENT (Ada Obi)",
+			"Date Narration Debit Credit Balance",
+			"01-Oct-2026 SALARY (OCT) ACME LTD 250,000.00 260,000.00",
+			"03-Oct-2026 POS PURCHASE \\ SHOPRITE 12,500.50 247,499.50",
+		}
+		if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+			t.Errorf("compressed %t: got\n%s\nwant\n%s", compress, text, strings.Join(want, "\n"))
+		}
+	}
+
+	t.Run("reads positioned and kerned text", func(t *testing.T) {
+		content := []byte("BT /F1 9 Tf 1 0 0 1 40 700 Tm [(Open)-50(ing)-400(Balance)] TJ 14 TL T* (<- next line) Tj ET\n" +
+			"BT 1 0 0 1 300 700 Tm <31302C3030302E3030> Tj ET")
+
+		lines := pdfContentLines(content)
+		if len(lines) != 2 || lines[0] != "Opening Balance 10,000.00" || lines[1] != "<- next line" {
+			t.Errorf("got %q", lines)
+		}
+	})
+
+	t.Run("turns away PDFs whose streams inflate to too much between them", func(t *testing.T) {
+		var stream bytes.Buffer
+		writer := zlib.NewWriter(&stream)
+		writer.Write(bytes.Repeat([]byte("\n"), maxPDFStreamSize))
+		writer.Close()
+
+		// no stream is over maxPDFStreamSize, and all of them are
+		// over maxPDFDecodedSize
+		pdf := bytes.NewBufferString("%PDF-1.4\n")
+		for i := 1; i <= maxPDFDecodedSize/maxPDFStreamSize+1; i++ {
+			fmt.Fprintf(pdf, "%d 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n", i, stream.Len(), stream.Bytes())
+		}
+
+		if _, err := extractPDFText(pdf.Bytes()); err != ErrPDFTooLarge {
+			t.Errorf("got %v, want %v", err, ErrPDFTooLarge)
+		}
+		if _, err := readBankStatement("statement.pdf", pdf.Bytes()); !errors.Is(err, ErrUnreadableBankStatement) {
+			t.Errorf("got %v, want %v", err, ErrUnreadableBankStatement)
+		}
+	})
+
+	t.Run("turns away files that aren't PDFs", func(t *testing.T) {
+		if _, err := extractPDFText([]byte("Date,Amount\n")); err != ErrNotPDF {
+			t.Errorf("got %v, want %v", err, ErrNotPDF)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package web_app
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -9,9 +10,8 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -73,16 +73,13 @@ func (d *DB) GetHomeScreenInformation(userID uint) (HomeScreenInformation, error
 
 	var firstName sql.NullString
 	var lastName sql.NullString
-	var savingsBalance sql.NullInt64
-	var loansBalance int64
-	var investmentBalance int64
 
 	if err := d.Conn.QueryRow(GetHomeScreenInformationStatement, userID).Scan(
 		&firstName,
 		&lastName,
-		&savingsBalance,
-		&loansBalance,
-		&investmentBalance,
+		&information.SavingsBalance,
+		&information.LoansBalance,
+		&information.InvestmentBalance,
 	); err != nil {
 		log.Println(err)
 		if err == sql.ErrNoRows {
@@ -92,14 +89,59 @@ func (d *DB) GetHomeScreenInformation(userID uint) (HomeScreenInformation, error
 
 	information.FirstName = firstName.String
 	information.LastName = lastName.String
-	information.SavingsBalance = int64(convertToNaira(savingsBalance.Int64))
-	information.LoansBalance = int64(convertToNaira(loansBalance))
-	information.InvestmentBalance = int64(convertToNaira(investmentBalance))
-	// converted back into naira
+
+	recent, err := d.GetTransactionHistory(userID, TransactionHistoryFilter{Page: 1, PageSize: recentActivityCount})
+	if err != nil {
+		return information, err
+	}
+
+	for _, transaction := range recent.Transactions {
+		information.Activities = append(information.Activities, transaction.Activity())
+	}
 
 	return information, nil
 }
 
+func (d *DB) GetTransactionHistory(userID uint, filter TransactionHistoryFilter) (TransactionHistoryInformation, error) {
+	information := TransactionHistoryInformation{Filter: filter}
+
+	from := sql.NullTime{Time: filter.From, Valid: !filter.From.IsZero()}
+	to := sql.NullTime{Time: filter.To, Valid: !filter.To.IsZero()}
+
+	// fetching one extra row tells us whether there's another page
+	rows, err := d.Conn.Query(GetTransactionHistoryStatement, userID, from, to, filter.Product, filter.Status, filter.Direction, filter.PageSize+1, filter.Offset())
+	if err != nil {
+		return information, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction TransactionRecord
+		var createdAt sql.NullTime
+
+		if err := rows.Scan(
+			&transaction.Reference,
+			&transaction.Product,
+			&transaction.Direction,
+			&transaction.Status,
+			&transaction.Amount,
+			&createdAt,
+		); err != nil {
+			return information, err
+		}
+
+		transaction.CreatedAt = createdAt.Time
+		information.Transactions = append(information.Transactions, transaction)
+	}
+
+	if len(information.Transactions) > filter.PageSize {
+		information.Transactions = information.Transactions[:filter.PageSize]
+		information.HasNextPage = true
+	}
+
+	return information, rows.Err()
+}
+
 func (d *DB) AuthenticateUser(email string, password string) (LoginPostInformation, error) {
 	var information LoginPostInformation
 	var passwordHash string
@@ -111,6 +153,7 @@ func (d *DB) AuthenticateUser(email string, password string) (LoginPostInformati
 		&information.Email,
 		&information.UserIsAdmin,
 		&information.UserIsVerified,
+		&information.UserIsSuspended,
 		&passwordHash,
 	); err != nil {
 		if err == sql.ErrNoRows {
@@ -127,6 +170,10 @@ func (d *DB) AuthenticateUser(email string, password string) (LoginPostInformati
 		return information, ErrPasswordIncorrect
 	}
 
+	if information.UserIsSuspended {
+		return information, ErrAccountSuspended
+	}
+
 	return information, nil
 }
 
@@ -185,37 +232,20 @@ func (d *DB) GetProfileScreenInformation(userID uint) (ProfileScreenInformation,
 }
 
 func (d *DB) GetSavingsScreenInformation(userID uint) (SavingsScreenInformation, error) {
-	var transitoryBalance sql.NullInt64
 	var information SavingsScreenInformation
 
 	if err := d.Conn.QueryRow(
 		GetSavingsScreenInformationStatement, userID,
 	).Scan(
-		&transitoryBalance,
+		&information.Balance,
 	); err != nil {
 		return information, err
 	}
 
-	// the money data is stored as kobo. Change it to naira here
-	if transitoryBalance.Valid {
-		information.Balance = convertToNaira(transitoryBalance.Int64)
-	}
-
 	return information, nil
 }
 
-func convertToNaira(kobo int64) uint64 {
-	if kobo == 0 {
-		return 0
-	}
-	// TODO: there should be proper testing here.
-	// there shouldn't be any negative values passed in as kobo
-	// this is a domain rule
-	return uint64(kobo / 100)
-}
-
 func (d *DB) GetFamilyVaultScreenInformation(userID uint) (FamilyVaultScreenInformation, error) {
-	var transitoryBalance int64
 	var information FamilyVaultScreenInformation
 	var plans []FamilyVaultBasicPlan
 
@@ -232,23 +262,23 @@ func (d *DB) GetFamilyVaultScreenInformation(userID uint) (FamilyVaultScreenInfo
 	for rows.Next() {
 		plan := new(FamilyVaultBasicPlan)
 		var ownerID uint
-		var balance int64
 
-		err = rows.Scan(&plan.ID, &plan.Name, &plan.Description, &balance, &ownerID)
+		err = rows.Scan(&plan.ID, &plan.Name, &plan.Description, &plan.Balance, &ownerID)
+
+		if err != nil {
+			return information, err
+		}
 
+		information.Balance, err = information.Balance.Add(plan.Balance)
 		if err != nil {
 			return information, err
 		}
 
-		// highly inefficient
-		plan.Balance = humanize.Comma(int64(convertToNaira(balance)))
 		plan.IsCreator = (ownerID == userID)
 		plans = append(plans, *plan)
 	}
 
 	information.FamilyVaultBasicPlans = plans
-	// the money data is stored as kobo. Change it to naira here
-	information.Balance = humanize.Comma(int64(convertToNaira(transitoryBalance)))
 	return information, nil
 }
 
@@ -256,13 +286,12 @@ func (d *DB) GetFamilyVaultPlanScreenInformation(userID uint, planID int) (Famil
 	var information FamilyVaultPlanScreenInformation
 	var description sql.NullString
 	var creatorID int
-	var balance int64
 
 	if err := d.Conn.QueryRow(GetFamilyVaultPlanScreenInformationStatement, planID, userID).Scan(
 		&information.ID,
 		&information.Name,
 		&description,
-		&balance,
+		&information.Balance,
 		&creatorID,
 	); err != nil {
 		if err == sql.ErrNoRows {
@@ -271,17 +300,15 @@ func (d *DB) GetFamilyVaultPlanScreenInformation(userID uint, planID int) (Famil
 	}
 
 	information.Description = description.String
-	information.Balance = humanize.Comma(int64(convertToNaira(balance)))
 	return information, nil
 }
 
 func (d *DB) GetSoloSaverScreenInformation(userID uint) (SoloSaverScreenInformation, error) {
 	var information SoloSaverScreenInformation
-	var balance sql.NullInt64
 	var email sql.NullString
 
 	if err := d.Conn.QueryRow(GetSoloSaverScreenInformationStatement, userID).Scan(
-		&balance,
+		&information.Balance,
 		&email,
 		&information.HasPendingPayment,
 	); err != nil {
@@ -290,10 +317,16 @@ func (d *DB) GetSoloSaverScreenInformation(userID uint) (SoloSaverScreenInformat
 		}
 	}
 
-	information.Balance = uint64(balance.Int64) / 100
-	// the balance is converted back to normal naira
 	information.EmailAddress = email.String
-	return information, nil
+
+	if err := d.Conn.QueryRow(GetSoloSavingsOnHoldStatement, userID).Scan(&information.OnHold); err != nil {
+		return information, err
+	}
+
+	// withdrawals are paid out to one of these
+	accounts, err := d.GetBankAccounts(userID)
+	information.Accounts = accounts
+	return information, err
 }
 
 func (d *DB) GetTargetSavingsPlanScreenInformation(userID uint, planID int) (TargetSavingsPlanScreenInformation, error) {
@@ -302,7 +335,6 @@ func (d *DB) GetTargetSavingsPlanScreenInformation(userID uint, planID int) (Tar
 
 func (d *DB) GetTargetSavingsScreenInformation(userID uint) (TargetSavingsScreenInformation, error) {
 	var information TargetSavingsScreenInformation
-	var balance sql.NullInt64
 	var plans []TargetSavingsBasicPlan
 
 	rows, err := d.Conn.Query(GetTargetSavingsScreenInformationStatement, userID)
@@ -317,35 +349,60 @@ func (d *DB) GetTargetSavingsScreenInformation(userID uint) (TargetSavingsScreen
 
 		err = rows.Scan(&plan.ID, &plan.Name, &plan.Description, &plan.Balance, &plan.Goal)
 
-		balance.Int64 += int64(plan.Balance)
+		if err != nil {
+			return information, err
+		}
 
+		information.Balance, err = information.Balance.Add(plan.Balance)
 		if err != nil {
 			return information, err
 		}
-		plan.CompletionPercentage = uint((plan.Balance / plan.Goal) * 100)
+
+		if plan.Goal > 0 {
+			plan.CompletionPercentage = uint(plan.Balance * 100 / plan.Goal)
+		}
 		plans = append(plans, *plan)
 	}
 
 	information.Plans = plans
-	// the money data is stored as kobo. Change it to naira here
 	return information, nil
 }
 
 func (d *DB) GetLoansScreenInformation(userID uint) (LoansScreenInformation, error) {
 	var information LoansScreenInformation
-	var balance sql.NullInt64
 
 	if err := d.Conn.QueryRow(GetLoansScreenInformationStatement, userID).Scan(
-		&balance,
-		&information.HasPendingLoans,
+		&information.Balance,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return information, fmt.Errorf("error %s returned from query", err.Error())
 		}
 	}
 
-	information.Balance = balance.Int64
-	return information, nil
+	applications, err := d.GetCustomerLoanApplications(userID)
+	if err != nil {
+		return information, err
+	}
+
+	information.Applications = applications
+	for _, application := range applications {
+		if application.InProgress() && application.Status != LoanApplicationActive && application.Status != LoanApplicationDefaulted {
+			information.HasPendingLoans = true
+		}
+	}
+
+	loan, err := d.GetActiveLoan(userID)
+	if err == ErrLoanDoesNotExist {
+		return information, nil
+	}
+	if err != nil {
+		return information, err
+	}
+
+	information.Loan = loan
+	information.HasLoan = true
+	information.Repayments, err = d.GetLoanRepayments(loan.ID)
+	return information, err
 }
 
 func (d *DB) GetThriftScreenInformation(userID uint) (ThriftScreenInformation, error) {
@@ -384,182 +441,3139 @@ func (d *DB) RegisterUser(firstName, lastName, email, password string) (Register
 	return information, nil
 }
 
-func (d *DB) CreateLoanApplication(userID uint, amount, termDuration uint64, bvn uint64) (LoanApplicationInformation, error) {
-	var information LoanApplicationInformation
-	amount_in_k := amount * 100
-	_, err := d.Conn.Exec(CreateLoanApplicationStatement, userID, amount_in_k, termDuration)
-
-	if err != nil {
-		return information, fmt.Errorf("Error while executing statement: %s", err)
-	}
-
-	return information, nil
-}
-
 func (d *DB) GetLoanScreenInformation(userID uint) (GetLoanScreenInformation, error) {
 	// TODO: the name of this function is too alike to another. The other function breaks the convention of this entire interface. FIX IT.
 
 	var information GetLoanScreenInformation
-	statement, err := d.Conn.Prepare(GetLoanScreenInformationStatement)
 
+	// TODO: after BVN validation step, this should change
+	bvn, err := d.GetBVN(userID)
 	if err != nil {
 		return information, err
 	}
+	information.HasValidBVN = bvn != ""
 
-	err = statement.QueryRow(userID).Scan(&information.HasValidBVN)
-
-	// TODO: after BVN validation step, this should change
+	if information.BankAccounts, err = d.GetBankAccounts(userID); err != nil {
+		return information, err
+	}
 
+	applications, err := d.GetCustomerLoanApplications(userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			information.HasValidBVN = false
-			return information, nil
-		}
 		return information, err
 	}
 
-	information.HasValidBVN = true
-	return information, nil
+	for _, application := range applications {
+		if application.InProgress() {
+			information.Application = application
+			information.HasApplicationInProgress = true
+			information.Guarantors, err = d.GetLoanGuarantors(application.ID)
+			break
+		}
+	}
+
+	return information, err
 }
 
 func (d *DB) GetPaystackVerificationInformation(referenceNumber string) (PaystackTransactionInformation, error) {
+	information, err := scanPayment(d.Conn.QueryRow(GetPaystackVerificationInformation, referenceNumber))
+	if err == sql.ErrNoRows {
+		return information, ErrReferenceNumberDoesNotExist
+	}
+	return information, err
+}
+
+func scanPayment(row scanner) (PaystackTransactionInformation, error) {
 	var information PaystackTransactionInformation
+	var verifiedAt, flaggedAt sql.NullTime
+
+	err := row.Scan(
+		&information.CustomerID,
+		&information.PlanID,
+		&information.ReferenceNumber,
+		&information.PaymentOriginator,
+		&information.PaymentAmount,
+		&information.PaymentProvider,
+		&information.FulfillmentStatus,
+		&information.FulfillmentFailureReason,
+		&information.VerificationStatus,
+		&information.VerificationFailureReason,
+		&information.CreatedAt,
+		&verifiedAt,
+		&flaggedAt,
+		&information.FlagReason,
+	)
+
+	information.VerifiedAt = verifiedAt.Time
+	information.FlaggedAt = flaggedAt.Time
+	return information, err
+}
 
-	err := d.Conn.QueryRow(GetPaystackVerificationInformation, referenceNumber).Scan(&information.CustomerID, &information.PlanID, &information.PaymentOriginator)
+func (d *DB) queryPayments(query string, args ...any) ([]PaystackTransactionInformation, error) {
+	var payments []PaystackTransactionInformation
 
+	rows, err := d.Conn.Query(query, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return information, ErrReferenceNumberDoesNotExist
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return payments, err
 		}
-		return information, err
+		payments = append(payments, payment)
 	}
 
-	return information, nil
+	return payments, rows.Err()
 }
 
-func (d *DB) UpdateSoloSaverPaymentFailure(referenceNumber uuid.UUID) (SoloSaverPaymentInformation, error) {
-	var information SoloSaverPaymentInformation
-	if _, err := d.Conn.Exec(UpdateSoloSaverPaymentFailureStatement, referenceNumber); err != nil {
-		return information, err
-	}
-	return information, nil
+// RecordVerificationFailure fails a pending payment that Paystack
+// says didn't go through, or that didn't match what we expected
+func (d *DB) RecordVerificationFailure(referenceNumber uuid.UUID, reason string) error {
+	_, err := d.Conn.Exec(RecordVerificationFailureStatement, referenceNumber, reason)
+	return err
 }
 
 // For solo savers payments, planID doesn't matter, but you'll still need to provide something, by convention, we can make that 99909990
-func (d *DB) CreatePayment(userID, planID uint, referenceNumber uuid.UUID, paymentOriginator string, amountInK int64) (PaymentInformation, error) {
+func (d *DB) CreatePayment(userID, planID uint, referenceNumber uuid.UUID, paymentOriginator string, amount Money, provider string) (PaymentInformation, error) {
 	var information PaymentInformation
 
-	_, err := d.Conn.Exec(CreatePaymentProcessorPendingTransaction, userID, planID, referenceNumber, paymentOriginator, amountInK)
+	_, err := d.Conn.Exec(CreatePaymentProcessorPendingTransaction, userID, planID, referenceNumber, paymentOriginator, amount, provider)
 
 	if err != nil {
 		log.Printf("An error occured while trying to create a pending payment %s", err)
-		return information, nil
+		return information, err
 	}
 
 	return information, nil
 }
 
-// Takes a paystack payment, saves the paystack information then also for this function at least, it updates the user's solo saver account
-func (d *DB) UpdateSoloSaverPaymentInformation(amountInK uint64, referenceNumber uuid.UUID) (SoloSaverPaymentInformation, error) {
-	var information SoloSaverPaymentInformation
+func (d *DB) MarkPaymentVerified(referenceNumber uuid.UUID) error {
+	_, err := d.Conn.Exec(MarkPaymentVerifiedStatement, referenceNumber)
+	return err
+}
 
-	if _, err := d.Conn.Exec(UpdateSoloSaverPaymentInformationStatement, amountInK, referenceNumber); err != nil {
-		return information, err
-	}
+func (d *DB) RecordFulfillmentFailure(referenceNumber uuid.UUID, reason string) error {
+	_, err := d.Conn.Exec(RecordFulfillmentFailureStatement, referenceNumber, reason)
+	return err
+}
 
-	return information, nil
+func (d *DB) FulfillSoloSavingsPayment(payment PaystackTransactionInformation) error {
+	journal := depositJournal(fmt.Sprintf("PAYMENT:%s", payment.ReferenceNumber), soloSavingsLedgerAccount(payment.CustomerID), payment.PaymentAmount)
+	return d.fulfillPayment(payment, journal, CreditSoloSavingsBalanceStatement, payment.CustomerID, payment.PaymentAmount)
 }
 
-func (d *DB) CreateNewFamilyVault(userID uint, familyName, familyMemberEmail string, amount float64, frequency string, duration int64) (FamilyVaultInformation, error) {
-	var information FamilyVaultInformation
-	description := ""
-	balance_in_k := 0
-	amount_in_k := amount * 100
+func (d *DB) FulfillTargetSavingsPayment(payment PaystackTransactionInformation) error {
+	journal := depositJournal(fmt.Sprintf("PAYMENT:%s", payment.ReferenceNumber), targetSavingsLedgerAccount(payment.CustomerID, payment.PlanID), payment.PaymentAmount)
+	return d.fulfillPayment(payment, journal, CreditTargetSavingsBalanceStatement, payment.PlanID, payment.CustomerID, payment.PaymentAmount)
+}
 
-	var planID uint
+func (d *DB) FulfillFamilyVaultPayment(payment PaystackTransactionInformation) error {
+	journal := depositJournal(fmt.Sprintf("PAYMENT:%s", payment.ReferenceNumber), familyVaultLedgerAccount(payment.PlanID), payment.PaymentAmount)
+	return d.fulfillPayment(payment, journal, CreditFamilyVaultBalanceStatement, payment.PlanID, payment.CustomerID, payment.PaymentAmount)
+}
 
-	transformedFrequency, err := convertFrequency(frequency)
+// FulfillLoanRepayment shares a repayment out over the loan's
+// installments, penalties first, then interest, then principal.
+// Repayments for loans that are no longer being repaid, or that are
+// more than is now owed, can't be fulfilled.
+func (d *DB) FulfillLoanRepayment(payment PaystackTransactionInformation) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
+	repayment, err := scanLoanRepayment(tx.QueryRow(GetLoanRepaymentStatement, payment.ReferenceNumber))
+	if err == ErrLoanRepaymentDoesNotExist {
+		return fmt.Errorf("%w: %s", ErrFulfillmentTargetAbsent, err)
+	}
 	if err != nil {
-		return information, err
+		return err
 	}
 
-	statement, err := d.Conn.Prepare(CreateFamilyVaultStatement)
-	err = statement.QueryRow(userID, familyName, description, amount_in_k, balance_in_k, duration, transformedFrequency, familyMemberEmail).Scan(&planID)
+	loan, err := scanLoan(tx.QueryRow(LockLoanStatement, repayment.LoanID))
+	if err != nil {
+		return err
+	}
+	if !loan.Repayable() {
+		return fmt.Errorf("%w: %s", ErrFulfillmentTargetAbsent, ErrLoanNotActive)
+	}
 
+	if loan.Installments, err = getLoanInstallments(tx, loan.ID); err != nil {
+		return err
+	}
+
+	allocation, err := allocateRepayment(loan, payment.PaymentAmount, time.Now(), repaymentThrough(repayment))
+	if errors.Is(err, ErrRepaymentTooLarge) {
+		return fmt.Errorf("%w: %s", ErrFulfillmentTargetAbsent, err)
+	}
 	if err != nil {
-		return information, err
+		return err
 	}
 
-	information.PlanID = planID
-	return information, nil
+	journal := loanRepaymentJournal(fmt.Sprintf("LOAN_REPAYMENT:%s", payment.ReferenceNumber), payment.CustomerID, allocation)
+	if _, err = postJournal(tx, journal); err != nil {
+		return err
+	}
+
+	if err = updateLoanInstallments(tx, loan.Installments, allocation.Installments); err != nil {
+		return err
+	}
+
+	if allocation.PrincipalPaid > 0 {
+		if err = updateBalance(tx, DecreaseLoansOwedStatement, payment.CustomerID, allocation.PrincipalPaid); err != nil {
+			return fulfillmentBalanceError(err)
+		}
+	}
+
+	if _, err = tx.Exec(AllocateLoanRepaymentStatement, payment.ReferenceNumber, allocation.PenaltyPaid, allocation.FeePaid, allocation.InterestPaid, allocation.PrincipalPaid, allocation.WaivedInterest); err != nil {
+		return err
+	}
+
+	if allocation.Repaid {
+		if err = setLoanStatus(tx, loan.ID, LoanRepaid, LoanApplicationRepaid); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(MarkPaymentFulfilledStatement, payment.ReferenceNumber); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (d *DB) GetInvestmentsScreenInformation(userID uint) (InvestmentsScreenInformation, error) {
-	var information InvestmentsScreenInformation
-	var balance int64
-	err := d.Conn.QueryRow(GetInvestmentsScreenInformationStatement, userID).Scan(&balance)
+// updateLoanInstallments saves the installments of a schedule that
+// changed from before
+func updateLoanInstallments(tx *sql.Tx, before, after []LoanInstallment) error {
+	for i, installment := range after {
+		if installment == before[i] {
+			continue
+		}
+		paidAt := sql.NullTime{Time: installment.PaidAt, Valid: !installment.PaidAt.IsZero()}
+		if _, err := tx.Exec(UpdateLoanInstallmentStatement, installment.ID, installment.InterestDue, installment.PrincipalPaid, installment.InterestPaid, installment.PenaltyPaid, installment.FeePaid, paidAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setLoanStatus marks a loan repaid, or reopens it, along with its
+// application
+func setLoanStatus(tx *sql.Tx, loanID uint, status, applicationStatus string) error {
+	statement := MarkLoanRepaidStatement
+	if status == LoanActive {
+		statement = ReopenLoanStatement
+	}
+	if _, err := tx.Exec(statement, loanID); err != nil {
+		return err
+	}
+
+	// loans made before applications were tracked have none
+	application, err := scanLoanApplication(tx.QueryRow(LockLoanApplicationByLoanStatement, loanID))
+	if err == nil {
+		_, err = transitionLoanApplication(tx, application, applicationStatus, 0, "")
+	}
+	if err != nil && err != ErrLoanApplicationDoesNotExist {
+		return err
+	}
+	return nil
+}
 
+// FulfillInvestmentPayment pays the payment into the customer's
+// investment balance and, when it is for an application that is
+// waiting to be paid for, opens the application's investment with it.
+// Payments that can't open an investment stay in the balance, and the
+// reason is kept in the application's audit log.
+func (d *DB) FulfillInvestmentPayment(payment PaystackTransactionInformation) error {
+	tx, err := d.Conn.Begin()
 	if err != nil {
-		return information, err
+		return err
+	}
+	defer tx.Rollback()
+
+	journal := depositJournal(fmt.Sprintf("PAYMENT:%s", payment.ReferenceNumber), investmentLedgerAccount(payment.CustomerID), payment.PaymentAmount)
+	if _, err = postJournal(tx, journal); err != nil {
+		return err
+	}
+	if err := updateBalance(tx, CreditInvestmentBalanceStatement, payment.CustomerID, payment.PaymentAmount); err != nil {
+		return fulfillmentBalanceError(err)
 	}
 
-	information.Balance = convertToNaira(balance)
+	if payment.PlanID != 0 {
+		application, err := scanInvestmentApplication(tx.QueryRow(LockInvestmentApplicationStatement, payment.PlanID))
+		if err != nil && err != ErrInvestmentApplicationDoesNotExist {
+			return err
+		}
 
-	return information, nil
+		detail := ""
+		if err == nil {
+			err = checkInvestmentPayment(application, payment)
+		}
+		if err == nil {
+			var position InvestmentPosition
+			position, err = openInvestmentPosition(tx, application, time.Now())
+			detail = fmt.Sprintf("paid for by payment %s, which opened investment %d of %s at %s a year until %s", payment.ReferenceNumber, position.ID, position.Principal, position.RatePercent(), position.MaturityDate.Format("2006-01-02"))
+		}
+		switch {
+		case err == ErrInvestmentApplicationDoesNotExist, err == ErrInvestmentApplicationNotPayable, errors.Is(err, ErrChargeAmountMismatch),
+			err == ErrInvestmentProductDoesNotExist, err == ErrInvestmentProductInactive, err == ErrInvestmentBelowMinimum, err == ErrInvestmentTenor:
+			detail = fmt.Sprintf("payment %s of %s was kept in the investment balance: %s", payment.ReferenceNumber, payment.PaymentAmount, err)
+		case err != nil:
+			return err
+		}
+
+		if _, err := tx.Exec(RecordAuditStatement, ActorSystem, AuditInvestmentApplicationFunded, investmentApplicationAuditSubject(payment.PlanID), detail); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(MarkPaymentFulfilledStatement, payment.ReferenceNumber); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (d *DB) CreateInvestmentApplication(userID uint, employmentInformation string, yearOfEmployment time.Time, employerName string, investmentAmount uint64, investmentTenure uint64, taxIdentificationNumber uint64, bankAccountName string, bankAccountNumber uint64) (InvestmentApplicationInformation, error) {
+// fulfillPayment posts the journal, credits the cached balance with
+// balanceStatement and marks the payment fulfilled in one database
+// transaction. The balance statement must affect exactly one row.
+func (d *DB) fulfillPayment(payment PaystackTransactionInformation, journal JournalTransaction, balanceStatement string, args ...any) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	formattedDateOfEmployment := yearOfEmployment.Format("2006-01-02")
-	convertedInvestmentAmount := investmentAmount * 100
-	
-	var information InvestmentApplicationInformation
-	if _, err := d.Conn.Exec(CreateInvestmentApplicationStatement, userID, employmentInformation, formattedDateOfEmployment, employerName, investmentTenure, taxIdentificationNumber, bankAccountName, bankAccountNumber, convertedInvestmentAmount); err != nil {
-		return information, err
+	if _, err = postJournal(tx, journal); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(balanceStatement, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected != 1 {
+		return ErrFulfillmentTargetAbsent
+	}
+
+	if _, err = tx.Exec(MarkPaymentFulfilledStatement, payment.ReferenceNumber); err != nil {
+		return err
 	}
 
-	return information, nil 
+	return tx.Commit()
 }
 
-func (d *DB) GetAdminHomeScreenInformation(userID uint) (AdminHomeScreenInformation, error) {
-	// TODO: Limit this to only admins
-	// that's what the userID is for
-	var information AdminHomeScreenInformation
+// PostSoloSaverWithdrawal takes money out of a customer's solo saver
+// account. The reference identifies the withdrawal so that it can't
+// be posted twice.
+func (d *DB) PostSoloSaverWithdrawal(userID uint, amount Money, reference string) (LedgerPostingInformation, error) {
+	journal := withdrawalJournal(fmt.Sprintf("WITHDRAWAL:%s", reference), soloSavingsLedgerAccount(userID), amount)
+	return d.postJournalWithBalanceUpdate(journal, WithdrawSoloSavingsBalanceStatement, userID, amount)
+}
+
+func (d *DB) PostSoloSaverInterest(userID uint, amount Money, reference string) (LedgerPostingInformation, error) {
+	journal := interestJournal(fmt.Sprintf("INTEREST:%s", reference), soloSavingsLedgerAccount(userID), amount)
+	return d.postJournalWithBalanceUpdate(journal, CreditSoloSavingsBalanceStatement, userID, amount)
+}
+
+// PostSoloSaverAdjustment pays money into, or takes it out of, a
+// customer's solo saver account by hand. The reference is the admin
+// action it was approved with.
+func (d *DB) PostSoloSaverAdjustment(userID uint, amount Money, credit bool, reference string) (LedgerPostingInformation, error) {
+	journal := adjustmentJournal(fmt.Sprintf("ADJUSTMENT:%s", reference), soloSavingsLedgerAccount(userID), amount, credit)
+	if credit {
+		return d.postJournalWithBalanceUpdate(journal, CreditSoloSavingsBalanceStatement, userID, amount)
+	}
+	return d.postJournalWithBalanceUpdate(journal, DebitSoloSavingsBalanceStatement, userID, amount)
+}
 
-	err := d.Conn.QueryRow(GetAdminHomeScreenInformationStatement).Scan(&information.LoanRequests, &information.InvestmentsRequests, &information.WithdrawalRequests)
+// postJournalWithBalanceUpdate posts the journal and updates the
+// cached balance in one database transaction. The balance statement
+// takes the customer id and the amount, and must affect exactly one
+// row. Debits that would overdraw the account affect none.
+func (d *DB) postJournalWithBalanceUpdate(journal JournalTransaction, balanceStatement string, customerID uint, amount Money) (LedgerPostingInformation, error) {
+	var information LedgerPostingInformation
 
+	tx, err := d.Conn.Begin()
 	if err != nil {
 		return information, err
 	}
+	defer tx.Rollback()
 
-	return information, nil
+	information.LedgerTransactionID, err = postJournal(tx, journal)
+	if err != nil {
+		return information, err
+	}
+
+	if err := updateBalance(tx, balanceStatement, customerID, amount); err != nil {
+		return information, err
+	}
+
+	return information, tx.Commit()
 }
 
-func convertFrequency(frequency string) (string, error) {
-	if frequency == "Daily" {
-		return "D", nil
+// updateBalance runs a balance statement, which must affect exactly one
+// row. Most take the customer id and the amount.
+func updateBalance(tx *sql.Tx, balanceStatement string, args ...any) error {
+	result, err := tx.Exec(balanceStatement, args...)
+	if err != nil {
+		return err
 	}
-	if frequency == "Weekly" {
-		return "W", nil
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
-	if frequency == "Montly" {
-		return "M", nil
+	if affected != 1 {
+		return ErrInsufficientLedgerFund
 	}
-	if frequency == "Yearly" {
-		return "Y", nil
+
+	return nil
+}
+
+// postJournal writes a validated journal inside tx. It is the only
+// place where ledger rows get written.
+func postJournal(tx *sql.Tx, journal JournalTransaction) (uint, error) {
+	var transactionID uint
+
+	if err := journal.Validate(); err != nil {
+		return transactionID, err
 	}
-	return "", errors.New(fmt.Sprintf("Unknown frequency specified %s", frequency))
+
+	err := tx.QueryRow(CreateLedgerTransactionStatement, journal.IdempotencyKey, journal.Description).Scan(&transactionID)
+
+	if err == sql.ErrNoRows {
+		return transactionID, ErrJournalAlreadyPosted
+	}
+
+	if err != nil {
+		return transactionID, err
+	}
+
+	for _, entry := range journal.Entries {
+		var accountID uint
+		customerID := sql.NullInt64{Int64: int64(entry.Account.CustomerID), Valid: entry.Account.CustomerID != 0}
+
+		if err := tx.QueryRow(UpsertLedgerAccountStatement, entry.Account.Code, entry.Account.Type, customerID).Scan(&accountID); err != nil {
+			return transactionID, err
+		}
+
+		if _, err := tx.Exec(CreateLedgerEntryStatement, transactionID, accountID, entry.Direction, entry.Amount); err != nil {
+			return transactionID, err
+		}
+	}
+
+	return transactionID, nil
 }
 
-func HashPassword(password string) (string, error) {
-	// the second argument is the cost,
-	// which I suppose is how many times the hash is rehashed
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 16)
+// GetStatementInformation builds a statement for one of the
+// customer's ledger accounts from the journal
+func (d *DB) GetStatementInformation(userID uint, request StatementRequest) (StatementInformation, error) {
+	information := StatementInformation{Product: request.Product, From: request.From, To: request.To, GeneratedAt: time.Now()}
+
+	ledgerAccount, ok := statementProducts[request.Product]
+	if !ok {
+		return information, fmt.Errorf("no statement for product %q", request.Product)
+	}
+	account := ledgerAccount(userID, request.Plan)
+
+	if planStatement, ok := statementPlanStatements[request.Product]; ok {
+		err := d.Conn.QueryRow(planStatement, request.Plan, userID).Scan(&information.PlanName)
+		if err == sql.ErrNoRows {
+			return information, ErrStatementPlanNotFound
+		}
+		if err != nil {
+			return information, err
+		}
+	}
+
+	var firstName, lastName string
+	if err := d.Conn.QueryRow(GetStatementCustomerStatement, userID).Scan(&firstName, &lastName, &information.EmailAddress); err != nil {
+		return information, err
+	}
+	information.CustomerName = fmt.Sprintf("%s %s", firstName, lastName)
+
+	if err := d.Conn.QueryRow(GetLedgerBalanceBeforeStatement, account.Code, request.From).Scan(&information.OpeningBalance); err != nil {
+		return information, err
+	}
 
+	rows, err := d.Conn.Query(GetLedgerEntriesBetweenStatement, account.Code, request.From, request.To)
 	if err != nil {
-		return "", err
+		return information, err
 	}
+	defer rows.Close()
 
-	return string(hash), nil
+	var entries []StatementLedgerEntry
+	for rows.Next() {
+		var entry StatementLedgerEntry
+		var idempotencyKey, description string
+
+		if err := rows.Scan(&idempotencyKey, &description, &entry.Direction, &entry.Amount, &entry.CreatedAt); err != nil {
+			return information, err
+		}
+
+		entry.Description, entry.Reference = statementDescription(idempotencyKey, description)
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return information, err
+	}
+
+	information.Lines, information.ClosingBalance, err = buildStatementLines(account.Type, information.OpeningBalance, entries)
+	return information, err
+}
+
+// GetStatementPlans lists the savings plans and investments the
+// customer can get a statement for
+func (d *DB) GetStatementPlans(userID uint) ([]StatementPlan, error) {
+	var plans []StatementPlan
+
+	rows, err := d.Conn.Query(GetStatementPlansStatement, userID)
+	if err != nil {
+		return plans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var plan StatementPlan
+		if err := rows.Scan(&plan.Product, &plan.ID, &plan.Name); err != nil {
+			return plans, err
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, rows.Err()
+}
+
+func (d *DB) GetLedgerBalance(accountCode string) (Money, error) {
+	var balance Money
+	err := d.Conn.QueryRow(GetLedgerBalanceStatement, accountCode).Scan(&balance)
+	return balance, err
+}
+
+// CheckLedgerInvariants returns every journal that doesn't balance and
+// every account whose cached balance disagrees with the journal. An
+// empty result means the books are consistent.
+func (d *DB) CheckLedgerInvariants() ([]LedgerDiscrepancy, error) {
+	var discrepancies []LedgerDiscrepancy
+
+	rows, err := d.Conn.Query(GetUnbalancedLedgerTransactionsStatement)
+	if err != nil {
+		return discrepancies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var debits, credits Money
+
+		if err := rows.Scan(&key, &debits, &credits); err != nil {
+			return discrepancies, err
+		}
+
+		discrepancies = append(discrepancies, LedgerDiscrepancy{
+			AccountCode:   key,
+			CachedBalance: debits,
+			LedgerBalance: credits,
+			Reason:        "journal debits and credits do not balance",
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		return discrepancies, err
+	}
+
+	mismatches, err := d.Conn.Query(GetLedgerBalanceMismatchesStatement)
+	if err != nil {
+		return discrepancies, err
+	}
+	defer mismatches.Close()
+
+	for mismatches.Next() {
+		discrepancy := LedgerDiscrepancy{Reason: "cached balance does not match the ledger"}
+
+		if err := mismatches.Scan(&discrepancy.AccountCode, &discrepancy.CachedBalance, &discrepancy.LedgerBalance); err != nil {
+			return discrepancies, err
+		}
+
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	return discrepancies, mismatches.Err()
+}
+
+func (d *DB) CreateNewFamilyVault(userID uint, familyName, familyMemberEmail string, amount Money, frequency string, duration int64) (FamilyVaultInformation, error) {
+	var information FamilyVaultInformation
+	description := ""
+	balance_in_k := 0
+
+	var planID uint
+
+	transformedFrequency, err := convertFrequency(frequency)
+
+	if err != nil {
+		return information, err
+	}
+
+	statement, err := d.Conn.Prepare(CreateFamilyVaultStatement)
+	err = statement.QueryRow(userID, familyName, description, amount, balance_in_k, duration, transformedFrequency, familyMemberEmail).Scan(&planID)
+
+	if err != nil {
+		return information, err
+	}
+
+	information.PlanID = planID
+	return information, nil
+}
+
+func (d *DB) GetInvestmentsScreenInformation(userID uint) (InvestmentsScreenInformation, error) {
+	var information InvestmentsScreenInformation
+	err := d.Conn.QueryRow(GetInvestmentsScreenInformationStatement, userID).Scan(&information.Balance)
+
+	if err != nil {
+		return information, err
+	}
+
+	if information.Positions, err = d.GetCustomerInvestmentPositions(userID); err != nil {
+		return information, err
+	}
+
+	if information.Applications, err = d.GetCustomerInvestmentApplications(userID); err != nil {
+		return information, err
+	}
+
+	information.Products, err = d.GetInvestmentProducts(true)
+	return information, err
+}
+
+func (d *DB) GetAdminHomeScreenInformation(userID uint) (AdminHomeScreenInformation, error) {
+	// TODO: Limit this to only admins
+	// that's what the userID is for
+	var information AdminHomeScreenInformation
+
+	err := d.Conn.QueryRow(GetAdminHomeScreenInformationStatement).Scan(&information.LoanRequests, &information.LoansUnderReview, &information.InvestmentsRequests, &information.WithdrawalRequests, &information.ActionsToApprove)
+
+	if err != nil {
+		return information, err
+	}
+
+	return information, nil
+}
+
+func convertFrequency(frequency string) (string, error) {
+	if frequency == "Daily" {
+		return "D", nil
+	}
+	if frequency == "Weekly" {
+		return "W", nil
+	}
+	if frequency == "Montly" {
+		return "M", nil
+	}
+	if frequency == "Yearly" {
+		return "Y", nil
+	}
+	return "", errors.New(fmt.Sprintf("Unknown frequency specified %s", frequency))
+}
+
+func HashPassword(password string) (string, error) {
+	// the second argument is the cost,
+	// which I suppose is how many times the hash is rehashed
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 16)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (d *DB) SaveWebhookEvent(event WebhookEvent) (uint, bool, error) {
+	var id uint
+
+	err := d.Conn.QueryRow(SaveWebhookEventStatement, event.Provider, event.EventID, event.EventType, event.Payload, event.Signature, event.SignatureValid).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		// the provider has sent this event before
+		err = d.Conn.QueryRow(GetWebhookEventIDStatement, event.Provider, event.EventID).Scan(&id)
+		return id, true, err
+	}
+
+	return id, false, err
+}
+
+func (d *DB) GetWebhookEvent(id uint) (WebhookEvent, error) {
+	event, err := scanWebhookEvent(d.Conn.QueryRow(GetWebhookEventStatement, id))
+	if err == sql.ErrNoRows {
+		return event, ErrWebhookEventDoesNotExist
+	}
+	return event, err
+}
+
+func (d *DB) GetWebhookEvents(status string, limit int) ([]WebhookEvent, error) {
+	var events []WebhookEvent
+
+	rows, err := d.Conn.Query(GetWebhookEventsStatement, status, limit)
+	if err != nil {
+		return events, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (d *DB) RecordWebhookEventOutcome(id uint, processingError error) error {
+	status := StatusSuccessful
+	var reason sql.NullString
+
+	if processingError != nil {
+		status = StatusFailed
+		reason = sql.NullString{String: processingError.Error(), Valid: true}
+	}
+
+	_, err := d.Conn.Exec(RecordWebhookEventOutcomeStatement, id, status, reason)
+	return err
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhookEvent(row scanner) (WebhookEvent, error) {
+	var event WebhookEvent
+	var processedAt sql.NullTime
+
+	err := row.Scan(
+		&event.ID,
+		&event.Provider,
+		&event.EventID,
+		&event.EventType,
+		&event.Payload,
+		&event.Signature,
+		&event.SignatureValid,
+		&event.Status,
+		&event.FailureReason,
+		&event.Attempts,
+		&event.ReceivedAt,
+		&processedAt,
+	)
+
+	event.ProcessedAt = processedAt.Time
+	return event, err
+}
+
+func (d *DB) GetStalePendingPayments(createdBefore time.Time, limit int) ([]PaystackTransactionInformation, error) {
+	return d.queryPayments(GetStalePendingPaymentsStatement, createdBefore, limit)
+}
+
+func (d *DB) FlagPaymentForReview(referenceNumber uuid.UUID, reason string) error {
+	_, err := d.Conn.Exec(FlagPaymentForReviewStatement, referenceNumber, reason)
+	return err
+}
+
+func (d *DB) GetFlaggedPayments(limit int) ([]PaystackTransactionInformation, error) {
+	return d.queryPayments(GetFlaggedPaymentsStatement, limit)
+}
+
+func (d *DB) GetPaymentsCreatedBetween(provider string, from, to time.Time) ([]PaystackTransactionInformation, error) {
+	return d.queryPayments(GetPaymentsCreatedBetweenStatement, provider, from, to)
+}
+
+func (d *DB) SaveReconciliationReport(report ReconciliationReport) (uint, error) {
+	discrepancies, err := json.Marshal(report.Discrepancies)
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint
+	err = d.Conn.QueryRow(SaveReconciliationReportStatement, report.Provider, report.Day, report.Matched, discrepancies).Scan(&id)
+	return id, err
+}
+
+func (d *DB) GetReconciliationReports(limit int) ([]ReconciliationReport, error) {
+	var reports []ReconciliationReport
+
+	rows, err := d.Conn.Query(GetReconciliationReportsStatement, limit)
+	if err != nil {
+		return reports, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var report ReconciliationReport
+		var discrepancies []byte
+
+		if err := rows.Scan(&report.ID, &report.Provider, &report.Day, &report.Matched, &discrepancies, &report.CreatedAt); err != nil {
+			return reports, err
+		}
+
+		if err := json.Unmarshal(discrepancies, &report.Discrepancies); err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+func scanBankAccount(row scanner) (BankAccount, error) {
+	var account BankAccount
+	err := row.Scan(&account.ID, &account.CustomerID, &account.BankCode, &account.AccountNumber, &account.AccountName, &account.RecipientProvider, &account.RecipientCode, &account.CreatedAt)
+	return account, err
+}
+
+func (d *DB) AddBankAccount(account BankAccount) (uint, error) {
+	var id uint
+	err := d.Conn.QueryRow(AddBankAccountStatement, account.CustomerID, account.BankCode, account.AccountNumber, account.AccountName, account.RecipientProvider, account.RecipientCode).Scan(&id)
+	if err == sql.ErrNoRows {
+		return id, ErrBankAccountAlreadyLinked
+	}
+	return id, err
+}
+
+// GetBankAccount only finds the account if it is the customer's
+func (d *DB) GetBankAccount(customerID, bankAccountID uint) (BankAccount, error) {
+	account, err := scanBankAccount(d.Conn.QueryRow(GetBankAccountStatement, customerID, bankAccountID))
+	if err == sql.ErrNoRows {
+		return account, ErrBankAccountDoesNotExist
+	}
+	return account, err
+}
+
+func (d *DB) GetBankAccounts(customerID uint) ([]BankAccount, error) {
+	var accounts []BankAccount
+
+	rows, err := d.Conn.Query(GetBankAccountsStatement, customerID)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account, err := scanBankAccount(rows)
+		if err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (d *DB) SaveTransferRecipient(bankAccountID uint, provider, recipientCode string) error {
+	_, err := d.Conn.Exec(SaveTransferRecipientStatement, bankAccountID, provider, recipientCode)
+	return err
+}
+
+func (d *DB) CreateWithdrawalApplication(customerID, bankAccountID uint, amount Money) (uint, error) {
+	var id uint
+	err := d.Conn.QueryRow(CreateWithdrawalApplicationStatement, customerID, bankAccountID, amount).Scan(&id)
+	return id, err
+}
+
+func scanWithdrawalApplication(row scanner) (WithdrawalApplication, error) {
+	var withdrawal WithdrawalApplication
+	var reviewedAt sql.NullTime
+
+	err := row.Scan(&withdrawal.ID, &withdrawal.CustomerID, &withdrawal.CustomerName, &withdrawal.BankAccountID, &withdrawal.Amount, &withdrawal.Status, &withdrawal.FailureReason,
+		&withdrawal.DecisionNote, &withdrawal.ReviewedBy, &reviewedAt, &withdrawal.PayoutStatus, &withdrawal.CreatedAt)
+	if err == sql.ErrNoRows {
+		return withdrawal, ErrWithdrawalDoesNotExist
+	}
+	withdrawal.ReviewedAt = reviewedAt.Time
+	return withdrawal, err
+}
+
+func (d *DB) GetWithdrawalApplication(id uint) (WithdrawalApplication, error) {
+	return scanWithdrawalApplication(d.Conn.QueryRow(GetWithdrawalApplicationStatement, id))
+}
+
+func (d *DB) GetWithdrawalApplications(filter AdminQueueFilter) ([]WithdrawalApplication, error) {
+	var withdrawals []WithdrawalApplication
+
+	rows, err := d.Conn.Query(GetWithdrawalApplicationsStatement, filter.Status, filter.Sort, filter.Limit(), filter.Offset())
+	if err != nil {
+		return withdrawals, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		withdrawal, err := scanWithdrawalApplication(rows)
+		if err != nil {
+			return withdrawals, err
+		}
+		withdrawals = append(withdrawals, withdrawal)
+	}
+
+	return withdrawals, rows.Err()
+}
+
+func (d *DB) ApproveWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error) {
+	return d.decideWithdrawalApplication(id, adminID, StatusPending, AuditWithdrawalApproved, note)
+}
+
+func (d *DB) RejectWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error) {
+	return d.decideWithdrawalApplication(id, adminID, StatusFailed, AuditWithdrawalRejected, note)
+}
+
+// decideWithdrawalApplication records an admin's decision on a
+// withdrawal. Approved withdrawals stay pending until they are paid out.
+func (d *DB) decideWithdrawalApplication(id, adminID uint, status, action, note string) (WithdrawalApplication, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return WithdrawalApplication{}, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return WithdrawalApplication{}, err
+	}
+	defer tx.Rollback()
+
+	withdrawal, err := scanWithdrawalApplication(tx.QueryRow(LockWithdrawalApplicationStatement, id))
+	if err != nil {
+		return withdrawal, err
+	}
+	if withdrawal.Status != StatusPending || withdrawal.Decided() {
+		return withdrawal, ErrWithdrawalDecided
+	}
+
+	if _, err := tx.Exec(DecideWithdrawalApplicationStatement, id, status, note, adminID); err != nil {
+		return withdrawal, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), action, withdrawalAuditSubject(id), fmt.Sprintf("%s: %s", withdrawal.Amount, note)); err != nil {
+		return withdrawal, err
+	}
+
+	withdrawal.Status = status
+	withdrawal.DecisionNote = note
+	withdrawal.ReviewedBy = adminID
+	withdrawal.ReviewedAt = time.Now()
+	if status == StatusFailed {
+		withdrawal.FailureReason = note
+	}
+
+	return withdrawal, tx.Commit()
+}
+
+func scanPayout(row scanner) (Payout, error) {
+	var payout Payout
+	err := row.Scan(&payout.ID, &payout.Reference, &payout.CustomerID, &payout.BankAccountID, &payout.Purpose, &payout.SourceID, &payout.Amount, &payout.Provider, &payout.TransferID, &payout.Status, &payout.FailureReason, &payout.CreatedAt, &payout.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return payout, ErrPayoutDoesNotExist
+	}
+	return payout, err
+}
+
+// payoutBalanceStatements are the statements that update the cached
+// balance of the account a payout's money comes out of, when the money
+// is held and when it is given back
+func payoutBalanceStatements(purpose string) (hold, release string) {
+	if purpose == PayoutPurposeLoanDisbursement {
+		return IncreaseLoansOwedStatement, DecreaseLoansOwedStatement
+	}
+	return WithdrawSoloSavingsBalanceStatement, CreditSoloSavingsBalanceStatement
+}
+
+func (d *DB) CreatePayout(payout Payout) (uint, error) {
+	var id uint
+
+	account, err := payoutLedgerAccount(payout)
+	if err != nil {
+		return id, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return id, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(CreatePayoutStatement, payout.Reference, payout.CustomerID, payout.BankAccountID, payout.Purpose, payout.SourceID, payout.Amount, payout.Provider).Scan(&id)
+	if err == sql.ErrNoRows {
+		return id, ErrPayoutAlreadyExists
+	}
+	if err != nil {
+		return id, err
+	}
+
+	if _, err := postJournal(tx, payoutHoldJournal(payout.Reference.String(), account, payout.Amount)); err != nil {
+		return id, err
+	}
+
+	hold, _ := payoutBalanceStatements(payout.Purpose)
+	if err := updateBalance(tx, hold, payout.CustomerID, payout.Amount); err != nil {
+		return id, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (d *DB) GetPayoutByReference(reference uuid.UUID) (Payout, error) {
+	return scanPayout(d.Conn.QueryRow(GetPayoutByReferenceStatement, reference))
+}
+
+func (d *DB) GetStalePendingPayouts(createdBefore time.Time, limit int) ([]Payout, error) {
+	var payouts []Payout
+
+	rows, err := d.Conn.Query(GetStalePendingPayoutsStatement, createdBefore, limit)
+	if err != nil {
+		return payouts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return payouts, err
+		}
+		payouts = append(payouts, payout)
+	}
+
+	return payouts, rows.Err()
+}
+
+func (d *DB) MarkPayoutProcessing(reference uuid.UUID, transferID string) error {
+	_, err := d.Conn.Exec(MarkPayoutProcessingStatement, reference, transferID)
+	return err
+}
+
+func (d *DB) SettlePayout(reference uuid.UUID) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	payout, err := scanPayout(tx.QueryRow(LockPayoutStatement, reference))
+	if err != nil {
+		return err
+	}
+
+	if payout.Status != PayoutPending && payout.Status != PayoutProcessing {
+		return nil
+	}
+
+	if _, err := postJournal(tx, payoutSettledJournal(reference.String(), payout.Amount)); err != nil {
+		return err
+	}
+
+	if err := endPayout(tx, payout, PayoutSuccessful, ""); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) FailPayout(reference uuid.UUID, status, reason string) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	payout, err := scanPayout(tx.QueryRow(LockPayoutStatement, reference))
+	if err != nil {
+		return err
+	}
+
+	account, err := payoutLedgerAccount(payout)
+	if err != nil {
+		return err
+	}
+
+	var journal JournalTransaction
+	switch {
+	case payout.Status == PayoutPending || payout.Status == PayoutProcessing:
+		// the money never left, whatever the provider calls it
+		journal = payoutReleasedJournal(reference.String(), account, payout.Amount)
+	case payout.Status == PayoutSuccessful && status == PayoutReversed:
+		journal = payoutReversedJournal(reference.String(), account, payout.Amount)
+	default:
+		return nil
+	}
+
+	if _, err := postJournal(tx, journal); err != nil {
+		return err
+	}
+
+	_, release := payoutBalanceStatements(payout.Purpose)
+	if err := updateBalance(tx, release, payout.CustomerID, payout.Amount); err != nil {
+		return err
+	}
+
+	if err := endPayout(tx, payout, status, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// endPayout records how a payout ended, on it and on the withdrawal it
+// was for
+func endPayout(tx *sql.Tx, payout Payout, status, reason string) error {
+	if _, err := tx.Exec(UpdatePayoutStatusStatement, payout.Reference, status, reason); err != nil {
+		return err
+	}
+
+	if payout.Purpose == PayoutPurposeLoanDisbursement {
+		return endLoanDisbursement(tx, payout, status, reason)
+	}
+
+	withdrawalStatus := StatusSuccessful
+	if status != PayoutSuccessful {
+		withdrawalStatus = StatusFailed
+	}
+
+	_, err := tx.Exec(UpdateWithdrawalApplicationStatusStatement, payout.SourceID, withdrawalStatus, reason)
+	return err
+}
+
+// endLoanDisbursement makes the loan once its payout has gone through.
+// Payouts that didn't go through, or came back, send the application
+// back to approved so that it can be paid out again.
+func endLoanDisbursement(tx *sql.Tx, payout Payout, status, reason string) error {
+	application, err := scanLoanApplication(tx.QueryRow(LockLoanApplicationStatement, payout.SourceID))
+	if err != nil {
+		return err
+	}
+
+	if status == PayoutSuccessful {
+		if application.Status != LoanApplicationDisbursed {
+			return nil
+		}
+
+		loan, err := loanApplicationSchedule(application, time.Now())
+		if err != nil {
+			return err
+		}
+
+		loanID, err := createLoan(tx, loan)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(SetLoanApplicationLoanStatement, application.ID, loanID); err != nil {
+			return err
+		}
+
+		_, err = transitionLoanApplication(tx, application, LoanApplicationActive, 0, "")
+		return err
+	}
+
+	if application.Status != LoanApplicationDisbursed && application.Status != LoanApplicationActive {
+		return nil
+	}
+
+	if application.LoanID != 0 {
+		if _, err := tx.Exec(CancelLoanStatement, application.LoanID); err != nil {
+			return err
+		}
+	}
+
+	_, err = transitionLoanApplication(tx, application, LoanApplicationApproved, 0, fmt.Sprintf("the payout was %s: %s", strings.ToLower(status), reason))
+	return err
+}
+
+// paymentBalanceStatements are the statements that update the cached
+// balance that a payment was credited to, when its money is held for a
+// refund or a dispute and when it is given back. Both take args and
+// then the amount. Loan repayments aren't a balance, see
+// holdLoanRepaymentAmount.
+func paymentBalanceStatements(payment PaystackTransactionInformation) (hold, release string, args []any, err error) {
+	switch payment.PaymentOriginator {
+	case OriginatorSoloSavings:
+		return DebitSoloSavingsBalanceStatement, CreditSoloSavingsBalanceStatement, []any{payment.CustomerID}, nil
+	case OriginatorTargetSavings:
+		return DebitTargetSavingsBalanceStatement, CreditTargetSavingsBalanceStatement, []any{payment.PlanID, payment.CustomerID}, nil
+	case OriginatorFamilySavings:
+		return DebitFamilyVaultBalanceStatement, ReturnFamilyVaultBalanceStatement, []any{payment.PlanID}, nil
+	case OriginatorInvestments:
+		return DebitInvestmentBalanceStatement, CreditInvestmentBalanceStatement, []any{payment.CustomerID}, nil
+	}
+	return "", "", nil, fmt.Errorf("%w: %q", ErrUnknownPaymentAccount, payment.PaymentOriginator)
+}
+
+// holdPaymentAmount takes amount out of the balance that a payment was
+// credited to, and posts the journal for it. The balance goes first, so
+// that nothing is posted when there isn't enough.
+func holdPaymentAmount(tx *sql.Tx, payment PaystackTransactionInformation, journal JournalTransaction, amount Money) error {
+	if payment.PaymentOriginator == OriginatorLoanRepayment {
+		return holdLoanRepaymentAmount(tx, payment, journal, amount)
+	}
+
+	hold, _, args, err := paymentBalanceStatements(payment)
+	if err != nil {
+		return err
+	}
+
+	if err := updateBalance(tx, hold, append(args, amount)...); err != nil {
+		return err
+	}
+
+	_, err = postJournal(tx, journal)
+	return err
+}
+
+// releasePaymentAmount gives back an amount that holdPaymentAmount took
+func releasePaymentAmount(tx *sql.Tx, payment PaystackTransactionInformation, journal JournalTransaction, amount Money) error {
+	if payment.PaymentOriginator == OriginatorLoanRepayment {
+		return releaseLoanRepaymentAmount(tx, payment, journal, amount)
+	}
+
+	_, release, args, err := paymentBalanceStatements(payment)
+	if err != nil {
+		return err
+	}
+
+	if _, err := postJournal(tx, journal); err != nil {
+		return err
+	}
+
+	return updateBalance(tx, release, append(args, amount)...)
+}
+
+// lockRepaymentLoan locks the loan that a repayment went to, with its
+// schedule
+func lockRepaymentLoan(tx *sql.Tx, paymentReference uuid.UUID) (LoanRepayment, Loan, error) {
+	repayment, err := scanLoanRepayment(tx.QueryRow(GetLoanRepaymentStatement, paymentReference))
+	if err != nil {
+		return repayment, Loan{}, err
+	}
+
+	loan, err := scanLoan(tx.QueryRow(LockLoanStatement, repayment.LoanID))
+	if err != nil {
+		return repayment, loan, err
+	}
+
+	loan.Installments, err = getLoanInstallments(tx, loan.ID)
+	return repayment, loan, err
+}
+
+// holdLoanRepaymentAmount takes amount of a repayment back off its
+// loan. The principal is owed again, and the interest, fees and
+// penalties come back out of income, so the journal's entry on the
+// customer's loans receivable is split over them. A loan that the
+// repayment paid off is being repaid again.
+func holdLoanRepaymentAmount(tx *sql.Tx, payment PaystackTransactionInformation, journal JournalTransaction, amount Money) error {
+	repayment, loan, err := lockRepaymentLoan(tx, payment.ReferenceNumber)
+	if err != nil {
+		return err
+	}
+
+	// what is left of the repayment was taken back by another refund
+	// or dispute
+	reversal, err := reverseRepayment(loan, repayment, amount)
+	if errors.Is(err, ErrRepaymentReversalTooLarge) {
+		return ErrInsufficientLedgerFund
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := updateLoanInstallments(tx, loan.Installments, reversal.Installments); err != nil {
+		return err
+	}
+
+	if reversal.PrincipalPaid > 0 {
+		if err := updateBalance(tx, IncreaseLoansOwedStatement, payment.CustomerID, reversal.PrincipalPaid); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ReverseLoanRepaymentStatement, payment.ReferenceNumber, reversal.PenaltyPaid, reversal.FeePaid, reversal.InterestPaid, reversal.PrincipalPaid, reversal.WaivedInterest); err != nil {
+		return err
+	}
+
+	if loan.Status == LoanRepaid && !reversal.Repaid {
+		if err := setLoanStatus(tx, loan.ID, LoanActive, LoanApplicationActive); err != nil {
+			return err
+		}
+	}
+
+	_, err = postJournal(tx, splitJournalEntry(journal, loansReceivableLedgerAccount(payment.CustomerID), loanRepaymentPortions(payment.CustomerID, reversal)))
+	return err
+}
+
+// releaseLoanRepaymentAmount gives back an amount that
+// holdLoanRepaymentAmount took, by paying it into the loan again. Loans
+// that have since been repaid some other way, or that now owe less than
+// the amount, can't take it back.
+func releaseLoanRepaymentAmount(tx *sql.Tx, payment PaystackTransactionInformation, journal JournalTransaction, amount Money) error {
+	repayment, loan, err := lockRepaymentLoan(tx, payment.ReferenceNumber)
+	if err != nil {
+		return err
+	}
+	if !loan.Repayable() {
+		return ErrLoanNotActive
+	}
+
+	allocation, err := allocateRepayment(loan, amount, time.Now(), repaymentThrough(repayment))
+	if err != nil {
+		return err
+	}
+
+	if _, err := postJournal(tx, splitJournalEntry(journal, loansReceivableLedgerAccount(payment.CustomerID), loanRepaymentPortions(payment.CustomerID, allocation))); err != nil {
+		return err
+	}
+
+	if err := updateLoanInstallments(tx, loan.Installments, allocation.Installments); err != nil {
+		return err
+	}
+
+	if allocation.PrincipalPaid > 0 {
+		if err := updateBalance(tx, DecreaseLoansOwedStatement, payment.CustomerID, allocation.PrincipalPaid); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(ReallocateLoanRepaymentStatement, payment.ReferenceNumber, allocation.PenaltyPaid, allocation.FeePaid, allocation.InterestPaid, allocation.PrincipalPaid, allocation.WaivedInterest); err != nil {
+		return err
+	}
+
+	if allocation.Repaid {
+		return setLoanStatus(tx, loan.ID, LoanRepaid, LoanApplicationRepaid)
+	}
+	return nil
+}
+
+func scanRefund(row scanner) (Refund, error) {
+	var refund Refund
+	err := row.Scan(&refund.ID, &refund.Reference, &refund.PaymentReference, &refund.Amount, &refund.Reason, &refund.InitiatedBy, &refund.Provider, &refund.ProviderRefundID, &refund.Status, &refund.Held, &refund.FailureReason, &refund.CreatedAt, &refund.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return refund, ErrRefundDoesNotExist
+	}
+	return refund, err
+}
+
+func (d *DB) CreateRefund(refund Refund) (Refund, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return refund, err
+	}
+	defer tx.Rollback()
+
+	payment, err := scanPayment(tx.QueryRow(LockPaymentStatement, refund.PaymentReference))
+	if err == sql.ErrNoRows {
+		return refund, ErrReferenceNumberDoesNotExist
+	}
+	if err != nil {
+		return refund, err
+	}
+
+	var refunded Money
+	if err := tx.QueryRow(GetRefundedAmountStatement, refund.PaymentReference).Scan(&refunded); err != nil {
+		return refund, err
+	}
+
+	if refunded+refund.Amount > payment.PaymentAmount {
+		return refund, ErrRefundTooLarge
+	}
+
+	// payments that were never fulfilled never made it into the ledger
+	held := payment.FulfillmentStatus == StatusSuccessful
+	if held {
+		account, err := paymentLedgerAccount(payment)
+		if err != nil {
+			return refund, err
+		}
+
+		if err := holdPaymentAmount(tx, payment, refundHoldJournal(refund.Reference.String(), account, refund.Amount), refund.Amount); err != nil {
+			return refund, err
+		}
+	}
+
+	saved, err := scanRefund(tx.QueryRow(CreateRefundStatement, refund.Reference, refund.PaymentReference, refund.Amount, refund.Reason, refund.InitiatedBy, refund.Provider, held))
+	if err != nil {
+		return refund, err
+	}
+
+	return saved, tx.Commit()
+}
+
+func (d *DB) GetRefunds(paymentReference uuid.UUID) ([]Refund, error) {
+	var refunds []Refund
+
+	rows, err := d.Conn.Query(GetRefundsStatement, paymentReference)
+	if err != nil {
+		return refunds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		refund, err := scanRefund(rows)
+		if err != nil {
+			return refunds, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+func (d *DB) GetPendingRefund(paymentReference uuid.UUID, amount Money) (Refund, error) {
+	return scanRefund(d.Conn.QueryRow(GetPendingRefundStatement, paymentReference, amount))
+}
+
+func (d *DB) MarkRefundSubmitted(reference uuid.UUID, providerRefundID string) error {
+	_, err := d.Conn.Exec(MarkRefundSubmittedStatement, reference, providerRefundID)
+	return err
+}
+
+func (d *DB) ProcessRefund(reference uuid.UUID) (bool, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	refund, err := scanRefund(tx.QueryRow(LockRefundStatement, reference))
+	if err != nil {
+		return false, err
+	}
+
+	if refund.Status != RefundPending {
+		return false, nil
+	}
+
+	if refund.Held {
+		if _, err := postJournal(tx, refundProcessedJournal(reference.String(), refund.Amount)); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(UpdateRefundStatusStatement, reference, RefundProcessed, ""); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (d *DB) FailRefund(reference uuid.UUID, reason string) (bool, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	refund, err := scanRefund(tx.QueryRow(LockRefundStatement, reference))
+	if err != nil {
+		return false, err
+	}
+
+	if refund.Status != RefundPending {
+		return false, nil
+	}
+
+	if refund.Held {
+		payment, err := scanPayment(tx.QueryRow(GetPaystackVerificationInformation, refund.PaymentReference))
+		if err != nil {
+			return false, err
+		}
+
+		account, err := paymentLedgerAccount(payment)
+		if err != nil {
+			return false, err
+		}
+
+		if err := releasePaymentAmount(tx, payment, refundFailedJournal(reference.String(), account, refund.Amount), refund.Amount); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(UpdateRefundStatusStatement, reference, RefundFailed, reason); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func scanDispute(row scanner) (Dispute, error) {
+	var dispute Dispute
+	var resolvedAt sql.NullTime
+	err := row.Scan(&dispute.ID, &dispute.Provider, &dispute.ProviderDisputeID, &dispute.PaymentReference, &dispute.Amount, &dispute.Reason, &dispute.Status, &dispute.Held, &dispute.CreatedAt, &resolvedAt)
+	if err == sql.ErrNoRows {
+		return dispute, ErrDisputeDoesNotExist
+	}
+	dispute.ResolvedAt = resolvedAt.Time
+	return dispute, err
+}
+
+// disputeKey identifies a dispute's journals
+func disputeKey(provider, providerDisputeID string) string {
+	return fmt.Sprintf("%s:%s", provider, providerDisputeID)
+}
+
+func (d *DB) OpenDispute(dispute Dispute) (Dispute, bool, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return dispute, false, err
+	}
+	defer tx.Rollback()
+
+	saved, err := scanDispute(tx.QueryRow(CreateDisputeStatement, dispute.Provider, dispute.ProviderDisputeID, dispute.PaymentReference, dispute.Amount, dispute.Reason))
+	if err == ErrDisputeDoesNotExist {
+		saved, err := scanDispute(tx.QueryRow(LockDisputeStatement, dispute.Provider, dispute.ProviderDisputeID))
+		return saved, false, err
+	}
+	if err != nil {
+		return dispute, false, err
+	}
+
+	payment, err := scanPayment(tx.QueryRow(LockPaymentStatement, dispute.PaymentReference))
+	if err != nil {
+		return saved, false, err
+	}
+
+	if payment.FulfillmentStatus == StatusSuccessful {
+		account, err := paymentLedgerAccount(payment)
+		if err != nil {
+			return saved, false, err
+		}
+
+		// the customer may have already taken the money out, in which
+		// case the dispute stays open without it
+		journal := disputeHoldJournal(disputeKey(dispute.Provider, dispute.ProviderDisputeID), account, saved.Amount)
+		err = holdPaymentAmount(tx, payment, journal, saved.Amount)
+		switch err {
+		case nil:
+			if _, err := tx.Exec(SetDisputeHeldStatement, saved.ID); err != nil {
+				return saved, false, err
+			}
+			saved.Held = true
+		case ErrInsufficientLedgerFund:
+		default:
+			return saved, false, err
+		}
+	}
+
+	return saved, true, tx.Commit()
+}
+
+func (d *DB) ResolveDispute(provider, providerDisputeID, status string) (bool, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	dispute, err := scanDispute(tx.QueryRow(LockDisputeStatement, provider, providerDisputeID))
+	if err != nil {
+		return false, err
+	}
+
+	if dispute.Status != DisputeOpen {
+		return false, nil
+	}
+
+	payment, err := scanPayment(tx.QueryRow(GetPaystackVerificationInformation, dispute.PaymentReference))
+	if err != nil {
+		return false, err
+	}
+
+	key := disputeKey(provider, providerDisputeID)
+	switch {
+	case status == DisputeWon && dispute.Held:
+		account, err := paymentLedgerAccount(payment)
+		if err != nil {
+			return false, err
+		}
+
+		if err := releasePaymentAmount(tx, payment, disputeWonJournal(key, account, dispute.Amount), dispute.Amount); err != nil {
+			return false, err
+		}
+	case status == DisputeLost && (dispute.Held || payment.FulfillmentStatus == StatusSuccessful):
+		// money that couldn't be held from the customer is a loss
+		if _, err := postJournal(tx, disputeLostJournal(key, dispute.Held, dispute.Amount)); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.Exec(ResolveDisputeStatement, provider, providerDisputeID, status); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (d *DB) GetDisputes(paymentReference uuid.UUID) ([]Dispute, error) {
+	var disputes []Dispute
+
+	rows, err := d.Conn.Query(GetDisputesStatement, paymentReference)
+	if err != nil {
+		return disputes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		dispute, err := scanDispute(rows)
+		if err != nil {
+			return disputes, err
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	return disputes, rows.Err()
+}
+
+func (d *DB) RecordAudit(entry AuditEntry) error {
+	_, err := d.Conn.Exec(RecordAuditStatement, entry.Actor, entry.Action, entry.Subject, entry.Detail)
+	return err
+}
+
+func (d *DB) GetAuditLog(subject string, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+
+	rows, err := d.Conn.Query(GetAuditLogStatement, subject, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.Subject, &entry.Detail, &entry.CreatedAt); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func scanLoan(row scanner) (Loan, error) {
+	var loan Loan
+	var disbursedAt, repaidAt sql.NullTime
+
+	err := row.Scan(&loan.ID, &loan.CustomerID, &loan.Principal, &loan.Status, &loan.InterestMethod, &loan.MonthlyRate, &loan.FeeRate, &loan.Frequency, &loan.DaysPastDue, &loan.DelinquencyBucket, &disbursedAt, &repaidAt, &loan.CreatedAt)
+	if err == sql.ErrNoRows {
+		return loan, ErrLoanDoesNotExist
+	}
+
+	loan.DisbursedAt = disbursedAt.Time
+	loan.RepaidAt = repaidAt.Time
+	return loan, err
+}
+
+func scanLoanRepayment(row scanner) (LoanRepayment, error) {
+	var repayment LoanRepayment
+	var allocatedAt sql.NullTime
+
+	err := row.Scan(&repayment.ID, &repayment.PaymentReference, &repayment.LoanID, &repayment.Kind, &repayment.InstallmentNumber, &repayment.Amount, &repayment.PenaltyPaid, &repayment.FeePaid, &repayment.InterestPaid, &repayment.PrincipalPaid, &repayment.WaivedInterest, &allocatedAt)
+	if err == sql.ErrNoRows {
+		return repayment, ErrLoanRepaymentDoesNotExist
+	}
+
+	repayment.AllocatedAt = allocatedAt.Time
+	return repayment, err
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func getLoanInstallments(q querier, loanID uint) ([]LoanInstallment, error) {
+	var installments []LoanInstallment
+
+	rows, err := q.Query(GetLoanInstallmentsStatement, loanID)
+	if err != nil {
+		return installments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var installment LoanInstallment
+		var paidAt, overdueAt, penaltyChargedThrough, lastRemindedAt sql.NullTime
+
+		if err := rows.Scan(&installment.ID, &installment.LoanID, &installment.Number, &installment.DueDate, &installment.PrincipalDue, &installment.InterestDue, &installment.FeeDue, &installment.PenaltyDue, &installment.PrincipalPaid, &installment.InterestPaid, &installment.FeePaid, &installment.PenaltyPaid, &paidAt, &overdueAt, &penaltyChargedThrough, &lastRemindedAt); err != nil {
+			return installments, err
+		}
+
+		installment.PaidAt = paidAt.Time
+		installment.OverdueAt = overdueAt.Time
+		installment.PenaltyChargedThrough = penaltyChargedThrough.Time
+		installment.LastRemindedAt = lastRemindedAt.Time
+		installments = append(installments, installment)
+	}
+
+	return installments, rows.Err()
+}
+
+func (d *DB) CreateLoan(loan Loan) (uint, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	loanID, err := createLoan(tx, loan)
+	if err != nil {
+		return 0, err
+	}
+
+	return loanID, tx.Commit()
+}
+
+func createLoan(tx *sql.Tx, loan Loan) (uint, error) {
+	disbursedAt := sql.NullTime{Time: loan.DisbursedAt, Valid: !loan.DisbursedAt.IsZero()}
+
+	var loanID uint
+	if err := tx.QueryRow(CreateLoanStatement, loan.CustomerID, loan.Principal, disbursedAt, loan.InterestMethod, loan.MonthlyRate, loan.FeeRate, loan.Frequency).Scan(&loanID); err != nil {
+		return 0, err
+	}
+
+	for _, installment := range loan.Installments {
+		if _, err := tx.Exec(CreateLoanInstallmentStatement, loanID, installment.Number, installment.DueDate, installment.PrincipalDue, installment.InterestDue, installment.FeeDue); err != nil {
+			return 0, err
+		}
+	}
+
+	return loanID, nil
+}
+
+func (d *DB) GetActiveLoan(customerID uint) (Loan, error) {
+	loan, err := scanLoan(d.Conn.QueryRow(GetActiveLoanStatement, customerID))
+	if err != nil {
+		return loan, err
+	}
+
+	loan.Installments, err = getLoanInstallments(d.Conn, loan.ID)
+	return loan, err
+}
+
+func (d *DB) GetLoanRepayments(loanID uint) ([]LoanRepayment, error) {
+	var repayments []LoanRepayment
+
+	rows, err := d.Conn.Query(GetLoanRepaymentsStatement, loanID)
+	if err != nil {
+		return repayments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		repayment, err := scanLoanRepayment(rows)
+		if err != nil {
+			return repayments, err
+		}
+		repayments = append(repayments, repayment)
+	}
+
+	return repayments, rows.Err()
+}
+
+// CreateLoanRepayment makes the pending payment and records what it is
+// for, so that it can be shared out when the payment's webhook arrives
+func (d *DB) CreateLoanRepayment(customerID uint, repayment LoanRepayment, provider string) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(CreatePaymentProcessorPendingTransaction, customerID, repayment.LoanID, repayment.PaymentReference, OriginatorLoanRepayment, repayment.Amount, provider); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(CreateLoanRepaymentStatement, repayment.PaymentReference, repayment.LoanID, repayment.Kind, repayment.InstallmentNumber, repayment.Amount); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanLoanApplication(row scanner) (LoanApplication, error) {
+	var application LoanApplication
+	var reviewedAt sql.NullTime
+	var reasons []byte
+
+	err := row.Scan(&application.ID, &application.CustomerID, &application.Amount, &application.DurationInDays, &application.BVN, &application.BankAccountID, &application.InterestMethod, &application.MonthlyRate, &application.FeeRate, &application.Frequency,
+		&application.Credit.Score, &application.Credit.MaxAmount, &application.Credit.MaxTenorDays, &reasons, &application.GuarantorsRequired, &application.GuarantorsAccepted, &application.Status, &application.DecisionNote, &application.ReviewedBy, &reviewedAt, &application.LoanID, &application.CreatedAt, &application.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return application, ErrLoanApplicationDoesNotExist
+	}
+	if err != nil {
+		return application, err
+	}
+
+	application.ReviewedAt = reviewedAt.Time
+	return application, json.Unmarshal(reasons, &application.Credit.Reasons)
+}
+
+func (d *DB) CreateLoanApplication(application LoanApplication) (uint, error) {
+	var id uint
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return id, err
+	}
+	defer tx.Rollback()
+
+	var accountID uint
+	err = tx.QueryRow(GetLoansAccountIDStatement, application.CustomerID).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		return id, ErrAccountDoesNotExist
+	}
+	if err != nil {
+		return id, err
+	}
+
+	var bvn string
+	err = tx.QueryRow(GetBVNStatement, application.CustomerID).Scan(&bvn)
+	switch {
+	case err == sql.ErrNoRows && application.BVN == "":
+		return id, ErrBVNRequired
+	case err == sql.ErrNoRows:
+		if err := validateBVN(application.BVN); err != nil {
+			return id, err
+		}
+
+		result, err := tx.Exec(SaveBVNStatement, application.CustomerID, application.BVN)
+		if err != nil {
+			return id, err
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+			return id, ErrBVNInUse
+		}
+	case err != nil:
+		return id, err
+	default:
+		application.BVN = bvn
+	}
+
+	reasons, err := json.Marshal(append([]CreditReason{}, application.Credit.Reasons...))
+	if err != nil {
+		return id, err
+	}
+
+	err = tx.QueryRow(CreateLoanApplicationStatement, accountID, application.Amount, application.DurationInDays, application.BVN, application.BankAccountID, application.InterestMethod, application.MonthlyRate, application.FeeRate, application.Frequency,
+		application.Credit.Score, application.Credit.MaxAmount, application.Credit.MaxTenorDays, reasons, application.GuarantorsRequired).Scan(&id)
+	if err == sql.ErrNoRows {
+		return id, ErrLoanApplicationInProgress
+	}
+	if err != nil {
+		return id, err
+	}
+
+	if _, err := insertLoanGuarantors(tx, id, application.Guarantors, customerActor(application.CustomerID)); err != nil {
+		return id, err
+	}
+
+	if statement := application.Statement; statement != nil {
+		analysis, err := json.Marshal(statement)
+		if err != nil {
+			return id, err
+		}
+		if _, err := tx.Exec(CreateLoanApplicationStatementStatement, id, statement.FileName, statement.Format, analysis); err != nil {
+			return id, err
+		}
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, customerActor(application.CustomerID), AuditLoanApplicationSubmitted, loanApplicationAuditSubject(id), fmt.Sprintf("%s over %d days, credit score %d", application.Amount, application.DurationInDays, application.Credit.Score)); err != nil {
+		return id, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (d *DB) GetLoanApplication(id uint) (LoanApplication, error) {
+	return scanLoanApplication(d.Conn.QueryRow(GetLoanApplicationStatement, id))
+}
+
+func (d *DB) GetLoanApplications(filter AdminQueueFilter) ([]LoanApplication, error) {
+	return d.queryLoanApplications(GetLoanApplicationsStatement, filter.Status, filter.Sort, filter.Limit(), filter.Offset())
+}
+
+func (d *DB) GetCustomerLoanApplications(customerID uint) ([]LoanApplication, error) {
+	return d.queryLoanApplications(GetCustomerLoanApplicationsStatement, customerID)
+}
+
+func (d *DB) queryLoanApplications(query string, args ...any) ([]LoanApplication, error) {
+	var applications []LoanApplication
+
+	rows, err := d.Conn.Query(query, args...)
+	if err != nil {
+		return applications, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		application, err := scanLoanApplication(rows)
+		if err != nil {
+			return applications, err
+		}
+		applications = append(applications, application)
+	}
+
+	return applications, rows.Err()
+}
+
+func (d *DB) GetBVN(customerID uint) (string, error) {
+	var bvn string
+
+	err := d.Conn.QueryRow(GetBVNStatement, customerID).Scan(&bvn)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return bvn, err
+}
+
+func (d *DB) TransitionLoanApplication(id uint, status string, reviewer uint, note string) (LoanApplication, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return LoanApplication{}, err
+	}
+	defer tx.Rollback()
+
+	application, err := scanLoanApplication(tx.QueryRow(LockLoanApplicationStatement, id))
+	if err != nil {
+		return application, err
+	}
+
+	if application, err = transitionLoanApplication(tx, application, status, reviewer, note); err != nil {
+		return application, err
+	}
+
+	return application, tx.Commit()
+}
+
+// transitionLoanApplication moves a locked application to status and
+// records it in the audit log. A reviewer of 0 is the system.
+func transitionLoanApplication(tx *sql.Tx, application LoanApplication, status string, reviewer uint, note string) (LoanApplication, error) {
+	if !canTransitionLoanApplication(application.Status, status) {
+		return application, fmt.Errorf("%w: %s to %s", ErrLoanApplicationTransition, application.Status, status)
+	}
+
+	if status == LoanApplicationRejected && note == "" {
+		return application, ErrLoanApplicationNoteRequired
+	}
+
+	if status == LoanApplicationApproved && !application.HasGuarantorConsent() {
+		return application, ErrGuarantorConsentRequired
+	}
+
+	actor := ActorSystem
+	reviewedBy := sql.NullInt64{}
+	if reviewer != 0 {
+		actor = adminActor(reviewer)
+		reviewedBy = sql.NullInt64{Int64: int64(reviewer), Valid: true}
+	}
+
+	if _, err := tx.Exec(TransitionLoanApplicationStatement, application.ID, status, note, reviewedBy, application.Status); err != nil {
+		return application, err
+	}
+
+	detail := fmt.Sprintf("%s to %s", application.Status, status)
+	if note != "" {
+		detail = fmt.Sprintf("%s: %s", detail, note)
+	}
+	if _, err := tx.Exec(RecordAuditStatement, actor, AuditLoanApplicationStatus, loanApplicationAuditSubject(application.ID), detail); err != nil {
+		return application, err
+	}
+
+	application.Status = status
+	if note != "" {
+		application.DecisionNote = note
+	}
+	if reviewer != 0 {
+		application.ReviewedBy = reviewer
+		application.ReviewedAt = time.Now()
+	}
+	return application, nil
+}
+
+func (d *DB) GetActiveLoanIDs() ([]uint, error) {
+	var ids []uint
+
+	rows, err := d.Conn.Query(GetActiveLoanIDsStatement)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// AssessLoanDelinquency holds the loan's lock while it is assessed, so
+// that penalties are charged on what is overdue after any repayment
+// that is being shared out
+func (d *DB) AssessLoanDelinquency(loanID uint, policy LoanPenaltyPolicy, today time.Time) (LoanDelinquency, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return LoanDelinquency{}, err
+	}
+	defer tx.Rollback()
+
+	loan, err := scanLoan(tx.QueryRow(LockLoanStatement, loanID))
+	if err != nil {
+		return LoanDelinquency{}, err
+	}
+
+	if loan.Installments, err = getLoanInstallments(tx, loan.ID); err != nil {
+		return LoanDelinquency{}, err
+	}
+
+	delinquency := assessDelinquency(loan, policy, today)
+
+	for _, installment := range delinquency.Changed {
+		overdueAt := sql.NullTime{Time: installment.OverdueAt, Valid: !installment.OverdueAt.IsZero()}
+		chargedThrough := sql.NullTime{Time: installment.PenaltyChargedThrough, Valid: !installment.PenaltyChargedThrough.IsZero()}
+
+		if _, err := tx.Exec(MarkLoanInstallmentOverdueStatement, installment.ID, installment.PenaltyDue, overdueAt, chargedThrough); err != nil {
+			return delinquency, err
+		}
+	}
+
+	if delinquency.Loan.DaysPastDue != loan.DaysPastDue || delinquency.Escalated() {
+		if _, err := tx.Exec(UpdateLoanDelinquencyStatement, loan.ID, delinquency.Loan.DaysPastDue, delinquency.Loan.DelinquencyBucket); err != nil {
+			return delinquency, err
+		}
+	}
+
+	if delinquency.Escalated() {
+		detail := fmt.Sprintf("%s to %s, %d days past due", delinquency.PreviousBucket, delinquency.Loan.DelinquencyBucket, delinquency.Loan.DaysPastDue)
+		if _, err := tx.Exec(RecordAuditStatement, ActorSystem, AuditLoanDelinquency, loanAuditSubject(loan.ID), detail); err != nil {
+			return delinquency, err
+		}
+	}
+
+	if delinquency.Defaulted {
+		if err := defaultLoan(tx, delinquency.Loan); err != nil {
+			return delinquency, err
+		}
+	}
+
+	return delinquency, tx.Commit()
+}
+
+// defaultLoan marks a loan, and the application it was made for,
+// defaulted. It can still be repaid.
+func defaultLoan(tx *sql.Tx, loan Loan) error {
+	if _, err := tx.Exec(DefaultLoanStatement, loan.ID); err != nil {
+		return err
+	}
+
+	detail := fmt.Sprintf("%d days past due with %s owed", loan.DaysPastDue, loan.Outstanding())
+	if _, err := tx.Exec(RecordAuditStatement, ActorSystem, AuditLoanDefaulted, loanAuditSubject(loan.ID), detail); err != nil {
+		return err
+	}
+
+	// loans made before applications were tracked have none
+	application, err := scanLoanApplication(tx.QueryRow(LockLoanApplicationByLoanStatement, loan.ID))
+	if err == nil {
+		_, err = transitionLoanApplication(tx, application, LoanApplicationDefaulted, 0, fmt.Sprintf("more than %d days late", loanDefaultDays))
+	}
+	if err != nil && err != ErrLoanApplicationDoesNotExist {
+		return err
+	}
+	return nil
+}
+
+func (d *DB) GetCustomerContact(customerID uint) (CustomerContact, error) {
+	var contact CustomerContact
+
+	err := d.Conn.QueryRow(GetCustomerContactStatement, customerID).Scan(&contact.FirstName, &contact.Email, &contact.PhoneNumber)
+	if err == sql.ErrNoRows {
+		return contact, ErrAccountDoesNotExist
+	}
+	return contact, err
+}
+
+func (d *DB) MarkLoanReminderSent(installmentID uint, at time.Time) error {
+	_, err := d.Conn.Exec(MarkLoanReminderSentStatement, installmentID, at)
+	return err
+}
+
+func (d *DB) GetOverdueLoans(bucket string, limit int) ([]OverdueLoan, error) {
+	var loans []OverdueLoan
+
+	rows, err := d.Conn.Query(GetOverdueLoansStatement, bucket, limit)
+	if err != nil {
+		return loans, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loan OverdueLoan
+		var disbursedAt, repaidAt sql.NullTime
+
+		if err := rows.Scan(&loan.ID, &loan.CustomerID, &loan.Principal, &loan.Status, &loan.InterestMethod, &loan.MonthlyRate, &loan.FeeRate, &loan.Frequency, &loan.DaysPastDue, &loan.DelinquencyBucket, &disbursedAt, &repaidAt, &loan.CreatedAt,
+			&loan.Contact.FirstName, &loan.Contact.Email, &loan.Contact.PhoneNumber, &loan.Owed, &loan.Overdue); err != nil {
+			return loans, err
+		}
+
+		loan.DisbursedAt = disbursedAt.Time
+		loan.RepaidAt = repaidAt.Time
+		loans = append(loans, loan)
+	}
+
+	return loans, rows.Err()
+}
+
+func (d *DB) GetCreditSignals(customerID uint) (CreditSignals, error) {
+	var signals CreditSignals
+
+	err := d.Conn.QueryRow(GetCreditSignalsStatement, customerID).Scan(&signals.DateJoined, &signals.EmailVerified, &signals.HasPhoneNumber, &signals.HasDateOfBirth, &signals.HasAddress,
+		&signals.SavingsBalance, &signals.SavingsMonths, &signals.BVNOnFile, &signals.BVNVerified, &signals.LoansRepaid, &signals.LoansDefaulted, &signals.WorstDaysLate)
+	if err == sql.ErrNoRows {
+		return signals, ErrAccountDoesNotExist
+	}
+	return signals, err
+}
+
+func (d *DB) GetLoanApplicationStatement(applicationID uint) (BankStatementAnalysis, error) {
+	var analysis BankStatementAnalysis
+	var contents []byte
+
+	err := d.Conn.QueryRow(GetLoanApplicationStatementStatement, applicationID).Scan(&analysis.FileName, &analysis.Format, &contents)
+	if err == sql.ErrNoRows {
+		return analysis, ErrBankStatementNotFound
+	}
+	if err != nil {
+		return analysis, err
+	}
+
+	return analysis, json.Unmarshal(contents, &analysis)
+}
+
+func scanLoanGuarantor(row scanner) (LoanGuarantor, error) {
+	var guarantor LoanGuarantor
+	var respondedAt sql.NullTime
+
+	err := row.Scan(&guarantor.ID, &guarantor.ApplicationID, &guarantor.Contact, &guarantor.Token, &guarantor.Status, &guarantor.CustomerID, &guarantor.Hold, &respondedAt, &guarantor.CreatedAt)
+	if err == sql.ErrNoRows {
+		return guarantor, ErrGuaranteeDoesNotExist
+	}
+
+	guarantor.RespondedAt = respondedAt.Time
+	return guarantor, err
+}
+
+func scanLoanGuarantee(row scanner) (LoanGuarantee, error) {
+	var guarantee LoanGuarantee
+	var respondedAt sql.NullTime
+
+	err := row.Scan(&guarantee.ID, &guarantee.ApplicationID, &guarantee.Contact, &guarantee.Token, &guarantee.Status, &guarantee.CustomerID, &guarantee.Hold, &respondedAt, &guarantee.CreatedAt,
+		&guarantee.ApplicantID, &guarantee.ApplicantName, &guarantee.Amount, &guarantee.DurationInDays, &guarantee.ApplicationStatus)
+	if err == sql.ErrNoRows {
+		return guarantee, ErrGuaranteeDoesNotExist
+	}
+
+	guarantee.RespondedAt = respondedAt.Time
+	return guarantee, err
+}
+
+// insertLoanGuarantors nominates guarantors for an application, each
+// with the token for their invitation
+func insertLoanGuarantors(tx *sql.Tx, applicationID uint, contacts []string, actor string) ([]LoanGuarantor, error) {
+	var guarantors []LoanGuarantor
+
+	for _, contact := range contacts {
+		guarantor, err := scanLoanGuarantor(tx.QueryRow(CreateLoanGuarantorStatement, applicationID, contact, uuid.NewString()))
+		if err == ErrGuaranteeDoesNotExist {
+			return guarantors, ErrGuarantorNominated
+		}
+		if err != nil {
+			return guarantors, err
+		}
+
+		if _, err := tx.Exec(RecordAuditStatement, actor, AuditLoanGuarantorInvited, loanApplicationAuditSubject(applicationID), fmt.Sprintf("guarantor %d was nominated", guarantor.ID)); err != nil {
+			return guarantors, err
+		}
+		guarantors = append(guarantors, guarantor)
+	}
+
+	return guarantors, nil
+}
+
+func (d *DB) AddLoanGuarantors(customerID, applicationID uint, contacts []string) ([]LoanGuarantor, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	application, err := scanLoanApplication(tx.QueryRow(LockLoanApplicationStatement, applicationID))
+	if err != nil {
+		return nil, err
+	}
+	if application.CustomerID != customerID {
+		return nil, ErrLoanApplicationDoesNotExist
+	}
+	if application.Status != LoanApplicationSubmitted && application.Status != LoanApplicationUnderReview {
+		return nil, ErrGuarantorsClosed
+	}
+
+	existing, err := d.queryLoanGuarantors(tx, applicationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing)+len(contacts) > maxGuarantors {
+		return nil, ErrTooManyGuarantors
+	}
+
+	guarantors, err := insertLoanGuarantors(tx, applicationID, contacts, customerActor(customerID))
+	if err != nil {
+		return nil, err
+	}
+
+	return guarantors, tx.Commit()
+}
+
+func (d *DB) GetLoanGuarantors(applicationID uint) ([]LoanGuarantor, error) {
+	return d.queryLoanGuarantors(d.Conn, applicationID)
+}
+
+func (d *DB) queryLoanGuarantors(q querier, applicationID uint) ([]LoanGuarantor, error) {
+	var guarantors []LoanGuarantor
+
+	rows, err := q.Query(GetLoanGuarantorsStatement, applicationID)
+	if err != nil {
+		return guarantors, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		guarantor, err := scanLoanGuarantor(rows)
+		if err != nil {
+			return guarantors, err
+		}
+		guarantors = append(guarantors, guarantor)
+	}
+
+	return guarantors, rows.Err()
+}
+
+func (d *DB) GetLoanGuarantee(token string) (LoanGuarantee, error) {
+	return scanLoanGuarantee(d.Conn.QueryRow(GetLoanGuaranteeStatement, token))
+}
+
+func (d *DB) GetOpenLoanGuarantees(contacts []string) ([]LoanGuarantee, error) {
+	var guarantees []LoanGuarantee
+
+	rows, err := d.Conn.Query(GetOpenLoanGuaranteesStatement, pq.Array(contacts))
+	if err != nil {
+		return guarantees, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		guarantee, err := scanLoanGuarantee(rows)
+		if err != nil {
+			return guarantees, err
+		}
+		if guarantee.Open() {
+			guarantees = append(guarantees, guarantee)
+		}
+	}
+
+	return guarantees, rows.Err()
+}
+
+func (d *DB) RespondToLoanGuarantee(token string, customerID uint, accept bool, hold Money) (LoanGuarantor, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return LoanGuarantor{}, err
+	}
+	defer tx.Rollback()
+
+	guarantee, err := scanLoanGuarantee(tx.QueryRow(LockLoanGuaranteeStatement, token))
+	if err != nil {
+		return guarantee.LoanGuarantor, err
+	}
+
+	var contact CustomerContact
+	if err := tx.QueryRow(GetCustomerContactStatement, customerID).Scan(&contact.FirstName, &contact.Email, &contact.PhoneNumber); err != nil {
+		return guarantee.LoanGuarantor, err
+	}
+
+	if err := checkGuaranteeResponse(guarantee, customerID, contact); err != nil {
+		return guarantee.LoanGuarantor, err
+	}
+
+	status := GuarantorDeclined
+	if accept {
+		status = GuarantorAccepted
+	} else {
+		hold = 0
+	}
+
+	if hold > 0 {
+		var balance, onHold Money
+		err := tx.QueryRow(LockSoloSavingsBalanceStatement, customerID).Scan(&balance)
+		if err == sql.ErrNoRows {
+			return guarantee.LoanGuarantor, ErrHoldTooLarge
+		}
+		if err != nil {
+			return guarantee.LoanGuarantor, err
+		}
+		if err := tx.QueryRow(GetSoloSavingsOnHoldStatement, customerID).Scan(&onHold); err != nil {
+			return guarantee.LoanGuarantor, err
+		}
+		if hold > balance-onHold {
+			return guarantee.LoanGuarantor, ErrHoldTooLarge
+		}
+	}
+
+	if _, err := tx.Exec(RespondToLoanGuarantorStatement, guarantee.ID, status, customerID, hold); err != nil {
+		return guarantee.LoanGuarantor, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, customerActor(customerID), AuditLoanGuarantorResponded, loanApplicationAuditSubject(guarantee.ApplicationID), fmt.Sprintf("guarantor %d: %s, with %s on hold", guarantee.ID, status, hold)); err != nil {
+		return guarantee.LoanGuarantor, err
+	}
+
+	guarantee.Status = status
+	guarantee.CustomerID = customerID
+	guarantee.Hold = hold
+	guarantee.RespondedAt = time.Now()
+	return guarantee.LoanGuarantor, tx.Commit()
+}
+
+func scanInvestmentProduct(row scanner) (InvestmentProduct, error) {
+	var product InvestmentProduct
+	var tenors []int64
+
+	err := row.Scan(&product.ID, &product.Name, &product.AnnualRate, &product.MinimumAmount, pq.Array(&tenors), &product.Active, &product.CreatedAt)
+	if err == sql.ErrNoRows {
+		return product, ErrInvestmentProductDoesNotExist
+	}
+
+	for _, tenor := range tenors {
+		product.Tenors = append(product.Tenors, uint64(tenor))
+	}
+	return product, err
+}
+
+func (d *DB) GetInvestmentProducts(activeOnly bool) ([]InvestmentProduct, error) {
+	rows, err := d.Conn.Query(GetInvestmentProductsStatement, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []InvestmentProduct
+	for rows.Next() {
+		product, err := scanInvestmentProduct(rows)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+func (d *DB) GetInvestmentProduct(id uint) (InvestmentProduct, error) {
+	return scanInvestmentProduct(d.Conn.QueryRow(GetInvestmentProductStatement, id))
+}
+
+func (d *DB) CreateInvestmentProduct(product InvestmentProduct, adminID uint) (uint, error) {
+	if err := product.Validate(); err != nil {
+		return 0, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	tenors := make([]int64, 0, len(product.Tenors))
+	for _, tenor := range product.Tenors {
+		tenors = append(tenors, int64(tenor))
+	}
+
+	var id uint
+	err = tx.QueryRow(CreateInvestmentProductStatement, product.Name, product.AnnualRate, product.MinimumAmount, pq.Array(tenors)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvestmentProductExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), AuditInvestmentProduct, investmentProductAuditSubject(id), fmt.Sprintf("created %q at %s a year from %s for %v days", product.Name, product.RatePercent(), product.MinimumAmount, product.Tenors)); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (d *DB) SetInvestmentProductActive(id uint, active bool, adminID uint) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(SetInvestmentProductActiveStatement, id, active)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		return ErrInvestmentProductDoesNotExist
+	}
+
+	detail := "stopped offering it"
+	if active {
+		detail = "offered it again"
+	}
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), AuditInvestmentProduct, investmentProductAuditSubject(id), detail); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanInvestmentApplication(row scanner) (InvestmentApplication, error) {
+	var application InvestmentApplication
+	var dateOfEmployment, reviewedAt, submittedAt sql.NullTime
+
+	err := row.Scan(&application.ID, &application.CustomerID, &application.CustomerName, &application.ProductID, &application.ProductName, &application.Amount, &application.TenorInDays,
+		&application.EmploymentStatus, &dateOfEmployment, &application.EmployerName, &application.TIN, &application.BankAccountName, &application.BankAccountNumber,
+		&application.Status, &application.DecisionNote, &application.ReviewedBy, &reviewedAt, &submittedAt, &application.PositionID, &application.CreatedAt, &application.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return application, ErrInvestmentApplicationDoesNotExist
+	}
+
+	application.DateOfEmployment = dateOfEmployment.Time
+	application.ReviewedAt = reviewedAt.Time
+	application.SubmittedAt = submittedAt.Time
+	return application, err
+}
+
+func (d *DB) queryInvestmentApplications(statement string, args ...any) ([]InvestmentApplication, error) {
+	rows, err := d.Conn.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var applications []InvestmentApplication
+	for rows.Next() {
+		application, err := scanInvestmentApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+
+	return applications, rows.Err()
+}
+
+func (d *DB) GetInvestmentApplication(id uint) (InvestmentApplication, error) {
+	return scanInvestmentApplication(d.Conn.QueryRow(GetInvestmentApplicationStatement, id))
+}
+
+func (d *DB) GetInvestmentApplications(filter AdminQueueFilter) ([]InvestmentApplication, error) {
+	return d.queryInvestmentApplications(GetInvestmentApplicationsStatement, filter.Status, filter.Sort, filter.Limit(), filter.Offset())
+}
+
+func (d *DB) GetCustomerInvestmentApplications(customerID uint) ([]InvestmentApplication, error) {
+	return d.queryInvestmentApplications(GetCustomerInvestmentApplicationsStatement, customerID)
+}
+
+func (d *DB) GetInvestmentApplicationDraft(customerID uint) (InvestmentApplication, error) {
+	return scanInvestmentApplication(d.Conn.QueryRow(GetInvestmentApplicationDraftStatement, customerID))
+}
+
+func (d *DB) SaveInvestmentApplicationDraft(application InvestmentApplication) (uint, error) {
+	dateOfEmployment := sql.NullTime{Time: application.DateOfEmployment, Valid: !application.DateOfEmployment.IsZero()}
+
+	var id uint
+	err := d.Conn.QueryRow(SaveInvestmentApplicationDraftStatement, application.CustomerID, application.EmploymentStatus, dateOfEmployment, application.EmployerName, application.TenorInDays,
+		application.TIN, application.BankAccountName, application.BankAccountNumber, application.Amount, application.ProductID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return id, fmt.Errorf("customer %d doesn't have an investment account", application.CustomerID)
+	}
+	return id, err
+}
+
+func (d *DB) SubmitInvestmentApplication(customerID uint) (InvestmentApplication, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return InvestmentApplication{}, err
+	}
+	defer tx.Rollback()
+
+	application, err := scanInvestmentApplication(tx.QueryRow(LockInvestmentApplicationDraftStatement, customerID))
+	if err != nil {
+		return application, err
+	}
+
+	var waiting bool
+	if err := tx.QueryRow(HasWaitingInvestmentApplicationStatement, customerID).Scan(&waiting); err != nil {
+		return application, err
+	}
+	if waiting {
+		return application, ErrInvestmentApplicationWaiting
+	}
+
+	product, err := scanInvestmentProduct(tx.QueryRow(GetInvestmentProductStatement, application.ProductID))
+	if err != nil && err != ErrInvestmentProductDoesNotExist {
+		return application, err
+	}
+	if problems := investmentApplicationProblems(application, product); len(problems) > 0 {
+		return application, ErrInvestmentApplicationIncomplete
+	}
+
+	if _, err := tx.Exec(SubmitInvestmentApplicationStatement, application.ID); err != nil {
+		return application, err
+	}
+	application.Status = InvestmentApplicationPending
+
+	if _, err := tx.Exec(RecordAuditStatement, customerActor(customerID), AuditInvestmentApplicationSubmitted, investmentApplicationAuditSubject(application.ID), fmt.Sprintf("applied to invest %s in %s for %d days", application.Amount, product.Name, application.TenorInDays)); err != nil {
+		return application, err
+	}
+
+	return application, tx.Commit()
+}
+
+func (d *DB) RejectInvestmentApplication(id, adminID uint, note string) (InvestmentApplication, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return InvestmentApplication{}, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return InvestmentApplication{}, err
+	}
+	defer tx.Rollback()
+
+	application, err := scanInvestmentApplication(tx.QueryRow(LockInvestmentApplicationStatement, id))
+	if err != nil {
+		return application, err
+	}
+	if application.Status != InvestmentApplicationPending {
+		return application, ErrInvestmentApplicationDecided
+	}
+
+	if _, err := tx.Exec(DecideInvestmentApplicationStatement, id, InvestmentApplicationRejected, note, adminID); err != nil {
+		return application, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), AuditInvestmentApplicationRejected, investmentApplicationAuditSubject(id), note); err != nil {
+		return application, err
+	}
+
+	application.Status = InvestmentApplicationRejected
+	application.DecisionNote = note
+	return application, tx.Commit()
+}
+
+func (d *DB) ApproveInvestmentApplication(id, adminID uint, note string) (InvestmentApplication, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return InvestmentApplication{}, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return InvestmentApplication{}, err
+	}
+	defer tx.Rollback()
+
+	application, err := scanInvestmentApplication(tx.QueryRow(LockInvestmentApplicationStatement, id))
+	if err != nil {
+		return application, err
+	}
+	if application.Status != InvestmentApplicationPending {
+		return application, ErrInvestmentApplicationDecided
+	}
+
+	product, err := scanInvestmentProduct(tx.QueryRow(GetInvestmentProductStatement, application.ProductID))
+	if err != nil {
+		return application, err
+	}
+	if _, err := quoteInvestment(product, application.Amount, application.TenorInDays, time.Now()); err != nil {
+		return application, err
+	}
+
+	if _, err := tx.Exec(DecideInvestmentApplicationStatement, id, InvestmentApplicationApproved, note, adminID); err != nil {
+		return application, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), AuditInvestmentApplicationApproved, investmentApplicationAuditSubject(id), fmt.Sprintf("approved %s in %s for %d days, to be paid for: %s", application.Amount, product.Name, application.TenorInDays, note)); err != nil {
+		return application, err
+	}
+
+	application.Status = InvestmentApplicationApproved
+	application.DecisionNote = note
+	return application, tx.Commit()
+}
+
+// openInvestmentPosition opens the position an application asked for
+// on start, at its product's rate then, paid for out of the customer's
+// investment balance
+func openInvestmentPosition(tx *sql.Tx, application InvestmentApplication, start time.Time) (InvestmentPosition, error) {
+	var position InvestmentPosition
+
+	product, err := scanInvestmentProduct(tx.QueryRow(GetInvestmentProductStatement, application.ProductID))
+	if err != nil {
+		return position, err
+	}
+	if !product.Active {
+		return position, ErrInvestmentProductInactive
+	}
+
+	quote, err := quoteInvestment(product, application.Amount, application.TenorInDays, start)
+	if err != nil {
+		return position, err
+	}
+
+	position = InvestmentPosition{
+		CustomerID:    application.CustomerID,
+		ProductID:     product.ID,
+		ProductName:   product.Name,
+		ApplicationID: application.ID,
+		Principal:     quote.Amount,
+		AnnualRate:    product.AnnualRate,
+		TenorInDays:   quote.TenorInDays,
+		StartDate:     calendarDay(start),
+		MaturityDate:  quote.MaturityDate,
+		Status:        InvestmentPositionActive,
+	}
+	if position.ID, err = insertInvestmentPosition(tx, position); err != nil {
+		return position, err
+	}
+
+	journal := transferJournal(fmt.Sprintf("INVESTMENT_POSITION:%d:OPENED", position.ID), investmentLedgerAccount(position.CustomerID), investmentPositionLedgerAccount(position.CustomerID, position.ID), position.Principal)
+	if _, err := postJournal(tx, journal); err != nil {
+		return position, err
+	}
+	if err := updateBalance(tx, DebitInvestmentBalanceStatement, position.CustomerID, position.Principal); err != nil {
+		return position, err
+	}
+
+	return position, nil
+}
+
+func insertInvestmentPosition(tx *sql.Tx, position InvestmentPosition) (uint, error) {
+	var id uint
+	err := tx.QueryRow(CreateInvestmentPositionStatement, position.CustomerID, position.ProductID, position.ApplicationID, position.RolledOverFrom, position.Principal, position.AnnualRate, position.TenorInDays, position.StartDate, position.MaturityDate, position.Rollover).Scan(&id)
+	return id, err
+}
+
+func scanInvestmentPosition(row scanner) (InvestmentPosition, error) {
+	var position InvestmentPosition
+	var maturedAt sql.NullTime
+
+	err := row.Scan(&position.ID, &position.CustomerID, &position.ProductID, &position.ProductName, &position.ApplicationID, &position.RolledOverFrom, &position.Principal, &position.AnnualRate, &position.TenorInDays,
+		&position.StartDate, &position.MaturityDate, &position.Status, &position.Rollover, &position.Return, &maturedAt)
+	if err == sql.ErrNoRows {
+		return position, ErrInvestmentPositionDoesNotExist
+	}
+
+	position.MaturedAt = maturedAt.Time
+	return position, err
+}
+
+func (d *DB) GetCustomerInvestmentPositions(customerID uint) ([]InvestmentPosition, error) {
+	rows, err := d.Conn.Query(GetCustomerInvestmentPositionsStatement, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []InvestmentPosition
+	for rows.Next() {
+		position, err := scanInvestmentPosition(rows)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+
+	return positions, rows.Err()
+}
+
+func (d *DB) SetInvestmentRollover(customerID, positionID uint, rollover bool) error {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	position, err := scanInvestmentPosition(tx.QueryRow(LockInvestmentPositionStatement, positionID))
+	if err != nil {
+		return err
+	}
+	if position.CustomerID != customerID {
+		return ErrInvestmentPositionDoesNotExist
+	}
+	if position.Status != InvestmentPositionActive {
+		return ErrInvestmentPositionEnded
+	}
+
+	if _, err := tx.Exec(SetInvestmentRolloverStatement, positionID, customerID, rollover); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, customerActor(customerID), AuditInvestmentRollover, investmentPositionAuditSubject(positionID), fmt.Sprintf("rollover %t", rollover)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (d *DB) GetMaturedInvestmentPositionIDs(on time.Time) ([]uint, error) {
+	rows, err := d.Conn.Query(GetMaturedInvestmentPositionIDsStatement, calendarDay(on))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (d *DB) MatureInvestmentPosition(id uint, today time.Time) (InvestmentMaturity, error) {
+	var maturity InvestmentMaturity
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return maturity, err
+	}
+	defer tx.Rollback()
+
+	position, err := scanInvestmentPosition(tx.QueryRow(LockInvestmentPositionStatement, id))
+	if err != nil {
+		return maturity, err
+	}
+	if position.Status != InvestmentPositionActive {
+		return maturity, ErrInvestmentPositionEnded
+	}
+	if !position.IsMatured(today) {
+		return maturity, fmt.Errorf("investment %d matures on %s", id, position.MaturityDate.Format("2006-01-02"))
+	}
+
+	product, err := scanInvestmentProduct(tx.QueryRow(GetInvestmentProductStatement, position.ProductID))
+	if err != nil {
+		return maturity, err
+	}
+
+	maturity = matureInvestment(position, product, today)
+	matured := maturity.Position
+	account := investmentPositionLedgerAccount(matured.CustomerID, matured.ID)
+
+	if matured.Return > 0 {
+		if _, err := postJournal(tx, interestJournal(fmt.Sprintf("INVESTMENT_POSITION:%d:RETURN", matured.ID), account, matured.Return)); err != nil {
+			return maturity, err
+		}
+	}
+
+	var detail string
+	if next := maturity.RolledOverTo; next != nil {
+		if next.ID, err = insertInvestmentPosition(tx, *next); err != nil {
+			return maturity, err
+		}
+		if _, err := postJournal(tx, transferJournal(fmt.Sprintf("INVESTMENT_POSITION:%d:ROLLED_OVER", matured.ID), account, investmentPositionLedgerAccount(next.CustomerID, next.ID), next.Principal)); err != nil {
+			return maturity, err
+		}
+		detail = fmt.Sprintf("earned %s, rolled over into investment %d of %s", matured.Return, next.ID, next.Principal)
+	} else {
+		if _, err := postJournal(tx, transferJournal(fmt.Sprintf("INVESTMENT_POSITION:%d:PAID_OUT", matured.ID), account, soloSavingsLedgerAccount(matured.CustomerID), maturity.PaidOut)); err != nil {
+			return maturity, err
+		}
+		if err := updateBalance(tx, CreditSoloSavingsBalanceStatement, matured.CustomerID, maturity.PaidOut); err != nil {
+			return maturity, err
+		}
+		detail = fmt.Sprintf("earned %s, paid %s into solo savings", matured.Return, maturity.PaidOut)
+	}
+
+	if err := updateBalance(tx, MatureInvestmentPositionStatement, matured.ID, matured.Status, matured.Return, matured.MaturedAt); err != nil {
+		return maturity, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, ActorSystem, AuditInvestmentMatured, investmentPositionAuditSubject(matured.ID), detail); err != nil {
+		return maturity, err
+	}
+
+	return maturity, tx.Commit()
+}
+
+func scanAdminRoles(rows *sql.Rows) ([]AdminRole, error) {
+	var roles []AdminRole
+	defer rows.Close()
+
+	for rows.Next() {
+		var role AdminRole
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return roles, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (d *DB) GetAdminRoles() ([]AdminRole, error) {
+	rows, err := d.Conn.Query(GetAdminRolesStatement)
+	if err != nil {
+		return nil, err
+	}
+	return scanAdminRoles(rows)
+}
+
+// GetAdminPermissions is what the customer's roles give them. Admins
+// always have a role, as taking their last one away stops them being an
+// admin.
+func (d *DB) GetAdminPermissions(customerID uint) (AdminPermissions, error) {
+	rows, err := d.Conn.Query(GetAdminUserRolesStatement, customerID)
+	if err != nil {
+		return AdminPermissions{}, err
+	}
+
+	roles, err := scanAdminRoles(rows)
+	if err != nil {
+		return AdminPermissions{}, err
+	}
+	if len(roles) == 0 {
+		return AdminPermissions{}, ErrNotAdmin
+	}
+
+	return adminPermissionsFor(roles), nil
+}
+
+func (d *DB) GetAdmins() ([]AdminUser, error) {
+	var admins []AdminUser
+
+	rows, err := d.Conn.Query(GetAdminsStatement)
+	if err != nil {
+		return admins, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var admin AdminUser
+		if err := rows.Scan(&admin.CustomerID, &admin.Name, &admin.Email, pq.Array(&admin.Roles)); err != nil {
+			return admins, err
+		}
+		admins = append(admins, admin)
+	}
+
+	return admins, rows.Err()
+}
+
+func (d *DB) AssignAdminRoles(email string, roles []string, assignedBy uint) (AdminUser, error) {
+	admin := AdminUser{Roles: roles}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return admin, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(GetCustomerByEmailStatement, strings.ToLower(strings.TrimSpace(email))).Scan(&admin.CustomerID, &admin.Name, &admin.Email)
+	if err == sql.ErrNoRows {
+		return admin, ErrAccountDoesNotExist
+	}
+	if err != nil {
+		return admin, err
+	}
+
+	rows, err := tx.Query(GetAdminRolesStatement)
+	if err != nil {
+		return admin, err
+	}
+	known, err := scanAdminRoles(rows)
+	if err != nil {
+		return admin, err
+	}
+
+	if err := checkRoleAssignment(known, roles, admin.CustomerID == assignedBy); err != nil {
+		return admin, err
+	}
+
+	detail := "no roles, so they are no longer an admin"
+	if len(roles) == 0 {
+		if _, err := tx.Exec(DeleteAdminUserStatement, admin.CustomerID); err != nil {
+			return admin, err
+		}
+	} else {
+		var adminUserID uint
+		if err := tx.QueryRow(UpsertAdminUserStatement, admin.CustomerID).Scan(&adminUserID); err != nil {
+			return admin, err
+		}
+		if _, err := tx.Exec(ClearAdminUserRolesStatement, adminUserID); err != nil {
+			return admin, err
+		}
+		if _, err := tx.Exec(AssignAdminUserRolesStatement, adminUserID, pq.Array(roles), assignedBy); err != nil {
+			return admin, err
+		}
+		detail = strings.Join(roles, ", ")
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(assignedBy), AuditAdminRolesAssigned, adminAuditSubject(admin.CustomerID), detail); err != nil {
+		return admin, err
+	}
+
+	return admin, tx.Commit()
+}
+
+func scanCustomerAccount(row scanner) (CustomerAccount, error) {
+	var account CustomerAccount
+	var suspendedAt sql.NullTime
+
+	err := row.Scan(&account.ID, &account.FirstName, &account.LastName, &account.Email, &account.PhoneNumber, &account.EmailVerified, &account.DateJoined,
+		&suspendedAt, &account.SuspensionNote, pq.Array(&account.AdminRoles))
+	if err == sql.ErrNoRows {
+		return account, ErrAccountDoesNotExist
+	}
+	account.SuspendedAt = suspendedAt.Time
+	return account, err
+}
+
+func (d *DB) GetCustomerAccount(customerID uint) (CustomerAccount, error) {
+	return scanCustomerAccount(d.Conn.QueryRow(GetCustomerAccountStatement, customerID))
+}
+
+func (d *DB) SuspendCustomer(customerID, adminID uint, note string) (CustomerAccount, error) {
+	return d.setCustomerSuspended(customerID, adminID, true, note)
+}
+
+func (d *DB) ReinstateCustomer(customerID, adminID uint, note string) (CustomerAccount, error) {
+	return d.setCustomerSuspended(customerID, adminID, false, note)
+}
+
+func (d *DB) setCustomerSuspended(customerID, adminID uint, suspend bool, note string) (CustomerAccount, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return CustomerAccount{}, err
+	}
+	if suspend && customerID == adminID {
+		return CustomerAccount{}, ErrCantSuspendYourself
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return CustomerAccount{}, err
+	}
+	defer tx.Rollback()
+
+	account, err := scanCustomerAccount(tx.QueryRow(LockCustomerAccountStatement, customerID))
+	if err != nil {
+		return account, err
+	}
+	if account.Suspended() == suspend {
+		return account, nil
+	}
+
+	action := AuditCustomerReinstated
+	if suspend {
+		action = AuditCustomerSuspended
+		account.SuspendedAt = time.Now()
+		account.SuspensionNote = note
+		_, err = tx.Exec(SuspendCustomerStatement, customerID, account.SuspendedAt, note)
+	} else {
+		account.SuspendedAt = time.Time{}
+		account.SuspensionNote = ""
+		_, err = tx.Exec(ReinstateCustomerStatement, customerID)
+	}
+	if err != nil {
+		return account, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), action, customerAuditSubject(customerID), note); err != nil {
+		return account, err
+	}
+
+	return account, tx.Commit()
+}
+
+func scanAdminAction(row scanner) (AdminAction, error) {
+	var action AdminAction
+	var reviewedAt, executedAt sql.NullTime
+
+	err := row.Scan(&action.ID, &action.Kind, &action.Subject, &action.Summary, &action.Amount, &action.Payload, &action.Status, &action.Note, &action.ProposedBy, &action.ProposedAt,
+		&action.DecisionNote, &action.ReviewedBy, &reviewedAt, &action.FailureReason, &executedAt)
+	if err == sql.ErrNoRows {
+		return action, ErrAdminActionDoesNotExist
+	}
+	action.ReviewedAt = reviewedAt.Time
+	action.ExecutedAt = executedAt.Time
+	return action, err
+}
+
+func (d *DB) ProposeAdminAction(action AdminAction) (AdminAction, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return action, err
+	}
+	defer tx.Rollback()
+
+	// the payload is sent as text, which postgres reads as jsonb
+	proposed, err := scanAdminAction(tx.QueryRow(ProposeAdminActionStatement, action.Kind, action.Subject, action.Summary, action.Amount, string(action.Payload), action.Note, action.ProposedBy))
+	if err == ErrAdminActionDoesNotExist {
+		return action, ErrAdminActionPending
+	}
+	if err != nil {
+		return action, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(proposed.ProposedBy), AuditAdminActionProposed, adminActionAuditSubject(proposed.ID), fmt.Sprintf("%s: %s", proposed.Summary, proposed.Note)); err != nil {
+		return proposed, err
+	}
+
+	return proposed, tx.Commit()
+}
+
+func (d *DB) GetAdminAction(id uint) (AdminAction, error) {
+	return scanAdminAction(d.Conn.QueryRow(GetAdminActionStatement, id))
+}
+
+func (d *DB) GetAdminActions(filter AdminQueueFilter) ([]AdminAction, error) {
+	rows, err := d.Conn.Query(GetAdminActionsStatement, filter.Status, filter.Sort, filter.Limit(), filter.Offset())
+	if err != nil {
+		return nil, err
+	}
+	return scanAdminActions(rows)
+}
+
+func (d *DB) GetSubjectAdminActions(subject string) ([]AdminAction, error) {
+	rows, err := d.Conn.Query(GetSubjectAdminActionsStatement, subject)
+	if err != nil {
+		return nil, err
+	}
+	return scanAdminActions(rows)
+}
+
+func (d *DB) GetStaleApprovedAdminActions(approvedBefore time.Time, limit int) ([]AdminAction, error) {
+	rows, err := d.Conn.Query(GetStaleApprovedAdminActionsStatement, approvedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAdminActions(rows)
+}
+
+func scanAdminActions(rows *sql.Rows) ([]AdminAction, error) {
+	var actions []AdminAction
+	defer rows.Close()
+
+	for rows.Next() {
+		action, err := scanAdminAction(rows)
+		if err != nil {
+			return actions, err
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, rows.Err()
+}
+
+func (d *DB) ApproveAdminAction(id, adminID uint, note string) (AdminAction, error) {
+	return d.decideAdminAction(id, adminID, AdminActionApproved, AuditAdminActionApproved, note)
+}
+
+func (d *DB) RejectAdminAction(id, adminID uint, note string) (AdminAction, error) {
+	return d.decideAdminAction(id, adminID, AdminActionRejected, AuditAdminActionRejected, note)
+}
+
+func (d *DB) decideAdminAction(id, adminID uint, status, auditAction, note string) (AdminAction, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return AdminAction{}, err
+	}
+
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return AdminAction{}, err
+	}
+	defer tx.Rollback()
+
+	action, err := scanAdminAction(tx.QueryRow(LockAdminActionStatement, id))
+	if err != nil {
+		return action, err
+	}
+	if err := checkAdminActionReview(action, adminID, status == AdminActionApproved); err != nil {
+		return action, err
+	}
+
+	if _, err := tx.Exec(DecideAdminActionStatement, id, status, note, adminID); err != nil {
+		return action, err
+	}
+
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(adminID), auditAction, adminActionAuditSubject(id), fmt.Sprintf("%s: %s", action.Summary, note)); err != nil {
+		return action, err
+	}
+
+	action.Status = status
+	action.DecisionNote = note
+	action.ReviewedBy = adminID
+	action.ReviewedAt = time.Now()
+
+	return action, tx.Commit()
+}
+
+func (d *DB) FinishAdminAction(id uint, failure string) (AdminAction, error) {
+	tx, err := d.Conn.Begin()
+	if err != nil {
+		return AdminAction{}, err
+	}
+	defer tx.Rollback()
+
+	action, err := scanAdminAction(tx.QueryRow(LockAdminActionStatement, id))
+	if err != nil {
+		return action, err
+	}
+	if action.Status != AdminActionApproved {
+		return action, ErrAdminActionDecided
+	}
+
+	status, auditAction, detail := AdminActionExecuted, AuditAdminActionExecuted, action.Summary
+	if failure != "" {
+		status, auditAction, detail = AdminActionFailed, AuditAdminActionFailed, failure
+	}
+
+	if _, err := tx.Exec(FinishAdminActionStatement, id, status, failure); err != nil {
+		return action, err
+	}
+
+	// the action is carried out on behalf of the admin that approved it
+	if _, err := tx.Exec(RecordAuditStatement, adminActor(action.ReviewedBy), auditAction, adminActionAuditSubject(id), detail); err != nil {
+		return action, err
+	}
+
+	action.Status = status
+	action.FailureReason = failure
+	action.ExecutedAt = time.Now()
+
+	return action, tx.Commit()
 }
@@ -0,0 +1,355 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payments are normally settled by their webhook, but webhooks get
+// lost. The PaymentReconciler sweeps up payments that have been
+// pending for too long and asks their provider what happened to them,
+// and every night it compares the day's payments with the provider's
+// own list of transactions.
+
+const (
+	// stalePaymentAge is how long a payment waits for its webhook
+	// before we go and ask the provider about it
+	stalePaymentAge = 30 * time.Minute
+	// abandonedPaymentAge is how long a customer has to pay. A charge
+	// that is still pending after this is failed.
+	abandonedPaymentAge       = 24 * time.Hour
+	stalePaymentSweepInterval = 10 * time.Minute
+	stalePaymentSweepLimit    = 100
+	// reconciliationHour is when the report for the day before is written
+	reconciliationHour = 2
+)
+
+// The outcomes of settling a stale payment
+const (
+	SettlementFulfilled = "fulfilled"
+	SettlementFailed    = "failed"
+	SettlementFlagged   = "flagged"
+	// SettlementRefunded payments were paid for something that isn't
+	// there any more
+	SettlementRefunded = "refunded"
+	// SettlementPending payments are asked about again on the next sweep
+	SettlementPending = "pending"
+)
+
+// The kinds of discrepancy that a reconciliation report lists
+const (
+	// DiscrepancyMissingAtProvider is a payment we verified that the
+	// provider has no successful charge for
+	DiscrepancyMissingAtProvider = "MISSING_AT_PROVIDER"
+	// DiscrepancyMissingLocally is a successful charge for a payment
+	// that we never verified
+	DiscrepancyMissingLocally = "MISSING_LOCALLY"
+	// DiscrepancyUnknownCharge is a successful charge with a reference
+	// that we don't have
+	DiscrepancyUnknownCharge  = "UNKNOWN_CHARGE"
+	DiscrepancyAmountMismatch = "AMOUNT_MISMATCH"
+	// DiscrepancyNotFulfilled is a verified payment that was never
+	// credited to the customer
+	DiscrepancyNotFulfilled = "NOT_FULFILLED"
+)
+
+type ReconciliationDiscrepancy struct {
+	Kind           string `json:"kind"`
+	Reference      string `json:"reference"`
+	OurAmount      Money  `json:"our_amount"`
+	ProviderAmount Money  `json:"provider_amount"`
+	Detail         string `json:"detail"`
+}
+
+// ReconciliationReport compares one provider's transactions for a day
+// with the payments that we made with it
+type ReconciliationReport struct {
+	ID            uint
+	Provider      string
+	Day           time.Time
+	Matched       int
+	Discrepancies []ReconciliationDiscrepancy
+	CreatedAt     time.Time
+}
+
+// StaleSettlement counts what happened to the payments in a sweep
+type StaleSettlement map[string]int
+
+type ReconciliationStore interface {
+	PaymentEventStore
+	// GetStalePendingPayments lists pending payments made before
+	// createdBefore that haven't been flagged, oldest first
+	GetStalePendingPayments(createdBefore time.Time, limit int) ([]PaystackTransactionInformation, error)
+	FlagPaymentForReview(referenceNumber uuid.UUID, reason string) error
+	GetFlaggedPayments(limit int) ([]PaystackTransactionInformation, error)
+	GetPaymentsCreatedBetween(provider string, from, to time.Time) ([]PaystackTransactionInformation, error)
+	// SaveReconciliationReport replaces any report for the same
+	// provider and day
+	SaveReconciliationReport(report ReconciliationReport) (uint, error)
+	GetReconciliationReports(limit int) ([]ReconciliationReport, error)
+}
+
+type PaymentReconciler struct {
+	store       ReconciliationStore
+	providers   *PaymentProviders
+	fulfillment *FulfillmentDispatcher
+	refunds     *RefundService
+	now         func() time.Time
+}
+
+func NewPaymentReconciler(store ReconciliationStore, providers *PaymentProviders, refunds *RefundService) *PaymentReconciler {
+	return &PaymentReconciler{
+		store:       store,
+		providers:   providers,
+		fulfillment: NewFulfillmentDispatcher(store),
+		refunds:     refunds,
+		now:         time.Now,
+	}
+}
+
+// Run sweeps up stale payments until ctx is cancelled, and writes the
+// reconciliation report for the day before every night
+func (r *PaymentReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(stalePaymentSweepInterval)
+	defer ticker.Stop()
+
+	nightly := time.NewTimer(nextReconciliation(r.now()).Sub(r.now()))
+	defer nightly.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.SettleStalePayments(ctx); err != nil {
+				log.Printf("couldn't settle stale payments: %s", err)
+			}
+		case <-nightly.C:
+			yesterday := r.now().AddDate(0, 0, -1)
+			if _, err := r.Reconcile(ctx, yesterday); err != nil {
+				log.Printf("reconciliation for %s failed: %s", yesterday.Format("2006-01-02"), err)
+			}
+			nightly.Reset(nextReconciliation(r.now()).Sub(r.now()))
+		}
+	}
+}
+
+// nextReconciliation is the next time the nightly report is due
+func nextReconciliation(now time.Time) time.Time {
+	return nextDailyRun(now, reconciliationHour)
+}
+
+// nextDailyRun is the next time it is hour o'clock
+func nextDailyRun(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// SettleStalePayments asks the provider about every payment that has
+// been pending for longer than stalePaymentAge, then fulfills, fails,
+// refunds or flags it. A payment that can't be settled doesn't stop the rest.
+func (r *PaymentReconciler) SettleStalePayments(ctx context.Context) (StaleSettlement, error) {
+	settlement := StaleSettlement{}
+
+	payments, err := r.store.GetStalePendingPayments(r.now().Add(-stalePaymentAge), stalePaymentSweepLimit)
+	if err != nil {
+		return settlement, err
+	}
+
+	var errs []error
+	for _, payment := range payments {
+		outcome, err := r.settle(ctx, payment)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("payment %s: %w", payment.ReferenceNumber, err))
+			continue
+		}
+		settlement[outcome]++
+	}
+
+	return settlement, errors.Join(errs...)
+}
+
+func (r *PaymentReconciler) settle(ctx context.Context, payment PaystackTransactionInformation) (string, error) {
+	reference := payment.ReferenceNumber
+	abandoned := r.now().Sub(payment.CreatedAt) >= abandonedPaymentAge
+
+	provider, err := r.providers.Get(payment.PaymentProvider)
+	if err != nil {
+		return r.flag(reference, fmt.Sprintf("we no longer have keys for %s, which the payment was made with", payment.PaymentProvider))
+	}
+
+	charge, err := provider.Verify(ctx, reference.String())
+	if err != nil {
+		if abandoned {
+			return r.flag(reference, fmt.Sprintf("%s couldn't tell us about the payment: %s", provider.Name(), err))
+		}
+		log.Printf("couldn't verify stale payment %s with %s: %s", reference, provider.Name(), err)
+		return SettlementPending, nil
+	}
+
+	switch charge.Status {
+	case ChargeSuccessful:
+		if err := confirmCharge(charge, payment); err != nil {
+			// the customer paid, but not what we expected, so someone
+			// has to sort out their money
+			if err := r.store.RecordVerificationFailure(reference, err.Error()); err != nil {
+				return "", err
+			}
+			return r.flag(reference, fmt.Sprintf("%s took a payment that failed verification: %s", provider.Name(), err))
+		}
+
+		err := r.fulfillment.Dispatch(reference, charge.Amount)
+		if unfulfillable(err) {
+			return SettlementRefunded, r.refunds.RefundUnfulfillable(ctx, reference, err)
+		}
+		if err != nil {
+			return "", err
+		}
+		return SettlementFulfilled, nil
+	case ChargeFailed:
+		reason := charge.GatewayResponse
+		if reason == "" {
+			reason = fmt.Sprintf("%s says the charge failed", provider.Name())
+		}
+		return SettlementFailed, r.store.RecordVerificationFailure(reference, reason)
+	}
+
+	if abandoned {
+		return SettlementFailed, r.store.RecordVerificationFailure(reference, "the payment was never completed")
+	}
+	return SettlementPending, nil
+}
+
+func (r *PaymentReconciler) flag(referenceNumber uuid.UUID, reason string) (string, error) {
+	log.Printf("flagging payment %s for review: %s", referenceNumber, reason)
+	return SettlementFlagged, r.store.FlagPaymentForReview(referenceNumber, reason)
+}
+
+// Reconcile writes a report per provider comparing the payments made
+// on day with the provider's transactions for the same day
+func (r *PaymentReconciler) Reconcile(ctx context.Context, day time.Time) ([]ReconciliationReport, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	to := from.AddDate(0, 0, 1)
+
+	var reports []ReconciliationReport
+	var errs []error
+
+	for _, provider := range r.providers.All() {
+		report, err := r.reconcileProvider(ctx, provider, from, to)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, errors.Join(errs...)
+}
+
+func (r *PaymentReconciler) reconcileProvider(ctx context.Context, provider PaymentProvider, from, to time.Time) (ReconciliationReport, error) {
+	ours, err := r.store.GetPaymentsCreatedBetween(provider.Name(), from, to)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	theirs, err := provider.ListCharges(ctx, from, to)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	report, err := reconcilePayments(ours, theirs, r.store.GetPaystackVerificationInformation)
+	if err != nil {
+		return report, err
+	}
+	report.Provider = provider.Name()
+	report.Day = from
+
+	report.ID, err = r.store.SaveReconciliationReport(report)
+	if len(report.Discrepancies) > 0 {
+		log.Printf("%s reconciliation for %s found %d discrepancies", report.Provider, from.Format("2006-01-02"), len(report.Discrepancies))
+	}
+	return report, err
+}
+
+// reconcilePayments matches our payments with the provider's charges
+// by reference. A charge that isn't among ours may be for a payment
+// made the day before, so it is looked up before it is reported.
+func reconcilePayments(ours []PaystackTransactionInformation, theirs []ProviderCharge, lookup func(referenceNumber string) (PaystackTransactionInformation, error)) (ReconciliationReport, error) {
+	var report ReconciliationReport
+
+	charges := map[string]ProviderCharge{}
+	for _, charge := range theirs {
+		if charge.Status == ChargeSuccessful {
+			charges[charge.Reference] = charge
+		}
+	}
+
+	compare := func(payment PaystackTransactionInformation) {
+		reference := payment.ReferenceNumber.String()
+		charge, charged := charges[reference]
+		delete(charges, reference)
+
+		discrepancy := ReconciliationDiscrepancy{Reference: reference, OurAmount: payment.PaymentAmount, ProviderAmount: charge.Amount}
+
+		switch {
+		case payment.VerificationStatus != StatusSuccessful && charged:
+			discrepancy.Kind = DiscrepancyMissingLocally
+			discrepancy.Detail = fmt.Sprintf("our payment is %s", payment.VerificationStatus)
+		case payment.VerificationStatus != StatusSuccessful:
+			// nobody has been paid, so there is nothing to compare
+			return
+		case !charged:
+			discrepancy.Kind = DiscrepancyMissingAtProvider
+		case charge.Amount != payment.PaymentAmount:
+			discrepancy.Kind = DiscrepancyAmountMismatch
+		case payment.FulfillmentStatus != StatusSuccessful:
+			discrepancy.Kind = DiscrepancyNotFulfilled
+			discrepancy.Detail = payment.FulfillmentFailureReason
+		default:
+			report.Matched++
+			return
+		}
+
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+
+	for _, payment := range ours {
+		compare(payment)
+	}
+
+	for _, charge := range theirs {
+		if _, ok := charges[charge.Reference]; !ok {
+			continue
+		}
+
+		// references that aren't even a uuid can't be ours
+		if _, err := charge.ReferenceNumber(); err == nil {
+			payment, err := lookup(charge.Reference)
+			if err == nil {
+				compare(payment)
+				continue
+			}
+			if err != ErrReferenceNumberDoesNotExist {
+				return report, err
+			}
+		}
+
+		delete(charges, charge.Reference)
+		report.Discrepancies = append(report.Discrepancies, ReconciliationDiscrepancy{
+			Kind:           DiscrepancyUnknownCharge,
+			Reference:      charge.Reference,
+			ProviderAmount: charge.Amount,
+			Detail:         fmt.Sprintf("charge %s", charge.ID),
+		})
+	}
+
+	return report, nil
+}
@@ -0,0 +1,306 @@
+package web_app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeReconciliationStore keeps flags and reports on top of the
+// payments of a FakeFulfillmentStore
+type FakeReconciliationStore struct {
+	*FakeFulfillmentStore
+	flagged map[string]string
+	reports []ReconciliationReport
+}
+
+func NewFakeReconciliationStore(payments ...PaystackTransactionInformation) *FakeReconciliationStore {
+	return &FakeReconciliationStore{FakeFulfillmentStore: NewFakeFulfillmentStore(payments...), flagged: map[string]string{}}
+}
+
+func (f *FakeReconciliationStore) GetStalePendingPayments(createdBefore time.Time, limit int) ([]PaystackTransactionInformation, error) {
+	var stale []PaystackTransactionInformation
+	for reference, payment := range f.payments {
+		if _, flagged := f.flagged[reference]; !flagged && payment.VerificationStatus == StatusPending && payment.CreatedAt.Before(createdBefore) {
+			stale = append(stale, payment)
+		}
+	}
+	return stale, nil
+}
+
+func (f *FakeReconciliationStore) FlagPaymentForReview(referenceNumber uuid.UUID, reason string) error {
+	f.flagged[referenceNumber.String()] = reason
+	return nil
+}
+
+func (f *FakeReconciliationStore) GetFlaggedPayments(limit int) ([]PaystackTransactionInformation, error) {
+	var flagged []PaystackTransactionInformation
+	for reference, reason := range f.flagged {
+		payment := f.payments[reference]
+		payment.FlagReason = reason
+		flagged = append(flagged, payment)
+	}
+	return flagged, nil
+}
+
+func (f *FakeReconciliationStore) GetPaymentsCreatedBetween(provider string, from, to time.Time) ([]PaystackTransactionInformation, error) {
+	var payments []PaystackTransactionInformation
+	for _, payment := range f.payments {
+		if payment.PaymentProvider == provider && !payment.CreatedAt.Before(from) && payment.CreatedAt.Before(to) {
+			payments = append(payments, payment)
+		}
+	}
+	return payments, nil
+}
+
+func (f *FakeReconciliationStore) SaveReconciliationReport(report ReconciliationReport) (uint, error) {
+	f.reports = append(f.reports, report)
+	return uint(len(f.reports)), nil
+}
+
+func (f *FakeReconciliationStore) GetReconciliationReports(limit int) ([]ReconciliationReport, error) {
+	return f.reports, nil
+}
+
+func newSandboxReconciler(store *FakeReconciliationStore, sandbox *SandboxProvider) *PaymentReconciler {
+	providers := NewPaymentProviders(sandbox)
+	return NewPaymentReconciler(store, providers, NewRefundService(NewFakeRefundStore(store.FakeFulfillmentStore), providers))
+}
+
+// newOfflineSandbox is a sandbox whose webhooks never get through
+func newOfflineSandbox(t *testing.T) *SandboxProvider {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	return NewSandboxProvider(server.URL, "sk_sandbox", server.Client())
+}
+
+// stalePayment is a sandbox payment made age ago
+func stalePayment(sandbox *SandboxProvider, age time.Duration) PaystackTransactionInformation {
+	payment := pendingPayment(OriginatorSoloSavings)
+	payment.CreatedAt = time.Now().Add(-age)
+	sandbox.Initialize(context.Background(), PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+	return payment
+}
+
+func TestSettleStalePayments(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fulfills a payment whose webhook never arrived", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		payment := stalePayment(sandbox, time.Hour)
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+		store := NewFakeReconciliationStore(payment)
+
+		settlement, err := newSandboxReconciler(store, sandbox).SettleStalePayments(ctx)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if settlement[SettlementFulfilled] != 1 || len(store.fulfilled) != 1 {
+			t.Errorf("expected the payment to be fulfilled, got %v", settlement)
+		}
+	})
+
+	t.Run("fails a declined payment", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		payment := stalePayment(sandbox, time.Hour)
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), false)
+		store := NewFakeReconciliationStore(payment)
+
+		newSandboxReconciler(store, sandbox).SettleStalePayments(ctx)
+
+		if got := store.payments[payment.ReferenceNumber.String()]; got.VerificationStatus != StatusFailed || got.VerificationFailureReason != "Declined" {
+			t.Errorf("expected the payment to fail, got %+v", got)
+		}
+	})
+
+	t.Run("waits for the customer until the payment is abandoned", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		recent := stalePayment(sandbox, time.Hour)
+		abandoned := stalePayment(sandbox, 25*time.Hour)
+		store := NewFakeReconciliationStore(recent, abandoned)
+
+		settlement, _ := newSandboxReconciler(store, sandbox).SettleStalePayments(ctx)
+
+		if settlement[SettlementPending] != 1 || settlement[SettlementFailed] != 1 {
+			t.Errorf("unexpected settlement %v", settlement)
+		}
+
+		if got := store.payments[abandoned.ReferenceNumber.String()]; got.VerificationStatus != StatusFailed {
+			t.Errorf("expected the abandoned payment to fail, got %+v", got)
+		}
+	})
+
+	t.Run("leaves young payments alone", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		payment := stalePayment(sandbox, time.Minute)
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+		store := NewFakeReconciliationStore(payment)
+
+		if settlement, _ := newSandboxReconciler(store, sandbox).SettleStalePayments(ctx); len(settlement) != 0 {
+			t.Errorf("expected nothing to be settled, got %v", settlement)
+		}
+	})
+
+	t.Run("flags payments that the provider can't tell us about", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		recent := pendingPayment(OriginatorSoloSavings)
+		recent.CreatedAt = time.Now().Add(-time.Hour)
+		abandoned := pendingPayment(OriginatorSoloSavings)
+		abandoned.CreatedAt = time.Now().Add(-25 * time.Hour)
+		store := NewFakeReconciliationStore(recent, abandoned)
+		reconciler := newSandboxReconciler(store, sandbox)
+
+		settlement, _ := reconciler.SettleStalePayments(ctx)
+
+		if settlement[SettlementFlagged] != 1 || len(store.flagged) != 1 {
+			t.Fatalf("expected the abandoned payment to be flagged, got %v", settlement)
+		}
+
+		if _, ok := store.flagged[abandoned.ReferenceNumber.String()]; !ok {
+			t.Errorf("flagged the wrong payment: %v", store.flagged)
+		}
+
+		// flagged payments are left for an admin
+		if settlement, _ := reconciler.SettleStalePayments(ctx); settlement[SettlementFlagged] != 0 {
+			t.Errorf("expected flagged payments not to be asked about again, got %v", settlement)
+		}
+	})
+
+	t.Run("flags a charge for another amount", func(t *testing.T) {
+		sandbox := newOfflineSandbox(t)
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.CreatedAt = time.Now().Add(-time.Hour)
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: 100})
+		sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+		store := NewFakeReconciliationStore(payment)
+
+		newSandboxReconciler(store, sandbox).SettleStalePayments(ctx)
+
+		if got := store.payments[payment.ReferenceNumber.String()]; got.VerificationStatus != StatusFailed || len(store.fulfilled) != 0 {
+			t.Errorf("expected the payment to fail verification, got %+v", got)
+		}
+
+		if _, ok := store.flagged[payment.ReferenceNumber.String()]; !ok {
+			t.Error("expected the payment to be flagged")
+		}
+	})
+
+	t.Run("flags payments made with a provider we no longer have", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.PaymentProvider = ProviderFlutterwave
+		payment.CreatedAt = time.Now().Add(-time.Hour)
+		store := NewFakeReconciliationStore(payment)
+
+		if settlement, _ := newSandboxReconciler(store, newOfflineSandbox(t)).SettleStalePayments(ctx); settlement[SettlementFlagged] != 1 {
+			t.Errorf("expected the payment to be flagged, got %v", settlement)
+		}
+	})
+}
+
+func TestReconcilePayments(t *testing.T) {
+	payment := func(verification, fulfillment string) PaystackTransactionInformation {
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.VerificationStatus = verification
+		payment.FulfillmentStatus = fulfillment
+		return payment
+	}
+	charge := func(payment PaystackTransactionInformation, amount Money) ProviderCharge {
+		return ProviderCharge{ID: "1", Reference: payment.ReferenceNumber.String(), Amount: amount, Currency: "NGN", Status: ChargeSuccessful}
+	}
+
+	matched := payment(StatusSuccessful, StatusSuccessful)
+	missingAtProvider := payment(StatusSuccessful, StatusSuccessful)
+	missingLocally := payment(StatusPending, StatusPending)
+	wrongAmount := payment(StatusSuccessful, StatusSuccessful)
+	notFulfilled := payment(StatusSuccessful, StatusFailed)
+	unpaid := payment(StatusFailed, StatusFailed)
+	yesterdays := payment(StatusSuccessful, StatusSuccessful)
+	declined := charge(unpaid, unpaid.PaymentAmount)
+	declined.Status = ChargeFailed
+
+	ours := []PaystackTransactionInformation{matched, missingAtProvider, missingLocally, wrongAmount, notFulfilled, unpaid}
+	theirs := []ProviderCharge{
+		charge(matched, matched.PaymentAmount),
+		charge(missingLocally, missingLocally.PaymentAmount),
+		charge(wrongAmount, 100),
+		charge(notFulfilled, notFulfilled.PaymentAmount),
+		declined,
+		charge(yesterdays, yesterdays.PaymentAmount),
+		{ID: "2", Reference: "T123456789", Amount: 5000, Status: ChargeSuccessful},
+	}
+
+	lookup := NewFakeFulfillmentStore(yesterdays).GetPaystackVerificationInformation
+
+	report, err := reconcilePayments(ours, theirs, lookup)
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+
+	if report.Matched != 2 {
+		t.Errorf("expected today's and yesterday's payments to match, got %d", report.Matched)
+	}
+
+	want := map[string]string{
+		missingAtProvider.ReferenceNumber.String(): DiscrepancyMissingAtProvider,
+		missingLocally.ReferenceNumber.String():    DiscrepancyMissingLocally,
+		wrongAmount.ReferenceNumber.String():       DiscrepancyAmountMismatch,
+		notFulfilled.ReferenceNumber.String():      DiscrepancyNotFulfilled,
+		"T123456789":                               DiscrepancyUnknownCharge,
+	}
+
+	if len(report.Discrepancies) != len(want) {
+		t.Errorf("expected %d discrepancies, got %+v", len(want), report.Discrepancies)
+	}
+
+	for _, discrepancy := range report.Discrepancies {
+		if want[discrepancy.Reference] != discrepancy.Kind {
+			t.Errorf("expected %s to be %q, got %q", discrepancy.Reference, want[discrepancy.Reference], discrepancy.Kind)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	sandbox := newOfflineSandbox(t)
+	payment := stalePayment(sandbox, 0)
+	sandbox.Complete(ctx, payment.ReferenceNumber.String(), true)
+	store := NewFakeReconciliationStore(payment)
+
+	// the webhook never arrived, so the provider has money that we
+	// haven't verified
+	reports, err := newSandboxReconciler(store, sandbox).Reconcile(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("did not expect an error, got %q", err)
+	}
+
+	if len(reports) != 1 || len(store.reports) != 1 {
+		t.Fatalf("expected one saved report, got %+v", reports)
+	}
+
+	if report := reports[0]; report.Provider != ProviderSandbox || len(report.Discrepancies) != 1 || report.Discrepancies[0].Kind != DiscrepancyMissingLocally {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestNextReconciliation(t *testing.T) {
+	before := time.Date(2026, 10, 19, 1, 30, 0, 0, time.UTC)
+	after := time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)
+
+	if next := nextReconciliation(before); !next.Equal(time.Date(2026, 10, 19, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the report to be due tonight, got %s", next)
+	}
+
+	if next := nextReconciliation(after); !next.Equal(time.Date(2026, 10, 20, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the report to be due tomorrow night, got %s", next)
+	}
+}
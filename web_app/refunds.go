@@ -0,0 +1,349 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refunds give back some or all of a payment through the provider it
+// was made with. If the payment was credited, the refunded amount is
+// held from what it was credited to while the provider sends it back,
+// like a payout. Disputes (chargebacks) hold the disputed amount until
+// the bank decides who keeps it.
+
+// Refund statuses. Every provider's own statuses are mapped onto the
+// lower case ones, and we keep the upper case ones.
+const (
+	ProviderRefundPending   = "pending"
+	ProviderRefundProcessed = "processed"
+	ProviderRefundFailed    = "failed"
+
+	RefundPending   = "PENDING"
+	RefundProcessed = "PROCESSED"
+	RefundFailed    = "FAILED"
+)
+
+// Dispute statuses
+const (
+	DisputeOpen = "OPEN"
+	// DisputeWon disputes were decided in our favour, and we keep the money
+	DisputeWon  = "WON"
+	DisputeLost = "LOST"
+)
+
+// What goes in the audit log for refunds and disputes
+const (
+	AuditRefundRequested = "REFUND_REQUESTED"
+	AuditRefundProcessed = "REFUND_PROCESSED"
+	AuditRefundFailed    = "REFUND_FAILED"
+	AuditDisputeOpened   = "DISPUTE_OPENED"
+	AuditDisputeWon      = "DISPUTE_WON"
+	AuditDisputeLost     = "DISPUTE_LOST"
+)
+
+var (
+	ErrRefundNotPaid         = errors.New("only payments that were paid can be refunded")
+	ErrRefundTooLarge        = errors.New("the refund is more than what is left of the payment")
+	ErrRefundInvalidAmount   = errors.New("refunds must be more than zero")
+	ErrRefundDoesNotExist    = errors.New("refund does not exist")
+	ErrDisputeDoesNotExist   = errors.New("dispute does not exist")
+	ErrUnknownPaymentAccount = errors.New("no account for this payment originator")
+)
+
+type Refund struct {
+	ID uint
+	// Reference is ours. PaymentReference is the payment's.
+	Reference        uuid.UUID
+	PaymentReference uuid.UUID
+	Amount           Money
+	Reason           string
+	InitiatedBy      string
+	Provider         string
+	ProviderRefundID string
+	Status           string
+	// Held is set when the amount was taken from what the payment was
+	// credited to. Payments that were never credited have nothing to hold.
+	Held          bool
+	FailureReason string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type ProviderDispute struct {
+	// ID is the provider's. Reference is the disputed payment's.
+	ID        string
+	Reference string
+	Amount    Money
+	Status    string
+	Reason    string
+}
+
+type Dispute struct {
+	ID                uint
+	Provider          string
+	ProviderDisputeID string
+	PaymentReference  uuid.UUID
+	Amount            Money
+	Reason            string
+	Status            string
+	Held              bool
+	CreatedAt         time.Time
+	ResolvedAt        time.Time
+}
+
+// paymentLedgerAccount is the account that a payment was credited to
+func paymentLedgerAccount(payment PaystackTransactionInformation) (LedgerAccount, error) {
+	switch payment.PaymentOriginator {
+	case OriginatorSoloSavings:
+		return soloSavingsLedgerAccount(payment.CustomerID), nil
+	case OriginatorTargetSavings:
+		return targetSavingsLedgerAccount(payment.CustomerID, payment.PlanID), nil
+	case OriginatorFamilySavings:
+		return familyVaultLedgerAccount(payment.PlanID), nil
+	case OriginatorLoanRepayment:
+		return loansReceivableLedgerAccount(payment.CustomerID), nil
+	case OriginatorInvestments:
+		return investmentLedgerAccount(payment.CustomerID), nil
+	}
+	return LedgerAccount{}, fmt.Errorf("%w: %q", ErrUnknownPaymentAccount, payment.PaymentOriginator)
+}
+
+type RefundStore interface {
+	AuditStore
+	GetPaystackVerificationInformation(referenceNumber string) (PaystackTransactionInformation, error)
+	// CreateRefund saves the refund and holds its amount in one
+	// transaction. It turns away refunds for more than what is left of
+	// the payment.
+	CreateRefund(refund Refund) (Refund, error)
+	GetRefunds(paymentReference uuid.UUID) ([]Refund, error)
+	// GetPendingRefund finds the oldest pending refund of amount for
+	// a payment
+	GetPendingRefund(paymentReference uuid.UUID, amount Money) (Refund, error)
+	MarkRefundSubmitted(reference uuid.UUID, providerRefundID string) error
+	// ProcessRefund and FailRefund post the ledger entries for the end
+	// of a refund. Refunds that have already ended are left alone, and
+	// ended is false.
+	ProcessRefund(reference uuid.UUID) (ended bool, err error)
+	FailRefund(reference uuid.UUID, reason string) (ended bool, err error)
+	// OpenDispute saves a dispute and holds its amount if it can. A
+	// dispute that was already saved is returned as it is, and opened
+	// is false.
+	OpenDispute(dispute Dispute) (saved Dispute, opened bool, err error)
+	// ResolveDispute gives back or settles the held amount. Disputes
+	// that have already been resolved are left alone, and resolved is
+	// false.
+	ResolveDispute(provider, providerDisputeID, status string) (resolved bool, err error)
+	GetDisputes(paymentReference uuid.UUID) ([]Dispute, error)
+}
+
+type RefundService struct {
+	store     RefundStore
+	providers *PaymentProviders
+}
+
+func NewRefundService(store RefundStore, providers *PaymentProviders) *RefundService {
+	return &RefundService{store: store, providers: providers}
+}
+
+// Refund gives back amount of a payment through its provider. actor is
+// who asked for it, for the audit log.
+func (s *RefundService) Refund(ctx context.Context, paymentReference uuid.UUID, amount Money, reason, actor string) (Refund, error) {
+	if amount <= 0 {
+		return Refund{}, ErrRefundInvalidAmount
+	}
+
+	payment, err := s.store.GetPaystackVerificationInformation(paymentReference.String())
+	if err != nil {
+		return Refund{}, err
+	}
+
+	if payment.VerificationStatus != StatusSuccessful {
+		return Refund{}, ErrRefundNotPaid
+	}
+
+	provider, err := s.providers.Get(payment.PaymentProvider)
+	if err != nil {
+		return Refund{}, err
+	}
+
+	refund, err := s.store.CreateRefund(Refund{
+		Reference:        uuid.New(),
+		PaymentReference: paymentReference,
+		Amount:           amount,
+		Reason:           reason,
+		InitiatedBy:      actor,
+		Provider:         provider.Name(),
+		Status:           RefundPending,
+	})
+	if err != nil {
+		return refund, err
+	}
+
+	s.audit(actor, AuditRefundRequested, paymentReference, fmt.Sprintf("refund %s of %s: %s", refund.Reference, amount, reason))
+
+	providerRefund, err := provider.Refund(ctx, paymentReference.String(), amount)
+	if err != nil {
+		return refund, errors.Join(err, s.settle(refund, provider.Name(), ProviderRefundFailed, err.Error()))
+	}
+
+	if err := s.store.MarkRefundSubmitted(refund.Reference, providerRefund.ID); err != nil {
+		return refund, err
+	}
+	refund.ProviderRefundID = providerRefund.ID
+
+	return refund, s.settle(refund, provider.Name(), providerRefund.Status, "")
+}
+
+// RefundUnfulfillable gives back a payment that can't be credited to
+// what it was for, e.g. because the plan was deleted
+func (s *RefundService) RefundUnfulfillable(ctx context.Context, paymentReference uuid.UUID, reason error) error {
+	payment, err := s.store.GetPaystackVerificationInformation(paymentReference.String())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("refunding payment %s, which can't be fulfilled: %s", paymentReference, reason)
+
+	_, err = s.Refund(ctx, paymentReference, payment.PaymentAmount, fmt.Sprintf("automatic refund: %s", reason), ActorSystem)
+	if err == ErrRefundTooLarge {
+		// it has already been refunded
+		return nil
+	}
+	return err
+}
+
+// HandleRefund acts on a refund webhook for a refund that we made
+func (s *RefundService) HandleRefund(ctx context.Context, provider PaymentProvider, providerRefund ProviderRefund) error {
+	paymentReference, err := uuid.Parse(providerRefund.Reference)
+	if err != nil {
+		log.Printf("ignoring %s refund for reference %q that isn't ours", provider.Name(), providerRefund.Reference)
+		return nil
+	}
+
+	refund, err := s.store.GetPendingRefund(paymentReference, providerRefund.Amount)
+	if err == ErrRefundDoesNotExist {
+		// either it has already ended, or it wasn't made by us
+		log.Printf("ignoring %s refund of %s for payment %s, which has no pending refund", provider.Name(), providerRefund.Amount, paymentReference)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if refund.Provider != provider.Name() {
+		log.Printf("ignoring %s refund for payment %s, which was refunded with %s", provider.Name(), paymentReference, refund.Provider)
+		return nil
+	}
+
+	return s.settle(refund, provider.Name(), providerRefund.Status, "")
+}
+
+// settle ends a refund if the provider says it has ended. The webhook
+// for a refund can arrive before the provider has answered us, so
+// either can be the one that ends it.
+func (s *RefundService) settle(refund Refund, actor, status, reason string) error {
+	switch status {
+	case ProviderRefundProcessed:
+		ended, err := s.store.ProcessRefund(refund.Reference)
+		if err != nil || !ended {
+			return err
+		}
+		s.audit(actor, AuditRefundProcessed, refund.PaymentReference, fmt.Sprintf("refund %s of %s", refund.Reference, refund.Amount))
+	case ProviderRefundFailed:
+		if reason == "" {
+			reason = fmt.Sprintf("%s could not make the refund", refund.Provider)
+		}
+		ended, err := s.store.FailRefund(refund.Reference, reason)
+		if err != nil || !ended {
+			return err
+		}
+		s.audit(actor, AuditRefundFailed, refund.PaymentReference, fmt.Sprintf("refund %s of %s: %s", refund.Reference, refund.Amount, reason))
+	}
+
+	return nil
+}
+
+// HandleDispute acts on a dispute webhook. A dispute that is resolved
+// before we heard that it was opened is opened first.
+func (s *RefundService) HandleDispute(ctx context.Context, provider PaymentProvider, providerDispute ProviderDispute) error {
+	paymentReference, err := uuid.Parse(providerDispute.Reference)
+	if err != nil {
+		log.Printf("ignoring %s dispute for reference %q that isn't ours", provider.Name(), providerDispute.Reference)
+		return nil
+	}
+
+	payment, err := s.store.GetPaystackVerificationInformation(paymentReference.String())
+	if err == ErrReferenceNumberDoesNotExist {
+		log.Printf("ignoring %s dispute for unknown payment %s", provider.Name(), paymentReference)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if payment.PaymentProvider != provider.Name() {
+		log.Printf("ignoring %s dispute for payment %s, which was made with %s", provider.Name(), paymentReference, payment.PaymentProvider)
+		return nil
+	}
+
+	// nobody can dispute more than they paid
+	amount := providerDispute.Amount
+	if amount <= 0 || amount > payment.PaymentAmount {
+		amount = payment.PaymentAmount
+	}
+
+	dispute, opened, err := s.store.OpenDispute(Dispute{
+		Provider:          provider.Name(),
+		ProviderDisputeID: providerDispute.ID,
+		PaymentReference:  paymentReference,
+		Amount:            amount,
+		Reason:            providerDispute.Reason,
+		Status:            DisputeOpen,
+	})
+	if err != nil {
+		return err
+	}
+
+	if opened {
+		detail := fmt.Sprintf("dispute %s of %s: %s", dispute.ProviderDisputeID, dispute.Amount, dispute.Reason)
+		if !dispute.Held {
+			detail += " (the amount could not be held)"
+		}
+		s.audit(provider.Name(), AuditDisputeOpened, paymentReference, detail)
+	}
+
+	if providerDispute.Status == DisputeOpen || dispute.Status != DisputeOpen {
+		return nil
+	}
+
+	resolved, err := s.store.ResolveDispute(provider.Name(), providerDispute.ID, providerDispute.Status)
+	if err != nil || !resolved {
+		return err
+	}
+
+	action := AuditDisputeLost
+	if providerDispute.Status == DisputeWon {
+		action = AuditDisputeWon
+	}
+	s.audit(provider.Name(), action, paymentReference, fmt.Sprintf("dispute %s of %s", dispute.ProviderDisputeID, dispute.Amount))
+	return nil
+}
+
+// audit records an action. Failing to is logged rather than undoing
+// what was done, since the ledger has the movement either way.
+func (s *RefundService) audit(actor, action string, paymentReference uuid.UUID, detail string) {
+	err := s.store.RecordAudit(AuditEntry{Actor: actor, Action: action, Subject: paymentAuditSubject(paymentReference), Detail: detail})
+	if err != nil {
+		log.Printf("couldn't record %s for payment %s in the audit log: %s", action, paymentReference, err)
+	}
+}
+
+// unfulfillable errors won't go away by trying again
+func unfulfillable(err error) bool {
+	return errors.Is(err, ErrFulfillmentTargetAbsent) || errors.Is(err, ErrNoFulfiller)
+}
@@ -0,0 +1,426 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// FakeRefundStore keeps the balances that payments were credited to,
+// keyed by ledger account code, and moves them the way the ledger
+// entries for refunds and disputes would
+type FakeRefundStore struct {
+	*FakeFulfillmentStore
+	refunds  []Refund
+	disputes map[string]Dispute
+	balances map[string]Money
+	journals []string
+	audit    []AuditEntry
+}
+
+func NewFakeRefundStore(fulfillment *FakeFulfillmentStore) *FakeRefundStore {
+	return &FakeRefundStore{
+		FakeFulfillmentStore: fulfillment,
+		disputes:             map[string]Dispute{},
+		balances:             map[string]Money{},
+	}
+}
+
+func (f *FakeRefundStore) RecordAudit(entry AuditEntry) error {
+	f.audit = append(f.audit, entry)
+	return nil
+}
+
+func (f *FakeRefundStore) GetAuditLog(subject string, limit int) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for i := len(f.audit) - 1; i >= 0 && len(entries) < limit; i-- {
+		if f.audit[i].Subject == subject {
+			entries = append(entries, f.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+func (f *FakeRefundStore) accountCode(paymentReference uuid.UUID) string {
+	account, _ := paymentLedgerAccount(f.payments[paymentReference.String()])
+	return account.Code
+}
+
+func (f *FakeRefundStore) CreateRefund(refund Refund) (Refund, error) {
+	payment, ok := f.payments[refund.PaymentReference.String()]
+	if !ok {
+		return refund, ErrReferenceNumberDoesNotExist
+	}
+
+	refunded := refund.Amount
+	for _, other := range f.refunds {
+		if other.PaymentReference == refund.PaymentReference && other.Status != RefundFailed {
+			refunded += other.Amount
+		}
+	}
+	if refunded > payment.PaymentAmount {
+		return refund, ErrRefundTooLarge
+	}
+
+	if payment.FulfillmentStatus == StatusSuccessful {
+		code := f.accountCode(refund.PaymentReference)
+		if f.balances[code] < refund.Amount {
+			return refund, ErrInsufficientLedgerFund
+		}
+		f.balances[code] -= refund.Amount
+		f.journals = append(f.journals, "REFUND:"+refund.Reference.String())
+		refund.Held = true
+	}
+
+	refund.ID = uint(len(f.refunds) + 1)
+	f.refunds = append(f.refunds, refund)
+	return refund, nil
+}
+
+func (f *FakeRefundStore) GetRefunds(paymentReference uuid.UUID) ([]Refund, error) {
+	var refunds []Refund
+	for _, refund := range f.refunds {
+		if refund.PaymentReference == paymentReference {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (f *FakeRefundStore) GetPendingRefund(paymentReference uuid.UUID, amount Money) (Refund, error) {
+	for _, refund := range f.refunds {
+		if refund.PaymentReference == paymentReference && refund.Amount == amount && refund.Status == RefundPending {
+			return refund, nil
+		}
+	}
+	return Refund{}, ErrRefundDoesNotExist
+}
+
+func (f *FakeRefundStore) refund(reference uuid.UUID) (*Refund, error) {
+	for i := range f.refunds {
+		if f.refunds[i].Reference == reference {
+			return &f.refunds[i], nil
+		}
+	}
+	return nil, ErrRefundDoesNotExist
+}
+
+func (f *FakeRefundStore) MarkRefundSubmitted(reference uuid.UUID, providerRefundID string) error {
+	refund, err := f.refund(reference)
+	if err != nil {
+		return err
+	}
+	refund.ProviderRefundID = providerRefundID
+	return nil
+}
+
+func (f *FakeRefundStore) ProcessRefund(reference uuid.UUID) (bool, error) {
+	refund, err := f.refund(reference)
+	if err != nil || refund.Status != RefundPending {
+		return false, err
+	}
+
+	if refund.Held {
+		f.journals = append(f.journals, "REFUND_PROCESSED:"+reference.String())
+	}
+	refund.Status = RefundProcessed
+	return true, nil
+}
+
+func (f *FakeRefundStore) FailRefund(reference uuid.UUID, reason string) (bool, error) {
+	refund, err := f.refund(reference)
+	if err != nil || refund.Status != RefundPending {
+		return false, err
+	}
+
+	if refund.Held {
+		f.balances[f.accountCode(refund.PaymentReference)] += refund.Amount
+		f.journals = append(f.journals, "REFUND_FAILED:"+reference.String())
+	}
+	refund.Status = RefundFailed
+	refund.FailureReason = reason
+	return true, nil
+}
+
+func (f *FakeRefundStore) OpenDispute(dispute Dispute) (Dispute, bool, error) {
+	key := disputeKey(dispute.Provider, dispute.ProviderDisputeID)
+	if saved, ok := f.disputes[key]; ok {
+		return saved, false, nil
+	}
+
+	payment := f.payments[dispute.PaymentReference.String()]
+	code := f.accountCode(dispute.PaymentReference)
+	if payment.FulfillmentStatus == StatusSuccessful && f.balances[code] >= dispute.Amount {
+		f.balances[code] -= dispute.Amount
+		f.journals = append(f.journals, "DISPUTE:"+key)
+		dispute.Held = true
+	}
+
+	dispute.ID = uint(len(f.disputes) + 1)
+	dispute.Status = DisputeOpen
+	f.disputes[key] = dispute
+	return dispute, true, nil
+}
+
+func (f *FakeRefundStore) ResolveDispute(provider, providerDisputeID, status string) (bool, error) {
+	key := disputeKey(provider, providerDisputeID)
+	dispute, ok := f.disputes[key]
+	if !ok {
+		return false, ErrDisputeDoesNotExist
+	}
+	if dispute.Status != DisputeOpen {
+		return false, nil
+	}
+
+	payment := f.payments[dispute.PaymentReference.String()]
+	switch {
+	case status == DisputeWon && dispute.Held:
+		f.balances[f.accountCode(dispute.PaymentReference)] += dispute.Amount
+		f.journals = append(f.journals, "DISPUTE_WON:"+key)
+	case status == DisputeLost && (dispute.Held || payment.FulfillmentStatus == StatusSuccessful):
+		f.journals = append(f.journals, "DISPUTE_LOST:"+key)
+	}
+
+	dispute.Status = status
+	f.disputes[key] = dispute
+	return true, nil
+}
+
+func (f *FakeRefundStore) GetDisputes(paymentReference uuid.UUID) ([]Dispute, error) {
+	var disputes []Dispute
+	for _, dispute := range f.disputes {
+		if dispute.PaymentReference == paymentReference {
+			disputes = append(disputes, dispute)
+		}
+	}
+	return disputes, nil
+}
+
+func (f *FakeRefundStore) actions() []string {
+	var actions []string
+	for _, entry := range f.audit {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+// newPaidPayment makes a target savings payment that the sandbox was
+// paid for and that was credited, with nothing else in its plan
+func newPaidPayment(t *testing.T) (*SandboxProvider, *RefundService, *FakeRefundStore, PaystackTransactionInformation) {
+	t.Helper()
+	ctx := context.Background()
+
+	payment := pendingPayment(OriginatorTargetSavings)
+	store := NewFakeRefundStore(NewFakeFulfillmentStore(payment))
+	sandbox := newSandboxProcessor(t, store, NewFakePayoutStore(), store)
+
+	sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+	if _, err := sandbox.Complete(ctx, payment.ReferenceNumber.String(), true); err != nil {
+		t.Fatalf("did not expect an error paying, got %q", err)
+	}
+
+	payment = store.payments[payment.ReferenceNumber.String()]
+	if payment.FulfillmentStatus != StatusSuccessful {
+		t.Fatalf("expected the payment to be fulfilled, got %+v", payment)
+	}
+	store.balances[store.accountCode(payment.ReferenceNumber)] = payment.PaymentAmount
+
+	return sandbox, NewRefundService(store, NewPaymentProviders(sandbox)), store, payment
+}
+
+func TestRefunds(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("refunds part of a payment and takes it from the plan", func(t *testing.T) {
+		_, refunds, store, payment := newPaidPayment(t)
+
+		refund, err := refunds.Refund(ctx, payment.ReferenceNumber, 200000, "customer asked", adminActor(3))
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if got := store.refunds[0]; got.Status != RefundProcessed || !got.Held || got.ProviderRefundID == "" || got.Reference != refund.Reference {
+			t.Errorf("expected a processed refund, got %+v", got)
+		}
+
+		if balance := store.balances[store.accountCode(payment.ReferenceNumber)]; balance != 300000 {
+			t.Errorf("expected 300000 left in the plan, got %s", balance)
+		}
+
+		// the webhook and the provider's answer both end the refund,
+		// but it is only recorded once
+		want := []string{AuditRefundRequested, AuditRefundProcessed}
+		if got := store.actions(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("expected %v in the audit log, got %v", want, got)
+		}
+
+		if store.audit[0].Actor != "admin:3" || store.audit[0].Subject != paymentAuditSubject(payment.ReferenceNumber) {
+			t.Errorf("unexpected audit entry %+v", store.audit[0])
+		}
+	})
+
+	t.Run("refunds no more than was paid", func(t *testing.T) {
+		_, refunds, _, payment := newPaidPayment(t)
+
+		refunds.Refund(ctx, payment.ReferenceNumber, 400000, "customer asked", adminActor(3))
+
+		if _, err := refunds.Refund(ctx, payment.ReferenceNumber, 100001, "customer asked", adminActor(3)); err != ErrRefundTooLarge {
+			t.Errorf("expected %q, got %v", ErrRefundTooLarge, err)
+		}
+	})
+
+	t.Run("only refunds payments that were paid", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		store := NewFakeRefundStore(NewFakeFulfillmentStore(payment))
+		refunds := NewRefundService(store, NewPaymentProviders(NewSandboxProvider("", "sk_sandbox", nil)))
+
+		if _, err := refunds.Refund(ctx, payment.ReferenceNumber, 100, "customer asked", adminActor(3)); err != ErrRefundNotPaid {
+			t.Errorf("expected %q, got %v", ErrRefundNotPaid, err)
+		}
+
+		if _, err := refunds.Refund(ctx, payment.ReferenceNumber, 0, "customer asked", adminActor(3)); err != ErrRefundInvalidAmount {
+			t.Errorf("expected %q, got %v", ErrRefundInvalidAmount, err)
+		}
+	})
+
+	t.Run("gives the money back when the provider can't refund", func(t *testing.T) {
+		payment := pendingPayment(OriginatorSoloSavings)
+		payment.VerificationStatus = StatusSuccessful
+		payment.FulfillmentStatus = StatusSuccessful
+		store := NewFakeRefundStore(NewFakeFulfillmentStore(payment))
+		store.balances[store.accountCode(payment.ReferenceNumber)] = payment.PaymentAmount
+		// the sandbox has never heard of the charge
+		refunds := NewRefundService(store, NewPaymentProviders(NewSandboxProvider("", "sk_sandbox", nil)))
+
+		if _, err := refunds.Refund(ctx, payment.ReferenceNumber, 100000, "customer asked", adminActor(3)); !errors.Is(err, ErrSandboxChargeDoesNotExist) {
+			t.Errorf("expected %q, got %v", ErrSandboxChargeDoesNotExist, err)
+		}
+
+		if store.refunds[0].Status != RefundFailed || store.refunds[0].FailureReason == "" {
+			t.Errorf("expected a failed refund, got %+v", store.refunds[0])
+		}
+
+		if balance := store.balances[store.accountCode(payment.ReferenceNumber)]; balance != payment.PaymentAmount {
+			t.Errorf("expected the balance to be given back, got %s", balance)
+		}
+	})
+
+	t.Run("doesn't refund more than the customer has left", func(t *testing.T) {
+		_, refunds, store, payment := newPaidPayment(t)
+		store.balances[store.accountCode(payment.ReferenceNumber)] = 100
+
+		if _, err := refunds.Refund(ctx, payment.ReferenceNumber, 200000, "customer asked", adminActor(3)); err != ErrInsufficientLedgerFund {
+			t.Errorf("expected %q, got %v", ErrInsufficientLedgerFund, err)
+		}
+
+		if len(store.refunds) != 0 || len(store.audit) != 0 {
+			t.Errorf("expected nothing to be refunded, got %+v", store.refunds)
+		}
+	})
+
+	t.Run("refunds payments that can't be fulfilled", func(t *testing.T) {
+		payment := pendingPayment(OriginatorTargetSavings)
+		store := NewFakeRefundStore(NewFakeFulfillmentStore(payment))
+		// the plan was deleted after the payment was made
+		store.failWith = ErrFulfillmentTargetAbsent
+		sandbox := newSandboxProcessor(t, store, NewFakePayoutStore(), store)
+
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: payment.ReferenceNumber, Amount: payment.PaymentAmount})
+		if _, err := sandbox.Complete(ctx, payment.ReferenceNumber.String(), true); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if len(store.refunds) != 1 {
+			t.Fatalf("expected one refund, got %+v", store.refunds)
+		}
+
+		refund := store.refunds[0]
+		if refund.Amount != payment.PaymentAmount || refund.InitiatedBy != ActorSystem || refund.Held || refund.Status != RefundProcessed {
+			t.Errorf("expected the whole payment to be refunded, got %+v", refund)
+		}
+
+		// nothing was credited, so there is nothing in the ledger
+		if len(store.journals) != 0 {
+			t.Errorf("expected no journals, got %v", store.journals)
+		}
+	})
+}
+
+func TestDisputes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("holds the disputed amount until the dispute is won", func(t *testing.T) {
+		sandbox, _, store, payment := newPaidPayment(t)
+		code := store.accountCode(payment.ReferenceNumber)
+
+		dispute, _ := sandbox.Dispute(ctx, payment.ReferenceNumber.String(), 150000)
+
+		if balance := store.balances[code]; balance != 350000 {
+			t.Errorf("expected 150000 to be held, got a balance of %s", balance)
+		}
+
+		sandbox.ResolveDispute(ctx, dispute.ID, true)
+
+		if balance := store.balances[code]; balance != payment.PaymentAmount {
+			t.Errorf("expected the held amount back, got a balance of %s", balance)
+		}
+
+		want := []string{AuditDisputeOpened, AuditDisputeWon}
+		if got := store.actions(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("expected %v in the audit log, got %v", want, got)
+		}
+	})
+
+	t.Run("settles the held amount when the dispute is lost", func(t *testing.T) {
+		sandbox, _, store, payment := newPaidPayment(t)
+
+		dispute, _ := sandbox.Dispute(ctx, payment.ReferenceNumber.String(), payment.PaymentAmount)
+		sandbox.ResolveDispute(ctx, dispute.ID, false)
+
+		if balance := store.balances[store.accountCode(payment.ReferenceNumber)]; balance != 0 {
+			t.Errorf("expected the payment to be gone, got a balance of %s", balance)
+		}
+
+		key := disputeKey(ProviderSandbox, dispute.ID)
+		want := []string{"DISPUTE:" + key, "DISPUTE_LOST:" + key}
+		if got := store.journals; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("stays open without the money when the customer has spent it", func(t *testing.T) {
+		sandbox, _, store, payment := newPaidPayment(t)
+		store.balances[store.accountCode(payment.ReferenceNumber)] = 0
+
+		sandbox.Dispute(ctx, payment.ReferenceNumber.String(), payment.PaymentAmount)
+
+		for _, dispute := range store.disputes {
+			if dispute.Held || dispute.Status != DisputeOpen {
+				t.Errorf("expected an open dispute that isn't held, got %+v", dispute)
+			}
+		}
+	})
+
+	t.Run("opens a dispute that we only hear about when it is resolved", func(t *testing.T) {
+		_, refunds, store, payment := newPaidPayment(t)
+		sandbox, _ := refunds.providers.Get(ProviderSandbox)
+
+		err := refunds.HandleDispute(ctx, sandbox, ProviderDispute{ID: "41", Reference: payment.ReferenceNumber.String(), Amount: 900000, Status: DisputeLost})
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		dispute := store.disputes[disputeKey(ProviderSandbox, "41")]
+		if dispute.Status != DisputeLost || dispute.Amount != payment.PaymentAmount {
+			t.Errorf("expected a lost dispute for no more than the payment, got %+v", dispute)
+		}
+
+		// resent webhooks change nothing
+		refunds.HandleDispute(ctx, sandbox, ProviderDispute{ID: "41", Reference: payment.ReferenceNumber.String(), Amount: 900000, Status: DisputeLost})
+		if len(store.audit) != 2 {
+			t.Errorf("expected the dispute to be recorded once, got %+v", store.audit)
+		}
+	})
+}
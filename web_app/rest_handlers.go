@@ -1,123 +1,66 @@
 package web_app
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 
-	"github.com/google/uuid"
+	chi "github.com/go-chi/chi/v5"
 )
 
-type PaystackGenericData struct {
-	Event string `json:"event"`
-}
-
-type PaystackPaymentSuccessful struct {
-	Data PaystackPaymentSuccessfulDataObject
-}
-
-type PaystackPaymentFailure struct {
-	Data PaystackPaymentFailureDataObject
-}
-
-type PaystackPaymentSuccessfulDataObject struct {
-	Amount          uint64    `json:"amount"`
-	ReferenceNumber uuid.UUID `json:"offline_reference"`
+// paystackVerificationWebhook is the webhook URL that Paystack was
+// set up with before we took other providers
+func (h *HandlerManager) paystackVerificationWebhook(w http.ResponseWriter, r *http.Request) {
+	h.receiveWebhook(w, r, ProviderPaystack)
 }
 
-type PaystackPaymentFailureDataObject struct {
-	Amount          uint64    `json:"amount"`
-	ReferenceNumber uuid.UUID `json:"offline_reference"`
+func (h *HandlerManager) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	h.receiveWebhook(w, r, chi.URLParam(r, "provider"))
 }
 
-func (h *HandlerManager) paystackVerificationWebhook(w http.ResponseWriter, r *http.Request) {
-	// This is a POST endpoint that we'll give to paystack as a
-	// webhook to verify payments
-
-	// First, we verify that the request is coming from paystack,
-	// by checking the hash key sent in the request
+// receiveWebhook saves a webhook from a payment provider and hands it
+// to the webhook worker. The provider checks that it signed it.
+func (h *HandlerManager) receiveWebhook(w http.ResponseWriter, r *http.Request, providerName string) {
+	provider, err := h.payments.Get(providerName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	paystackSignature := r.Header.Get("x-paystack-signature")
-	bodyAsBytes, err := io.ReadAll(r.Body)
+	signature := provider.WebhookSignature(r.Header)
+	bodyAsBytes, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodySize))
 
 	if err != nil {
 		log.Printf("an error occured while trying to read body %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyAsBytes))
-
-	isValidMac := validateMAC(bodyAsBytes, []byte(paystackSignature), []byte(h.paystackSecretKey))
-	if !isValidMac {
-		w.WriteHeader(http.StatusForbidden)
+	webhook, err := provider.ParseWebhook(bodyAsBytes, signature)
+	if err != nil {
+		log.Printf("error while trying to decode %s webhook %s", providerName, err)
+		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	var jsonBody PaystackGenericData
-	err = json.NewDecoder(r.Body).Decode(&jsonBody)
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyAsBytes))
+	// the event is saved before we do anything else with it. If
+	// saving fails, the provider will retry
+	id, duplicate, err := h.store.SaveWebhookEvent(webhookEventToSave(providerName, bodyAsBytes, signature, webhook))
 
 	if err != nil {
-		log.Printf("error while trying to decode data %s", err)
+		log.Printf("couldn't save %s %s event: %s", providerName, webhook.EventType, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	// TODO: a good solution is to store the secret key as its byte representation to avoid the constant transformation
-
-	// TODO: change this to a switch case
-	if jsonBody.Event == "paymentrequest.success" {
-		// marshal the rest of the data into the paymentSuccess object
-		var data PaystackPaymentSuccessful
-		err := json.NewDecoder(r.Body).Decode(&data)
-
-		if err != nil {
-			log.Printf("error while trying to decode paymentrequest.success: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// We handle successes and failures, we can handle the rest as time goes on
-
-		if err != nil {
-			log.Printf("The conversion of the amount passed into the payment object from paystack has failed: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		_, err = h.store.UpdateSoloSaverPaymentInformation(data.Data.Amount, data.Data.ReferenceNumber)
 
-		if err != nil {
-			log.Printf("Couldn't update payment information with error %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+	if !webhook.SignatureValid {
+		w.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	if jsonBody.Event == "paymentrequest.failure" {
-		var data PaystackPaymentFailure
-		err := json.NewDecoder(r.Body).Decode(&data)
-
-		// TODO: Add payment failure reason
-		_, err = h.store.UpdateSoloSaverPaymentFailure(data.Data.ReferenceNumber)
-
-		if err != nil {
-			log.Printf("Couldn't update payment information with error %s", err)
-		}
-		return
+	if !duplicate {
+		h.webhooks.Enqueue(id)
 	}
 
-	return
-}
-
-func validateMAC(message, messageMAC, signingKey []byte) bool {
-	// the signingKey is, in this case, the secret key from Paystack
-	mac := hmac.New(sha512.New, signingKey)
-	mac.Write(message)
-	expectedMAC := mac.Sum(nil)
-	return hmac.Equal(messageMAC, expectedMAC)
+	w.WriteHeader(http.StatusOK)
 }
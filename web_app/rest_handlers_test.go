@@ -1,9 +0,0 @@
-package web_app
-
-import "testing"
-
-func TestValidMACFunction(t *testing.T) {
-	t.Run("it fails when the macs do not match", func(t *testing.T) {
-		
-	})
-}
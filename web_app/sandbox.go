@@ -0,0 +1,598 @@
+package web_app
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+)
+
+// The sandbox is a payment provider that runs inside the server. It
+// has a checkout page where payments can be made or declined, and it
+// sends webhooks back to the server like a real provider would, so
+// payments can be tried out in development and tests without a
+// network connection. Its charges only live in memory.
+
+const sandboxDefaultSecretKey = "sk_sandbox"
+
+// The webhook events that the sandbox sends
+const (
+	SandboxChargeSuccess    = "charge.success"
+	SandboxChargeFailed     = "charge.failed"
+	SandboxRefundProcessed  = "refund.processed"
+	SandboxTransferSuccess  = "transfer.success"
+	SandboxTransferFailed   = "transfer.failed"
+	SandboxTransferReversed = "transfer.reversed"
+	SandboxDisputeCreate    = "charge.dispute.create"
+	SandboxDisputeResolve   = "charge.dispute.resolve"
+)
+
+var (
+	ErrSandboxChargeDoesNotExist    = errors.New("sandbox charge does not exist")
+	ErrSandboxChargeCompleted       = errors.New("sandbox charge has already been paid or declined")
+	ErrSandboxRefundTooLarge        = errors.New("sandbox refund is more than what is left of the charge")
+	ErrSandboxWebhookFailed         = errors.New("the server did not accept the sandbox webhook")
+	ErrSandboxRecipientDoesNotExist = errors.New("sandbox transfer recipient does not exist")
+	ErrSandboxTransferDoesNotExist  = errors.New("sandbox transfer does not exist")
+	ErrSandboxTransferCompleted     = errors.New("sandbox transfer can't be moved to that status")
+	ErrSandboxDisputeDoesNotExist   = errors.New("sandbox dispute does not exist")
+	ErrSandboxDisputeResolved       = errors.New("sandbox dispute has already been resolved")
+)
+
+type sandboxCharge struct {
+	ProviderCharge
+	Email       string
+	CallbackURL string
+	Refunded    Money
+	CreatedAt   time.Time
+}
+
+type sandboxTransfer struct {
+	ProviderTransfer
+	Recipient BankAccount
+	Reason    string
+	CreatedAt time.Time
+}
+
+// sandboxEvent is the body of a sandbox webhook
+type sandboxEvent struct {
+	Event string           `json:"event"`
+	Data  sandboxEventData `json:"data"`
+}
+
+type sandboxEventData struct {
+	ID              string    `json:"id"`
+	Reference       string    `json:"reference"`
+	Amount          Money     `json:"amount"`
+	Currency        string    `json:"currency"`
+	Status          string    `json:"status"`
+	GatewayResponse string    `json:"gateway_response"`
+	PaidAt          time.Time `json:"paid_at"`
+}
+
+type SandboxProvider struct {
+	// baseURL is where the server is, which hosts the checkout page
+	// and receives the webhooks
+	baseURL    string
+	secretKey  string
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	charges    map[string]*sandboxCharge
+	recipients map[string]BankAccount
+	// transfers are keyed by our reference, like charges
+	transfers map[string]*sandboxTransfer
+	// disputes are keyed by their id
+	disputes map[string]*ProviderDispute
+	lastID   int64
+}
+
+func NewSandboxProvider(baseURL, secretKey string, httpClient *http.Client) *SandboxProvider {
+	return &SandboxProvider{
+		baseURL:    baseURL,
+		secretKey:  secretKey,
+		httpClient: httpClient,
+		charges:    map[string]*sandboxCharge{},
+		recipients: map[string]BankAccount{},
+		transfers:  map[string]*sandboxTransfer{},
+		disputes:   map[string]*ProviderDispute{},
+	}
+}
+
+func (s *SandboxProvider) Name() string {
+	return ProviderSandbox
+}
+
+func (s *SandboxProvider) Initialize(ctx context.Context, request PaymentRequest) (PaymentAuthorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reference := request.ReferenceNumber.String()
+	s.lastID++
+	s.charges[reference] = &sandboxCharge{
+		ProviderCharge: ProviderCharge{
+			ID:                strconv.FormatInt(s.lastID, 10),
+			ProviderReference: reference,
+			Reference:         reference,
+			Amount:            request.Amount,
+			Currency:          "NGN",
+			Status:            ChargePending,
+		},
+		Email:       request.Email,
+		CallbackURL: request.CallbackURL,
+		CreatedAt:   time.Now(),
+	}
+
+	return PaymentAuthorization{AuthorizationURL: s.baseURL + "/sandbox/checkout/" + reference, AccessCode: reference}, nil
+}
+
+func (s *SandboxProvider) Verify(ctx context.Context, reference string) (ProviderCharge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	charge, ok := s.charges[reference]
+	if !ok {
+		return ProviderCharge{}, fmt.Errorf("%w: %s", ErrSandboxChargeDoesNotExist, reference)
+	}
+	return charge.ProviderCharge, nil
+}
+
+func (s *SandboxProvider) ListCharges(ctx context.Context, from, to time.Time) ([]ProviderCharge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var charges []ProviderCharge
+	for _, charge := range s.charges {
+		if !charge.CreatedAt.Before(from) && charge.CreatedAt.Before(to) {
+			charges = append(charges, charge.ProviderCharge)
+		}
+	}
+	return charges, nil
+}
+
+func (s *SandboxProvider) WebhookSignature(header http.Header) string {
+	return header.Get("x-sandbox-signature")
+}
+
+func (s *SandboxProvider) ParseWebhook(body []byte, signature string) (ProviderWebhook, error) {
+	var event sandboxEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return ProviderWebhook{}, err
+	}
+
+	webhook := ProviderWebhook{
+		EventID:        fmt.Sprintf("%s:%s", event.Event, event.Data.ID),
+		EventType:      event.Event,
+		SignatureValid: hmac.Equal([]byte(signature), []byte(s.sign(body))),
+	}
+
+	switch event.Event {
+	case SandboxChargeSuccess, SandboxChargeFailed:
+		webhook.Kind = WebhookKindCharge
+		webhook.Charge = ProviderCharge{
+			ID:                event.Data.ID,
+			ProviderReference: event.Data.Reference,
+			Reference:         event.Data.Reference,
+			Amount:            event.Data.Amount,
+			Currency:          event.Data.Currency,
+			Status:            event.Data.Status,
+			GatewayResponse:   event.Data.GatewayResponse,
+			PaidAt:            event.Data.PaidAt,
+		}
+	case SandboxRefundProcessed:
+		webhook.Kind = WebhookKindRefund
+		webhook.Refund = ProviderRefund{
+			ID:        event.Data.ID,
+			Reference: event.Data.Reference,
+			Amount:    event.Data.Amount,
+			Status:    event.Data.Status,
+		}
+	case SandboxDisputeCreate, SandboxDisputeResolve:
+		webhook.Kind = WebhookKindDispute
+		webhook.Dispute = ProviderDispute{
+			ID:        event.Data.ID,
+			Reference: event.Data.Reference,
+			Amount:    event.Data.Amount,
+			Status:    event.Data.Status,
+			Reason:    event.Data.GatewayResponse,
+		}
+	case SandboxTransferSuccess, SandboxTransferFailed, SandboxTransferReversed:
+		webhook.Kind = WebhookKindTransfer
+		webhook.Transfer = ProviderTransfer{
+			ID:            event.Data.ID,
+			Reference:     event.Data.Reference,
+			Amount:        event.Data.Amount,
+			Status:        event.Data.Status,
+			FailureReason: event.Data.GatewayResponse,
+		}
+	}
+
+	return webhook, nil
+}
+
+func (s *SandboxProvider) Refund(ctx context.Context, reference string, amount Money) (ProviderRefund, error) {
+	s.mu.Lock()
+	charge, ok := s.charges[reference]
+	if !ok {
+		s.mu.Unlock()
+		return ProviderRefund{}, fmt.Errorf("%w: %s", ErrSandboxChargeDoesNotExist, reference)
+	}
+
+	if charge.Status != ChargeSuccessful {
+		s.mu.Unlock()
+		return ProviderRefund{}, fmt.Errorf("%w: %s", ErrChargeNotSuccessful, charge.Status)
+	}
+
+	refunded, err := charge.Refunded.Add(amount)
+	if err != nil || refunded > charge.Amount {
+		s.mu.Unlock()
+		return ProviderRefund{}, ErrSandboxRefundTooLarge
+	}
+
+	charge.Refunded = refunded
+	s.lastID++
+	refund := ProviderRefund{ID: strconv.FormatInt(s.lastID, 10), Reference: reference, Amount: amount, Status: ProviderRefundProcessed}
+	s.mu.Unlock()
+
+	err = s.sendWebhook(ctx, SandboxRefundProcessed, sandboxEventData{
+		ID:        refund.ID,
+		Reference: reference,
+		Amount:    amount,
+		Currency:  "NGN",
+		Status:    refund.Status,
+	})
+
+	return refund, err
+}
+
+// Complete pays or declines a charge, as the customer would on the
+// checkout page, and sends the webhook for it. It returns where the
+// customer should go next.
+func (s *SandboxProvider) Complete(ctx context.Context, reference string, pay bool) (string, error) {
+	s.mu.Lock()
+	charge, ok := s.charges[reference]
+	if !ok {
+		s.mu.Unlock()
+		return "", fmt.Errorf("%w: %s", ErrSandboxChargeDoesNotExist, reference)
+	}
+
+	if charge.Status != ChargePending {
+		s.mu.Unlock()
+		return "", ErrSandboxChargeCompleted
+	}
+
+	event := SandboxChargeSuccess
+	charge.Status = ChargeSuccessful
+	charge.GatewayResponse = "Approved"
+	charge.PaidAt = time.Now()
+	if !pay {
+		event = SandboxChargeFailed
+		charge.Status = ChargeFailed
+		charge.GatewayResponse = "Declined"
+	}
+
+	data := sandboxEventData{
+		ID:              charge.ID,
+		Reference:       charge.Reference,
+		Amount:          charge.Amount,
+		Currency:        charge.Currency,
+		Status:          charge.Status,
+		GatewayResponse: charge.GatewayResponse,
+		PaidAt:          charge.PaidAt,
+	}
+	callbackURL := charge.CallbackURL
+	s.mu.Unlock()
+
+	return callbackURL, s.sendWebhook(ctx, event, data)
+}
+
+func (s *SandboxProvider) CreateTransferRecipient(ctx context.Context, account BankAccount) (TransferRecipient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	recipient := TransferRecipient{
+		Code:        fmt.Sprintf("RCP_sandbox_%d", s.lastID),
+		AccountName: "Sandbox Account " + account.MaskedAccountNumber(),
+	}
+	account.AccountName = recipient.AccountName
+	s.recipients[recipient.Code] = account
+
+	return recipient, nil
+}
+
+// Transfer makes a pending transfer, which is completed on the
+// transfers page. Like a real provider, a reference that has been
+// used before gets the transfer that was made with it.
+func (s *SandboxProvider) Transfer(ctx context.Context, request TransferRequest) (ProviderTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reference := request.Reference.String()
+	if transfer, ok := s.transfers[reference]; ok {
+		return transfer.ProviderTransfer, nil
+	}
+
+	recipient, ok := s.recipients[request.RecipientCode]
+	if !ok {
+		return ProviderTransfer{}, fmt.Errorf("%w: %s", ErrSandboxRecipientDoesNotExist, request.RecipientCode)
+	}
+
+	s.lastID++
+	transfer := &sandboxTransfer{
+		ProviderTransfer: ProviderTransfer{
+			ID:        strconv.FormatInt(s.lastID, 10),
+			Reference: reference,
+			Amount:    request.Amount,
+			Status:    TransferPending,
+		},
+		Recipient: recipient,
+		Reason:    request.Reason,
+		CreatedAt: time.Now(),
+	}
+	s.transfers[reference] = transfer
+
+	return transfer.ProviderTransfer, nil
+}
+
+func (s *SandboxProvider) VerifyTransfer(ctx context.Context, id string) (ProviderTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, transfer := range s.transfers {
+		if transfer.ID == id {
+			return transfer.ProviderTransfer, nil
+		}
+	}
+	return ProviderTransfer{}, fmt.Errorf("%w: %s", ErrSandboxTransferDoesNotExist, id)
+}
+
+// CompleteTransfer moves a transfer to status, as the bank would, and
+// sends the webhook for it. Pending transfers succeed or fail, and
+// successful ones can be reversed.
+func (s *SandboxProvider) CompleteTransfer(ctx context.Context, reference, status string) error {
+	s.mu.Lock()
+	transfer, ok := s.transfers[reference]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrSandboxTransferDoesNotExist, reference)
+	}
+
+	var event string
+	switch {
+	case status == TransferSuccessful && transfer.Status == TransferPending:
+		event = SandboxTransferSuccess
+	case status == TransferFailed && transfer.Status == TransferPending:
+		event = SandboxTransferFailed
+		transfer.FailureReason = "Account could not be credited"
+	case status == TransferReversed && transfer.Status == TransferSuccessful:
+		event = SandboxTransferReversed
+		transfer.FailureReason = "Transfer was reversed by the bank"
+	default:
+		s.mu.Unlock()
+		return ErrSandboxTransferCompleted
+	}
+
+	transfer.Status = status
+	data := sandboxEventData{
+		ID:              transfer.ID,
+		Reference:       transfer.Reference,
+		Amount:          transfer.Amount,
+		Currency:        "NGN",
+		Status:          transfer.Status,
+		GatewayResponse: transfer.FailureReason,
+	}
+	s.mu.Unlock()
+
+	return s.sendWebhook(ctx, event, data)
+}
+
+// Dispute opens a dispute for amount of a paid charge, as the
+// customer's bank would, and sends the webhook for it
+func (s *SandboxProvider) Dispute(ctx context.Context, reference string, amount Money) (ProviderDispute, error) {
+	s.mu.Lock()
+	charge, ok := s.charges[reference]
+	if !ok {
+		s.mu.Unlock()
+		return ProviderDispute{}, fmt.Errorf("%w: %s", ErrSandboxChargeDoesNotExist, reference)
+	}
+
+	if charge.Status != ChargeSuccessful {
+		s.mu.Unlock()
+		return ProviderDispute{}, fmt.Errorf("%w: %s", ErrChargeNotSuccessful, charge.Status)
+	}
+
+	s.lastID++
+	dispute := &ProviderDispute{
+		ID:        strconv.FormatInt(s.lastID, 10),
+		Reference: reference,
+		Amount:    amount,
+		Status:    DisputeOpen,
+		Reason:    "chargeback",
+	}
+	s.disputes[dispute.ID] = dispute
+	opened := *dispute
+	s.mu.Unlock()
+
+	return opened, s.sendDisputeWebhook(ctx, SandboxDisputeCreate, opened)
+}
+
+// ResolveDispute decides an open dispute and sends the webhook for it
+func (s *SandboxProvider) ResolveDispute(ctx context.Context, id string, won bool) error {
+	s.mu.Lock()
+	dispute, ok := s.disputes[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrSandboxDisputeDoesNotExist, id)
+	}
+
+	if dispute.Status != DisputeOpen {
+		s.mu.Unlock()
+		return ErrSandboxDisputeResolved
+	}
+
+	dispute.Status = DisputeLost
+	if won {
+		dispute.Status = DisputeWon
+	}
+	resolved := *dispute
+	s.mu.Unlock()
+
+	return s.sendDisputeWebhook(ctx, SandboxDisputeResolve, resolved)
+}
+
+func (s *SandboxProvider) sendDisputeWebhook(ctx context.Context, event string, dispute ProviderDispute) error {
+	return s.sendWebhook(ctx, event, sandboxEventData{
+		ID:              dispute.ID,
+		Reference:       dispute.Reference,
+		Amount:          dispute.Amount,
+		Currency:        "NGN",
+		Status:          dispute.Status,
+		GatewayResponse: dispute.Reason,
+	})
+}
+
+func (s *SandboxProvider) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.secretKey))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *SandboxProvider) sendWebhook(ctx context.Context, event string, data sandboxEventData) error {
+	body, err := json.Marshal(sandboxEvent{Event: event, Data: data})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/utility/webhooks/"+ProviderSandbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("x-sandbox-signature", s.sign(body))
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s", ErrSandboxWebhookFailed, response.Status)
+	}
+
+	return nil
+}
+
+// Handler serves the checkout page, and a page where transfers are
+// completed. It is mounted at /sandbox.
+func (s *SandboxProvider) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/checkout/{reference}", s.checkoutGetHandler)
+	r.Post("/checkout/{reference}", s.checkoutPostHandler)
+	r.Get("/transfers", s.transfersGetHandler)
+	r.Post("/transfers/{reference}", s.transferPostHandler)
+	return r
+}
+
+func (s *SandboxProvider) checkoutGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+	reference := chi.URLParam(r, "reference")
+
+	s.mu.Lock()
+	charge, ok := s.charges[reference]
+	var information sandboxCharge
+	if ok {
+		information = *charge
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "This payment does not exist", http.StatusNotFound)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("./web_app/templates/sandbox-checkout.html"))
+
+	if err := tmpl.Execute(w, information); err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+func (s *SandboxProvider) checkoutPostHandler(w http.ResponseWriter, r *http.Request) {
+	reference := chi.URLParam(r, "reference")
+
+	callbackURL, err := s.Complete(r.Context(), reference, r.FormValue("outcome") == "pay")
+	if errors.Is(err, ErrSandboxChargeDoesNotExist) {
+		http.Error(w, "This payment does not exist", http.StatusNotFound)
+		return
+	}
+	if err == ErrSandboxChargeCompleted {
+		http.Error(w, "This payment has already been completed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		// the charge is completed either way, like with a real
+		// provider whose webhook didn't get through
+		log.Printf("sandbox webhook for %s failed: %s", reference, err)
+	}
+
+	if callbackURL == "" {
+		callbackURL = "/dashboard/savings"
+	}
+
+	http.Redirect(w, r, callbackURL, http.StatusSeeOther)
+}
+
+func (s *SandboxProvider) transfersGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/html")
+
+	s.mu.Lock()
+	transfers := make([]sandboxTransfer, 0, len(s.transfers))
+	for _, transfer := range s.transfers {
+		transfers = append(transfers, *transfer)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].CreatedAt.After(transfers[j].CreatedAt) })
+
+	tmpl := template.Must(template.ParseFiles("./web_app/templates/sandbox-transfers.html"))
+
+	if err := tmpl.Execute(w, transfers); err != nil {
+		http.Error(w, "Something went wrong", http.StatusInternalServerError)
+		log.Printf("error %q from url %q", err, r.URL.Path)
+	}
+}
+
+func (s *SandboxProvider) transferPostHandler(w http.ResponseWriter, r *http.Request) {
+	reference := chi.URLParam(r, "reference")
+
+	err := s.CompleteTransfer(r.Context(), reference, r.FormValue("outcome"))
+	if errors.Is(err, ErrSandboxTransferDoesNotExist) {
+		http.Error(w, "This transfer does not exist", http.StatusNotFound)
+		return
+	}
+	if err == ErrSandboxTransferCompleted {
+		http.Error(w, "This transfer can't be moved to that status", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("sandbox webhook for transfer %s failed: %s", reference, err)
+	}
+
+	http.Redirect(w, r, "/sandbox/transfers", http.StatusSeeOther)
+}
@@ -0,0 +1,158 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// newSandboxWithInbox points a sandbox at a server that keeps the
+// webhooks it is sent
+func newSandboxWithInbox(t *testing.T) (*SandboxProvider, *[]ProviderWebhook) {
+	t.Helper()
+
+	var sandbox *SandboxProvider
+	var inbox []ProviderWebhook
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		webhook, err := sandbox.ParseWebhook(body, sandbox.WebhookSignature(r.Header))
+		if err != nil || !webhook.SignatureValid {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		inbox = append(inbox, webhook)
+	}))
+	t.Cleanup(server.Close)
+
+	sandbox = NewSandboxProvider(server.URL, "sk_sandbox", server.Client())
+	return sandbox, &inbox
+}
+
+func TestSandboxProvider(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends a signed webhook when a charge is paid", func(t *testing.T) {
+		sandbox, inbox := newSandboxWithInbox(t)
+		reference := uuid.New()
+
+		authorization, _ := sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 250000, CallbackURL: "/dashboard/savings/solo-saver"})
+		if !strings.HasSuffix(authorization.AuthorizationURL, "/sandbox/checkout/"+reference.String()) {
+			t.Errorf("unexpected checkout page %q", authorization.AuthorizationURL)
+		}
+
+		callbackURL, err := sandbox.Complete(ctx, reference.String(), true)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if callbackURL != "/dashboard/savings/solo-saver" {
+			t.Errorf("unexpected callback %q", callbackURL)
+		}
+
+		if len(*inbox) != 1 || (*inbox)[0].Kind != WebhookKindCharge || (*inbox)[0].Charge.Status != ChargeSuccessful || (*inbox)[0].Charge.Amount != 250000 {
+			t.Fatalf("unexpected webhooks %+v", *inbox)
+		}
+
+		charge, _ := sandbox.Verify(ctx, reference.String())
+		if charge.Status != ChargeSuccessful {
+			t.Errorf("expected the charge to be verified as paid, got %q", charge.Status)
+		}
+	})
+
+	t.Run("a charge can only be completed once", func(t *testing.T) {
+		sandbox, _ := newSandboxWithInbox(t)
+		reference := uuid.New()
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 250000})
+		sandbox.Complete(ctx, reference.String(), false)
+
+		if _, err := sandbox.Complete(ctx, reference.String(), true); err != ErrSandboxChargeCompleted {
+			t.Errorf("expected %q, got %v", ErrSandboxChargeCompleted, err)
+		}
+	})
+
+	t.Run("refunds no more than was paid", func(t *testing.T) {
+		sandbox, inbox := newSandboxWithInbox(t)
+		reference := uuid.New()
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 250000})
+
+		if _, err := sandbox.Refund(ctx, reference.String(), 100); !errors.Is(err, ErrChargeNotSuccessful) {
+			t.Errorf("expected an unpaid charge not to be refunded, got %v", err)
+		}
+
+		sandbox.Complete(ctx, reference.String(), true)
+
+		if _, err := sandbox.Refund(ctx, reference.String(), 200000); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if _, err := sandbox.Refund(ctx, reference.String(), 50001); err != ErrSandboxRefundTooLarge {
+			t.Errorf("expected %q, got %v", ErrSandboxRefundTooLarge, err)
+		}
+
+		if last := (*inbox)[len(*inbox)-1]; last.Kind != WebhookKindRefund || last.Refund.Amount != 200000 || last.Refund.Status != ProviderRefundProcessed {
+			t.Errorf("expected a refund webhook, got %+v", last)
+		}
+	})
+
+	t.Run("disputes are opened and resolved once", func(t *testing.T) {
+		sandbox, inbox := newSandboxWithInbox(t)
+		reference := uuid.New()
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 250000})
+		sandbox.Complete(ctx, reference.String(), true)
+
+		dispute, err := sandbox.Dispute(ctx, reference.String(), 250000)
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if err := sandbox.ResolveDispute(ctx, dispute.ID, true); err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if err := sandbox.ResolveDispute(ctx, dispute.ID, false); err != ErrSandboxDisputeResolved {
+			t.Errorf("expected %q, got %v", ErrSandboxDisputeResolved, err)
+		}
+
+		opened, resolved := (*inbox)[len(*inbox)-2], (*inbox)[len(*inbox)-1]
+		if opened.Kind != WebhookKindDispute || opened.Dispute.Status != DisputeOpen || resolved.Dispute.Status != DisputeWon || resolved.Dispute.Reference != reference.String() {
+			t.Errorf("unexpected dispute webhooks %+v and %+v", opened, resolved)
+		}
+	})
+
+	t.Run("the checkout page completes the charge", func(t *testing.T) {
+		sandbox, inbox := newSandboxWithInbox(t)
+		reference := uuid.New()
+		sandbox.Initialize(ctx, PaymentRequest{ReferenceNumber: reference, Amount: 250000, CallbackURL: "/dashboard/savings/solo-saver"})
+
+		form := url.Values{"outcome": {"decline"}}
+		request := httptest.NewRequest(http.MethodPost, "/checkout/"+reference.String(), strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := httptest.NewRecorder()
+
+		sandbox.Handler().ServeHTTP(response, request)
+
+		if response.Code != http.StatusSeeOther || response.Header().Get("Location") != "/dashboard/savings/solo-saver" {
+			t.Errorf("expected a redirect back to the dashboard, got %d to %q", response.Code, response.Header().Get("Location"))
+		}
+
+		if len(*inbox) != 1 || (*inbox)[0].Charge.Status != ChargeFailed {
+			t.Errorf("expected a failed charge webhook, got %+v", *inbox)
+		}
+
+		request = httptest.NewRequest(http.MethodPost, "/checkout/"+uuid.NewString(), nil)
+		response = httptest.NewRecorder()
+		sandbox.Handler().ServeHTTP(response, request)
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for an unknown charge, got %d", response.Code)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package web_app
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
 	"log"
@@ -16,7 +17,24 @@ import (
 var ErrorEmptyRouteMap error = errors.New("passed empty RouteMap as arg")
 
 // TODO: write tests for the handlers getting passed in
-func WebAppServer(secretKey []byte, paystackPublicKey, paystackSecretKey string) (handler http.Handler, cleanUp func() error, err error) {
+func WebAppServer(secretKey []byte, baseURL string, payments *PaymentProviders) (handler http.Handler, cleanUp func() error, err error) {
+	penaltyPolicy, err := LoanPenaltyPolicyFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	creditPolicy, err := CreditPolicyFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	notifier, err := NotifiersFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	approvalPolicy, err := ApprovalPolicyFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	partialsManager := GetPartialsManager(os.DirFS("./partials"))
 	db := DB{}
 	db.Connect()
@@ -28,7 +46,32 @@ func WebAppServer(secretKey []byte, paystackPublicKey, paystackSecretKey string)
 	// set this field based on if it is dev or prod
 	// store.Options.Secure = true
 
-	handlerManager := NewHandlerManager(partialsManager, &db, cookieStore, paystackPublicKey, paystackSecretKey)
+	// webhooks are processed in the background, after they've been saved
+	refunds := NewRefundService(&db, payments)
+	payouts := NewPayoutService(&db, payments)
+	processor := NewPaymentEventProcessor(&db, payments, payouts, refunds)
+	webhookWorker := NewWebhookWorker(&db, processor.Process)
+	workerContext, stopWorker := context.WithCancel(context.Background())
+	go webhookWorker.Run(workerContext)
+	// payments whose webhook never arrived are checked with the provider
+	go NewPaymentReconciler(&db, payments, refunds).Run(workerContext)
+	// payouts that the provider couldn't be asked to send are sent again
+	go payouts.Run(workerContext)
+	// approved admin actions that were interrupted are carried out again
+	go NewAdminActionResumer(&db, &db, payouts).Run(workerContext)
+	// late loan installments are charged penalties and customers are
+	// reminded about them. Only one process should collect, so it is
+	// turned on for the one that does.
+	if os.Getenv("RUN_LOAN_COLLECTIONS") == "true" {
+		go NewLoanCollector(&db, notifier, penaltyPolicy, baseURL).Run(workerContext)
+	}
+	// matured investments are paid into solo savings or rolled over
+	go NewInvestmentMaturer(&db, notifier, baseURL).Run(workerContext)
+
+	handlerManager := NewHandlerManager(partialsManager, &db, cookieStore, payments, baseURL, webhookWorker)
+	handlerManager.credit = creditPolicy
+	handlerManager.notifier = notifier
+	handlerManager.approvals = approvalPolicy
 	r := chi.NewRouter()
 
 	csrfMiddleware := csrf.Protect(
@@ -72,13 +115,27 @@ func WebAppServer(secretKey []byte, paystackPublicKey, paystackSecretKey string)
 	dashboardSubRouter.Get("/", handlerManager.dashboardHomeGetHandler)
 	dashboardSubRouter.Get("/home", handlerManager.dashboardHomeGetHandler)
 	dashboardSubRouter.Get("/profile", handlerManager.profileGetHandler)
+	dashboardSubRouter.Get("/transactions", handlerManager.transactionsGetHandler)
+	dashboardSubRouter.Get("/transactions/{product}", handlerManager.transactionsGetHandler)
+	dashboardSubRouter.Get("/statements", handlerManager.statementsGetHandler)
+	dashboardSubRouter.Get("/statements/download", handlerManager.statementsDownloadGetHandler)
 	dashboardSubRouter.Get("/savings", handlerManager.savingsGetHandler)
 	dashboardSubRouter.Get("/loans", handlerManager.loansGetHandler)
+	dashboardSubRouter.Post("/loans/repay", handlerManager.loansRepayPostHandler)
 	dashboardSubRouter.Get("/loans/get-loan", handlerManager.getLoansGetHandler)
 	dashboardSubRouter.Post("/loans/get-loan", handlerManager.getLoansPostHandler)
+	dashboardSubRouter.Post("/loans/guarantors", handlerManager.loanGuarantorsPostHandler)
+	dashboardSubRouter.Get("/guarantees", handlerManager.guaranteesGetHandler)
+	dashboardSubRouter.Get("/guarantees/{token}", handlerManager.guaranteeGetHandler)
+	dashboardSubRouter.Post("/guarantees/{token}", handlerManager.guaranteePostHandler)
 	dashboardSubRouter.Get("/investments", handlerManager.investmentsGetHandler)
 	dashboardSubRouter.Get("/investments/form", handlerManager.investmentsFormGetHandler)
 	dashboardSubRouter.Post("/investments/form", handlerManager.investmentsFormPostHandler)
+	dashboardSubRouter.Get("/investments/form/confirm", handlerManager.investmentsConfirmGetHandler)
+	dashboardSubRouter.Post("/investments/form/confirm", handlerManager.investmentsConfirmPostHandler)
+	dashboardSubRouter.Post("/investments/{positionID}/rollover", handlerManager.investmentRolloverPostHandler)
+	dashboardSubRouter.Get("/investments/{positionID}/certificate", handlerManager.investmentCertificateGetHandler)
+	dashboardSubRouter.Post("/investments/applications/{applicationID}/pay", handlerManager.investmentApplicationPayPostHandler)
 	dashboardSubRouter.Get("/fragments/bvn", handlerManager.bvnModalGetHandler)
 	dashboardSubRouter.Post("/fragments/bvn", handlerManager.addBVNPostHandler)
 	dashboardSubRouter.Get("/savings/family-vault", handlerManager.familyVaultGetHandler)
@@ -87,26 +144,67 @@ func WebAppServer(secretKey []byte, paystackPublicKey, paystackSecretKey string)
 	dashboardSubRouter.Get("/savings/target-savings", handlerManager.targetSavingsGetHandler)
 	dashboardSubRouter.Get("/savings/solo-saver", handlerManager.soloSavingsGetHandler)
 	dashboardSubRouter.Post("/savings/solo-saver", handlerManager.soloSavingsAddFunds)
+	dashboardSubRouter.Post("/savings/solo-saver/withdraw", handlerManager.soloSavingsWithdrawPostHandler)
+	dashboardSubRouter.Get("/bank-accounts", handlerManager.bankAccountsGetHandler)
+	dashboardSubRouter.Post("/bank-accounts", handlerManager.bankAccountsPostHandler)
 	dashboardSubRouter.Get("/thrift", handlerManager.thriftGetHandler)
 	dashboardSubRouter.Get("/thrift/new", handlerManager.thriftNewGetHandler)
 	dashboardSubRouter.Get("/thrift/{thriftID}", handlerManager.thriftPlanGetHandler)	
 	dashboardSubRouter.Get("/logout", handlerManager.loginGetHandler)
 	
 	apiSubRouter.Post("/paystack-verification-webhook", handlerManager.paystackVerificationWebhook)
+	apiSubRouter.Post("/webhooks/{provider}", handlerManager.paymentWebhookHandler)
+
+	// the sandbox's checkout page stands in for the provider's, so it
+	// sits outside of our own routers
+	if sandbox, err := payments.Get(ProviderSandbox); err == nil {
+		r.Mount("/sandbox", sandbox.(*SandboxProvider).Handler())
+	}
 	
+	// every admin can see the home page, and each other admin route
+	// needs the permission for what it does
+	can := handlerManager.requirePermission
 	adminSubRouter.Get("/", handlerManager.adminHomeGetHandler)
+	adminSubRouter.With(can(PermissionPaymentsView)).Get("/webhooks", handlerManager.adminWebhooksGetHandler)
+	adminSubRouter.With(can(PermissionWebhooksReplay)).Post("/webhooks/{eventID}/replay", handlerManager.adminWebhookReplayPostHandler)
+	adminSubRouter.With(can(PermissionPaymentsView)).Get("/payments", handlerManager.adminPaymentsGetHandler)
+	adminSubRouter.With(can(PermissionPaymentsView)).Get("/payments/{reference}", handlerManager.adminPaymentGetHandler)
+	adminSubRouter.With(can(PermissionPaymentsRefund)).Post("/payments/{reference}/refunds", handlerManager.adminPaymentRefundPostHandler)
+	adminSubRouter.With(can(PermissionLoansView)).Get("/loan-applications", handlerManager.adminLoanApplicationsGetHandler)
+	adminSubRouter.With(can(PermissionLoansView)).Get("/loan-applications/{applicationID}", handlerManager.adminLoanApplicationGetHandler)
+	adminSubRouter.With(can(PermissionLoansApprove)).Post("/loan-applications/{applicationID}/decision", handlerManager.adminLoanApplicationDecisionPostHandler)
+	adminSubRouter.With(can(PermissionLoansApprove)).Post("/loan-applications/{applicationID}/disburse", handlerManager.adminLoanApplicationDisbursePostHandler)
+	adminSubRouter.With(can(PermissionReportsView)).Get("/loans/overdue", handlerManager.adminOverdueLoansGetHandler)
+	adminSubRouter.With(can(PermissionInvestmentsView)).Get("/investments", handlerManager.adminInvestmentsGetHandler)
+	adminSubRouter.With(can(PermissionInvestmentsManage)).Post("/investments/products", handlerManager.adminInvestmentProductsPostHandler)
+	adminSubRouter.With(can(PermissionInvestmentsManage)).Post("/investments/products/{productID}/active", handlerManager.adminInvestmentProductActivePostHandler)
+	adminSubRouter.With(can(PermissionInvestmentsView)).Get("/investment-applications", handlerManager.adminInvestmentApplicationsGetHandler)
+	adminSubRouter.With(can(PermissionInvestmentsView)).Get("/investment-applications/{applicationID}", handlerManager.adminInvestmentApplicationGetHandler)
+	adminSubRouter.With(can(PermissionInvestmentsApprove)).Post("/investment-applications/{applicationID}/decision", handlerManager.adminInvestmentApplicationDecisionPostHandler)
+	adminSubRouter.With(can(PermissionWithdrawalsView)).Get("/withdrawals", handlerManager.adminWithdrawalsGetHandler)
+	adminSubRouter.With(can(PermissionWithdrawalsView)).Get("/withdrawals/{withdrawalID}", handlerManager.adminWithdrawalGetHandler)
+	adminSubRouter.With(can(PermissionWithdrawalsApprove)).Post("/withdrawals/{withdrawalID}/decision", handlerManager.adminWithdrawalDecisionPostHandler)
+	adminSubRouter.With(can(PermissionWithdrawalsApprove)).Post("/withdrawals/{withdrawalID}/payout", handlerManager.adminWithdrawalPayoutPostHandler)
+	adminSubRouter.With(can(PermissionUsersView)).Get("/users/{customerID}", handlerManager.adminUserGetHandler)
+	adminSubRouter.With(can(PermissionUsersSuspend)).Post("/users/{customerID}/suspension", handlerManager.adminUserSuspensionPostHandler)
+	adminSubRouter.With(can(PermissionBalancesAdjust)).Post("/users/{customerID}/adjustments", handlerManager.adminUserAdjustmentPostHandler)
+	// actions proposed by one admin are approved by another with the
+	// permission the action needs, which is checked for each action.
+	// Admins that can't decide any kind of action can't see them.
+	actionPermissions := adminActionPermissions()
+	adminSubRouter.With(can(actionPermissions...)).Get("/actions", handlerManager.adminActionsGetHandler)
+	adminSubRouter.With(can(actionPermissions...)).Get("/actions/{actionID}", handlerManager.adminActionGetHandler)
+	adminSubRouter.With(can(actionPermissions...)).Post("/actions/{actionID}/decision", handlerManager.adminActionDecisionPostHandler)
+	adminSubRouter.With(can(PermissionRolesAssign)).Get("/roles", handlerManager.adminRolesGetHandler)
+	adminSubRouter.With(can(PermissionRolesAssign)).Post("/roles", handlerManager.adminRolesPostHandler)
 
 	fs := http.FileServer(http.Dir("./web_app/templates/static/"))
 	r.Handle("/static/*", http.StripPrefix("/static/", fs))
 
 	cleanUpFunction := func() error {
-		firstError := cleanUp()
-		secondError := db.Conn.Close()
-		if firstError != nil {
-			log.Printf("error with cleanup %s \n", firstError)
-		}
-		if secondError != nil {
-			log.Printf("error with cleanup %s \n", secondError)
+		stopWorker()
+		if err := db.Conn.Close(); err != nil {
+			log.Printf("error with cleanup %s \n", err)
 			os.Exit(1)
 		}
 		return nil
@@ -33,7 +33,13 @@ type UserSession struct {
 
 var ErrNotAdmin = errors.New("user is not an admin user")
 
-// Role is Admin, or Basic. This is used to restrict access to the admin routes
+// Role is Admin, or Basic. This is used to restrict access to the admin
+// routes, and what an admin can do there is restricted by the
+// permissions of their admin roles
+const (
+	RoleAdmin = "Admin"
+	RoleBasic = "Basic"
+)
 
 var sessionStore = make(map[uuid.UUID]UserSession)
 
@@ -95,3 +101,13 @@ func GetSession(sessionID uuid.UUID) (UserSession, error) {
 
 	return id, nil
 }
+
+// EndUserSessions logs a user out everywhere, e.g. when their account is
+// suspended
+func EndUserSessions(userID uint) {
+	for sessionID, session := range sessionStore {
+		if session.UserID == userID {
+			delete(sessionStore, sessionID)
+		}
+	}
+}
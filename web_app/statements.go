@@ -0,0 +1,391 @@
+package web_app
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+var (
+	ErrUnknownStatementFormat = errors.New("unknown statement format")
+	ErrStatementPlanNotFound  = errors.New("the customer doesn't have that plan")
+)
+
+const statementLogoPath = "./web_app/templates/static/images/images/PAZPryLogoTextInverted 1.png"
+
+// statementProducts are the products that a statement can be
+// generated for, keyed by the slug used in the form. Savings plans and
+// investment positions have a ledger account each, the others one per
+// customer. Money that has been invested moves out of the investments
+// account into its position's.
+var statementProducts = map[string]func(customerID, planID uint) LedgerAccount{
+	"solo-saver":     func(customerID, _ uint) LedgerAccount { return soloSavingsLedgerAccount(customerID) },
+	"target-savings": targetSavingsLedgerAccount,
+	"family-vault":   func(_, planID uint) LedgerAccount { return familyVaultLedgerAccount(planID) },
+	"investments":    func(customerID, _ uint) LedgerAccount { return investmentLedgerAccount(customerID) },
+	"investment":     investmentPositionLedgerAccount,
+	"loans":          func(customerID, _ uint) LedgerAccount { return loansReceivableLedgerAccount(customerID) },
+}
+
+var statementProductNames = map[string]string{
+	"solo-saver":     "Solo Saver",
+	"target-savings": "Target Savings",
+	"family-vault":   "Family Vault",
+	"investments":    "Investments",
+	"investment":     "Investment",
+	"loans":          "Loans",
+}
+
+// statementPlanStatements look up the name of a plan the customer
+// saves into, or an investment they hold, for the products that need a
+// plan chosen
+var statementPlanStatements = map[string]string{
+	"target-savings": GetStatementTargetSavingsPlanStatement,
+	"family-vault":   GetStatementFamilyVaultPlanStatement,
+	"investment":     GetStatementInvestmentPositionStatement,
+}
+
+// StatementPlan is a savings plan or an investment that a statement can
+// be generated for
+type StatementPlan struct {
+	Product string
+	ID      uint
+	Name    string
+}
+
+type StatementRequest struct {
+	Product string
+	// Plan is only set for products with a ledger account per plan
+	Plan uint
+	// From is inclusive, To is exclusive
+	From   time.Time
+	To     time.Time
+	Format string
+}
+
+type StatementLedgerEntry struct {
+	Reference   string
+	Description string
+	Direction   LedgerDirection
+	Amount      Money
+	CreatedAt   time.Time
+}
+
+type StatementLine struct {
+	Date        time.Time
+	Description string
+	Reference   string
+	Debit       Money
+	Credit      Money
+	Balance     Money
+}
+
+type StatementInformation struct {
+	CustomerName   string
+	EmailAddress   string
+	Product        string
+	PlanName       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance Money
+	ClosingBalance Money
+	Lines          []StatementLine
+	GeneratedAt    time.Time
+}
+
+// parseStatementRequest reads the statement form. The "to" date is
+// inclusive on the form and exclusive on the request.
+func parseStatementRequest(form url.Values) (StatementRequest, map[string]string) {
+	var errorsMap = make(map[string]string)
+	var request StatementRequest
+
+	request.Product = form.Get("product")
+	if _, ok := statementProducts[request.Product]; !ok {
+		errorsMap["Product"] = "Choose a product"
+	}
+
+	if _, ok := statementPlanStatements[request.Product]; ok {
+		plan, err := strconv.ParseUint(form.Get("plan"), 10, 64)
+		if err != nil || plan == 0 {
+			errorsMap["Plan"] = "Choose a plan"
+		}
+		request.Plan = uint(plan)
+	}
+
+	from, err := time.Parse("2006-01-02", form.Get("from"))
+	if err != nil {
+		errorsMap["From"] = "Enter a valid start date"
+	}
+	request.From = from
+
+	to, err := time.Parse("2006-01-02", form.Get("to"))
+	if err != nil {
+		errorsMap["To"] = "Enter a valid end date"
+	}
+	request.To = to.AddDate(0, 0, 1)
+
+	if len(errorsMap) == 0 && !request.From.Before(request.To) {
+		errorsMap["To"] = "The end date must be after the start date"
+	}
+
+	request.Format = form.Get("format")
+	if request.Format != "pdf" && request.Format != "csv" {
+		errorsMap["Format"] = "Choose PDF or CSV"
+	}
+
+	return request, errorsMap
+}
+
+// buildStatementLines walks the entries in order and keeps a running
+// balance on the account's normal side
+func buildStatementLines(accountType LedgerAccountType, openingBalance Money, entries []StatementLedgerEntry) ([]StatementLine, Money, error) {
+	balance := openingBalance
+	lines := make([]StatementLine, 0, len(entries))
+
+	for _, entry := range entries {
+		var err error
+		balance, err = balance.Add(normalBalance(accountType, entry.Direction, entry.Amount))
+		if err != nil {
+			return lines, balance, err
+		}
+
+		line := StatementLine{
+			Date:        entry.CreatedAt,
+			Description: entry.Description,
+			Reference:   entry.Reference,
+			Balance:     balance,
+		}
+
+		if entry.Direction == LedgerDebit {
+			line.Debit = entry.Amount
+		} else {
+			line.Credit = entry.Amount
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, balance, nil
+}
+
+// statementDescriptions turns the journal's idempotency key prefixes
+// into descriptions a customer can read
+var statementDescriptions = map[string]string{
+	"PAYMENT":           "Card top-up",
+	"WITHDRAWAL":        "Withdrawal",
+	"INTEREST":          "Interest",
+	"LOAN_DISBURSEMENT": "Loan disbursement",
+	"LOAN_REPAYMENT":    "Loan repayment",
+	"OPENING_BALANCES":  "Balance brought forward",
+	"PAYOUT":            "Payout to your bank account",
+	"PAYOUT_RELEASED":   "Payout returned",
+	"PAYOUT_REVERSED":   "Payout reversed by your bank",
+	"REFUND":            "Refund",
+	"REFUND_FAILED":     "Refund returned",
+	"DISPUTE":           "Held for a disputed payment",
+	"DISPUTE_WON":       "Disputed payment released",
+	// investment keys end with what happened to the investment
+	"INVESTMENT_POSITION:OPENED":      "Invested",
+	"INVESTMENT_POSITION:RETURN":      "Investment return",
+	"INVESTMENT_POSITION:ROLLED_OVER": "Rolled over into a new investment",
+	"INVESTMENT_POSITION:PAID_OUT":    "Paid out to your Solo Saver",
+}
+
+// statementDescription splits an idempotency key like
+// PAYMENT:<reference> or INVESTMENT_POSITION:<id>:OPENED into a
+// description and a reference
+func statementDescription(idempotencyKey, fallback string) (string, string) {
+	prefix, reference, _ := strings.Cut(idempotencyKey, ":")
+
+	if id, event, ok := strings.Cut(reference, ":"); ok {
+		if description, ok := statementDescriptions[prefix+":"+event]; ok {
+			return description, id
+		}
+	}
+
+	description, ok := statementDescriptions[prefix]
+	if !ok {
+		return fallback, reference
+	}
+	return description, reference
+}
+
+func (s StatementInformation) ProductName() string {
+	if s.PlanName != "" {
+		return fmt.Sprintf("%s (%s)", statementProductNames[s.Product], s.PlanName)
+	}
+	return statementProductNames[s.Product]
+}
+
+func (s StatementInformation) Filename(format string) string {
+	return fmt.Sprintf("paz-%s-statement-%s-%s.%s", s.Product, s.From.Format("2006-01-02"), s.To.AddDate(0, 0, -1).Format("2006-01-02"), format)
+}
+
+func writeStatement(w io.Writer, format string, statement StatementInformation) error {
+	switch format {
+	case "csv":
+		return writeStatementCSV(w, statement)
+	case "pdf":
+		return writeStatementPDF(w, statement)
+	}
+	return ErrUnknownStatementFormat
+}
+
+func writeStatementCSV(w io.Writer, statement StatementInformation) error {
+	writer := csv.NewWriter(w)
+	period := fmt.Sprintf("%s to %s", statement.From.Format("2006-01-02"), statement.To.AddDate(0, 0, -1).Format("2006-01-02"))
+
+	records := [][]string{
+		{"Paz Finance account statement"},
+		{"Customer", statement.CustomerName},
+		{"Email", statement.EmailAddress},
+		{"Product", statement.ProductName()},
+		{"Period", period},
+		{},
+		{"Date", "Description", "Reference", "Debit (NGN)", "Credit (NGN)", "Balance (NGN)"},
+		{statement.From.Format("2006-01-02"), "Opening balance", "", "", "", statement.OpeningBalance.Decimal()},
+	}
+
+	for _, line := range statement.Lines {
+		records = append(records, []string{
+			line.Date.Format("2006-01-02 15:04"),
+			line.Description,
+			line.Reference,
+			statementAmount(line.Debit, Money.Decimal),
+			statementAmount(line.Credit, Money.Decimal),
+			line.Balance.Decimal(),
+		})
+	}
+
+	records = append(records, []string{statement.To.AddDate(0, 0, -1).Format("2006-01-02"), "Closing balance", "", "", "", statement.ClosingBalance.Decimal()})
+
+	if err := writer.WriteAll(records); err != nil {
+		return err
+	}
+
+	return writer.Error()
+}
+
+// statementAmount leaves empty cells empty, so that the debit and
+// credit columns read like a bank statement
+func statementAmount(amount Money, format func(Money) string) string {
+	if amount.IsZero() {
+		return ""
+	}
+	return format(amount)
+}
+
+// writeStatementPDF renders the statement with the core PDF fonts, so
+// that it doesn't need any font files or network access. The core
+// fonts don't have the naira sign, so amounts are labelled NGN.
+func writeStatementPDF(w io.Writer, statement StatementInformation) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(fmt.Sprintf("Paz Finance %s statement", statement.ProductName()), true)
+	pdf.SetAuthor("Paz Finance", true)
+	pdf.SetAutoPageBreak(true, 15)
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(78, 90, 102)
+		pdf.CellFormat(0, 6, fmt.Sprintf("Generated %s. Page %d", statement.GeneratedAt.Format("2 Jan 2006 15:04"), pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+
+	// brand header
+	pdf.SetFillColor(36, 61, 125)
+	pdf.Rect(0, 0, 210, 28, "F")
+	if _, err := os.Stat(statementLogoPath); err == nil {
+		pdf.ImageOptions(statementLogoPath, 10, 7, 0, 14, false, fpdf.ImageOptions{ReadDpi: true}, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetXY(100, 10)
+	pdf.CellFormat(100, 8, "Account statement", "", 0, "R", false, 0, "")
+
+	pdf.SetTextColor(41, 39, 39)
+	pdf.SetXY(10, 34)
+	pdf.SetFont("Helvetica", "", 10)
+	details := [][2]string{
+		{"Customer", statement.CustomerName},
+		{"Email", statement.EmailAddress},
+		{"Product", statement.ProductName()},
+		{"Period", fmt.Sprintf("%s to %s", statement.From.Format("2 Jan 2006"), statement.To.AddDate(0, 0, -1).Format("2 Jan 2006"))},
+		{"Opening balance", "NGN " + statement.OpeningBalance.Grouped()},
+		{"Closing balance", "NGN " + statement.ClosingBalance.Grouped()},
+	}
+	for _, detail := range details {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, 6, detail[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 6, detail[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	widths := []float64{28, 50, 40, 22, 24, 26}
+	aligns := []string{"L", "L", "L", "R", "R", "R"}
+	headers := []string{"Date", "Description", "Reference", "Debit (NGN)", "Credit (NGN)", "Balance (NGN)"}
+
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetFillColor(141, 204, 254)
+	for i, header := range headers {
+		pdf.CellFormat(widths[i], 8, header, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	// rows grow to fit descriptions and references that wrap, so that
+	// references can still be matched against the provider's records
+	pdf.SetFont("Helvetica", "", 8)
+	_, pageHeight := pdf.GetPageSize()
+	_, bottomMargin := pdf.GetAutoPageBreak()
+	const lineHeight = 5.0
+	row := func(cells ...string) {
+		lines := statementCellLines(pdf, widths, cells)
+		height := lineHeight
+		for _, cellLines := range lines {
+			height = max(height, float64(len(cellLines))*lineHeight)
+		}
+		if pdf.GetY()+height > pageHeight-bottomMargin {
+			pdf.AddPage()
+		}
+
+		left, top := pdf.GetXY()
+		x := left
+		for i, cellLines := range lines {
+			pdf.Rect(x, top, widths[i], height, "D")
+			for j, line := range cellLines {
+				pdf.SetXY(x, top+float64(j)*lineHeight)
+				pdf.CellFormat(widths[i], lineHeight, line, "", 0, aligns[i], false, 0, "")
+			}
+			x += widths[i]
+		}
+		pdf.SetXY(left, top+height)
+	}
+
+	row(statement.From.Format("02 Jan 2006"), "Opening balance", "", "", "", statement.OpeningBalance.Grouped())
+	for _, line := range statement.Lines {
+		row(line.Date.Format("02 Jan 2006 15:04"), line.Description, line.Reference, statementAmount(line.Debit, Money.Grouped), statementAmount(line.Credit, Money.Grouped), line.Balance.Grouped())
+	}
+	row(statement.To.AddDate(0, 0, -1).Format("02 Jan 2006"), "Closing balance", "", "", "", statement.ClosingBalance.Grouped())
+
+	return pdf.Output(w)
+}
+
+// statementCellLines splits each cell's text into the lines that fit
+// its column
+func statementCellLines(pdf *fpdf.Fpdf, widths []float64, cells []string) [][]string {
+	lines := make([][]string, len(cells))
+	for i, cell := range cells {
+		lines[i] = pdf.SplitText(cell, widths[i])
+	}
+	return lines
+}
@@ -0,0 +1,190 @@
+package web_app
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+func testStatement(t *testing.T) StatementInformation {
+	t.Helper()
+
+	from := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	entries := []StatementLedgerEntry{
+		{Reference: "a", Description: "Card top-up", Direction: LedgerCredit, Amount: 150050, CreatedAt: from.Add(time.Hour)},
+		{Reference: "b", Description: "Withdrawal", Direction: LedgerDebit, Amount: 50000, CreatedAt: from.Add(48 * time.Hour)},
+	}
+
+	lines, closing, err := buildStatementLines(LedgerLiability, 10000, entries)
+	if err != nil {
+		t.Fatalf("did not expect an error building the statement: %q", err)
+	}
+
+	return StatementInformation{
+		CustomerName:   "Tester Xavi",
+		EmailAddress:   "tester@xavi.com",
+		Product:        "solo-saver",
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: 10000,
+		ClosingBalance: closing,
+		Lines:          lines,
+		GeneratedAt:    from,
+	}
+}
+
+func TestStatementLines(t *testing.T) {
+	t.Run("keeps a running balance from the opening balance", func(t *testing.T) {
+		statement := testStatement(t)
+
+		if statement.Lines[0].Balance != 160050 {
+			t.Errorf("expected the first running balance to be 160050, got %d", statement.Lines[0].Balance)
+		}
+
+		if statement.ClosingBalance != 110050 {
+			t.Errorf("expected the closing balance to be 110050, got %d", statement.ClosingBalance)
+		}
+
+		if statement.Lines[1].Debit != 50000 || statement.Lines[1].Credit != 0 {
+			t.Errorf("expected the withdrawal in the debit column, got %+v", statement.Lines[1])
+		}
+	})
+
+	t.Run("a loan disbursement increases the amount owed", func(t *testing.T) {
+		entries := []StatementLedgerEntry{{Direction: LedgerDebit, Amount: 500000}}
+		_, closing, err := buildStatementLines(LedgerAsset, 0, entries)
+
+		if err != nil || closing != 500000 {
+			t.Errorf("expected 500000 owed, got %d (%v)", closing, err)
+		}
+	})
+
+	t.Run("describes journal keys", func(t *testing.T) {
+		description, reference := statementDescription("PAYMENT:3f1c", "deposit into SOLO_SAVINGS:1")
+
+		if description != "Card top-up" || reference != "3f1c" {
+			t.Errorf("got %q and %q", description, reference)
+		}
+
+		description, reference = statementDescription("INVESTMENT_POSITION:12:OPENED", "transfer")
+		if description != "Invested" || reference != "12" {
+			t.Errorf("got %q and %q", description, reference)
+		}
+	})
+}
+
+func TestStatementOutput(t *testing.T) {
+	t.Run("writes a CSV with opening, transaction and closing rows", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := writeStatement(&buffer, "csv", testStatement(t)); err != nil {
+			t.Fatalf("did not expect an error writing the CSV: %q", err)
+		}
+
+		reader := csv.NewReader(&buffer)
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			t.Fatalf("the CSV could not be read back: %q", err)
+		}
+
+		last := records[len(records)-1]
+		if last[1] != "Closing balance" || last[5] != "1100.50" {
+			t.Errorf("unexpected closing row %v", last)
+		}
+
+		var firstTransaction []string
+		for _, record := range records {
+			if len(record) > 1 && record[1] == "Card top-up" {
+				firstTransaction = record
+			}
+		}
+		if firstTransaction == nil || firstTransaction[4] != "1500.50" || firstTransaction[5] != "1600.50" {
+			t.Errorf("unexpected transaction row %v", firstTransaction)
+		}
+	})
+
+	t.Run("writes a PDF", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := writeStatement(&buffer, "pdf", testStatement(t)); err != nil {
+			t.Fatalf("did not expect an error writing the PDF: %q", err)
+		}
+
+		if !bytes.HasPrefix(buffer.Bytes(), []byte("%PDF-")) {
+			t.Error("expected the output to be a PDF document")
+		}
+	})
+
+	t.Run("wraps references instead of cutting them short", func(t *testing.T) {
+		pdf := fpdf.New("P", "mm", "A4", "")
+		pdf.SetFont("Helvetica", "", 8)
+
+		reference := "5f0c2a7e-8d3b-4c1e-9a6f-2b7d4e8c1a90"
+		lines := statementCellLines(pdf, []float64{28, 40}, []string{"02 Jan 2024 15:04", reference})
+		if strings.Join(lines[1], "") != reference {
+			t.Errorf("the reference came out as %q", lines[1])
+		}
+	})
+
+	t.Run("rejects unknown formats", func(t *testing.T) {
+		if err := writeStatement(&bytes.Buffer{}, "xlsx", testStatement(t)); err != ErrUnknownStatementFormat {
+			t.Errorf("expected %q, got %v", ErrUnknownStatementFormat, err)
+		}
+	})
+}
+
+func TestStatementRequest(t *testing.T) {
+	t.Run("parses a valid request", func(t *testing.T) {
+		form := url.Values{"product": {"solo-saver"}, "from": {"2024-04-01"}, "to": {"2024-04-30"}, "format": {"csv"}}
+		request, errorsMap := parseStatementRequest(form)
+
+		if len(errorsMap) != 0 {
+			t.Fatalf("did not expect errors, got %v", errorsMap)
+		}
+
+		if !request.To.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("expected the end date to be inclusive, got %s", request.To)
+		}
+	})
+
+	t.Run("needs a plan for savings plans", func(t *testing.T) {
+		form := url.Values{"product": {"target-savings"}, "from": {"2024-04-01"}, "to": {"2024-04-30"}, "format": {"pdf"}}
+		if _, errorsMap := parseStatementRequest(form); errorsMap["Plan"] == "" {
+			t.Errorf("expected an error for the plan")
+		}
+
+		form.Set("plan", "12")
+		request, errorsMap := parseStatementRequest(form)
+		if len(errorsMap) != 0 || request.Plan != 12 {
+			t.Errorf("got plan %d and %v", request.Plan, errorsMap)
+		}
+
+		if account := statementProducts["family-vault"](4, 12); account != familyVaultLedgerAccount(12) {
+			t.Errorf("got the ledger account %+v", account)
+		}
+
+		form.Set("product", "investment")
+		if _, errorsMap := parseStatementRequest(form); len(errorsMap) != 0 {
+			t.Errorf("got %v", errorsMap)
+		}
+		if account := statementProducts["investment"](4, 12); account != investmentPositionLedgerAccount(4, 12) {
+			t.Errorf("got the ledger account %+v", account)
+		}
+	})
+
+	t.Run("reports missing fields", func(t *testing.T) {
+		_, errorsMap := parseStatementRequest(url.Values{})
+
+		for _, key := range []string{"Product", "From", "To", "Format"} {
+			if errorsMap[key] == "" {
+				t.Errorf("expected an error for %s", key)
+			}
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package web_app
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const transactionHistoryPageSize = 20
+const recentActivityCount = 5
+
+// transactionProducts maps the URL slugs used by the history pages to
+// the product names used by the history query
+var transactionProducts = map[string]string{
+	"solo-saver":     "SOLO_SAVINGS",
+	"target-savings": "TARGET_SAVINGS",
+	"family-vault":   "FAMILY_SAVINGS",
+	"loans":          "LOANS",
+	"investments":    "INVESTMENTS",
+}
+
+var transactionProductNames = map[string]string{
+	"SOLO_SAVINGS":   "Solo Saver",
+	"TARGET_SAVINGS": "Target Savings",
+	"FAMILY_SAVINGS": "Family Vault",
+	"LOANS":          "Loans",
+	"INVESTMENTS":    "Investments",
+}
+
+type TransactionHistoryFilter struct {
+	// From is inclusive, To is exclusive. Zero values mean no bound
+	From      time.Time
+	To        time.Time
+	Product   string
+	Status    string
+	Direction string
+	Page      int
+	PageSize  int
+}
+
+func (f TransactionHistoryFilter) Offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// QueryString rebuilds the filter as query parameters for the given
+// page, so that pagination links keep the user's filters
+func (f TransactionHistoryFilter) QueryString(page int) string {
+	values := url.Values{}
+
+	if !f.From.IsZero() {
+		values.Set("from", f.From.Format("2006-01-02"))
+	}
+	if !f.To.IsZero() {
+		// the form's "to" date is inclusive
+		values.Set("to", f.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	for slug, product := range transactionProducts {
+		if product == f.Product {
+			values.Set("product", slug)
+		}
+	}
+	if f.Status != "" {
+		values.Set("status", strings.ToLower(f.Status))
+	}
+	if f.Direction != "" {
+		values.Set("direction", strings.ToLower(f.Direction))
+	}
+	values.Set("page", strconv.Itoa(page))
+
+	return values.Encode()
+}
+
+type TransactionRecord struct {
+	Reference string
+	// Product is one of the values of transactionProducts
+	Product string
+	// Direction is IN for money coming into the customer's Paz
+	// accounts (top-ups, loan disbursements) and OUT for money
+	// leaving them (withdrawals, loan repayments)
+	Direction string
+	Status    string
+	Amount    Money
+	CreatedAt time.Time
+}
+
+func (t TransactionRecord) ProductName() string {
+	return transactionProductNames[t.Product]
+}
+
+func (t TransactionRecord) Description() string {
+	switch {
+	case t.Product == "LOANS" && t.Direction == "IN":
+		return "Loan disbursed"
+	case t.Product == "LOANS":
+		return "Loan repayment"
+	case t.Direction == "OUT":
+		return fmt.Sprintf("Withdrawal from %s", t.ProductName())
+	}
+	return fmt.Sprintf("%s top-up", t.ProductName())
+}
+
+func (t TransactionRecord) Activity() Activity {
+	return Activity{
+		PrimaryInformation:   t.Description(),
+		SecondaryInformation: fmt.Sprintf("%s · %s", t.Amount, strings.ToLower(t.Status)),
+		Time:                 t.CreatedAt,
+	}
+}
+
+// parseTransactionHistoryFilter reads the history filters from the
+// query string. product is the URL slug from the per-product pages
+// and takes precedence over the query string. Invalid values are
+// reported in the returned map, keyed like the other forms' Errors.
+func parseTransactionHistoryFilter(query url.Values, product string) (TransactionHistoryFilter, map[string]string) {
+	var errorsMap = make(map[string]string)
+	filter := TransactionHistoryFilter{Page: 1, PageSize: transactionHistoryPageSize}
+
+	if product == "" {
+		product = query.Get("product")
+	}
+
+	if product != "" {
+		name, ok := transactionProducts[product]
+		if !ok {
+			errorsMap["Product"] = "Unknown product"
+		}
+		filter.Product = name
+	}
+
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			errorsMap["From"] = "Enter a valid start date"
+		}
+		filter.From = parsed
+	}
+
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			errorsMap["To"] = "Enter a valid end date"
+		} else {
+			filter.To = parsed.AddDate(0, 0, 1)
+		}
+	}
+
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		errorsMap["To"] = "The end date must be after the start date"
+	}
+
+	switch status := strings.ToUpper(query.Get("status")); status {
+	case "", "SUCCESSFUL", "PENDING", "FAILED":
+		filter.Status = status
+	default:
+		errorsMap["Status"] = "Unknown status"
+	}
+
+	switch direction := strings.ToUpper(query.Get("direction")); direction {
+	case "", "IN", "OUT":
+		filter.Direction = direction
+	default:
+		errorsMap["Direction"] = "Unknown direction"
+	}
+
+	if page := query.Get("page"); page != "" {
+		converted, err := strconv.Atoi(page)
+		if err != nil || converted < 1 {
+			errorsMap["Page"] = "Invalid page"
+		} else {
+			filter.Page = converted
+		}
+	}
+
+	return filter, errorsMap
+}
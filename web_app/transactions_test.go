@@ -0,0 +1,101 @@
+package web_app
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTransactionHistoryFilter(t *testing.T) {
+	t.Run("defaults to the first page with no filters", func(t *testing.T) {
+		filter, errorsMap := parseTransactionHistoryFilter(url.Values{}, "")
+
+		if len(errorsMap) != 0 {
+			t.Fatalf("did not expect errors, got %v", errorsMap)
+		}
+
+		if filter.Page != 1 || filter.PageSize != transactionHistoryPageSize {
+			t.Errorf("expected page 1 of size %d, got page %d of size %d", transactionHistoryPageSize, filter.Page, filter.PageSize)
+		}
+
+		if filter.Product != "" || filter.Status != "" || filter.Direction != "" {
+			t.Errorf("expected empty filters, got %+v", filter)
+		}
+	})
+
+	t.Run("makes the end date inclusive", func(t *testing.T) {
+		query := url.Values{"from": {"2024-04-01"}, "to": {"2024-04-30"}}
+		filter, errorsMap := parseTransactionHistoryFilter(query, "")
+
+		if len(errorsMap) != 0 {
+			t.Fatalf("did not expect errors, got %v", errorsMap)
+		}
+
+		want := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		if !filter.To.Equal(want) {
+			t.Errorf("expected the end bound to be %s, got %s", want, filter.To)
+		}
+	})
+
+	t.Run("the product in the URL wins over the query string", func(t *testing.T) {
+		query := url.Values{"product": {"loans"}}
+		filter, _ := parseTransactionHistoryFilter(query, "solo-saver")
+
+		if filter.Product != "SOLO_SAVINGS" {
+			t.Errorf("expected SOLO_SAVINGS, got %q", filter.Product)
+		}
+	})
+
+	t.Run("reports invalid values", func(t *testing.T) {
+		query := url.Values{
+			"product":   {"crypto"},
+			"from":      {"yesterday"},
+			"status":    {"lost"},
+			"direction": {"sideways"},
+			"page":      {"0"},
+		}
+		_, errorsMap := parseTransactionHistoryFilter(query, "")
+
+		for _, key := range []string{"Product", "From", "Status", "Direction", "Page"} {
+			if errorsMap[key] == "" {
+				t.Errorf("expected an error for %s", key)
+			}
+		}
+	})
+
+	t.Run("rejects an end date before the start date", func(t *testing.T) {
+		query := url.Values{"from": {"2024-04-10"}, "to": {"2024-04-01"}}
+		_, errorsMap := parseTransactionHistoryFilter(query, "")
+
+		if errorsMap["To"] == "" {
+			t.Error("expected an error when the end date is before the start date")
+		}
+	})
+
+	t.Run("pagination links keep the filters", func(t *testing.T) {
+		query := url.Values{"product": {"loans"}, "status": {"pending"}, "to": {"2024-04-30"}}
+		filter, _ := parseTransactionHistoryFilter(query, "")
+
+		got, _ := url.ParseQuery(filter.QueryString(2))
+
+		if got.Get("product") != "loans" || got.Get("status") != "pending" || got.Get("to") != "2024-04-30" || got.Get("page") != "2" {
+			t.Errorf("pagination query lost filters: %v", got)
+		}
+	})
+}
+
+func TestTransactionRecordActivity(t *testing.T) {
+	// loan disbursements come from their payout, and are pending until
+	// the transfer has ended
+	disbursement := TransactionRecord{Reference: "5f0c9b1e-2d1f-4d6a-9a53-3c1f8e0b7a21", Product: "LOANS", Direction: "IN", Status: StatusPending, Amount: 2_000_000_00}
+
+	activity := disbursement.Activity()
+	if activity.PrimaryInformation != "Loan disbursed" || activity.SecondaryInformation != "₦2,000,000.00 · pending" {
+		t.Errorf("got %+v", activity)
+	}
+
+	repayment := TransactionRecord{Product: "LOANS", Direction: "OUT", Status: StatusSuccessful, Amount: 50_000_00}
+	if got := repayment.Description(); got != "Loan repayment" {
+		t.Errorf("got %q, want %q", got, "Loan repayment")
+	}
+}
@@ -8,6 +8,23 @@ import (
 )
 
 type IStore interface {
+	ReconciliationStore
+	WebhookEventStore
+	PayoutStore
+	RefundStore
+	LoanStore
+	LoanApplicationStore
+	DelinquencyStore
+	CreditStore
+	BankStatementStore
+	GuarantorStore
+	InvestmentStore
+	InvestmentApplicationStore
+	InvestmentMaturityStore
+	WithdrawalApplicationStore
+	AdminRoleStore
+	CustomerAccountStore
+	AdminActionStore
 	AuthenticateUser(email string, password string) (LoginPostInformation, error)
 	RegisterUser(firstName, lastName, email, password string) (RegisterPostInformation, error)
 	GetHomeScreenInformation(userID uint) (HomeScreenInformation, error)
@@ -19,17 +36,20 @@ type IStore interface {
 	GetTargetSavingsScreenInformation(userID uint) (TargetSavingsScreenInformation, error)
 	GetTargetSavingsPlanScreenInformation(userID uint, planID int) (TargetSavingsPlanScreenInformation, error)
 	GetLoansScreenInformation(userID uint) (LoansScreenInformation, error)
-	CreateLoanApplication(userID uint, amount uint64, termDuration uint64, bvn uint64) (LoanApplicationInformation, error)
 	GetThriftScreenInformation(userID uint) (ThriftScreenInformation, error)
-	CreatePayment(userID, planID uint, referenceNumber uuid.UUID, paymentoriginator string, amountInK int64) (PaymentInformation, error)
+	CreatePayment(userID, planID uint, referenceNumber uuid.UUID, paymentoriginator string, amount Money, provider string) (PaymentInformation, error)
 	GetLoanScreenInformation(userID uint) (GetLoanScreenInformation, error)
-	CreateNewFamilyVault(userID uint, familyName, familyMemberEmail string, amount float64, frequency string, duration int64) (FamilyVaultInformation, error)
-	GetPaystackVerificationInformation(referenceNumber string) (PaystackTransactionInformation, error)
-	UpdateSoloSaverPaymentInformation(amountInK uint64, referenceNumber uuid.UUID) (SoloSaverPaymentInformation, error)
-	UpdateSoloSaverPaymentFailure(referenceNumber uuid.UUID) (SoloSaverPaymentInformation, error)
-	CreateInvestmentApplication(userID uint, employmentInformation string, yearOfEmployment time.Time, employerName string, investmentAmount uint64, investmentTenure uint64, taxIdentificationNumber uint64, bankAccountName string, bankAccountNumber uint64) (InvestmentApplicationInformation, error)
+	CreateNewFamilyVault(userID uint, familyName, familyMemberEmail string, amount Money, frequency string, duration int64) (FamilyVaultInformation, error)
 	GetInvestmentsScreenInformation(userID uint) (InvestmentsScreenInformation, error)
 	GetAdminHomeScreenInformation(userID uint) (AdminHomeScreenInformation, error)
+	PostSoloSaverWithdrawal(userID uint, amount Money, reference string) (LedgerPostingInformation, error)
+	PostSoloSaverInterest(userID uint, amount Money, reference string) (LedgerPostingInformation, error)
+	PostSoloSaverAdjustment(userID uint, amount Money, credit bool, reference string) (LedgerPostingInformation, error)
+	GetLedgerBalance(accountCode string) (Money, error)
+	CheckLedgerInvariants() ([]LedgerDiscrepancy, error)
+	GetTransactionHistory(userID uint, filter TransactionHistoryFilter) (TransactionHistoryInformation, error)
+	GetStatementInformation(userID uint, request StatementRequest) (StatementInformation, error)
+	GetStatementPlans(userID uint) ([]StatementPlan, error)
 }
 
 type User struct {
@@ -48,9 +68,9 @@ type Activity struct {
 type HomeScreenInformation struct {
 	FirstName         string
 	LastName          string
-	SavingsBalance    int64
-	LoansBalance      int64
-	InvestmentBalance int64
+	SavingsBalance    Money
+	LoansBalance      Money
+	InvestmentBalance Money
 	Activities        []Activity
 	isBVNAdded        bool
 	isDebitCardAdded  bool
@@ -71,7 +91,7 @@ type ProfileScreenInformation struct {
 
 type FamilyVaultScreenInformation struct {
 	FamilyVaultBasicPlans []FamilyVaultBasicPlan
-	Balance               string
+	Balance               Money
 }
 
 type FamilyVaultPlanScreenInformation = FamilyVaultBasicPlan
@@ -85,14 +105,14 @@ type NextOfKin struct {
 }
 
 type SavingsScreenInformation struct {
-	Balance uint64
+	Balance Money
 }
 
 type BasicSavingsPlan struct {
 	PlanID          uint
 	Name            string
 	Description     string
-	Amount          uint64
+	Amount          Money
 	OwnerStatus     bool
 	NumberOfMembers uint
 }
@@ -101,20 +121,23 @@ type FamilyVaultBasicPlan struct {
 	ID              string
 	Name            string
 	Description     string
-	Balance         string
+	Balance         Money
 	IsCreator       bool
 	NumberOfMembers uint
 }
 
 type SoloSaverScreenInformation struct {
-	Balance           uint64
-	Accounts          []DBUserBankAccount
+	Balance Money
+	// OnHold is the part of Balance that is on hold for loans the
+	// customer has guaranteed, and can't be withdrawn
+	OnHold            Money
+	Accounts          []BankAccount
 	EmailAddress      string
 	HasPendingPayment bool
 }
 
 type TargetSavingsScreenInformation struct {
-	Balance uint64
+	Balance Money
 	Plans   []TargetSavingsBasicPlan
 }
 
@@ -122,17 +145,23 @@ type TargetSavingsBasicPlan struct {
 	ID                   string
 	Name                 string
 	Description          string
-	Balance              uint64
+	Balance              Money
 	CompletionPercentage uint
-	Goal                 uint64
+	Goal                 Money
 }
 
 type TargetSavingsPlanScreenInformation struct {
 }
 
 type LoansScreenInformation struct {
-	Balance         int64
+	Balance         Money
 	HasPendingLoans bool
+	// Loan is the loan being repaid, if HasLoan
+	Loan       Loan
+	HasLoan    bool
+	Repayments []LoanRepayment
+	// Applications are the customer's loan applications, newest first
+	Applications []LoanApplication
 }
 
 type ThriftScreenInformation struct {
@@ -148,19 +177,24 @@ type ThriftBasicPlan struct {
 	NumberOfMembers uint
 }
 
-type DBUserBankAccount struct {
-	// this is the representation of the account in the DB
-	// the views should send the accounts to the frontend through hash values
-	ID   string
-	Name string
-}
-
 type HandlerManager struct {
-	partialsManager   IPartialsManager
-	store             IStore
-	cookieStore       *sessions.CookieStore
-	paystackPublicKey string
-	paystackSecretKey string
+	partialsManager IPartialsManager
+	store           IStore
+	cookieStore     *sessions.CookieStore
+	payments        *PaymentProviders
+	// baseURL is where the server can be reached from outside, for
+	// the links that we give to payment providers
+	baseURL  string
+	webhooks *WebhookWorker
+	payouts  *PayoutService
+	refunds  *RefundService
+	// credit is the policy that loan applications are scored with
+	credit CreditPolicy
+	// notifier sends guarantors their invitations, and customers the
+	// decisions made on what they asked for
+	notifier Notifier
+	// approvals is how large a withdrawal or loan one admin can approve
+	approvals ApprovalPolicy
 }
 
 type LoginData struct {
@@ -172,13 +206,6 @@ type VerificationData struct {
 	Message string
 }
 
-type SoloSaverAddFundsRequestType struct {
-	Amount          int64
-	Account         int64
-	ReferenceNumber uuid.UUID
-	// SessionToken string
-}
-
 type TransactionInformation struct {
 	// TODO: iota is a better representation
 	Status          string
@@ -188,18 +215,24 @@ type TransactionInformation struct {
 type LoginPostInformation struct {
 	UserIsVerified bool
 	UserIsAdmin    bool
-	Email          string
-	ID             uint
+	// UserIsSuspended customers can't log in
+	UserIsSuspended bool
+	Email           string
+	ID              uint
 }
 
 type RegisterPostInformation struct {
 }
 
-type LoanApplicationInformation struct {
-}
-
 type GetLoanScreenInformation struct {
-	HasValidBVN bool
+	HasValidBVN  bool
+	BankAccounts []BankAccount
+	// Application is the customer's application in progress, if
+	// HasApplicationInProgress
+	Application              LoanApplication
+	HasApplicationInProgress bool
+	// Guarantors are the guarantors nominated for Application
+	Guarantors []LoanGuarantor
 }
 
 type FamilyVaultInformation struct {
@@ -213,30 +246,46 @@ type PaystackTransactionInformation struct {
 	PlanID                    uint
 	ReferenceNumber           uuid.UUID
 	PaymentOriginator         string
-	PaymentAmountInKobo       int64
+	PaymentAmount             Money
+	PaymentProvider           string
 	FulfillmentStatus         string
 	FulfillmentFailureReason  string
 	VerificationStatus        string
 	VerificationFailureReason string
 	CreatedAt                 time.Time
 	VerifiedAt                time.Time
-}
-
-type SoloSaverPaymentInformation struct {
+	// FlaggedAt is set when the reconciliation job couldn't settle the
+	// payment, and an admin has to look at it
+	FlaggedAt  time.Time
+	FlagReason string
 }
 
 type PaymentInformation struct {
 }
 
-type InvestmentApplicationInformation struct {
-}
-
 type InvestmentsScreenInformation struct {
-	Balance uint64
+	Balance   Money
+	Positions []InvestmentPosition
+	// Applications are the customer's applications, their draft
+	// included, newest first
+	Applications []InvestmentApplication
+	// Products are the products that are offered
+	Products []InvestmentProduct
 }
 
+// AdminHomeScreenInformation counts what is waiting for an admin to
+// decide on in each queue
 type AdminHomeScreenInformation struct {
 	LoanRequests        int
+	LoansUnderReview    int
 	InvestmentsRequests int
 	WithdrawalRequests  int
+	// ActionsToApprove are actions waiting for a second admin
+	ActionsToApprove int
+}
+
+type TransactionHistoryInformation struct {
+	Filter       TransactionHistoryFilter
+	Transactions []TransactionRecord
+	HasNextPage  bool
 }
@@ -0,0 +1,197 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Every webhook we receive is saved before anything is done with it,
+// then processed by the WebhookWorker. That way the provider gets its
+// acknowledgement straight away, a failure halfway through doesn't
+// lose the event, and failed events can be replayed.
+
+const (
+	webhookQueueSize     = 256
+	webhookSweepInterval = time.Minute
+	webhookSweepLimit    = 50
+	// webhookMaxBodySize is far more than any provider sends
+	webhookMaxBodySize = 1 << 20
+)
+
+var (
+	ErrWebhookEventDoesNotExist = errors.New("webhook event does not exist")
+	ErrWebhookSignatureInvalid  = errors.New("webhook event has an invalid signature and will not be processed")
+)
+
+type WebhookEvent struct {
+	ID       uint
+	Provider string
+	// EventID identifies the event at the provider. Providers resend
+	// events, so it is unique per provider.
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Signature      string
+	SignatureValid bool
+	Status         string
+	FailureReason  string
+	Attempts       int
+	ReceivedAt     time.Time
+	ProcessedAt    time.Time
+}
+
+type WebhookEventStore interface {
+	// SaveWebhookEvent returns the id of the saved event, and whether
+	// the provider had already sent it
+	SaveWebhookEvent(event WebhookEvent) (uint, bool, error)
+	GetWebhookEvent(id uint) (WebhookEvent, error)
+	// GetWebhookEvents lists events by status, newest first. An empty
+	// status lists every event.
+	GetWebhookEvents(status string, limit int) ([]WebhookEvent, error)
+	RecordWebhookEventOutcome(id uint, processingError error) error
+}
+
+// webhookEventToSave is what is kept of a webhook. A webhook without
+// a valid signature could have come from anyone, so only that it
+// arrived is kept, not what it said.
+func webhookEventToSave(providerName string, body []byte, signature string, webhook ProviderWebhook) WebhookEvent {
+	if webhook.SignatureValid {
+		return WebhookEvent{
+			Provider:       providerName,
+			EventID:        webhook.EventID,
+			EventType:      webhook.EventType,
+			Payload:        body,
+			Signature:      signature,
+			SignatureValid: true,
+		}
+	}
+
+	return WebhookEvent{
+		Provider:  providerName,
+		EventID:   truncateRunes(webhook.EventID, 128),
+		EventType: truncateRunes(webhook.EventType, 64),
+		Payload:   []byte{},
+	}
+}
+
+// truncateRunes cuts value down to fit a varchar(length) column
+func truncateRunes(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
+
+// WebhookProcessor acts on a saved webhook event. It must be safe to
+// call more than once for the same event.
+type WebhookProcessor func(ctx context.Context, event WebhookEvent) error
+
+type WebhookWorker struct {
+	store         WebhookEventStore
+	process       WebhookProcessor
+	queue         chan uint
+	sweepInterval time.Duration
+}
+
+func NewWebhookWorker(store WebhookEventStore, process WebhookProcessor) *WebhookWorker {
+	return &WebhookWorker{
+		store:         store,
+		process:       process,
+		queue:         make(chan uint, webhookQueueSize),
+		sweepInterval: webhookSweepInterval,
+	}
+}
+
+// Enqueue asks the worker to process a saved event. It never blocks
+// the webhook handler: when the queue is full the event stays pending
+// and the next sweep picks it up.
+func (w *WebhookWorker) Enqueue(id uint) {
+	select {
+	case w.queue <- id:
+	default:
+		log.Printf("webhook queue is full, event %d will be picked up by the next sweep", id)
+	}
+}
+
+// Run processes queued events until ctx is cancelled. It also sweeps
+// up pending events that were saved but never processed, e.g. because
+// the server restarted.
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-w.queue:
+			if err := w.Handle(ctx, id); err != nil {
+				log.Printf("webhook event %d failed: %s", id, err)
+			}
+		case <-ticker.C:
+			w.sweep(ctx)
+		}
+	}
+}
+
+func (w *WebhookWorker) sweep(ctx context.Context) {
+	pending, err := w.store.GetWebhookEvents(StatusPending, webhookSweepLimit)
+	if err != nil {
+		log.Printf("couldn't load pending webhook events: %s", err)
+		return
+	}
+
+	for _, event := range pending {
+		// events that arrived in the last moments are most likely
+		// still in the queue
+		if time.Since(event.ReceivedAt) < w.sweepInterval {
+			continue
+		}
+
+		if err := w.Handle(ctx, event.ID); err != nil {
+			log.Printf("webhook event %d failed: %s", event.ID, err)
+		}
+	}
+}
+
+// Handle processes a saved event and records the outcome. Replaying
+// an event is just handling it again.
+func (w *WebhookWorker) Handle(ctx context.Context, id uint) error {
+	event, err := w.store.GetWebhookEvent(id)
+	if err != nil {
+		return err
+	}
+
+	if !event.SignatureValid {
+		return ErrWebhookSignatureInvalid
+	}
+
+	processingError := w.process(ctx, event)
+
+	if err := w.store.RecordWebhookEventOutcome(id, processingError); err != nil {
+		return err
+	}
+
+	return processingError
+}
+
+// Replay handles the given events again, one after the other, and
+// returns how many of them succeeded
+func (w *WebhookWorker) Replay(ctx context.Context, ids ...uint) (int, error) {
+	var errs []error
+	succeeded := 0
+
+	for _, id := range ids {
+		if err := w.Handle(ctx, id); err != nil {
+			errs = append(errs, fmt.Errorf("event %d: %w", id, err))
+			continue
+		}
+		succeeded++
+	}
+
+	return succeeded, errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type FakeWebhookEventStore struct {
+	mu       sync.Mutex
+	events   map[uint]WebhookEvent
+	outcomes map[uint][]error
+}
+
+func NewFakeWebhookEventStore(events ...WebhookEvent) *FakeWebhookEventStore {
+	store := &FakeWebhookEventStore{events: map[uint]WebhookEvent{}, outcomes: map[uint][]error{}}
+	for _, event := range events {
+		store.events[event.ID] = event
+	}
+	return store
+}
+
+func (f *FakeWebhookEventStore) SaveWebhookEvent(event WebhookEvent) (uint, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, saved := range f.events {
+		if saved.Provider == event.Provider && saved.EventID == event.EventID && saved.SignatureValid {
+			return id, true, nil
+		}
+	}
+
+	event.ID = uint(len(f.events) + 1)
+	event.Status = StatusPending
+	f.events[event.ID] = event
+	return event.ID, false, nil
+}
+
+func (f *FakeWebhookEventStore) GetWebhookEvent(id uint) (WebhookEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event, ok := f.events[id]
+	if !ok {
+		return event, ErrWebhookEventDoesNotExist
+	}
+	return event, nil
+}
+
+func (f *FakeWebhookEventStore) GetWebhookEvents(status string, limit int) ([]WebhookEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var events []WebhookEvent
+	for _, event := range f.events {
+		if status == "" || event.Status == status {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (f *FakeWebhookEventStore) RecordWebhookEventOutcome(id uint, processingError error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event := f.events[id]
+	event.Attempts++
+	event.Status = StatusSuccessful
+	if processingError != nil {
+		event.Status = StatusFailed
+	}
+	f.events[id] = event
+	f.outcomes[id] = append(f.outcomes[id], processingError)
+	return nil
+}
+
+func (f *FakeWebhookEventStore) status(id uint) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.events[id].Status
+}
+
+func TestWebhookWorker(t *testing.T) {
+	errFulfillment := errors.New("plan does not exist")
+
+	t.Run("records the processing outcome", func(t *testing.T) {
+		store := NewFakeWebhookEventStore(
+			WebhookEvent{ID: 1, SignatureValid: true, Status: StatusPending},
+			WebhookEvent{ID: 2, SignatureValid: true, Status: StatusPending},
+		)
+		worker := NewWebhookWorker(store, func(ctx context.Context, event WebhookEvent) error {
+			if event.ID == 2 {
+				return errFulfillment
+			}
+			return nil
+		})
+
+		if err := worker.Handle(context.Background(), 1); err != nil {
+			t.Errorf("did not expect an error, got %q", err)
+		}
+
+		if err := worker.Handle(context.Background(), 2); err != errFulfillment {
+			t.Errorf("expected %q, got %v", errFulfillment, err)
+		}
+
+		if store.status(1) != StatusSuccessful || store.status(2) != StatusFailed {
+			t.Errorf("unexpected statuses %s and %s", store.status(1), store.status(2))
+		}
+	})
+
+	t.Run("never processes events with a bad signature", func(t *testing.T) {
+		store := NewFakeWebhookEventStore(WebhookEvent{ID: 1, SignatureValid: false, Status: StatusFailed})
+		processed := false
+		worker := NewWebhookWorker(store, func(ctx context.Context, event WebhookEvent) error {
+			processed = true
+			return nil
+		})
+
+		if err := worker.Handle(context.Background(), 1); err != ErrWebhookSignatureInvalid {
+			t.Errorf("expected %q, got %v", ErrWebhookSignatureInvalid, err)
+		}
+
+		if processed {
+			t.Error("expected the event not to be processed")
+		}
+	})
+
+	t.Run("replays failed events", func(t *testing.T) {
+		store := NewFakeWebhookEventStore(WebhookEvent{ID: 1, SignatureValid: true, Status: StatusFailed})
+		worker := NewWebhookWorker(store, func(ctx context.Context, event WebhookEvent) error { return nil })
+
+		succeeded, err := worker.Replay(context.Background(), 1, 99)
+
+		if succeeded != 1 {
+			t.Errorf("expected one event to succeed, got %d", succeeded)
+		}
+
+		if !errors.Is(err, ErrWebhookEventDoesNotExist) {
+			t.Errorf("expected the unknown event to be reported, got %v", err)
+		}
+
+		if store.status(1) != StatusSuccessful {
+			t.Errorf("expected the replayed event to succeed, got %s", store.status(1))
+		}
+	})
+
+	t.Run("processes queued events in the background", func(t *testing.T) {
+		store := NewFakeWebhookEventStore(WebhookEvent{ID: 1, SignatureValid: true, Status: StatusPending})
+		done := make(chan struct{})
+		worker := NewWebhookWorker(store, func(ctx context.Context, event WebhookEvent) error {
+			close(done)
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go worker.Run(ctx)
+
+		worker.Enqueue(1)
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the queued event was not processed")
+		}
+	})
+
+	t.Run("enqueueing never blocks", func(t *testing.T) {
+		worker := NewWebhookWorker(NewFakeWebhookEventStore(), nil)
+
+		for i := 0; i < webhookQueueSize+10; i++ {
+			worker.Enqueue(uint(i))
+		}
+	})
+}
+
+func TestWebhookEventToSave(t *testing.T) {
+	body := []byte(`{"event":"charge.success","data":{"reference":"abc"}}`)
+
+	t.Run("keeps signed webhooks whole", func(t *testing.T) {
+		event := webhookEventToSave(ProviderPaystack, body, "signature", ProviderWebhook{EventID: "1", EventType: "charge.success", SignatureValid: true})
+		if string(event.Payload) != string(body) || event.Signature != "signature" || !event.SignatureValid {
+			t.Errorf("got %+v", event)
+		}
+	})
+
+	t.Run("only keeps that an unsigned webhook arrived", func(t *testing.T) {
+		longID := strings.Repeat("x", 500)
+		event := webhookEventToSave(ProviderPaystack, body, "forged", ProviderWebhook{EventID: longID, EventType: "charge.success"})
+		if len(event.Payload) != 0 || event.Signature != "" || event.SignatureValid {
+			t.Errorf("kept more than it should have: %+v", event)
+		}
+		if event.Provider != ProviderPaystack || event.EventType != "charge.success" || len(event.EventID) != 128 {
+			t.Errorf("got %+v", event)
+		}
+	})
+}
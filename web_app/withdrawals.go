@@ -0,0 +1,92 @@
+package web_app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Withdrawals from the solo saver wait in a queue until an admin
+// approves or rejects them. Approving one pays it out to the bank
+// account it was made for, and rejecting one tells the customer why.
+
+// WithdrawalPaying is how the queue shows pending withdrawals that have
+// been approved and are being paid out. The database keeps them
+// pending until their payout ends.
+const WithdrawalPaying = "PAYING"
+
+// The decisions an admin can make on a withdrawal
+const (
+	WithdrawalApproved = "APPROVED"
+	WithdrawalRejected = "REJECTED"
+)
+
+// Audit log actions for withdrawals
+const (
+	AuditWithdrawalApproved = "WITHDRAWAL_APPROVED"
+	AuditWithdrawalRejected = "WITHDRAWAL_REJECTED"
+)
+
+var ErrWithdrawalDecided = errors.New("the withdrawal has already been approved or rejected")
+
+// Decided is whether an admin has approved or rejected the withdrawal.
+// Only approved withdrawals are paid out.
+func (w WithdrawalApplication) Decided() bool {
+	return !w.ReviewedAt.IsZero()
+}
+
+// QueueStatus is the withdrawal's status, with approved withdrawals that
+// haven't been paid out yet shown as paying
+func (w WithdrawalApplication) QueueStatus() string {
+	if w.Status == StatusPending && w.Decided() {
+		return WithdrawalPaying
+	}
+	return w.Status
+}
+
+// CanPayOut is whether an approved withdrawal still has to be paid out,
+// e.g. because the provider couldn't be asked to when it was approved
+func (w WithdrawalApplication) CanPayOut() bool {
+	return w.QueueStatus() == WithdrawalPaying && w.PayoutStatus == ""
+}
+
+func isWithdrawalQueueStatus(status string) bool {
+	switch status {
+	case StatusPending, WithdrawalPaying, StatusSuccessful, StatusFailed:
+		return true
+	}
+	return false
+}
+
+func withdrawalAuditSubject(id uint) string {
+	return fmt.Sprintf("withdrawal:%d", id)
+}
+
+func withdrawalRejectedNotice(contact CustomerContact, withdrawal WithdrawalApplication, baseURL string) (string, string) {
+	return "Your withdrawal wasn't approved", fmt.Sprintf("Hi %s, we couldn't approve your withdrawal of %s: %s. The money is still in your Solo Saver at %s/dashboard/savings/solo-saver.",
+		contact.FirstName, withdrawal.Amount, withdrawal.DecisionNote, baseURL)
+}
+
+type WithdrawalApplicationStore interface {
+	// GetWithdrawalApplications lists withdrawals for the admin queue.
+	// A status of PAYING is the pending ones that have been approved,
+	// and PENDING the ones that haven't been decided yet.
+	GetWithdrawalApplications(filter AdminQueueFilter) ([]WithdrawalApplication, error)
+	// ApproveWithdrawalApplication and RejectWithdrawalApplication
+	// decide a pending withdrawal that hasn't been decided yet, and
+	// record it in the audit log. Rejected withdrawals fail with the
+	// note as their reason.
+	ApproveWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error)
+	RejectWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error)
+}
+
+// approveWithdrawal approves a withdrawal and pays it out. A payout
+// that couldn't be made leaves the withdrawal approved, to be paid out
+// again.
+func approveWithdrawal(ctx context.Context, store WithdrawalApplicationStore, payouts *PayoutService, id, adminID uint, note string) (Payout, error) {
+	if _, err := store.ApproveWithdrawalApplication(id, adminID, note); err != nil {
+		return Payout{}, err
+	}
+
+	return payouts.PayWithdrawal(ctx, id)
+}
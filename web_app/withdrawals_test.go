@@ -0,0 +1,131 @@
+package web_app
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// FakeWithdrawalApplicationStore decides withdrawals the way the
+// database does
+type FakeWithdrawalApplicationStore struct {
+	*FakePayoutStore
+	audit []AuditEntry
+}
+
+func (f *FakeWithdrawalApplicationStore) GetWithdrawalApplications(filter AdminQueueFilter) ([]WithdrawalApplication, error) {
+	var withdrawals []WithdrawalApplication
+	for _, withdrawal := range f.withdrawals {
+		if filter.Status == "" || withdrawal.QueueStatus() == filter.Status {
+			withdrawals = append(withdrawals, withdrawal)
+		}
+	}
+	return withdrawals, nil
+}
+
+func (f *FakeWithdrawalApplicationStore) ApproveWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error) {
+	return f.decide(id, adminID, StatusPending, AuditWithdrawalApproved, note)
+}
+
+func (f *FakeWithdrawalApplicationStore) RejectWithdrawalApplication(id, adminID uint, note string) (WithdrawalApplication, error) {
+	return f.decide(id, adminID, StatusFailed, AuditWithdrawalRejected, note)
+}
+
+func (f *FakeWithdrawalApplicationStore) decide(id, adminID uint, status, action, note string) (WithdrawalApplication, error) {
+	note, err := decisionNote(note)
+	if err != nil {
+		return WithdrawalApplication{}, err
+	}
+
+	withdrawal, err := f.GetWithdrawalApplication(id)
+	if err != nil {
+		return withdrawal, err
+	}
+	if withdrawal.Status != StatusPending || withdrawal.Decided() {
+		return withdrawal, ErrWithdrawalDecided
+	}
+
+	withdrawal.Status = status
+	withdrawal.DecisionNote = note
+	withdrawal.ReviewedBy = adminID
+	withdrawal.ReviewedAt = time.Now()
+	if status == StatusFailed {
+		withdrawal.FailureReason = note
+	}
+	f.withdrawals[id] = withdrawal
+	f.audit = append(f.audit, AuditEntry{Actor: adminActor(adminID), Action: action, Subject: withdrawalAuditSubject(id), Detail: note})
+	return withdrawal, nil
+}
+
+func TestWithdrawalQueueStatus(t *testing.T) {
+	withdrawal := WithdrawalApplication{Status: StatusPending}
+	if withdrawal.QueueStatus() != StatusPending || withdrawal.CanPayOut() {
+		t.Errorf("expected %+v to be waiting for a decision", withdrawal)
+	}
+
+	withdrawal.ReviewedAt = time.Now()
+	if withdrawal.QueueStatus() != WithdrawalPaying || !withdrawal.CanPayOut() {
+		t.Errorf("expected %+v to be waiting to be paid out", withdrawal)
+	}
+
+	withdrawal.PayoutStatus = PayoutProcessing
+	if withdrawal.QueueStatus() != WithdrawalPaying || withdrawal.CanPayOut() {
+		t.Errorf("expected %+v to be being paid out", withdrawal)
+	}
+
+	withdrawal.Status = StatusSuccessful
+	if withdrawal.QueueStatus() != StatusSuccessful {
+		t.Errorf("expected %+v to have been paid", withdrawal)
+	}
+}
+
+func TestApproveWithdrawal(t *testing.T) {
+	ctx := context.Background()
+
+	newWithdrawal := func(t *testing.T) (*SandboxProvider, *PayoutService, *FakeWithdrawalApplicationStore, uint) {
+		sandbox, _, payoutStore, withdrawalID := newSandboxPayouts(t, 1000000, 400000)
+		store := &FakeWithdrawalApplicationStore{FakePayoutStore: payoutStore}
+		return sandbox, NewPayoutService(store, NewPaymentProviders(sandbox)), store, withdrawalID
+	}
+
+	t.Run("pays out what is approved", func(t *testing.T) {
+		sandbox, payouts, store, id := newWithdrawal(t)
+
+		payout, err := approveWithdrawal(ctx, store, payouts, id, 2, "customer confirmed by phone")
+		if err != nil {
+			t.Fatalf("did not expect an error, got %q", err)
+		}
+
+		if withdrawal := store.withdrawals[id]; withdrawal.QueueStatus() != WithdrawalPaying || withdrawal.ReviewedBy != 2 {
+			t.Errorf("expected the withdrawal to be approved, got %+v", withdrawal)
+		}
+
+		sandbox.CompleteTransfer(ctx, payout.Reference.String(), TransferSuccessful)
+		if withdrawal := store.withdrawals[id]; withdrawal.Status != StatusSuccessful || store.balances[1] != 600000 {
+			t.Errorf("expected the withdrawal to be paid, got %+v and a balance of %s", withdrawal, store.balances[1])
+		}
+	})
+
+	t.Run("needs a note", func(t *testing.T) {
+		_, payouts, store, id := newWithdrawal(t)
+
+		if _, err := approveWithdrawal(ctx, store, payouts, id, 2, " "); err != ErrDecisionNoteRequired {
+			t.Errorf("got %v, want %v", err, ErrDecisionNoteRequired)
+		}
+		if len(store.payouts) != 0 {
+			t.Errorf("expected no payout, got %d", len(store.payouts))
+		}
+	})
+
+	t.Run("doesn't pay out what was rejected", func(t *testing.T) {
+		_, payouts, store, id := newWithdrawal(t)
+		store.RejectWithdrawalApplication(id, 2, "account under review")
+
+		if _, err := approveWithdrawal(ctx, store, payouts, id, 2, "changed my mind"); err != ErrWithdrawalDecided {
+			t.Errorf("got %v, want %v", err, ErrWithdrawalDecided)
+		}
+		if withdrawal := store.withdrawals[id]; withdrawal.Status != StatusFailed || withdrawal.FailureReason != "account under review" || len(store.payouts) != 0 {
+			t.Errorf("expected the withdrawal to stay rejected, got %+v and %d payouts", withdrawal, len(store.payouts))
+		}
+	})
+}